@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"text/tabwriter"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/emitter"
+	"github.com/juliosaraiva/log2json/internal/parser"
+	"github.com/juliosaraiva/log2json/internal/reader"
+)
+
+// benchTime is how long each bench measurement repeats its pass over the
+// input, at least once.
+var benchTime = 500 * time.Millisecond
+
+// benchResult is one measured row of the bench report.
+type benchResult struct {
+	name       string
+	passes     int
+	elapsed    time.Duration
+	allocs     uint64
+	allocBytes uint64
+}
+
+// runBench measures the throughput of the configured parsers and of each
+// pipeline stage on the --file sample (or the whole input), and prints a
+// report to output. The sample is read into memory first, so disk speed
+// does not count.
+func runBench(cfg Config, input io.Reader, output io.Writer, errOutput io.Writer) error {
+	if cfg.BenchFile != "" {
+		f, err := os.Open(cfg.BenchFile)
+		if err != nil {
+			return fmt.Errorf("cannot open --file: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		input = f
+	}
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return fmt.Errorf("cannot read bench input: %w", err)
+	}
+	read, err := reader.New(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return fmt.Errorf("cannot read bench input: %w", err)
+	}
+	if len(read) == 0 {
+		return fmt.Errorf("bench input is empty")
+	}
+	lines := make([]string, len(read))
+	for i, line := range read {
+		lines[i] = line.Text
+	}
+
+	registry, plugin, closeParsers, err := buildRegistry(cfg, errOutput)
+	if err != nil {
+		return err
+	}
+	defer closeParsers()
+
+	// Check the transform options once; each pass builds a fresh chain
+	chain, err := buildTransforms(cfg, nil, plugin, errOutput)
+	if err != nil {
+		return err
+	}
+	hasTransforms := chain.Len() > 0
+	registry.WantFields(pushdownFields(cfg, chain))
+
+	// Parsers: the forced one, or every format auto-detection tries
+	var parsers []parser.Parser
+	switch {
+	case len(cfg.Patterns) > 0:
+		parsers = []parser.Parser{registry.GetParser("regex")}
+	case cfg.Format != "":
+		parsers = []parser.Parser{registry.GetParser(cfg.Format)}
+	default:
+		for _, info := range registry.ListParsers() {
+			parsers = append(parsers, registry.GetParser(info.Name))
+		}
+	}
+
+	tw := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+	name := "stdin"
+	if cfg.BenchFile != "" {
+		name = cfg.BenchFile
+	}
+	_, _ = fmt.Fprintf(tw, "bench: %d lines, %.2f MB from %s\n\n", len(lines), float64(len(data))/1e6, name)
+
+	_, _ = fmt.Fprintln(tw, "PARSER\tMATCHED\tLINES/S\tMB/S\tALLOCS/LINE\tBYTES/LINE")
+	for _, p := range parsers {
+		matched := 0
+		for _, line := range lines {
+			if entry, err := p.Parse(line); err == nil && entry.ParseError == nil {
+				matched++
+			}
+		}
+		// Entries are released as the pipeline releases them once emitted
+		r := measure(p.Name(), nil, func() {
+			for _, line := range lines {
+				if entry, err := p.Parse(line); err == nil {
+					entry.Release()
+				}
+			}
+		})
+		_, _ = fmt.Fprintf(tw, "%s\t%.1f%%\t%s\n", p.Name(), 100*float64(matched)/float64(len(lines)), r.columns(len(lines), len(data)))
+	}
+
+	// Pipeline stages, each timed on its own
+	if registry.AutoDetects() {
+		registry.Detect(lines[:min(len(lines), parser.DefaultSampleSize)])
+	}
+	parseAll := func() []*parser.Entry {
+		entries := make([]*parser.Entry, 0, len(lines))
+		for i, line := range lines {
+			if entry, err := registry.Parse(line); err == nil {
+				entry.LineNum = i + 1
+				entries = append(entries, entry)
+			}
+		}
+		return entries
+	}
+
+	var readOpts []reader.Option
+	if cfg.BufferSize > 0 {
+		readOpts = append(readOpts, reader.WithBufferSize(int(cfg.BufferSize)))
+	}
+	readAll := func() {
+		for range reader.New(bytes.NewReader(data), readOpts...).Lines() {
+		}
+	}
+	if cfg.Mmap && cfg.BenchFile != "" {
+		// Read the file itself, as --mmap reads a file given as stdin
+		readAll = func() {
+			f, err := os.Open(cfg.BenchFile)
+			if err != nil {
+				return
+			}
+			for range reader.New(f, append(readOpts, reader.WithMmap())...).Lines() {
+			}
+			_ = f.Close()
+		}
+	}
+
+	stages := []benchResult{
+		measure("read", nil, readAll),
+		measure("parse", nil, func() {
+			for _, line := range lines {
+				if entry, err := registry.Parse(line); err == nil {
+					entry.Release()
+				}
+			}
+		}),
+	}
+	if hasTransforms {
+		var entries []*parser.Entry
+		setup := func() {
+			entries = parseAll()
+			chain, _ = buildTransforms(cfg, nil, plugin, io.Discard)
+		}
+		stages = append(stages, measure("transform", setup, func() {
+			for _, entry := range entries {
+				chain.Process(entry)
+			}
+			chain.Flush()
+		}))
+	}
+	entries := parseAll()
+	emitOpts := emitterOptions(cfg)
+	stages = append(stages, measure("emit", nil, func() {
+		emit := emitter.New(io.Discard, emitOpts)
+		for _, entry := range entries {
+			_ = emit.Emit(entry)
+		}
+		_ = emit.Close()
+	}))
+
+	// The whole pipeline takes the sum of the stages' time per line
+	total := benchResult{name: "total", passes: 1}
+	for _, r := range stages {
+		total.elapsed += r.elapsed / time.Duration(r.passes)
+		total.allocs += r.allocs / uint64(r.passes)
+		total.allocBytes += r.allocBytes / uint64(r.passes)
+	}
+
+	_, _ = fmt.Fprintln(tw, "\nSTAGE\tLINES/S\tMB/S\tALLOCS/LINE\tBYTES/LINE")
+	for _, r := range append(stages, total) {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\n", r.name, r.columns(len(lines), len(data)))
+	}
+	return tw.Flush()
+}
+
+// measure runs pass repeatedly, at least once and until benchTime has
+// passed, counting its time and allocations. setup, if non-nil, runs
+// before each pass and is not counted.
+func measure(name string, setup, pass func()) benchResult {
+	r := benchResult{name: name}
+	var before, after runtime.MemStats
+	for r.passes == 0 || r.elapsed < benchTime {
+		if setup != nil {
+			setup()
+		}
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+		pass()
+		r.elapsed += time.Since(start)
+		runtime.ReadMemStats(&after)
+		r.allocs += after.Mallocs - before.Mallocs
+		r.allocBytes += after.TotalAlloc - before.TotalAlloc
+		r.passes++
+	}
+	return r
+}
+
+// columns formats the throughput and allocation columns for a pass over
+// lines lines of size bytes.
+func (r benchResult) columns(lines, size int) string {
+	seconds := r.elapsed.Seconds()
+	if seconds == 0 {
+		seconds = 1e-9
+	}
+	processed := float64(r.passes * lines)
+	return fmt.Sprintf("%.0f\t%.1f\t%.1f\t%.0f",
+		processed/seconds,
+		float64(r.passes*size)/1e6/seconds,
+		float64(r.allocs)/processed,
+		float64(r.allocBytes)/processed)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Exit statuses, for scripts and CI jobs to tell a failed run from one
+// that completed with some bad lines.
+const (
+	exitOK          = 0
+	exitFailed      = 1 // invalid options, an unrecoverable error or an exceeded error budget
+	exitLinesFailed = 2 // completed, with failed lines within the error budget
+
+	// A run stopped by SIGINT or SIGTERM exits with 128 plus the signal
+	// number; see interruptedError.
+)
+
+// linesFailedError reports a run that completed, with lines that failed
+// to read, parse or write, under an error budget that allowed them.
+type linesFailedError struct {
+	failed, lines int
+}
+
+func (e *linesFailedError) Error() string {
+	return fmt.Sprintf("completed with errors: %d of %d lines failed", e.failed, e.lines)
+}
+
+// exitCode returns the exit status for the error run returned.
+func exitCode(err error) int {
+	var failed *linesFailedError
+	var interrupted *interruptedError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &interrupted):
+		return interrupted.exitStatus()
+	case errors.As(err, &failed):
+		return exitLinesFailed
+	}
+	return exitFailed
+}
+
+// errorBudget applies --fail-fast, --max-errors and --max-error-ratio:
+// how many of a run's lines may fail before it counts as failed.
+type errorBudget struct {
+	failFast  bool
+	maxErrors int     // 0: no limit
+	maxRatio  float64 // 0: no limit
+
+	lines  int // lines processed, after --match
+	errors int // lines that failed
+}
+
+func newErrorBudget(cfg Config) (*errorBudget, error) {
+	if cfg.MaxErrors < 0 {
+		return nil, fmt.Errorf("invalid --max-errors: must not be negative")
+	}
+	if cfg.MaxErrorRatio < 0 || cfg.MaxErrorRatio > 1 {
+		return nil, fmt.Errorf("invalid --max-error-ratio %v: must be between 0 and 1", cfg.MaxErrorRatio)
+	}
+	if cfg.FailFast && (cfg.MaxErrors > 0 || cfg.MaxErrorRatio > 0) {
+		return nil, fmt.Errorf("--fail-fast cannot be combined with --max-errors or --max-error-ratio")
+	}
+	return &errorBudget{failFast: cfg.FailFast, maxErrors: cfg.MaxErrors, maxRatio: cfg.MaxErrorRatio}, nil
+}
+
+// enabled reports whether any error policy was given. Without one, failed
+// lines are reported but the run succeeds, as it always has.
+func (b *errorBudget) enabled() bool {
+	return b.failFast || b.maxErrors > 0 || b.maxRatio > 0
+}
+
+// fail counts a failed line. It returns an error once the run must stop:
+// at the first failure with --fail-fast, or past --max-errors.
+func (b *errorBudget) fail(line int, cause error) error {
+	b.errors++
+	switch {
+	case b.failFast:
+		return fmt.Errorf("--fail-fast: stopped at line %d: %w", line, cause)
+	case b.maxErrors > 0 && b.errors > b.maxErrors:
+		return fmt.Errorf("--max-errors %d exceeded: stopped at line %d: %w", b.maxErrors, line, cause)
+	}
+	return nil
+}
+
+// result returns the outcome of a run that read all its input: nil, a
+// *linesFailedError, or an error if more than --max-error-ratio of the
+// lines failed.
+func (b *errorBudget) result() error {
+	if b.errors == 0 || !b.enabled() {
+		return nil
+	}
+	if ratio := float64(b.errors) / float64(b.lines); b.maxRatio > 0 && ratio > b.maxRatio {
+		return fmt.Errorf("--max-error-ratio %v exceeded: %d of %d lines failed (%.1f%%)", b.maxRatio, b.errors, b.lines, 100*ratio)
+	}
+	return &linesFailedError{failed: b.errors, lines: b.lines}
+}
+
+// defaultErrorRatioWindow is how many recent lines --abort-on-error-ratio
+// looks at by default.
+const defaultErrorRatioWindow = 1000
+
+// errorBreaker applies --abort-on-error-ratio: it trips once more than a
+// ratio of the last window lines failed to parse, as happens when the
+// format of an input changes upstream. A run then stops, or with
+// --error-ratio-passthrough writes the rest of its lines raw.
+type errorBreaker struct {
+	ratio       float64
+	passthrough bool
+
+	recent  []bool // whether each of the last lines failed, oldest at next when full
+	next    int
+	failed  int // failures in recent
+	tripped bool
+}
+
+// newErrorBreaker returns nil when cfg has no --abort-on-error-ratio.
+func newErrorBreaker(cfg Config) (*errorBreaker, error) {
+	switch {
+	case cfg.AbortOnErrorRatio < 0 || cfg.AbortOnErrorRatio >= 1:
+		return nil, fmt.Errorf("invalid --abort-on-error-ratio %v: must be more than 0 and less than 1", cfg.AbortOnErrorRatio)
+	case cfg.ErrorRatioWindow < 0:
+		return nil, fmt.Errorf("invalid --error-ratio-window: must not be negative")
+	case cfg.AbortOnErrorRatio == 0 && (cfg.ErrorRatioWindow > 0 || cfg.ErrorRatioPassthrough):
+		return nil, fmt.Errorf("--error-ratio-window and --error-ratio-passthrough require --abort-on-error-ratio")
+	case cfg.AbortOnErrorRatio == 0:
+		return nil, nil
+	}
+	window := cfg.ErrorRatioWindow
+	if window == 0 {
+		window = defaultErrorRatioWindow
+	}
+	return &errorBreaker{
+		ratio:       cfg.AbortOnErrorRatio,
+		passthrough: cfg.ErrorRatioPassthrough,
+		recent:      make([]bool, 0, window),
+	}, nil
+}
+
+// add records whether a line failed to parse, and reports whether that
+// tripped the breaker: the window is full, and more than the ratio of it
+// failed.
+func (b *errorBreaker) add(failed bool) bool {
+	if b.tripped {
+		return false
+	}
+	if len(b.recent) < cap(b.recent) {
+		b.recent = append(b.recent, failed)
+	} else {
+		if b.recent[b.next] {
+			b.failed--
+		}
+		b.recent[b.next] = failed
+		b.next = (b.next + 1) % len(b.recent)
+	}
+	if failed {
+		b.failed++
+	}
+	if len(b.recent) == cap(b.recent) && float64(b.failed) > b.ratio*float64(len(b.recent)) {
+		b.tripped = true
+	}
+	return b.tripped
+}
+
+// err describes the breaker tripping at line.
+func (b *errorBreaker) err(line int) error {
+	return fmt.Errorf("--abort-on-error-ratio %v exceeded: %d of the last %d lines failed to parse, at line %d", b.ratio, b.failed, len(b.recent), line)
+}
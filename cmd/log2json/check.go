@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/emitter"
+	"github.com/juliosaraiva/log2json/internal/parser"
+	"github.com/juliosaraiva/log2json/internal/reader"
+)
+
+// checkTimeout bounds each connection --check makes to a network output.
+const checkTimeout = 5 * time.Second
+
+// runCheck is --check. It runs once the options have been validated, the
+// parsers built and the expressions compiled: it checks that each output
+// can be written or reached, then with --check-lines parses that many
+// input lines and reports the formats that matched. Nothing is written to
+// the outputs.
+func runCheck(ctx context.Context, cfg Config, registry *parser.Registry, matchRe *regexp.Regexp, input io.Reader, output, errOutput io.Writer) error {
+	_, _ = fmt.Fprintln(output, "configuration: ok")
+
+	var failed int
+	for _, dest := range checkDestinations(cfg) {
+		if err := checkOutput(ctx, cfg, dest, errOutput); err != nil {
+			failed++
+			_, _ = fmt.Fprintf(output, "output %s: %v\n", outputName(dest), err)
+		} else {
+			_, _ = fmt.Fprintf(output, "output %s: ok\n", outputName(dest))
+		}
+	}
+
+	if cfg.CheckLines > 0 {
+		if err := checkSample(ctx, cfg, registry, matchRe, input, output); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("check failed: %d of the outputs cannot be written", failed)
+	}
+	return nil
+}
+
+// checkDestinations lists the outputs a run with cfg would write to, in
+// the order they were given, without duplicates.
+func checkDestinations(cfg Config) []string {
+	var dests []string
+	seen := make(map[string]bool)
+	add := func(dest string) {
+		if !seen[dest] {
+			seen[dest] = true
+			dests = append(dests, dest)
+		}
+	}
+
+	switch {
+	case cfg.OTLPEndpoint != "":
+		add(cfg.OTLPEndpoint)
+	case len(cfg.Outputs) == 0:
+		add("stdout")
+	}
+	for _, dest := range cfg.Outputs {
+		add(dest)
+	}
+	for _, spec := range cfg.Routes {
+		// The routes compiled before runCheck, so they parse
+		if _, dest, err := parseRoute(spec); err == nil && dest != "stdout" {
+			add(dest)
+		}
+	}
+	if cfg.SchemaErrors != "" {
+		add(cfg.SchemaErrors)
+	}
+	return dests
+}
+
+// checkOutput checks that dest could be written: a file can be created in
+// its directory, or a network output takes its options and accepts
+// connections. Network writers are closed before any entry is queued, so
+// they send nothing.
+func checkOutput(ctx context.Context, cfg Config, dest string, errOutput io.Writer) error {
+	var w io.Closer
+	var err error
+	switch {
+	case isStdout(dest), dest == "stderr":
+		return nil
+	case dest == cfg.OTLPEndpoint:
+		w, err = newOTLPExporter(cfg, emitter.Options{}, errOutput)
+	case emitter.IsESURL(dest):
+		w, err = newESWriter(cfg, dest, emitter.Options{}, errOutput)
+	case emitter.IsHTTPURL(dest):
+		w, err = newHTTPWriter(cfg, dest, emitter.Options{}, errOutput)
+	case emitter.IsSyslogURL(dest):
+		// Connecting is the check; a UDP collector cannot be probed
+		w, err = newSyslogWriter(cfg, dest, emitter.Options{})
+		if err != nil {
+			return err
+		}
+		return w.Close()
+	case emitter.IsForwardURL(dest):
+		w, err = newForwardWriter(cfg, dest, emitter.Options{}, errOutput)
+		if err != nil {
+			return err
+		}
+		return w.Close()
+	default:
+		return checkWritable(dest)
+	}
+	if err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return checkReachable(ctx, dest)
+}
+
+// checkWritable checks that path is not a directory and that a file can
+// be created next to it. The probe file is removed; path is not touched.
+func checkWritable(path string) error {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".log2json-check-*")
+	if err != nil {
+		return fmt.Errorf("cannot create files in %s: %w", filepath.Dir(path), err)
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkReachable connects to the host of an HTTP-based output: an
+// http(s):// or es:// --output, or the --otlp-endpoint.
+func checkReachable(ctx context.Context, dest string) error {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return err
+	}
+	port, secure := "80", false
+	if u.Scheme == "https" || u.Scheme == emitter.ESHTTPSScheme {
+		port, secure = "443", true
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	var conn net.Conn
+	if secure {
+		dialer := &tls.Dialer{Config: &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot connect: %w", err)
+	}
+	return conn.Close()
+}
+
+// checkSample parses the first --check-lines input lines and reports how
+// many lines each format matched.
+func checkSample(ctx context.Context, cfg Config, registry *parser.Registry, matchRe *regexp.Regexp, input io.Reader, output io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var sample []reader.Line
+	var texts []string
+	var skipped int
+	for line := range reader.New(input).LinesContext(ctx) {
+		if line.Err != nil {
+			return fmt.Errorf("cannot read input: %w", line.Err)
+		}
+		if matchRe != nil && matchRe.MatchString(line.Text) == cfg.InvertMatch {
+			skipped++
+		} else {
+			sample = append(sample, line)
+			texts = append(texts, line.Text)
+		}
+		if line.Number == cfg.CheckLines {
+			break
+		}
+	}
+
+	_, _ = fmt.Fprintf(output, "sample: %d lines", len(sample)+skipped)
+	if skipped > 0 {
+		_, _ = fmt.Fprintf(output, ", %d skipped by --match", skipped)
+	}
+	_, _ = fmt.Fprintln(output)
+	if registry.AutoDetects() {
+		if p := registry.Detect(texts); p != nil {
+			_, _ = fmt.Fprintf(output, "detected format: %s\n", p.Name())
+		} else {
+			_, _ = fmt.Fprintln(output, "detected format: none")
+		}
+	}
+
+	formats := make(map[string]int)
+	var empty, unmatched []int
+	for _, line := range sample {
+		entry, err := registry.Parse(line.Text)
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.ParseError == nil:
+			formats[entry.Format]++
+		case errors.Is(entry.ParseError, parser.ErrEmptyLine):
+			empty = append(empty, line.Number)
+		default:
+			unmatched = append(unmatched, line.Number)
+		}
+	}
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return formats[names[i]] > formats[names[j]] || formats[names[i]] == formats[names[j]] && names[i] < names[j]
+	})
+	for _, name := range names {
+		_, _ = fmt.Fprintf(output, "    %s: %d lines\n", name, formats[name])
+	}
+	if len(empty) > 0 {
+		_, _ = fmt.Fprintf(output, "    empty: %d lines\n", len(empty))
+	}
+	if len(unmatched) > 0 {
+		_, _ = fmt.Fprintf(output, "    no match: %d lines (%s)\n", len(unmatched), sampleLineNumbers(unmatched))
+	}
+	return nil
+}
+
+// sampleLineNumbers lists the first few of the line numbers.
+func sampleLineNumbers(lines []int) string {
+	const max = 5
+	parts := make([]string, 0, max+1)
+	for i, n := range lines {
+		if i == max {
+			parts = append(parts, "...")
+			break
+		}
+		parts = append(parts, fmt.Sprint(n))
+	}
+	return "lines " + strings.Join(parts, ", ")
+}
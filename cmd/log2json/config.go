@@ -0,0 +1,182 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/juliosaraiva/log2json/internal/yaml"
+)
+
+// configFileNames lists the config files loaded when --config is not
+// given, in order of preference: one in the working directory, then the
+// user's.
+func configFileNames() []string {
+	return []string{"log2json.yaml", filepath.Join(configDir(), "config.yaml")}
+}
+
+// configDir returns the directory of log2json's configuration files:
+// $XDG_CONFIG_HOME/log2json, or ~/.config/log2json.
+func configDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "log2json")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "log2json")
+}
+
+// formatsEnv names a list of extra directories of format definitions.
+const formatsEnv = "LOG2JSON_FORMATS_DIR"
+
+// formatsDirs returns the directories format definitions are loaded
+// from: the formats directory of configDir, if it exists, then those
+// listed in $LOG2JSON_FORMATS_DIR, which must exist.
+func formatsDirs() []string {
+	var dirs []string
+	if dir := filepath.Join(configDir(), "formats"); dirExists(dir) {
+		dirs = append(dirs, dir)
+	}
+	for _, dir := range filepath.SplitList(os.Getenv(formatsEnv)) {
+		if dir != "" && !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// applyConfigFile sets the flags of fs from a YAML config file whose keys
+// are flag names, such as format, match or output-format. Keys can be
+// grouped under sections of any name (parser:, outputs:, ...). Lists set
+// repeatable flags once per item and join into comma-separated values
+// for the others. Flags given on the command line, under any of their
+// names, keep their value.
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	doc, err := yaml.Unmarshal(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if doc == nil {
+		return nil
+	}
+	root, ok := doc.(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s: expected a mapping of option names to values", path)
+	}
+
+	// Aliases such as -f and --format share a flag.Value
+	var given []flag.Value
+	fs.Visit(func(f *flag.Flag) {
+		given = append(given, f.Value)
+	})
+
+	if err := applyConfigSection(fs, root, given); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func applyConfigSection(fs *flag.FlagSet, section map[string]any, given []flag.Value) error {
+	for key, v := range section {
+		f := fs.Lookup(key)
+		if f == nil {
+			sub, ok := v.(map[string]any)
+			if !ok {
+				return fmt.Errorf("unknown option %q", key)
+			}
+			if err := applyConfigSection(fs, sub, given); err != nil {
+				return err
+			}
+			continue
+		}
+		switch key {
+		case "config", "help", "h", "version", "V", "list", "l":
+			return fmt.Errorf("option %q cannot be set in a config file", key)
+		}
+		if isGiven(f.Value, given) {
+			continue
+		}
+
+		values, err := configValues(f.Value, v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		for _, value := range values {
+			if err := f.Value.Set(value); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+func isGiven(v flag.Value, given []flag.Value) bool {
+	for _, g := range given {
+		if g == v {
+			return true
+		}
+	}
+	return false
+}
+
+// configValues converts a config value to the strings to Set.
+func configValues(fv flag.Value, v any) ([]string, error) {
+	list, ok := v.([]any)
+	if !ok {
+		s, err := configString(v)
+		if err != nil {
+			return nil, err
+		}
+		return []string{s}, nil
+	}
+
+	items := make([]string, len(list))
+	for i, item := range list {
+		s, err := configString(item)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = s
+	}
+	switch fv.(type) {
+	case *stringList, listOrAllFlag:
+		return items, nil
+	}
+	return []string{strings.Join(items, ",")}, nil
+}
+
+func configString(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case nil:
+		return "", fmt.Errorf("missing value")
+	}
+	return "", fmt.Errorf("expected a single value or a list")
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+	"github.com/juliosaraiva/log2json/internal/reader"
+)
+
+// devMode is the kind of pattern the dev command edits.
+type devMode int
+
+const (
+	devRegex devMode = iota
+	devDissect
+)
+
+func (m devMode) String() string {
+	if m == devDissect {
+		return "dissect"
+	}
+	return "regex"
+}
+
+// devGroupColors are the ANSI colors of the regex groups the dev command
+// highlights, in turn.
+var devGroupColors = []string{"32", "36", "33", "35", "34"}
+
+// devSession is the state of the dev command: the sample lines, the
+// pattern being edited and the parser compiled from it.
+type devSession struct {
+	name      string // the sample file, for the title
+	lines     []string
+	inference parser.TypeInference
+
+	mode    devMode
+	pattern []rune
+	cursor  int
+
+	parser parser.Parser
+	regex  *regexp.Regexp // in regex mode, to highlight the groups
+	err    error
+}
+
+func newDevSession(name string, lines []string, inference parser.TypeInference, mode devMode, pattern string) *devSession {
+	s := &devSession{name: name, lines: lines, inference: inference, mode: mode, pattern: []rune(pattern)}
+	s.cursor = len(s.pattern)
+	s.compile()
+	return s
+}
+
+// compile builds the parser for the current pattern; an invalid pattern
+// leaves none and sets err.
+func (s *devSession) compile() {
+	s.parser, s.regex, s.err = nil, nil, nil
+	text := string(s.pattern)
+	if text == "" {
+		return
+	}
+	switch s.mode {
+	case devRegex:
+		p, err := parser.NewRegexParser(text)
+		if err != nil {
+			s.err = err
+			return
+		}
+		p.SetTypeInference(s.inference)
+		s.parser = p
+		s.regex = regexp.MustCompile(text) // NewRegexParser compiled it
+	case devDissect:
+		p, err := parser.NewDissectParser(text)
+		if err != nil {
+			s.err = err
+			return
+		}
+		p.SetTypeInference(s.inference)
+		s.parser = p
+	}
+}
+
+// key applies one key, reading the rest of an escape sequence from keys.
+// It reports whether the session is over, and if so whether the pattern
+// was accepted (Enter) rather than abandoned (Ctrl-C, Ctrl-D).
+func (s *devSession) key(r rune, keys *bufio.Reader) (done, accept bool) {
+	edited := false
+	switch r {
+	case '\r', '\n':
+		return true, true
+	case 0x03, 0x04: // Ctrl-C, Ctrl-D
+		return true, false
+	case '\t':
+		s.mode = 1 - s.mode
+		edited = true
+	case 0x7f, 0x08: // Backspace
+		if s.cursor > 0 {
+			s.pattern = append(s.pattern[:s.cursor-1], s.pattern[s.cursor:]...)
+			s.cursor--
+			edited = true
+		}
+	case 0x01: // Ctrl-A
+		s.cursor = 0
+	case 0x05: // Ctrl-E
+		s.cursor = len(s.pattern)
+	case 0x15: // Ctrl-U
+		s.pattern, s.cursor = s.pattern[:0], 0
+		edited = true
+	case 0x1b:
+		edited = s.escape(keys)
+	default:
+		if unicode.IsPrint(r) {
+			s.pattern = append(s.pattern[:s.cursor], append([]rune{r}, s.pattern[s.cursor:]...)...)
+			s.cursor++
+			edited = true
+		}
+	}
+	if edited {
+		s.compile()
+	}
+	return false, false
+}
+
+// escape handles the arrow, Home, End and Delete key sequences, and
+// reports whether the pattern changed.
+func (s *devSession) escape(keys *bufio.Reader) bool {
+	if b, err := keys.ReadByte(); err != nil || b != '[' {
+		return false
+	}
+	b, err := keys.ReadByte()
+	if err != nil {
+		return false
+	}
+	switch b {
+	case 'C':
+		s.cursor = min(s.cursor+1, len(s.pattern))
+	case 'D':
+		s.cursor = max(s.cursor-1, 0)
+	case 'H':
+		s.cursor = 0
+	case 'F':
+		s.cursor = len(s.pattern)
+	case '3':
+		if next, err := keys.ReadByte(); err == nil && next == '~' && s.cursor < len(s.pattern) {
+			s.pattern = append(s.pattern[:s.cursor], s.pattern[s.cursor+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// render draws the screen: the sample lines on the left, with what the
+// pattern matched highlighted, their fields as JSON on the right, and the
+// pattern being edited at the bottom.
+func (s *devSession) render(w io.Writer, width, height int) error {
+	width, height = max(width, 20), max(height, 6)
+	var b bytes.Buffer
+	b.WriteString("\x1b[H\x1b[2J")
+	title := fmt.Sprintf("log2json dev %s (%d lines): %s pattern. Tab: switch to %s, Enter: print pattern and exit, Ctrl-C: quit",
+		s.name, len(s.lines), s.mode, 1-s.mode)
+	b.WriteString("\x1b[1m" + truncate(title, width) + "\x1b[0m\n")
+	b.WriteString(strings.Repeat("─", width) + "\n")
+
+	left := (width - 3) / 2
+	right := width - 3 - left
+	rows := min(len(s.lines), height-5)
+	matched := 0
+	for i, line := range s.lines {
+		entry := s.parse(line)
+		if entry != nil && entry.ParseError == nil {
+			matched++
+		}
+		if i >= rows {
+			continue
+		}
+		b.WriteString(s.highlight(line, entry, left))
+		b.WriteString(" │ ")
+		switch {
+		case entry == nil:
+		case entry.ParseError != nil:
+			b.WriteString("\x1b[31m" + truncate(entry.ParseError.Error(), right) + "\x1b[0m")
+		default:
+			data, _ := json.Marshal(entry.Fields)
+			b.WriteString(truncate(string(data), right))
+		}
+		b.WriteString("\n")
+	}
+	for i := rows; i < height-5; i++ {
+		b.WriteString("\n")
+	}
+
+	b.WriteString(strings.Repeat("─", width) + "\n")
+	switch {
+	case s.err != nil:
+		b.WriteString("\x1b[31m" + truncate(s.err.Error(), width) + "\x1b[0m\n")
+	case s.parser != nil:
+		_, _ = fmt.Fprintf(&b, "%d of %d lines match\n", matched, len(s.lines))
+	default:
+		b.WriteString("type a pattern\n")
+	}
+	prompt := s.mode.String() + "> "
+	b.WriteString(prompt + string(s.pattern))
+	_, _ = fmt.Fprintf(&b, "\x1b[%d;%dH", height, utf8.RuneCountInString(prompt)+s.cursor+1)
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// parse parses a sample line with the current pattern, or returns nil if
+// there is none.
+func (s *devSession) parse(line string) *parser.Entry {
+	if s.parser == nil {
+		return nil
+	}
+	entry, err := s.parser.Parse(line)
+	if err != nil {
+		entry = parser.NewEntry(line)
+		entry.ParseError = err
+	}
+	return entry
+}
+
+// highlight returns line cut to width and padded to it, with the text
+// each regex group matched in its color, or the whole line in green if
+// a dissect pattern parsed it.
+func (s *devSession) highlight(line string, entry *parser.Entry, width int) string {
+	line = strings.ReplaceAll(line, "\t", " ")
+	cut := len(line)
+	if n := utf8.RuneCountInString(line); n > width {
+		cut = runeOffset(line, width)
+	}
+	pad := strings.Repeat(" ", width-utf8.RuneCountInString(line[:cut]))
+
+	if entry == nil || entry.ParseError != nil {
+		return line[:cut] + pad
+	}
+	if s.regex == nil {
+		return "\x1b[32m" + line[:cut] + "\x1b[0m" + pad
+	}
+
+	// color[i] is the group that matched byte i, or -1
+	color := make([]int, cut)
+	for i := range color {
+		color[i] = -1
+	}
+	loc := s.regex.FindStringSubmatchIndex(line)
+	for g := 1; g < len(loc)/2; g++ {
+		for i := loc[2*g]; i >= 0 && i < loc[2*g+1] && i < cut; i++ {
+			color[i] = g - 1
+		}
+	}
+	var b strings.Builder
+	current := -1
+	for i := 0; i < cut; i++ {
+		if color[i] != current {
+			if current >= 0 {
+				b.WriteString("\x1b[0m")
+			}
+			if color[i] >= 0 {
+				b.WriteString("\x1b[" + devGroupColors[color[i]%len(devGroupColors)] + "m")
+			}
+			current = color[i]
+		}
+		b.WriteByte(line[i])
+	}
+	if current >= 0 {
+		b.WriteString("\x1b[0m")
+	}
+	return b.String() + pad
+}
+
+// runeOffset returns the byte offset of the nth rune of s.
+func runeOffset(s string, n int) int {
+	for i := range s {
+		if n == 0 {
+			return i
+		}
+		n--
+	}
+	return len(s)
+}
+
+// truncate cuts s to width runes, marking the cut with an ellipsis.
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	if width <= 1 {
+		return s[:runeOffset(s, width)]
+	}
+	return s[:runeOffset(s, width-1)] + "…"
+}
+
+// run redraws the screen after each key until the session is over, and
+// reports whether the pattern was accepted.
+func (s *devSession) run(keys *bufio.Reader, screen io.Writer, size func() (int, int)) (bool, error) {
+	for {
+		width, height := size()
+		if err := s.render(screen, width, height); err != nil {
+			return false, err
+		}
+		r, _, err := keys.ReadRune()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if done, accept := s.key(r, keys); done {
+			return accept, nil
+		}
+	}
+}
+
+// runDevCommand is the dev command: a terminal UI, drawn on stderr, for
+// writing a regex or dissect pattern against the lines of a sample file.
+// The pattern accepted with Enter is printed to stdout, so it can be
+// captured: log2json -p "$(log2json dev sample.log)".
+func runDevCommand(cfg Config, stdin *os.File, stdout io.Writer, stderr *os.File) error {
+	if cfg.DevSample == "" {
+		return fmt.Errorf("the dev command needs a sample file: log2json dev [OPTIONS] sample.log")
+	}
+	if len(cfg.Patterns) > 1 {
+		return fmt.Errorf("the dev command edits a single --pattern")
+	}
+	f, err := os.Open(cfg.DevSample)
+	if err != nil {
+		return fmt.Errorf("cannot open sample file: %w", err)
+	}
+	lines, err := reader.New(f).ReadAll()
+	_ = f.Close()
+	if err != nil {
+		return fmt.Errorf("cannot read sample file: %w", err)
+	}
+	if !isTerminal(stdin) || !isTerminal(stderr) {
+		return fmt.Errorf("the dev command needs an interactive terminal")
+	}
+
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = line.Text
+	}
+	var pattern string
+	if len(cfg.Patterns) == 1 {
+		pattern = cfg.Patterns[0]
+	}
+	s := newDevSession(cfg.DevSample, texts, typeInference(cfg), devRegex, pattern)
+
+	restore, err := makeRaw(int(stdin.Fd()))
+	if err != nil {
+		return fmt.Errorf("cannot set up the terminal: %w", err)
+	}
+	size := func() (int, int) {
+		width, height, err := terminalSize(int(stderr.Fd()))
+		if err != nil {
+			return 80, 24
+		}
+		return width, height
+	}
+	_, _ = io.WriteString(stderr, "\x1b[?1049h") // alternate screen
+	accept, err := s.run(bufio.NewReader(stdin), stderr, size)
+	_, _ = io.WriteString(stderr, "\x1b[?1049l")
+	restore()
+	if err != nil {
+		return err
+	}
+
+	if accept && len(s.pattern) > 0 {
+		if s.mode == devDissect {
+			_, _ = fmt.Fprintln(stderr, "dissect patterns are used from a --patterns-file: dissect: '...'")
+		}
+		_, _ = fmt.Fprintln(stdout, string(s.pattern))
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/dockerlog"
+	"github.com/juliosaraiva/log2json/internal/emitter"
+)
+
+// defaultDockerSocket is where a managed Docker plugin serves its API;
+// the daemon finds it through the interface socket of the plugin's
+// config.json.
+const defaultDockerSocket = "/run/docker/plugins/log2json.sock"
+
+// dockerStopTimeout bounds how long StopLogging waits for a container's
+// remaining entries before it closes the FIFO.
+const dockerStopTimeout = 10 * time.Second
+
+// runDockerPlugin is the docker-plugin command: a Docker logging driver
+// serving the plugin API on cfg.DockerSocket until ctx is done. Each
+// container's stdout and stderr run through a pipeline of their own, with
+// the container's details added as fields, to the network outputs.
+func runDockerPlugin(ctx context.Context, cfg Config, errOutput io.Writer) error {
+	if len(cfg.Routes) > 0 || cfg.HealthListen != "" || cfg.ForwardListen != "" || cfg.KubeNodeLogs != "" {
+		return fmt.Errorf("the docker-plugin command does not support --route, --health-listen, --forward-listen or --kube-node-logs")
+	}
+	if cfg.OTLPEndpoint == "" && len(cfg.Outputs) == 0 {
+		return fmt.Errorf("the docker-plugin command needs an http(s)://, es://, syslog:// or forward:// --output, or --otlp-endpoint")
+	}
+	for _, dest := range cfg.Outputs {
+		if !emitter.IsHTTPURL(dest) && !emitter.IsESURL(dest) && !emitter.IsSyslogURL(dest) && !emitter.IsForwardURL(dest) {
+			return fmt.Errorf("the docker-plugin command forwards to network outputs, not %s", outputName(dest))
+		}
+	}
+
+	path := cfg.DockerSocket
+	if path == "" {
+		path = defaultDockerSocket
+	}
+	_ = os.Remove(path) // a socket left by an earlier run
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("cannot listen on --docker-socket: %w", err)
+	}
+	driver := &dockerDriver{ctx: ctx, cfg: cfg, errOutput: errOutput, streams: make(map[string]*dockerStream)}
+	server := &http.Server{Handler: dockerlog.NewHandler(driver), ReadHeaderTimeout: healthTimeout}
+	if !cfg.Quiet {
+		_, _ = fmt.Fprintf(errOutput, "docker-plugin: serving the logging driver API on %s\n", path)
+	}
+
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+	if err := sdNotify("READY=1"); err != nil && !cfg.Quiet {
+		_, _ = fmt.Fprintf(errOutput, "warning: %v\n", err)
+	}
+	select {
+	case err = <-served:
+	case <-ctx.Done():
+	}
+	_ = sdNotify("STOPPING=1")
+	shutdown, cancel := context.WithTimeout(context.Background(), healthTimeout)
+	defer cancel()
+	_ = server.Shutdown(shutdown)
+	driver.stopAll()
+	_ = os.Remove(path)
+
+	// A signal is how the daemon stops a plugin, so it is a clean exit
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("docker-plugin: %w", err)
+	}
+	return nil
+}
+
+// dockerDriver is the logging driver: one dockerStream per container.
+type dockerDriver struct {
+	ctx       context.Context
+	cfg       Config
+	errOutput io.Writer
+
+	mu      sync.Mutex
+	streams map[string]*dockerStream // by FIFO path
+}
+
+// StartLogging checks the container's --log-opt options and starts
+// reading its FIFO.
+func (d *dockerDriver) StartLogging(file string, info dockerlog.Info) error {
+	cfg, err := d.containerConfig(info)
+	if err != nil {
+		return err
+	}
+	s := &dockerStream{file: file, name: strings.TrimPrefix(info.ContainerName, "/"), done: make(chan struct{})}
+	d.mu.Lock()
+	if _, ok := d.streams[file]; ok {
+		d.mu.Unlock()
+		return fmt.Errorf("already logging to %s", file)
+	}
+	d.streams[file] = s
+	d.mu.Unlock()
+
+	go s.run(d.ctx, cfg, d.errOutput)
+	return nil
+}
+
+// StopLogging waits for the rest of the container's entries to be
+// converted and sent.
+func (d *dockerDriver) StopLogging(file string) error {
+	d.mu.Lock()
+	s, ok := d.streams[file]
+	delete(d.streams, file)
+	d.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	s.stop(dockerStopTimeout)
+	return nil
+}
+
+// stopAll stops every stream, when the plugin shuts down.
+func (d *dockerDriver) stopAll() {
+	d.mu.Lock()
+	streams := d.streams
+	d.streams = make(map[string]*dockerStream)
+	d.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, s := range streams {
+		wg.Add(1)
+		go func(s *dockerStream) {
+			defer wg.Done()
+			// The pipelines have stopped; don't wait for the daemon
+			s.stop(0)
+		}(s)
+	}
+	wg.Wait()
+}
+
+// containerConfig applies a container's --log-opt options to the plugin's
+// configuration and adds its details as fields, through --derive stages
+// ahead of the user's so those can refer to them.
+func (d *dockerDriver) containerConfig(info dockerlog.Info) (Config, error) {
+	cfg := d.cfg
+	for opt, value := range info.Config {
+		switch opt {
+		case "format":
+			cfg.Format = value
+		default:
+			return cfg, fmt.Errorf("unknown log opt %q for log2json", opt)
+		}
+	}
+	if cfg.Format != d.cfg.Format {
+		_, _, closeParsers, err := buildRegistry(cfg, io.Discard)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid log opt format: %w", err)
+		}
+		closeParsers()
+	}
+
+	var fields []string
+	add := func(field, value string) {
+		if value != "" {
+			fields = append(fields, field+"="+value)
+		}
+	}
+	add("container_id", info.ContainerID)
+	add("container_name", strings.TrimPrefix(info.ContainerName, "/"))
+	add("image", info.ContainerImageName)
+	cfg.Derives = append(fields, cfg.Derives...)
+	return cfg, nil
+}
+
+// dockerStream reads a container's FIFO and feeds its lines to a pipeline
+// per source, stdout and stderr.
+type dockerStream struct {
+	file string
+	name string // the container, for messages
+	done chan struct{}
+
+	mu      sync.Mutex
+	fifo    *os.File
+	aborted bool
+}
+
+// run converts the container's entries until the FIFO is closed.
+func (s *dockerStream) run(ctx context.Context, cfg Config, errOutput io.Writer) {
+	defer close(s.done)
+
+	// Opening a FIFO blocks until the daemon opens it for writing
+	f, err := os.Open(s.file)
+	if err != nil {
+		_, _ = fmt.Fprintf(errOutput, "error: container %s: %v\n", s.name, err)
+		return
+	}
+	s.mu.Lock()
+	s.fifo = f
+	aborted := s.aborted
+	s.mu.Unlock()
+	defer func() { _ = f.Close() }()
+	if aborted {
+		return
+	}
+
+	pipelines := make(map[string]*dockerPipeline)
+	pipeline := func(source string) *dockerPipeline {
+		p := pipelines[source]
+		if p == nil {
+			p = startDockerPipeline(ctx, cfg, source, s.name, errOutput)
+			pipelines[source] = p
+		}
+		return p
+	}
+	partial := make(map[string][]byte)
+	dec := dockerlog.NewDecoder(f)
+	var entry dockerlog.Entry
+	for {
+		if err := dec.Decode(&entry); err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, os.ErrClosed) {
+				_, _ = fmt.Fprintf(errOutput, "error: container %s: %v\n", s.name, err)
+			}
+			break
+		}
+		source := entry.Source
+		if source == "" {
+			source = "stdout"
+		}
+		// The daemon splits long lines into partial entries
+		line := append(partial[source], entry.Line...)
+		if entry.Partial {
+			partial[source] = line
+			continue
+		}
+		partial[source] = line[:0]
+		_, _ = pipeline(source).w.Write(append(line, '\n'))
+	}
+
+	// A line cut off by the end of the stream is still converted
+	for source, rest := range partial {
+		if len(rest) > 0 {
+			_, _ = pipeline(source).w.Write(append(rest, '\n'))
+		}
+	}
+	for _, p := range pipelines {
+		_ = p.w.Close()
+	}
+	for _, p := range pipelines {
+		<-p.done
+	}
+}
+
+// stop waits up to wait for the stream to reach the end of the FIFO, then
+// closes it if the daemon has not.
+func (s *dockerStream) stop(wait time.Duration) {
+	select {
+	case <-s.done:
+		return
+	case <-time.After(wait):
+	}
+	s.mu.Lock()
+	s.aborted = true
+	if s.fifo != nil {
+		_ = s.fifo.Close()
+	} else if w, err := os.OpenFile(s.file, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+		// Let the open waiting for a writer return
+		_ = w.Close()
+	}
+	s.mu.Unlock()
+	<-s.done
+}
+
+// dockerPipeline converts the lines of one source of a container.
+type dockerPipeline struct {
+	w    *io.PipeWriter
+	done chan struct{}
+}
+
+func startDockerPipeline(ctx context.Context, cfg Config, source, container string, errOutput io.Writer) *dockerPipeline {
+	cfg.Derives = append([]string{"source=" + source}, cfg.Derives...)
+	r, w := io.Pipe()
+	p := &dockerPipeline{w: w, done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		err := runPipelineContext(ctx, cfg, r, io.Discard, errOutput)
+		if err != nil {
+			_, _ = fmt.Fprintf(errOutput, "error: container %s %s: %v\n", container, source, err)
+		}
+		// Lines sent after the pipeline stopped are dropped
+		_ = r.CloseWithError(errors.New("pipeline stopped"))
+	}()
+	return p
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/juliosaraiva/log2json/internal/transform"
+)
+
+// listOrAllFlag is a boolean flag that optionally takes a comma-separated
+// list: "--flag" applies to everything, "--flag=a,b" only to a and b.
+type listOrAllFlag struct {
+	all   *bool
+	items *[]string
+}
+
+// String returns the flag's current value.
+func (f listOrAllFlag) String() string {
+	if f.all == nil || f.items == nil {
+		return ""
+	}
+	if *f.all {
+		return "true"
+	}
+	return strings.Join(*f.items, ",")
+}
+
+// Set records either the "all" form or a list of items.
+func (f listOrAllFlag) Set(s string) error {
+	switch s {
+	case "true":
+		*f.all = true
+	case "false":
+		*f.all = false
+		*f.items = nil
+	default:
+		*f.items = append(*f.items, splitList(s)...)
+	}
+	return nil
+}
+
+// IsBoolFlag lets the flag be given without a value.
+func (f listOrAllFlag) IsBoolFlag() bool {
+	return true
+}
+
+// statsFlag is --stats: the summary goes to stderr when given without a
+// value, or to the file --stats=FILE names.
+type statsFlag struct {
+	enabled *bool
+	path    *string
+}
+
+// String returns the flag's current value.
+func (f statsFlag) String() string {
+	if f.enabled == nil || f.path == nil {
+		return ""
+	}
+	if *f.path != "" {
+		return *f.path
+	}
+	return strconv.FormatBool(*f.enabled)
+}
+
+// Set enables the summary, to stderr or to a file.
+func (f statsFlag) Set(s string) error {
+	switch s {
+	case "true":
+		*f.enabled = true
+	case "false":
+		*f.enabled = false
+		*f.path = ""
+	default:
+		*f.enabled = true
+		*f.path = s
+	}
+	return nil
+}
+
+// IsBoolFlag lets the flag be given without a value.
+func (f statsFlag) IsBoolFlag() bool {
+	return true
+}
+
+// explainFlag is --explain: explanations go to stderr when it is given
+// without a value, or to a _detection field with --explain=field.
+type explainFlag string
+
+// String returns the setting.
+func (e *explainFlag) String() string {
+	if e == nil {
+		return ""
+	}
+	return string(*e)
+}
+
+// Set records a setting.
+func (e *explainFlag) Set(s string) error {
+	switch s {
+	case "true", "stderr":
+		*e = "stderr"
+	case "false":
+		*e = ""
+	case "field":
+		*e = "field"
+	default:
+		return fmt.Errorf("must be stderr or field")
+	}
+	return nil
+}
+
+// IsBoolFlag lets the flag be given without a value.
+func (e *explainFlag) IsBoolFlag() bool {
+	return true
+}
+
+// colorFlag is --color: "auto" when given without a value, or
+// --color=auto, always or never.
+type colorFlag string
+
+// String returns the setting.
+func (c *colorFlag) String() string {
+	if c == nil {
+		return ""
+	}
+	return string(*c)
+}
+
+// Set records a setting.
+func (c *colorFlag) Set(s string) error {
+	switch s {
+	case "true":
+		*c = "auto"
+	case "false":
+		*c = "never"
+	case "auto", "always", "never":
+		*c = colorFlag(s)
+	default:
+		return fmt.Errorf("must be auto, always or never")
+	}
+	return nil
+}
+
+// IsBoolFlag lets the flag be given without a value.
+func (c *colorFlag) IsBoolFlag() bool {
+	return true
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+// String returns the values joined by commas.
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set appends a value.
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// sizeFlag is a byte count, given plainly or with a unit (100MB, 1GiB).
+type sizeFlag int64
+
+// String returns the size in bytes.
+func (s *sizeFlag) String() string {
+	return strconv.FormatInt(int64(*s), 10)
+}
+
+// Set parses a size.
+func (s *sizeFlag) Set(v string) error {
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		*s = sizeFlag(n)
+		return nil
+	}
+	suffix, n, ok := transform.ParseUnit(v)
+	if !ok || suffix != transform.SuffixSize {
+		return fmt.Errorf("invalid size %q: want bytes or a unit such as 100MB", v)
+	}
+	*s = sizeFlag(n)
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+	"github.com/juliosaraiva/log2json/internal/reader"
+	"github.com/juliosaraiva/log2json/internal/tail"
+)
+
+// tailInterval is how often followed files, of --follow and
+// --kube-node-logs, are polled for new lines and new files.
+var tailInterval = tail.DefaultInterval
+
+// followStdin is the --follow argument that reads stdin, whose lines have
+// "stdin" as _source.
+const followStdin = "-"
+
+// followLines reads the --follow inputs, stdin for "-" and the files each
+// other argument names, as a glob pattern, and returns their lines in the
+// order they are read, each with the file it came from, or stdin, as
+// _source. Files are read from their start and then followed, through
+// rotation, until ctx is done; stdin is read to its end. When detect is
+// set, each argument's format is detected apart, by a registry of its
+// own, and lines carry their parsed entry. Bytes read from files are
+// added to read. The returned function stops following and the parsers.
+func followLines(ctx context.Context, cfg Config, stdin <-chan reader.Line, detect bool, read *atomic.Int64, errOutput io.Writer) (<-chan reader.Line, func(), error) {
+	var followers []*tail.Follower
+	for _, arg := range cfg.FollowFiles {
+		var follower *tail.Follower
+		if arg != followStdin {
+			var err error
+			follower, err = tail.New(arg, tail.WithFromStart(), tail.WithInterval(tailInterval), tail.WithReadCounter(read))
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		followers = append(followers, follower)
+	}
+	var stops []func()
+	stopAll := func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+	registries := make([]*parser.Registry, len(followers))
+	if detect {
+		for i := range registries {
+			registry, _, stop, err := buildRegistry(cfg, errOutput)
+			if err != nil {
+				stopAll()
+				return nil, nil, err
+			}
+			registries[i], stops = registry, append(stops, stop)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	lines := make(chan reader.Line)
+	var wg sync.WaitGroup
+	for i, follower := range followers {
+		wg.Add(1)
+		go func(follower *tail.Follower, registry *parser.Registry) {
+			defer wg.Done()
+			// send parses the line if the argument has a registry
+			send := func(line reader.Line) bool {
+				if line.Err == nil && registry != nil {
+					entry, err := registry.Parse(line.Text)
+					if err != nil {
+						line.Err = &inputParseError{err: err}
+					} else {
+						line.Entry = entry
+					}
+				}
+				select {
+				case lines <- line:
+					return true
+				case <-ctx.Done():
+					return false
+				}
+			}
+
+			if follower == nil {
+				for line := range stdin {
+					line.Fields = map[string]any{"_source": "stdin"}
+					if !send(line) {
+						return
+					}
+				}
+				return
+			}
+			for tl := range follower.Lines(ctx) {
+				if tl.Gone {
+					continue
+				}
+				line := reader.Line{Text: tl.Text, Number: tl.Number, Err: tl.Err, Fields: map[string]any{"_source": tl.Path}}
+				if !send(line) {
+					return
+				}
+			}
+		}(follower, registries[i])
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wg.Wait()
+		close(lines)
+	}()
+	return lines, func() { cancel(); <-done; stopAll() }, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/forward"
+	"github.com/juliosaraiva/log2json/internal/reader"
+)
+
+// forwardMessageKeys are the record fields holding the log line itself,
+// in the order they are looked for: Fluent Bit's tail and Docker inputs
+// use log, its syslog and systemd inputs message.
+var forwardMessageKeys = []string{"log", "message"}
+
+// forwardLines listens on addr, or on the socket systemd passed for
+// "systemd", for Fluentd forward connections, as --forward-listen, and
+// returns their events as lines until ctx is done.
+// A message is acknowledged once the read loop has taken all its events,
+// so a sender in ack mode resends what a stopped run never received.
+func forwardLines(ctx context.Context, addr string, bytesIn *atomic.Int64, errOutput io.Writer, quiet bool) (<-chan reader.Line, error) {
+	var listener net.Listener
+	var err error
+	if addr == systemdListen {
+		listener, err = sdListener("forward")
+	} else {
+		listener, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen on --forward-listen: %w", err)
+	}
+	lines := make(chan reader.Line)
+
+	// Connections are served concurrently; the lock keeps each message's
+	// events together and the line numbers in the order they are sent
+	var mu sync.Mutex
+	number := 0
+	send := func(line reader.Line) bool {
+		select {
+		case lines <- line:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	handle := func(events []forward.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, event := range events {
+			number++
+			if !send(forwardLine(event, number)) {
+				return ctx.Err()
+			}
+		}
+		return nil
+	}
+
+	opts := []forward.Option{forward.WithReadCounter(bytesIn)}
+	if !quiet {
+		opts = append(opts, forward.WithErrorLog(func(format string, args ...any) {
+			_, _ = fmt.Fprintf(errOutput, "warning: "+format+"\n", args...)
+		}))
+	}
+	go func() {
+		defer close(lines)
+		if err := forward.Serve(ctx, listener, handle, opts...); err != nil {
+			mu.Lock()
+			defer mu.Unlock()
+			send(reader.Line{Number: number + 1, Err: fmt.Errorf("--forward-listen: %w", err)})
+		}
+	}()
+	return lines, nil
+}
+
+// forwardLine turns an event into a line: the text of its log or message
+// field, with the record's other fields and the event's tag and time
+// alongside. A record without either is converted as its JSON.
+func forwardLine(event forward.Event, number int) reader.Line {
+	fields := make(map[string]any, len(event.Record)+2)
+	fields["tag"] = event.Tag
+	fields["time"] = event.Time.Format(time.RFC3339Nano)
+	for _, key := range forwardMessageKeys {
+		if text, ok := event.Record[key].(string); ok {
+			for k, v := range event.Record {
+				if k != key {
+					fields[k] = v
+				}
+			}
+			return reader.Line{Text: text, Number: number, Fields: fields}
+		}
+	}
+	data, err := json.Marshal(event.Record)
+	if err != nil {
+		return reader.Line{Number: number, Err: fmt.Errorf("forward record: %w", err)}
+	}
+	return reader.Line{Text: string(data), Number: number, Fields: fields}
+}
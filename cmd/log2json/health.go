@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// healthTimeout bounds how long /stats waits for the read loop, which
+// hands out the statistics between lines, and how long shutting the health
+// server down waits for requests in flight.
+const healthTimeout = 2 * time.Second
+
+// healthServer serves --health-listen: /healthz while the process is up,
+// /readyz while it is reading input, and /stats with the --stats summary
+// so far, for orchestrators and load balancers to probe a long-running
+// conversion.
+type healthServer struct {
+	server   *http.Server
+	listener net.Listener
+	ready    atomic.Bool
+
+	// snapshots carries /stats requests to the read loop, which owns the
+	// run statistics and answers with the summary as JSON
+	snapshots chan chan []byte
+}
+
+// startHealthServer listens on addr, or on the socket systemd passed for
+// "systemd", and serves the health endpoints in the background until close.
+func startHealthServer(addr string, errOutput io.Writer) (*healthServer, error) {
+	var listener net.Listener
+	var err error
+	if addr == systemdListen {
+		listener, err = sdListener("health")
+	} else {
+		listener, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen on --health-listen: %w", err)
+	}
+	h := &healthServer{listener: listener, snapshots: make(chan chan []byte)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok\n")
+	})
+	mux.HandleFunc("/readyz", h.serveReady)
+	mux.HandleFunc("/stats", h.serveStats)
+	h.server = &http.Server{Handler: mux, ReadHeaderTimeout: healthTimeout}
+
+	go func() {
+		if err := h.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			_, _ = fmt.Fprintf(errOutput, "warning: health server stopped: %v\n", err)
+		}
+	}()
+	return h, nil
+}
+
+func (h *healthServer) serveReady(w http.ResponseWriter, r *http.Request) {
+	if !h.ready.Load() {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	_, _ = io.WriteString(w, "ok\n")
+}
+
+func (h *healthServer) serveStats(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+	reply := make(chan []byte, 1)
+	select {
+	case h.snapshots <- reply:
+	case <-ctx.Done():
+		http.Error(w, "statistics unavailable: the run is busy or finished", http.StatusServiceUnavailable)
+		return
+	}
+	data := <-reply
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// setReady marks the run as reading input, or as no longer reading.
+func (h *healthServer) setReady(ready bool) {
+	if h != nil {
+		h.ready.Store(ready)
+	}
+}
+
+// requests returns the channel of /stats requests, or nil, which never
+// delivers, without a health server.
+func (h *healthServer) requests() chan chan []byte {
+	if h == nil {
+		return nil
+	}
+	return h.snapshots
+}
+
+// close stops the server, letting requests in flight finish.
+func (h *healthServer) close() {
+	if h == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+	defer cancel()
+	_ = h.server.Shutdown(ctx)
+}
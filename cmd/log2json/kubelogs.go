@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/kubelog"
+	"github.com/juliosaraiva/log2json/internal/parser"
+	"github.com/juliosaraiva/log2json/internal/reader"
+	"github.com/juliosaraiva/log2json/internal/tail"
+)
+
+// kubeFile is a container log followed by --kube-node-logs.
+type kubeFile struct {
+	fields   map[string]any // the container's details, when its name has them
+	registry *parser.Registry
+	stop     func()
+	pending  map[string]*kubePending // partial lines by stream
+}
+
+// kubePending is a line the runtime split into partial records, joined
+// until its last record.
+type kubePending struct {
+	text   []byte
+	number int       // the line number of its first record
+	at     time.Time // the time of its first record
+}
+
+// kubeLines follows the container logs in the --kube-node-logs directory,
+// the kubelet's links to the CRI log files, and returns their lines: each
+// record's message, partial records joined, with the pod, namespace,
+// container and container id from the file's name, and the stream and
+// time from the record. A line not in the CRI format, as the json-file
+// logs of a Docker node, is passed on whole.
+//
+// Logs already there are followed from their end, and containers started
+// later from their start. When detect is set, each container's format is
+// detected apart, by a registry of its own, and lines carry their parsed
+// entry. Bytes read are added to read. The returned function stops
+// following and the containers' parsers.
+func kubeLines(ctx context.Context, cfg Config, detect bool, read *atomic.Int64, errOutput io.Writer) (<-chan reader.Line, func(), error) {
+	follower, err := tail.New(filepath.Join(filepath.Clean(cfg.KubeNodeLogs), "*.log"),
+		tail.WithInterval(tailInterval), tail.WithReadCounter(read))
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	followed := follower.Lines(ctx)
+
+	lines := make(chan reader.Line)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer close(lines)
+		files := make(map[string]*kubeFile)
+		defer func() {
+			for _, f := range files {
+				f.stopParsers()
+			}
+		}()
+		send := func(line reader.Line) bool {
+			select {
+			case lines <- line:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for tl := range followed {
+			f := files[tl.Path]
+			if f == nil && !tl.Gone {
+				f = newKubeFile(tl.Path, cfg, detect, errOutput)
+				files[tl.Path] = f
+			}
+			switch {
+			case tl.Gone:
+				// A removed container's cut-off lines are still converted
+				if f != nil {
+					for _, stream := range []string{"stdout", "stderr"} {
+						if p := f.pending[stream]; p != nil && !send(f.line(stream, p)) {
+							return
+						}
+					}
+					f.stopParsers()
+					delete(files, tl.Path)
+				}
+			case tl.Err != nil:
+				if !send(reader.Line{Number: tl.Number, Err: tl.Err}) {
+					return
+				}
+			default:
+				rec, ok := kubelog.ParseRecord(tl.Text)
+				if !ok {
+					if !send(f.line("", &kubePending{text: []byte(tl.Text), number: tl.Number})) {
+						return
+					}
+					continue
+				}
+				p := f.pending[rec.Stream]
+				if p == nil {
+					p = &kubePending{number: tl.Number, at: rec.Time}
+				}
+				p.text = append(p.text, rec.Message...)
+				if rec.Partial && len(p.text) < tail.DefaultMaxLineSize {
+					f.pending[rec.Stream] = p
+					continue
+				}
+				delete(f.pending, rec.Stream)
+				if !send(f.line(rec.Stream, p)) {
+					return
+				}
+			}
+		}
+	}()
+	return lines, func() { cancel(); <-done }, nil
+}
+
+// newKubeFile starts following the container log at path. A registry that
+// cannot be built leaves the main one to parse its lines.
+func newKubeFile(path string, cfg Config, detect bool, errOutput io.Writer) *kubeFile {
+	f := &kubeFile{pending: make(map[string]*kubePending)}
+	if meta, ok := kubelog.ParseFileName(path); ok {
+		f.fields = map[string]any{
+			"pod":          meta.Pod,
+			"namespace":    meta.Namespace,
+			"container":    meta.Container,
+			"container_id": meta.ContainerID,
+		}
+	}
+	if detect {
+		if registry, _, stop, err := buildRegistry(cfg, errOutput); err == nil {
+			f.registry, f.stop = registry, stop
+		}
+	}
+	return f
+}
+
+// line makes the line of a record, or of a line not in the CRI format when
+// stream is empty, parsed by the container's registry if it has one.
+func (f *kubeFile) line(stream string, p *kubePending) reader.Line {
+	fields := make(map[string]any, len(f.fields)+2)
+	for k, v := range f.fields {
+		fields[k] = v
+	}
+	if stream != "" {
+		fields["stream"] = stream
+		fields["time"] = p.at.Format(time.RFC3339Nano)
+	}
+	line := reader.Line{Text: string(p.text), Number: p.number, Fields: fields}
+	if f.registry != nil {
+		entry, err := f.registry.Parse(line.Text)
+		if err != nil {
+			line.Err = &inputParseError{err: err}
+		} else {
+			line.Entry = entry
+		}
+	}
+	return line
+}
+
+// stopParsers stops the container's exec parsers, if it has a registry.
+func (f *kubeFile) stopParsers() {
+	if f.stop != nil {
+		f.stop()
+		f.stop = nil
+	}
+}
@@ -9,15 +9,27 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"text/template"
+	"time"
 
+	"github.com/juliosaraiva/log2json/internal/alert"
 	"github.com/juliosaraiva/log2json/internal/emitter"
 	"github.com/juliosaraiva/log2json/internal/parser"
+	"github.com/juliosaraiva/log2json/internal/query"
 	"github.com/juliosaraiva/log2json/internal/reader"
+	"github.com/juliosaraiva/log2json/internal/transform"
+	"github.com/juliosaraiva/log2json/internal/wasm"
 )
 
 // Version information (set via build flags)
@@ -26,28 +38,202 @@ var version = "dev"
 // Config holds all CLI configuration options.
 type Config struct {
 	// Parser options
-	Format   string // Force specific format
-	Pattern  string // Custom regex pattern
-	Adaptive bool   // Re-detect format per line
+	Format        string   // Force specific format
+	Patterns      []string // Custom regex patterns, tried in order
+	Adaptive      bool     // Re-detect format per line
+	RedetectAfter int      // Re-detect after this many failed lines in a row
+	DetectLines   int      // Lines sampled to auto-detect the format
+	Fallback      string   // Parser for lines no format claims (default generic)
+	NoFallback    bool     // Leave lines no format claims unparsed
+	Parsers       []string // Formats auto-detection tries, in this order
+	Plugins       []string // Go plugin (.so) parsers, repeatable
+	ExecParsers   []string // Commands parsing lines over stdin/stdout, repeatable
+	PatternsFile  string   // Named regex/dissect/grok parsers (YAML)
+	FormatsDirs   []string // Directories of format definitions (YAML)
+
+	NoInferTypes  bool     // Keep all kv/regex values as strings
+	NoInferFields []string // Keep these kv/regex fields as strings
+
+	KVSeparator        string // Between key and value (default "=")
+	KVMinPairs         int    // Pairs a line needs to be detected as kv
+	ApacheFormat       string // combined, common or vhost_combined
+	SyslogParseMessage bool   // Parse JSON/kv syslog messages into fields
+	RegexParsers       bool   // Match syslog/apache lines with regexps, not the scanners
+	JSONMaxDepth       int    // Keep JSON nested deeper as text (0 = no limit)
+
+	// Input options
+	Match         string   // Only process raw lines matching this regex
+	InvertMatch   bool     // Invert Match: skip matching lines
+	Context       int      // With Match or Where, entries also kept before and after each match
+	Head          int      // Stop after emitting this many entries (0 = no limit)
+	ForwardListen string   // Receive Fluentd forward events on this address instead of stdin
+	Mmap          bool     // Read stdin through a memory mapping when it is a regular file
+	KubeNodeLogs  string   // Follow the Kubernetes container logs in this directory instead of stdin
+	Follow        bool     // Read and follow the files given as arguments, and stdin for -
+	FollowFiles   []string // With Follow, the files to follow (- for stdin)
+
+	// Error policy
+	FailFast      bool    // Stop at the first line that fails
+	MaxErrors     int     // Stop once more lines than this fail (0 = no limit)
+	MaxErrorRatio float64 // Fail if more than this fraction of lines fail (0 = no limit)
+
+	AbortOnErrorRatio     float64 // Stop once more than this fraction of recent lines fail to parse (0 = never)
+	ErrorRatioWindow      int     // With AbortOnErrorRatio, the recent lines (0: 1000)
+	ErrorRatioPassthrough bool    // With AbortOnErrorRatio, pass the rest of the lines through raw instead
 
 	// Output options
-	Pretty        bool     // Pretty-print JSON
-	Fields        []string // Only output these fields
-	AddTimestamp  bool     // Add _ingestTime field
-	AddLineNumber bool     // Add _lineNumber field
-	AddRaw        bool     // Add _raw field
-	OmitEmpty     bool     // Skip entries with parse errors
+	Outputs          []string      // Output destinations (file, stdout, es://, http(s)://), repeatable
+	OutputFormat     string        // Output encoding: json (default), parquet, avro or cbor
+	OutputTemplate   string        // Render entries through this Go template instead of JSON
+	InferSchema      bool          // schema command: write an inferred JSON Schema instead of entries
+	SchemaReport     bool          // With InferSchema, write a field summary instead
+	Describe         bool          // describe command: write field statistics instead of entries
+	DescribeLines    int           // With Describe, lines to sample (0: all)
+	Bench            bool          // bench command: measure parser and stage throughput
+	BenchFile        string        // With Bench, the sample to measure (default stdin)
+	Test             bool          // test command: report how sample lines parse
+	TestInput        string        // With Test, the sample lines (default stdin)
+	TestExpect       string        // With Test, YAML file of expected fields per line
+	Dev              bool          // dev command: write a pattern interactively
+	DevSample        string        // With Dev, the sample file to write it against
+	DockerPlugin     bool          // docker-plugin command: serve as a Docker logging driver
+	Merge            bool          // merge command: convert files merged by timestamp
+	MergeFiles       []string      // With Merge, the files to merge
+	Top              bool          // top command: show a live ranking of a field's values
+	TopBy            string        // With Top, the field to rank
+	TopInterval      time.Duration // With Top, how often the ranking is redrawn (0: 2s)
+	DockerSocket     string        // With DockerPlugin, the plugin API socket
+	OutputCompress   string        // Compress output: gzip or zstd
+	OutputAppend     bool          // Append to output files instead of truncating them
+	OutputAtomic     bool          // Write output files under a temporary name, renamed when done
+	RotateSize       int64         // Rotate the --output file at this size in bytes
+	RotateInterval   time.Duration // Rotate the --output file at this age
+	RotateKeep       int           // Rotated files to keep (0: all)
+	RotateCompress   bool          // Gzip rotated files
+	ParquetRowGroup  int           // Entries per Parquet row group
+	AvroSchema       string        // Avro schema file (default: inferred)
+	ESAPIKey         string        // API key for an es:// --output
+	OutputAuth       string        // Credentials for HTTP-based outputs: basic:, bearer: or api-key:
+	OutputHeaders    []string      // Extra request headers for an http(s):// --output (Name: value)
+	OutputTimeout    time.Duration // Per-request timeout for an http(s):// or forward:// --output
+	SyslogFacility   string        // Facility of messages to a syslog:// --output
+	SyslogSDID       string        // SD-ID carrying extra fields in syslog messages
+	ForwardTag       string        // Tag (a template) of entries sent to a forward:// --output
+	OTLPEndpoint     string        // Export to this OpenTelemetry collector
+	OTLPProtocol     string        // OTLP transport: http/protobuf or grpc
+	OTLPHeaders      []string      // Extra OTLP request headers (Name: value)
+	OTLPService      string        // OTLP service.name resource attribute
+	BatchSize        int           // Entries per request for network outputs
+	FlushInterval    time.Duration // Longest an entry waits in a network batch or output buffer
+	FlushLines       int           // Flush file/stdout output every this many entries
+	Buffer           string        // File/stdout buffering: auto (block for files, else line), line or block
+	BufferSize       int64         // Bytes of input read and output buffered at a time (0 adapts)
+	Pretty           bool          // Pretty-print JSON
+	Color            string        // Colorize JSON on stdout: auto (terminals only), always or never
+	Fields           []string      // Only output these fields
+	FieldOrder       []string      // Keys to write first, in this order
+	KeyPrefix        string        // Prepend this to every parsed field name
+	Namespace        string        // Nest parsed fields under this key
+	GroupOutput      bool          // Envelope: fields, meta and error objects
+	AddTimestamp     bool          // Add _ingestTime field
+	AddLineNumber    bool          // Add _lineNumber field
+	AddRaw           bool          // Add _raw field
+	AddFormat        bool          // Add _format field (parser name)
+	OmitEmpty        bool          // Skip entries with parse errors
+	Routes           []string      // Conditional routes (expr => destination)
+	Alerts           []string      // Commands run for matching entries (expr => command)
+	AlertRate        string        // With Alerts, runs per rule per interval (default 10/m)
+	NotifyWebhook    string        // URL to POST entries matching NotifyWhen to
+	NotifyWhen       string        // With NotifyWebhook, the expression entries to send match
+	NotifyTemplate   string        // With NotifyWebhook, a template of request bodies
+	NotifyDigest     time.Duration // With NotifyWebhook, send a digest this often (0: each entry)
+	OutputByField    string        // Write entries to a file per value of a field (field:path)
+	OutputByFieldMax int           // With OutputByField, files kept open at once
+	AddHost          bool          // Add _host metadata block
+	AddEnv           []string      // Environment variables to include in _host
+
+	// Transform options
+	Types            string        // Explicit field types (field:type,...)
+	ParseUnits       bool          // Add numeric fields for unit-suffixed values
+	ParseUnitFields  []string      // Limit ParseUnits to these fields
+	Schema           string        // Schema file to enforce
+	SchemaErrors     string        // File for schema violations (default stderr)
+	HashFields       string        // Fields to replace with salted hashes
+	AnonymizeIP      string        // IP fields to truncate to their network prefix
+	SplitFields      []string      // Fields to split into arrays (field:delim), repeatable
+	Explode          string        // Array field to split into one entry per element
+	Lookups          []string      // Lookup tables (field=file), repeatable
+	ClassifyIP       []string      // IP fields to classify
+	RDNS             bool          // Reverse DNS lookup for classified IPs
+	RDNSTimeout      time.Duration // Per-entry reverse DNS wait
+	RDNSConcurrency  int           // Max in-flight reverse DNS lookups
+	Derives          []string      // Templated fields (field=template), repeatable
+	Correlate        string        // Correlation id field to sequence records by
+	CorrelateIdle    time.Duration // Close an id after this long unseen
+	CorrelateSummary bool          // Emit a summary record when an id closes
+	MineTemplates    string        // Free-text field to mine message templates from
+	MineSimilarity   float64       // Token similarity needed to join a template
+	Script           string        // Starlark script defining transform(entry)
+	WasmPlugin       string        // WebAssembly plugin exporting transform and/or parse
+	Where            string        // Keep only entries matching this expression
+	MinLevel         string        // Drop entries below this severity
+	DedupConsec      bool          // Collapse consecutive duplicates
+	DedupWindow      string        // Drop lines repeated within N lines or a duration
+	ReorderWindow    time.Duration // Sort entries this far out of order by timestamp
+	SampleBy         string        // Per-key sampling (field:1/N)
+	RateLimitBy      string        // Per-key rate limit (field:N/interval)
+	MaxFieldBytes    int           // Truncate string values longer than this
+	MaxFields        int           // Keep at most this many fields
+	Histogram        string        // Numeric fields to emit distributions of instead of entries
+	Percentiles      string        // With Histogram, the percentiles to report
+	Query            string        // SQL query whose rows replace the entries
+	Window           time.Duration // With Histogram or Query, the window each result covers (0: all input)
 
 	// General options
-	Quiet   bool // Suppress warnings
-	Verbose bool // Debug output
-	List    bool // List available formats
-	Help    bool // Show help
-	Version bool // Show version
+	ConfigFile   string // YAML file of option values, overridden by flags
+	Quiet        bool   // Suppress warnings
+	Verbose      bool   // Debug output
+	Stats        bool   // Print an end-of-run summary (JSON)
+	StatsFile    string // Write the summary to this file instead of stderr
+	Check        bool   // Validate the options and outputs, then exit
+	CheckLines   int    // With Check, parse this many input lines and report formats
+	Explain      string // Explain format detection: stderr or field (_detection)
+	ExplainLines int    // With Explain, explain only the first N lines (0: all)
+	HealthListen string // Serve /healthz, /readyz and /stats on this address
+	List         bool   // List available formats
+	Help         bool   // Show help
+	Version      bool   // Show version
 }
 
 func main() {
-	cfg := parseFlags()
+	// "log2json schema|describe|bench|test|dev|docker-plugin|merge|top [OPTIONS]" take the same options
+	var command string
+	if len(os.Args) > 1 && (os.Args[1] == "schema" || os.Args[1] == "describe" || os.Args[1] == "bench" || os.Args[1] == "test" || os.Args[1] == "dev" || os.Args[1] == "docker-plugin" || os.Args[1] == "merge" || os.Args[1] == "top") {
+		command = os.Args[1]
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+	cfg, err := parseFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	cfg.InferSchema = command == "schema"
+	cfg.Describe = command == "describe"
+	cfg.Bench = command == "bench"
+	cfg.Test = command == "test"
+	cfg.Dev = command == "dev"
+	cfg.DockerPlugin = command == "docker-plugin"
+	cfg.Merge = command == "merge"
+	cfg.Top = command == "top"
+	if cfg.Dev {
+		cfg.DevSample = flag.Arg(0)
+	}
+	if cfg.Merge {
+		cfg.MergeFiles = flag.Args()
+	}
+	if cfg.Follow {
+		cfg.FollowFiles = flag.Args()
+	}
 
 	// Handle info flags
 	if cfg.Version {
@@ -61,43 +247,179 @@ func main() {
 	}
 
 	if cfg.List {
-		listFormats()
+		if err := listFormats(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
 		os.Exit(0)
 	}
 
 	// Run the converter
 	if err := run(cfg); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
 
-// parseFlags parses command line arguments into Config.
-func parseFlags() Config {
+// parseFlags parses command line arguments, and the config file they or
+// the default search path name, into Config.
+func parseFlags() (Config, error) {
 	var cfg Config
-	var fieldsStr string
+	var parsersStr, fieldsStr, fieldOrderStr, classifyIPStr, addEnvStr string
 
 	// Parser options
 	flag.StringVar(&cfg.Format, "format", "", "Force log format (auto-detect if empty)")
 	flag.StringVar(&cfg.Format, "f", "", "Force log format (shorthand)")
-	flag.StringVar(&cfg.Pattern, "pattern", "", "Custom regex with named groups")
-	flag.StringVar(&cfg.Pattern, "p", "", "Custom regex (shorthand)")
+	flag.Var((*stringList)(&cfg.Patterns), "pattern", "Custom regex with named groups (repeatable, tried in order)")
+	flag.Var((*stringList)(&cfg.Patterns), "p", "Custom regex (shorthand)")
 	flag.BoolVar(&cfg.Adaptive, "adaptive", false, "Re-detect format for each line")
+	flag.IntVar(&cfg.RedetectAfter, "redetect-after", 0, "Re-detect the format after N lines in a row fail to parse (0 = never)")
+	flag.IntVar(&cfg.DetectLines, "detect-lines", parser.DefaultSampleSize, "Lines to sample when auto-detecting the format")
+	flag.StringVar(&cfg.Fallback, "fallback", "", "Parser for lines no format claims (default generic)")
+	flag.BoolVar(&cfg.NoFallback, "no-fallback", false, "Emit lines no format claims with a parse error")
+	flag.StringVar(&parsersStr, "parsers", "", "Formats to auto-detect, in priority order (comma-separated)")
+	flag.Var(listOrAllFlag{&cfg.NoInferTypes, &cfg.NoInferFields}, "no-infer-types", "Keep kv/regex values as strings (all, or =field,...)")
+	flag.Var((*stringList)(&cfg.Plugins), "plugin", "Load a parser from a Go plugin (.so, repeatable)")
+	flag.Var((*stringList)(&cfg.ExecParsers), "exec-parser", "Parse lines with an external command (repeatable)")
+	flag.StringVar(&cfg.PatternsFile, "patterns-file", "", "Load named regex/dissect/grok parsers from a YAML file")
+	flag.StringVar(&cfg.KVSeparator, "kv-separator", "=", "Text between key and value for the kv format")
+	flag.IntVar(&cfg.KVMinPairs, "kv-min-pairs", parser.DefaultKVMinPairs, "Pairs a line needs to be detected as kv")
+	flag.StringVar(&cfg.ApacheFormat, "apache-format", string(parser.ApacheCombined), "Apache log variant: combined, common or vhost_combined")
+	flag.BoolVar(&cfg.SyslogParseMessage, "syslog-parse-message", false, "Parse JSON or key=value syslog messages into fields")
+	flag.BoolVar(&cfg.RegexParsers, "regex-parsers", false, "Parse syslog and apache lines with regular expressions instead of the faster scanners (to check them)")
+	flag.IntVar(&cfg.JSONMaxDepth, "json-max-depth", 0, "Keep JSON objects/arrays nested deeper than N as text")
+
+	// Input options
+	flag.StringVar(&cfg.Match, "match", "", "Only process raw lines matching regex")
+	flag.BoolVar(&cfg.InvertMatch, "invert-match", false, "Skip raw lines matching --match instead")
+	flag.IntVar(&cfg.Context, "context", 0, "Also keep N entries before and after each --match or --where match, with _context: true")
+	flag.IntVar(&cfg.Context, "C", 0, "Context entries around matches (shorthand)")
+	flag.IntVar(&cfg.Head, "head", 0, "Emit the first N entries, then stop reading and exit")
+	flag.StringVar(&cfg.ForwardListen, "forward-listen", "", "Receive Fluentd forward protocol events on this address instead of reading stdin")
+	flag.BoolVar(&cfg.Mmap, "mmap", false, "Read stdin through a memory mapping when it is a regular file")
+	flag.BoolVar(&cfg.Follow, "follow", false, "Read and follow the files given as arguments, and stdin for -, in one run")
+	flag.StringVar(&cfg.KubeNodeLogs, "kube-node-logs", "", "Follow the Kubernetes container logs in this directory (/var/log/containers) instead of reading stdin")
+
+	// Error policy
+	flag.BoolVar(&cfg.FailFast, "fail-fast", false, "Stop with exit status 1 at the first line that fails")
+	flag.IntVar(&cfg.MaxErrors, "max-errors", 0, "Stop with exit status 1 once more than N lines fail (0 = no limit)")
+	flag.Float64Var(&cfg.MaxErrorRatio, "max-error-ratio", 0, "Exit with status 1 if more than this fraction of lines fail, e.g. 0.05")
+	flag.Float64Var(&cfg.AbortOnErrorRatio, "abort-on-error-ratio", 0, "Stop with exit status 1 once more than this fraction of the recent lines fail to parse, e.g. 0.5")
+	flag.IntVar(&cfg.ErrorRatioWindow, "error-ratio-window", 0, "With --abort-on-error-ratio, how many recent lines to look at (default 1000)")
+	flag.BoolVar(&cfg.ErrorRatioPassthrough, "error-ratio-passthrough", false, "With --abort-on-error-ratio, write the remaining lines raw instead of stopping")
 
 	// Output options
+	flag.Var((*stringList)(&cfg.Outputs), "output", "Write output to this file, stdout, es://host:9200/index or http(s):// URL instead of stdout (repeatable)")
+	flag.Var((*stringList)(&cfg.Outputs), "o", "Output destination (shorthand)")
+	flag.BoolVar(&cfg.OutputAppend, "append", false, "Append to output files instead of truncating them")
+	flag.BoolVar(&cfg.OutputAtomic, "atomic", false, "Write output files to a temporary file, renamed over them when done")
+	flag.StringVar(&cfg.ESAPIKey, "es-api-key", "", "Elasticsearch API key for an es:// --output")
+	flag.StringVar(&cfg.OutputAuth, "output-auth", "", "Credentials for http(s):// and es:// outputs and --otlp-endpoint: basic:USER:PASS, bearer:TOKEN or api-key:KEY")
+	flag.Var((*stringList)(&cfg.OutputHeaders), "output-header", "Add a request header for an http(s):// --output ('Name: value', repeatable)")
+	flag.DurationVar(&cfg.OutputTimeout, "output-timeout", emitter.DefaultHTTPTimeout, "Per-request timeout for an http(s):// or forward:// --output")
+	flag.StringVar(&cfg.SyslogFacility, "syslog-facility", "", "Facility of messages to a syslog:// --output (name or number, default user)")
+	flag.StringVar(&cfg.SyslogSDID, "syslog-sd-id", "", "Structured-data ID carrying extra fields in syslog messages (default "+emitter.DefaultSyslogSDID+")")
+	flag.StringVar(&cfg.ForwardTag, "forward-tag", "", "Tag of entries sent to a forward:// --output, a template such as 'app.{{.program}}' (default "+emitter.DefaultForwardTag+")")
+	flag.StringVar(&cfg.OutputFormat, "output-format", "json", "Output format: json, parquet, avro or cbor")
+	flag.BoolVar(&cfg.SchemaReport, "report", false, "With the schema command, print a field summary instead of a JSON Schema")
+	flag.IntVar(&cfg.DescribeLines, "lines", 10000, "With the describe command, lines to sample (0 for all)")
+	flag.StringVar(&cfg.BenchFile, "file", "", "With the bench command, the sample log file to measure (default stdin)")
+	flag.StringVar(&cfg.TestInput, "input", "", "With the test command, the sample log file to parse (default stdin)")
+	flag.StringVar(&cfg.TestExpect, "expect", "", "With the test command, a YAML file of the fields expected per line")
+	flag.StringVar(&cfg.DockerSocket, "docker-socket", defaultDockerSocket, "With the docker-plugin command, the socket to serve the plugin API on")
+	flag.StringVar(&cfg.TopBy, "by", "", "With the top command, the field whose values to rank")
+	flag.DurationVar(&cfg.TopInterval, "interval", defaultTopInterval, "With the top command, how often to redraw the ranking")
+	flag.StringVar(&cfg.OutputTemplate, "output-template", "", "Render each entry with a Go template (e.g. '{{.level}} {{.msg}}') instead of JSON")
+	flag.StringVar(&cfg.OutputCompress, "output-compress", "", "Compress output (file, stdout or http(s)://): gzip or zstd")
+	flag.Var((*sizeFlag)(&cfg.RotateSize), "rotate-size", "Rotate the --output file when it reaches this size (e.g. 100MB)")
+	flag.DurationVar(&cfg.RotateInterval, "rotate-interval", 0, "Rotate the --output file when it is this old (e.g. 1h)")
+	flag.IntVar(&cfg.RotateKeep, "keep", 0, "Rotated --output files to keep (default all)")
+	flag.BoolVar(&cfg.RotateCompress, "rotate-compress", false, "Gzip rotated --output files")
+	flag.IntVar(&cfg.ParquetRowGroup, "parquet-row-group", emitter.DefaultRowGroupSize, "Entries per Parquet row group")
+	flag.StringVar(&cfg.OTLPEndpoint, "otlp-endpoint", "", "Export entries to this OpenTelemetry collector URL")
+	flag.StringVar(&cfg.OTLPProtocol, "otlp-protocol", emitter.OTLPHTTP, "OTLP transport: http/protobuf or grpc")
+	flag.Var((*stringList)(&cfg.OTLPHeaders), "otlp-header", "Add an OTLP request header ('Name: value', repeatable)")
+	flag.StringVar(&cfg.OTLPService, "otlp-service", "log2json", "OTLP service.name resource attribute")
+	flag.IntVar(&cfg.BatchSize, "batch-size", emitter.DefaultBatchSize, "Entries per request for network outputs")
+	flag.DurationVar(&cfg.FlushInterval, "flush-interval", 0, "Longest an entry waits before a network batch is sent (default 1s) or buffered output is flushed")
+	flag.IntVar(&cfg.FlushLines, "flush-lines", 0, "Flush file/stdout output every N entries instead of after each one")
+	flag.StringVar(&cfg.Buffer, "buffer", "auto", "File/stdout buffering: auto (block for files, line for pipes and terminals), line or block")
+	flag.Var((*sizeFlag)(&cfg.BufferSize), "buffer-size", "Bytes of input read and output buffered at a time, instead of adapting to the input (e.g. 256KB)")
+	flag.StringVar(&cfg.AvroSchema, "avro-schema", "", "Avro schema file for --output-format avro (default: inferred)")
 	flag.BoolVar(&cfg.Pretty, "pretty", false, "Pretty-print JSON output")
+	flag.Var((*colorFlag)(&cfg.Color), "color", "Colorize JSON on stdout: auto (terminals only, the default for a bare --color), always or never")
 	flag.StringVar(&fieldsStr, "fields", "", "Only output these fields (comma-separated)")
 	flag.StringVar(&fieldsStr, "F", "", "Only output these fields (shorthand)")
+	flag.StringVar(&fieldOrderStr, "field-order", "", "Write these keys first, in this order (comma-separated)")
+	flag.StringVar(&cfg.KeyPrefix, "key-prefix", "", "Prepend this to every parsed field name (metadata is left as is)")
+	flag.StringVar(&cfg.Namespace, "namespace", "", "Nest parsed fields under this key (metadata stays at the top level)")
+	flag.BoolVar(&cfg.GroupOutput, "group-output", false, "Nest parsed fields under \"fields\", metadata under \"meta\" and errors under \"error\"")
 	flag.BoolVar(&cfg.AddTimestamp, "add-timestamp", false, "Add _ingestTime field")
 	flag.BoolVar(&cfg.AddLineNumber, "add-line-number", false, "Add _lineNumber field")
 	flag.BoolVar(&cfg.AddRaw, "add-raw", false, "Add _raw field with original line")
+	flag.BoolVar(&cfg.AddFormat, "add-format", false, "Add _format field with the parser that produced the entry")
 	flag.BoolVar(&cfg.OmitEmpty, "omit-empty", false, "Skip entries with parse errors")
+	flag.Var((*stringList)(&cfg.Routes), "route", "Route matching entries to a destination ('expr => dest', repeatable)")
+	flag.Var((*stringList)(&cfg.Alerts), "alert", "Run a command with each entry matching an expression on stdin ('expr => command', repeatable)")
+	flag.StringVar(&cfg.AlertRate, "alert-rate", "", "Runs each --alert rule is allowed per interval (default "+alert.DefaultRate+")")
+	flag.StringVar(&cfg.NotifyWebhook, "notify-webhook", "", "POST entries matching --notify-when to this http(s):// webhook URL (Slack or generic)")
+	flag.StringVar(&cfg.NotifyWhen, "notify-when", "", "With --notify-webhook, the expression entries to send match")
+	flag.StringVar(&cfg.NotifyTemplate, "notify-template", "", "With --notify-webhook, a Go template of the request bodies (entry or digest fields)")
+	flag.DurationVar(&cfg.NotifyDigest, "notify-digest", 0, "With --notify-webhook, send one digest of the matches this often instead of a request per entry")
+	flag.StringVar(&cfg.OutputByField, "output-by-field", "", "Write entries to a file per value of a field ('field:out/{field}.ndjson')")
+	flag.IntVar(&cfg.OutputByFieldMax, "output-by-field-max-open", emitter.DefaultMaxShards, "Files --output-by-field keeps open at once")
+	flag.BoolVar(&cfg.AddHost, "add-host-metadata", false, "Add _host block (hostname, OS, version)")
+	flag.StringVar(&addEnvStr, "add-env", "", "Environment variables to include in _host (comma-separated)")
+
+	// Transform options
+	flag.StringVar(&cfg.Types, "types", "", "Force field types (field:int|float|string|bool,...)")
+	flag.Var(listOrAllFlag{&cfg.ParseUnits, &cfg.ParseUnitFields}, "parse-units", "Add <field>_ms/_bytes/_percent for values like 5ms, 3KB, 15% (all, or =field,...)")
+	flag.StringVar(&cfg.Schema, "schema", "", "Validate entries against a schema file (JSON Schema or field list)")
+	flag.StringVar(&cfg.SchemaErrors, "schema-errors", "", "Write schema violations to this file (default stderr)")
+	flag.StringVar(&cfg.HashFields, "hash-fields", "", "Replace fields with HMACs keyed by the salt (fields[:algo[:salt]])")
+	flag.StringVar(&cfg.AnonymizeIP, "anonymize-ip", "", "Zero the host bits of IP fields (fields[:v4prefix[:v6prefix]])")
+	flag.Var((*stringList)(&cfg.SplitFields), "split-field", "Split a delimited field into an array (field[:delim], repeatable)")
+	flag.StringVar(&cfg.Explode, "explode", "", "Emit one entry per element of an array field")
+	flag.Var((*stringList)(&cfg.Lookups), "lookup", "Join a field against a CSV/JSON table (field=file, repeatable)")
+	flag.StringVar(&classifyIPStr, "classify-ip", "", "Tag IP fields as private/public/loopback/cgnat (comma-separated)")
+	flag.BoolVar(&cfg.RDNS, "rdns", false, "Reverse DNS lookup for --classify-ip fields")
+	flag.DurationVar(&cfg.RDNSTimeout, "rdns-timeout", transform.DefaultRDNSTimeout, "Max wait per reverse DNS lookup")
+	flag.IntVar(&cfg.RDNSConcurrency, "rdns-concurrency", transform.DefaultRDNSConcurrency, "Max concurrent reverse DNS lookups")
+	flag.Var((*stringList)(&cfg.Derives), "derive", "Add a field rendered from a Go template (field=template, repeatable)")
+	flag.StringVar(&cfg.Correlate, "correlate", "", "Annotate records with _firstSeen and _seq per value of an id field")
+	flag.DurationVar(&cfg.CorrelateIdle, "correlate-idle", transform.DefaultCorrelateIdle, "Close a --correlate id after this long unseen")
+	flag.BoolVar(&cfg.CorrelateSummary, "correlate-summary", false, "Emit a summary record when a --correlate id closes")
+	flag.StringVar(&cfg.MineTemplates, "mine-templates", "", "Learn message templates from a free-text field (adds _templateId, _template, _params)")
+	flag.Float64Var(&cfg.MineSimilarity, "mine-similarity", transform.DefaultDrainSimilarity, "Fraction of matching tokens needed to join a template")
+	flag.StringVar(&cfg.Script, "script", "", "Run transform(entry) from a Starlark script on every entry")
+	flag.StringVar(&cfg.WasmPlugin, "wasm-plugin", "", "Load a WebAssembly plugin exporting transform and/or parse")
+	flag.StringVar(&cfg.Where, "where", "", "Keep only entries matching expression")
+	flag.StringVar(&cfg.Where, "w", "", "Filter expression (shorthand)")
+	flag.StringVar(&cfg.MinLevel, "min-level", "", "Drop entries below this level (e.g. warn)")
+	flag.BoolVar(&cfg.DedupConsec, "dedup-consecutive", false, "Collapse runs of identical entries (adds _repeatCount)")
+	flag.DurationVar(&cfg.ReorderWindow, "reorder-window", 0, "Hold entries this long, by their timestamps, to sort out-of-order ones (e.g. 5s)")
+	flag.StringVar(&cfg.DedupWindow, "dedup-window", "", "Drop lines identical to one seen within the last N lines or a duration (e.g. 10000 or 30s)")
+	flag.StringVar(&cfg.SampleBy, "sample-by", "", "Downsample hot values of a field (field:1/N)")
+	flag.StringVar(&cfg.Histogram, "histogram", "", "Emit distributions (count, percentiles, buckets) of numeric fields instead of entries")
+	flag.StringVar(&cfg.Percentiles, "percentiles", "", "With --histogram, the percentiles to report (default "+transform.DefaultPercentiles+")")
+	flag.StringVar(&cfg.Query, "query", "", "Run a SQL query over the entries, writing its rows instead ('SELECT path, count(*) FROM stream GROUP BY path')")
+	flag.DurationVar(&cfg.Window, "window", 0, "With --histogram or a grouping --query, emit results per window of this length (default: the whole input)")
+	flag.StringVar(&cfg.RateLimitBy, "rate-limit-by", "", "Cap entries per value of a field (field:N/interval)")
+	flag.IntVar(&cfg.MaxFieldBytes, "max-field-bytes", 0, "Truncate string values longer than N bytes")
+	flag.IntVar(&cfg.MaxFields, "max-fields", 0, "Keep at most N fields per entry, plus the _omittedFields count")
 
 	// General options
+	flag.StringVar(&cfg.ConfigFile, "config", "", "Read option values from a YAML file (flags override it)")
 	flag.BoolVar(&cfg.Quiet, "quiet", false, "Suppress warnings to stderr")
 	flag.BoolVar(&cfg.Quiet, "q", false, "Suppress warnings (shorthand)")
 	flag.BoolVar(&cfg.Verbose, "verbose", false, "Debug output to stderr")
 	flag.BoolVar(&cfg.Verbose, "v", false, "Debug output (shorthand)")
+	flag.Var(statsFlag{&cfg.Stats, &cfg.StatsFile}, "stats", "Print a JSON summary of the run to stderr, or to --stats=FILE")
+	flag.BoolVar(&cfg.Check, "check", false, "Validate the options and outputs without converting anything")
+	flag.IntVar(&cfg.CheckLines, "check-lines", 0, "With --check, parse the first N input lines and report the formats")
+	flag.Var((*explainFlag)(&cfg.Explain), "explain", "Report which parsers were tried on each line and which won, to stderr or, with --explain=field, in a _detection field")
+	flag.IntVar(&cfg.ExplainLines, "explain-lines", 0, "With --explain, explain only the first N lines (0 for all)")
+	flag.StringVar(&cfg.HealthListen, "health-listen", "", "Serve /healthz, /readyz and /stats (JSON) on this address while running")
 	flag.BoolVar(&cfg.List, "list", false, "List available formats")
 	flag.BoolVar(&cfg.List, "l", false, "List formats (shorthand)")
 	flag.BoolVar(&cfg.Help, "help", false, "Show help")
@@ -110,15 +432,50 @@ func parseFlags() Config {
 
 	flag.Parse()
 
-	// Parse fields list
-	if fieldsStr != "" {
-		cfg.Fields = strings.Split(fieldsStr, ",")
-		for i := range cfg.Fields {
-			cfg.Fields[i] = strings.TrimSpace(cfg.Fields[i])
+	// Fill in options not given on the command line from the config file
+	if cfg.ConfigFile == "" {
+		for _, path := range configFileNames() {
+			if fileExists(path) {
+				cfg.ConfigFile = path
+				break
+			}
+		}
+	}
+	if cfg.ConfigFile != "" {
+		if err := applyConfigFile(flag.CommandLine, cfg.ConfigFile); err != nil {
+			return cfg, fmt.Errorf("invalid --config: %w", err)
 		}
 	}
 
-	return cfg
+	// Parse field lists
+	cfg.Parsers = splitList(parsersStr)
+	cfg.Fields = splitList(fieldsStr)
+	cfg.FieldOrder = splitList(fieldOrderStr)
+	cfg.ClassifyIP = splitList(classifyIPStr)
+	cfg.AddEnv = splitList(addEnvStr)
+
+	// Load shared patterns from the default location if present
+	if cfg.PatternsFile == "" {
+		if path := filepath.Join(configDir(), "patterns.yaml"); fileExists(path) {
+			cfg.PatternsFile = path
+		}
+	}
+	cfg.FormatsDirs = formatsDirs()
+
+	return cfg, nil
+}
+
+// splitList splits a comma-separated flag value, trimming whitespace.
+// Returns nil for an empty string.
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	items := strings.Split(s, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
 }
 
 // printUsage prints the help message.
@@ -128,27 +485,402 @@ func printUsage() {
 USAGE:
     log2json [OPTIONS]
     <command> | log2json [OPTIONS]
+    <command> | log2json schema [--report] [OPTIONS]
+    <command> | log2json describe [--lines <N>] [OPTIONS]
+    log2json bench [--file <FILE>] [OPTIONS]
+    log2json test [--input <FILE>] [--expect <FILE>] [OPTIONS]
+    log2json dev [OPTIONS] <SAMPLE>
+    log2json merge [OPTIONS] <FILE>...
+    <command> | log2json top --by <FIELD> [--interval <DUR>] [OPTIONS]
+    <command> | log2json --follow [OPTIONS] <FILE|->...
+
+COMMANDS:
+    schema                    Read the whole input and print a JSON Schema of
+                              the fields seen (types, required fields, examples)
+                              instead of the entries. Takes the same options.
+        --report              Print a table of field types, presence and
+                              distinct-value counts instead
+    describe                  Sample the input and print, per field, its types,
+                              presence, distinct values, numeric min/max and
+                              most frequent values, to help choose --fields,
+                              --types and --where filters
+        --lines <N>           Lines to sample (default 10000, 0 for all)
+    bench                     Measure lines/s, MB/s and allocations per line
+                              of each parser and of each pipeline stage (read,
+                              parse, transform, emit) on a sample, with the
+                              given parser, tuning and transform options
+        --file <FILE>         Sample log file to measure (default stdin)
+    test                      Parse sample lines with the given parser options
+                              and print, for each line, the format that
+                              matched and the fields it extracted
+        --input <FILE>        Sample log file to parse (default stdin)
+        --expect <FILE>       YAML file of the fields expected per line
+                              (lines: {1: {level: INFO}, 2: false}); exits
+                              with status 1 if any differ
+    dev <SAMPLE>              Write a regex or dissect pattern interactively:
+                              the sample's lines are shown beside their parsed
+                              fields, updated as you type, with what each
+                              group matched highlighted. Tab switches between
+                              regex and dissect; Enter prints the pattern to
+                              stdout, Ctrl-C quits. Starts from --pattern
+    docker-plugin             Run as a Docker logging driver plugin: convert
+                              each container's stdout and stderr, adding
+                              container_id, container_name, image and source
+                              fields, and forward them to the network
+                              --output or --otlp-endpoint. A container can
+                              choose its format with --log-opt format=NAME
+        --docker-socket <PATH>
+                              Plugin API socket (default
+                              /run/docker/plugins/log2json.sock)
+    merge <FILE>...           Convert the files into one stream ordered by
+                              their timestamps, each file's format detected
+                              on its own, adding the file name as _source
+    top                       Show a ranking of the values of a field in the
+                              entries, with counts, rates and shares, redrawn
+                              in the terminal (on stderr) like top. Entries
+                              are only written to an --output, if one is given
+        --by <FIELD>          Field whose values to rank
+        --interval <DUR>      How often to redraw the ranking (default 2s)
 
 OPTIONS:
     -f, --format <FORMAT>     Force specific format (auto-detect if empty)
                               Use --list to see available formats
-    -p, --pattern <REGEX>     Custom regex with named groups
+    -p, --pattern <REGEX>     Custom regex with named groups (repeatable: each
+                              line is parsed with the first that matches)
                               Example: '(?P<time>\S+) (?P<level>\w+) (?P<msg>.*)'
     --adaptive                Re-detect format for each line (for mixed logs)
+    --redetect-after <N>      Re-detect the format once N lines in a row fail
+                              to parse with the detected one (default 0,
+                              never), for streams whose format changes
+    --detect-lines <N>        Lines to sample before choosing a format (default
+                              20; at most 1s is spent waiting for them). The
+                              format parsing most of them wins, so a banner
+                              line cannot lock the stream to the wrong parser
+    --fallback <FORMAT>       Parser for lines no format claims (default
+                              generic, which wraps them as "message")
+    --no-fallback             Emit lines no format claims as {"raw":...} with
+                              a _parseError (drop them with --omit-empty)
+    --parsers <FORMATS>       Only auto-detect these formats (comma-separated);
+                              the order breaks ties between formats equally
+                              sure of a line (default json,kv,syslog,apache,
+                              generic; leave out generic for no fallback)
+    --no-infer-types[=FIELDS] Keep kv/regex values as strings instead of inferring
+                              numbers/booleans (all fields, or only FIELDS)
+    --plugin <FILE.so>        Load a parser from a Go plugin exporting
+                              NewParser() any (repeatable; tried before the
+                              built-in formats, or select it with -f)
+    --exec-parser <CMD>       Parse lines with an external command: each line
+                              is written to its stdin and it answers on stdout
+                              with a JSON object per line (null if the line is
+                              not its format). Named after the program;
+                              repeatable, tried before the built-in formats
+    --patterns-file <FILE>    Load named regex/dissect/grok parsers from a YAML
+                              file (default ~/.config/log2json/patterns.yaml if
+                              it exists); tried before the built-in formats,
+                              highest priority first, or select one with -f.
+                              One-format files in ~/.config/log2json/formats/
+                              and $LOG2JSON_FORMATS_DIR are loaded the same way
+    --kv-separator <SEP>      Text between key and value for kv (default =)
+    --kv-min-pairs <N>        Pairs a line needs to be detected as kv
+                              (default 2)
+    --apache-format <FORMAT>  combined (default; referer and user agent
+                              optional), common or vhost_combined
+    --syslog-parse-message    Add the fields of JSON or key=value syslog
+                              messages to the entry
+    --regex-parsers           Parse syslog and apache lines with the regular
+                              expressions the faster scanners replaced, to
+                              check their output against
+    --json-max-depth <N>      Keep JSON objects and arrays nested more than N
+                              levels deep as JSON text (default no limit)
+
+    --match <REGEX>           Only process raw lines matching regex (before parsing)
+    --invert-match            Skip lines matching --match instead
+    -C, --context <N>         Also keep the N entries before and after each
+                              --match or --where match, marked _context: true,
+                              like grep -C
+    --head <N>                Emit the first N entries, then stop reading the
+                              input and exit; --stats covers the lines read
+    --forward-listen <ADDR>   Receive events from Fluentd or Fluent Bit over the
+                              forward protocol on ADDR (e.g. :24224) instead
+                              of reading stdin; each record's log or message
+                              is parsed and its other fields kept. "systemd"
+                              takes the socket from systemd socket activation
+    --mmap                    Read stdin through a memory mapping when it is a
+                              regular file (log2json --mmap < big.log), which is
+                              faster on large files; the file must not be
+                              truncated while it is read
+    --follow <FILE|->...      Read the files, then follow them as they grow and
+                              rotate, together with stdin where - is given;
+                              each entry gets its file or stdin as _source, and
+                              each argument's format is detected on its own.
+                              Quoted patterns ('logs/*.log') pick up new files.
+                              The files follow the other options
+    --kube-node-logs <DIR>    Follow the container logs of a Kubernetes node in
+                              DIR (/var/log/containers) instead of reading
+                              stdin: CRI partial lines are joined, and pod,
+                              namespace, container, container_id, stream and
+                              time added from the file name and record
 
+    -o, --output <FILE|URL>   Write output to FILE instead of stdout, or index it
+                              in Elasticsearch with es://[user:pass@]host:9200/index
+                              (es+https:// for TLS), in --batch-size bulk requests.
+                              An http:// or https:// URL receives NDJSON batches
+                              as POST requests, retried with backoff on failure.
+                              syslog://host[:514] sends RFC 5424 messages over
+                              UDP (syslog+tcp:// or syslog+tls:// for TCP/TLS),
+                              extra fields as structured data.
+                              forward://host[:24224] sends batches to a Fluentd
+                              or Fluent Bit forward input (forward+tls:// for
+                              TLS), resending those not acknowledged.
+                              Repeat to write to several destinations at once
+                              ('-' is stdout); one failing does not stop the others
+    --append                  Append to output files instead of truncating them
+                              (with rotation, to the current file)
+    --atomic                  Write output files to a temporary file in the same
+                              directory and rename it over FILE once done, so
+                              readers never see a partial file
+    --es-api-key <KEY>        Authenticate to Elasticsearch with an API key
+    --output-auth <SPEC>      Authenticate http(s):// and es:// outputs and
+                              --otlp-endpoint: basic:USER:PASS, bearer:TOKEN
+                              or api-key:KEY (X-API-Key, or ApiKey for es://).
+                              A secret written env:NAME is read from the
+                              environment, and file:PATH from a file
+    --output-header <'K: V'>  Add a header to http(s):// output requests (repeatable)
+    --output-timeout <DUR>    Timeout for each http(s):// output request, or
+                              forward:// batch and its acknowledgement
+                              (default 30s)
+    --syslog-facility <NAME>  Facility for a syslog:// output: user (default),
+                              daemon, local0-local7, ... or a number 0-23
+    --syslog-sd-id <ID>       SD-ID of the structured-data element holding
+                              extra fields (default fields@32473)
+    --forward-tag <TMPL>      Tag of entries sent to a forward:// output, a
+                              template of their fields such as
+                              'app.{{.program}}' (default log2json)
+    --output-format <FORMAT>  Output format: json (default), parquet, avro or
+                              cbor (a CBOR sequence, one map per entry).
+                              Parquet columns and Avro fields are inferred from
+                              the first row group or block; later fields that
+                              do not fit go to _extra
+    --output-template <TMPL>  Render each entry as a line of text with a Go
+                              template instead of JSON, e.g.
+                              '{{.timestamp}} {{.level}} {{.message}}'
+                              (file and stdout outputs; missing fields are empty)
+    --output-compress <ALG>   Compress output written to a file, stdout or an
+                              http(s):// --output: gzip or zstd
+    --rotate-size <SIZE>      Rotate the --output file when it reaches SIZE
+                              (e.g. 100MB); rotated files are FILE.1 (newest),
+                              FILE.2, ...
+    --rotate-interval <DUR>   Rotate the --output file when it is DUR old (e.g. 1h)
+    --keep <N>                Rotated files to keep (default all)
+    --rotate-compress         Gzip rotated files (FILE.1.gz, ...)
+    --parquet-row-group <N>   Entries per Parquet row group (default 10000)
+    --avro-schema <FILE>      Write Avro with this schema instead of inferring
+                              one; entries that do not match are errors
+    --otlp-endpoint <URL>     Export entries as OTLP log records to an
+                              OpenTelemetry collector instead of stdout
+                              (e.g. http://localhost:4318)
+    --otlp-protocol <PROTO>   http/protobuf (default) or grpc (https only)
+    --otlp-header <'K: V'>    Add a header to OTLP requests (repeatable)
+    --otlp-service <NAME>     service.name resource attribute (default log2json)
+    --batch-size <N>          Entries per request for network outputs (default 512)
+    --flush-interval <DUR>    Send a partial batch after this long (default 1s).
+                              For file/stdout output, buffer entries and flush
+                              at most this long after one is written
+    --flush-lines <N>         Buffer file/stdout output, flushing every N entries
+                              (default: flush after each). Terminals and the
+                              end of input always flush at once
+    --buffer <MODE>           File/stdout buffering: line (flush after each
+                              entry, or as --flush-lines and --flush-interval
+                              say), block (write when the buffer is full, and
+                              at least every --flush-interval, default 1s) or
+                              auto (the default: block for files, including a
+                              redirected stdout, and line for pipes)
+    --buffer-size <SIZE>      Input and output buffer size (default: adapt
+                              to the line lengths and throughput seen)
     --pretty                  Pretty-print JSON (not recommended for pipes)
+    --color[=WHEN]            Colorize JSON on stdout: error/warn levels in
+                              red/yellow, metadata keys dimmed, --match hits
+                              highlighted. WHEN is auto (the default: only
+                              when stdout is a terminal), always or never
     -F, --fields <FIELDS>     Only output these fields (comma-separated)
+    --field-order <FIELDS>    Write these keys first, in this order; the rest
+                              follow sorted (also orders Parquet/Avro columns)
+    --key-prefix <PREFIX>     Prepend PREFIX to every parsed field name (app_
+                              turns message into app_message); metadata such
+                              as _lineNumber is left as is
+    --namespace <KEY>         Nest parsed fields under KEY, next to metadata
+    --group-output            Write each entry as {"fields":{...},"meta":{...},
+                              "error":{...}}: parsed fields, metadata (_ keys,
+                              without the _) and errors (_parseError as "parse")
     --add-timestamp           Add _ingestTime field with ingestion time
     --add-line-number         Add _lineNumber field
     --add-raw                 Add _raw field with original line
+    --add-format              Add _format field with the parser that produced
+                              the entry (useful with --adaptive)
     --omit-empty              Skip entries with parse errors
+    --route <'EXPR => DEST'>  Send entries matching EXPR to DEST (stdout, stderr or
+                              a file); first match wins, 'default' matches all,
+                              unmatched entries are dropped (repeatable)
+    --alert <'EXPR => CMD'>   Run CMD (a program and its arguments, no shell)
+                              for entries matching EXPR, with the entry on
+                              stdin; LOG2JSON_ALERT holds EXPR and
+                              LOG2JSON_ALERT_SKIPPED the matches skipped since
+                              its last run (repeatable)
+    --alert-rate <N/DUR>      Runs each --alert rule is allowed per interval,
+                              one at a time (default 10/m); other matches are
+                              skipped
+    --notify-webhook <URL>    POST entries matching --notify-when to an http(s)://
+                              webhook: the entry as JSON, or for Slack
+                              (hooks.slack.com) a message showing it
+    --notify-when <EXPR>      The expression entries to send match
+    --notify-template <TMPL>  Go template of the request bodies, of the entry's
+                              fields or the digest's ('{"text": {{json .msg}}}')
+    --notify-digest <DUR>     Send one digest of the matches every DUR (count,
+                              first 20 entries, condition, start and end)
+                              instead of a request per entry
+    --output-by-field <'FIELD:PATH'>
+                              Write entries to a file per value of FIELD, its
+                              PATH holding {FIELD}: 'program:out/{program}.ndjson'.
+                              Values are made safe as file names (other
+                              characters become _; _none when missing), and
+                              directories are created
+    --output-by-field-max-open <N>
+                              Files kept open at once; the least recently
+                              written is closed, and appended to when
+                              reopened (default 64)
+    --add-host-metadata       Add _host block (hostname, OS, pid, version)
+    --add-env <VARS>          Include these environment variables in _host
+
+    --types <RULES>           Force field types, overriding inference
+                              Example: 'status:int,duration:float,zip:string'
+    --parse-units[=FIELDS]    Add numeric fields for unit-suffixed values:
+                              latency=1.2s -> latency_ms=1200, size=3KB ->
+                              size_bytes=3000, cpu=15%% -> cpu_percent=15
+    --schema <FILE>           Validate entries against a schema (JSON Schema subset
+                              or {"field":"type"} list); values are coerced to the
+                              declared types, violating entries are rejected
+    --schema-errors <FILE>    Write rejected entries here (default stderr)
+    --hash-fields <SPEC>      Replace fields with HMACs keyed by the salt
+                              Format: field1,field2[:sha256|sha512[:salt]]
+                              The salt may be env:NAME or file:PATH
+                              Runs before enrichment, --script and --where,
+                              which see the hashes
+    --anonymize-ip <SPEC>     Zero the host bits of IP addresses, keeping the
+                              network prefix (default /24 for IPv4, /48 for IPv6)
+                              Format: field1,field2[:v4prefix[:v6prefix]]
+                              Runs before enrichment, --script and --where
+    --split-field <SPEC>      Split a delimiter-joined field into a JSON array
+                              (field[:delim], default comma; repeatable)
+                              Example: 'tags:,' or 'x_forwarded_for'
+    --explode <FIELD>         Emit one entry per element of an array field (or a
+                              string holding a JSON array), merged with the
+                              parent's scalar fields
+    --lookup <FIELD=FILE>     Add columns from a CSV/JSON table keyed by FIELD
+                              (repeatable), e.g. status=status_names.csv
+    --classify-ip <FIELDS>    Add <field>_class (private, public, loopback, cgnat...)
+    --rdns                    Add <field>_hostname via cached reverse DNS
+    --rdns-timeout <DUR>      Max wait per lookup (default 500ms)
+    --rdns-concurrency <N>    Max concurrent lookups (default 8)
+    --derive <FIELD=TMPL>     Add FIELD rendered from a Go template over the
+                              entry (repeatable), e.g.
+                              'summary={{.method}} {{.path}} -> {{.status}}'
+    --correlate <FIELD>       Add _firstSeen and _seq (position within the id) to
+                              records sharing a request/trace id
+    --correlate-idle <DUR>    Close an id after this long unseen (default 1m)
+    --correlate-summary       Emit {FIELD, _count, _firstSeen, _lastSeen,
+                              _duration} when an id closes
+    --mine-templates <FIELD>  Learn message templates from free text (variable
+                              tokens become <*>); adds _templateId, _template
+                              and _params
+    --mine-similarity <F>     Fraction of matching tokens needed to join a
+                              template (default 0.4)
+    --script <FILE>           Run transform(entry) from a Starlark script on
+                              every entry: return the dict to keep it, a list
+                              of dicts to emit several, or None to drop it
+    --wasm-plugin <FILE>      Load a WebAssembly plugin: its parse export becomes
+                              a format named after the file (used unless -f or
+                              -p is given), its transform export a stage run
+                              after --script
+    -w, --where <EXPR>        Keep only entries matching expression
+                              Example: 'status >= 500 && method == "POST"'
+    --min-level <LEVEL>       Drop entries below this level (trace, debug, info,
+                              notice, warn, error, critical, fatal)
+    --dedup-consecutive       Collapse runs of identical entries into one
+                              record with _repeatCount
+    --dedup-window <N|DUR>    Drop lines identical to one seen in the last N
+                              lines or DUR (e.g. 10000 or 30s), such as
+                              copies delivered twice
+    --reorder-window <DUR>    Sort entries up to DUR out of order by their
+                              timestamps, as when merging live inputs
+    --sample-by <FIELD:1/N>   Keep 1 in N entries per value of FIELD once a value
+                              has been seen N times (rare values kept in full)
+    --rate-limit-by <SPEC>    Cap entries per value of a field per interval
+                              Example: program:10/s (adds _dropped summaries)
+    --max-field-bytes <N>     Truncate string values over N bytes (_truncatedFields)
+    --max-fields <N>          Keep at most N fields per entry, plus _omittedFields
+    --histogram <FIELDS>      Emit the distribution of numeric FIELDS instead of
+                              entries: count, min, max, mean, sum, percentiles
+                              and 1-2-5 bucket counts, one record per field
+    --percentiles <LIST>      Percentiles to report (default 50,90,95,99)
+    --query <SQL>             Write the rows of a SQL query over the entries
+                              instead of them, e.g. 'SELECT path, count(*)
+                              FROM stream WHERE status >= 500 GROUP BY path'
+    --window <DUR>            Emit distributions, or grouped query rows, per
+                              DUR window, by entry timestamp (default: once
+                              for the whole input)
 
+    --config <FILE>           Read option values from a YAML file whose keys
+                              are option names (format: kv); flags override
+                              it. Default ./log2json.yaml, then
+                              ~/.config/log2json/config.yaml, if they exist
     -q, --quiet               Suppress warnings to stderr
-    -v, --verbose             Debug output to stderr
+    -v, --verbose             Debug output to stderr (includes --stats)
+    --stats[=FILE]            Print a JSON summary of the run on exit (lines
+                              read and parsed per format, errors by type,
+                              bytes in/out, elapsed time, throughput) to
+                              stderr, or to FILE
+    --fail-fast               Stop at the first line that fails to read, parse
+                              or write, with exit status 1
+    --max-errors <N>          Stop with exit status 1 once more than N lines fail
+    --max-error-ratio <R>     Exit with status 1 if more than R (e.g. 0.05) of
+                              the lines fail
+    --abort-on-error-ratio <R>
+                              Stop with exit status 1 once more than R (e.g.
+                              0.5) of the recent lines fail to parse, as after
+                              a format change upstream
+    --error-ratio-window <N>  Recent lines --abort-on-error-ratio looks at
+                              (default 1000)
+    --error-ratio-passthrough Instead of stopping, write the remaining lines
+                              unparsed, as {"raw": LINE}
+    --check                   Validate the options (formats, patterns,
+                              expressions, output settings) and check that
+                              each output can be written or reached, then
+                              exit without converting anything
+    --check-lines <N>         With --check, also parse the first N input lines
+                              and report the detected format and matches
+    --explain[=stderr|field]  Report, for each line, which parsers were tried,
+                              why each rejected it and which one won: to
+                              stderr, or in a _detection field with
+                              --explain=field
+    --explain-lines <N>       With --explain, explain only the first N lines
+    --health-listen <ADDR>    Serve HTTP probes on ADDR (e.g. :8081) while
+                              running: /healthz, /readyz (200 while reading
+                              input, 503 once shutting down) and /stats, the
+                              --stats summary so far. "systemd" takes the
+                              socket from systemd socket activation
     -l, --list                List available formats
     -h, --help                Show this help
     -V, --version             Show version
 
+EXIT STATUS:
+    0    All lines converted (or, without an error policy, the run completed)
+    1    Invalid options, an unrecoverable error, or the error budget of
+         --fail-fast, --max-errors or --max-error-ratio was exceeded
+    2    Completed with failed lines, within --max-errors or --max-error-ratio
+    130  Interrupted by SIGINT (143: SIGTERM); lines already read are still
+         converted, outputs flushed and --stats written. A second signal
+         exits at once
+
 EXAMPLES:
     # Auto-detect format from syslog
     tail -f /var/log/syslog | log2json
@@ -162,15 +894,45 @@ EXAMPLES:
     # Filter errors with jq
     cat app.log | log2json | jq 'select(.level == "ERROR")'
 
+    # Or filter inside log2json
+    cat access.log | log2json -f apache -w 'status >= 500'
+
     # Add metadata and select fields
     cat app.log | log2json --add-timestamp -F timestamp,level,message
 
+    # Split errors into their own file
+    cat app.log | log2json --route 'level == "ERROR" => errors.ndjson' --route 'default => stdout'
+
+    # Pseudonymize user and IP fields
+    cat access.log | log2json --hash-fields user,ip:sha256:s3cret
+
+    # Truncate client IPs to /16 networks
+    cat access.log | log2json --anonymize-ip ip:16
+
+    # Ship to a Fluentd aggregator, tagged by program
+    tail -F /var/log/syslog | log2json -o forward://aggregator:24224 --forward-tag 'syslog.{{.program}}'
+
+    # Validate a deployment's options before starting it
+    head -100 app.log | log2json --config prod.yaml --check --check-lines 100
+
+    # Summarize the fields of an application log
+    cat app.log | log2json schema --report
+
 `)
 }
 
-// listFormats prints available log formats.
-func listFormats() {
+// listFormats prints available log formats, including the installed
+// format definitions and those of the patterns file.
+func listFormats(cfg Config) error {
 	registry := parser.NewRegistry()
+	if err := registerFormats(registry, cfg.FormatsDirs); err != nil {
+		return err
+	}
+	if cfg.PatternsFile != "" {
+		if err := registerPatterns(registry, cfg.PatternsFile); err != nil {
+			return err
+		}
+	}
 	fmt.Println("Available log formats:")
 	fmt.Println()
 	for _, p := range registry.ListParsers() {
@@ -178,15 +940,168 @@ func listFormats() {
 	}
 	fmt.Println()
 	fmt.Println("Use -f/--format to force a specific format, or omit for auto-detection.")
+	return nil
+}
+
+// registerPatterns adds the parsers of a patterns file ahead of the
+// built-in formats, highest priority first.
+func registerPatterns(registry *parser.Registry, path string) error {
+	patterns, err := parser.LoadPatterns(path)
+	if err != nil {
+		return fmt.Errorf("invalid --patterns-file: %w", err)
+	}
+	for i := len(patterns) - 1; i >= 0; i-- {
+		p := patterns[i]
+		if registry.GetParser(p.Name()) != nil {
+			return fmt.Errorf("invalid --patterns-file: pattern name %q is already registered", p.Name())
+		}
+		registry.RegisterFirst(p)
+	}
+	return nil
+}
+
+// registerFormats adds the format definitions of dirs ahead of the
+// built-in formats, highest priority first.
+func registerFormats(registry *parser.Registry, dirs []string) error {
+	if len(dirs) == 0 {
+		return nil
+	}
+	formats, err := parser.LoadFormatsDirs(dirs...)
+	if err != nil {
+		return fmt.Errorf("invalid format definitions: %w", err)
+	}
+	for i := len(formats) - 1; i >= 0; i-- {
+		p := formats[i]
+		if registry.GetParser(p.Name()) != nil {
+			return fmt.Errorf("invalid format definitions: format name %q is already registered", p.Name())
+		}
+		registry.RegisterFirst(p)
+	}
+	return nil
+}
+
+// tunedParsers returns registry options replacing the built-in parsers
+// that the parser tuning flags configure. Zero values keep the defaults.
+func tunedParsers(cfg Config) ([]parser.RegistryOption, error) {
+	var opts []parser.RegistryOption
+
+	var kvOpts []parser.KeyValueOption
+	if cfg.KVSeparator != "" && cfg.KVSeparator != "=" {
+		kvOpts = append(kvOpts, parser.WithKVSeparator(cfg.KVSeparator))
+	}
+	if cfg.KVMinPairs < 0 {
+		return nil, fmt.Errorf("invalid --kv-min-pairs: %d is negative", cfg.KVMinPairs)
+	}
+	if cfg.KVMinPairs > 0 {
+		kvOpts = append(kvOpts, parser.WithKVMinPairs(cfg.KVMinPairs))
+	}
+	if len(kvOpts) > 0 {
+		opts = append(opts, parser.WithBuiltin(parser.NewKeyValueParser(kvOpts...)))
+	}
+
+	var apacheOpts []parser.ApacheOption
+	if cfg.ApacheFormat != "" {
+		variant, err := parser.ParseApacheVariant(cfg.ApacheFormat)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --apache-format: %w", err)
+		}
+		if variant != parser.ApacheCombined {
+			apacheOpts = append(apacheOpts, parser.WithApacheVariant(variant))
+		}
+	}
+	if cfg.RegexParsers {
+		apacheOpts = append(apacheOpts, parser.WithApacheRegex())
+	}
+	if len(apacheOpts) > 0 {
+		opts = append(opts, parser.WithBuiltin(parser.NewApacheParser(apacheOpts...)))
+	}
+
+	var syslogOpts []parser.SyslogOption
+	if cfg.SyslogParseMessage {
+		syslogOpts = append(syslogOpts, parser.WithMessageParsing())
+	}
+	if cfg.RegexParsers {
+		syslogOpts = append(syslogOpts, parser.WithSyslogRegex())
+	}
+	if len(syslogOpts) > 0 {
+		opts = append(opts, parser.WithBuiltin(parser.NewSyslogParser(syslogOpts...)))
+	}
+
+	if cfg.JSONMaxDepth < 0 {
+		return nil, fmt.Errorf("invalid --json-max-depth: %d is negative", cfg.JSONMaxDepth)
+	}
+	if cfg.JSONMaxDepth > 0 {
+		opts = append(opts, parser.WithBuiltin(parser.NewJSONParser(parser.WithMaxDepth(cfg.JSONMaxDepth))))
+	}
+	return opts, nil
+}
+
+// typeInference builds parser type inference settings. Fields forced to
+// string with --types also skip inference, so their original text
+// (leading zeros, "1.10") survives.
+func typeInference(cfg Config) parser.TypeInference {
+	ti := parser.TypeInference{Disabled: cfg.NoInferTypes}
+
+	fields := append([]string(nil), cfg.NoInferFields...)
+	if cfg.Types != "" {
+		// Invalid rules are reported when the transform chain is built.
+		if rules, err := transform.ParseTypeRules(cfg.Types); err == nil {
+			for field, typ := range rules {
+				if typ == transform.TypeString {
+					fields = append(fields, field)
+				}
+			}
+		}
+	}
+
+	if len(fields) > 0 {
+		ti.StringFields = make(map[string]bool, len(fields))
+		for _, f := range fields {
+			ti.StringFields[f] = true
+		}
+	}
+	return ti
+}
+
+// pushdownFields returns the fields parsers need to extract: the --fields
+// list, when outputs limited to it are all that read an entry's fields.
+// Transform stages, --route, --alert and --notify-when conditions, the
+// --output-by-field field and the top command may read any field, so with
+// them every field is extracted (nil).
+func pushdownFields(cfg Config, chain *transform.Chain) []string {
+	if chain.Len() > 0 || len(cfg.Routes) > 0 || len(cfg.Alerts) > 0 || cfg.NotifyWhen != "" || cfg.OutputByField != "" || cfg.Top {
+		return nil
+	}
+	return cfg.Fields
 }
 
 // run executes the main conversion pipeline using stdin/stdout/stderr.
 func run(cfg Config) error {
-	return runPipeline(cfg, os.Stdin, os.Stdout, os.Stderr)
+	if cfg.Check && (cfg.Bench || cfg.Test || cfg.InferSchema || cfg.Describe || cfg.Dev || cfg.DockerPlugin || cfg.Merge || cfg.Top) {
+		return fmt.Errorf("--check cannot be combined with the bench, test, schema, describe, dev, docker-plugin, merge or top commands")
+	}
+	if cfg.Dev {
+		return runDevCommand(cfg, os.Stdin, os.Stdout, os.Stderr)
+	}
+	if cfg.Bench {
+		return runBench(cfg, os.Stdin, os.Stdout, os.Stderr)
+	}
+	if cfg.Test {
+		return runTestCommand(cfg, os.Stdin, os.Stdout, os.Stderr)
+	}
+	ctx, stop := shutdownContext(context.Background(), os.Stderr)
+	defer stop()
+	if cfg.DockerPlugin {
+		return runDockerPlugin(ctx, cfg, os.Stderr)
+	}
+	return runPipelineContext(ctx, cfg, os.Stdin, os.Stdout, os.Stderr)
 }
 
-// runPipeline executes the conversion pipeline with explicit I/O.
-func runPipeline(cfg Config, input io.Reader, output io.Writer, errOutput io.Writer) error {
+// buildRegistry creates the parser registry the parser options describe,
+// and loads the WebAssembly plugin, whose transform export, if any, is a
+// transform stage. The returned function stops the --exec-parser
+// processes.
+func buildRegistry(cfg Config, errOutput io.Writer) (*parser.Registry, *wasm.Plugin, func(), error) {
 	// Build parser registry options
 	var regOpts []parser.RegistryOption
 
@@ -196,85 +1111,998 @@ func runPipeline(cfg Config, input io.Reader, output io.Writer, errOutput io.Wri
 	if cfg.Adaptive {
 		regOpts = append(regOpts, parser.WithAdaptiveMode())
 	}
+	if cfg.RedetectAfter < 0 {
+		return nil, nil, nil, fmt.Errorf("invalid --redetect-after: %d is negative", cfg.RedetectAfter)
+	}
+	if cfg.RedetectAfter > 0 && (cfg.Adaptive || cfg.Format != "" || len(cfg.Patterns) > 0) {
+		return nil, nil, nil, fmt.Errorf("--redetect-after only applies to auto-detection without --adaptive")
+	}
+	if cfg.RedetectAfter > 0 {
+		regOpts = append(regOpts, parser.WithRedetectAfter(cfg.RedetectAfter))
+	}
+	if cfg.DetectLines < 0 {
+		return nil, nil, nil, fmt.Errorf("invalid --detect-lines: %d is negative", cfg.DetectLines)
+	}
+	if cfg.NoFallback && cfg.Fallback != "" {
+		return nil, nil, nil, fmt.Errorf("--no-fallback cannot be combined with --fallback")
+	}
+	if (cfg.NoFallback || cfg.Fallback != "") && (cfg.Format != "" || len(cfg.Patterns) > 0) {
+		return nil, nil, nil, fmt.Errorf("--fallback and --no-fallback only apply to auto-detection, not --format or --pattern")
+	}
+	if len(cfg.Parsers) > 0 && (cfg.Format != "" || len(cfg.Patterns) > 0) {
+		return nil, nil, nil, fmt.Errorf("--parsers only applies to auto-detection, not --format or --pattern")
+	}
+	if cfg.NoFallback {
+		regOpts = append(regOpts, parser.WithFallback(""))
+	} else if cfg.Fallback != "" {
+		regOpts = append(regOpts, parser.WithFallback(cfg.Fallback))
+	}
+	inference := typeInference(cfg)
+	regOpts = append(regOpts, parser.WithTypeInference(inference))
+	tuned, err := tunedParsers(cfg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	regOpts = append(regOpts, tuned...)
 
-	// Create registry
+	// Load the WebAssembly plugin; its parser is forced unless a format
+	// was given, and registered so --format can name it
+	var plugin *wasm.Plugin
+	var pluginParser *parser.WasmParser
+	if cfg.WasmPlugin != "" {
+		p, err := wasm.LoadPlugin(cfg.WasmPlugin, errOutput)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid --wasm-plugin: %w", err)
+		}
+		plugin = p
+		if p.HasParse() {
+			base := filepath.Base(cfg.WasmPlugin)
+			pluginParser, err = parser.NewWasmParser(strings.TrimSuffix(base, filepath.Ext(base)), p)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("invalid --wasm-plugin: %w", err)
+			}
+			if cfg.Format == "" {
+				regOpts = append(regOpts, parser.WithForcedFormat(pluginParser.Name()))
+			}
+		}
+	}
+
+	// Create registry; exec parsers are stopped by the returned function
 	registry := parser.NewRegistry(regOpts...)
+	var closers []io.Closer
+	closeParsers := func() {
+		for _, c := range closers {
+			_ = c.Close()
+		}
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			closeParsers()
+		}
+	}()
+	for _, path := range cfg.Plugins {
+		p, err := parser.LoadPlugin(path)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid --plugin: %w", err)
+		}
+		if registry.GetParser(p.Name()) != nil {
+			return nil, nil, nil, fmt.Errorf("invalid --plugin: parser name %q is already registered", p.Name())
+		}
+		registry.RegisterFirst(p)
+	}
+	for _, command := range cfg.ExecParsers {
+		args := strings.Fields(command)
+		if len(args) == 0 {
+			return nil, nil, nil, fmt.Errorf("invalid --exec-parser: empty command")
+		}
+		base := filepath.Base(args[0])
+		name := strings.TrimSuffix(base, filepath.Ext(base))
+		if registry.GetParser(name) != nil {
+			return nil, nil, nil, fmt.Errorf("invalid --exec-parser: parser name %q is already registered", name)
+		}
+		p, err := parser.NewExecParser(name, args, errOutput)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid --exec-parser: %w", err)
+		}
+		closers = append(closers, p)
+		registry.RegisterFirst(p)
+	}
+	if pluginParser != nil {
+		if registry.GetParser(pluginParser.Name()) != nil {
+			return nil, nil, nil, fmt.Errorf("invalid --wasm-plugin: parser name %q conflicts with a built-in format", pluginParser.Name())
+		}
+		registry.Register(pluginParser)
+	}
+
+	if err := registerFormats(registry, cfg.FormatsDirs); err != nil {
+		return nil, nil, nil, err
+	}
+	if cfg.PatternsFile != "" {
+		if err := registerPatterns(registry, cfg.PatternsFile); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	// Restrict and reorder the formats auto-detection tries
+	if len(cfg.Parsers) > 0 {
+		if err := registry.Select(cfg.Parsers); err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid --parsers: %w", err)
+		}
+	}
+	if cfg.Fallback != "" && registry.GetParser(cfg.Fallback) == nil {
+		return nil, nil, nil, fmt.Errorf("unknown --fallback format %q; use --list to see available formats", cfg.Fallback)
+	}
 
 	// Validate format exists (fail fast instead of per-line errors)
-	if cfg.Format != "" && cfg.Pattern == "" {
+	if cfg.Format != "" && len(cfg.Patterns) == 0 {
 		if registry.GetParser(cfg.Format) == nil {
-			return fmt.Errorf("unknown format %q; use --list to see available formats", cfg.Format)
+			return nil, nil, nil, fmt.Errorf("unknown format %q; use --list to see available formats", cfg.Format)
 		}
 	}
 
 	// Handle custom pattern
-	if cfg.Pattern != "" {
-		regexParser, err := parser.NewRegexParser(cfg.Pattern)
+	if len(cfg.Patterns) > 0 {
+		regexParser, err := parser.NewRegexParser(cfg.Patterns...)
 		if err != nil {
-			return fmt.Errorf("invalid pattern: %w", err)
+			return nil, nil, nil, fmt.Errorf("invalid pattern: %w", err)
 		}
 		// Insert custom parser at highest priority
-		registry = parser.NewRegistry(parser.WithForcedFormat("regex"))
+		registry = parser.NewRegistry(parser.WithForcedFormat("regex"), parser.WithTypeInference(inference))
 		registry.Register(regexParser)
 	}
 
-	// Create emitter
-	emitOpts := emitter.Options{
+	ok = true
+	return registry, plugin, closeParsers, nil
+}
+
+// fieldOrder returns the keys to write first: --field-order, or else a
+// --query's columns, its window's bounds first.
+func fieldOrder(cfg Config) []string {
+	if len(cfg.FieldOrder) > 0 || cfg.Query == "" {
+		return cfg.FieldOrder
+	}
+	q, err := query.Parse(cfg.Query)
+	if err != nil {
+		return nil // reported by buildTransforms
+	}
+	if cfg.Window > 0 && q.Grouped() {
+		return append([]string{"window_start", "window_end"}, q.Columns()...)
+	}
+	return q.Columns()
+}
+
+// emitterOptions returns the JSON output settings of the output options.
+func emitterOptions(cfg Config) emitter.Options {
+	return emitter.Options{
 		Pretty:        cfg.Pretty,
 		Fields:        cfg.Fields,
+		FieldOrder:    fieldOrder(cfg),
 		AddTimestamp:  cfg.AddTimestamp,
 		AddLineNumber: cfg.AddLineNumber,
 		AddRaw:        cfg.AddRaw,
+		AddFormat:     cfg.AddFormat,
 		OmitEmpty:     cfg.OmitEmpty,
+		KeyPrefix:     cfg.KeyPrefix,
+		Namespace:     cfg.Namespace,
+		GroupOutput:   cfg.GroupOutput,
+		FlushLines:    cfg.FlushLines,
+		FlushInterval: cfg.FlushInterval,
+		Buffering:     bufferMode(cfg.Buffer),
+		BufferSize:    int(cfg.BufferSize),
+	}
+}
+
+// bufferMode converts --buffer; auto is left for streamOptions to resolve
+// for each output.
+func bufferMode(s string) emitter.BufferMode {
+	if s == "auto" {
+		return ""
+	}
+	return emitter.BufferMode(s)
+}
+
+// runPipeline executes the conversion pipeline with explicit I/O.
+func runPipeline(cfg Config, input io.Reader, output io.Writer, errOutput io.Writer) error {
+	return runPipelineContext(context.Background(), cfg, input, output, errOutput)
+}
+
+// runPipelineContext is like runPipeline, but stops reading once ctx is
+// done. What was read is still converted, the outputs are flushed and the
+// summary is written; the error returned is ctx's cause, if it has one.
+func runPipelineContext(ctx context.Context, cfg Config, input io.Reader, output io.Writer, errOutput io.Writer) error {
+	stats := newRunStats()
+	output = countingWriter{Writer: output, n: &stats.bytesOut}
+
+	registry, plugin, closeParsers, err := buildRegistry(cfg, errOutput)
+	if err != nil {
+		return err
+	}
+	defer closeParsers()
+
+	budget, err := newErrorBudget(cfg)
+	if err != nil {
+		return err
+	}
+	breaker, err := newErrorBreaker(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.CheckLines < 0 {
+		return fmt.Errorf("invalid --check-lines: must not be negative")
+	}
+	if cfg.CheckLines > 0 && !cfg.Check {
+		return fmt.Errorf("--check-lines requires --check")
+	}
+	if cfg.ExplainLines < 0 {
+		return fmt.Errorf("invalid --explain-lines: must not be negative")
+	}
+	if cfg.ExplainLines > 0 && cfg.Explain == "" {
+		return fmt.Errorf("--explain-lines requires --explain")
+	}
+
+	// Compile raw line filter
+	var matchRe *regexp.Regexp
+	if cfg.Match != "" {
+		re, err := regexp.Compile(cfg.Match)
+		if err != nil {
+			return fmt.Errorf("invalid --match regex: %w", err)
+		}
+		matchRe = re
+	} else if cfg.InvertMatch {
+		return fmt.Errorf("--invert-match requires --match")
+	}
+	// With --context, the lines --match rejects are still parsed, as the
+	// context of those it accepts; the transforms apply it
+	skipRe := matchRe
+	if cfg.Context > 0 {
+		skipRe = nil
+	}
+	if cfg.Head < 0 {
+		return fmt.Errorf("invalid --head: must not be negative")
+	}
+	if cfg.Mmap && cfg.ForwardListen != "" {
+		return fmt.Errorf("--mmap reads stdin, and cannot be combined with --forward-listen")
+	}
+	switch {
+	case cfg.Top && cfg.TopBy == "":
+		return fmt.Errorf("the top command needs the field to rank: log2json top --by FIELD")
+	case cfg.TopBy != "" && !cfg.Top:
+		return fmt.Errorf("--by applies to the top command")
+	case cfg.TopInterval < 0:
+		return fmt.Errorf("invalid --interval: %v is negative", cfg.TopInterval)
+	}
+	if cfg.Follow {
+		switch {
+		case len(cfg.FollowFiles) == 0:
+			return fmt.Errorf("--follow needs the files to follow, or - for stdin")
+		case cfg.ForwardListen != "" || cfg.Mmap || cfg.Merge || cfg.KubeNodeLogs != "":
+			return fmt.Errorf("--follow reads its files, and cannot be combined with --forward-listen, --mmap, merge or --kube-node-logs")
+		case cfg.Explain != "":
+			return fmt.Errorf("--explain cannot be combined with --follow")
+		}
+		stdin := 0
+		for _, arg := range cfg.FollowFiles {
+			if arg == followStdin {
+				stdin++
+			} else if _, err := filepath.Match(arg, ""); err != nil {
+				return fmt.Errorf("invalid --follow file %q: %w", arg, err)
+			}
+		}
+		if stdin > 1 {
+			return fmt.Errorf("--follow reads stdin (-) once")
+		}
+	}
+	if cfg.KubeNodeLogs != "" {
+		switch {
+		case cfg.ForwardListen != "" || cfg.Mmap || cfg.Merge:
+			return fmt.Errorf("--kube-node-logs follows its directory, and cannot be combined with --forward-listen, --mmap or merge")
+		case cfg.Explain != "":
+			return fmt.Errorf("--explain cannot be combined with --kube-node-logs")
+		}
+		if info, err := os.Stat(cfg.KubeNodeLogs); err != nil || !info.IsDir() {
+			return fmt.Errorf("invalid --kube-node-logs: %s is not a directory", cfg.KubeNodeLogs)
+		}
+	}
+	if cfg.Merge {
+		switch {
+		case len(cfg.MergeFiles) == 0:
+			return fmt.Errorf("merge needs the files to merge")
+		case cfg.ForwardListen != "" || cfg.Mmap:
+			return fmt.Errorf("merge reads its files, and cannot be combined with --forward-listen or --mmap")
+		case cfg.Explain != "":
+			return fmt.Errorf("--explain cannot be combined with merge")
+		}
+	}
+
+	// Schema violations are written to their own stream
+	var rejects *emitter.Emitter
+	if cfg.Schema != "" {
+		rejectOutput := errOutput
+		if cfg.SchemaErrors != "" && !cfg.Check {
+			f, err := os.Create(cfg.SchemaErrors)
+			if err != nil {
+				return fmt.Errorf("cannot open --schema-errors file: %w", err)
+			}
+			defer func() { _ = f.Close() }()
+			rejectOutput = f
+		}
+		rejects = emitter.New(rejectOutput, emitter.Options{AddLineNumber: true, AddRaw: true})
+		defer func() { _ = rejects.Close() }()
+	}
+
+	// Build transform stages
+	chain, err := buildTransforms(cfg, rejects, plugin, errOutput)
+	if err != nil {
+		return err
+	}
+	registry.WantFields(pushdownFields(cfg, chain))
+
+	// Create emitter
+	emitOpts := emitterOptions(cfg)
+	if cfg.FlushLines < 0 || cfg.FlushInterval < 0 {
+		return fmt.Errorf("invalid --flush-lines or --flush-interval: must not be negative")
+	}
+	switch cfg.Buffer {
+	case "", "auto", string(emitter.BufferLine), string(emitter.BufferBlock):
+	default:
+		return fmt.Errorf("invalid --buffer %q: must be auto, line or block", cfg.Buffer)
+	}
+	if cfg.BufferSize < 0 || cfg.BufferSize > maxBufferSize {
+		return fmt.Errorf("invalid --buffer-size: must be between 0 and %d bytes", maxBufferSize)
+	}
+	if cfg.AddHost || len(cfg.AddEnv) > 0 {
+		emitOpts.Host = emitter.HostMetadata(version, cfg.AddEnv)
+	}
+	switch cfg.OutputFormat {
+	case "", "json":
+	case "parquet", "avro", "cbor":
+		if len(cfg.Routes) > 0 {
+			return fmt.Errorf("--output-format %s cannot be combined with --route", cfg.OutputFormat)
+		}
+		if cfg.OutputFormat == "parquet" && cfg.ParquetRowGroup <= 0 {
+			return fmt.Errorf("invalid --parquet-row-group: must be positive")
+		}
+	default:
+		return fmt.Errorf("invalid --output-format %q: must be json, parquet, avro or cbor", cfg.OutputFormat)
+	}
+	if cfg.OTLPEndpoint != "" && (len(cfg.Outputs) > 0 || len(cfg.Routes) > 0 || cfg.OutputFormat != "" && cfg.OutputFormat != "json") {
+		return fmt.Errorf("--otlp-endpoint cannot be combined with --output, --output-format or --route")
+	}
+	if cfg.OTLPEndpoint != "" && (cfg.KeyPrefix != "" || cfg.Namespace != "" || cfg.GroupOutput) {
+		return fmt.Errorf("--key-prefix, --namespace and --group-output cannot be combined with --otlp-endpoint")
+	}
+	if len(cfg.Outputs) > 1 && len(cfg.Routes) > 0 {
+		return fmt.Errorf("--route cannot be combined with several --output destinations")
+	}
+	if cfg.OutputByField != "" {
+		switch {
+		case len(cfg.Outputs) > 0 || len(cfg.Routes) > 0 || cfg.OTLPEndpoint != "":
+			return fmt.Errorf("--output-by-field cannot be combined with --output, --route or --otlp-endpoint")
+		case cfg.OutputFormat != "" && cfg.OutputFormat != "json" || cfg.OutputTemplate != "" || cfg.OutputCompress != "" || cfg.OutputAtomic:
+			return fmt.Errorf("--output-by-field writes JSON, and cannot be combined with --output-format, --output-template, --output-compress or --atomic")
+		case cfg.OutputByFieldMax < 0:
+			return fmt.Errorf("invalid --output-by-field-max-open: %d is negative", cfg.OutputByFieldMax)
+		}
+	}
+	var esOutput, httpOutput, syslogOutput, forwardOutput, fileOutput bool
+	seen := make(map[string]bool, len(cfg.Outputs))
+	for _, dest := range cfg.Outputs {
+		switch {
+		case seen[dest]:
+			return fmt.Errorf("--output %s given more than once", outputName(dest))
+		case emitter.IsESURL(dest):
+			esOutput = true
+		case emitter.IsHTTPURL(dest):
+			httpOutput = true
+		case emitter.IsSyslogURL(dest):
+			syslogOutput = true
+		case emitter.IsForwardURL(dest):
+			forwardOutput = true
+		case !isStdout(dest):
+			fileOutput = true
+		}
+		seen[dest] = true
+	}
+	if esOutput && (len(cfg.Routes) > 0 || cfg.OutputFormat != "" && cfg.OutputFormat != "json") {
+		return fmt.Errorf("an es:// --output cannot be combined with --output-format or --route")
+	}
+	if cfg.ESAPIKey != "" && !esOutput {
+		return fmt.Errorf("--es-api-key requires an es:// --output")
+	}
+	if cfg.OutputAuth != "" {
+		switch {
+		case !esOutput && !httpOutput && cfg.OTLPEndpoint == "":
+			return fmt.Errorf("--output-auth requires an http(s):// or es:// --output, or --otlp-endpoint")
+		case cfg.ESAPIKey != "":
+			return fmt.Errorf("--es-api-key cannot be combined with --output-auth")
+		}
+	}
+	if httpOutput && (len(cfg.Routes) > 0 || cfg.OutputFormat != "" && cfg.OutputFormat != "json") {
+		return fmt.Errorf("an http(s):// --output cannot be combined with --output-format or --route")
+	}
+	if len(cfg.OutputHeaders) > 0 && !httpOutput {
+		return fmt.Errorf("--output-header requires an http(s):// --output")
+	}
+	if syslogOutput && (len(cfg.Routes) > 0 || cfg.OutputFormat != "" && cfg.OutputFormat != "json" || cfg.KeyPrefix != "" || cfg.Namespace != "" || cfg.GroupOutput) {
+		return fmt.Errorf("a syslog:// --output cannot be combined with --output-format, --route, --key-prefix, --namespace or --group-output")
+	}
+	if (cfg.SyslogFacility != "" || cfg.SyslogSDID != "") && !syslogOutput {
+		return fmt.Errorf("--syslog-facility and --syslog-sd-id require a syslog:// --output")
+	}
+	if forwardOutput && (len(cfg.Routes) > 0 || cfg.OutputFormat != "" && cfg.OutputFormat != "json") {
+		return fmt.Errorf("a forward:// --output cannot be combined with --output-format or --route")
+	}
+	if cfg.ForwardTag != "" {
+		if !forwardOutput {
+			return fmt.Errorf("--forward-tag requires a forward:// --output")
+		}
+		if _, err := emitter.ParseTemplate(cfg.ForwardTag); err != nil {
+			return fmt.Errorf("invalid --forward-tag: %w", err)
+		}
+	}
+	var tmpl *template.Template
+	if cfg.OutputTemplate != "" {
+		if cfg.OutputFormat != "" && cfg.OutputFormat != "json" {
+			return fmt.Errorf("--output-template cannot be combined with --output-format %s", cfg.OutputFormat)
+		}
+		if len(cfg.Routes) > 0 || cfg.OTLPEndpoint != "" {
+			return fmt.Errorf("--output-template cannot be combined with --route or --otlp-endpoint")
+		}
+		var err error
+		if tmpl, err = emitter.ParseTemplate(cfg.OutputTemplate); err != nil {
+			return fmt.Errorf("invalid --output-template: %w", err)
+		}
+	}
+	if cfg.BenchFile != "" && !cfg.Bench {
+		return fmt.Errorf("--file requires the bench command")
+	}
+	if (cfg.TestInput != "" || cfg.TestExpect != "") && !cfg.Test {
+		return fmt.Errorf("--input and --expect require the test command")
+	}
+	if cfg.SchemaReport && !cfg.InferSchema {
+		return fmt.Errorf("--report requires the schema command")
+	}
+	if cfg.DescribeLines < 0 {
+		return fmt.Errorf("invalid --lines: must not be negative")
+	}
+	if (cfg.InferSchema || cfg.Describe) && (cfg.OutputFormat != "" && cfg.OutputFormat != "json" || tmpl != nil || len(cfg.Routes) > 0 || cfg.OutputByField != "" || cfg.OTLPEndpoint != "" || esOutput || httpOutput || syslogOutput || forwardOutput) {
+		command := "schema"
+		if cfg.Describe {
+			command = "describe"
+		}
+		return fmt.Errorf("the %s command cannot be combined with --output-format, --output-template, --route, --output-by-field, --otlp-endpoint or a network --output", command)
+	}
+	var avroOpts []emitter.AvroOption
+	if cfg.AvroSchema != "" {
+		if cfg.OutputFormat != "avro" {
+			return fmt.Errorf("--avro-schema requires --output-format avro")
+		}
+		data, err := os.ReadFile(cfg.AvroSchema)
+		if err != nil {
+			return fmt.Errorf("cannot read --avro-schema file: %w", err)
+		}
+		schema, err := emitter.ParseAvroSchema(data)
+		if err != nil {
+			return fmt.Errorf("invalid --avro-schema: %w", err)
+		}
+		avroOpts = append(avroOpts, emitter.WithAvroSchema(schema))
+	}
+	if cfg.OutputAppend || cfg.OutputAtomic {
+		if !fileOutput && len(cfg.Routes) == 0 && cfg.OutputByField == "" {
+			return fmt.Errorf("--append and --atomic require a file --output, --route or --output-by-field")
+		}
+		if cfg.OutputAppend && cfg.OutputAtomic {
+			return fmt.Errorf("--append and --atomic cannot be combined")
+		}
+	}
+	rotate := rotateConfig(cfg)
+	if rotate != (emitter.RotateConfig{}) {
+		if cfg.OutputAtomic {
+			return fmt.Errorf("--atomic cannot be combined with file rotation")
+		}
+		if !fileOutput {
+			return fmt.Errorf("--rotate-size, --rotate-interval, --keep and --rotate-compress require a file --output")
+		}
+		if cfg.OutputFormat != "" && cfg.OutputFormat != "json" {
+			return fmt.Errorf("file rotation cannot be combined with --output-format %s", cfg.OutputFormat)
+		}
+		if rotate.Size <= 0 && rotate.Interval <= 0 {
+			return fmt.Errorf("--keep and --rotate-compress require --rotate-size or --rotate-interval")
+		}
+	}
+	switch cfg.OutputCompress {
+	case "":
+	case emitter.CompressGzip, emitter.CompressZstd:
+		if cfg.OTLPEndpoint != "" || esOutput || syslogOutput || forwardOutput || len(cfg.Routes) > 0 {
+			return fmt.Errorf("--output-compress cannot be combined with --otlp-endpoint, an es://, syslog:// or forward:// --output or --route")
+		}
+		if rotate != (emitter.RotateConfig{}) {
+			return fmt.Errorf("--output-compress cannot be combined with file rotation; use --rotate-compress")
+		}
+	default:
+		return fmt.Errorf("invalid --output-compress %q: must be gzip or zstd", cfg.OutputCompress)
+	}
+
+	var color bool
+	switch cfg.Color {
+	case "", "never":
+	case "always":
+		color = true
+	case "auto":
+		color = isTerminal(output)
+	default:
+		return fmt.Errorf("invalid --color %q: must be auto, always or never", cfg.Color)
+	}
+	var highlight *regexp.Regexp
+	if !cfg.InvertMatch {
+		highlight = matchRe
+	}
+
+	// Alert rules and webhooks (they only act once entries are written),
+	// given entries as they are written
+	alertOpts := emitOpts
+	alertOpts.Pretty, alertOpts.Color = false, false
+	encode := func(entry *parser.Entry) ([]byte, error) {
+		var buf bytes.Buffer
+		em := emitter.New(&buf, alertOpts)
+		if err := em.Emit(entry); err != nil {
+			return nil, err
+		}
+		err := em.Close()
+		return buf.Bytes(), err
+	}
+	var hooks []alertHook
+	defer func() {
+		for _, h := range hooks {
+			_ = h.Close()
+		}
+	}()
+	if len(cfg.Alerts) > 0 {
+		var opts []alert.Option
+		if cfg.Quiet {
+			opts = append(opts, alert.WithQuiet())
+		}
+		alerter, err := alert.New(cfg.Alerts, cfg.AlertRate, encode, errOutput, opts...)
+		if err != nil {
+			return fmt.Errorf("invalid --alert: %w", err)
+		}
+		hooks = append(hooks, alerter)
+	} else if cfg.AlertRate != "" {
+		return fmt.Errorf("--alert-rate requires --alert")
+	}
+	if cfg.NotifyWebhook != "" {
+		if cfg.NotifyWhen == "" {
+			return fmt.Errorf("--notify-webhook needs --notify-when, the expression entries to send match")
+		}
+		if cfg.NotifyDigest < 0 {
+			return fmt.Errorf("invalid --notify-digest: %v is negative", cfg.NotifyDigest)
+		}
+		opts := []alert.WebhookOption{alert.WithDigest(cfg.NotifyDigest)}
+		if cfg.NotifyTemplate != "" {
+			tmpl, err := emitter.ParseTemplate(cfg.NotifyTemplate)
+			if err != nil {
+				return fmt.Errorf("invalid --notify-template: %w", err)
+			}
+			opts = append(opts, alert.WithTemplate(tmpl))
+		}
+		if cfg.Quiet {
+			opts = append(opts, alert.WithWebhookQuiet())
+		}
+		webhook, err := alert.NewWebhook(cfg.NotifyWebhook, cfg.NotifyWhen, encode, errOutput, opts...)
+		if err != nil {
+			return fmt.Errorf("invalid --notify-webhook: %w", err)
+		}
+		hooks = append(hooks, webhook)
+	} else if cfg.NotifyWhen != "" || cfg.NotifyTemplate != "" || cfg.NotifyDigest != 0 {
+		return fmt.Errorf("--notify-when, --notify-template and --notify-digest require --notify-webhook")
+	}
+
+	// --check stops here, before any output is opened
+	if cfg.Check {
+		for _, spec := range cfg.Routes {
+			if _, _, err := parseRoute(spec); err != nil {
+				return fmt.Errorf("invalid --route: %w", err)
+			}
+		}
+		return runCheck(ctx, cfg, registry, matchRe, input, output, errOutput)
+	}
+
+	env := &outputEnv{cfg: cfg, stdout: output, errOutput: errOutput, emitOpts: emitOpts, avroOpts: avroOpts, tmpl: tmpl, color: color, highlight: highlight, written: &stats.bytesOut}
+	var emit entrySink
+	switch {
+	case cfg.OTLPEndpoint != "":
+		exporter, err := newOTLPExporter(cfg, emitOpts, errOutput)
+		if err != nil {
+			return err
+		}
+		emit = exporter
+	case cfg.OutputByField != "":
+		// Shards are files, opened as they are needed
+		opts := streamOptions(nil, true, emitOpts)
+		sharder, err := emitter.NewShardWriter(cfg.OutputByField, opts, func(path string, reopen bool) (io.WriteCloser, error) {
+			if dir := filepath.Dir(path); dir != "." {
+				if err := os.MkdirAll(dir, 0o750); err != nil {
+					return nil, fmt.Errorf("cannot open --output-by-field file: %w", err)
+				}
+			}
+			f, err := emitter.OpenOutputFile(path, reopen || cfg.OutputAppend)
+			if err != nil {
+				return nil, fmt.Errorf("cannot open --output-by-field file: %w", err)
+			}
+			return countingWriteCloser{countingWriter{Writer: f, n: &stats.bytesOut}, f}, nil
+		}, cfg.OutputByFieldMax)
+		if err != nil {
+			return fmt.Errorf("invalid --output-by-field: %w", err)
+		}
+		emit = sharder
+	case len(cfg.Routes) > 0:
+		// Routes to "stdout" go to the --output file, if there is one
+		dest := "stdout"
+		if len(cfg.Outputs) == 1 {
+			dest = cfg.Outputs[0]
+		}
+		w, closers, err := env.writer(dest)
+		if err != nil {
+			return err
+		}
+		outputs := newOutputSet(w, errOutput, emitOpts, func(path string) (io.WriteCloser, error) {
+			f, err := openOutputFile(cfg, path)
+			if err != nil {
+				return nil, err
+			}
+			return countingWriteCloser{countingWriter{Writer: f, n: &stats.bytesOut}, f}, nil
+		})
+		defer func() { _ = outputs.Close() }()
+		router, err := buildRouter(cfg.Routes, outputs)
+		if err != nil {
+			for _, c := range closers {
+				_ = c.Close()
+			}
+			return err
+		}
+		emit = &closingSink{entrySink: router, closers: closers}
+	case cfg.Top && len(cfg.Outputs) == 0:
+		// The ranking is the output
+		emit = discardSink{}
+	default:
+		sink, err := env.openAll()
+		if err != nil {
+			return err
+		}
+		emit = sink
 	}
-	emit := emitter.New(output, emitOpts)
 	defer func() { _ = emit.Close() }()
+	if cfg.Top {
+		board := newTopBoard(cfg.TopBy)
+		emit = &topSink{entrySink: emit, board: board}
+		interval := cfg.TopInterval
+		if interval == 0 {
+			interval = defaultTopInterval
+		}
+		defer startTop(board, errOutput, interval)()
+	}
+	if len(hooks) > 0 {
+		emit = &alertSink{entrySink: emit, hooks: hooks}
+	}
+
+	// Probes for orchestrators, once the outputs are open
+	var health *healthServer
+	if cfg.HealthListen != "" {
+		health, err = startHealthServer(cfg.HealthListen, errOutput)
+		if err != nil {
+			return err
+		}
+		defer health.close()
+	}
 
 	// Create stream reader
-	streamReader := reader.New(input)
+	readOpts := []reader.Option{reader.WithReadCounter(&stats.bytesIn)}
+	if cfg.Mmap {
+		readOpts = append(readOpts, reader.WithMmap())
+	}
+	if cfg.BufferSize > 0 {
+		readOpts = append(readOpts, reader.WithBufferSize(int(cfg.BufferSize)))
+	}
+	streamReader := reader.New(input, readOpts...)
+	detectLines := cfg.DetectLines
+	if detectLines == 0 {
+		detectLines = parser.DefaultSampleSize
+	}
 
-	// Process lines
-	lineCount := 0
-	errorCount := 0
+	// fail reports a failed line and counts it against the error budget,
+	// returning an error once the run must stop
+	fail := func(kind string, line int, err error) error {
+		if !cfg.Quiet {
+			_, _ = fmt.Fprintf(errOutput, "%s error at line %d: %v\n", kind, line, err)
+		}
+		return budget.fail(line, err)
+	}
 
-	for line := range streamReader.Lines() {
-		lineCount++
+	// emitted counts the entries written, for --head
+	emitted := 0
+	emitAll := func(entries []*parser.Entry) error {
+		for _, out := range entries {
+			if cfg.Head > 0 && emitted >= cfg.Head {
+				break
+			}
+			emitted++
+			if err := emit.Emit(out); err != nil {
+				stats.Errors.Output++
+				if err := fail("output", out.LineNum, err); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	// Outputs copy what they keep of an entry, so once it is emitted only
+	// a stage holding entries back may still refer to it
+	release := !chain.Holds()
+
+	explained := 0
+	handle := func(line reader.Line) error {
+		stats.Lines.Read++
 
 		// Handle read errors
-		if line.Err != nil {
-			if !cfg.Quiet {
-				_, _ = fmt.Fprintf(errOutput, "read error at line %d: %v\n", line.Number, line.Err)
+		var parseErr *inputParseError
+		if line.Err != nil && !errors.As(line.Err, &parseErr) {
+			stats.Errors.Read++
+			budget.lines++
+			return fail("read", line.Number, line.Err)
+		}
+
+		// Skip lines rejected by the raw line filter (cheaper than parsing)
+		if skipRe != nil && skipRe.MatchString(line.Text) == cfg.InvertMatch {
+			stats.Lines.Skipped++
+			return nil
+		}
+		budget.lines++
+
+		// Explain the choice of parser before Parse caches a format
+		var explanation *parser.Explanation
+		if cfg.Explain != "" && (cfg.ExplainLines == 0 || explained < cfg.ExplainLines) {
+			explained++
+			explanation = registry.Explain(line.Text)
+			if cfg.Explain == "stderr" {
+				writeExplanation(errOutput, line.Number, explanation)
 			}
-			errorCount++
-			continue
 		}
 
-		// Parse the line
-		entry, err := registry.Parse(line.Text)
+		// Parse the line, unless its input did, or the lines are passed
+		// through raw since too many failed
+		entry := line.Entry
+		var err error
+		switch {
+		case parseErr != nil:
+			err = parseErr.err
+		case entry == nil && breaker != nil && breaker.tripped:
+			entry = parser.NewEntry(line.Text)
+			entry.Fields["raw"] = line.Text
+		case entry == nil:
+			entry, err = registry.Parse(line.Text)
+		}
+
+		// Too many recent lines that fail to parse stop the run, or from
+		// now on pass the lines through
+		if breaker != nil && !breaker.tripped && (err != nil || !errors.Is(entry.ParseError, parser.ErrEmptyLine)) {
+			if breaker.add(err != nil || entry.ParseError != nil) {
+				if !breaker.passthrough {
+					return breaker.err(line.Number)
+				}
+				if !cfg.Quiet {
+					_, _ = fmt.Fprintf(errOutput, "warning: %v; passing the remaining lines through raw\n", breaker.err(line.Number))
+				}
+			}
+		}
 		if err != nil {
-			if !cfg.Quiet {
-				_, _ = fmt.Fprintf(errOutput, "parse error at line %d: %v\n", line.Number, err)
+			stats.Errors.Parse++
+			return fail("parse", line.Number, err)
+		}
+		stats.parsed(entry)
+		for k, v := range line.Fields {
+			if _, ok := entry.Fields[k]; !ok {
+				entry.Fields[k] = v
 			}
-			errorCount++
-			continue
+		}
+		if explanation != nil && cfg.Explain == "field" {
+			entry.Fields["_detection"] = explanation.Fields()
 		}
 
 		// Set line number
 		entry.LineNum = line.Number
 
-		// Emit JSON
-		if err := emit.Emit(entry); err != nil {
-			if !cfg.Quiet {
-				_, _ = fmt.Fprintf(errOutput, "output error at line %d: %v\n", line.Number, err)
+		// Lines no format parsed count against the error budget; they are
+		// still emitted with their _parseError
+		if budget.enabled() && entry.ParseError != nil && !errors.Is(entry.ParseError, parser.ErrEmptyLine) {
+			if err := budget.fail(line.Number, entry.ParseError); err != nil {
+				return err
+			}
+		}
+
+		// Transform and emit JSON, then reuse the entry if nothing else
+		// can still refer to it
+		outs := chain.Process(entry)
+		err = emitAll(outs)
+		if release && (len(outs) == 0 || len(outs) == 1 && outs[0] == entry) {
+			entry.Release()
+		}
+		return err
+	}
+
+	// The reader stops early if the error budget runs out or ctx is done
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var lines <-chan reader.Line
+	if cfg.ForwardListen != "" {
+		lines, err = forwardLines(ctx, cfg.ForwardListen, &stats.bytesIn, errOutput, cfg.Quiet)
+		if err != nil {
+			return err
+		}
+	} else if cfg.Merge {
+		var stopMerge func()
+		lines, stopMerge, err = mergeLines(ctx, cfg, &stats.bytesIn, errOutput)
+		if err != nil {
+			return err
+		}
+		defer stopMerge()
+	} else if cfg.Follow {
+		var stdin <-chan reader.Line
+		if slices.Contains(cfg.FollowFiles, followStdin) {
+			stdin = streamReader.LinesContext(ctx)
+		}
+		var stopFollow func()
+		lines, stopFollow, err = followLines(ctx, cfg, stdin, registry.AutoDetects(), &stats.bytesIn, errOutput)
+		if err != nil {
+			return err
+		}
+		defer stopFollow()
+	} else if cfg.KubeNodeLogs != "" {
+		var stopKube func()
+		lines, stopKube, err = kubeLines(ctx, cfg, registry.AutoDetects(), &stats.bytesIn, errOutput)
+		if err != nil {
+			return err
+		}
+		defer stopKube()
+	} else {
+		lines = streamReader.LinesContext(ctx)
+	}
+
+	// The describe command reads only a sample of the input, and --head
+	// stops reading once it has its entries
+	sampled := func() bool {
+		return cfg.Describe && cfg.DescribeLines > 0 && stats.Lines.Read >= cfg.DescribeLines ||
+			cfg.Head > 0 && emitted >= cfg.Head
+	}
+
+	process := func() error {
+		// Tell probes and a systemd Type=notify unit that input is being read
+		health.setReady(true)
+		defer health.setReady(false)
+		if err := sdNotify("READY=1"); err != nil && !cfg.Quiet {
+			_, _ = fmt.Fprintf(errOutput, "warning: %v\n", err)
+		}
+		defer func() { _ = sdNotify("STOPPING=1") }()
+
+		// The systemd watchdog is fed from the read loop, so that it stops
+		// being fed, and systemd restarts the service, when conversion
+		// stalls, as on an output that blocks
+		var watchdog <-chan time.Time
+		if interval := sdWatchdogInterval(); interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			watchdog = ticker.C
+		}
+
+		// Pick the format from a sample of the first lines; merge,
+		// --follow and --kube-node-logs pick each file's own
+		if registry.AutoDetects() && !cfg.Merge && !cfg.Follow && cfg.KubeNodeLogs == "" {
+			sample := sampleLines(lines, detectLines, detectWait)
+			texts := make([]string, 0, len(sample))
+			for _, line := range sample {
+				if line.Err == nil && (skipRe == nil || skipRe.MatchString(line.Text) != cfg.InvertMatch) {
+					texts = append(texts, line.Text)
+				}
+			}
+			p := registry.Detect(texts)
+			if p != nil && (cfg.Verbose || cfg.Explain == "stderr") {
+				_, _ = fmt.Fprintf(errOutput, "detected format: %s\n", p.Name())
+			}
+			if p == nil && cfg.Explain == "stderr" {
+				_, _ = fmt.Fprintf(errOutput, "detected format: none in %d sample lines, choosing per line\n", len(texts))
+			}
+			for _, line := range sample {
+				if sampled() {
+					break
+				}
+				if err := handle(line); err != nil {
+					return err
+				}
 			}
-			errorCount++
 		}
+	read:
+		for !sampled() {
+			// A read blocked on the input does not hold up a shutdown
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					break read
+				}
+				if err := handle(line); err != nil {
+					return err
+				}
+			case reply := <-health.requests():
+				data, err := stats.encode(registry)
+				if err != nil {
+					data = []byte("{}\n")
+				}
+				reply <- data
+			case <-watchdog:
+				_ = sdNotify("WATCHDOG=1")
+			case <-ctx.Done():
+				break read
+			}
+		}
+
+		// Emit anything still buffered by transform stages
+		return emitAll(chain.Flush())
 	}
+	err = process()
 
-	// Print summary in verbose mode
-	if cfg.Verbose {
-		_, _ = fmt.Fprintf(errOutput, "processed %d lines, %d errors\n", lineCount, errorCount)
+	// Flush output; Parquet writes its footer here
+	if closeErr := emit.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf("cannot write output: %w", closeErr)
 	}
 
-	return nil
+	// Summarize the run, even one the error budget stopped
+	if cfg.Stats || cfg.Verbose {
+		if statsErr := writeStats(cfg, stats, registry, errOutput); statsErr != nil && err == nil {
+			err = statsErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if cause := context.Cause(ctx); cause != nil && !errors.Is(cause, context.Canceled) {
+		return cause
+	}
+	return budget.result()
+}
+
+// detectWait bounds how long auto-detection waits for its sample, so a
+// slow live stream starts promptly.
+const detectWait = time.Second
+
+// sampleLines reads up to n lines, stopping early at the end of input or
+// once wait has passed.
+func sampleLines(lines <-chan reader.Line, n int, wait time.Duration) []reader.Line {
+	sample := make([]reader.Line, 0, n)
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+	for len(sample) < n {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return sample
+			}
+			sample = append(sample, line)
+		case <-timeout.C:
+			return sample
+		}
+	}
+	return sample
+}
+
+// writeExplanation prints an --explain report: the parser chosen for a
+// line, then each registered parser's verdict on it.
+func writeExplanation(w io.Writer, lineNum int, ex *parser.Explanation) {
+	_, _ = fmt.Fprintf(w, "line %d: %s\n", lineNum, ex)
+	for _, v := range ex.Parsers {
+		if v.Confidence == 0 && !v.Matched && v.Err == nil {
+			_, _ = fmt.Fprintf(w, "    %s: %s\n", v.Name, v)
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "    %s: %s (confidence %.2f)\n", v.Name, v, v.Confidence)
+	}
 }
@@ -1,12 +1,35 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
 	"encoding/json"
+	"flag"
+	"fmt"
 	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/dockerlog"
+	"github.com/juliosaraiva/log2json/internal/emitter"
+	"github.com/juliosaraiva/log2json/internal/forward"
+	"github.com/juliosaraiva/log2json/internal/parser"
+	"github.com/juliosaraiva/log2json/internal/reader"
 )
 
 // helper to run the pipeline and return stdout/stderr output
@@ -159,8 +182,8 @@ func TestIntegration_CustomPattern(t *testing.T) {
 2024-01-16 ERROR something failed`
 
 	cfg := Config{
-		Pattern: `(?P<date>\d{4}-\d{2}-\d{2}) (?P<level>\w+) (?P<msg>.+)`,
-		Quiet:   true,
+		Patterns: []string{`(?P<date>\d{4}-\d{2}-\d{2}) (?P<level>\w+) (?P<msg>.+)`},
+		Quiet:    true,
 	}
 
 	stdout, _ := runTest(t, cfg, input)
@@ -181,6 +204,36 @@ func TestIntegration_CustomPattern(t *testing.T) {
 	}
 }
 
+func TestIntegration_MultiplePatterns(t *testing.T) {
+	input := `2024-01-15 INFO hello world
+GET /health 200
+unrelated line`
+
+	cfg := Config{
+		Patterns: []string{
+			`^(?P<date>\d{4}-\d{2}-\d{2}) (?P<level>\w+) (?P<msg>.+)$`,
+			`^(?P<method>[A-Z]+) (?P<path>\S+) (?P<status>\d+)$`,
+		},
+		Quiet: true,
+	}
+
+	stdout, _ := runTest(t, cfg, input)
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(results))
+	}
+	if results[0]["level"] != "INFO" || results[0]["method"] != nil {
+		t.Errorf("line 1: expected the first pattern's fields, got %v", results[0])
+	}
+	if results[1]["path"] != "/health" || results[1]["status"] != float64(200) {
+		t.Errorf("line 2: expected the second pattern's fields, got %v", results[1])
+	}
+	if _, ok := results[2]["_parseError"]; !ok {
+		t.Errorf("line 3: expected a parse error, got %v", results[2])
+	}
+}
+
 func TestIntegration_AdaptiveMode(t *testing.T) {
 	input := `{"level":"info","msg":"json line"}
 Jan 15 10:30:46 host prog[1]: syslog line`
@@ -214,221 +267,4039 @@ Jan 15 10:30:46 host prog[1]: syslog line`
 	}
 }
 
-func TestIntegration_FieldFiltering(t *testing.T) {
-	input := `Jan 15 10:30:45 myhost sshd[1234]: Accepted password`
-
-	cfg := Config{
-		Fields: []string{"host", "message"},
-		Quiet:  true,
-	}
+func TestIntegration_AddFormat(t *testing.T) {
+	input := `{"msg":"json line"}
+Jan 15 10:30:46 host prog[1]: user=bob action=login
+level=info msg=kv
+plain text`
 
-	stdout, _ := runTest(t, cfg, input)
+	stdout, _ := runTest(t, Config{Adaptive: true, AddFormat: true, Quiet: true}, input)
 	results := parseNDJSON(t, stdout)
 
-	if len(results) != 1 {
-		t.Fatalf("expected 1 line, got %d", len(results))
+	want := []string{"json", "syslog", "kv", "generic"}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d lines, got %d", len(want), len(results))
+	}
+	for i, format := range want {
+		if results[i]["_format"] != format {
+			t.Errorf("line %d: _format = %v, want %s", i+1, results[i]["_format"], format)
+		}
 	}
+}
 
-	r := results[0]
-	if r["host"] != "myhost" {
-		t.Errorf("expected host=myhost, got %v", r["host"])
+func TestIntegration_Fallback(t *testing.T) {
+	input := `level=info msg=a
+plain text`
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want []map[string]any // fields of the second line; nil if dropped
+	}{
+		{
+			name: "generic by default",
+			cfg:  Config{Adaptive: true},
+			want: []map[string]any{{"message": "plain text"}},
+		},
+		{
+			name: "no fallback",
+			cfg:  Config{Adaptive: true, NoFallback: true},
+			want: []map[string]any{{"raw": "plain text", "_parseError": parser.ErrNoMatch.Error()}},
+		},
+		{
+			name: "no fallback dropped",
+			cfg:  Config{Adaptive: true, NoFallback: true, OmitEmpty: true},
+		},
+		{
+			name: "other parser",
+			cfg:  Config{Adaptive: true, Fallback: "json"},
+			want: []map[string]any{{"raw": "plain text"}},
+		},
 	}
-	if r["message"] != "Accepted password" {
-		t.Errorf("expected message=Accepted password, got %v", r["message"])
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Quiet = true
+			stdout, _ := runTest(t, tt.cfg, input)
+			results := parseNDJSON(t, stdout)
+			if len(results) != 1+len(tt.want) {
+				t.Fatalf("expected %d lines, got %d: %v", 1+len(tt.want), len(results), results)
+			}
+			for _, want := range tt.want {
+				for k, v := range want {
+					if results[1][k] != v {
+						t.Errorf("%s = %v, want %v", k, results[1][k], v)
+					}
+				}
+			}
+		})
 	}
-	// Should NOT contain other fields
-	if _, ok := r["program"]; ok {
-		t.Error("expected program field to be filtered out")
+}
+
+func TestIntegration_Parsers(t *testing.T) {
+	input := `{"msg":"json line"}
+level=info msg=kv`
+
+	stdout, _ := runTest(t, Config{Adaptive: true, AddFormat: true, Parsers: []string{"kv", "generic"}, Quiet: true}, input)
+	results := parseNDJSON(t, stdout)
+
+	want := []string{"generic", "kv"}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d lines, got %d", len(want), len(results))
 	}
-	if _, ok := r["pid"]; ok {
-		t.Error("expected pid field to be filtered out")
+	for i, format := range want {
+		if results[i]["_format"] != format {
+			t.Errorf("line %d: _format = %v, want %s", i+1, results[i]["_format"], format)
+		}
 	}
 }
 
-func TestIntegration_OmitEmpty(t *testing.T) {
-	input := "valid line\n\nanother valid line"
-
-	cfg := Config{
-		OmitEmpty: true,
-		Quiet:     true,
+func TestIntegration_ExecParser(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("needs /bin/sh")
 	}
+	path := filepath.Join(t.TempDir(), "audit.sh")
+	script := `#!/bin/sh
+while IFS= read -r line; do
+	case "$line" in
+	*" did "*) printf '{"user":"%s","action":"%s"}\n' "${line%% did *}" "${line#* did }" ;;
+	*) echo null ;;
+	esac
+done
+`
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	input := `alice did login
+{"msg":"json line"}`
 
+	cfg := Config{ExecParsers: []string{path}, Adaptive: true, AddFormat: true, Quiet: true}
 	stdout, _ := runTest(t, cfg, input)
 	results := parseNDJSON(t, stdout)
 
-	// Empty line should be omitted (has ParseError=ErrEmptyLine)
 	if len(results) != 2 {
-		t.Fatalf("expected 2 lines (empty omitted), got %d", len(results))
+		t.Fatalf("expected 2 lines, got %d", len(results))
+	}
+	if results[0]["_format"] != "audit" || results[0]["user"] != "alice" || results[0]["action"] != "login" {
+		t.Errorf("line 1: expected the audit parser's fields, got %v", results[0])
+	}
+	if results[1]["_format"] != "json" {
+		t.Errorf("line 2: expected json for lines the command declines, got %v", results[1])
 	}
-}
 
-func TestIntegration_AddMetadata(t *testing.T) {
-	input := `Jan 15 10:30:45 myhost sshd[1234]: test message`
+	cfg = Config{ExecParsers: []string{path}, Format: "audit", Quiet: true}
+	stdout, _ = runTest(t, cfg, "bob did logout")
+	if results := parseNDJSON(t, stdout); len(results) != 1 || results[0]["user"] != "bob" {
+		t.Errorf("-f audit: got %v", results)
+	}
+}
 
-	cfg := Config{
-		AddTimestamp:  true,
-		AddLineNumber: true,
-		AddRaw:        true,
-		Quiet:         true,
+func TestIntegration_PatternsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "patterns.yaml")
+	patterns := `patterns:
+  myapp:
+    regex: '^\[(?P<level>\w+)\] (?P<msg>.*)$'
+    priority: 1
+  nginx-error:
+    dissect: '%{date} %{time} [%{level}] %{pid}#%{tid}: %{message}'
+`
+	if err := os.WriteFile(path, []byte(patterns), 0o644); err != nil {
+		t.Fatal(err)
 	}
+	input := `[INFO] started
+2024/01/15 10:30:45 [error] 12#0: open() failed`
 
-	stdout, _ := runTest(t, cfg, input)
-	results := parseNDJSON(t, stdout)
+	tests := []struct {
+		name string
+		cfg  Config
+		want []string // _format of each line
+	}{
+		{name: "auto-detected", cfg: Config{Adaptive: true}, want: []string{"myapp", "nginx-error"}},
+		{name: "forced", cfg: Config{Format: "nginx-error"}, want: []string{"nginx-error", "nginx-error"}},
+	}
 
-	if len(results) != 1 {
-		t.Fatalf("expected 1 line, got %d", len(results))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.PatternsFile = path
+			tt.cfg.AddFormat = true
+			tt.cfg.Quiet = true
+			stdout, _ := runTest(t, tt.cfg, input)
+			results := parseNDJSON(t, stdout)
+			if len(results) != len(tt.want) {
+				t.Fatalf("expected %d lines, got %d", len(tt.want), len(results))
+			}
+			for i, format := range tt.want {
+				if results[i]["_format"] != format {
+					t.Errorf("line %d: _format = %v, want %s", i+1, results[i]["_format"], format)
+				}
+			}
+			if results[1]["pid"] != float64(12) {
+				t.Errorf("pid = %v, want 12", results[1]["pid"])
+			}
+		})
 	}
+}
 
-	r := results[0]
-	if _, ok := r["_ingestTime"]; !ok {
-		t.Error("expected _ingestTime field")
+func TestIntegration_FormatsDirs(t *testing.T) {
+	dir := t.TempDir()
+	definition := `description: Ticketed app logs
+grok: '%{LOGLEVEL:level} \[%{TICKET:ticket}\] %{GREEDYDATA:msg}'
+grok_patterns:
+  TICKET: '[A-Z]+-\d+'
+`
+	if err := os.WriteFile(filepath.Join(dir, "tickets.yaml"), []byte(definition), 0o644); err != nil {
+		t.Fatal(err)
 	}
-	if lineNum, ok := r["_lineNumber"].(float64); !ok || lineNum != 1 {
-		t.Errorf("expected _lineNumber=1, got %v", r["_lineNumber"])
+
+	cfg := Config{FormatsDirs: []string{dir}, AddFormat: true, Quiet: true}
+	stdout, _ := runTest(t, cfg, "ERROR [OPS-42] disk full\nWARN [OPS-7] disk almost full")
+	results := parseNDJSON(t, stdout)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(results))
 	}
-	if r["_raw"] != input {
-		t.Errorf("expected _raw to be original line, got %v", r["_raw"])
+	want := map[string]any{"_format": "tickets", "level": "ERROR", "ticket": "OPS-42", "msg": "disk full"}
+	for k, v := range want {
+		if results[0][k] != v {
+			t.Errorf("%s = %v, want %v", k, results[0][k], v)
+		}
 	}
 }
 
-func TestIntegration_VerboseMode(t *testing.T) {
-	input := `Jan 15 10:30:45 myhost sshd[1234]: test`
+func TestFormatsDirs(t *testing.T) {
+	config := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", config)
+	extra := t.TempDir()
+	t.Setenv("LOG2JSON_FORMATS_DIR", extra+string(os.PathListSeparator)+extra)
 
-	cfg := Config{
-		Verbose: true,
-		Quiet:   true,
+	// The default directory only counts if it exists
+	if got := formatsDirs(); !reflect.DeepEqual(got, []string{extra}) {
+		t.Errorf("formatsDirs() = %v, want [%s]", got, extra)
+	}
+	dflt := filepath.Join(config, "log2json", "formats")
+	if err := os.MkdirAll(dflt, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if got := formatsDirs(); !reflect.DeepEqual(got, []string{dflt, extra}) {
+		t.Errorf("formatsDirs() = %v, want [%s %s]", got, dflt, extra)
 	}
+}
 
-	_, stderr := runTest(t, cfg, input)
+func TestIntegration_RedetectAfter(t *testing.T) {
+	input := `{"msg":"one"}
+{"msg":"two"}
+a=1 b=2
+a=3 b=4
+a=5 b=6`
 
-	if !strings.Contains(stderr, "processed 1 lines") {
-		t.Errorf("expected verbose summary in stderr, got: %s", stderr)
+	cfg := Config{RedetectAfter: 2, DetectLines: 1, AddFormat: true, Quiet: true}
+	stdout, _ := runTest(t, cfg, input)
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 5 {
+		t.Fatalf("expected 5 lines, got %d", len(results))
+	}
+	// The first kv line fails with json; the second triggers re-detection
+	if _, ok := results[2]["_parseError"]; !ok {
+		t.Errorf("line 3: expected a parse error before re-detection, got %v", results[2])
+	}
+	for i, r := range results[3:] {
+		if r["_format"] != "kv" || r["a"] == nil {
+			t.Errorf("line %d: expected kv after re-detection, got %v", i+4, r)
+		}
 	}
 }
 
-func TestIntegration_UnknownFormat(t *testing.T) {
-	var out, errOut bytes.Buffer
-	cfg := Config{Format: "bogus"}
-	err := runPipeline(cfg, strings.NewReader("test"), &out, &errOut)
-	if err == nil {
-		t.Fatal("expected error for unknown format")
+func TestBench(t *testing.T) {
+	defer func(d time.Duration) { benchTime = d }(benchTime)
+	benchTime = time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "sample.log")
+	if err := os.WriteFile(path, []byte("a=1 b=2\nc=3 d=4\nplain text\n"), 0o644); err != nil {
+		t.Fatal(err)
 	}
-	if !strings.Contains(err.Error(), "unknown format") {
-		t.Errorf("expected unknown format error, got: %v", err)
+
+	tests := []struct {
+		name  string
+		cfg   Config
+		input string
+		want  []string
+		skip  []string
+	}{
+		{
+			name: "every format on a file",
+			cfg:  Config{BenchFile: path},
+			want: []string{"3 lines", path, "json ", "kv  ", "66.7%", "generic", "read", "parse", "emit", "total"},
+			skip: []string{"transform"},
+		},
+		{
+			name: "mapped file",
+			cfg:  Config{BenchFile: path, Format: "kv", Mmap: true},
+			want: []string{"3 lines", "kv ", "read", "parse", "emit", "total"},
+			skip: []string{"json", "generic"},
+		},
+		{
+			name:  "forced format with transforms from stdin",
+			cfg:   Config{Format: "kv", Where: "a == 1"},
+			input: "a=1 b=2\n",
+			want:  []string{"1 lines", "stdin", "kv ", "100.0%", "transform"},
+			skip:  []string{"json", "generic"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := runBench(tt.cfg, strings.NewReader(tt.input), &out, io.Discard); err != nil {
+				t.Fatalf("runBench() error: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("report lacks %q:\n%s", want, out.String())
+				}
+			}
+			for _, skip := range tt.skip {
+				if strings.Contains(out.String(), skip) {
+					t.Errorf("report should not have %q:\n%s", skip, out.String())
+				}
+			}
+		})
 	}
-}
 
-func TestIntegration_InvalidPattern(t *testing.T) {
-	var out, errOut bytes.Buffer
-	cfg := Config{Pattern: "(?P<broken"}
-	err := runPipeline(cfg, strings.NewReader("test"), &out, &errOut)
-	if err == nil {
-		t.Fatal("expected error for invalid pattern")
+	if err := runBench(Config{}, strings.NewReader(""), io.Discard, io.Discard); err == nil {
+		t.Error("expected an error for empty input")
 	}
-	if !strings.Contains(err.Error(), "invalid pattern") {
-		t.Errorf("expected invalid pattern error, got: %v", err)
+	if err := runBench(Config{Format: "nope"}, strings.NewReader("x\n"), io.Discard, io.Discard); err == nil {
+		t.Error("expected an error for an unknown format")
 	}
 }
 
-func TestIntegration_WithSampleFiles(t *testing.T) {
+func TestDevSession(t *testing.T) {
+	lines := []string{"INFO 200 started", "WARN 503 retrying", "garbage"}
+
 	tests := []struct {
-		name     string
-		file     string
-		format   string
-		minLines int
+		name        string
+		mode        devMode
+		keys        string
+		wantAccept  bool
+		wantPattern string
+		wantMode    devMode
+		wantScreen  []string
 	}{
-		{"syslog_file", "../../testdata/sample_syslog.log", "syslog", 6},
-		{"apache_file", "../../testdata/sample_apache.log", "apache", 5},
-		{"json_file", "../../testdata/sample_json.log", "json", 5},
-		{"kv_file", "../../testdata/sample_kv.log", "kv", 5},
-		{"generic_file", "../../testdata/sample_generic.log", "", 6},
-		{"mixed_file", "../../testdata/sample_mixed.log", "", 5},
+		{
+			name:        "type a regex",
+			keys:        `(?P<level>\w+) (?P<status>\d+) (?P<msg>.*)` + "\r",
+			wantAccept:  true,
+			wantPattern: `(?P<level>\w+) (?P<status>\d+) (?P<msg>.*)`,
+			wantScreen:  []string{`{"level":"INFO","msg":"started","status":200}`, "2 of 3 lines match", "\x1b[32mINFO\x1b[0m \x1b[36m200\x1b[0m"},
+		},
+		{
+			name:        "edit with the cursor keys",
+			keys:        "(?P<level>\\w+)x\x1b[D\x1b[D\x7fX\x1b[F\x7f\r",
+			wantAccept:  true,
+			wantPattern: `(?P<level>\wX)`,
+			wantScreen:  []string{"0 of 3 lines match", "line does not match"},
+		},
+		{
+			name:        "invalid regex",
+			keys:        "(?P<level\x03",
+			wantPattern: "(?P<level",
+			wantScreen:  []string{"invalid regex pattern"},
+		},
+		{
+			name:        "switch to dissect",
+			keys:        "\t%{level} %{status} %{msg}\x04",
+			wantPattern: "%{level} %{status} %{msg}",
+			wantMode:    devDissect,
+			wantScreen:  []string{"dissect> ", `{"level":"WARN","msg":"retrying","status":503}`, "2 of 3 lines match"},
+		},
+		{
+			name:        "clear the line",
+			mode:        devRegex,
+			keys:        "abc\x15",
+			wantPattern: "",
+			wantScreen:  []string{"type a pattern"},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			data, err := os.ReadFile(tt.file)
+			s := newDevSession("sample.log", lines, parser.TypeInference{}, tt.mode, "")
+			var screen bytes.Buffer
+			accept, err := s.run(bufio.NewReader(strings.NewReader(tt.keys)), &screen, func() (int, int) { return 160, 20 })
 			if err != nil {
-				t.Skipf("sample file not found: %s", tt.file)
+				t.Fatalf("run() error: %v", err)
 			}
-
-			cfg := Config{Quiet: true}
-			if tt.format != "" {
-				cfg.Format = tt.format
+			if accept != tt.wantAccept {
+				t.Errorf("accept = %v, want %v", accept, tt.wantAccept)
 			}
-			if tt.name == "mixed_file" {
-				cfg.Adaptive = true
+			if got := string(s.pattern); got != tt.wantPattern {
+				t.Errorf("pattern = %q, want %q", got, tt.wantPattern)
+			}
+			if s.mode != tt.wantMode {
+				t.Errorf("mode = %v, want %v", s.mode, tt.wantMode)
+			}
+			// The last frame drawn
+			frames := strings.Split(screen.String(), "\x1b[H\x1b[2J")
+			last := frames[len(frames)-1]
+			for _, want := range tt.wantScreen {
+				if !strings.Contains(last, want) {
+					t.Errorf("screen = %q, want it to contain %q", last, want)
+				}
 			}
+		})
+	}
+}
 
-			var out, errOut bytes.Buffer
-			err = runPipeline(cfg, bytes.NewReader(data), &out, &errOut)
-			if err != nil {
-				t.Fatalf("runPipeline error: %v", err)
+func TestDevCommand_Errors(t *testing.T) {
+	sample := filepath.Join(t.TempDir(), "sample.log")
+	if err := os.WriteFile(sample, []byte("INFO started\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stdin, err := os.Open(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{name: "no sample", cfg: Config{Dev: true}, want: "needs a sample file"},
+		{name: "missing sample", cfg: Config{Dev: true, DevSample: sample + ".missing"}, want: "cannot open sample file"},
+		{name: "several patterns", cfg: Config{Dev: true, DevSample: sample, Patterns: []string{"a", "b"}}, want: "single --pattern"},
+		{name: "not a terminal", cfg: Config{Dev: true, DevSample: sample}, want: "interactive terminal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := runDevCommand(tt.cfg, stdin, &out, stdin)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("runDevCommand() error = %v, want it to contain %q", err, tt.want)
 			}
+		})
+	}
+}
 
-			results := parseNDJSON(t, out.String())
-			if len(results) < tt.minLines {
-				t.Errorf("expected at least %d lines, got %d", tt.minLines, len(results))
+func TestTestCommand(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "sample.log")
+	if err := os.WriteFile(input, []byte("2024-01-15 INFO 200 hello\n2024-01-16 ERROR 500 oops\nnot matching\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pattern := `^(?P<date>\S+) (?P<level>\w+) (?P<status>\d+) (?P<msg>.*)$`
+
+	tests := []struct {
+		name    string
+		expect  string
+		wantErr string
+		want    []string
+	}{
+		{
+			name: "no expectations",
+			want: []string{
+				"line 1: matched regex", `level = "INFO"`, "status = 200",
+				"line 3: no match", "3 lines: 2 matched, 1 not matched",
+			},
+		},
+		{
+			name: "expectations met",
+			expect: `lines:
+  1: {level: INFO, status: 200, missing: null}
+  2:
+    msg: oops
+  3: false
+`,
+			want: []string{"expectations: 3 passed, 0 failed"},
+		},
+		{
+			name: "expectations failed",
+			expect: `lines:
+  1: {level: WARN, date: null}
+  2: {extra: 1}
+  3: {msg: x}
+  9: {msg: y}
+`,
+			wantErr: "4 of 4 expectations failed",
+			want: []string{
+				`level: got "INFO", want "WARN"`,
+				`date: got "2024-01-15", want no field`,
+				"extra: missing, want 1",
+				`no match, want fields {"msg":"x"}`,
+				"line 9: FAIL",
+				"expected, but the input has 3 lines",
+			},
+		},
+		{
+			name:    "invalid expectations",
+			expect:  "lines:\n  first: {msg: x}\n",
+			wantErr: "invalid --expect",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{Patterns: []string{pattern}, TestInput: input}
+			if tt.expect != "" {
+				cfg.TestExpect = filepath.Join(dir, "expect.yaml")
+				if err := os.WriteFile(cfg.TestExpect, []byte(tt.expect), 0o644); err != nil {
+					t.Fatal(err)
+				}
 			}
 
-			// Verify each line is valid JSON (already done by parseNDJSON)
-			for i, r := range results {
-				if len(r) == 0 {
-					t.Errorf("line %d has no fields", i+1)
+			var out bytes.Buffer
+			err := runTestCommand(cfg, strings.NewReader(""), &out, io.Discard)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("runTestCommand() error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("runTestCommand() error = %v, want %q", err, tt.wantErr)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("report lacks %q:\n%s", want, out.String())
 				}
 			}
 		})
 	}
 }
 
-func TestIntegration_PrettyOutput(t *testing.T) {
-	input := `{"level":"info","msg":"test"}`
+func TestIntegration_Stats(t *testing.T) {
+	input := `{"level":"info"}
+{"level":"warn"}
+not json
+`
 
-	cfg := Config{
-		Pretty: true,
-		Quiet:  true,
-	}
+	cfg := Config{Format: "json", Stats: true, Quiet: true}
+	stdout, stderr := runTest(t, cfg, input)
 
-	stdout, _ := runTest(t, cfg, input)
+	var stats runStats
+	if err := json.Unmarshal([]byte(stderr), &stats); err != nil {
+		t.Fatalf("expected a JSON summary, got %q: %v", stderr, err)
+	}
+	if want := (lineStats{Read: 3, Parsed: 2}); stats.Lines != want {
+		t.Errorf("lines = %+v, want %+v", stats.Lines, want)
+	}
+	if !reflect.DeepEqual(stats.Formats, map[string]int{"json": 2}) {
+		t.Errorf("formats = %v, want 2 json lines", stats.Formats)
+	}
+	if want := (errorStats{Parse: 1}); stats.Errors != want {
+		t.Errorf("errors = %+v, want %+v", stats.Errors, want)
+	}
+	// Formats that never ran are left out
+	if want := []parserStats{{Name: "json", Attempted: 3, Matched: 2, Failed: 1}}; !reflect.DeepEqual(stats.Parsers, want) {
+		t.Errorf("parsers = %+v, want %+v", stats.Parsers, want)
+	}
+	if want := (byteStats{In: int64(len(input)), Out: int64(len(stdout))}); stats.Bytes != want {
+		t.Errorf("bytes = %+v, want %+v", stats.Bytes, want)
+	}
+	if stats.ElapsedSeconds <= 0 {
+		t.Errorf("elapsedSeconds = %v, want it positive", stats.ElapsedSeconds)
+	}
 
-	// Pretty output should contain indentation
-	if !strings.Contains(stdout, "  ") {
-		t.Error("expected indented output with --pretty")
+	// --stats=FILE writes the summary there instead
+	path := filepath.Join(t.TempDir(), "stats.json")
+	cfg.StatsFile = path
+	if _, stderr := runTest(t, cfg, input); stderr != "" {
+		t.Errorf("expected nothing on stderr, got %q", stderr)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &stats); err != nil || stats.Lines.Read != 3 {
+		t.Errorf("stats file = %q, %v; want the summary", data, err)
 	}
 
-	// Should still be valid JSON
-	var m map[string]any
-	if err := json.Unmarshal([]byte(stdout), &m); err != nil {
-		t.Fatalf("pretty output is not valid JSON: %v", err)
+	// Without --stats or --verbose nothing is printed
+	cfg = Config{Format: "json", Quiet: true}
+	if _, stderr := runTest(t, cfg, input); stderr != "" {
+		t.Errorf("unexpected statistics: %q", stderr)
 	}
 }
 
-func TestIntegration_EmptyInput(t *testing.T) {
-	stdout, _ := runTest(t, Config{Quiet: true, OmitEmpty: true}, "")
+func TestIntegration_Mmap(t *testing.T) {
+	input := "a=1 b=2\r\n\nc=3 d=4\nlast=1 line=2"
+	path := filepath.Join(t.TempDir(), "input.log")
+	if err := os.WriteFile(path, []byte(input), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	run := func(mmap bool) (string, *runStats) {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = f.Close() }()
+		var out, errOut bytes.Buffer
+		cfg := Config{Format: "kv", Mmap: mmap, Stats: true, Quiet: true}
+		if err := runPipeline(cfg, f, &out, &errOut); err != nil {
+			t.Fatalf("runPipeline returned error: %v", err)
+		}
+		stats := &runStats{}
+		if err := json.Unmarshal(errOut.Bytes(), stats); err != nil {
+			t.Fatalf("expected a JSON summary, got %q: %v", errOut.String(), err)
+		}
+		return out.String(), stats
+	}
 
-	if strings.TrimSpace(stdout) != "" {
-		t.Errorf("expected empty output for empty input with omit-empty, got: %s", stdout)
+	want, wantStats := run(false)
+	got, stats := run(true)
+	if got != want {
+		t.Errorf("--mmap output = %q, want %q", got, want)
+	}
+	if stats.Lines != wantStats.Lines || stats.Bytes.In != int64(len(input)) {
+		t.Errorf("--mmap stats = %+v %+v, want %+v and %d bytes in", stats.Lines, stats.Bytes, wantStats.Lines, len(input))
 	}
 }
 
-// Ensure runPipeline writes nothing if input is empty and OmitEmpty is false
-func TestIntegration_EmptyInputNoOmit(t *testing.T) {
+func TestRunStats_ParsedWrappedEmptyLine(t *testing.T) {
+	stats := newRunStats()
+	stats.parsed(&parser.Entry{ParseError: fmt.Errorf("line 3: %w", parser.ErrEmptyLine)})
+	if stats.Lines.Empty != 1 || stats.Errors.Parse != 0 {
+		t.Errorf("stats = %+v %+v, want the wrapped empty line counted as empty", stats.Lines, stats.Errors)
+	}
+}
+
+func TestIntegration_StatsErrorBudget(t *testing.T) {
+	// The summary is written even when the error budget stops the run
 	var out, errOut bytes.Buffer
-	err := runPipeline(Config{Quiet: true}, strings.NewReader(""), &out, &errOut)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	cfg := Config{Format: "json", Stats: true, Quiet: true, FailFast: true}
+	err := runPipeline(cfg, strings.NewReader("{\"a\":1}\nnot json\n{\"a\":2}\n"), &out, &errOut)
+	if err == nil {
+		t.Fatal("expected --fail-fast error, got nil")
 	}
-	// No lines to process, so output should be empty
-	if out.Len() != 0 {
-		t.Errorf("expected empty output, got: %s", out.String())
+	var stats runStats
+	if err := json.Unmarshal(errOut.Bytes(), &stats); err != nil {
+		t.Fatalf("expected a JSON summary, got %q: %v", errOut.String(), err)
+	}
+	if stats.Lines.Read != 2 || stats.Errors.Parse != 1 {
+		t.Errorf("lines = %+v, errors = %+v, want 2 lines read and 1 parse error", stats.Lines, stats.Errors)
+	}
+}
+
+func TestStatsFlag(t *testing.T) {
+	tests := []struct {
+		args    []string
+		enabled bool
+		path    string
+	}{
+		{args: nil},
+		{args: []string{"--stats"}, enabled: true},
+		{args: []string{"--stats=run.json"}, enabled: true, path: "run.json"},
+		{args: []string{"--stats=run.json", "--stats=false"}},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			var enabled bool
+			var path string
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.Var(statsFlag{&enabled, &path}, "stats", "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if enabled != tt.enabled || path != tt.path {
+				t.Errorf("got %v %q, want %v %q", enabled, path, tt.enabled, tt.path)
+			}
+		})
+	}
+}
+
+func TestIntegration_ParserTuning(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   Config
+		input string
+		want  map[string]any
+	}{
+		{
+			name:  "kv separator",
+			cfg:   Config{KVSeparator: ":"},
+			input: "level:warn code:7",
+			want:  map[string]any{"level": "warn", "code": float64(7)},
+		},
+		{
+			name:  "kv single pair",
+			cfg:   Config{KVMinPairs: 1},
+			input: "status=ok",
+			want:  map[string]any{"status": "ok"},
+		},
+		{
+			name:  "apache vhost",
+			cfg:   Config{ApacheFormat: "vhost_combined"},
+			input: `example.com:80 10.0.0.1 - - [15/Jan/2024:10:30:45 +0000] "GET / HTTP/1.1" 200 512 "-" "curl/8.0"`,
+			want:  map[string]any{"vhost": "example.com", "port": float64(80), "status": float64(200)},
+		},
+		{
+			name:  "syslog message",
+			cfg:   Config{SyslogParseMessage: true},
+			input: "Jan 15 10:30:45 web1 app[12]: user=bob action=login",
+			want:  map[string]any{"host": "web1", "user": "bob", "action": "login"},
+		},
+		{
+			name:  "regex apache vhost",
+			cfg:   Config{ApacheFormat: "vhost_combined", RegexParsers: true},
+			input: `example.com:80 10.0.0.1 - - [15/Jan/2024:10:30:45 +0000] "GET / HTTP/1.1" 200 512 "-" "curl/8.0"`,
+			want:  map[string]any{"vhost": "example.com", "port": float64(80), "status": float64(200)},
+		},
+		{
+			name:  "regex syslog message",
+			cfg:   Config{SyslogParseMessage: true, RegexParsers: true},
+			input: "Jan 15 10:30:45 web1 app[12]: user=bob action=login",
+			want:  map[string]any{"host": "web1", "pid": float64(12), "user": "bob"},
+		},
+		{
+			name:  "json depth",
+			cfg:   Config{JSONMaxDepth: 1},
+			input: `{"a":{"b":1}}`,
+			want:  map[string]any{"a": `{"b":1}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Quiet = true
+			stdout, _ := runTest(t, tt.cfg, tt.input)
+			results := parseNDJSON(t, stdout)
+			if len(results) != 1 {
+				t.Fatalf("expected 1 line, got %d", len(results))
+			}
+			for k, v := range tt.want {
+				if results[0][k] != v {
+					t.Errorf("%s = %v, want %v (entry: %v)", k, results[0][k], v, results[0])
+				}
+			}
+		})
+	}
+}
+
+func TestIntegration_SampleDetection(t *testing.T) {
+	input := `{"banner":"app v1.2 starting"}
+level=info msg="listening" port=8080
+level=warn msg="slow request" ms=950
+level=info msg="shutting down" port=8080`
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantMsg any // msg of the second entry
+	}{
+		{name: "sample picks kv", cfg: Config{Verbose: true}, wantMsg: "listening"},
+		{name: "one-line sample locks to json", cfg: Config{DetectLines: 1, Quiet: true}, wantMsg: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr := runTest(t, tt.cfg, input)
+			results := parseNDJSON(t, stdout)
+			if len(results) != 4 {
+				t.Fatalf("got %d entries, want 4", len(results))
+			}
+			if results[1]["msg"] != tt.wantMsg {
+				t.Errorf("msg = %v, want %v", results[1]["msg"], tt.wantMsg)
+			}
+			if tt.cfg.Verbose && !strings.Contains(stderr, "detected format: kv") {
+				t.Errorf("stderr = %q, want detected format", stderr)
+			}
+		})
+	}
+}
+
+func TestSampleLines(t *testing.T) {
+	lines := make(chan reader.Line, 3)
+	lines <- reader.Line{Text: "a", Number: 1}
+	lines <- reader.Line{Text: "b", Number: 2}
+
+	// Fewer lines than asked for and no end of input: the wait ends it
+	if got := sampleLines(lines, 5, 20*time.Millisecond); len(got) != 2 {
+		t.Errorf("got %d lines, want 2", len(got))
+	}
+	lines <- reader.Line{Text: "c", Number: 3}
+	close(lines)
+	if got := sampleLines(lines, 5, time.Hour); len(got) != 1 || got[0].Text != "c" {
+		t.Errorf("got %v, want [c]", got)
+	}
+}
+
+func TestIntegration_FieldFiltering(t *testing.T) {
+	input := `Jan 15 10:30:45 myhost sshd[1234]: Accepted password`
+
+	cfg := Config{
+		Fields: []string{"host", "message"},
+		Quiet:  true,
+	}
+
+	stdout, _ := runTest(t, cfg, input)
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 1 {
+		t.Fatalf("expected 1 line, got %d", len(results))
+	}
+
+	r := results[0]
+	if r["host"] != "myhost" {
+		t.Errorf("expected host=myhost, got %v", r["host"])
+	}
+	if r["message"] != "Accepted password" {
+		t.Errorf("expected message=Accepted password, got %v", r["message"])
+	}
+	// Should NOT contain other fields
+	if _, ok := r["program"]; ok {
+		t.Error("expected program field to be filtered out")
+	}
+	if _, ok := r["pid"]; ok {
+		t.Error("expected pid field to be filtered out")
+	}
+}
+
+func TestIntegration_FieldPushdown(t *testing.T) {
+	input := `10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /a HTTP/1.0" 200 12
+10.0.0.2 - - [10/Oct/2000:13:55:37 -0700] "POST /b HTTP/1.0" 500 7
+`
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{
+			name: "parsers extract only the output fields",
+			cfg:  Config{Format: "apache", Fields: []string{"status", "path"}},
+			want: `{"path":"/a","status":200}` + "\n" + `{"path":"/b","status":500}` + "\n",
+		},
+		{
+			name: "transforms still see every field",
+			cfg:  Config{Format: "apache", Fields: []string{"status"}, Where: `method == "POST"`},
+			want: `{"status":500}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Quiet = true
+			if stdout, _ := runTest(t, tt.cfg, input); stdout != tt.want {
+				t.Errorf("got %q, want %q", stdout, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntegration_OmitEmpty(t *testing.T) {
+	input := "valid line\n\nanother valid line"
+
+	cfg := Config{
+		OmitEmpty: true,
+		Quiet:     true,
+	}
+
+	stdout, _ := runTest(t, cfg, input)
+	results := parseNDJSON(t, stdout)
+
+	// Empty line should be omitted (has ParseError=ErrEmptyLine)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 lines (empty omitted), got %d", len(results))
+	}
+}
+
+func TestIntegration_AddMetadata(t *testing.T) {
+	input := `Jan 15 10:30:45 myhost sshd[1234]: test message`
+
+	cfg := Config{
+		AddTimestamp:  true,
+		AddLineNumber: true,
+		AddRaw:        true,
+		Quiet:         true,
+	}
+
+	stdout, _ := runTest(t, cfg, input)
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 1 {
+		t.Fatalf("expected 1 line, got %d", len(results))
+	}
+
+	r := results[0]
+	if _, ok := r["_ingestTime"]; !ok {
+		t.Error("expected _ingestTime field")
+	}
+	if lineNum, ok := r["_lineNumber"].(float64); !ok || lineNum != 1 {
+		t.Errorf("expected _lineNumber=1, got %v", r["_lineNumber"])
+	}
+	if r["_raw"] != input {
+		t.Errorf("expected _raw to be original line, got %v", r["_raw"])
+	}
+}
+
+func TestIntegration_VerboseMode(t *testing.T) {
+	input := `Jan 15 10:30:45 myhost sshd[1234]: test`
+
+	cfg := Config{
+		Verbose: true,
+		Quiet:   true,
+	}
+
+	_, stderr := runTest(t, cfg, input)
+
+	if !strings.Contains(stderr, `"read": 1,`) {
+		t.Errorf("expected verbose summary in stderr, got: %s", stderr)
+	}
+}
+
+func TestIntegration_UnknownFormat(t *testing.T) {
+	var out, errOut bytes.Buffer
+	cfg := Config{Format: "bogus"}
+	err := runPipeline(cfg, strings.NewReader("test"), &out, &errOut)
+	if err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+	if !strings.Contains(err.Error(), "unknown format") {
+		t.Errorf("expected unknown format error, got: %v", err)
+	}
+}
+
+func TestIntegration_InvalidPattern(t *testing.T) {
+	var out, errOut bytes.Buffer
+	cfg := Config{Patterns: []string{"(?P<broken"}}
+	err := runPipeline(cfg, strings.NewReader("test"), &out, &errOut)
+	if err == nil {
+		t.Fatal("expected error for invalid pattern")
+	}
+	if !strings.Contains(err.Error(), "invalid pattern") {
+		t.Errorf("expected invalid pattern error, got: %v", err)
+	}
+}
+
+func TestIntegration_WithSampleFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		format   string
+		minLines int
+	}{
+		{"syslog_file", "../../testdata/sample_syslog.log", "syslog", 6},
+		{"apache_file", "../../testdata/sample_apache.log", "apache", 5},
+		{"json_file", "../../testdata/sample_json.log", "json", 5},
+		{"kv_file", "../../testdata/sample_kv.log", "kv", 5},
+		{"generic_file", "../../testdata/sample_generic.log", "", 6},
+		{"mixed_file", "../../testdata/sample_mixed.log", "", 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := os.ReadFile(tt.file)
+			if err != nil {
+				t.Skipf("sample file not found: %s", tt.file)
+			}
+
+			cfg := Config{Quiet: true}
+			if tt.format != "" {
+				cfg.Format = tt.format
+			}
+			if tt.name == "mixed_file" {
+				cfg.Adaptive = true
+			}
+
+			var out, errOut bytes.Buffer
+			err = runPipeline(cfg, bytes.NewReader(data), &out, &errOut)
+			if err != nil {
+				t.Fatalf("runPipeline error: %v", err)
+			}
+
+			results := parseNDJSON(t, out.String())
+			if len(results) < tt.minLines {
+				t.Errorf("expected at least %d lines, got %d", tt.minLines, len(results))
+			}
+
+			// Verify each line is valid JSON (already done by parseNDJSON)
+			for i, r := range results {
+				if len(r) == 0 {
+					t.Errorf("line %d has no fields", i+1)
+				}
+			}
+		})
+	}
+}
+
+func TestIntegration_PrettyOutput(t *testing.T) {
+	input := `{"level":"info","msg":"test"}`
+
+	cfg := Config{
+		Pretty: true,
+		Quiet:  true,
+	}
+
+	stdout, _ := runTest(t, cfg, input)
+
+	// Pretty output should contain indentation
+	if !strings.Contains(stdout, "  ") {
+		t.Error("expected indented output with --pretty")
+	}
+
+	// Should still be valid JSON
+	var m map[string]any
+	if err := json.Unmarshal([]byte(stdout), &m); err != nil {
+		t.Fatalf("pretty output is not valid JSON: %v", err)
+	}
+}
+
+func TestIntegration_EmptyInput(t *testing.T) {
+	stdout, _ := runTest(t, Config{Quiet: true, OmitEmpty: true}, "")
+
+	if strings.TrimSpace(stdout) != "" {
+		t.Errorf("expected empty output for empty input with omit-empty, got: %s", stdout)
+	}
+}
+
+// Ensure runPipeline writes nothing if input is empty and OmitEmpty is false
+func TestIntegration_EmptyInputNoOmit(t *testing.T) {
+	var out, errOut bytes.Buffer
+	err := runPipeline(Config{Quiet: true}, strings.NewReader(""), &out, &errOut)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// No lines to process, so output should be empty
+	if out.Len() != 0 {
+		t.Errorf("expected empty output, got: %s", out.String())
 	}
 }
 
 // Ensure Close is called even when no lines processed (via defer)
 func TestIntegration_CloseOnEmpty(t *testing.T) {
 	var out bytes.Buffer
-	err := runPipeline(Config{Quiet: true}, strings.NewReader(""), &out, io.Discard)
+	err := runPipeline(Config{Quiet: true}, strings.NewReader(""), &out, io.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestIntegration_ParseUnits(t *testing.T) {
+	input := `level=info latency=1.2s resp=3KiB cpu=15% path=/api`
+
+	cfg := Config{ParseUnits: true, Where: "latency_ms > 1000", Quiet: true}
+	stdout, _ := runTest(t, cfg, input)
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 1 {
+		t.Fatalf("expected 1 line, got %d", len(results))
+	}
+	r := results[0]
+	if r["latency"] != "1.2s" || r["latency_ms"] != float64(1200) {
+		t.Errorf("expected latency kept and latency_ms added, got %v", r)
+	}
+	if r["resp_bytes"] != float64(3072) || r["cpu_percent"] != float64(15) {
+		t.Errorf("expected resp_bytes and cpu_percent, got %v", r)
+	}
+	if _, ok := r["path_ms"]; ok {
+		t.Errorf("unexpected field from non-unit value: %v", r)
+	}
+}
+
+func TestIntegration_AnonymizeIP(t *testing.T) {
+	input := `{"ip":"203.0.113.77","peer":"2001:db8:abcd:12::1"}`
+
+	cfg := Config{AnonymizeIP: "ip,peer:16", Quiet: true}
+	stdout, _ := runTest(t, cfg, input)
+	results := parseNDJSON(t, stdout)
+
+	if results[0]["ip"] != "203.0.0.0" {
+		t.Errorf("expected ip truncated to /16, got %v", results[0]["ip"])
+	}
+	if results[0]["peer"] != "2001:db8:abcd::" {
+		t.Errorf("expected peer truncated to /48, got %v", results[0]["peer"])
+	}
+}
+
+func TestIntegration_InvalidAnonymizeIP(t *testing.T) {
+	var out, errOut bytes.Buffer
+	err := runPipeline(Config{AnonymizeIP: "ip:40"}, strings.NewReader("x"), &out, &errOut)
+	if err == nil || !strings.Contains(err.Error(), "--anonymize-ip") {
+		t.Errorf("expected --anonymize-ip error, got %v", err)
+	}
+}
+
+func TestIntegration_HashFields(t *testing.T) {
+	input := `user=alice ip=10.0.0.1 msg=login
+user=alice ip=10.0.0.2 msg=logout`
+
+	cfg := Config{HashFields: "user:sha256:pepper", Quiet: true}
+	stdout, _ := runTest(t, cfg, input)
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(results))
+	}
+	if results[0]["user"] == "alice" {
+		t.Error("expected user to be hashed")
+	}
+	if results[0]["user"] != results[1]["user"] {
+		t.Errorf("expected identical hashes for same user, got %v and %v", results[0]["user"], results[1]["user"])
+	}
+	if results[0]["ip"] != "10.0.0.1" {
+		t.Errorf("expected ip untouched, got %v", results[0]["ip"])
+	}
+}
+
+func TestIntegration_RedactionBeforeDerive(t *testing.T) {
+	cfg := Config{
+		HashFields:  "user:sha256:pepper",
+		AnonymizeIP: "ip",
+		Derives:     []string{"who={{.user}}@{{.ip}}"},
+		Quiet:       true,
+	}
+	stdout, _ := runTest(t, cfg, "user=alice ip=10.0.0.7 msg=login")
+	results := parseNDJSON(t, stdout)
+	if len(results) != 1 {
+		t.Fatalf("expected 1 line, got %d", len(results))
+	}
+	want := fmt.Sprintf("%v@10.0.0.0", results[0]["user"])
+	if results[0]["who"] != want {
+		t.Errorf("who = %v, want %q (from the redacted fields)", results[0]["who"], want)
+	}
+}
+
+func TestIntegration_HashFieldsSecretSalt(t *testing.T) {
+	t.Setenv("LOG2JSON_TEST_SALT", "pepper")
+	path := filepath.Join(t.TempDir(), "salt")
+	if err := os.WriteFile(path, []byte("pepper\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var want any
+	for _, spec := range []string{"user:sha256:pepper", "user:sha256:env:LOG2JSON_TEST_SALT", "user:sha256:file:" + path} {
+		stdout, _ := runTest(t, Config{HashFields: spec, Quiet: true}, "user=alice")
+		results := parseNDJSON(t, stdout)
+		if len(results) != 1 {
+			t.Fatalf("%s: expected 1 line, got %d", spec, len(results))
+		}
+		if want == nil {
+			want = results[0]["user"]
+		} else if results[0]["user"] != want {
+			t.Errorf("%s: user = %v, want %v (the literal salt's hash)", spec, results[0]["user"], want)
+		}
+	}
+
+	var out, errOut bytes.Buffer
+	err := runPipeline(Config{HashFields: "user:sha256:env:LOG2JSON_TEST_UNSET"}, strings.NewReader("user=alice"), &out, &errOut)
+	if err == nil || !strings.Contains(err.Error(), "LOG2JSON_TEST_UNSET is not set") {
+		t.Errorf("expected an unset salt variable error, got %v", err)
+	}
+}
+
+func TestIntegration_InvalidHashSpec(t *testing.T) {
+	var out, errOut bytes.Buffer
+	cfg := Config{HashFields: "user:md4"}
+	err := runPipeline(cfg, strings.NewReader("test"), &out, &errOut)
+	if err == nil || !strings.Contains(err.Error(), "--hash-fields") {
+		t.Errorf("expected --hash-fields error, got: %v", err)
+	}
+}
+
+func TestIntegration_ClassifyIP(t *testing.T) {
+	input := `192.168.1.1 - - [15/Jan/2024:10:30:45 +0000] "GET / HTTP/1.1" 200 10
+8.8.8.8 - - [15/Jan/2024:10:30:46 +0000] "GET / HTTP/1.1" 200 10`
+
+	cfg := Config{Format: "apache", ClassifyIP: []string{"ip"}, Quiet: true}
+	stdout, _ := runTest(t, cfg, input)
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(results))
+	}
+	if results[0]["ip_class"] != "private" {
+		t.Errorf("expected ip_class=private, got %v", results[0]["ip_class"])
+	}
+	if results[1]["ip_class"] != "public" {
+		t.Errorf("expected ip_class=public, got %v", results[1]["ip_class"])
+	}
+}
+
+func TestIntegration_AddHostMetadata(t *testing.T) {
+	t.Setenv("LOG2JSON_TEST_REGION", "us-east-1")
+
+	cfg := Config{AddEnv: []string{"LOG2JSON_TEST_REGION"}, Quiet: true}
+	stdout, _ := runTest(t, cfg, "INFO hello")
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 1 {
+		t.Fatalf("expected 1 line, got %d", len(results))
+	}
+	host, ok := results[0]["_host"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected _host block, got %v", results[0]["_host"])
+	}
+	if host["version"] != version {
+		t.Errorf("expected version=%s, got %v", version, host["version"])
+	}
+	if env, _ := host["env"].(map[string]any); env["LOG2JSON_TEST_REGION"] != "us-east-1" {
+		t.Errorf("expected region in _host.env, got %v", host["env"])
+	}
+}
+
+func TestIntegration_Where(t *testing.T) {
+	input := `192.168.1.1 - - [15/Jan/2024:10:30:45 +0000] "GET / HTTP/1.1" 200 10
+192.168.1.1 - - [15/Jan/2024:10:30:46 +0000] "POST /api HTTP/1.1" 503 10
+192.168.1.1 - - [15/Jan/2024:10:30:47 +0000] "GET /x HTTP/1.1" 500 10`
+
+	cfg := Config{Format: "apache", Where: `status >= 500 && method == "POST"`, Quiet: true}
+	stdout, _ := runTest(t, cfg, input)
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 1 {
+		t.Fatalf("expected 1 line, got %d", len(results))
+	}
+	if results[0]["path"] != "/api" {
+		t.Errorf("expected path=/api, got %v", results[0]["path"])
+	}
+}
+
+func TestIntegration_InvalidWhere(t *testing.T) {
+	var out, errOut bytes.Buffer
+	err := runPipeline(Config{Where: "status >="}, strings.NewReader("test"), &out, &errOut)
+	if err == nil || !strings.Contains(err.Error(), "--where") {
+		t.Errorf("expected --where error, got: %v", err)
+	}
+}
+
+func TestIntegration_Match(t *testing.T) {
+	input := `INFO GET /healthz
+ERROR GET /api failed
+INFO GET /api ok`
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want int
+	}{
+		{name: "match", cfg: Config{Match: `/api`, Quiet: true}, want: 2},
+		{name: "invert match", cfg: Config{Match: `healthz`, InvertMatch: true, Quiet: true}, want: 2},
+		{name: "no match", cfg: Config{Match: `nothing`, Quiet: true}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, _ := runTest(t, tt.cfg, input)
+			if got := len(parseNDJSON(t, stdout)); got != tt.want {
+				t.Errorf("expected %d lines, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestIntegration_Context(t *testing.T) {
+	input := `level=info msg=a
+level=info msg=b
+level=info msg=c
+level=error msg=d
+level=info msg=e
+level=info msg=f
+level=info msg=g
+level=info msg=h
+level=error msg=i`
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want string // messages kept, context ones in parentheses
+	}{
+		{name: "where", cfg: Config{Where: `level == "error"`, Context: 1}, want: "(c) d (e) (h) i"},
+		{name: "match", cfg: Config{Match: `level=error`, Context: 2}, want: "(b) (c) d (e) (f) (g) (h) i"},
+		{name: "invert match", cfg: Config{Match: `level=info`, InvertMatch: true, Context: 1}, want: "(c) d (e) (h) i"},
+		{name: "match and where", cfg: Config{Match: `level=error`, Where: `msg == "i"`, Context: 1}, want: "(h) i"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, _ := runTest(t, tt.cfg, input)
+			var got []string
+			for _, r := range parseNDJSON(t, stdout) {
+				if r["_context"] == true {
+					got = append(got, fmt.Sprintf("(%s)", r["msg"]))
+				} else {
+					got = append(got, fmt.Sprint(r["msg"]))
+				}
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("kept %q, want %q", strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+}
+
+func TestIntegration_MatchErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{name: "bad regex", cfg: Config{Match: "("}, want: "--match"},
+		{name: "invert without match", cfg: Config{InvertMatch: true}, want: "--invert-match"},
+		{name: "negative head", cfg: Config{Head: -1}, want: "--head"},
+		{name: "context without filter", cfg: Config{Context: 2}, want: "--context requires"},
+		{name: "negative context", cfg: Config{Context: -1, Where: "true"}, want: "--context"},
+		{name: "context bad regex", cfg: Config{Context: 1, Match: "("}, want: "--match"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, errOut bytes.Buffer
+			err := runPipeline(tt.cfg, strings.NewReader("test"), &out, &errOut)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected %s error, got: %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestIntegration_Head(t *testing.T) {
+	// The input never ends: --head must stop reading on its own
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	input := io.MultiReader(strings.NewReader("n=1 level=info\nn=2 level=debug\nn=3 level=info\nn=4 level=info\n"), pr)
+
+	cfg := Config{Format: "kv", Where: `level == "info"`, Head: 2, Stats: true}
+	var out, errOut bytes.Buffer
+	done := make(chan error, 1)
+	go func() { done <- runPipeline(cfg, input, &out, &errOut) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("runPipeline() error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("--head did not stop reading the input")
+	}
+
+	results := parseNDJSON(t, out.String())
+	if len(results) != 2 || results[0]["n"] != float64(1) || results[1]["n"] != float64(3) {
+		t.Errorf("entries = %v, want n=1 and n=3", results)
+	}
+	if !strings.Contains(errOut.String(), `"read": 3,`) {
+		t.Errorf("stats = %q, want 3 lines read", errOut.String())
+	}
+}
+
+func TestIntegration_MinLevel(t *testing.T) {
+	input := `2024-01-15 10:30:45 DEBUG starting
+2024-01-15 10:30:46 INFO ready
+2024-01-15 10:30:47 WARN slow request
+2024-01-15 10:30:48 ERROR failed`
+
+	stdout, _ := runTest(t, Config{MinLevel: "warn", Quiet: true}, input)
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(results))
+	}
+	if results[0]["level"] != "WARN" || results[1]["level"] != "ERROR" {
+		t.Errorf("expected WARN and ERROR, got %v and %v", results[0]["level"], results[1]["level"])
+	}
+}
+
+func TestIntegration_DedupConsecutive(t *testing.T) {
+	input := `Jan 15 10:30:45 host app[1]: disk full
+Jan 15 10:30:46 host app[1]: disk full
+Jan 15 10:30:47 host app[1]: disk full
+Jan 15 10:30:48 host app[1]: recovered`
+
+	stdout, _ := runTest(t, Config{DedupConsec: true, Quiet: true}, input)
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(results))
+	}
+	if count, ok := results[0]["_repeatCount"].(float64); !ok || count != 3 {
+		t.Errorf("expected _repeatCount=3, got %v", results[0]["_repeatCount"])
+	}
+	if _, ok := results[1]["_repeatCount"]; ok {
+		t.Error("expected no _repeatCount on single entry")
+	}
+}
+
+func TestIntegration_DedupWindow(t *testing.T) {
+	input := `level=info msg=a
+level=info msg=b
+level=info msg=a
+level=info msg=c
+level=info msg=d
+level=info msg=a`
+
+	stdout, _ := runTest(t, Config{DedupWindow: "2", Quiet: true}, input)
+	var got []string
+	for _, r := range parseNDJSON(t, stdout) {
+		got = append(got, r["msg"].(string))
+	}
+	if strings.Join(got, "") != "abcda" {
+		t.Errorf("got %v, want a b c d a", got)
+	}
+}
+
+func TestIntegration_ReorderWindow(t *testing.T) {
+	input := `{"time":"2024-01-15T10:30:02Z","msg":"b"}
+{"time":"2024-01-15T10:30:01Z","msg":"a"}
+{"time":"2024-01-15T10:30:04Z","msg":"d"}
+{"time":"2024-01-15T10:30:03Z","msg":"c"}
+{"time":"2024-01-15T10:30:09Z","msg":"e"}`
+
+	stdout, _ := runTest(t, Config{ReorderWindow: 5 * time.Second}, input)
+	var got []string
+	for _, r := range parseNDJSON(t, stdout) {
+		got = append(got, r["msg"].(string))
+	}
+	if strings.Join(got, "") != "abcde" {
+		t.Errorf("got %v, want a b c d e", got)
+	}
+}
+
+func TestIntegration_Merge(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"app.log": `{"time":"2024-01-15T10:30:01Z","msg":"start"}
+{"time":"2024-01-15T10:30:05Z","msg":"db down"}
+`,
+		"access.log": `10.0.0.1 - - [15/Jan/2024:10:30:02 +0000] "GET /a HTTP/1.1" 200 12 "-" "curl"
+10.0.0.1 - - [15/Jan/2024:10:30:06 +0000] "GET /b HTTP/1.1" 500 12 "-" "curl"
+`,
+		"kv.log": `ts=2024-01-15T10:30:03Z msg=slow
+no timestamp here
+ts=2024-01-15T10:30:04Z msg=slower
+`,
+	}
+	var paths []string
+	for _, name := range []string{"app.log", "access.log", "kv.log"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(files[name]), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	stdout, _ := runTest(t, Config{Merge: true, MergeFiles: paths, AddFormat: true, Quiet: true}, "")
+	results := parseNDJSON(t, stdout)
+	want := []struct{ source, format string }{
+		{"app.log", "json"},
+		{"access.log", "apache"},
+		{"kv.log", "kv"},
+		{"kv.log", "kv"}, // unparsed, it stays after the line before it
+		{"kv.log", "kv"},
+		{"app.log", "json"},
+		{"access.log", "apache"},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d entries, want %d:\n%s", len(results), len(want), stdout)
+	}
+	for i, w := range want {
+		if results[i]["_source"] != filepath.Join(dir, w.source) || results[i]["_format"] != w.format {
+			t.Errorf("entry %d from %v as %v, want %s as %s", i, results[i]["_source"], results[i]["_format"], w.source, w.format)
+		}
+	}
+}
+
+func TestIntegration_KubeNodeLogs(t *testing.T) {
+	defer func(d time.Duration) { tailInterval = d }(tailInterval)
+	tailInterval = 5 * time.Millisecond
+
+	dir := t.TempDir()
+	id := strings.Repeat("ab", 32)
+	web := filepath.Join(dir, "web-1_shop_nginx-"+id+".log")
+	appendLines := func(path string, lines ...string) {
+		t.Helper()
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		for _, line := range lines {
+			_, _ = f.WriteString(line + "\n")
+		}
+	}
+	appendLines(web, `2024-01-15T10:30:00Z stdout F {"msg":"before"}`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := &notifyWriter{written: make(chan struct{}, 1024)}
+	var errOut bytes.Buffer
+	done := make(chan error, 1)
+	cfg := Config{KubeNodeLogs: dir, Quiet: true}
+	go func() { done <- runPipelineContext(ctx, cfg, strings.NewReader(""), out, &errOut) }()
+	wait := func(what string, ping func()) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+			out.mu.Lock()
+			found := strings.Contains(out.buf.String(), what)
+			out.mu.Unlock()
+			if found {
+				return
+			}
+			ping()
+			select {
+			case <-out.written:
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+		t.Fatalf("no %s in the output", what)
+	}
+
+	// Once the logs already there are followed, a container starts
+	wait("ping", func() { appendLines(web, `2024-01-15T10:30:01Z stdout F {"msg":"ping"}`) })
+	api := filepath.Join(dir, "api-2_shop_app-"+strings.Repeat("cd", 32)+".log")
+	appendLines(api,
+		`2024-01-15T10:30:02.5Z stdout P {"level":"info",`,
+		`2024-01-15T10:30:03Z stderr F {"level":"error","msg":"oops"}`,
+		`2024-01-15T10:30:03Z stdout F "msg":"joined"}`,
+		`{"log":"not cri\n","stream":"stdout"}`,
+	)
+	wait("not cri", func() {})
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("runPipelineContext() error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runPipelineContext() did not return once cancelled")
+	}
+
+	var results []map[string]any
+	for _, e := range parseNDJSON(t, out.buf.String()) {
+		switch {
+		case e["msg"] == "before":
+			t.Errorf("a line written before following started was read: %v", e)
+		case e["msg"] == "ping":
+			if e["pod"] != "web-1" || e["container"] != "nginx" || e["container_id"] != id {
+				t.Errorf("ping entry = %v, want the web-1 pod's nginx container", e)
+			}
+		default:
+			results = append(results, e)
+		}
+	}
+	want := []map[string]any{
+		{"level": "error", "msg": "oops", "stream": "stderr", "time": "2024-01-15T10:30:03Z"},
+		{"level": "info", "msg": "joined", "stream": "stdout", "time": "2024-01-15T10:30:02.5Z"},
+		{"log": "not cri\n", "stream": "stdout"},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d entries, want %d:\n%s", len(results), len(want), out.buf.String())
+	}
+	for i, w := range want {
+		w["pod"], w["namespace"], w["container"] = "api-2", "shop", "app"
+		for k, v := range w {
+			if results[i][k] != v {
+				t.Errorf("entry %d %s = %v, want %v", i, k, results[i][k], v)
+			}
+		}
+	}
+}
+
+func TestIntegration_Follow(t *testing.T) {
+	defer func(d time.Duration) { tailInterval = d }(tailInterval)
+	tailInterval = 5 * time.Millisecond
+
+	dir := t.TempDir()
+	app := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(app, []byte("ts=2024-01-15T10:30:00Z level=info msg=started\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := &notifyWriter{written: make(chan struct{}, 1024)}
+	var errOut bytes.Buffer
+	done := make(chan error, 1)
+	cfg := Config{Follow: true, FollowFiles: []string{app, "-", filepath.Join(dir, "web-*.log")}, AddFormat: true, Stats: true, Quiet: true}
+	stdin := `{"level":"warn","msg":"from stdin"}` + "\n"
+	go func() { done <- runPipelineContext(ctx, cfg, strings.NewReader(stdin), out, &errOut) }()
+	wait := func(what string) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+			out.mu.Lock()
+			found := strings.Contains(out.buf.String(), what)
+			out.mu.Unlock()
+			if found {
+				return
+			}
+			select {
+			case <-out.written:
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+		t.Fatalf("no %s in the output", what)
+	}
+
+	// The file is read from its start and followed after stdin ends, and
+	// a file matching the pattern is picked up when it appears
+	wait("started")
+	wait("from stdin")
+	f, err := os.OpenFile(app, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString("ts=2024-01-15T10:30:05Z level=error msg=appended\n")
+	_ = f.Close()
+	wait("appended")
+	web := filepath.Join(dir, "web-1.log")
+	if err := os.WriteFile(web, []byte(`10.0.0.1 - - [15/Jan/2024:10:30:06 +0000] "GET / HTTP/1.1" 200 12 "-" "curl"`+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	wait("curl")
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("runPipelineContext() error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runPipelineContext() did not return once cancelled")
+	}
+
+	sources := map[string]string{}
+	for _, e := range parseNDJSON(t, out.buf.String()) {
+		sources[fmt.Sprint(e["msg"])] = fmt.Sprint(e["_source"], " ", e["_format"])
+	}
+	want := map[string]string{
+		"started":    app + " kv",
+		"from stdin": "stdin json",
+		"appended":   app + " kv",
+		"<nil>":      web + " apache", // no msg
+	}
+	if fmt.Sprint(sources) != fmt.Sprint(want) {
+		t.Errorf("sources = %v, want %v", sources, want)
+	}
+	if !strings.Contains(errOut.String(), `"read": 4`) {
+		t.Errorf("stats do not count the 4 lines of all inputs:\n%s", errOut.String())
+	}
+}
+
+func TestIntegration_SampleBy(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; i < 20; i++ {
+		sb.WriteString("path=/healthz status=200\n")
+	}
+	sb.WriteString("path=/login status=401\n")
+
+	stdout, _ := runTest(t, Config{SampleBy: "path:1/5", Quiet: true}, sb.String())
+	results := parseNDJSON(t, stdout)
+
+	// 5 warm-up + 3 sampled (counts 10, 15, 20) + 1 rare
+	if len(results) != 9 {
+		t.Fatalf("expected 9 lines, got %d", len(results))
+	}
+	if results[len(results)-1]["path"] != "/login" {
+		t.Errorf("expected rare path to be kept, got %v", results[len(results)-1]["path"])
+	}
+}
+
+func TestIntegration_RateLimitBy(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; i < 10; i++ {
+		sb.WriteString("Jan 15 10:30:45 host noisy[1]: spam\n")
+	}
+	sb.WriteString("Jan 15 10:30:45 host quiet[2]: hello\n")
+
+	stdout, _ := runTest(t, Config{RateLimitBy: "program:3/h", Quiet: true}, sb.String())
+	results := parseNDJSON(t, stdout)
+
+	// 3 noisy + 1 quiet + 1 summary at end of input
+	if len(results) != 5 {
+		t.Fatalf("expected 5 lines, got %d", len(results))
+	}
+	summary := results[len(results)-1]
+	if dropped, ok := summary["_dropped"].(float64); !ok || dropped != 7 {
+		t.Errorf("expected _dropped=7, got %v", summary["_dropped"])
+	}
+	if summary["program"] != "noisy" {
+		t.Errorf("expected summary for program=noisy, got %v", summary["program"])
+	}
+}
+
+func TestIntegration_MaxFieldBytes(t *testing.T) {
+	input := `{"message":"` + strings.Repeat("x", 100) + `","a":1,"b":2,"c":3}`
+
+	stdout, _ := runTest(t, Config{MaxFieldBytes: 10, MaxFields: 3, Quiet: true}, input)
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 1 {
+		t.Fatalf("expected 1 line, got %d", len(results))
+	}
+	r := results[0]
+	// Keys in order: a, b, c, message -> message is omitted by --max-fields
+	if _, ok := r["message"]; ok {
+		t.Errorf("expected message to be omitted, got %v", r["message"])
+	}
+	if omitted, ok := r["_omittedFields"].(float64); !ok || omitted != 1 {
+		t.Errorf("expected _omittedFields=1, got %v", r["_omittedFields"])
+	}
+}
+
+func TestIntegration_Types(t *testing.T) {
+	input := `Jan 15 10:30:45 host app[1234]: zip=02134 ok`
+
+	cfg := Config{Format: "syslog", Types: "pid:string", Quiet: true}
+	stdout, _ := runTest(t, cfg, input)
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 1 {
+		t.Fatalf("expected 1 line, got %d", len(results))
+	}
+	if results[0]["pid"] != "1234" {
+		t.Errorf("expected pid as string \"1234\", got %v (%T)", results[0]["pid"], results[0]["pid"])
+	}
+}
+
+func TestIntegration_InvalidTypes(t *testing.T) {
+	var out, errOut bytes.Buffer
+	err := runPipeline(Config{Types: "pid:decimal"}, strings.NewReader("test"), &out, &errOut)
+	if err == nil || !strings.Contains(err.Error(), "--types") {
+		t.Errorf("expected --types error, got: %v", err)
+	}
+}
+
+func TestIntegration_NoInferTypes(t *testing.T) {
+	input := `zip=02134 version=1.10 count=5`
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want map[string]any
+	}{
+		{
+			name: "all fields",
+			cfg:  Config{NoInferTypes: true, Quiet: true},
+			want: map[string]any{"zip": "02134", "version": "1.10", "count": "5"},
+		},
+		{
+			name: "selected fields",
+			cfg:  Config{NoInferFields: []string{"zip"}, Quiet: true},
+			want: map[string]any{"zip": "02134", "version": 1.1, "count": float64(5)},
+		},
+		{
+			name: "string type rule keeps lexical form",
+			cfg:  Config{Types: "version:string", Quiet: true},
+			want: map[string]any{"zip": float64(2134), "version": "1.10", "count": float64(5)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, _ := runTest(t, tt.cfg, input)
+			results := parseNDJSON(t, stdout)
+			if len(results) != 1 {
+				t.Fatalf("expected 1 line, got %d", len(results))
+			}
+			for k, want := range tt.want {
+				if got := results[0][k]; got != want {
+					t.Errorf("%s = %v (%T), want %v (%T)", k, got, got, want, want)
+				}
+			}
+		})
+	}
+}
+
+func TestListOrAllFlag(t *testing.T) {
+	var all bool
+	var items []string
+	f := listOrAllFlag{&all, &items}
+
+	if err := f.Set("true"); err != nil || !all {
+		t.Fatalf("Set(true): all=%v err=%v", all, err)
+	}
+	if f.String() != "true" {
+		t.Errorf("String() = %q, want true", f.String())
+	}
+	if err := f.Set("false"); err != nil || all {
+		t.Fatalf("Set(false): all=%v err=%v", all, err)
+	}
+	if err := f.Set("zip, version"); err != nil {
+		t.Fatalf("Set(list) error: %v", err)
+	}
+	if len(items) != 2 || items[0] != "zip" || items[1] != "version" {
+		t.Errorf("items = %v, want [zip version]", items)
+	}
+	if f.String() != "zip,version" {
+		t.Errorf("String() = %q, want zip,version", f.String())
+	}
+	if !f.IsBoolFlag() {
+		t.Error("IsBoolFlag() = false, want true")
+	}
+}
+
+func TestColorFlag(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "true", want: "auto"},
+		{in: "false", want: "never"},
+		{in: "always", want: "always"},
+		{in: "auto", want: "auto"},
+		{in: "yes", wantErr: true},
+	}
+	for _, tt := range tests {
+		var c colorFlag
+		err := c.Set(tt.in)
+		if (err != nil) != tt.wantErr || string(c) != tt.want {
+			t.Errorf("Set(%q) = %q, %v; want %q", tt.in, c, err, tt.want)
+		}
+	}
+}
+
+func TestExplainFlag(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "true", want: "stderr"},
+		{in: "stderr", want: "stderr"},
+		{in: "field", want: "field"},
+		{in: "false", want: ""},
+		{in: "stdout", wantErr: true},
+	}
+	for _, tt := range tests {
+		var e explainFlag
+		err := e.Set(tt.in)
+		if (err != nil) != tt.wantErr || string(e) != tt.want {
+			t.Errorf("Set(%q) = %q, %v; want %q", tt.in, e, err, tt.want)
+		}
+	}
+}
+
+func TestIntegration_Schema(t *testing.T) {
+	dir := t.TempDir()
+	schemaPath := dir + "/schema.json"
+	errPath := dir + "/rejects.ndjson"
+	if err := os.WriteFile(schemaPath, []byte(`{"status":"int","path":"string"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	input := `status=200 path=/ok
+status=oops path=/bad
+path=/missing`
+
+	cfg := Config{Schema: schemaPath, SchemaErrors: errPath, NoInferTypes: true, Quiet: true}
+	stdout, _ := runTest(t, cfg, input)
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 1 {
+		t.Fatalf("expected 1 valid line, got %d", len(results))
+	}
+	// Coerced to int despite --no-infer-types
+	if status, ok := results[0]["status"].(float64); !ok || status != 200 {
+		t.Errorf("expected status=200 as number, got %v", results[0]["status"])
+	}
+
+	data, err := os.ReadFile(errPath)
+	if err != nil {
+		t.Fatalf("reading rejects: %v", err)
+	}
+	rejects := parseNDJSON(t, string(data))
+	if len(rejects) != 2 {
+		t.Fatalf("expected 2 rejected lines, got %d", len(rejects))
+	}
+	if msg, _ := rejects[1]["_schemaError"].(string); !strings.Contains(msg, "missing required field") {
+		t.Errorf("expected missing field violation, got %v", rejects[1]["_schemaError"])
+	}
+	if ln, ok := rejects[0]["_lineNumber"].(float64); !ok || ln != 2 {
+		t.Errorf("expected _lineNumber=2 on rejected entry, got %v", rejects[0]["_lineNumber"])
+	}
+}
+
+func TestIntegration_SchemaToStderr(t *testing.T) {
+	schemaPath := t.TempDir() + "/schema.json"
+	if err := os.WriteFile(schemaPath, []byte(`{"status":"int"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr := runTest(t, Config{Schema: schemaPath, Quiet: true}, "a=1 b=2")
+	if strings.TrimSpace(stdout) != "" {
+		t.Errorf("expected no valid output, got %s", stdout)
+	}
+	if !strings.Contains(stderr, "_schemaError") {
+		t.Errorf("expected rejected entry on stderr, got %s", stderr)
+	}
+}
+
+func TestIntegration_Lookup(t *testing.T) {
+	table := t.TempDir() + "/status.csv"
+	if err := os.WriteFile(table, []byte("status,status_text\n404,Not Found\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	input := `192.168.1.1 - - [15/Jan/2024:10:30:45 +0000] "GET /x HTTP/1.1" 404 10`
+
+	cfg := Config{Format: "apache", Lookups: []string{"status=" + table}, Quiet: true}
+	stdout, _ := runTest(t, cfg, input)
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 1 {
+		t.Fatalf("expected 1 line, got %d", len(results))
+	}
+	if results[0]["status_text"] != "Not Found" {
+		t.Errorf("expected status_text=Not Found, got %v", results[0]["status_text"])
+	}
+}
+
+func TestIntegration_SplitField(t *testing.T) {
+	input := `user=alice tags=a,b,c xff="10.0.0.1, 10.0.0.2"`
+
+	cfg := Config{SplitFields: []string{"tags:,", "xff"}, Quiet: true}
+	stdout, _ := runTest(t, cfg, input)
+	results := parseNDJSON(t, stdout)
+
+	tags, ok := results[0]["tags"].([]any)
+	if !ok || len(tags) != 3 || tags[2] != "c" {
+		t.Errorf("expected tags array, got %v", results[0]["tags"])
+	}
+	xff, ok := results[0]["xff"].([]any)
+	if !ok || len(xff) != 2 || xff[1] != "10.0.0.2" {
+		t.Errorf("expected xff array, got %v", results[0]["xff"])
+	}
+}
+
+func TestIntegration_Explode(t *testing.T) {
+	input := `{"batch":7,"records":[{"user":"alice","action":"login"},{"user":"bob","action":"delete"}]}`
+
+	cfg := Config{Explode: "records", Where: `action == "delete"`, Quiet: true}
+	stdout, _ := runTest(t, cfg, input)
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 1 {
+		t.Fatalf("expected 1 line, got %d", len(results))
+	}
+	if results[0]["user"] != "bob" || results[0]["batch"] != float64(7) {
+		t.Errorf("expected bob's record with the parent batch, got %v", results[0])
+	}
+	if _, ok := results[0]["records"]; ok {
+		t.Errorf("exploded field should be removed, got %v", results[0])
+	}
+}
+
+func TestIntegration_Derive(t *testing.T) {
+	input := `{"method":"GET","path":"/api","status":503}
+{"method":"POST","path":"/login"}`
+
+	cfg := Config{
+		Derives: []string{
+			"summary={{.method}} {{.path}} -> {{.status}}",
+			"alert=ALERT: {{.summary}}",
+		},
+		Where: "summary != null",
+		Quiet: true,
+	}
+	stdout, _ := runTest(t, cfg, input)
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 1 {
+		t.Fatalf("expected 1 line, got %d", len(results))
+	}
+	if results[0]["alert"] != "ALERT: GET /api -> 503" {
+		t.Errorf("expected derived alert text, got %v", results[0])
+	}
+}
+
+func TestIntegration_InvalidDerive(t *testing.T) {
+	var out, errOut bytes.Buffer
+	err := runPipeline(Config{Derives: []string{"summary"}}, strings.NewReader("x"), &out, &errOut)
+	if err == nil || !strings.Contains(err.Error(), "--derive") {
+		t.Errorf("expected --derive error, got %v", err)
+	}
+}
+
+func TestIntegration_Correlate(t *testing.T) {
+	input := `request_id=r1 msg=start
+request_id=r2 msg=start
+request_id=r1 msg=end`
+
+	cfg := Config{Correlate: "request_id", CorrelateIdle: time.Minute, CorrelateSummary: true, Quiet: true}
+	stdout, _ := runTest(t, cfg, input)
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 5 {
+		t.Fatalf("expected 3 records and 2 summaries, got %d", len(results))
+	}
+	if results[2]["msg"] != "end" || results[2]["_seq"] != float64(2) {
+		t.Errorf("expected r1's second record, got %v", results[2])
+	}
+	if results[3]["request_id"] != "r1" || results[3]["_count"] != float64(2) {
+		t.Errorf("expected r1 summary at end of input, got %v", results[3])
+	}
+}
+
+func TestIntegration_MineTemplates(t *testing.T) {
+	input := `Connected to 10.0.0.1 port 22
+Disk almost full
+Connected to 10.0.0.2 port 2222`
+
+	cfg := Config{MineTemplates: "message", MineSimilarity: 0.4, Where: "_templateId == 1", Quiet: true}
+	stdout, _ := runTest(t, cfg, input)
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(results))
+	}
+	if results[1]["_template"] != "Connected to <*> port <*>" {
+		t.Errorf("expected a generalized template, got %v", results[1])
+	}
+}
+
+func TestIntegration_InvalidMineSimilarity(t *testing.T) {
+	var out, errOut bytes.Buffer
+	err := runPipeline(Config{MineTemplates: "message", MineSimilarity: 2}, strings.NewReader("x"), &out, &errOut)
+	if err == nil || !strings.Contains(err.Error(), "--mine-similarity") {
+		t.Errorf("expected --mine-similarity error, got %v", err)
+	}
+}
+
+func TestIntegration_Histogram(t *testing.T) {
+	input := `time=2024-01-15T10:00:01Z path=/a duration=120
+time=2024-01-15T10:00:20Z path=/b duration=80
+time=2024-01-15T10:00:40Z path=/a duration=oops
+time=2024-01-15T10:01:05Z path=/a duration=300`
+
+	cfg := Config{Histogram: "duration", Percentiles: "50,99", Window: time.Minute, Where: `path != "/b"`, Quiet: true}
+	stdout, _ := runTest(t, cfg, input)
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 2 {
+		t.Fatalf("expected a record per window, got %d: %s", len(results), stdout)
+	}
+	first := results[0]
+	if first["window_start"] != "2024-01-15T10:00:00Z" || first["count"] != float64(1) || first["p99"] != float64(120) {
+		t.Errorf("expected the first minute without filtered-out entries, got %v", first)
+	}
+	if results[1]["window_start"] != "2024-01-15T10:01:00Z" || results[1]["max"] != float64(300) {
+		t.Errorf("expected the second minute, got %v", results[1])
+	}
+}
+
+func TestIntegration_InvalidHistogram(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{name: "bad percentile", cfg: Config{Histogram: "duration", Percentiles: "101"}, want: "invalid --histogram"},
+		{name: "percentiles without histogram", cfg: Config{Percentiles: "50"}, want: "--percentiles requires --histogram"},
+		{name: "window without histogram", cfg: Config{Window: time.Second}, want: "--window requires"},
+		{name: "negative window", cfg: Config{Histogram: "duration", Window: -time.Second}, want: "invalid --window"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, errOut bytes.Buffer
+			err := runPipeline(tt.cfg, strings.NewReader("x"), &out, &errOut)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected %q error, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestIntegration_Query(t *testing.T) {
+	input := `{"path":"/a","status":500,"duration":120}
+{"path":"/b","status":200,"duration":15}
+{"path":"/a","status":503,"duration":80}
+{"path":"/c","status":502,"duration":40}
+{"path":"/c","status":500}`
+
+	cfg := Config{Query: "SELECT path, count(*) AS errors, avg(duration) FROM stream WHERE status >= 500 GROUP BY path ORDER BY errors DESC, path", Quiet: true}
+	stdout, _ := runTest(t, cfg, input)
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 2 {
+		t.Fatalf("expected a row per failing path, got %d: %s", len(results), stdout)
+	}
+	if results[0]["path"] != "/a" || results[0]["errors"] != float64(2) || results[0]["avg(duration)"] != float64(100) {
+		t.Errorf("unexpected first row: %v", results[0])
+	}
+	if results[1]["path"] != "/c" || results[1]["avg(duration)"] != float64(40) {
+		t.Errorf("unexpected second row: %v", results[1])
+	}
+	// Columns are written in SELECT order
+	if want := `{"path":"/a","errors":2,"avg(duration)":100}`; !strings.HasPrefix(stdout, want+"\n") {
+		t.Errorf("expected %s first, got %s", want, stdout)
+	}
+
+	cfg = Config{Query: "SELECT path, status FROM stream WHERE path LIKE '/c%' LIMIT 1", Quiet: true}
+	stdout, _ = runTest(t, cfg, input)
+	if stdout != `{"path":"/c","status":502}`+"\n" {
+		t.Errorf("unexpected rows: %s", stdout)
+	}
+}
+
+func TestIntegration_InvalidQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{name: "syntax", cfg: Config{Query: "SELECT path FROM stream WHERE"}, want: "invalid --query"},
+		{name: "with histogram", cfg: Config{Query: "SELECT * FROM stream", Histogram: "duration"}, want: "--histogram cannot be combined with --query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, errOut bytes.Buffer
+			err := runPipeline(tt.cfg, strings.NewReader("x"), &out, &errOut)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected %q error, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestIntegration_Script(t *testing.T) {
+	path := t.TempDir() + "/transform.star"
+	src := `
+def transform(entry):
+    if entry["level"] == "DEBUG":
+        return None
+    entry["severe"] = entry["level"] in ("ERROR", "FATAL")
+    print("saw", entry["level"])
+    return entry
+`
+	if err := os.WriteFile(path, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	input := `2024-01-15 10:30:45 DEBUG noise
+2024-01-15 10:30:46 ERROR failed
+2024-01-15 10:30:47 INFO ready`
+
+	cfg := Config{Script: path, Where: "severe == true", Quiet: true}
+	stdout, stderr := runTest(t, cfg, input)
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 1 {
+		t.Fatalf("expected 1 line, got %d", len(results))
+	}
+	if results[0]["level"] != "ERROR" {
+		t.Errorf("expected the ERROR line, got %v", results[0])
+	}
+	if stderr != "saw ERROR\nsaw INFO\n" {
+		t.Errorf("expected print output on stderr, got %q", stderr)
+	}
+}
+
+func TestIntegration_InvalidScript(t *testing.T) {
+	path := t.TempDir() + "/bad.star"
+	if err := os.WriteFile(path, []byte("def other(entry):\n    return entry\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out, errOut bytes.Buffer
+	err := runPipeline(Config{Script: path}, strings.NewReader("x"), &out, &errOut)
+	if err == nil || !strings.Contains(err.Error(), "--script") {
+		t.Errorf("expected --script error, got %v", err)
+	}
+}
+
+// echoPlugin is a WebAssembly plugin (assembled by internal/wasm's test
+// helpers) whose transform logs and returns its input, and whose parse
+// returns lines starting with '{' as-is.
+const echoPlugin = "0061736d0100000001110360017f017f60027f7f017e60027f7f00020b0103656e76036c6f67000203040300010105030100010607017f014180080b072604066d656d6f7279020005616c6c6f630001097472616e73666f726d000205706172736500030a3c030b002300230020006a24000b12002000200110002000ad4220862001ad840b1b0020002d000041fb0047044042000f0b2000ad4220862001ad840b0b06010041000b00"
+
+func writeEchoPlugin(t *testing.T) string {
+	t.Helper()
+	data, err := hex.DecodeString(echoPlugin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := t.TempDir() + "/objects.wasm"
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestIntegration_WasmPlugin(t *testing.T) {
+	path := writeEchoPlugin(t)
+	input := `{"level":"info","msg":"ready"}
+not an object`
+
+	stdout, stderr := runTest(t, Config{WasmPlugin: path, Quiet: true}, input)
+	results := parseNDJSON(t, stdout)
+
+	if len(results) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(results))
+	}
+	if results[0]["msg"] != "ready" || results[0]["_parseError"] != nil {
+		t.Errorf("expected the plugin to parse line 1, got %v", results[0])
+	}
+	if results[1]["raw"] != "not an object" || results[1]["_parseError"] == nil {
+		t.Errorf("expected line 2 to be unmatched, got %v", results[1])
+	}
+	if got := strings.Count(stderr, "\n"); got != 2 {
+		t.Errorf("expected the transform to log 2 lines, got %q", stderr)
+	}
+
+	// An explicit format overrides the plugin parser; the transform still runs.
+	stdout, _ = runTest(t, Config{WasmPlugin: path, Format: "kv", Quiet: true}, "a=1 b=two")
+	results = parseNDJSON(t, stdout)
+	if len(results) != 1 || results[0]["b"] != "two" {
+		t.Errorf("expected kv output, got %v", results)
+	}
+
+	// The plugin parser can also be selected by name.
+	stdout, _ = runTest(t, Config{WasmPlugin: path, Format: "objects", Quiet: true}, `{"x":1}`)
+	if results = parseNDJSON(t, stdout); len(results) != 1 || results[0]["x"] != float64(1) {
+		t.Errorf("expected plugin output, got %v", results)
+	}
+}
+
+func TestIntegration_InvalidWasmPlugin(t *testing.T) {
+	path := t.TempDir() + "/bad.wasm"
+	if err := os.WriteFile(path, []byte("not wasm"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out, errOut bytes.Buffer
+	err := runPipeline(Config{WasmPlugin: path}, strings.NewReader("x"), &out, &errOut)
+	if err == nil || !strings.Contains(err.Error(), "--wasm-plugin") {
+		t.Errorf("expected --wasm-plugin error, got %v", err)
+	}
+}
+
+func TestIntegration_InvalidPlugin(t *testing.T) {
+	var out, errOut bytes.Buffer
+	cfg := Config{Plugins: []string{t.TempDir() + "/missing.so"}}
+	err := runPipeline(cfg, strings.NewReader("x"), &out, &errOut)
+	if err == nil || !strings.Contains(err.Error(), "--plugin") {
+		t.Errorf("expected --plugin error, got %v", err)
+	}
+}
+
+func TestIntegration_Route(t *testing.T) {
+	errPath := t.TempDir() + "/errors.ndjson"
+	input := `2024-01-15 10:30:45 INFO ready
+2024-01-15 10:30:46 ERROR failed
+2024-01-15 10:30:47 WARN slow`
+
+	cfg := Config{
+		Routes: []string{`level == "ERROR" => ` + errPath, `default => stdout`},
+		Quiet:  true,
+	}
+	stdout, _ := runTest(t, cfg, input)
+
+	if got := len(parseNDJSON(t, stdout)); got != 2 {
+		t.Errorf("expected 2 lines on stdout, got %d", got)
+	}
+
+	data, err := os.ReadFile(errPath)
+	if err != nil {
+		t.Fatalf("reading route file: %v", err)
+	}
+	routed := parseNDJSON(t, string(data))
+	if len(routed) != 1 || routed[0]["level"] != "ERROR" {
+		t.Errorf("expected 1 ERROR line in route file, got %v", routed)
+	}
+}
+
+func TestIntegration_Alert(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "notify.sh")
+	alerts := filepath.Join(dir, "alerts")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\ncat >> "+alerts+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	input := `2024-01-15 10:30:45 INFO ready
+2024-01-15 10:30:46 ERROR failed
+2024-01-15 10:30:47 ERROR failed again
+2024-01-15 10:30:48 ERROR failed once more`
+
+	cfg := Config{
+		Alerts:    []string{`level == "ERROR" => ` + script},
+		AlertRate: "1/h",
+		Fields:    []string{"level", "message"},
+	}
+	stdout, stderr := runTest(t, cfg, input)
+	if got := len(parseNDJSON(t, stdout)); got != 4 {
+		t.Errorf("expected 4 entries on stdout, got %d", got)
+	}
+
+	// The command ran once, with the entry as it is written
+	data, err := os.ReadFile(alerts)
+	if err != nil {
+		t.Fatalf("reading alerts: %v", err)
+	}
+	if want := `{"level":"ERROR","message":"failed"}` + "\n"; string(data) != want {
+		t.Errorf("command got %q, want %q", data, want)
+	}
+	if !strings.Contains(stderr, "2 matches skipped") {
+		t.Errorf("skipped matches were not reported: %q", stderr)
+	}
+}
+
+func TestIntegration_NotifyWebhook(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	input := `level=info msg=ready
+level=fatal msg="disk full" host=web1
+level=fatal msg="out of memory" host=web2`
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want []string
+	}{
+		{
+			name: "entries",
+			cfg:  Config{NotifyWebhook: srv.URL, NotifyWhen: `level == "fatal"`, Fields: []string{"msg"}},
+			want: []string{`{"msg":"disk full"}`, `{"msg":"out of memory"}`},
+		},
+		{
+			name: "template",
+			cfg:  Config{NotifyWebhook: srv.URL, NotifyWhen: `host == "web2"`, NotifyTemplate: `{"text": {{json .msg}}}`},
+			want: []string{`{"text": "out of memory"}`},
+		},
+		{
+			name: "digest template",
+			cfg:  Config{NotifyWebhook: srv.URL, NotifyWhen: `level == "fatal"`, NotifyDigest: time.Hour, NotifyTemplate: `{{.count}}:{{range .entries}} {{.host}}{{end}}`},
+			want: []string{`2: web1 web2`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bodies = nil
+			stdout, _ := runTest(t, tt.cfg, input)
+			if got := len(parseNDJSON(t, stdout)); got != 3 {
+				t.Errorf("expected 3 entries on stdout, got %d", got)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if !reflect.DeepEqual(bodies, tt.want) {
+				t.Errorf("webhook got %q, want %q", bodies, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntegration_OutputFile(t *testing.T) {
+	path := t.TempDir() + "/out.ndjson"
+	cfg := Config{Outputs: []string{path}, Quiet: true}
+	stdout, _ := runTest(t, cfg, "level=info msg=one\nlevel=warn msg=two")
+	if stdout != "" {
+		t.Errorf("expected no stdout with --output, got %q", stdout)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading output file: %v", err)
+	}
+	if got := parseNDJSON(t, string(data)); len(got) != 2 || got[1]["msg"] != "two" {
+		t.Errorf("unexpected output file contents: %v", got)
+	}
+}
+
+func TestIntegration_OutputAppend(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/out.ndjson"
+	routed := dir + "/errors.ndjson"
+	for _, f := range []string{path, routed} {
+		if err := os.WriteFile(f, []byte("{\"msg\":\"earlier\"}\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := Config{
+		Outputs:      []string{path},
+		Routes:       []string{`level == "error" => ` + routed, `default => stdout`},
+		OutputAppend: true,
+		Quiet:        true,
+	}
+	runTest(t, cfg, "level=info msg=one\nlevel=error msg=two")
+
+	for file, want := range map[string]string{path: "one", routed: "two"} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("reading output file: %v", err)
+		}
+		got := parseNDJSON(t, string(data))
+		if len(got) != 2 || got[0]["msg"] != "earlier" || got[1]["msg"] != want {
+			t.Errorf("%s = %v, want the earlier entry then %s", file, got, want)
+		}
+	}
+}
+
+func TestIntegration_OutputAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/out.ndjson"
+	if err := os.WriteFile(path, []byte("{\"msg\":\"earlier\"}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{Outputs: []string{path}, OutputAtomic: true, Quiet: true}
+	runTest(t, cfg, "level=info msg=one\nlevel=warn msg=two")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading output file: %v", err)
+	}
+	if got := parseNDJSON(t, string(data)); len(got) != 2 || got[0]["msg"] != "one" {
+		t.Errorf("unexpected output file contents: %v", got)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected only the output file in %s, got %d files", dir, len(entries))
+	}
+}
+
+func TestIntegration_ErrorBudget(t *testing.T) {
+	input := "{\"n\":1}\nbad\n{\"n\":3}\nworse\n{\"n\":5}\n\n"
+
+	tests := []struct {
+		name      string
+		cfg       Config
+		wantLines int    // entries written
+		wantErr   string // "" for success
+		wantCode  int
+	}{
+		{name: "no policy", cfg: Config{}, wantLines: 6, wantCode: exitOK},
+		{name: "fail fast", cfg: Config{FailFast: true}, wantLines: 1, wantErr: "--fail-fast: stopped at line 2", wantCode: exitFailed},
+		{name: "max errors exceeded", cfg: Config{MaxErrors: 1}, wantLines: 3, wantErr: "--max-errors 1 exceeded: stopped at line 4", wantCode: exitFailed},
+		{name: "within max errors", cfg: Config{MaxErrors: 2}, wantLines: 6, wantErr: "2 of 6 lines failed", wantCode: exitLinesFailed},
+		{name: "within max error ratio", cfg: Config{MaxErrorRatio: 0.5}, wantLines: 6, wantErr: "2 of 6 lines failed", wantCode: exitLinesFailed},
+		{name: "max error ratio exceeded", cfg: Config{MaxErrorRatio: 0.25}, wantLines: 6, wantErr: "--max-error-ratio 0.25 exceeded: 2 of 6 lines failed (33.3%)", wantCode: exitFailed},
+		{name: "filtered lines do not count", cfg: Config{MaxErrorRatio: 0.25, Match: "n|bad"}, wantLines: 4, wantErr: "1 of 4 lines failed", wantCode: exitLinesFailed},
+		{name: "recent error ratio exceeded", cfg: Config{AbortOnErrorRatio: 0.3, ErrorRatioWindow: 3}, wantLines: 2, wantErr: "--abort-on-error-ratio 0.3 exceeded: 1 of the last 3 lines failed to parse, at line 3", wantCode: exitFailed},
+		{name: "within recent error ratio", cfg: Config{AbortOnErrorRatio: 0.5, ErrorRatioWindow: 2}, wantLines: 6, wantCode: exitOK},
+		{name: "recent error ratio passthrough", cfg: Config{AbortOnErrorRatio: 0.3, ErrorRatioWindow: 3, ErrorRatioPassthrough: true}, wantLines: 6, wantCode: exitOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Format = "json"
+			tt.cfg.Quiet = true
+			var out, errOut bytes.Buffer
+			err := runPipeline(tt.cfg, strings.NewReader(input), &out, &errOut)
+
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("runPipeline() error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("runPipeline() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if code := exitCode(err); code != tt.wantCode {
+				t.Errorf("exitCode() = %d, want %d", code, tt.wantCode)
+			}
+			if got := len(parseNDJSON(t, out.String())); got != tt.wantLines {
+				t.Errorf("wrote %d entries, want %d", got, tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestIntegration_ErrorRatioPassthrough(t *testing.T) {
+	input := "{\"n\":1}\nbad\nworse\n{\"n\":4}\n"
+	cfg := Config{Format: "json", AbortOnErrorRatio: 0.5, ErrorRatioWindow: 2, ErrorRatioPassthrough: true}
+	stdout, stderr := runTest(t, cfg, input)
+
+	results := parseNDJSON(t, stdout)
+	if len(results) != 4 {
+		t.Fatalf("expected 4 entries, got %d", len(results))
+	}
+	if _, ok := results[2]["_parseError"]; !ok {
+		t.Errorf("the line tripping the breaker was not parsed: %v", results[2])
+	}
+	if want := map[string]any{"raw": `{"n":4}`}; !reflect.DeepEqual(results[3], want) {
+		t.Errorf("line after the breaker tripped = %v, want %v", results[3], want)
+	}
+	if !strings.Contains(stderr, "2 of the last 2 lines failed to parse, at line 3; passing the remaining lines through raw") {
+		t.Errorf("the breaker tripping was not reported: %q", stderr)
+	}
+}
+
+func TestErrorBreaker_Window(t *testing.T) {
+	b, err := newErrorBreaker(Config{AbortOnErrorRatio: 0.5, ErrorRatioWindow: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Failures that leave the window stop counting
+	for i, failed := range []bool{true, true, false, false, false, true, false, true} {
+		if b.add(failed) {
+			t.Fatalf("tripped at line %d with %d of %d failed", i+1, b.failed, len(b.recent))
+		}
+	}
+	if !b.add(true) {
+		t.Errorf("did not trip with %d of the last %d lines failed", b.failed, len(b.recent))
+	}
+}
+
+// notifyWriter is a bytes.Buffer that signals each write.
+type notifyWriter struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	written chan struct{}
+}
+
+func (w *notifyWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	defer func() { w.written <- struct{}{} }()
+	return w.buf.Write(p)
+}
+
+func TestIntegration_Interrupted(t *testing.T) {
+	// Input that stays open, like a terminal or a pipe from a live process
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	out := &notifyWriter{written: make(chan struct{}, 16)}
+	var errOut bytes.Buffer
+	ctx, cancel := context.WithCancelCause(context.Background())
+	done := make(chan error)
+	cfg := Config{Format: "json", Stats: true, Quiet: true}
+	go func() { done <- runPipelineContext(ctx, cfg, pr, out, &errOut) }()
+
+	_, _ = pw.Write([]byte("{\"n\":1}\n"))
+	<-out.written
+	cancel(&interruptedError{sig: os.Interrupt})
+
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("runPipelineContext() did not return after the interrupt")
+	}
+	if err == nil || err.Error() != "interrupted by SIGINT" {
+		t.Fatalf("runPipelineContext() error = %v, want interrupted by SIGINT", err)
+	}
+	if code := exitCode(err); code != 130 {
+		t.Errorf("exitCode() = %d, want 130", code)
+	}
+	if got := len(parseNDJSON(t, out.buf.String())); got != 1 {
+		t.Errorf("wrote %d entries, want the line read before the interrupt", got)
+	}
+	var stats runStats
+	if err := json.Unmarshal(errOut.Bytes(), &stats); err != nil || stats.Lines.Read != 1 {
+		t.Errorf("stderr = %q, want the summary of the line read", errOut.String())
+	}
+}
+
+func TestExitCode_Signals(t *testing.T) {
+	tests := []struct {
+		sig  os.Signal
+		want int
+	}{
+		{sig: os.Interrupt, want: 130},
+		{sig: syscall.SIGTERM, want: 143},
+	}
+	for _, tt := range tests {
+		err := fmt.Errorf("run: %w", &interruptedError{sig: tt.sig})
+		if got := exitCode(err); got != tt.want {
+			t.Errorf("exitCode(%v) = %d, want %d", tt.sig, got, tt.want)
+		}
+	}
+}
+
+func TestIntegration_HealthListen(t *testing.T) {
+	// Find a free port for the health server
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	out := &notifyWriter{written: make(chan struct{}, 16)}
+	var errOut bytes.Buffer
+	done := make(chan error, 1)
+	cfg := Config{Format: "json", HealthListen: addr, Quiet: true}
+	go func() { done <- runPipeline(cfg, pr, out, &errOut) }()
+
+	_, _ = pw.Write([]byte("{\"n\":1}\n"))
+	<-out.written
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	for _, path := range []string{"/healthz", "/readyz"} {
+		if code, body := get(path); code != http.StatusOK {
+			t.Errorf("GET %s = %d %q, want 200", path, code, body)
+		}
+	}
+	code, body := get("/stats")
+	var stats runStats
+	if err := json.Unmarshal([]byte(body), &stats); code != http.StatusOK || err != nil || stats.Lines.Read != 1 {
+		t.Errorf("GET /stats = %d %q, want the summary of the line read", code, body)
+	}
+
+	_ = pw.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("runPipeline() error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runPipeline() did not return at the end of input")
+	}
+	if resp, err := http.Get("http://" + addr + "/healthz"); err == nil {
+		_ = resp.Body.Close()
+		t.Error("health server still listening after the run")
+	}
+}
+
+func TestIntegration_ForwardListen(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var out, errOut bytes.Buffer
+	done := make(chan error, 1)
+	cfg := Config{Format: "json", ForwardListen: addr, Quiet: true}
+	go func() { done <- runPipelineContext(ctx, cfg, strings.NewReader(""), &out, &errOut) }()
+
+	var conn net.Conn
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if conn, err = net.Dial("tcp", addr); err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("dial --forward-listen: %v", err)
+	}
+	defer conn.Close()
+
+	ts := time.Unix(1700000000, 0).UTC()
+	msg := forward.AppendValue(nil, []any{"app.web", []any{
+		[]any{ts, map[string]any{"log": `{"level":"info","msg":"started","stream":"app"}`, "stream": "stdout"}},
+		[]any{ts, map[string]any{"level": "warn", "msg": "no message key"}},
+	}, map[string]any{"chunk": "c1"}})
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	want := forward.AppendValue(nil, map[string]any{"ack": "c1"})
+	ack := make([]byte, len(want))
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(conn, ack); err != nil || !bytes.Equal(ack, want) {
+		t.Fatalf("ack = %x, %v; want %x", ack, err, want)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("runPipelineContext() error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runPipelineContext() did not return once cancelled")
+	}
+
+	entries := parseNDJSON(t, out.String())
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2: %s", len(entries), out.String())
+	}
+	for k, v := range map[string]any{"level": "info", "msg": "started", "stream": "app", "tag": "app.web", "time": "2023-11-14T22:13:20Z"} {
+		if entries[0][k] != v {
+			t.Errorf("entry 0 %s = %v, want %v", k, entries[0][k], v)
+		}
+	}
+	if _, ok := entries[0]["log"]; ok {
+		t.Errorf("entry 0 kept the log field: %v", entries[0])
+	}
+	if entries[1]["level"] != "warn" || entries[1]["msg"] != "no message key" || entries[1]["tag"] != "app.web" {
+		t.Errorf("entry 1 = %v, want the record with its tag", entries[1])
+	}
+}
+
+func TestIntegration_SystemdNotify(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unix datagram sockets unavailable: %v", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", socket)
+	t.Setenv("WATCHDOG_USEC", "20000")
+	t.Setenv("WATCHDOG_PID", "")
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- runPipeline(Config{Format: "json", Quiet: true}, pr, io.Discard, io.Discard) }()
+
+	var states []string
+	buf := make([]byte, 64)
+	for !slices.Contains(states, "STOPPING=1") {
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("states = %v, then %v", states, err)
+		}
+		states = append(states, string(buf[:n]))
+		// Let a watchdog keep-alive arrive before the input ends
+		if slices.Contains(states, "WATCHDOG=1") {
+			_ = pw.Close()
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("runPipeline() error: %v", err)
+	}
+	if states[0] != "READY=1" {
+		t.Errorf("states = %v, want READY=1 first", states)
+	}
+}
+
+// blockingWriter blocks every Write until release is closed, telling
+// blocked when the first one starts.
+type blockingWriter struct {
+	blocked chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { close(w.blocked) })
+	<-w.release
+	return len(p), nil
+}
+
+func TestIntegration_SystemdWatchdogStall(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unix datagram sockets unavailable: %v", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", socket)
+	t.Setenv("WATCHDOG_USEC", "20000")
+	t.Setenv("WATCHDOG_PID", "")
+
+	// read returns the next state, or "" if none arrives within wait
+	buf := make([]byte, 64)
+	read := func(wait time.Duration) string {
+		_ = conn.SetReadDeadline(time.Now().Add(wait))
+		n, err := conn.Read(buf)
+		if err != nil {
+			return ""
+		}
+		return string(buf[:n])
+	}
+
+	pr, pw := io.Pipe()
+	out := &blockingWriter{blocked: make(chan struct{}), release: make(chan struct{})}
+	done := make(chan error, 1)
+	go func() { done <- runPipeline(Config{Format: "json", Quiet: true}, pr, out, io.Discard) }()
+
+	// Fed while idle
+	for state := ""; state != "WATCHDOG=1"; {
+		if state = read(5 * time.Second); state == "" {
+			t.Fatal("no WATCHDOG=1 while waiting for input")
+		}
+	}
+
+	// Not fed while the output blocks
+	go func() { _, _ = io.WriteString(pw, `{"n":1}`+"\n") }()
+	<-out.blocked
+	time.Sleep(30 * time.Millisecond)
+	for read(time.Millisecond) != "" {
+	}
+	if state := read(200 * time.Millisecond); state != "" {
+		t.Errorf("got %q while the output was blocked", state)
+	}
+
+	close(out.release)
+	_ = pw.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("runPipeline() error: %v", err)
+	}
+}
+
+func TestSdWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		usec, pid string
+		want      time.Duration
+	}{
+		{usec: "", want: 0},
+		{usec: "10000000", want: 5 * time.Second},
+		{usec: "10000000", pid: strconv.Itoa(os.Getpid()), want: 5 * time.Second},
+		{usec: "10000000", pid: "1", want: 0},
+		{usec: "bad", want: 0},
+	}
+	for _, tt := range tests {
+		t.Setenv("WATCHDOG_USEC", tt.usec)
+		t.Setenv("WATCHDOG_PID", tt.pid)
+		if got := sdWatchdogInterval(); got != tt.want {
+			t.Errorf("WATCHDOG_USEC=%q WATCHDOG_PID=%q: interval = %v, want %v", tt.usec, tt.pid, got, tt.want)
+		}
+	}
+}
+
+func TestSdListener_NotActivated(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	if _, err := sdListener("health"); err == nil {
+		t.Error("sdListener() took a socket passed to another process")
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Error("sdListener() left $LISTEN_FDS set")
+	}
+}
+
+func TestIntegration_ForwardListenSystemd(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	f, err := l.(*net.TCPListener).File()
+	_ = l.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Pass the socket as systemd would, as the only one
+	defer func(start int) { sdListenFDsStart = start }(sdListenFDsStart)
+	sdListenFDsStart = int(f.Fd())
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "forward")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var out bytes.Buffer
+	done := make(chan error, 1)
+	cfg := Config{Format: "json", ForwardListen: systemdListen, Quiet: true}
+	go func() { done <- runPipelineContext(ctx, cfg, strings.NewReader(""), &out, io.Discard) }()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial the passed socket: %v", err)
+	}
+	defer conn.Close()
+	msg := forward.AppendValue(nil, []any{"app", time.Unix(1700000000, 0).UTC(), map[string]any{"msg": "hi"}, map[string]any{"chunk": "c1"}})
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	want := forward.AppendValue(nil, map[string]any{"ack": "c1"})
+	ack := make([]byte, len(want))
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(conn, ack); err != nil || !bytes.Equal(ack, want) {
+		t.Fatalf("ack = %x, %v; want %x", ack, err, want)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("runPipelineContext() error: %v", err)
+	}
+	if entries := parseNDJSON(t, out.String()); len(entries) != 1 || entries[0]["msg"] != "hi" {
+		t.Errorf("got %s, want the event", out.String())
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Error("$LISTEN_FDS left set")
+	}
+}
+
+func TestDockerPlugin(t *testing.T) {
+	var mu sync.Mutex
+	var received []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, parseNDJSON(t, string(body))...)
+	}))
+	defer srv.Close()
+
+	// The daemon writes to a FIFO; a file holding the whole stream reads the same
+	dir := t.TempDir()
+	var stream []byte
+	for _, e := range []dockerlog.Entry{
+		{Source: "stdout", Line: []byte("level=info msg=hi")},
+		{Source: "stderr", Line: []byte("level=err"), Partial: true},
+		{Source: "stderr", Line: []byte("or msg=boom")},
+	} {
+		stream = dockerlog.AppendEntry(stream, &e)
+	}
+	fifo := filepath.Join(dir, "fifo")
+	if err := os.WriteFile(fifo, stream, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(dir, "plugin.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	errOut := &notifyWriter{written: make(chan struct{}, 64)}
+	cfg := Config{Outputs: []string{srv.URL}, DockerSocket: socket, Quiet: true}
+	go func() { done <- runDockerPlugin(ctx, cfg, errOut) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}
+	post := func(path, body string) string {
+		t.Helper()
+		for i := 0; ; i++ {
+			resp, err := client.Post("http://plugin"+path, "application/json", strings.NewReader(body))
+			if err != nil && i < 50 {
+				time.Sleep(20 * time.Millisecond) // not listening yet
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			data, _ := io.ReadAll(resp.Body)
+			return strings.TrimSpace(string(data))
+		}
+	}
+
+	info := `"Info":{"ContainerID":"abc123","ContainerName":"/web","ContainerImageName":"nginx:1","Config":{"format":"kv"}}`
+	if got := post("/LogDriver.StartLogging", `{"File":"`+fifo+`",`+info+`}`); got != `{"Err":""}` {
+		t.Fatalf("StartLogging = %s", got)
+	}
+	if got := post("/LogDriver.StopLogging", `{"File":"`+fifo+`"}`); got != `{"Err":""}` {
+		t.Fatalf("StopLogging = %s", got)
+	}
+	if got := post("/LogDriver.StartLogging", `{"File":"x","Info":{"Config":{"max-size":"10m"}}}`); !strings.Contains(got, `unknown log opt \"max-size\"`) {
+		t.Errorf("StartLogging with an unknown option = %s", got)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("runDockerPlugin() error: %v", err)
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("socket left behind: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Slice(received, func(i, j int) bool { return fmt.Sprint(received[i]["source"]) > fmt.Sprint(received[j]["source"]) })
+	want := []map[string]any{
+		{"container_id": "abc123", "container_name": "web", "image": "nginx:1", "source": "stdout", "level": "info", "msg": "hi"},
+		{"container_id": "abc123", "container_name": "web", "image": "nginx:1", "source": "stderr", "level": "error", "msg": "boom"},
+	}
+	if !reflect.DeepEqual(received, want) {
+		t.Errorf("received %v, want %v", received, want)
+	}
+	if errOut.buf.Len() > 0 {
+		t.Errorf("stderr = %q", errOut.buf.String())
+	}
+}
+
+func TestDockerPlugin_Errors(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "plugin.sock")
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{name: "no output", cfg: Config{}, want: "needs an http(s)://"},
+		{name: "file output", cfg: Config{Outputs: []string{"out.ndjson"}}, want: "network outputs, not out.ndjson"},
+		{name: "routes", cfg: Config{Outputs: []string{"http://localhost:9000"}, Routes: []string{"default => stdout"}}, want: "--route"},
+		{name: "bad socket", cfg: Config{Outputs: []string{"http://localhost:9000"}, DockerSocket: filepath.Join(socket, "missing", "x.sock")}, want: "--docker-socket"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := runDockerPlugin(context.Background(), tt.cfg, io.Discard)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("runDockerPlugin() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntegration_Check(t *testing.T) {
+	var requests int
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		input   string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "stdout",
+			cfg:  Config{},
+			want: []string{"configuration: ok", "output stdout: ok"},
+		},
+		{
+			name: "outputs",
+			cfg:  Config{Outputs: []string{filepath.Join(dir, "out.ndjson"), srv.URL}},
+			want: []string{"output " + filepath.Join(dir, "out.ndjson") + ": ok", "output " + srv.URL + ": ok"},
+		},
+		{
+			name: "routes",
+			cfg:  Config{Routes: []string{`level == "error" => ` + filepath.Join(dir, "errors.ndjson"), "default => stdout"}},
+			want: []string{"output stdout: ok", "output " + filepath.Join(dir, "errors.ndjson") + ": ok"},
+		},
+		{
+			name:    "unwritable file",
+			cfg:     Config{Outputs: []string{filepath.Join(dir, "missing", "out.ndjson")}},
+			want:    []string{"cannot create files in"},
+			wantErr: "check failed: 1 of the outputs",
+		},
+		{
+			name:    "unreachable url",
+			cfg:     Config{Outputs: []string{closed.URL}},
+			want:    []string{"output " + closed.URL + ": cannot connect"},
+			wantErr: "check failed: 1 of the outputs",
+		},
+		{
+			name:  "sample",
+			cfg:   Config{CheckLines: 4},
+			input: "{\"level\":\"info\"}\n{\"level\":\"warn\"}\n\x00\x01\n\n{\"level\":\"error\"}\n",
+			want:  []string{"sample: 4 lines", "detected format: json", "    json: 2 lines", "    empty: 1 lines", "    no match: 1 lines (lines 3)"},
+		},
+		{
+			name:  "sample with match",
+			cfg:   Config{Format: "json", CheckLines: 2, Match: "info"},
+			input: "{\"level\":\"info\"}\n{\"level\":\"warn\"}\n",
+			want:  []string{"sample: 2 lines, 1 skipped by --match", "    json: 1 lines"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Check = true
+			var out, errOut bytes.Buffer
+			err := runPipeline(tt.cfg, strings.NewReader(tt.input), &out, &errOut)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("runPipeline() error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("runPipeline() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("report = %q, want it to contain %q", out.String(), want)
+				}
+			}
+		})
+	}
+
+	// Nothing was written or sent
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("--check left %d files behind", len(entries))
+	}
+	if requests != 0 {
+		t.Errorf("--check sent %d requests", requests)
+	}
+}
+
+func TestIntegration_Explain(t *testing.T) {
+	input := "Oct 11 22:14:15 host sshd[42]: Accepted password\n{\"level\": }\n"
+
+	t.Run("stderr", func(t *testing.T) {
+		stdout, stderr := runTest(t, Config{Explain: "stderr"}, input)
+		if len(parseNDJSON(t, stdout)) != 2 {
+			t.Fatalf("stdout = %q, want 2 entries", stdout)
+		}
+		for _, want := range []string{
+			"line 1: syslog (detected)\n",
+			"    syslog: matched (confidence 1.00)\n",
+			"    apache: rejected\n",
+			"line 2: syslog (cached)\n",
+			"    json: failed: invalid character",
+			"    syslog: failed: line does not match parser pattern (confidence 0.00)\n",
+		} {
+			if !strings.Contains(stderr, want) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr, want)
+			}
+		}
+	})
+
+	t.Run("field", func(t *testing.T) {
+		stdout, stderr := runTest(t, Config{Explain: "field", ExplainLines: 1}, input)
+		if strings.Contains(stderr, "line 1:") {
+			t.Errorf("stderr = %q, want no explanation", stderr)
+		}
+		entries := parseNDJSON(t, stdout)
+		if len(entries) != 2 {
+			t.Fatalf("got %d entries, want 2", len(entries))
+		}
+		detection, ok := entries[0]["_detection"].(map[string]any)
+		if !ok {
+			t.Fatalf("_detection = %v, want an object", entries[0]["_detection"])
+		}
+		if detection["choice"] != "detected" || detection["format"] != "syslog" {
+			t.Errorf("_detection = %v, want syslog detected", detection)
+		}
+		if parsers, _ := detection["parsers"].([]any); len(parsers) < 2 {
+			t.Errorf("_detection.parsers = %v, want a verdict from each parser", detection["parsers"])
+		}
+		if _, ok := entries[1]["_detection"]; ok {
+			t.Errorf("line 2 has _detection beyond --explain-lines 1")
+		}
+	})
+}
+
+func TestIntegration_OutputParquet(t *testing.T) {
+	path := t.TempDir() + "/logs.parquet"
+	cfg := Config{Outputs: []string{path}, OutputFormat: "parquet", ParquetRowGroup: 2, Quiet: true}
+	runTest(t, cfg, "level=info status=200\nlevel=error status=500\nlevel=warn status=404")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading output file: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) {
+		t.Fatalf("output is not a Parquet file: %q", data)
+	}
+	for _, col := range []string{"level", "status", "_extra"} {
+		if !bytes.Contains(data, []byte(col)) {
+			t.Errorf("footer is missing column %q", col)
+		}
+	}
+}
+
+func TestIntegration_OutputAvro(t *testing.T) {
+	dir := t.TempDir()
+	schemaPath := dir + "/log.avsc"
+	schema := `{"type":"record","name":"Log","fields":[{"name":"level","type":"string"},{"name":"status","type":"int"}]}`
+	if err := os.WriteFile(schemaPath, []byte(schema), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cfg := range []Config{
+		{OutputFormat: "avro", Quiet: true},
+		{OutputFormat: "avro", AvroSchema: schemaPath, Quiet: true},
+	} {
+		stdout, _ := runTest(t, cfg, "level=info status=200\nlevel=error status=500")
+		if !strings.HasPrefix(stdout, "Obj\x01") || !strings.Contains(stdout, `"name":"status"`) {
+			t.Errorf("output is not an Avro container with the schema: %q", stdout)
+		}
+	}
+
+	// Entries that do not match the schema are reported, not written
+	cfg := Config{OutputFormat: "avro", AvroSchema: schemaPath}
+	_, stderr := runTest(t, cfg, "level=info status=oops")
+	if !strings.Contains(stderr, "output error") {
+		t.Errorf("expected output error on stderr, got %q", stderr)
+	}
+}
+
+func TestIntegration_OutputCBOR(t *testing.T) {
+	cfg := Config{OutputFormat: "cbor", Quiet: true}
+	stdout, _ := runTest(t, cfg, `{"level":"info"}`+"\n"+`{"level":"warn","n":2}`)
+
+	// A map header, then text strings with their lengths in the low bits
+	want := "\xa1\x65level\x64info" + "\xa2\x61n\x02\x65level\x64warn"
+	if stdout != want {
+		t.Errorf("output = %q, want %q", stdout, want)
+	}
+}
+
+func TestIntegration_OTLP(t *testing.T) {
+	var mu sync.Mutex
+	var requests int
+	var auth, contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		auth, contentType = r.Header.Get("Authorization"), r.Header.Get("Content-Type")
+		if r.URL.Path != "/v1/logs" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := Config{
+		OTLPEndpoint:  srv.URL,
+		OTLPHeaders:   []string{"Authorization: Bearer secret"},
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+	}
+	stdout, stderr := runTest(t, cfg, "level=info msg=a\nlevel=warn msg=b\nlevel=error msg=c")
+	if stdout != "" || stderr != "" {
+		t.Errorf("unexpected output: stdout %q, stderr %q", stdout, stderr)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != 2 {
+		t.Errorf("collector got %d requests, want 2 batches", requests)
+	}
+	if auth != "Bearer secret" || contentType != "application/x-protobuf" {
+		t.Errorf("headers: Authorization %q, Content-Type %q", auth, contentType)
+	}
+}
+
+func TestIntegration_Elasticsearch(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(data))
+		mu.Unlock()
+		_, _ = io.WriteString(w, `{"errors":false,"items":[]}`)
+	}))
+	defer srv.Close()
+
+	cfg := Config{
+		Outputs:       []string{strings.Replace(srv.URL, "http://", "es://", 1) + "/app-logs"},
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+	}
+	stdout, stderr := runTest(t, cfg, "level=info msg=a\nlevel=warn msg=b")
+	if stdout != "" || stderr != "" {
+		t.Errorf("unexpected output: stdout %q, stderr %q", stdout, stderr)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 1 {
+		t.Fatalf("got %d bulk requests, want 1", len(bodies))
+	}
+	lines := strings.Split(strings.TrimSpace(bodies[0]), "\n")
+	if len(lines) != 4 || lines[0] != `{"index":{"_index":"app-logs"}}` || !strings.Contains(lines[3], `"msg":"b"`) {
+		t.Errorf("bulk body = %q", bodies[0])
+	}
+}
+
+func TestIntegration_HTTPOutput(t *testing.T) {
+	var mu sync.Mutex
+	var bodies, auth []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(data))
+		auth = append(auth, r.Header.Get("X-Api-Key"))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	cfg := Config{
+		Outputs:       []string{srv.URL + "/ingest"},
+		OutputHeaders: []string{"X-Api-Key: s3cret"},
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+	}
+	stdout, stderr := runTest(t, cfg, "level=info msg=a\nlevel=warn msg=b")
+	if stdout != "" || stderr != "" {
+		t.Errorf("unexpected output: stdout %q, stderr %q", stdout, stderr)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 1 || auth[0] != "s3cret" {
+		t.Fatalf("got %d requests with keys %v, want 1 with s3cret", len(bodies), auth)
+	}
+	lines := strings.Split(strings.TrimSpace(bodies[0]), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], `"msg":"b"`) {
+		t.Errorf("request body = %q", bodies[0])
+	}
+}
+
+func TestIntegration_OutputAuth(t *testing.T) {
+	var mu sync.Mutex
+	var auth, apiKey string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		auth, apiKey = r.Header.Get("Authorization"), r.Header.Get("X-Api-Key")
+		mu.Unlock()
+		if strings.HasSuffix(r.URL.Path, "/_bulk") {
+			_, _ = io.WriteString(w, `{"errors":false,"items":[]}`)
+		}
+	}))
+	defer srv.Close()
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("k3y\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LOG2JSON_TEST_TOKEN", "t0ken")
+	es := strings.Replace(srv.URL, "http://", "es://elastic:ignored@", 1) + "/logs"
+	tests := []struct {
+		name     string
+		cfg      Config
+		wantAuth string
+		wantKey  string
+	}{
+		{name: "basic", cfg: Config{Outputs: []string{srv.URL}, OutputAuth: "basic:alice:s3cret"}, wantAuth: "Basic YWxpY2U6czNjcmV0"},
+		{name: "bearer from env", cfg: Config{Outputs: []string{srv.URL}, OutputAuth: "bearer:env:LOG2JSON_TEST_TOKEN"}, wantAuth: "Bearer t0ken"},
+		{name: "api key from file", cfg: Config{Outputs: []string{srv.URL}, OutputAuth: "api-key:file:" + keyFile}, wantKey: "k3y"},
+		{name: "es api key", cfg: Config{Outputs: []string{es}, OutputAuth: "api-key:file:" + keyFile}, wantAuth: "ApiKey k3y"},
+		{name: "es bearer", cfg: Config{Outputs: []string{es}, OutputAuth: "bearer:env:LOG2JSON_TEST_TOKEN"}, wantAuth: "Bearer t0ken"},
+		{name: "es api key flag from env", cfg: Config{Outputs: []string{es}, ESAPIKey: "env:LOG2JSON_TEST_TOKEN"}, wantAuth: "ApiKey t0ken"},
+		{name: "otlp", cfg: Config{OTLPEndpoint: srv.URL, OutputAuth: "bearer:env:LOG2JSON_TEST_TOKEN"}, wantAuth: "Bearer t0ken"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			auth, apiKey = "", ""
+			mu.Unlock()
+			if stdout, stderr := runTest(t, tt.cfg, "level=info msg=a"); stdout != "" || stderr != "" {
+				t.Errorf("unexpected output: stdout %q, stderr %q", stdout, stderr)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if auth != tt.wantAuth || apiKey != tt.wantKey {
+				t.Errorf("Authorization %q, X-API-Key %q; want %q, %q", auth, apiKey, tt.wantAuth, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestIntegration_OutputByField(t *testing.T) {
+	dir := t.TempDir()
+	input := `Jan 15 10:30:45 host sshd[1]: Accepted publickey
+Jan 15 10:30:46 host CRON[2]: job started
+Jan 15 10:30:47 host sshd[1]: Disconnected
+Jan 15 10:30:48 host kernel: eth0 up`
+	cfg := Config{OutputByField: "program:" + filepath.Join(dir, "by-program", "{program}.ndjson"), OutputByFieldMax: 2, Quiet: true}
+	if stdout, _ := runTest(t, cfg, input); stdout != "" {
+		t.Errorf("unexpected stdout %q", stdout)
+	}
+	for name, want := range map[string]int{"sshd.ndjson": 2, "CRON.ndjson": 1, "kernel.ndjson": 1} {
+		data, err := os.ReadFile(filepath.Join(dir, "by-program", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(parseNDJSON(t, string(data))); got != want {
+			t.Errorf("%s has %d entries, want %d", name, got, want)
+		}
+	}
+}
+
+func TestIntegration_OutputByFieldPushdown(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Config{
+		Format:           "kv",
+		Fields:           []string{"msg"},
+		OutputByField:    "program:" + filepath.Join(dir, "{program}.ndjson"),
+		OutputByFieldMax: 1,
+		Quiet:            true,
+	}
+	runTest(t, cfg, "program=a msg=x\nprogram=b msg=y")
+	for name, want := range map[string]string{"a.ndjson": "x", "b.ndjson": "y"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries := parseNDJSON(t, string(data))
+		if len(entries) != 1 || entries[0]["msg"] != want || entries[0]["program"] != nil {
+			t.Errorf("%s = %v, want only msg=%s", name, entries, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "_none.ndjson")); err == nil {
+		t.Error("entries were written to _none.ndjson")
+	}
+}
+
+func TestIntegration_OutputRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.ndjson")
+	cfg := Config{Outputs: []string{path}, RotateSize: 20, RotateKeep: 1}
+	input := `{"level":"info","n":1}
+{"level":"info","n":2}
+{"level":"info","n":3}`
+	if stdout, _ := runTest(t, cfg, input); stdout != "" {
+		t.Errorf("unexpected stdout %q", stdout)
+	}
+
+	for name, want := range map[string][]float64{"out.ndjson": {3}, "out.ndjson.1": {2}} {
+		data, err := os.ReadFile(filepath.Join(filepath.Dir(path), name))
+		if err != nil {
+			t.Fatalf("reading %s: %v", name, err)
+		}
+		entries := parseNDJSON(t, string(data))
+		if len(entries) != len(want) || entries[0]["n"] != want[0] {
+			t.Errorf("%s = %v, want n=%v", name, entries, want)
+		}
+	}
+	if _, err := os.Stat(path + ".2"); err == nil {
+		t.Errorf("out.ndjson.2 exists despite --keep 1")
+	}
+}
+
+func TestIntegration_OutputCompress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.ndjson.gz")
+	cfg := Config{Outputs: []string{path}, OutputCompress: "gzip"}
+	runTest(t, cfg, `{"level":"info","n":1}`+"\n"+`{"level":"warn","n":2}`)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("opening output: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error: %v", err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("reading gzip output: %v", err)
+	}
+	entries := parseNDJSON(t, string(data))
+	if len(entries) != 2 || entries[1]["level"] != "warn" {
+		t.Errorf("decompressed entries = %v", entries)
+	}
+
+	// zstd to stdout: a frame starting with the zstd magic number
+	stdout, _ := runTest(t, Config{OutputCompress: "zstd"}, `{"level":"info"}`)
+	if !strings.HasPrefix(stdout, "\x28\xb5\x2f\xfd") {
+		t.Errorf("stdout = %q, want a zstd frame", stdout)
+	}
+}
+
+func TestIntegration_TeeOutputs(t *testing.T) {
+	// A collector that rejects everything must not affect the other outputs
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad token", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "out.ndjson")
+	cfg := Config{
+		Outputs:       []string{"-", path, srv.URL},
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+	}
+	var out, errOut bytes.Buffer
+	input := `{"level":"info","n":1}` + "\n" + `{"level":"warn","n":2}`
+	if err := runPipeline(cfg, strings.NewReader(input), &out, &errOut); err != nil {
+		t.Fatalf("runPipeline returned error: %v", err)
+	}
+
+	if entries := parseNDJSON(t, out.String()); len(entries) != 2 {
+		t.Errorf("stdout has %d entries, want 2", len(entries))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading output file: %v", err)
+	}
+	if entries := parseNDJSON(t, string(data)); len(entries) != 2 {
+		t.Errorf("file has %d entries, want 2", len(entries))
+	}
+	want := "output error at line 2: " + srv.URL + ": dropped 1 entries: 401"
+	if !strings.Contains(errOut.String(), want) {
+		t.Errorf("stderr = %q, want it to contain %q", errOut.String(), want)
+	}
+}
+
+func TestIntegration_OutputTemplate(t *testing.T) {
+	cfg := Config{OutputTemplate: `{{.timestamp}} {{upper .level}} {{.msg}}{{if .user}} user={{.user}}{{end}}`}
+	input := `{"timestamp":"2024-01-15T10:00:00Z","level":"info","msg":"started"}
+{"timestamp":"2024-01-15T10:00:01Z","level":"warn","msg":"slow","user":"ana"}`
+	stdout, _ := runTest(t, cfg, input)
+	want := "2024-01-15T10:00:00Z INFO started\n2024-01-15T10:00:01Z WARN slow user=ana\n"
+	if stdout != want {
+		t.Errorf("got %q, want %q", stdout, want)
+	}
+}
+
+func TestIntegration_FieldOrder(t *testing.T) {
+	cfg := Config{FieldOrder: []string{"timestamp", "level", "message"}}
+	input := `{"message":"started","zone":"eu","level":"info","timestamp":"2024-01-15T10:00:00Z","app":"api"}`
+	stdout, _ := runTest(t, cfg, input)
+	want := `{"timestamp":"2024-01-15T10:00:00Z","level":"info","message":"started","app":"api","zone":"eu"}` + "\n"
+	if stdout != want {
+		t.Errorf("got %s, want %s", stdout, want)
+	}
+}
+
+func TestIntegration_InferSchema(t *testing.T) {
+	input := `{"level":"info","msg":"started","port":8080}
+{"level":"error","msg":"failed","err":"timeout"}`
+
+	stdout, _ := runTest(t, Config{InferSchema: true, AddLineNumber: true}, input)
+	var schema struct {
+		Schema     string                    `json:"$schema"`
+		Properties map[string]map[string]any `json:"properties"`
+		Required   []string                  `json:"required"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &schema); err != nil {
+		t.Fatalf("output is not a JSON Schema: %v\n%s", err, stdout)
+	}
+	if schema.Schema == "" || schema.Properties["port"]["type"] != "integer" {
+		t.Errorf("schema = %s", stdout)
+	}
+	if want := []string{"_lineNumber", "level", "msg"}; !reflect.DeepEqual(schema.Required, want) {
+		t.Errorf("required = %v, want %v", schema.Required, want)
+	}
+
+	stdout, _ = runTest(t, Config{InferSchema: true, SchemaReport: true}, input)
+	if !strings.HasPrefix(stdout, "2 entries") || !strings.Contains(stdout, "err    string   50.0%") {
+		t.Errorf("report = %s", stdout)
+	}
+}
+
+func TestIntegration_Describe(t *testing.T) {
+	input := `level=info status=200 path=/
+level=warn status=503 path=/api
+level=info status=200 path=/
+level=error status=500
+level=info status=404 path=/x`
+
+	stdout, _ := runTest(t, Config{Describe: true}, input)
+	for _, want := range []string{
+		"5 entries",
+		"FIELD   TYPE     PRESENT  DISTINCT  MIN  MAX  TOP VALUES",
+		`level   string   100.0%   3         -    -    "info" 60%, "error" 20%, "warn" 20%`,
+		`path    string   80.0%    3         -    -    "/" 50%, "/api" 25%, "/x" 25%`,
+		"status  integer  100.0%   4         200  503  200 40%, 404 20%, 500 20%, 503 20%",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("description lacks %q:\n%s", want, stdout)
+		}
+	}
+
+	// --lines samples the start of the input
+	stdout, _ = runTest(t, Config{Describe: true, DescribeLines: 2}, input)
+	if !strings.HasPrefix(stdout, "2 entries") || !strings.Contains(stdout, "200  503") {
+		t.Errorf("sampled description = %s", stdout)
+	}
+}
+
+func TestIntegration_Top(t *testing.T) {
+	input := `level=info path=/
+level=warn path=/api
+level=info path=/
+level=error
+level=info path=/x`
+
+	stdout, stderr := runTest(t, Config{Top: true, TopBy: "path", TopInterval: time.Hour}, input)
+	if stdout != "" {
+		t.Errorf("top without --output wrote entries: %s", stdout)
+	}
+	for _, want := range []string{
+		"log2json top by path: 5 entries,",
+		"3 values",
+		"(1 without path)",
+		"COUNT     RATE/s   SHARE  PATH",
+		"40.0%  /\n",
+		"20.0%  /api\n",
+	} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("ranking lacks %q:\n%s", want, stderr)
+		}
+	}
+	if strings.Index(stderr, "%  /\n") > strings.Index(stderr, "%  /api\n") {
+		t.Errorf("ranking is not by count:\n%s", stderr)
+	}
+
+	// The ranked field is parsed even when --fields leaves it out
+	_, stderr = runTest(t, Config{Top: true, TopBy: "path", Fields: []string{"level"}}, input)
+	if !strings.Contains(stderr, "%  /api\n") {
+		t.Errorf("ranking with --fields lacks /api:\n%s", stderr)
+	}
+
+	// Entries still go to an --output
+	path := filepath.Join(t.TempDir(), "out.ndjson")
+	runTest(t, Config{Top: true, TopBy: "level", Outputs: []string{path}, Quiet: true}, input)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(parseNDJSON(t, string(data))); got != 5 {
+		t.Errorf("--output has %d entries, want 5", got)
+	}
+}
+
+func TestTopBoard_Render(t *testing.T) {
+	clock := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	b := newTopBoard("status")
+	b.now = func() time.Time { return clock }
+	b.start, b.last = clock, clock
+	add := func(status any, n int) {
+		for i := 0; i < n; i++ {
+			e := parser.NewEntry("")
+			e.Fields["status"] = status
+			b.add(e)
+		}
+	}
+	add(200, 6)
+	add(500, 2)
+	clock = clock.Add(2 * time.Second)
+
+	var out bytes.Buffer
+	if err := b.render(&out, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	want := "log2json top by status: 8 entries, 4.0/s, 2 values, 2s\n" +
+		"     COUNT     RATE/s   SHARE  STATUS\n" +
+		"         6        3.0   75.0%  200\n"
+	if out.String() != want {
+		t.Errorf("render() =\n%s\nwant\n%s", out.String(), want)
+	}
+
+	// Rates are over the time since the last drawing
+	add(500, 10)
+	clock = clock.Add(5 * time.Second)
+	out.Reset()
+	_ = b.render(&out, 2, 0)
+	if !strings.Contains(out.String(), "        12        2.0   66.7%  500\n") {
+		t.Errorf("unexpected second drawing:\n%s", out.String())
+	}
+}
+
+func TestIntegration_Color(t *testing.T) {
+	input := `{"level":"error","msg":"db timeout"}`
+
+	// auto: the test's buffer is not a terminal
+	stdout, _ := runTest(t, Config{Color: "auto"}, input)
+	if strings.Contains(stdout, "\x1b[") {
+		t.Errorf("auto colored a non-terminal: %q", stdout)
+	}
+
+	stdout, _ = runTest(t, Config{Color: "always", Match: "time"}, input)
+	want := "{\"level\":\x1b[31m\"error\"\x1b[0m,\"msg\":\"db \x1b[7mtime\x1b[0mout\"}\n"
+	if stdout != want {
+		t.Errorf("got %q, want %q", stdout, want)
+	}
+
+	// Files are never colored
+	path := filepath.Join(t.TempDir(), "out.ndjson")
+	runTest(t, Config{Color: "always", Outputs: []string{path}}, input)
+	data, err := os.ReadFile(path)
 	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "\x1b[") {
+		t.Errorf("file output colored: %q", data)
+	}
+}
+
+func TestIntegration_FlushLines(t *testing.T) {
+	input := `{"n":1}
+{"n":2}
+{"n":3}`
+	for _, cfg := range []Config{{FlushLines: 2}, {FlushInterval: time.Hour}, {FlushLines: 2, OutputTemplate: "{{.n}}"}, {Buffer: "block"}, {Buffer: "block", BufferSize: 4}} {
+		stdout, _ := runTest(t, cfg, input)
+		// Entries still buffered at the end of input are flushed
+		if n := strings.Count(stdout, "\n"); n != 3 {
+			t.Errorf("%+v: got %d lines, want 3: %q", cfg, n, stdout)
+		}
+	}
+
+	opts := streamOptions(&bytes.Buffer{}, false, emitter.Options{FlushLines: 5, FlushInterval: time.Second})
+	if opts.FlushLines != 5 || opts.FlushInterval != time.Second {
+		t.Errorf("streamOptions dropped batching for a non-terminal: %+v", opts)
+	}
+}
+
+func TestIntegration_BufferSize(t *testing.T) {
+	var input strings.Builder
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&input, "level=info n=%d msg=%q\n", i, strings.Repeat("x", i%300))
+	}
+	want, _ := runTest(t, Config{Format: "kv"}, input.String())
+
+	// Any fixed size reads and writes the same entries as the adaptive
+	// buffers, including lines longer than it
+	for _, size := range []int64{16, 4096, 1 << 20} {
+		for _, buffer := range []string{"line", "block"} {
+			got, _ := runTest(t, Config{Format: "kv", BufferSize: size, Buffer: buffer}, input.String())
+			if got != want {
+				t.Errorf("--buffer-size %d --buffer %s: output differs from the default", size, buffer)
+			}
+		}
+	}
+}
+
+func TestStreamOptions_Buffering(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tests := []struct {
+		name         string
+		w            io.Writer
+		file         bool
+		opts         emitter.Options
+		want         emitter.BufferMode
+		wantInterval time.Duration
+	}{
+		{name: "auto pipe", w: &bytes.Buffer{}, want: emitter.BufferLine},
+		{name: "auto file output", w: &bytes.Buffer{}, file: true, want: emitter.BufferBlock, wantInterval: emitter.DefaultFlushInterval},
+		{name: "auto redirected stdout", w: f, want: emitter.BufferBlock, wantInterval: emitter.DefaultFlushInterval},
+		{name: "line file", w: f, opts: emitter.Options{Buffering: emitter.BufferLine}, want: emitter.BufferLine},
+		{name: "block pipe", w: &bytes.Buffer{}, opts: emitter.Options{Buffering: emitter.BufferBlock, FlushInterval: time.Minute}, want: emitter.BufferBlock, wantInterval: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := streamOptions(tt.w, tt.file, tt.opts)
+			if opts.Buffering != tt.want || opts.FlushInterval != tt.wantInterval {
+				t.Errorf("streamOptions() = %q every %v, want %q every %v", opts.Buffering, opts.FlushInterval, tt.want, tt.wantInterval)
+			}
+		})
+	}
+}
+
+func TestIntegration_KeyPrefixNamespace(t *testing.T) {
+	input := `{"message":"started","timestamp":"2024-01-15T10:00:00Z"}`
+
+	stdout, _ := runTest(t, Config{KeyPrefix: "app_", AddLineNumber: true}, input)
+	results := parseNDJSON(t, stdout)
+	if len(results) != 1 || results[0]["app_message"] != "started" || results[0]["_lineNumber"] != float64(1) || results[0]["message"] != nil {
+		t.Errorf("--key-prefix: got %v", results)
+	}
+
+	stdout, _ = runTest(t, Config{Namespace: "app", AddLineNumber: true}, input)
+	results = parseNDJSON(t, stdout)
+	app, _ := results[0]["app"].(map[string]any)
+	if app["timestamp"] != "2024-01-15T10:00:00Z" || results[0]["_lineNumber"] != float64(1) || len(results[0]) != 2 {
+		t.Errorf("--namespace: got %v", results)
+	}
+}
+
+func TestIntegration_GroupOutput(t *testing.T) {
+	input := `{"level":"info","msg":"started"}
+not json at all`
+	cfg := Config{Format: "json", GroupOutput: true, AddLineNumber: true}
+	stdout, _ := runTest(t, cfg, input)
+	results := parseNDJSON(t, stdout)
+	if len(results) != 2 {
+		t.Fatalf("got %d entries, want 2", len(results))
+	}
+
+	fields, _ := results[0]["fields"].(map[string]any)
+	meta, _ := results[0]["meta"].(map[string]any)
+	if fields["msg"] != "started" || meta["lineNumber"] != float64(1) || results[0]["error"] != nil {
+		t.Errorf("entry 1 = %v", results[0])
+	}
+	errs, _ := results[1]["error"].(map[string]any)
+	if errs["parse"] == nil {
+		t.Errorf("entry 2 = %v, want error.parse", results[1])
+	}
+}
+
+func TestIntegration_SyslogOutput(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	cfg := Config{Format: "syslog", Outputs: []string{"syslog://" + pc.LocalAddr().String()}, SyslogFacility: "local0"}
+	runTest(t, cfg, "2024-01-15T10:30:45Z web1 sshd[1234]: Accepted password for bob")
+
+	buf := make([]byte, 2048)
+	_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<134>1 2024-01-15T10:30:45Z web1 sshd 1234 - - Accepted password for bob"
+	if got := string(buf[:n]); got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestIntegration_ForwardOutput(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan struct{})
+	var mu sync.Mutex
+	var events []forward.Event
+	go func() {
+		defer close(served)
+		_ = forward.Serve(ctx, l, func(batch []forward.Event) error {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, batch...)
+			return nil
+		})
+	}()
+	defer func() {
+		cancel()
+		<-served
+	}()
+
+	cfg := Config{Format: "syslog", Outputs: []string{"forward://" + l.Addr().String()}, ForwardTag: "syslog.{{.program}}"}
+	runTest(t, cfg, "2024-01-15T10:30:45Z web1 sshd[1234]: Accepted password for bob\n2024-01-15T10:30:46Z web1 cron[99]: job done")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %+v", len(events), events)
+	}
+	if events[0].Tag != "syslog.sshd" || events[1].Tag != "syslog.cron" {
+		t.Errorf("tags = %q, %q; want syslog.sshd, syslog.cron", events[0].Tag, events[1].Tag)
+	}
+	if want := time.Date(2024, 1, 15, 10, 30, 45, 0, time.UTC); !events[0].Time.Equal(want) {
+		t.Errorf("time = %v, want %v", events[0].Time, want)
+	}
+	if events[0].Record["message"] != "Accepted password for bob" || events[0].Record["host"] != "web1" {
+		t.Errorf("record = %v, want the parsed syslog fields", events[0].Record)
+	}
+}
+
+func TestIntegration_InvalidOutputFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{name: "unknown format", cfg: Config{OutputFormat: "xml"}, want: "--output-format"},
+		{name: "parquet with routes", cfg: Config{OutputFormat: "parquet", ParquetRowGroup: 10, Routes: []string{"default => stdout"}}, want: "--route"},
+		{name: "bad row group", cfg: Config{OutputFormat: "parquet"}, want: "--parquet-row-group"},
+		{name: "avro with routes", cfg: Config{OutputFormat: "avro", Routes: []string{"default => stdout"}}, want: "--route"},
+		{name: "avro schema without avro", cfg: Config{AvroSchema: "log.avsc"}, want: "--avro-schema"},
+		{name: "missing avro schema", cfg: Config{OutputFormat: "avro", AvroSchema: t.TempDir() + "/missing.avsc"}, want: "--avro-schema"},
+		{name: "otlp with output", cfg: Config{OTLPEndpoint: "http://localhost:4318", Outputs: []string{"x"}}, want: "--otlp-endpoint"},
+		{name: "otlp bad endpoint", cfg: Config{OTLPEndpoint: "localhost:4318"}, want: "--otlp-endpoint"},
+		{name: "otlp bad header", cfg: Config{OTLPEndpoint: "http://localhost:4318", OTLPHeaders: []string{"novalue"}}, want: "--otlp-header"},
+		{name: "es bad url", cfg: Config{Outputs: []string{"es://localhost:9200"}}, want: "--output"},
+		{name: "append without file", cfg: Config{OutputAppend: true}, want: "--append and --atomic require"},
+		{name: "negative max errors", cfg: Config{MaxErrors: -1}, want: "--max-errors"},
+		{name: "max error ratio above 1", cfg: Config{MaxErrorRatio: 1.5}, want: "--max-error-ratio"},
+		{name: "abort error ratio of 1", cfg: Config{AbortOnErrorRatio: 1}, want: "--abort-on-error-ratio"},
+		{name: "negative error ratio window", cfg: Config{AbortOnErrorRatio: 0.5, ErrorRatioWindow: -1}, want: "--error-ratio-window"},
+		{name: "passthrough without error ratio", cfg: Config{ErrorRatioPassthrough: true}, want: "require --abort-on-error-ratio"},
+		{name: "negative check lines", cfg: Config{Check: true, CheckLines: -1}, want: "--check-lines"},
+		{name: "check lines without check", cfg: Config{CheckLines: 10}, want: "--check-lines requires --check"},
+		{name: "negative explain lines", cfg: Config{Explain: "stderr", ExplainLines: -1}, want: "--explain-lines"},
+		{name: "bad health address", cfg: Config{HealthListen: "127.0.0.1:notaport"}, want: "--health-listen"},
+		{name: "bad forward address", cfg: Config{ForwardListen: "127.0.0.1:notaport"}, want: "--forward-listen"},
+		{name: "mmap with forward input", cfg: Config{ForwardListen: "127.0.0.1:0", Mmap: true}, want: "--mmap"},
+		{name: "merge without files", cfg: Config{Merge: true}, want: "merge needs"},
+		{name: "merge with mmap", cfg: Config{Merge: true, MergeFiles: []string{"a.log"}, Mmap: true}, want: "merge reads its files"},
+		{name: "merge with explain", cfg: Config{Merge: true, MergeFiles: []string{"a.log"}, Explain: "stderr"}, want: "--explain"},
+		{name: "missing merge file", cfg: Config{Merge: true, MergeFiles: []string{"/nonexistent/a.log"}}, want: "cannot open merge input"},
+		{name: "kube logs with forward input", cfg: Config{KubeNodeLogs: t.TempDir(), ForwardListen: "127.0.0.1:0"}, want: "--kube-node-logs follows"},
+		{name: "kube logs with merge", cfg: Config{KubeNodeLogs: t.TempDir(), Merge: true, MergeFiles: []string{"a.log"}}, want: "--kube-node-logs follows"},
+		{name: "kube logs with explain", cfg: Config{KubeNodeLogs: t.TempDir(), Explain: "stderr"}, want: "--explain"},
+		{name: "missing kube logs directory", cfg: Config{KubeNodeLogs: "/nonexistent/containers"}, want: "not a directory"},
+		{name: "follow without files", cfg: Config{Follow: true}, want: "--follow needs"},
+		{name: "follow with kube logs", cfg: Config{Follow: true, FollowFiles: []string{"-"}, KubeNodeLogs: t.TempDir()}, want: "--follow reads its files"},
+		{name: "follow with explain", cfg: Config{Follow: true, FollowFiles: []string{"-"}, Explain: "stderr"}, want: "--explain"},
+		{name: "follow stdin twice", cfg: Config{Follow: true, FollowFiles: []string{"-", "-"}}, want: "stdin (-) once"},
+		{name: "follow bad pattern", cfg: Config{Follow: true, FollowFiles: []string{"logs/[a.log"}}, want: "invalid --follow file"},
+		{name: "top without field", cfg: Config{Top: true}, want: "top command needs"},
+		{name: "by without top", cfg: Config{TopBy: "path"}, want: "--by applies"},
+		{name: "top negative interval", cfg: Config{Top: true, TopBy: "path", TopInterval: -time.Second}, want: "--interval"},
+		{name: "alert without command", cfg: Config{Alerts: []string{`level == "fatal" =>`}}, want: "invalid --alert"},
+		{name: "alert bad expression", cfg: Config{Alerts: []string{`level === => ./notify.sh`}}, want: "invalid --alert"},
+		{name: "alert bad rate", cfg: Config{Alerts: []string{`true => true`}, AlertRate: "10"}, want: "invalid --alert"},
+		{name: "alert rate without alert", cfg: Config{AlertRate: "1/s"}, want: "--alert-rate requires --alert"},
+		{name: "webhook without condition", cfg: Config{NotifyWebhook: "https://example.com/hook"}, want: "needs --notify-when"},
+		{name: "notify condition without webhook", cfg: Config{NotifyWhen: "true"}, want: "require --notify-webhook"},
+		{name: "webhook not http", cfg: Config{NotifyWebhook: "ftp://example.com/hook", NotifyWhen: "true"}, want: "invalid --notify-webhook"},
+		{name: "webhook bad condition", cfg: Config{NotifyWebhook: "https://example.com/hook", NotifyWhen: "level =="}, want: "invalid --notify-webhook"},
+		{name: "webhook bad template", cfg: Config{NotifyWebhook: "https://example.com/hook", NotifyWhen: "true", NotifyTemplate: "{{.level"}, want: "invalid --notify-template"},
+		{name: "webhook negative digest", cfg: Config{NotifyWebhook: "https://example.com/hook", NotifyWhen: "true", NotifyDigest: -time.Minute}, want: "invalid --notify-digest"},
+		{name: "explain lines without explain", cfg: Config{ExplainLines: 10}, want: "--explain-lines requires --explain"},
+		{name: "check with bad route", cfg: Config{Check: true, Routes: []string{"level == => x.ndjson"}}, want: "--route"},
+		{name: "fail fast with max errors", cfg: Config{FailFast: true, MaxErrors: 3}, want: "--fail-fast"},
+		{name: "append and atomic", cfg: Config{Outputs: []string{t.TempDir() + "/out"}, OutputAppend: true, OutputAtomic: true}, want: "cannot be combined"},
+		{name: "atomic with rotation", cfg: Config{Outputs: []string{t.TempDir() + "/out"}, OutputAtomic: true, RotateSize: 10}, want: "--atomic"},
+		{name: "es with format", cfg: Config{Outputs: []string{"es://localhost:9200/logs"}, OutputFormat: "cbor"}, want: "es://"},
+		{name: "es negative batch size", cfg: Config{Outputs: []string{"es://localhost:9200/logs"}, BatchSize: -1}, want: "invalid --batch-size: -1 is negative"},
+		{name: "api key without es", cfg: Config{ESAPIKey: "k"}, want: "--es-api-key"},
+		{name: "http with routes", cfg: Config{Outputs: []string{"http://localhost:8080/ingest"}, Routes: []string{"default => stdout"}}, want: "http(s)://"},
+		{name: "http bad header", cfg: Config{Outputs: []string{"http://localhost:8080/ingest"}, OutputHeaders: []string{"novalue"}}, want: "--output-header"},
+		{name: "header without http", cfg: Config{OutputHeaders: []string{"A: b"}}, want: "--output-header"},
+		{name: "by field with output", cfg: Config{OutputByField: "program:{program}", OutputByFieldMax: 1, Outputs: []string{"x"}}, want: "--output-by-field cannot"},
+		{name: "by field with parquet", cfg: Config{OutputByField: "program:{program}", OutputByFieldMax: 1, OutputFormat: "parquet", ParquetRowGroup: 10}, want: "--output-by-field writes JSON"},
+		{name: "by field without placeholder", cfg: Config{OutputByField: "program:out.ndjson", OutputByFieldMax: 1}, want: "invalid --output-by-field"},
+		{name: "by field negative open files", cfg: Config{OutputByField: "program:{program}", OutputByFieldMax: -1}, want: "invalid --output-by-field-max-open: -1 is negative"},
+		{name: "auth without http", cfg: Config{OutputAuth: "bearer:t"}, want: "--output-auth requires"},
+		{name: "auth with es api key", cfg: Config{Outputs: []string{"es://localhost:9200/logs"}, ESAPIKey: "k", OutputAuth: "bearer:t"}, want: "--es-api-key cannot"},
+		{name: "unknown auth scheme", cfg: Config{Outputs: []string{"http://localhost:8080/ingest"}, OutputAuth: "digest:x"}, want: "--output-auth"},
+		{name: "basic auth without user", cfg: Config{Outputs: []string{"http://localhost:8080/ingest"}, OutputAuth: "basic:secret"}, want: "basic:USER:PASS"},
+		{name: "unset auth variable", cfg: Config{Outputs: []string{"http://localhost:8080/ingest"}, OutputAuth: "bearer:env:LOG2JSON_TEST_UNSET"}, want: "LOG2JSON_TEST_UNSET is not set"},
+		{name: "missing auth file", cfg: Config{Outputs: []string{"http://localhost:8080/ingest"}, OutputAuth: "api-key:file:/nonexistent/key"}, want: "--output-auth"},
+		{name: "rotate without output", cfg: Config{RotateSize: 100}, want: "--rotate-size"},
+		{name: "rotate with parquet", cfg: Config{Outputs: []string{t.TempDir() + "/out.parquet"}, OutputFormat: "parquet", ParquetRowGroup: 10, RotateSize: 100}, want: "--output-format"},
+		{name: "keep without limit", cfg: Config{Outputs: []string{t.TempDir() + "/out.ndjson"}, RotateKeep: 3}, want: "--keep"},
+		{name: "unknown compression", cfg: Config{OutputCompress: "lz4"}, want: "--output-compress"},
+		{name: "compress with rotation", cfg: Config{Outputs: []string{t.TempDir() + "/out.ndjson"}, RotateSize: 100, OutputCompress: "gzip"}, want: "--rotate-compress"},
+		{name: "compress with es", cfg: Config{Outputs: []string{"es://localhost:9200/logs"}, OutputCompress: "gzip"}, want: "--output-compress"},
+		{name: "duplicate output", cfg: Config{Outputs: []string{"-", "-"}}, want: "more than once"},
+		{name: "routes with several outputs", cfg: Config{Outputs: []string{"-", "x"}, Routes: []string{"default => stdout"}}, want: "--route"},
+		{name: "bad template", cfg: Config{OutputTemplate: "{{.level"}, want: "--output-template"},
+		{name: "template with format", cfg: Config{OutputTemplate: "{{.level}}", OutputFormat: "cbor"}, want: "--output-template"},
+		{name: "syslog with routes", cfg: Config{Outputs: []string{"syslog://localhost"}, Routes: []string{"default => stdout"}}, want: "syslog://"},
+		{name: "syslog bad scheme", cfg: Config{Outputs: []string{"syslog+quic://localhost"}}, want: "--output"},
+		{name: "syslog bad facility", cfg: Config{Outputs: []string{"syslog://localhost"}, SyslogFacility: "galaxy"}, want: "--syslog-facility"},
+		{name: "facility without syslog", cfg: Config{SyslogFacility: "user"}, want: "--syslog-facility"},
+		{name: "forward with output format", cfg: Config{Outputs: []string{"forward://localhost"}, OutputFormat: "cbor"}, want: "forward://"},
+		{name: "forward bad scheme", cfg: Config{Outputs: []string{"forward+udp://localhost"}}, want: "must be forward://"},
+		{name: "forward tag without forward", cfg: Config{ForwardTag: "app"}, want: "--forward-tag"},
+		{name: "forward bad tag", cfg: Config{Outputs: []string{"forward://localhost"}, ForwardTag: "{{.app"}, want: "--forward-tag"},
+		{name: "forward with compression", cfg: Config{Outputs: []string{"forward://localhost"}, OutputCompress: "gzip"}, want: "--output-compress"},
+		{name: "http negative timeout", cfg: Config{Outputs: []string{"http://localhost"}, OutputTimeout: -time.Second}, want: "invalid --output-timeout: -1s is negative"},
+		{name: "forward negative timeout", cfg: Config{Outputs: []string{"forward://localhost"}, OutputTimeout: -time.Second}, want: "invalid --output-timeout: -1s is negative"},
+		{name: "group output with otlp", cfg: Config{OTLPEndpoint: "http://localhost:4318", GroupOutput: true}, want: "--group-output"},
+		{name: "namespace with otlp", cfg: Config{OTLPEndpoint: "http://localhost:4318", Namespace: "app"}, want: "--namespace"},
+		{name: "negative flush lines", cfg: Config{FlushLines: -1}, want: "--flush-lines"},
+		{name: "unknown buffer mode", cfg: Config{Buffer: "full"}, want: "--buffer"},
+		{name: "negative buffer size", cfg: Config{BufferSize: -1}, want: "--buffer-size"},
+		{name: "bad dedup window", cfg: Config{DedupWindow: "soon"}, want: "--dedup-window"},
+		{name: "negative reorder window", cfg: Config{ReorderWindow: -time.Second}, want: "--reorder-window"},
+		{name: "negative detect lines", cfg: Config{DetectLines: -1}, want: "invalid --detect-lines: -1 is negative"},
+		{name: "missing exec parser", cfg: Config{ExecParsers: []string{"/nonexistent/parser"}}, want: "--exec-parser"},
+		{name: "exec parser name conflict", cfg: Config{ExecParsers: []string{"/bin/json"}}, want: "--exec-parser"},
+		{name: "file without bench", cfg: Config{BenchFile: "sample.log"}, want: "--file requires the bench command"},
+		{name: "expect without test", cfg: Config{TestExpect: "expect.yaml"}, want: "--input and --expect require the test command"},
+		{name: "negative redetect after", cfg: Config{RedetectAfter: -1}, want: "invalid --redetect-after: -1 is negative"},
+		{name: "redetect after with adaptive", cfg: Config{RedetectAfter: 3, Adaptive: true}, want: "--redetect-after"},
+		{name: "redetect after with format", cfg: Config{RedetectAfter: 3, Format: "json"}, want: "--redetect-after"},
+		{name: "fallback and no fallback", cfg: Config{Fallback: "kv", NoFallback: true}, want: "--no-fallback"},
+		{name: "fallback with format", cfg: Config{Fallback: "kv", Format: "json"}, want: "--fallback"},
+		{name: "unknown fallback", cfg: Config{Fallback: "xml"}, want: "--fallback"},
+		{name: "parsers with format", cfg: Config{Parsers: []string{"kv"}, Format: "kv"}, want: "--parsers"},
+		{name: "unknown parser", cfg: Config{Parsers: []string{"kv", "xml"}}, want: "--parsers"},
+		{name: "negative kv min pairs", cfg: Config{KVMinPairs: -1}, want: "invalid --kv-min-pairs: -1 is negative"},
+		{name: "unknown apache format", cfg: Config{ApacheFormat: "extended"}, want: "--apache-format"},
+		{name: "negative json max depth", cfg: Config{JSONMaxDepth: -1}, want: "invalid --json-max-depth: -1 is negative"},
+		{name: "negative max field bytes", cfg: Config{MaxFieldBytes: -1}, want: "invalid --max-field-bytes: -1 is negative"},
+		{name: "negative max fields", cfg: Config{MaxFields: -1}, want: "invalid --max-fields: -1 is negative"},
+		{name: "missing patterns file", cfg: Config{PatternsFile: t.TempDir() + "/missing.yaml"}, want: "--patterns-file"},
+		{name: "missing formats dir", cfg: Config{FormatsDirs: []string{t.TempDir() + "/missing"}}, want: "format definitions"},
+		{name: "fallback not selected", cfg: Config{Parsers: []string{"kv"}, Fallback: "json"}, want: "--fallback"},
+		{name: "bad color", cfg: Config{Color: "rainbow"}, want: "--color"},
+		{name: "report without schema", cfg: Config{SchemaReport: true}, want: "--report"},
+		{name: "schema with format", cfg: Config{InferSchema: true, OutputFormat: "parquet", ParquetRowGroup: 10}, want: "schema command"},
+		{name: "schema with routes", cfg: Config{InferSchema: true, Routes: []string{"default => stdout"}}, want: "schema command"},
+		{name: "describe with format", cfg: Config{Describe: true, OutputFormat: "cbor"}, want: "describe command"},
+		{name: "negative describe lines", cfg: Config{Describe: true, DescribeLines: -1}, want: "--lines"},
+		{name: "bad output path", cfg: Config{Outputs: []string{t.TempDir() + "/missing/out.ndjson"}}, want: "--output"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, errOut bytes.Buffer
+			err := runPipeline(tt.cfg, strings.NewReader("x"), &out, &errOut)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected %s error, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestParseRoute(t *testing.T) {
+	tests := []struct {
+		spec        string
+		wantDefault bool
+		wantDest    string
+		wantErr     bool
+	}{
+		{spec: `level=="error" => errors.ndjson`, wantDest: "errors.ndjson"},
+		{spec: `default => stdout`, wantDefault: true, wantDest: "stdout"},
+		{spec: `a >= 1 =>out`, wantDest: "out"},
+		{spec: `no arrow`, wantErr: true},
+		{spec: ` => stdout`, wantErr: true},
+		{spec: `level == => stdout`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			e, dest, err := parseRoute(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRoute error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if (e == nil) != tt.wantDefault {
+				t.Errorf("default route = %v, want %v", e == nil, tt.wantDefault)
+			}
+			if dest != tt.wantDest {
+				t.Errorf("dest = %q, want %q", dest, tt.wantDest)
+			}
+		})
+	}
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	type options struct {
+		Format      string
+		Adaptive    bool
+		DetectLines int
+		Fields      string
+		Outputs     []string
+	}
+	tests := []struct {
+		name    string
+		args    []string
+		content string
+		want    options
+		wantErr string
+	}{
+		{
+			name:    "values",
+			content: "format: kv\nadaptive: true\ndetect-lines: 5\nfields: [a, b]\noutput: [x.ndjson, -]\n",
+			want:    options{Format: "kv", Adaptive: true, DetectLines: 5, Fields: "a,b", Outputs: []string{"x.ndjson", "-"}},
+		},
+		{
+			name:    "sections",
+			content: "parser:\n  format: json\noutputs:\n  output: y.ndjson\n",
+			want:    options{Format: "json", DetectLines: 20, Outputs: []string{"y.ndjson"}},
+		},
+		{
+			name:    "flags override the file, under any name",
+			args:    []string{"-f", "syslog", "--output", "z"},
+			content: "format: kv\noutput: [x, y]\ndetect-lines: 7\n",
+			want:    options{Format: "syslog", DetectLines: 7, Outputs: []string{"z"}},
+		},
+		{name: "empty file", content: "# nothing yet\n", want: options{DetectLines: 20}},
+		{name: "unknown option", content: "formatt: kv\n", wantErr: `unknown option "formatt"`},
+		{name: "not allowed", content: "config: other.yaml\n", wantErr: "cannot be set"},
+		{name: "bad value", content: "detect-lines: many\n", wantErr: "detect-lines"},
+		{name: "missing value", content: "format:\n", wantErr: "missing value"},
+		{name: "not a mapping", content: "- format\n", wantErr: "expected a mapping"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got options
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.StringVar(&got.Format, "format", "", "")
+			fs.StringVar(&got.Format, "f", "", "")
+			fs.BoolVar(&got.Adaptive, "adaptive", false, "")
+			fs.IntVar(&got.DetectLines, "detect-lines", 20, "")
+			fs.StringVar(&got.Fields, "fields", "", "")
+			fs.Var((*stringList)(&got.Outputs), "output", "")
+			fs.String("config", "", "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join(t.TempDir(), "log2json.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			err := applyConfigFile(fs, path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyConfigFile() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyConfigFile() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("options = %+v, want %+v", got, tt.want)
+			}
+		})
 	}
 }
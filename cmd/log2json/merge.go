@@ -0,0 +1,176 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+	"github.com/juliosaraiva/log2json/internal/reader"
+	"github.com/juliosaraiva/log2json/internal/transform"
+)
+
+// mergeInput is one file of the merge command: its lines, parsed by a
+// registry of its own, so that each file's format is detected apart, and
+// the line to merge next.
+type mergeInput struct {
+	index    int
+	name     string
+	lines    <-chan reader.Line
+	sample   []reader.Line // read for detection, merged first
+	registry *parser.Registry
+	next     reader.Line
+	at       time.Time // the next line's time, or the last one the file had
+}
+
+// mergeLines reads the merge command's files and returns their lines
+// merged into one stream by their parsed timestamps, each line carrying
+// its parsed entry and the file it came from as _source. Lines of one
+// file keep their order; one without a timestamp takes the time of the
+// line before it. Bytes read are added to read. The returned function
+// stops the files' parsers once the lines have been read.
+func mergeLines(ctx context.Context, cfg Config, read *atomic.Int64, errOutput io.Writer) (<-chan reader.Line, func(), error) {
+	var inputs []*mergeInput
+	var closers []func()
+	closeAll := func() {
+		for _, c := range closers {
+			c()
+		}
+	}
+
+	detectLines := cfg.DetectLines
+	if detectLines == 0 {
+		detectLines = parser.DefaultSampleSize
+	}
+	for i, name := range cfg.MergeFiles {
+		// #nosec G304 -- the files to merge are named by the user
+		f, err := os.Open(name)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("cannot open merge input: %w", err)
+		}
+		closers = append(closers, func() { _ = f.Close() })
+		registry, _, stopParsers, err := buildRegistry(cfg, errOutput)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		closers = append(closers, stopParsers)
+
+		in := &mergeInput{index: i, name: name, registry: registry}
+		in.lines = reader.New(f, reader.WithReadCounter(read)).LinesContext(ctx)
+		if registry.AutoDetects() {
+			sample := sampleLines(in.lines, detectLines, time.Hour)
+			texts := make([]string, 0, len(sample))
+			for _, line := range sample {
+				if line.Err == nil {
+					texts = append(texts, line.Text)
+				}
+			}
+			p := registry.Detect(texts)
+			if p != nil && cfg.Verbose {
+				_, _ = fmt.Fprintf(errOutput, "detected format of %s: %s\n", name, p.Name())
+			}
+			in.sample = sample
+		}
+		inputs = append(inputs, in)
+	}
+
+	lines := make(chan reader.Line)
+	go func() {
+		defer close(lines)
+		var pending mergeHeap
+		now := time.Now()
+		for _, in := range inputs {
+			if in.advance(now) {
+				pending = append(pending, in)
+			}
+		}
+		heap.Init(&pending)
+		for len(pending) > 0 {
+			in := pending[0]
+			select {
+			case lines <- in.next:
+			case <-ctx.Done():
+				return
+			}
+			if in.advance(now) {
+				heap.Fix(&pending, 0)
+			} else {
+				heap.Pop(&pending)
+			}
+		}
+	}()
+	return lines, closeAll, nil
+}
+
+// advance reads and parses the input's next line, reporting false at its
+// end. A read error is passed on as the input's last line, and a parse
+// error as an inputParseError.
+func (in *mergeInput) advance(now time.Time) bool {
+	var line reader.Line
+	if len(in.sample) > 0 {
+		line, in.sample = in.sample[0], in.sample[1:]
+	} else if next, ok := <-in.lines; ok {
+		line = next
+	} else {
+		return false
+	}
+	line.Fields = map[string]any{"_source": in.name}
+	if line.Err == nil {
+		entry, err := in.registry.Parse(line.Text)
+		if err != nil {
+			line.Err = &inputParseError{err: err}
+		} else {
+			line.Entry = entry
+			if t, ok := transform.EntryTime(entry, now); ok {
+				in.at = t
+			}
+		}
+	}
+	in.next = line
+	return true
+}
+
+// inputParseError is the error of a line its input parsed, as merge and
+// --kube-node-logs do with a registry per file, and could not: it counts
+// as a parse error rather than a read error.
+type inputParseError struct {
+	err error
+}
+
+func (e *inputParseError) Error() string {
+	return e.err.Error()
+}
+
+func (e *inputParseError) Unwrap() error {
+	return e.err
+}
+
+// mergeHeap orders inputs by the time of their next line, then by their
+// order on the command line.
+type mergeHeap []*mergeInput
+
+func (h mergeHeap) Len() int { return len(h) }
+
+func (h mergeHeap) Less(i, j int) bool {
+	if !h[i].at.Equal(h[j].at) {
+		return h[i].at.Before(h[j].at)
+	}
+	return h[i].index < h[j].index
+}
+
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *mergeHeap) Push(x any) { *h = append(*h, x.(*mergeInput)) }
+
+func (h *mergeHeap) Pop() any {
+	old := *h
+	in := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return in
+}
@@ -0,0 +1,630 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"text/template"
+
+	"github.com/juliosaraiva/log2json/internal/emitter"
+	"github.com/juliosaraiva/log2json/internal/expr"
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// entrySink receives processed entries: a single emitter or a router.
+type entrySink interface {
+	Emit(entry *parser.Entry) error
+	Close() error
+}
+
+// outputSet opens output destinations on demand, sharing one emitter per
+// destination so several routes can target the same file.
+type outputSet struct {
+	stdout, stderr io.Writer
+	opts           emitter.Options
+	open           func(path string) (io.WriteCloser, error)
+
+	emitters map[string]*emitter.Emitter
+	files    []io.Closer
+}
+
+func newOutputSet(stdout, stderr io.Writer, opts emitter.Options, open func(path string) (io.WriteCloser, error)) *outputSet {
+	return &outputSet{
+		stdout:   stdout,
+		stderr:   stderr,
+		opts:     opts,
+		open:     open,
+		emitters: make(map[string]*emitter.Emitter),
+	}
+}
+
+// emitter returns the emitter for a destination: "stdout" (or "-"),
+// "stderr", or a file path, opened with the set's open function.
+func (o *outputSet) emitter(dest string) (*emitter.Emitter, error) {
+	if dest == "-" {
+		dest = "stdout"
+	}
+	if em, ok := o.emitters[dest]; ok {
+		return em, nil
+	}
+
+	var w io.Writer
+	switch dest {
+	case "stdout":
+		w = o.stdout
+	case "stderr":
+		w = o.stderr
+	default:
+		f, err := o.open(dest)
+		if err != nil {
+			return nil, err
+		}
+		o.files = append(o.files, f)
+		w = f
+	}
+
+	em := emitter.New(w, streamOptions(w, dest != "stdout" && dest != "stderr", o.opts))
+	o.emitters[dest] = em
+	return em, nil
+}
+
+// Close closes files opened by the set. Emitters are flushed by their owner.
+func (o *outputSet) Close() error {
+	var firstErr error
+	for _, f := range o.files {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// outputEnv holds the settings shared by every --output destination.
+type outputEnv struct {
+	cfg       Config
+	stdout    io.Writer
+	errOutput io.Writer
+	emitOpts  emitter.Options
+	avroOpts  []emitter.AvroOption
+	tmpl      *template.Template
+	color     bool           // colorize uncompressed JSON on stdout
+	highlight *regexp.Regexp // with color, --match hits to highlight
+	written   *atomic.Int64  // bytes written to output files, for --stats
+}
+
+// openAll opens every --output destination (stdout if there are none).
+// With several, each entry goes to all of them.
+func (e *outputEnv) openAll() (entrySink, error) {
+	dests := e.cfg.Outputs
+	if len(dests) == 0 {
+		dests = []string{"stdout"}
+	}
+	tee := &teeSink{}
+	for _, dest := range dests {
+		sink, err := e.open(dest)
+		if err != nil {
+			_ = tee.Close()
+			return nil, err
+		}
+		tee.names = append(tee.names, outputName(dest))
+		tee.sinks = append(tee.sinks, sink)
+	}
+	if len(tee.sinks) == 1 {
+		return tee.sinks[0], nil
+	}
+	return tee, nil
+}
+
+// open opens one --output destination: an es://, http(s)://, syslog://
+// or forward:// URL, stdout ("stdout" or "-"), or a file, written in
+// --output-format or through --output-template.
+func (e *outputEnv) open(dest string) (entrySink, error) {
+	switch {
+	case emitter.IsESURL(dest):
+		return newESWriter(e.cfg, dest, e.emitOpts, e.errOutput)
+	case emitter.IsHTTPURL(dest):
+		return newHTTPWriter(e.cfg, dest, e.emitOpts, e.errOutput)
+	case emitter.IsSyslogURL(dest):
+		return newSyslogWriter(e.cfg, dest, e.emitOpts)
+	case emitter.IsForwardURL(dest):
+		return newForwardWriter(e.cfg, dest, e.emitOpts, e.errOutput)
+	}
+
+	w, closers, err := e.writer(dest)
+	if err != nil {
+		return nil, err
+	}
+	opts := streamOptions(w, !isStdout(dest), e.emitOpts)
+	var sink entrySink
+	switch {
+	case e.cfg.Describe:
+		sink = emitter.NewSchemaInferrer(w, opts, emitter.WithFieldDescription())
+	case e.cfg.InferSchema && e.cfg.SchemaReport:
+		sink = emitter.NewSchemaInferrer(w, opts, emitter.WithSchemaReport())
+	case e.cfg.InferSchema:
+		sink = emitter.NewSchemaInferrer(w, opts)
+	case e.tmpl != nil:
+		sink = emitter.NewTemplate(w, opts, e.tmpl)
+	case e.cfg.OutputFormat == "parquet":
+		sink = emitter.NewParquet(w, opts, emitter.WithRowGroupSize(e.cfg.ParquetRowGroup))
+	case e.cfg.OutputFormat == "avro":
+		sink = emitter.NewAvro(w, opts, e.avroOpts...)
+	case e.cfg.OutputFormat == "cbor":
+		sink = emitter.NewCBOR(w, opts)
+	case isStdout(dest) && e.color && e.cfg.OutputCompress == "":
+		opts.Color = true
+		opts.Highlight = e.highlight
+		sink = emitter.New(w, opts)
+	default:
+		sink = emitter.New(w, opts)
+	}
+	return &closingSink{entrySink: sink, closers: closers}, nil
+}
+
+// writer opens stdout or a file, rotated and compressed as configured.
+// The closers must be closed, in order, once writing is done.
+func (e *outputEnv) writer(dest string) (io.Writer, []io.Closer, error) {
+	var w io.Writer
+	var closers []io.Closer
+	if isStdout(dest) {
+		w = e.stdout
+	} else {
+		var f io.WriteCloser
+		var err error
+		if rotate := rotateConfig(e.cfg); rotate.Size > 0 || rotate.Interval > 0 {
+			rotate.Append = e.cfg.OutputAppend
+			f, err = emitter.NewRotatingFile(dest, rotate)
+		} else {
+			f, err = openOutputFile(e.cfg, dest)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot open --output file: %w", err)
+		}
+		w = f
+		if e.written != nil {
+			w = countingWriter{Writer: f, n: e.written}
+		}
+		closers = append(closers, f)
+	}
+
+	if e.cfg.OutputCompress != "" {
+		c, err := emitter.NewCompressor(w, e.cfg.OutputCompress)
+		if err != nil {
+			for _, c := range closers {
+				_ = c.Close()
+			}
+			return nil, nil, err
+		}
+		w = c
+		closers = append([]io.Closer{c}, closers...)
+	}
+	return w, closers, nil
+}
+
+// openOutputFile opens an output file: appended to with --append,
+// replaced once written with --atomic, and otherwise created or
+// truncated.
+func openOutputFile(cfg Config, path string) (io.WriteCloser, error) {
+	if cfg.OutputAtomic {
+		return emitter.NewAtomicFile(path)
+	}
+	return emitter.OpenOutputFile(path, cfg.OutputAppend)
+}
+
+// rotateConfig collects the --rotate-* settings.
+func rotateConfig(cfg Config) emitter.RotateConfig {
+	return emitter.RotateConfig{
+		Size:     cfg.RotateSize,
+		Interval: cfg.RotateInterval,
+		Keep:     cfg.RotateKeep,
+		Compress: cfg.RotateCompress,
+	}
+}
+
+// isStdout reports whether an --output destination names stdout.
+func isStdout(dest string) bool {
+	return dest == "stdout" || dest == "-"
+}
+
+// maxBufferSize bounds --buffer-size.
+const maxBufferSize = 1 << 30
+
+// streamOptions returns opts for an emitter writing to w, a file if file
+// is set: batched flushing (--buffer, --flush-lines, --flush-interval) is
+// off for terminals, where entries should show up at once, and --buffer
+// auto buffers blocks for files, stdout redirected to one included, and
+// lines for the rest. Blocks are flushed at least every --flush-interval,
+// so a live stream to a file still shows up.
+func streamOptions(w io.Writer, file bool, opts emitter.Options) emitter.Options {
+	switch {
+	case isTerminal(w):
+		opts.FlushLines = 0
+		opts.FlushInterval = 0
+		opts.Buffering = emitter.BufferLine
+		return opts
+	case opts.Buffering == "" && (file || isRegularFile(w)):
+		opts.Buffering = emitter.BufferBlock
+	case opts.Buffering == "":
+		opts.Buffering = emitter.BufferLine
+	}
+	if opts.Buffering == emitter.BufferBlock && opts.FlushInterval == 0 {
+		opts.FlushInterval = emitter.DefaultFlushInterval
+	}
+	return opts
+}
+
+// isRegularFile reports whether w is a regular file, for --buffer auto.
+func isRegularFile(w io.Writer) bool {
+	if c, ok := w.(countingWriter); ok {
+		w = c.Writer
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode().IsRegular()
+}
+
+// isTerminal reports whether w is a terminal, for --color=auto.
+func isTerminal(w io.Writer) bool {
+	if c, ok := w.(countingWriter); ok {
+		w = c.Writer
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// outputName describes a destination in messages, without URL
+// credentials.
+func outputName(dest string) string {
+	if u, err := url.Parse(dest); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return dest
+}
+
+// closingSink closes the files and compressors under a sink once the
+// sink has flushed into them.
+type closingSink struct {
+	entrySink
+	closers []io.Closer
+}
+
+// Close flushes the sink, then closes what it writes to.
+func (s *closingSink) Close() error {
+	err := s.entrySink.Close()
+	for _, c := range s.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	s.closers = nil
+	return err
+}
+
+// alertHook acts on the entries matching its conditions: an
+// *alert.Alerter (--alert) or *alert.Webhook (--notify-webhook).
+type alertHook interface {
+	Check(entry *parser.Entry)
+	Close() error
+}
+
+// alertSink passes the entries it writes to alert hooks.
+type alertSink struct {
+	entrySink
+	hooks []alertHook
+}
+
+func (s *alertSink) Emit(entry *parser.Entry) error {
+	for _, h := range s.hooks {
+		h.Check(entry)
+	}
+	return s.entrySink.Emit(entry)
+}
+
+// Close waits for the hooks to finish, then closes the sink.
+func (s *alertSink) Close() error {
+	for _, h := range s.hooks {
+		_ = h.Close()
+	}
+	return s.entrySink.Close()
+}
+
+// teeSink sends every entry to several outputs. A failing output does
+// not stop the others; its errors are reported under its name.
+type teeSink struct {
+	names []string
+	sinks []entrySink
+}
+
+// Emit sends entry to every output.
+func (t *teeSink) Emit(entry *parser.Entry) error {
+	var errs []error
+	for i, sink := range t.sinks {
+		if err := sink.Emit(entry); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t.names[i], err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes every output.
+func (t *teeSink) Close() error {
+	var errs []error
+	for i, sink := range t.sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t.names[i], err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// newOTLPExporter creates the --otlp-endpoint exporter.
+func newOTLPExporter(cfg Config, emitOpts emitter.Options, errOutput io.Writer) (*emitter.OTLPExporter, error) {
+	headers, err := parseHeaders("otlp-header", cfg.OTLPHeaders)
+	if err != nil {
+		return nil, err
+	}
+	batch, err := batchConfig(cfg, errOutput)
+	if err != nil {
+		return nil, err
+	}
+	if err := addOutputAuth(headers, cfg.OutputAuth, false); err != nil {
+		return nil, err
+	}
+	opts := []emitter.OTLPOption{emitter.WithOTLPHeaders(headers)}
+	if cfg.OTLPProtocol != "" {
+		opts = append(opts, emitter.WithOTLPProtocol(cfg.OTLPProtocol))
+	}
+	if cfg.OTLPService != "" {
+		opts = append(opts, emitter.WithOTLPService(cfg.OTLPService))
+	}
+	exporter, err := emitter.NewOTLP(cfg.OTLPEndpoint, emitOpts, batch, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --otlp-endpoint: %w", err)
+	}
+	return exporter, nil
+}
+
+// newESWriter creates the writer for an es:// --output.
+func newESWriter(cfg Config, dest string, emitOpts emitter.Options, errOutput io.Writer) (*emitter.ElasticsearchWriter, error) {
+	batch, err := batchConfig(cfg, errOutput)
+	if err != nil {
+		return nil, err
+	}
+	var opts []emitter.ESOption
+	if cfg.ESAPIKey != "" {
+		key, err := secretValue("es-api-key", cfg.ESAPIKey)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, emitter.WithESAPIKey(key))
+	}
+	if cfg.OutputAuth != "" {
+		headers := make(http.Header)
+		if err := addOutputAuth(headers, cfg.OutputAuth, true); err != nil {
+			return nil, err
+		}
+		opts = append(opts, emitter.WithESHeaders(headers))
+	}
+	writer, err := emitter.NewElasticsearch(dest, emitOpts, batch, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --output: %w", err)
+	}
+	return writer, nil
+}
+
+// newHTTPWriter creates the writer for an http(s):// --output.
+func newHTTPWriter(cfg Config, dest string, emitOpts emitter.Options, errOutput io.Writer) (*emitter.HTTPWriter, error) {
+	headers, err := parseHeaders("output-header", cfg.OutputHeaders)
+	if err != nil {
+		return nil, err
+	}
+	if err := addOutputAuth(headers, cfg.OutputAuth, false); err != nil {
+		return nil, err
+	}
+	if cfg.OutputTimeout < 0 {
+		return nil, fmt.Errorf("invalid --output-timeout: %v is negative", cfg.OutputTimeout)
+	}
+	batch, err := batchConfig(cfg, errOutput)
+	if err != nil {
+		return nil, err
+	}
+	opts := []emitter.HTTPOption{emitter.WithHTTPHeaders(headers), emitter.WithHTTPTimeout(cfg.OutputTimeout)}
+	if cfg.OutputCompress != "" {
+		opts = append(opts, emitter.WithHTTPCompression(cfg.OutputCompress))
+	}
+	writer, err := emitter.NewHTTP(dest, emitOpts, batch, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --output: %w", err)
+	}
+	return writer, nil
+}
+
+// newSyslogWriter connects to a syslog:// --output.
+func newSyslogWriter(cfg Config, dest string, emitOpts emitter.Options) (*emitter.SyslogWriter, error) {
+	var opts []emitter.SyslogOption
+	if cfg.SyslogFacility != "" {
+		facility, err := emitter.ParseSyslogFacility(cfg.SyslogFacility)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --syslog-facility: %w", err)
+		}
+		opts = append(opts, emitter.WithSyslogFacility(facility))
+	}
+	if cfg.SyslogSDID != "" {
+		opts = append(opts, emitter.WithSyslogSDID(cfg.SyslogSDID))
+	}
+	writer, err := emitter.NewSyslog(dest, emitOpts, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --output: %w", err)
+	}
+	return writer, nil
+}
+
+// newForwardWriter connects to a forward:// --output.
+func newForwardWriter(cfg Config, dest string, emitOpts emitter.Options, errOutput io.Writer) (*emitter.ForwardWriter, error) {
+	if cfg.OutputTimeout < 0 {
+		return nil, fmt.Errorf("invalid --output-timeout: %v is negative", cfg.OutputTimeout)
+	}
+	batch, err := batchConfig(cfg, errOutput)
+	if err != nil {
+		return nil, err
+	}
+	opts := []emitter.ForwardOption{emitter.WithForwardTimeout(cfg.OutputTimeout)}
+	if cfg.ForwardTag != "" {
+		tmpl, err := emitter.ParseTemplate(cfg.ForwardTag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --forward-tag: %w", err)
+		}
+		opts = append(opts, emitter.WithForwardTagTemplate(tmpl))
+	}
+	writer, err := emitter.NewForward(dest, emitOpts, batch, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --output: %w", err)
+	}
+	return writer, nil
+}
+
+// parseHeaders parses repeatable 'Name: value' flags.
+func parseHeaders(flagName string, specs []string) (http.Header, error) {
+	headers := make(http.Header)
+	for _, h := range specs {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid --%s %q: want 'Name: value'", flagName, h)
+		}
+		headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return headers, nil
+}
+
+// addOutputAuth sets the header --output-auth sends: Authorization for
+// basic:USER:PASS and bearer:TOKEN, and for api-key:KEY an X-API-Key
+// header, or an Authorization ApiKey one for Elasticsearch (es).
+func addOutputAuth(headers http.Header, spec string, es bool) error {
+	if spec == "" {
+		return nil
+	}
+	scheme, value, _ := strings.Cut(spec, ":")
+	switch scheme {
+	case "basic":
+		user, pass, ok := strings.Cut(value, ":")
+		if !ok || user == "" {
+			return fmt.Errorf("invalid --output-auth: want basic:USER:PASS")
+		}
+		pass, err := secretValue("output-auth", pass)
+		if err != nil {
+			return err
+		}
+		headers.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+pass)))
+	case "bearer", "api-key":
+		secret, err := secretValue("output-auth", value)
+		if err != nil {
+			return err
+		}
+		if secret == "" {
+			return fmt.Errorf("invalid --output-auth: %s needs a value", scheme)
+		}
+		switch {
+		case scheme == "bearer":
+			headers.Set("Authorization", "Bearer "+secret)
+		case es:
+			headers.Set("Authorization", "ApiKey "+secret)
+		default:
+			headers.Set("X-API-Key", secret)
+		}
+	default:
+		return fmt.Errorf("invalid --output-auth %q: want basic:USER:PASS, bearer:TOKEN or api-key:KEY", scheme)
+	}
+	return nil
+}
+
+// secretValue resolves a credential flag: env:NAME is read from the
+// environment and file:PATH from a file, without its trailing newline, so
+// that secrets stay out of the command line; anything else is the value.
+func secretValue(flagName, value string) (string, error) {
+	if name, ok := strings.CutPrefix(value, "env:"); ok {
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("invalid --%s: environment variable %s is not set", flagName, name)
+		}
+		return secret, nil
+	}
+	if path, ok := strings.CutPrefix(value, "file:"); ok {
+		// #nosec G304 -- the secret file is named by the user
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("invalid --%s: %w", flagName, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return value, nil
+}
+
+// batchConfig builds the batching settings shared by network outputs.
+// Failed sends from interval flushes are reported on errOutput.
+func batchConfig(cfg Config, errOutput io.Writer) (emitter.BatchConfig, error) {
+	if cfg.BatchSize < 0 {
+		return emitter.BatchConfig{}, fmt.Errorf("invalid --batch-size: %d is negative", cfg.BatchSize)
+	}
+	batch := emitter.BatchConfig{Size: cfg.BatchSize, Interval: cfg.FlushInterval}
+	if !cfg.Quiet {
+		batch.OnError = func(err error) {
+			_, _ = fmt.Fprintf(errOutput, "output error: %v\n", err)
+		}
+	}
+	return batch, nil
+}
+
+// parseRoute splits a route spec of the form "<expr> => <dest>".
+// The expression "default" matches everything.
+func parseRoute(spec string) (*expr.Expr, string, error) {
+	i := strings.LastIndex(spec, "=>")
+	if i < 0 {
+		return nil, "", fmt.Errorf("expected '<expr> => <destination>', got %q", spec)
+	}
+	cond := strings.TrimSpace(spec[:i])
+	dest := strings.TrimSpace(spec[i+2:])
+	if cond == "" || dest == "" {
+		return nil, "", fmt.Errorf("expected '<expr> => <destination>', got %q", spec)
+	}
+
+	if cond == "default" {
+		return nil, dest, nil
+	}
+	e, err := expr.Compile(cond)
+	if err != nil {
+		return nil, "", err
+	}
+	return e, dest, nil
+}
+
+// buildRouter creates a router from --route specs, opening destinations
+// through outputs.
+func buildRouter(specs []string, outputs *outputSet) (*emitter.Router, error) {
+	routes := make([]emitter.Route, 0, len(specs))
+	for _, spec := range specs {
+		match, dest, err := parseRoute(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --route: %w", err)
+		}
+		em, err := outputs.emitter(dest)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open route destination: %w", err)
+		}
+		routes = append(routes, emitter.Route{Match: match, Dest: em})
+	}
+	return emitter.NewRouter(routes), nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// interruptedError reports a run stopped by SIGINT or SIGTERM. The lines
+// read before the signal were still converted and flushed.
+type interruptedError struct {
+	sig os.Signal
+}
+
+func (e *interruptedError) Error() string {
+	return fmt.Sprintf("interrupted by %s", signalName(e.sig))
+}
+
+// exitStatus is the shell convention for a process ended by a signal:
+// 128 plus the signal number, 130 for SIGINT and 143 for SIGTERM.
+func (e *interruptedError) exitStatus() int {
+	if s, ok := e.sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return exitFailed
+}
+
+func signalName(sig os.Signal) string {
+	switch sig {
+	case os.Interrupt:
+		return "SIGINT"
+	case syscall.SIGTERM:
+		return "SIGTERM"
+	}
+	return sig.String()
+}
+
+// shutdownContext returns a context canceled, with an *interruptedError
+// as its cause, when SIGINT or SIGTERM arrives, so the run can stop
+// reading and flush its outputs. A second signal exits at once, without
+// flushing. The returned function stops listening for signals.
+func shutdownContext(parent context.Context, errOutput io.Writer) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	stopped := make(chan struct{})
+
+	go func() {
+		select {
+		case sig := <-signals:
+			cancel(&interruptedError{sig: sig})
+		case <-stopped:
+			return
+		}
+		select {
+		case sig := <-signals:
+			_, _ = fmt.Fprintf(errOutput, "error: %s again, exiting without flushing output\n", signalName(sig))
+			os.Exit(exitCode(&interruptedError{sig: sig}))
+		case <-stopped:
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		close(stopped)
+		cancel(nil)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// runStats is the end-of-run summary --stats (and --verbose) writes as
+// JSON.
+type runStats struct {
+	Lines   lineStats      `json:"lines"`
+	Formats map[string]int `json:"formats"` // lines parsed, per format
+	Errors  errorStats     `json:"errors"`
+	Parsers []parserStats  `json:"parsers"`
+	Bytes   byteStats      `json:"bytes"`
+
+	ElapsedSeconds float64 `json:"elapsedSeconds"`
+	LinesPerSecond float64 `json:"linesPerSecond"`
+	BytesPerSecond float64 `json:"bytesPerSecond"`
+
+	start    time.Time
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+}
+
+// lineStats counts the input lines by what became of them.
+type lineStats struct {
+	Read    int `json:"read"`
+	Skipped int `json:"skipped"` // by --match
+	Empty   int `json:"empty"`
+	Parsed  int `json:"parsed"`
+}
+
+// errorStats counts the lines that failed, by the stage that failed.
+type errorStats struct {
+	Read   int `json:"read"`
+	Parse  int `json:"parse"` // no format parsed the line
+	Output int `json:"output"`
+}
+
+// parserStats is how many lines a format was given, parsed and failed on.
+type parserStats struct {
+	Name      string `json:"name"`
+	Attempted int64  `json:"attempted"`
+	Matched   int64  `json:"matched"`
+	Failed    int64  `json:"failed"`
+}
+
+// byteStats counts the bytes read from the input and written to stdout
+// and output files, after compression.
+type byteStats struct {
+	In  int64 `json:"in"`
+	Out int64 `json:"out"`
+}
+
+func newRunStats() *runStats {
+	return &runStats{Formats: make(map[string]int), start: time.Now()}
+}
+
+// parsed counts the outcome of parsing a line.
+func (s *runStats) parsed(entry *parser.Entry) {
+	switch {
+	case entry.ParseError == nil:
+		s.Lines.Parsed++
+		s.Formats[entry.Format]++
+	case errors.Is(entry.ParseError, parser.ErrEmptyLine):
+		s.Lines.Empty++
+	default:
+		s.Errors.Parse++
+	}
+}
+
+// encode completes the summary with the registry's parser counts, the
+// byte counts and the timings so far, and returns it as indented JSON.
+func (s *runStats) encode(registry *parser.Registry) ([]byte, error) {
+	s.Parsers = []parserStats{}
+	for _, p := range registry.Stats() {
+		if p.Attempted > 0 {
+			s.Parsers = append(s.Parsers, parserStats(p))
+		}
+	}
+	s.Bytes = byteStats{In: s.bytesIn.Load(), Out: s.bytesOut.Load()}
+
+	elapsed := time.Since(s.start).Seconds()
+	s.ElapsedSeconds = elapsed
+	if elapsed > 0 {
+		s.LinesPerSecond = float64(s.Lines.Read) / elapsed
+		s.BytesPerSecond = float64(s.Bytes.In) / elapsed
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// write writes the summary to w.
+func (s *runStats) write(w io.Writer, registry *parser.Registry) error {
+	data, err := s.encode(registry)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// writeStats writes the summary to the --stats file, or to errOutput.
+func writeStats(cfg Config, stats *runStats, registry *parser.Registry, errOutput io.Writer) error {
+	if cfg.StatsFile == "" {
+		return stats.write(errOutput, registry)
+	}
+	f, err := os.Create(cfg.StatsFile)
+	if err != nil {
+		return fmt.Errorf("cannot write --stats file: %w", err)
+	}
+	if err := stats.write(f, registry); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("cannot write --stats file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("cannot write --stats file: %w", err)
+	}
+	return nil
+}
+
+// countingWriter counts the bytes written through it, for --stats.
+type countingWriter struct {
+	io.Writer
+	n *atomic.Int64
+}
+
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.Writer.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// countingWriteCloser is a countingWriter over a file.
+type countingWriteCloser struct {
+	countingWriter
+	io.Closer
+}
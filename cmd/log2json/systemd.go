@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// systemdListen is the --health-listen and --forward-listen address that
+// takes the listening socket from systemd socket activation instead of
+// opening one.
+const systemdListen = "systemd"
+
+// sdListenFDsStart is the first file descriptor systemd passes to an
+// activated service (a variable for tests).
+var sdListenFDsStart = 3
+
+// sdSockets holds the sockets systemd passed that no listener has taken
+// yet, and their names ($LISTEN_FDNAMES).
+var sdSockets struct {
+	sync.Mutex
+	files []*os.File
+	names []string
+}
+
+// sdNotify sends a state change, such as "READY=1", to the service manager
+// when log2json runs as a systemd service of Type=notify. Without
+// $NOTIFY_SOCKET it does nothing.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// An abstract socket is given with a leading @
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("cannot notify systemd: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("cannot notify systemd: %w", err)
+	}
+	return nil
+}
+
+// sdWatchdogInterval returns how often systemd expects a keep-alive with
+// WatchdogSec= set: half its timeout, as sd_watchdog_enabled advises. It
+// returns 0 when the watchdog is off or meant for another process.
+func sdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// sdListener returns a listening socket passed by systemd socket
+// activation ($LISTEN_FDS, for this process's $LISTEN_PID): the one named
+// name with FileDescriptorName=, or else the first not taken yet, so that
+// --health-listen and --forward-listen can each have one. The variables
+// are cleared, so child processes don't take the sockets as theirs.
+func sdListener(name string) (net.Listener, error) {
+	sdSockets.Lock()
+	defer sdSockets.Unlock()
+	if n, ok := os.LookupEnv("LISTEN_FDS"); ok {
+		count, _ := strconv.Atoi(n)
+		pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID"))
+		names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+		if pid == os.Getpid() {
+			for i := 0; i < count; i++ {
+				fd := sdListenFDsStart + i
+				sdSockets.files = append(sdSockets.files, os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd)))
+				if i < len(names) {
+					sdSockets.names = append(sdSockets.names, names[i])
+				} else {
+					sdSockets.names = append(sdSockets.names, "")
+				}
+			}
+		}
+	}
+
+	i := slices.Index(sdSockets.names, name)
+	if i < 0 || sdSockets.files[i] == nil {
+		i = slices.IndexFunc(sdSockets.files, func(f *os.File) bool { return f != nil })
+	}
+	if i < 0 {
+		return nil, fmt.Errorf("no socket passed by systemd socket activation")
+	}
+	f := sdSockets.files[i]
+	sdSockets.files[i] = nil
+	defer func() { _ = f.Close() }()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("socket passed by systemd: %w", err)
+	}
+	return l, nil
+}
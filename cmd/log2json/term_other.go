@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !freebsd
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// makeRaw reports that the dev command's terminal UI is unavailable.
+func makeRaw(fd int) (func(), error) {
+	return nil, fmt.Errorf("the dev command is not supported on %s", runtime.GOOS)
+}
+
+// terminalSize reports that the terminal size is unknown.
+func terminalSize(fd int) (width, height int, err error) {
+	return 0, 0, fmt.Errorf("terminal size is not available on %s", runtime.GOOS)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+	"github.com/juliosaraiva/log2json/internal/reader"
+	"github.com/juliosaraiva/log2json/internal/yaml"
+)
+
+// lineExpectation is what an --expect file expects of one input line:
+// that it does not parse, or the values of some of its fields (nil for
+// fields that must be absent).
+type lineExpectation struct {
+	noMatch bool
+	fields  map[string]any
+}
+
+// runTestCommand parses the --input sample (or the whole input) with the
+// parser options and reports, line by line, the format that matched and
+// the fields it extracted. With --expect, it also compares them with the
+// expected values and fails if any differ.
+func runTestCommand(cfg Config, input io.Reader, output io.Writer, errOutput io.Writer) error {
+	var expect map[int]lineExpectation
+	if cfg.TestExpect != "" {
+		var err error
+		if expect, err = loadExpectations(cfg.TestExpect); err != nil {
+			return fmt.Errorf("invalid --expect: %w", err)
+		}
+	}
+
+	if cfg.TestInput != "" {
+		f, err := os.Open(cfg.TestInput)
+		if err != nil {
+			return fmt.Errorf("cannot open --input: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		input = f
+	}
+	lines, err := reader.New(input).ReadAll()
+	if err != nil {
+		return fmt.Errorf("cannot read test input: %w", err)
+	}
+
+	registry, _, closeParsers, err := buildRegistry(cfg, errOutput)
+	if err != nil {
+		return err
+	}
+	defer closeParsers()
+	if registry.AutoDetects() {
+		texts := make([]string, len(lines))
+		for i, line := range lines {
+			texts[i] = line.Text
+		}
+		registry.Detect(texts)
+	}
+
+	matched, passed, failed := 0, 0, 0
+	for _, line := range lines {
+		entry, err := registry.Parse(line.Text)
+		if err != nil {
+			return err
+		}
+		if entry.ParseError == nil {
+			matched++
+			_, _ = fmt.Fprintf(output, "line %d: matched %s\n", line.Number, entry.Format)
+			for _, k := range sortedKeys(entry.Fields) {
+				_, _ = fmt.Fprintf(output, "    %s = %s\n", k, jsonText(entry.Fields[k]))
+			}
+		} else {
+			_, _ = fmt.Fprintf(output, "line %d: no match (%v)\n    %s\n", line.Number, entry.ParseError, line.Text)
+		}
+
+		want, ok := expect[line.Number]
+		if !ok {
+			continue
+		}
+		if diffs := diffExpectation(entry, want); len(diffs) > 0 {
+			failed++
+			_, _ = fmt.Fprintf(output, "  FAIL\n")
+			for _, d := range diffs {
+				_, _ = fmt.Fprintf(output, "    %s\n", d)
+			}
+		} else {
+			passed++
+		}
+	}
+
+	// Expectations for lines past the end of the input
+	var missing []int
+	for n := range expect {
+		if n > len(lines) {
+			missing = append(missing, n)
+		}
+	}
+	sort.Ints(missing)
+	for _, n := range missing {
+		failed++
+		_, _ = fmt.Fprintf(output, "line %d: FAIL\n    expected, but the input has %d lines\n", n, len(lines))
+	}
+
+	_, _ = fmt.Fprintf(output, "\n%d lines: %d matched, %d not matched\n", len(lines), matched, len(lines)-matched)
+	if expect != nil {
+		_, _ = fmt.Fprintf(output, "expectations: %d passed, %d failed\n", passed, failed)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d expectations failed", failed, passed+failed)
+	}
+	return nil
+}
+
+// loadExpectations reads an --expect file, a lines: map from line
+// numbers to the fields expected of them, or to false for lines that
+// must not parse:
+//
+//	lines:
+//	  1:
+//	    level: INFO
+//	    status: 200
+//	  2: false
+func loadExpectations(path string) (map[int]lineExpectation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := yaml.Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	root, ok := doc.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected a mapping with a lines key", path)
+	}
+	for key := range root {
+		if key != "lines" {
+			return nil, fmt.Errorf("%s: unknown key %q", path, key)
+		}
+	}
+	defs, ok := root["lines"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: lines must map line numbers to fields", path)
+	}
+
+	expect := make(map[int]lineExpectation, len(defs))
+	for key, def := range defs {
+		n, err := strconv.Atoi(key)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%s: %q is not a line number", path, key)
+		}
+		switch def := def.(type) {
+		case bool:
+			if def {
+				return nil, fmt.Errorf("%s: line %d: expected fields or false", path, n)
+			}
+			expect[n] = lineExpectation{noMatch: true}
+		case map[string]any:
+			expect[n] = lineExpectation{fields: def}
+		default:
+			return nil, fmt.Errorf("%s: line %d: expected fields or false", path, n)
+		}
+	}
+	return expect, nil
+}
+
+// diffExpectation describes how entry differs from want.
+func diffExpectation(entry *parser.Entry, want lineExpectation) []string {
+	if want.noMatch {
+		if entry.ParseError == nil {
+			return []string{fmt.Sprintf("matched %s, want no match", entry.Format)}
+		}
+		return nil
+	}
+	if entry.ParseError != nil {
+		return []string{fmt.Sprintf("no match, want fields %s", jsonText(want.fields))}
+	}
+
+	var diffs []string
+	for _, k := range sortedKeys(want.fields) {
+		got, present := entry.Fields[k]
+		switch {
+		case want.fields[k] == nil && present:
+			diffs = append(diffs, fmt.Sprintf("%s: got %s, want no field", k, jsonText(got)))
+		case want.fields[k] == nil:
+		case !present:
+			diffs = append(diffs, fmt.Sprintf("%s: missing, want %s", k, jsonText(want.fields[k])))
+		case !reflect.DeepEqual(normalizeNumbers(got), normalizeNumbers(want.fields[k])):
+			diffs = append(diffs, fmt.Sprintf("%s: got %s, want %s", k, jsonText(got), jsonText(want.fields[k])))
+		}
+	}
+	return diffs
+}
+
+// normalizeNumbers converts every number in v to float64, so that values
+// compare equal whether YAML, JSON or type inference produced them.
+func normalizeNumbers(v any) any {
+	switch v := v.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return v.String()
+		}
+		return f
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = normalizeNumbers(item)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[k] = normalizeNumbers(item)
+		}
+		return out
+	}
+	return v
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// jsonText formats a value as compact JSON.
+func jsonText(v any) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// defaultTopInterval is how often the top command redraws its ranking.
+const defaultTopInterval = 2 * time.Second
+
+// maxTopValues bounds the values the top command ranks: entries with
+// further values are counted together, as topOther.
+const maxTopValues = 10000
+
+// topOther is the row of the values past maxTopValues.
+const topOther = "(other)"
+
+// topPlainRows is how many values the top command prints when stderr is
+// not a terminal, whose height would set it.
+const topPlainRows = 10
+
+// topBoard counts the entries written by the value of a field, for the
+// top command's ranking. It is safe for concurrent use: the pipeline
+// adds entries while the ranking is drawn.
+type topBoard struct {
+	field string
+	now   func() time.Time
+
+	mu      sync.Mutex
+	values  map[string]*topValue
+	total   int64
+	missing int64 // entries without the field
+	start   time.Time
+	last    time.Time // when the ranking was last drawn
+	prev    int64     // total when it was
+}
+
+// topValue is a value's count, and what it was when the ranking was last
+// drawn, for its rate.
+type topValue struct {
+	name        string
+	count, prev int64
+}
+
+func newTopBoard(field string) *topBoard {
+	b := &topBoard{field: field, now: time.Now, values: make(map[string]*topValue)}
+	b.start = b.now()
+	b.last = b.start
+	return b
+}
+
+// add counts an entry.
+func (b *topBoard) add(entry *parser.Entry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.total++
+	v, ok := entry.Fields[b.field]
+	if !ok || v == nil {
+		b.missing++
+		return
+	}
+	name := fmt.Sprint(v)
+	tv := b.values[name]
+	if tv == nil {
+		if len(b.values) >= maxTopValues {
+			name = topOther
+			tv = b.values[name]
+		}
+		if tv == nil {
+			tv = &topValue{name: name}
+			b.values[name] = tv
+		}
+	}
+	tv.count++
+}
+
+// render draws the ranking: a header with the totals, then up to rows
+// values, most frequent first, with their counts, rates per second since
+// the last drawing and shares of the entries. Lines are cut to width
+// runes, if it is positive.
+func (b *topBoard) render(w io.Writer, rows, width int) error {
+	b.mu.Lock()
+	now := b.now()
+	elapsed := now.Sub(b.start)
+	since := now.Sub(b.last).Seconds()
+	rate := func(n, prev int64) float64 {
+		if since <= 0 {
+			return 0
+		}
+		return float64(n-prev) / since
+	}
+	ranked := make([]topValue, 0, len(b.values))
+	rates := make(map[string]float64, len(b.values))
+	for _, v := range b.values {
+		ranked = append(ranked, *v)
+		rates[v.name] = rate(v.count, v.prev)
+		v.prev = v.count
+	}
+	total, missing, totalRate := b.total, b.missing, rate(b.total, b.prev)
+	b.last, b.prev = now, b.total
+	b.mu.Unlock()
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].count != ranked[j].count {
+			return ranked[i].count > ranked[j].count
+		}
+		return ranked[i].name < ranked[j].name
+	})
+
+	var out bytes.Buffer
+	line := func(s string) {
+		if width > 0 {
+			s = truncate(s, width)
+		}
+		out.WriteString(s + "\n")
+	}
+	header := fmt.Sprintf("log2json top by %s: %d entries, %.1f/s, %d values, %s", b.field, total, totalRate, len(ranked), elapsed.Truncate(time.Second))
+	if missing > 0 {
+		header += fmt.Sprintf(" (%d without %s)", missing, b.field)
+	}
+	line(header)
+	line(fmt.Sprintf("%10s %10s %7s  %s", "COUNT", "RATE/s", "SHARE", strings.ToUpper(b.field)))
+	for i, v := range ranked {
+		if i >= rows {
+			break
+		}
+		share := 0.0
+		if total > 0 {
+			share = 100 * float64(v.count) / float64(total)
+		}
+		line(fmt.Sprintf("%10d %10.1f %6.1f%%  %s", v.count, rates[v.name], share, v.name))
+	}
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// topSink counts the entries it passes to the outputs on a topBoard.
+type topSink struct {
+	entrySink
+	board *topBoard
+}
+
+func (s *topSink) Emit(entry *parser.Entry) error {
+	s.board.add(entry)
+	return s.entrySink.Emit(entry)
+}
+
+// discardSink drops entries, for the top command without an --output.
+type discardSink struct{}
+
+func (discardSink) Emit(*parser.Entry) error { return nil }
+func (discardSink) Close() error             { return nil }
+
+// startTop draws the board's ranking on screen every interval until the
+// returned function is called, which draws it a last time. On a terminal
+// the ranking is redrawn in place, on the alternate screen, sized to the
+// terminal, and the last one is left on the normal screen; otherwise each
+// is printed after the one before, with the top topPlainRows values.
+func startTop(board *topBoard, screen io.Writer, interval time.Duration) func() {
+	f, _ := screen.(*os.File)
+	live := f != nil && isTerminal(f)
+	size := func() (rows, width int) {
+		if !live {
+			return topPlainRows, 0
+		}
+		width, height, err := terminalSize(int(f.Fd()))
+		if err != nil {
+			return 20, 80
+		}
+		return max(height-3, 1), width
+	}
+	draw := func() {
+		rows, width := size()
+		if live {
+			_, _ = io.WriteString(screen, "\x1b[H\x1b[2J")
+		}
+		_ = board.render(screen, rows, width)
+		if !live {
+			_, _ = io.WriteString(screen, "\n")
+		}
+	}
+
+	if live {
+		_, _ = io.WriteString(screen, "\x1b[?1049h") // alternate screen
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				draw()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		if live {
+			_, _ = io.WriteString(screen, "\x1b[?1049l")
+			live = false
+		}
+		draw()
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/juliosaraiva/log2json/internal/emitter"
+	"github.com/juliosaraiva/log2json/internal/expr"
+	"github.com/juliosaraiva/log2json/internal/parser"
+	"github.com/juliosaraiva/log2json/internal/script"
+	"github.com/juliosaraiva/log2json/internal/transform"
+	"github.com/juliosaraiva/log2json/internal/wasm"
+)
+
+// buildTransforms assembles the transform chain from the CLI configuration.
+// Stages run in a fixed order regardless of flag order on the command line:
+// duplicate lines are dropped and entries reordered first, then type
+// coercion and schema validation, split and explode, redaction,
+// enrichment, the user script and plugin, filters, size limits, and last
+// the --histogram distributions or --query rows that replace the entries.
+// Entries rejected by the schema are written to rejects with a
+// _schemaError field; script print() output goes to errOutput. plugin may
+// be nil.
+func buildTransforms(cfg Config, rejects *emitter.Emitter, plugin *wasm.Plugin, errOutput io.Writer) (*transform.Chain, error) {
+	chain := transform.NewChain()
+
+	// Redelivered and out-of-order lines (before any work is spent on
+	// them, and so that later stages see entries in order)
+	if cfg.DedupWindow != "" {
+		d, err := transform.NewWindowDedup(cfg.DedupWindow)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --dedup-window: %w", err)
+		}
+		chain.Add(d)
+	}
+
+	if cfg.ReorderWindow < 0 {
+		return nil, fmt.Errorf("invalid --reorder-window: %v is negative", cfg.ReorderWindow)
+	}
+	if cfg.ReorderWindow > 0 {
+		chain.Add(transform.NewReorderer(cfg.ReorderWindow))
+	}
+
+	// Type coercion and validation (so filters compare the forced types)
+	if cfg.Types != "" {
+		c, err := transform.NewTypeCoercer(cfg.Types)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --types: %w", err)
+		}
+		chain.Add(c)
+	}
+	if cfg.ParseUnits || len(cfg.ParseUnitFields) > 0 {
+		chain.Add(transform.NewUnitParser(cfg.ParseUnitFields...))
+	}
+	if cfg.Schema != "" {
+		schema, err := transform.LoadSchema(cfg.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --schema: %w", err)
+		}
+		reject := func(e *parser.Entry, violations []string) {
+			e.Fields["_schemaError"] = strings.Join(violations, "; ")
+			if rejects != nil {
+				_ = rejects.Emit(e)
+			}
+		}
+		chain.Add(transform.NewSchemaValidator(schema, reject))
+	}
+
+	// Reshaping (so enrichment and filters see each record)
+	for _, spec := range cfg.SplitFields {
+		sp, err := transform.NewSplitter(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --split-field: %w", err)
+		}
+		chain.Add(sp)
+	}
+	if cfg.Explode != "" {
+		chain.Add(transform.NewExploder(cfg.Explode))
+	}
+
+	// Redaction (before enrichment and user code, so that nothing they
+	// copy or derive from a redacted field carries its original value)
+	if cfg.AnonymizeIP != "" {
+		a, err := transform.NewIPAnonymizer(cfg.AnonymizeIP)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --anonymize-ip: %w", err)
+		}
+		chain.Add(a)
+	}
+	if cfg.HashFields != "" {
+		spec, err := hashSpec(cfg.HashFields)
+		if err != nil {
+			return nil, err
+		}
+		h, err := transform.NewHasher(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --hash-fields: %w", err)
+		}
+		chain.Add(h)
+	}
+
+	// Enrichment
+	for _, spec := range cfg.Lookups {
+		l, err := transform.NewLookup(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --lookup: %w", err)
+		}
+		chain.Add(l)
+	}
+	if len(cfg.ClassifyIP) > 0 {
+		var opts []transform.IPOption
+		if cfg.RDNS {
+			opts = append(opts, transform.WithReverseDNS(cfg.RDNSTimeout, cfg.RDNSConcurrency))
+		}
+		chain.Add(transform.NewIPClassifier(cfg.ClassifyIP, opts...))
+	}
+	for _, spec := range cfg.Derives {
+		d, err := transform.NewDerive(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --derive: %w", err)
+		}
+		chain.Add(d)
+	}
+	if cfg.Correlate != "" {
+		opts := []transform.CorrelateOption{transform.WithIdleTimeout(cfg.CorrelateIdle)}
+		if cfg.CorrelateSummary {
+			opts = append(opts, transform.WithSummaries())
+		}
+		chain.Add(transform.NewCorrelator(cfg.Correlate, opts...))
+	}
+	if cfg.MineTemplates != "" {
+		if cfg.MineSimilarity <= 0 || cfg.MineSimilarity > 1 {
+			return nil, fmt.Errorf("invalid --mine-similarity: %v is not in (0, 1]", cfg.MineSimilarity)
+		}
+		chain.Add(transform.NewTemplateMiner(cfg.MineTemplates, cfg.MineSimilarity))
+	}
+
+	// User code (sees enriched fields; --where can test what it derives)
+	if cfg.Script != "" {
+		printFn := func(s string) { _, _ = fmt.Fprintln(errOutput, s) }
+		sc, err := transform.NewScript(cfg.Script, script.WithPrint(printFn))
+		if err != nil {
+			return nil, fmt.Errorf("invalid --script: %w", err)
+		}
+		chain.Add(sc)
+	}
+	if plugin != nil && plugin.HasTransform() {
+		w, err := transform.NewWasm(plugin)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --wasm-plugin: %w", err)
+		}
+		chain.Add(w)
+	}
+
+	// Filters; with --context, --match is applied here too, so that the
+	// lines around a match are parsed
+	var where *expr.Expr
+	if cfg.Where != "" {
+		e, err := expr.Compile(cfg.Where)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --where expression: %w", err)
+		}
+		where = e
+	}
+	switch {
+	case cfg.Context < 0:
+		return nil, fmt.Errorf("invalid --context: %d is negative", cfg.Context)
+	case cfg.Context > 0:
+		if cfg.Match == "" && where == nil {
+			return nil, fmt.Errorf("--context requires --match or --where")
+		}
+		var re *regexp.Regexp
+		if cfg.Match != "" {
+			var err error
+			if re, err = regexp.Compile(cfg.Match); err != nil {
+				return nil, fmt.Errorf("invalid --match regex: %w", err)
+			}
+		}
+		chain.Add(transform.NewContext(func(e *parser.Entry) bool {
+			if re != nil && re.MatchString(e.Raw) == cfg.InvertMatch {
+				return false
+			}
+			return where == nil || where.Match(e.Fields)
+		}, cfg.Context))
+	case where != nil:
+		chain.Add(transform.NewFilter(where))
+	}
+	if cfg.MinLevel != "" {
+		m, err := transform.NewMinLevel(cfg.MinLevel)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --min-level: %w", err)
+		}
+		chain.Add(m)
+	}
+	if cfg.SampleBy != "" {
+		smp, err := transform.NewKeySampler(cfg.SampleBy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --sample-by: %w", err)
+		}
+		chain.Add(smp)
+	}
+	if cfg.RateLimitBy != "" {
+		rl, err := transform.NewRateLimiter(cfg.RateLimitBy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --rate-limit-by: %w", err)
+		}
+		chain.Add(rl)
+	}
+	if cfg.DedupConsec {
+		chain.Add(transform.NewConsecutiveDedup())
+	}
+
+	// Size limits
+	if cfg.MaxFieldBytes < 0 {
+		return nil, fmt.Errorf("invalid --max-field-bytes: %d is negative", cfg.MaxFieldBytes)
+	}
+	if cfg.MaxFields < 0 {
+		return nil, fmt.Errorf("invalid --max-fields: %d is negative", cfg.MaxFields)
+	}
+	if cfg.MaxFieldBytes > 0 || cfg.MaxFields > 0 {
+		chain.Add(transform.NewTruncator(cfg.MaxFieldBytes, cfg.MaxFields))
+	}
+
+	// Distributions and queries (last, so they cover the entries that
+	// would be written)
+	switch {
+	case cfg.Histogram != "" && cfg.Query != "":
+		return nil, fmt.Errorf("--histogram cannot be combined with --query")
+	case cfg.Percentiles != "" && cfg.Histogram == "":
+		return nil, fmt.Errorf("--percentiles requires --histogram")
+	case cfg.Window != 0 && cfg.Histogram == "" && cfg.Query == "":
+		return nil, fmt.Errorf("--window requires --histogram or --query")
+	case cfg.Window < 0:
+		return nil, fmt.Errorf("invalid --window: %v is negative", cfg.Window)
+	}
+	if cfg.Histogram != "" {
+		h, err := transform.NewHistogram(cfg.Histogram, cfg.Percentiles, cfg.Window)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --histogram: %w", err)
+		}
+		chain.Add(h)
+	}
+	if cfg.Query != "" {
+		q, err := transform.NewQuery(cfg.Query, cfg.Window)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --query: %w", err)
+		}
+		chain.Add(q)
+	}
+
+	return chain, nil
+}
+
+// hashSpec resolves the salt of a --hash-fields spec, which, as a secret,
+// may be written env:NAME or file:PATH.
+func hashSpec(spec string) (string, error) {
+	fields, rest, _ := strings.Cut(spec, ":")
+	algo, salt, ok := strings.Cut(rest, ":")
+	if !ok {
+		return spec, nil
+	}
+	salt, err := secretValue("hash-fields", salt)
+	if err != nil {
+		return "", err
+	}
+	return fields + ":" + algo + ":" + salt, nil
+}
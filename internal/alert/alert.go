@@ -0,0 +1,265 @@
+// Package alert acts on entries matching a condition: it runs commands,
+// for --alert, and calls webhooks, for --notify-webhook. Each alert rule
+// is limited to a number of runs per interval, and to one run at a time,
+// so that a flood of matching entries cannot start a flood of processes;
+// webhook requests are queued, and dropped when the queue is full.
+package alert
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/expr"
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// DefaultRate is the runs per interval a rule is allowed by default.
+const DefaultRate = "10/m"
+
+// Timeout bounds each run of a command: it is killed after this long.
+const Timeout = time.Minute
+
+// Rule is an alert rule: a condition and the command run for entries
+// matching it.
+type Rule struct {
+	match   *expr.Expr
+	command []string
+
+	mu      sync.Mutex
+	start   time.Time // start of the current rate window
+	runs    int       // runs in the current window
+	running bool
+	skipped int // matches not run for since the last run
+}
+
+// ParseRule parses a rule of the form "<expr> => <command>". The command
+// is a program and its arguments, separated by spaces; it is not run by
+// a shell.
+func ParseRule(spec string) (*Rule, error) {
+	i := strings.LastIndex(spec, "=>")
+	if i < 0 {
+		return nil, fmt.Errorf("expected '<expr> => <command>', got %q", spec)
+	}
+	cond := strings.TrimSpace(spec[:i])
+	command := strings.Fields(spec[i+2:])
+	if cond == "" || len(command) == 0 {
+		return nil, fmt.Errorf("expected '<expr> => <command>', got %q", spec)
+	}
+	e, err := expr.Compile(cond)
+	if err != nil {
+		return nil, err
+	}
+	return &Rule{match: e, command: command}, nil
+}
+
+// Alerter checks entries against its rules and runs the commands of
+// those they match, in the background. Each command gets the entry, as
+// encoded by the encode function, on stdin, and the variables
+// LOG2JSON_ALERT (the rule's condition) and LOG2JSON_ALERT_SKIPPED (how
+// many matches were not run for since its last run). Its output goes to
+// stderr.
+type Alerter struct {
+	rules    []*Rule
+	limit    int
+	interval time.Duration
+	encode   func(*parser.Entry) ([]byte, error)
+	stderr   io.Writer
+	quiet    bool
+	now      func() time.Time
+
+	wg sync.WaitGroup
+	mu sync.Mutex // serializes writes to stderr
+}
+
+// Option configures an Alerter.
+type Option func(*Alerter)
+
+// WithQuiet leaves out the warnings about failed and skipped runs.
+func WithQuiet() Option {
+	return func(a *Alerter) { a.quiet = true }
+}
+
+// New creates an Alerter from rule specs (see ParseRule) and a rate of
+// the form "N/interval" (e.g. "10/m", "1/30s"), the runs each rule is
+// allowed per interval; an empty rate is DefaultRate. Warnings and the
+// commands' output go to stderr.
+func New(specs []string, rate string, encode func(*parser.Entry) ([]byte, error), stderr io.Writer, opts ...Option) (*Alerter, error) {
+	if rate == "" {
+		rate = DefaultRate
+	}
+	limit, interval, err := parseRate(rate)
+	if err != nil {
+		return nil, err
+	}
+	a := &Alerter{
+		limit:    limit,
+		interval: interval,
+		encode:   encode,
+		stderr:   stderr,
+		now:      time.Now,
+	}
+	for _, spec := range specs {
+		r, err := ParseRule(spec)
+		if err != nil {
+			return nil, err
+		}
+		a.rules = append(a.rules, r)
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a, nil
+}
+
+// parseRate parses "N/interval", where interval is s, m, h or a Go
+// duration.
+func parseRate(rate string) (int, time.Duration, error) {
+	num, unit, ok := strings.Cut(strings.TrimSpace(rate), "/")
+	limit, err := strconv.Atoi(num)
+	if !ok || err != nil || limit < 1 {
+		return 0, 0, fmt.Errorf("invalid rate %q (expected N/interval, e.g. 10/m)", rate)
+	}
+	var interval time.Duration
+	switch unit {
+	case "s", "sec":
+		interval = time.Second
+	case "m", "min":
+		interval = time.Minute
+	case "h":
+		interval = time.Hour
+	default:
+		interval, err = time.ParseDuration(unit)
+		if err != nil || interval <= 0 {
+			return 0, 0, fmt.Errorf("invalid interval %q", unit)
+		}
+	}
+	return limit, interval, nil
+}
+
+// Check runs the commands of the rules the entry matches, unless their
+// rate is spent or they are still running, in which case the match is
+// counted as skipped. It does not wait for the commands.
+func (a *Alerter) Check(entry *parser.Entry) {
+	var stdin []byte
+	for _, r := range a.rules {
+		if !r.match.Match(entry.Fields) {
+			continue
+		}
+		skipped, ok := a.claim(r)
+		if !ok {
+			continue
+		}
+		if stdin == nil {
+			data, err := a.encode(entry)
+			if err != nil {
+				a.release(r)
+				a.warn("alert %q: %v", r.match.String(), err)
+				continue
+			}
+			stdin = data
+		}
+		a.wg.Add(1)
+		go a.run(r, stdin, skipped)
+	}
+}
+
+// claim reserves a run of r, returning the matches skipped since its last
+// run, or false if r is running or its rate is spent.
+func (a *Alerter) claim(r *Rule) (int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := a.now()
+	if now.Sub(r.start) >= a.interval {
+		r.start, r.runs = now, 0
+	}
+	if r.running || r.runs >= a.limit {
+		r.skipped++
+		return 0, false
+	}
+	r.runs++
+	r.running = true
+	skipped := r.skipped
+	r.skipped = 0
+	return skipped, true
+}
+
+// release marks r as no longer running.
+func (a *Alerter) release(r *Rule) {
+	r.mu.Lock()
+	r.running = false
+	r.mu.Unlock()
+}
+
+// run runs r's command with stdin and reports if it fails.
+func (a *Alerter) run(r *Rule, stdin []byte, skipped int) {
+	defer a.wg.Done()
+	defer a.release(r)
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, r.command[0], r.command[1:]...) // #nosec G204 -- command is supplied by the user
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = a.output()
+	cmd.Stderr = a.output()
+	cmd.WaitDelay = time.Second // for children left holding its output
+	cmd.Env = append(os.Environ(),
+		"LOG2JSON_ALERT="+r.match.String(),
+		"LOG2JSON_ALERT_SKIPPED="+strconv.Itoa(skipped),
+	)
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("killed after %v", Timeout)
+		}
+		a.warn("alert %q: %s: %v", r.match.String(), r.command[0], err)
+	}
+}
+
+// output is where commands write, shared with the warnings.
+func (a *Alerter) output() io.Writer {
+	return lockedWriter{mu: &a.mu, w: a.stderr}
+}
+
+// Close waits for the commands that are running, then warns about the
+// rules whose last matches were skipped. It may be called more than once.
+func (a *Alerter) Close() error {
+	a.wg.Wait()
+	for _, r := range a.rules {
+		r.mu.Lock()
+		skipped := r.skipped
+		r.skipped = 0
+		r.mu.Unlock()
+		if skipped > 0 {
+			a.warn("alert %q: %d matches skipped (command running or rate spent)", r.match.String(), skipped)
+		}
+	}
+	return nil
+}
+
+func (a *Alerter) warn(format string, args ...any) {
+	if a.quiet {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, _ = fmt.Fprintf(a.stderr, "warning: "+format+"\n", args...)
+}
+
+// lockedWriter serializes writes to w.
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
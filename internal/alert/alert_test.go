@@ -0,0 +1,145 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func encodeJSON(e *parser.Entry) ([]byte, error) {
+	return json.Marshal(e.Fields)
+}
+
+func entry(level string) *parser.Entry {
+	e := parser.NewEntry("")
+	e.Fields["level"] = level
+	return e
+}
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		spec    string
+		command []string
+		wantErr string
+	}{
+		{spec: `level == "fatal" => ./notify.sh --channel ops`, command: []string{"./notify.sh", "--channel", "ops"}},
+		{spec: `status >= 500=>page`, command: []string{"page"}},
+		{spec: `level == "fatal"`, wantErr: "expected"},
+		{spec: `=> ./notify.sh`, wantErr: "expected"},
+		{spec: `level == "fatal" =>  `, wantErr: "expected"},
+		{spec: `level === 1 => x`, wantErr: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			r, err := ParseRule(tt.spec)
+			if tt.command == nil {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseRule() error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRule() error: %v", err)
+			}
+			if strings.Join(r.command, " ") != strings.Join(tt.command, " ") {
+				t.Errorf("command = %q, want %q", r.command, tt.command)
+			}
+		})
+	}
+}
+
+func TestNew_Rate(t *testing.T) {
+	tests := []struct {
+		rate     string
+		limit    int
+		interval time.Duration
+		wantErr  bool
+	}{
+		{rate: "", limit: 10, interval: time.Minute},
+		{rate: "1/s", limit: 1, interval: time.Second},
+		{rate: "3/30s", limit: 3, interval: 30 * time.Second},
+		{rate: "2/h", limit: 2, interval: time.Hour},
+		{rate: "0/m", wantErr: true},
+		{rate: "5", wantErr: true},
+		{rate: "5/fortnight", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rate, func(t *testing.T) {
+			a, err := New(nil, tt.rate, encodeJSON, &bytes.Buffer{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (a.limit != tt.limit || a.interval != tt.interval) {
+				t.Errorf("rate = %d/%v, want %d/%v", a.limit, a.interval, tt.limit, tt.interval)
+			}
+		})
+	}
+}
+
+func TestAlerter_Claim(t *testing.T) {
+	a, err := New([]string{"true => true"}, "2/m", encodeJSON, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return clock }
+	r := a.rules[0]
+
+	if _, ok := a.claim(r); !ok {
+		t.Fatal("first match was not run")
+	}
+	if _, ok := a.claim(r); ok {
+		t.Error("a match was run while the command was running")
+	}
+	a.release(r)
+	if skipped, ok := a.claim(r); !ok || skipped != 1 {
+		t.Errorf("second run = %d skipped, %v; want 1, true", skipped, ok)
+	}
+	a.release(r)
+	if _, ok := a.claim(r); ok {
+		t.Error("a match was run past the rate")
+	}
+
+	clock = clock.Add(time.Minute)
+	if skipped, ok := a.claim(r); !ok || skipped != 1 {
+		t.Errorf("run in the next window = %d skipped, %v; want 1, true", skipped, ok)
+	}
+}
+
+func TestAlerter_Run(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "notify.sh")
+	out := filepath.Join(dir, "out")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n{ echo \"$1 $LOG2JSON_ALERT $LOG2JSON_ALERT_SKIPPED\"; cat; } >> "+out+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	a, err := New([]string{`level == "fatal" => ` + script + ` ops`, `level == "error" => ` + filepath.Join(dir, "missing")}, "", encodeJSON, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Check(entry("info"))
+	a.Check(entry("fatal"))
+	a.Check(entry("error"))
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "ops level == \"fatal\" 0\n{\"level\":\"fatal\"}"; string(data) != want {
+		t.Errorf("command got %q, want %q", data, want)
+	}
+	if !strings.Contains(stderr.String(), `warning: alert "level == \"error\""`) {
+		t.Errorf("a failed command was not reported: %q", stderr.String())
+	}
+}
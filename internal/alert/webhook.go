@@ -0,0 +1,348 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/expr"
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// WebhookTimeout bounds each webhook request.
+const WebhookTimeout = 10 * time.Second
+
+// webhookQueue is how many requests may wait to be sent; matches past it
+// are dropped, so a slow webhook cannot hold up the conversion.
+const webhookQueue = 64
+
+// maxDigestEntries is how many entries a digest lists; it counts all.
+const maxDigestEntries = 20
+
+// Webhook POSTs entries matching a condition to a URL, one request per
+// entry, or with a digest interval one request per interval listing the
+// entries that matched in it. Requests are sent in the background, in
+// order.
+//
+// The body is the entry as JSON, or the digest: an object of the
+// condition, the count of entries, up to 20 of them, and the interval's
+// start and end. For Slack incoming webhooks (hooks.slack.com) it is a
+// message, {"text": ...}, showing those instead. A template replaces
+// either: it is executed with the entry's fields, or the digest's.
+type Webhook struct {
+	url    string
+	match  *expr.Expr
+	tmpl   *template.Template
+	slack  bool
+	digest time.Duration
+	encode func(*parser.Entry) ([]byte, error)
+	client *http.Client
+	stderr io.Writer
+	quiet  bool
+
+	queue   chan []byte
+	done    chan struct{}
+	stopped chan struct{}
+
+	mu       sync.Mutex
+	pending  []json.RawMessage // the current digest's entries
+	matched  int               // its count
+	start    time.Time         // when its interval started
+	dropped  int
+	failures int
+	closed   bool
+}
+
+// WebhookOption configures a Webhook.
+type WebhookOption func(*Webhook)
+
+// WithTemplate renders request bodies with tmpl.
+func WithTemplate(tmpl *template.Template) WebhookOption {
+	return func(w *Webhook) { w.tmpl = tmpl }
+}
+
+// WithDigest sends one request per interval for the entries that matched
+// in it, instead of one per entry.
+func WithDigest(interval time.Duration) WebhookOption {
+	return func(w *Webhook) { w.digest = interval }
+}
+
+// WithWebhookQuiet leaves out the warnings about failed requests and
+// dropped matches.
+func WithWebhookQuiet() WebhookOption {
+	return func(w *Webhook) { w.quiet = true }
+}
+
+// NewWebhook creates a Webhook POSTing the entries matching the
+// expression when to rawURL, encoded by encode. Failures are reported
+// on stderr. The Webhook must be closed, to send what is pending.
+func NewWebhook(rawURL, when string, encode func(*parser.Entry) ([]byte, error), stderr io.Writer, opts ...WebhookOption) (*Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("URL must be http:// or https://, got %q", rawURL)
+	}
+	match, err := expr.Compile(when)
+	if err != nil {
+		return nil, err
+	}
+	w := &Webhook{
+		url:     u.String(),
+		match:   match,
+		slack:   u.Hostname() == "hooks.slack.com",
+		encode:  encode,
+		client:  &http.Client{Timeout: WebhookTimeout},
+		stderr:  stderr,
+		queue:   make(chan []byte, webhookQueue),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		start:   time.Now(),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if w.digest < 0 {
+		return nil, fmt.Errorf("invalid digest interval %v", w.digest)
+	}
+	go w.loop()
+	return w, nil
+}
+
+// Check queues a request for the entry if it matches, or adds it to the
+// digest. It does not wait for the request.
+func (w *Webhook) Check(entry *parser.Entry) {
+	if !w.match.Match(entry.Fields) {
+		return
+	}
+	record, err := w.encode(entry)
+	if err != nil {
+		w.warn("notify webhook: %v", err)
+		return
+	}
+	record = bytes.TrimSpace(record)
+
+	if w.digest > 0 {
+		w.mu.Lock()
+		w.matched++
+		if len(w.pending) < maxDigestEntries {
+			w.pending = append(w.pending, record)
+		}
+		w.mu.Unlock()
+		return
+	}
+	body, err := w.entryBody(record)
+	if err != nil {
+		w.warn("notify webhook: %v", err)
+		return
+	}
+	w.enqueue(body)
+}
+
+// entryBody is the request body for one entry.
+func (w *Webhook) entryBody(record []byte) ([]byte, error) {
+	switch {
+	case w.tmpl != nil:
+		var fields map[string]any
+		if err := json.Unmarshal(record, &fields); err != nil {
+			return nil, err
+		}
+		return w.render(fields)
+	case w.slack:
+		return json.Marshal(map[string]string{
+			"text": fmt.Sprintf("log2json: an entry matched `%s`\n```%s```", w.match, record),
+		})
+	}
+	return record, nil
+}
+
+// digestBody is the request body for the entries matched from start to
+// end.
+func (w *Webhook) digestBody(count int, entries []json.RawMessage, start, end time.Time) ([]byte, error) {
+	digest := map[string]any{
+		"condition": w.match.String(),
+		"count":     count,
+		"entries":   entries,
+		"start":     start.UTC().Format(time.RFC3339),
+		"end":       end.UTC().Format(time.RFC3339),
+	}
+	switch {
+	case w.tmpl != nil:
+		list := make([]map[string]any, 0, len(entries))
+		for _, e := range entries {
+			var fields map[string]any
+			if err := json.Unmarshal(e, &fields); err != nil {
+				return nil, err
+			}
+			list = append(list, fields)
+		}
+		digest["entries"] = list
+		return w.render(digest)
+	case w.slack:
+		var text strings.Builder
+		fmt.Fprintf(&text, "log2json: %d entries matched `%s` in the last %v", count, w.match, end.Sub(start).Round(time.Second))
+		text.WriteString("\n```")
+		for i, e := range entries {
+			if i > 0 {
+				text.WriteByte('\n')
+			}
+			text.Write(e)
+		}
+		if count > len(entries) {
+			fmt.Fprintf(&text, "\n... and %d more", count-len(entries))
+		}
+		text.WriteString("```")
+		return json.Marshal(map[string]string{"text": text.String()})
+	}
+	return json.Marshal(digest)
+}
+
+func (w *Webhook) render(data any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := w.tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// enqueue queues a request, or drops it if the queue is full.
+func (w *Webhook) enqueue(body []byte) {
+	select {
+	case w.queue <- body:
+	default:
+		w.mu.Lock()
+		w.dropped++
+		w.mu.Unlock()
+	}
+}
+
+// loop sends the queued requests, and the digests when they are due,
+// until Close.
+func (w *Webhook) loop() {
+	defer close(w.stopped)
+	var tick <-chan time.Time
+	if w.digest > 0 {
+		ticker := time.NewTicker(w.digest)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case body := <-w.queue:
+			w.send(body)
+		case <-tick:
+			w.flushDigest()
+			w.drain()
+		case <-w.done:
+			w.drain()
+			return
+		}
+	}
+}
+
+// drain sends the requests queued.
+func (w *Webhook) drain() {
+	for {
+		select {
+		case body := <-w.queue:
+			w.send(body)
+		default:
+			return
+		}
+	}
+}
+
+// flushDigest queues the digest of the interval ending now, if entries
+// matched in it.
+func (w *Webhook) flushDigest() {
+	now := time.Now()
+	w.mu.Lock()
+	count, entries, start := w.matched, w.pending, w.start
+	w.matched, w.pending, w.start = 0, nil, now
+	w.mu.Unlock()
+	if count == 0 {
+		return
+	}
+	body, err := w.digestBody(count, entries, start, now)
+	if err != nil {
+		w.warn("notify webhook: %v", err)
+		return
+	}
+	w.enqueue(body)
+}
+
+// send POSTs one request body.
+func (w *Webhook) send(body []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), WebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		w.fail(err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		w.fail(err)
+		return
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		w.fail(fmt.Errorf("HTTP %s", resp.Status))
+	}
+}
+
+// fail reports a failed request. Only the first few are reported, so
+// that a webhook that is down does not flood stderr.
+func (w *Webhook) fail(err error) {
+	w.mu.Lock()
+	w.failures++
+	n := w.failures
+	w.mu.Unlock()
+	if n <= 3 {
+		w.warn("notify webhook: %v", err)
+	}
+}
+
+// Close sends the pending digest and the queued requests, and stops the
+// Webhook. It may be called more than once.
+func (w *Webhook) Close() error {
+	w.mu.Lock()
+	closed := w.closed
+	w.closed = true
+	w.mu.Unlock()
+	if closed {
+		return nil
+	}
+	close(w.done)
+	<-w.stopped
+	if w.digest > 0 {
+		w.flushDigest()
+		w.drain()
+	}
+
+	if w.dropped > 0 {
+		w.warn("notify webhook: %d requests dropped while it was behind", w.dropped)
+	}
+	if w.failures > 3 {
+		w.warn("notify webhook: %d requests failed in all", w.failures)
+	}
+	return nil
+}
+
+func (w *Webhook) warn(format string, args ...any) {
+	if w.quiet {
+		return
+	}
+	_, _ = fmt.Fprintf(w.stderr, "warning: "+format+"\n", args...)
+}
@@ -0,0 +1,169 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// hookServer records the bodies POSTed to it.
+type hookServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	bodies []string
+}
+
+func newHookServer(t *testing.T) *hookServer {
+	s := &hookServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s with Content-Type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		s.mu.Lock()
+		s.bodies = append(s.bodies, string(body))
+		s.mu.Unlock()
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestWebhook_Entries(t *testing.T) {
+	srv := newHookServer(t)
+	w, err := NewWebhook(srv.URL, `level == "fatal"`, encodeJSON, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Check(entry("info"))
+	w.Check(entry("fatal"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.bodies) != 1 || srv.bodies[0] != `{"level":"fatal"}` {
+		t.Errorf("bodies = %q", srv.bodies)
+	}
+}
+
+func TestWebhook_Template(t *testing.T) {
+	srv := newHookServer(t)
+	tmpl := template.Must(template.New("t").Parse(`{"text": "{{.level}} on {{.host}}"}`))
+	w, err := NewWebhook(srv.URL, `true`, func(*parser.Entry) ([]byte, error) {
+		return []byte(`{"level":"fatal","host":"web1"}` + "\n"), nil
+	}, &bytes.Buffer{}, WithTemplate(tmpl))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Check(entry("fatal"))
+	_ = w.Close()
+	if len(srv.bodies) != 1 || srv.bodies[0] != `{"text": "fatal on web1"}` {
+		t.Errorf("bodies = %q", srv.bodies)
+	}
+}
+
+func TestWebhook_Digest(t *testing.T) {
+	srv := newHookServer(t)
+	w, err := NewWebhook(srv.URL, `level != "info"`, encodeJSON, &bytes.Buffer{}, WithDigest(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxDigestEntries+5; i++ {
+		w.Check(entry("error"))
+	}
+	w.Check(entry("info"))
+	if len(srv.bodies) != 0 {
+		t.Errorf("a digest was sent before its interval ended: %q", srv.bodies)
+	}
+	_ = w.Close()
+
+	if len(srv.bodies) != 1 {
+		t.Fatalf("got %d requests, want 1 digest", len(srv.bodies))
+	}
+	var digest struct {
+		Condition  string
+		Count      int
+		Entries    []map[string]any
+		Start, End string
+	}
+	if err := json.Unmarshal([]byte(srv.bodies[0]), &digest); err != nil {
+		t.Fatal(err)
+	}
+	if digest.Condition != `level != "info"` || digest.Count != maxDigestEntries+5 || len(digest.Entries) != maxDigestEntries || digest.Start == "" || digest.End == "" {
+		t.Errorf("unexpected digest: %+v", digest)
+	}
+}
+
+func TestWebhook_Slack(t *testing.T) {
+	tests := []struct {
+		name   string
+		digest time.Duration
+		want   string
+	}{
+		{name: "entry", want: "log2json: an entry matched `true`\n```{\"level\":\"fatal\"}```"},
+		{name: "digest", digest: time.Hour, want: "log2json: 2 entries matched `true` in the last 0s\n```{\"level\":\"fatal\"}\n{\"level\":\"fatal\"}```"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newHookServer(t)
+			w, err := NewWebhook(srv.URL, `true`, encodeJSON, &bytes.Buffer{}, WithDigest(tt.digest))
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.slack = true
+			w.Check(entry("fatal"))
+			if tt.digest > 0 {
+				w.Check(entry("fatal"))
+			}
+			_ = w.Close()
+			var msg map[string]string
+			if len(srv.bodies) != 1 || json.Unmarshal([]byte(srv.bodies[0]), &msg) != nil || msg["text"] != tt.want {
+				t.Errorf("bodies = %q, want the text %q", srv.bodies, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhook_Failures(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	var stderr bytes.Buffer
+	w, err := NewWebhook(srv.URL, `true`, encodeJSON, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		w.Check(entry("fatal"))
+	}
+	_ = w.Close()
+	if got := strings.Count(stderr.String(), "HTTP 403"); got != 3 {
+		t.Errorf("reported %d failures, want the first 3:\n%s", got, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "5 requests failed") {
+		t.Errorf("the failures were not totalled:\n%s", stderr.String())
+	}
+}
+
+func TestNewWebhook_Invalid(t *testing.T) {
+	tests := []struct{ url, when string }{
+		{url: "ftp://example.com/hook", when: "true"},
+		{url: "https://", when: "true"},
+		{url: "https://example.com/hook", when: "level =="},
+	}
+	for _, tt := range tests {
+		if w, err := NewWebhook(tt.url, tt.when, encodeJSON, &bytes.Buffer{}); err == nil {
+			_ = w.Close()
+			t.Errorf("NewWebhook(%q, %q) accepted", tt.url, tt.when)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Package dockerlog implements the Docker logging driver plugin protocol:
+// the HTTP API the daemon calls to start and stop logging a container, and
+// the stream of log entries it then writes to a FIFO for that container.
+package dockerlog
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// MaxEntrySize bounds the encoded size of an entry in the stream; the
+// daemon splits longer lines into partial entries well below it.
+const MaxEntrySize = 1 << 20
+
+// Entry is one log message from a container.
+type Entry struct {
+	Source   string // "stdout" or "stderr"
+	TimeNano int64  // when the daemon read it, in Unix nanoseconds
+	Line     []byte // without the trailing newline
+	Partial  bool   // the line continues in the next entry
+}
+
+// Info describes the container a logging session is for.
+type Info struct {
+	Config             map[string]string // the --log-opt options
+	ContainerID        string
+	ContainerName      string
+	ContainerImageID   string
+	ContainerImageName string
+	ContainerLabels    map[string]string
+}
+
+// Driver receives the daemon's requests to start and stop logging. The
+// daemon writes a container's entries to file, a FIFO, from StartLogging
+// until StopLogging; StartLogging must not block reading it.
+type Driver interface {
+	StartLogging(file string, info Info) error
+	StopLogging(file string) error
+}
+
+// NewHandler serves the plugin API for driver: activation, capabilities,
+// and the start and stop requests. Reading logs back (docker logs) is not
+// supported.
+func NewHandler(driver Driver) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/Plugin.Activate", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, map[string]any{"Implements": []string{"LoggingDriver"}})
+	})
+	mux.HandleFunc("/LogDriver.Capabilities", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, map[string]any{"Cap": map[string]bool{"ReadLogs": false}})
+	})
+	mux.HandleFunc("/LogDriver.StartLogging", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			File string
+			Info Info
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondErr(w, fmt.Errorf("invalid request: %w", err))
+			return
+		}
+		respondErr(w, driver.StartLogging(req.File, req.Info))
+	})
+	mux.HandleFunc("/LogDriver.StopLogging", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			File string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondErr(w, fmt.Errorf("invalid request: %w", err))
+			return
+		}
+		respondErr(w, driver.StopLogging(req.File))
+	})
+	mux.HandleFunc("/LogDriver.ReadLogs", func(w http.ResponseWriter, r *http.Request) {
+		respondErr(w, errors.New("reading logs is not supported"))
+	})
+	return mux
+}
+
+// respond writes a plugin API response.
+func respond(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/vnd.docker.plugins.v1+json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// respondErr writes the response to a start or stop request, whose Err is
+// empty on success.
+func respondErr(w http.ResponseWriter, err error) {
+	var msg string
+	if err != nil {
+		msg = err.Error()
+	}
+	respond(w, map[string]string{"Err": msg})
+}
+
+// Decoder reads entries from a logging FIFO: each is a protobuf LogEntry
+// message after its size as a big-endian uint32.
+type Decoder struct {
+	r   io.Reader
+	buf []byte
+}
+
+// NewDecoder returns a decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Decode reads the next entry into e. It returns io.EOF at the end of the
+// stream, and io.ErrUnexpectedEOF if the stream ends inside an entry.
+func (d *Decoder) Decode(e *Entry) error {
+	var size [4]byte
+	if _, err := io.ReadFull(d.r, size[:]); err != nil {
+		return err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > MaxEntrySize {
+		return fmt.Errorf("log entry of %d bytes exceeds %d", n, MaxEntrySize)
+	}
+	if cap(d.buf) < int(n) {
+		d.buf = make([]byte, n)
+	}
+	d.buf = d.buf[:n]
+	if _, err := io.ReadFull(d.r, d.buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return unmarshalEntry(d.buf, e)
+}
+
+// LogEntry field numbers.
+const (
+	fieldSource   = 1
+	fieldTimeNano = 2
+	fieldLine     = 3
+	fieldPartial  = 4
+)
+
+// unmarshalEntry decodes a LogEntry message, skipping fields it does not
+// use, such as the partial message metadata.
+func unmarshalEntry(b []byte, e *Entry) error {
+	*e = Entry{}
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errors.New("malformed log entry")
+		}
+		b = b[n:]
+		num, wireType := tag>>3, tag&7
+
+		switch wireType {
+		case 0: // varint
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return errors.New("malformed log entry")
+			}
+			b = b[n:]
+			switch num {
+			case fieldTimeNano:
+				e.TimeNano = int64(v)
+			case fieldPartial:
+				e.Partial = v != 0
+			}
+		case 1: // 64-bit
+			if len(b) < 8 {
+				return errors.New("malformed log entry")
+			}
+			b = b[8:]
+		case 2: // length-delimited
+			size, n := binary.Uvarint(b)
+			if n <= 0 || size > uint64(len(b)-n) {
+				return errors.New("malformed log entry")
+			}
+			v := b[n : n+int(size)]
+			b = b[n+int(size):]
+			switch num {
+			case fieldSource:
+				e.Source = string(v)
+			case fieldLine:
+				e.Line = append([]byte(nil), v...)
+			}
+		case 5: // 32-bit
+			if len(b) < 4 {
+				return errors.New("malformed log entry")
+			}
+			b = b[4:]
+		default:
+			return fmt.Errorf("malformed log entry: wire type %d", wireType)
+		}
+	}
+	return nil
+}
+
+// AppendEntry appends e to b as the daemon writes it to the FIFO, for
+// programs that feed a logging driver.
+func AppendEntry(b []byte, e *Entry) []byte {
+	var msg []byte
+	if e.Source != "" {
+		msg = appendBytes(msg, fieldSource, []byte(e.Source))
+	}
+	if e.TimeNano != 0 {
+		msg = binary.AppendUvarint(binary.AppendUvarint(msg, fieldTimeNano<<3), uint64(e.TimeNano))
+	}
+	if len(e.Line) > 0 {
+		msg = appendBytes(msg, fieldLine, e.Line)
+	}
+	if e.Partial {
+		msg = binary.AppendUvarint(binary.AppendUvarint(msg, fieldPartial<<3), 1)
+	}
+	b = binary.BigEndian.AppendUint32(b, uint32(len(msg)))
+	return append(b, msg...)
+}
+
+func appendBytes(b []byte, num int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
@@ -0,0 +1,148 @@
+package dockerlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecoder(t *testing.T) {
+	entries := []Entry{
+		{Source: "stdout", TimeNano: 1700000000123456789, Line: []byte("GET /health 200")},
+		{Source: "stderr", TimeNano: 1700000000223456789, Line: []byte("part one "), Partial: true},
+		{Source: "stderr", Line: []byte("part two")},
+		{Source: "stdout"},
+	}
+	var stream []byte
+	for i := range entries {
+		stream = AppendEntry(stream, &entries[i])
+	}
+
+	d := NewDecoder(bytes.NewReader(stream))
+	for i, want := range entries {
+		var got Entry
+		if err := d.Decode(&got); err != nil {
+			t.Fatalf("Decode() entry %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("entry %d = %+v, want %+v", i, got, want)
+		}
+	}
+	var e Entry
+	if err := d.Decode(&e); err != io.EOF {
+		t.Errorf("Decode() at end = %v, want io.EOF", err)
+	}
+}
+
+func TestDecoder_SkipsUnknownFields(t *testing.T) {
+	msg := appendBytes(nil, fieldLine, []byte("hello"))
+	msg = appendBytes(msg, 5, []byte{0x0a, 0x01, 'x'})                      // partial_log_metadata
+	msg = append(binary.AppendUvarint(msg, 9<<3|1), 1, 2, 3, 4, 5, 6, 7, 8) // fixed64
+	msg = append(binary.AppendUvarint(msg, 10<<3|5), 1, 2, 3, 4)            // fixed32
+	stream := append(binary.BigEndian.AppendUint32(nil, uint32(len(msg))), msg...)
+
+	var e Entry
+	if err := NewDecoder(bytes.NewReader(stream)).Decode(&e); err != nil {
+		t.Fatalf("Decode() error: %v", err)
+	}
+	if string(e.Line) != "hello" {
+		t.Errorf("Line = %q, want hello", e.Line)
+	}
+}
+
+func TestDecoder_Errors(t *testing.T) {
+	full := AppendEntry(nil, &Entry{Source: "stdout", Line: []byte("hello")})
+	tests := []struct {
+		name   string
+		stream []byte
+		want   string
+	}{
+		{name: "truncated entry", stream: full[:len(full)-2], want: "unexpected EOF"},
+		{name: "truncated size", stream: full[:2], want: "unexpected EOF"},
+		{name: "oversized", stream: binary.BigEndian.AppendUint32(nil, MaxEntrySize+1), want: "exceeds"},
+		{name: "bad length", stream: []byte{0, 0, 0, 2, fieldLine<<3 | 2, 9}, want: "malformed"},
+		{name: "bad wire type", stream: []byte{0, 0, 0, 1, 1<<3 | 7}, want: "wire type 7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var e Entry
+			err := NewDecoder(bytes.NewReader(tt.stream)).Decode(&e)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Decode() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// fakeDriver records the requests it is given.
+type fakeDriver struct {
+	started map[string]Info
+	stopped []string
+	err     error
+}
+
+func (d *fakeDriver) StartLogging(file string, info Info) error {
+	d.started[file] = info
+	return d.err
+}
+
+func (d *fakeDriver) StopLogging(file string) error {
+	d.stopped = append(d.stopped, file)
+	return d.err
+}
+
+func TestHandler(t *testing.T) {
+	driver := &fakeDriver{started: make(map[string]Info)}
+	srv := httptest.NewServer(NewHandler(driver))
+	defer srv.Close()
+
+	post := func(path, body string) string {
+		t.Helper()
+		resp, err := http.Post(srv.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return strings.TrimSpace(string(data))
+	}
+
+	tests := []struct {
+		path, body, want string
+	}{
+		{path: "/Plugin.Activate", want: `{"Implements":["LoggingDriver"]}`},
+		{path: "/LogDriver.Capabilities", want: `{"Cap":{"ReadLogs":false}}`},
+		{
+			path: "/LogDriver.StartLogging",
+			body: `{"File":"/run/fifo/1","Info":{"ContainerID":"abc","ContainerName":"/web","Config":{"format":"json"}}}`,
+			want: `{"Err":""}`,
+		},
+		{path: "/LogDriver.StopLogging", body: `{"File":"/run/fifo/1"}`, want: `{"Err":""}`},
+		{path: "/LogDriver.StartLogging", body: `{"File":`, want: `{"Err":"invalid request: unexpected EOF"}`},
+		{path: "/LogDriver.ReadLogs", body: `{}`, want: `{"Err":"reading logs is not supported"}`},
+	}
+	for _, tt := range tests {
+		if got := post(tt.path, tt.body); got != tt.want {
+			t.Errorf("POST %s = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+
+	want := Info{ContainerID: "abc", ContainerName: "/web", Config: map[string]string{"format": "json"}}
+	if !reflect.DeepEqual(driver.started["/run/fifo/1"], want) {
+		t.Errorf("started = %+v, want %+v", driver.started, want)
+	}
+	if !reflect.DeepEqual(driver.stopped, []string{"/run/fifo/1"}) {
+		t.Errorf("stopped = %v", driver.stopped)
+	}
+
+	driver.err = errors.New("no such output")
+	if got := post("/LogDriver.StopLogging", `{"File":"x"}`); got != `{"Err":"no such output"}` {
+		t.Errorf("failed stop = %s", got)
+	}
+}
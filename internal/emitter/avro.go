@@ -0,0 +1,548 @@
+package emitter
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// DefaultAvroBlockSize is the number of entries per Avro block. When the
+// schema is inferred, the first block is the sample it is inferred from.
+const DefaultAvroBlockSize = 1000
+
+const avroMagic = "Obj\x01"
+
+// AvroSchema is a parsed Avro schema whose top level is a record.
+type AvroSchema struct {
+	root *avroType
+	json []byte
+}
+
+// avroType is one node of a schema.
+type avroType struct {
+	kind     string // primitive name, or record, enum, array, map, fixed, union
+	name     string
+	fields   []avroField // record
+	items    *avroType   // array items, map values
+	branches []*avroType // union
+	symbols  []string    // enum
+	size     int         // fixed
+}
+
+// avroField is a record field. key is the entry field it is read from,
+// which differs from name when an inferred name had to be sanitized.
+type avroField struct {
+	name       string
+	key        string
+	typ        *avroType
+	def        any
+	hasDefault bool
+}
+
+// ParseAvroSchema parses a JSON Avro schema. The top-level type must be a
+// record; logical types are written as their underlying type.
+func ParseAvroSchema(data []byte) (*AvroSchema, error) {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	root, err := parseAvroType(v, make(map[string]*avroType))
+	if err != nil {
+		return nil, err
+	}
+	if root.kind != "record" {
+		return nil, errors.New("top-level type must be a record")
+	}
+	compact, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &AvroSchema{root: root, json: compact}, nil
+}
+
+func parseAvroType(v any, named map[string]*avroType) (*avroType, error) {
+	switch x := v.(type) {
+	case string:
+		switch x {
+		case "null", "boolean", "int", "long", "float", "double", "bytes", "string":
+			return &avroType{kind: x}, nil
+		}
+		if t, ok := named[x]; ok {
+			return t, nil
+		}
+		return nil, fmt.Errorf("unknown type %q", x)
+	case []any:
+		t := &avroType{kind: "union"}
+		for _, b := range x {
+			bt, err := parseAvroType(b, named)
+			if err != nil {
+				return nil, err
+			}
+			t.branches = append(t.branches, bt)
+		}
+		return t, nil
+	case map[string]any:
+		return parseAvroComplex(x, named)
+	}
+	return nil, fmt.Errorf("invalid type %v", v)
+}
+
+func parseAvroComplex(x map[string]any, named map[string]*avroType) (*avroType, error) {
+	kind, _ := x["type"].(string)
+	name, _ := x["name"].(string)
+	t := &avroType{kind: kind, name: name}
+
+	switch kind {
+	case "record":
+		fields, ok := x["fields"].([]any)
+		if name == "" || !ok {
+			return nil, errors.New("record needs a name and fields")
+		}
+		named[name] = t // records may refer to themselves
+		for _, f := range fields {
+			fm, _ := f.(map[string]any)
+			fname, _ := fm["name"].(string)
+			if fname == "" {
+				return nil, fmt.Errorf("record %s: field without a name", name)
+			}
+			ft, err := parseAvroType(fm["type"], named)
+			if err != nil {
+				return nil, fmt.Errorf("record %s, field %s: %w", name, fname, err)
+			}
+			def, hasDefault := fm["default"]
+			t.fields = append(t.fields, avroField{name: fname, key: fname, typ: ft, def: def, hasDefault: hasDefault})
+		}
+	case "enum":
+		symbols, _ := x["symbols"].([]any)
+		for _, s := range symbols {
+			str, ok := s.(string)
+			if !ok {
+				return nil, fmt.Errorf("enum %s: symbols must be strings", name)
+			}
+			t.symbols = append(t.symbols, str)
+		}
+		named[name] = t
+	case "fixed":
+		size, ok := x["size"].(float64)
+		if !ok || size < 0 {
+			return nil, fmt.Errorf("fixed %s: invalid size", name)
+		}
+		t.size = int(size)
+		named[name] = t
+	case "array", "map":
+		key := "items"
+		if kind == "map" {
+			key = "values"
+		}
+		inner, err := parseAvroType(x[key], named)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", kind, err)
+		}
+		t.items = inner
+	default:
+		// A primitive in object form, possibly with a logical type.
+		return parseAvroType(x["type"], named)
+	}
+	return t, nil
+}
+
+// encode appends the binary encoding of v to buf.
+func (t *avroType) encode(buf []byte, v any) ([]byte, error) {
+	switch t.kind {
+	case "null":
+		if v != nil {
+			return nil, fmt.Errorf("expected null, got %T", v)
+		}
+		return buf, nil
+	case "boolean":
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expected boolean, got %T", v)
+		}
+		if b {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case "int", "long":
+		n, ok := avroInt(v)
+		if !ok || (t.kind == "int" && (n < math.MinInt32 || n > math.MaxInt32)) {
+			return nil, fmt.Errorf("expected %s, got %v", t.kind, v)
+		}
+		return binary.AppendVarint(buf, n), nil
+	case "float", "double":
+		f, ok := avroFloat(v)
+		if !ok {
+			return nil, fmt.Errorf("expected %s, got %T", t.kind, v)
+		}
+		if t.kind == "float" {
+			return binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(f))), nil
+		}
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(f)), nil
+	case "string":
+		// Other values are written as JSON, as in the Parquet writer.
+		s, ok := convertValue(parquetByteArray, v)
+		if !ok || v == nil {
+			return nil, fmt.Errorf("expected string, got %T", v)
+		}
+		return avroBytes(buf, s.(string)), nil
+	case "bytes":
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected bytes, got %T", v)
+		}
+		return avroBytes(buf, s), nil
+	case "fixed":
+		s, ok := v.(string)
+		if !ok || len(s) != t.size {
+			return nil, fmt.Errorf("expected %d-byte fixed %s", t.size, t.name)
+		}
+		return append(buf, s...), nil
+	case "enum":
+		s, _ := v.(string)
+		for i, sym := range t.symbols {
+			if sym == s {
+				return binary.AppendVarint(buf, int64(i)), nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not a symbol of enum %s", v, t.name)
+	case "array":
+		items, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("expected array, got %T", v)
+		}
+		if len(items) > 0 {
+			buf = binary.AppendVarint(buf, int64(len(items)))
+			for i, item := range items {
+				var err error
+				if buf, err = t.items.encode(buf, item); err != nil {
+					return nil, fmt.Errorf("[%d]: %w", i, err)
+				}
+			}
+		}
+		return append(buf, 0), nil
+	case "map":
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("expected map, got %T", v)
+		}
+		if len(m) > 0 {
+			buf = binary.AppendVarint(buf, int64(len(m)))
+			for k, mv := range m {
+				buf = avroBytes(buf, k)
+				var err error
+				if buf, err = t.items.encode(buf, mv); err != nil {
+					return nil, fmt.Errorf("%s: %w", k, err)
+				}
+			}
+		}
+		return append(buf, 0), nil
+	case "record":
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("expected record %s, got %T", t.name, v)
+		}
+		for _, f := range t.fields {
+			fv, present := m[f.key]
+			if !present && f.hasDefault {
+				fv = f.def
+			}
+			var err error
+			if buf, err = f.typ.encode(buf, fv); err != nil {
+				return nil, fmt.Errorf("field %s: %w", f.name, err)
+			}
+		}
+		return buf, nil
+	case "union":
+		for i, b := range t.branches {
+			if out, err := b.encode(binary.AppendVarint(buf, int64(i)), v); err == nil {
+				return out, nil
+			}
+		}
+		return nil, fmt.Errorf("%v matches no branch of union", v)
+	}
+	return nil, fmt.Errorf("unsupported type %s", t.kind)
+}
+
+func avroInt(v any) (int64, bool) {
+	if cv, ok := convertValue(parquetInt64, v); ok {
+		return cv.(int64), true
+	}
+	return 0, false
+}
+
+func avroFloat(v any) (float64, bool) {
+	if cv, ok := convertValue(parquetDouble, v); ok {
+		return cv.(float64), true
+	}
+	return 0, false
+}
+
+func avroBytes(buf []byte, s string) []byte {
+	buf = binary.AppendVarint(buf, int64(len(s)))
+	return append(buf, s...)
+}
+
+// AvroWriter writes entries as an Avro object container file with
+// deflate-compressed blocks. Without a schema, one is inferred from the
+// first block like the Parquet writer's: each field becomes a nullable
+// boolean, long, double or string, and later fields that do not fit are
+// kept as JSON in the _extra field.
+type AvroWriter struct {
+	out       *bufio.Writer
+	options   Options
+	blockSize int
+	schema    *AvroSchema // nil until inferred
+	columns   []parquetColumn
+	sync      [16]byte
+	started   bool
+
+	pending []map[string]any // rows awaiting schema inference
+	block   []byte
+	count   int
+	closed  bool
+}
+
+// AvroOption configures an AvroWriter.
+type AvroOption func(*AvroWriter)
+
+// WithAvroSchema writes entries with the given schema instead of
+// inferring one. Entries that do not match it are rejected by Emit.
+func WithAvroSchema(s *AvroSchema) AvroOption {
+	return func(a *AvroWriter) {
+		a.schema = s
+	}
+}
+
+// WithBlockSize sets the number of entries per Avro block.
+func WithBlockSize(n int) AvroOption {
+	return func(a *AvroWriter) {
+		if n > 0 {
+			a.blockSize = n
+		}
+	}
+}
+
+// NewAvro creates an Avro container writer.
+func NewAvro(output io.Writer, opts Options, aopts ...AvroOption) *AvroWriter {
+	a := &AvroWriter{
+		out:       bufio.NewWriter(output),
+		options:   opts,
+		blockSize: DefaultAvroBlockSize,
+	}
+	for _, opt := range aopts {
+		opt(a)
+	}
+	_, _ = rand.Read(a.sync[:])
+	return a
+}
+
+// Emit encodes an entry, writing a block when it is full.
+func (a *AvroWriter) Emit(entry *parser.Entry) error {
+	if a.closed {
+		return errors.New("avro writer is closed")
+	}
+	if a.options.OmitEmpty && entry.ParseError != nil {
+		return nil
+	}
+	row := buildOutput(&a.options, entry)
+
+	if a.schema == nil {
+		a.pending = append(a.pending, row)
+		if len(a.pending) < a.blockSize {
+			return nil
+		}
+		return a.inferSchema()
+	}
+	if err := a.encode(row); err != nil {
+		return err
+	}
+	if a.count >= a.blockSize {
+		return a.writeBlock()
+	}
+	return nil
+}
+
+// Close writes any buffered entries and flushes the output.
+func (a *AvroWriter) Close() error {
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+	if a.schema == nil {
+		if err := a.inferSchema(); err != nil {
+			return err
+		}
+	}
+	if err := a.writeBlock(); err != nil {
+		return err
+	}
+	return a.out.Flush()
+}
+
+// inferSchema derives the schema from the pending rows and writes them.
+func (a *AvroWriter) inferSchema() error {
+	a.columns = inferColumns(a.pending, a.options.FieldOrder)
+	a.schema = inferAvroSchema(a.columns)
+	for _, row := range a.pending {
+		if err := a.encode(row); err != nil {
+			return err
+		}
+	}
+	a.pending = nil
+	return a.writeBlock()
+}
+
+// inferAvroSchema builds a record of nullable fields from inferred columns.
+func inferAvroSchema(cols []parquetColumn) *AvroSchema {
+	root := &avroType{kind: "record", name: "LogEntry"}
+	type jsonField struct {
+		Name    string   `json:"name"`
+		Type    []string `json:"type"`
+		Default any      `json:"default"`
+	}
+	var fields []jsonField
+	used := make(map[string]bool)
+	for _, col := range cols {
+		kind := map[int32]string{parquetBoolean: "boolean", parquetInt64: "long", parquetDouble: "double"}[col.typ]
+		if kind == "" {
+			kind = "string"
+		}
+		name := avroName(col.name)
+		for i := 2; used[name]; i++ {
+			name = avroName(col.name) + "_" + strconv.Itoa(i)
+		}
+		used[name] = true
+
+		root.fields = append(root.fields, avroField{
+			name: name,
+			key:  col.name,
+			typ:  &avroType{kind: "union", branches: []*avroType{{kind: "null"}, {kind: kind}}},
+		})
+		fields = append(fields, jsonField{Name: name, Type: []string{"null", kind}})
+	}
+	schema, _ := json.Marshal(map[string]any{
+		"type":      "record",
+		"name":      root.name,
+		"namespace": "log2json",
+		"fields":    fields,
+	})
+	return &AvroSchema{root: root, json: schema}
+}
+
+// avroName makes a field name valid in Avro: [A-Za-z_][A-Za-z0-9_]*.
+func avroName(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' && i > 0) {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 {
+		return "_"
+	}
+	return string(b)
+}
+
+// encode appends a row to the current block. With an inferred schema,
+// values that do not fit their field are moved to _extra first.
+func (a *AvroWriter) encode(row map[string]any) error {
+	if a.columns != nil {
+		row = fitColumns(a.columns, row)
+	}
+	buf, err := a.schema.root.encode(a.block, row)
+	if err != nil {
+		return err
+	}
+	a.block = buf
+	a.count++
+	return nil
+}
+
+// fitColumns converts a row to inferred column types, collecting fields
+// that are not in the schema or do not fit their column in ExtraColumn.
+func fitColumns(cols []parquetColumn, row map[string]any) map[string]any {
+	out := make(map[string]any, len(cols))
+	extra := make(map[string]any)
+	for k, v := range row {
+		extra[k] = v
+	}
+	for _, col := range cols {
+		v, ok := row[col.name]
+		if !ok || col.name == ExtraColumn {
+			continue
+		}
+		delete(extra, col.name)
+		if v == nil {
+			continue
+		}
+		if cv, ok := convertValue(col.typ, v); ok {
+			out[col.name] = cv
+		} else {
+			extra[col.name] = v
+		}
+	}
+	if len(extra) > 0 {
+		out[ExtraColumn], _ = convertValue(parquetByteArray, extra)
+	}
+	return out
+}
+
+// writeBlock writes the header if needed, then the current block.
+func (a *AvroWriter) writeBlock() error {
+	if !a.started {
+		a.started = true
+		var hdr []byte
+		hdr = append(hdr, avroMagic...)
+		hdr = binary.AppendVarint(hdr, 2)
+		hdr = avroBytes(hdr, "avro.schema")
+		hdr = avroBytes(hdr, string(a.schema.json))
+		hdr = avroBytes(hdr, "avro.codec")
+		hdr = avroBytes(hdr, "deflate")
+		hdr = append(hdr, 0)
+		hdr = append(hdr, a.sync[:]...)
+		if _, err := a.out.Write(hdr); err != nil {
+			return err
+		}
+	}
+	if a.count == 0 {
+		return nil
+	}
+
+	var compressed bytes.Buffer
+	zw, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := zw.Write(a.block); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	var hdr []byte
+	hdr = binary.AppendVarint(hdr, int64(a.count))
+	hdr = binary.AppendVarint(hdr, int64(compressed.Len()))
+	if _, err := a.out.Write(hdr); err != nil {
+		return err
+	}
+	if _, err := a.out.Write(compressed.Bytes()); err != nil {
+		return err
+	}
+	if _, err := a.out.Write(a.sync[:]); err != nil {
+		return err
+	}
+	a.block = a.block[:0]
+	a.count = 0
+	return a.out.Flush()
+}
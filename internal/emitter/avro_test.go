@@ -0,0 +1,287 @@
+package emitter
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// avroReader decodes Avro binary data.
+type avroReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *avroReader) long() int64 {
+	v, n := binary.Varint(r.data[r.pos:])
+	if n <= 0 {
+		panic("avro: bad varint")
+	}
+	r.pos += n
+	return v
+}
+
+func (r *avroReader) bytes(n int) []byte {
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *avroReader) decode(t *avroType) any {
+	switch t.kind {
+	case "null":
+		return nil
+	case "boolean":
+		return r.bytes(1)[0] == 1
+	case "int", "long", "enum":
+		return r.long()
+	case "float":
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(r.bytes(4))))
+	case "double":
+		return math.Float64frombits(binary.LittleEndian.Uint64(r.bytes(8)))
+	case "string", "bytes":
+		return string(r.bytes(int(r.long())))
+	case "fixed":
+		return string(r.bytes(t.size))
+	case "array":
+		items := []any{}
+		for n := r.long(); n != 0; n = r.long() {
+			for i := int64(0); i < n; i++ {
+				items = append(items, r.decode(t.items))
+			}
+		}
+		return items
+	case "map":
+		m := map[string]any{}
+		for n := r.long(); n != 0; n = r.long() {
+			for i := int64(0); i < n; i++ {
+				k := string(r.bytes(int(r.long())))
+				m[k] = r.decode(t.items)
+			}
+		}
+		return m
+	case "record":
+		m := map[string]any{}
+		for _, f := range t.fields {
+			if v := r.decode(f.typ); v != nil {
+				m[f.name] = v
+			}
+		}
+		return m
+	case "union":
+		return r.decode(t.branches[r.long()])
+	}
+	panic("avro: unsupported type " + t.kind)
+}
+
+// readAvro decodes an object container file, returning its schema,
+// records and block count.
+func readAvro(t *testing.T, data []byte) (schema string, records []any, blocks int) {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte(avroMagic)) {
+		t.Fatalf("missing Avro magic: %q", data)
+	}
+	r := &avroReader{data: data, pos: len(avroMagic)}
+	meta := map[string]string{}
+	for n := r.long(); n != 0; n = r.long() {
+		for i := int64(0); i < n; i++ {
+			k := string(r.bytes(int(r.long())))
+			meta[k] = string(r.bytes(int(r.long())))
+		}
+	}
+	if meta["avro.codec"] != "deflate" {
+		t.Errorf("avro.codec = %q", meta["avro.codec"])
+	}
+	s, err := ParseAvroSchema([]byte(meta["avro.schema"]))
+	if err != nil {
+		t.Fatalf("embedded schema: %v", err)
+	}
+	sync := r.bytes(16)
+
+	for r.pos < len(data) {
+		count := r.long()
+		block, err := io.ReadAll(flate.NewReader(bytes.NewReader(r.bytes(int(r.long())))))
+		if err != nil {
+			t.Fatalf("inflate: %v", err)
+		}
+		br := &avroReader{data: block}
+		for i := int64(0); i < count; i++ {
+			records = append(records, br.decode(s.root))
+		}
+		if br.pos != len(block) {
+			t.Errorf("block has %d trailing bytes", len(block)-br.pos)
+		}
+		if !bytes.Equal(r.bytes(16), sync) {
+			t.Fatal("sync marker mismatch")
+		}
+		blocks++
+	}
+	return meta["avro.schema"], records, blocks
+}
+
+func avroEntry(fields map[string]any) *parser.Entry {
+	e := parser.NewEntry("")
+	for k, v := range fields {
+		e.Fields[k] = v
+	}
+	return e
+}
+
+func TestAvroWriter_Inferred(t *testing.T) {
+	var buf bytes.Buffer
+	a := NewAvro(&buf, Options{}, WithBlockSize(2))
+	for _, fields := range []map[string]any{
+		{"level": "info", "status": int64(200), "ok": true, "http.path": "/", "tags": []any{"a"}},
+		{"level": "error", "status": float64(500), "latency": 1.5},
+		{"level": "warn", "status": "n/a", "new": true}, // after the schema is fixed
+	} {
+		if err := a.Emit(avroEntry(fields)); err != nil {
+			t.Fatalf("Emit() error: %v", err)
+		}
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	schema, records, blocks := readAvro(t, buf.Bytes())
+	if blocks != 2 {
+		t.Errorf("blocks = %d, want 2", blocks)
+	}
+	var decoded struct {
+		Fields []struct {
+			Name string   `json:"name"`
+			Type []string `json:"type"`
+		} `json:"fields"`
+	}
+	if err := json.Unmarshal([]byte(schema), &decoded); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	var types []string
+	for _, f := range decoded.Fields {
+		types = append(types, f.Name+":"+strings.Join(f.Type, "|"))
+	}
+	wantTypes := []string{
+		"http_path:null|string", "latency:null|double", "level:null|string",
+		"ok:null|boolean", "status:null|long", "tags:null|string", "_extra:null|string",
+	}
+	if !reflect.DeepEqual(types, wantTypes) {
+		t.Errorf("schema fields = %v, want %v", types, wantTypes)
+	}
+
+	want := []any{
+		map[string]any{"level": "info", "status": int64(200), "ok": true, "http_path": "/", "tags": `["a"]`},
+		map[string]any{"level": "error", "status": int64(500), "latency": 1.5},
+		map[string]any{"level": "warn", "_extra": `{"new":true,"status":"n/a"}`},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records = %v, want %v", records, want)
+	}
+}
+
+func TestAvroWriter_Schema(t *testing.T) {
+	schema, err := ParseAvroSchema([]byte(`{
+		"type": "record", "name": "Log",
+		"fields": [
+			{"name": "level", "type": {"type": "enum", "name": "Level", "symbols": ["info", "error"]}},
+			{"name": "status", "type": "int"},
+			{"name": "host", "type": "string", "default": "unknown"},
+			{"name": "ratio", "type": ["null", "float"]},
+			{"name": "tags", "type": {"type": "array", "items": "string"}, "default": []},
+			{"name": "labels", "type": {"type": "map", "values": "long"}, "default": {}},
+			{"name": "ts", "type": {"type": "long", "logicalType": "timestamp-millis"}, "default": 0}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("ParseAvroSchema() error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	a := NewAvro(&buf, Options{}, WithAvroSchema(schema))
+	err = a.Emit(avroEntry(map[string]any{
+		"level": "error", "status": int64(503), "ratio": 0.5,
+		"tags": []any{"x", "y"}, "labels": map[string]any{"n": int64(1)}, "ignored": true,
+	}))
+	if err != nil {
+		t.Fatalf("Emit() error: %v", err)
+	}
+	for _, bad := range []map[string]any{
+		{"level": "debug", "status": int64(1)}, // not an enum symbol
+		{"level": "info", "status": "x"},       // not an int
+		{"level": "info"},                      // required field missing
+	} {
+		if err := a.Emit(avroEntry(bad)); err == nil {
+			t.Errorf("Emit(%v) expected error", bad)
+		}
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	got, records, _ := readAvro(t, buf.Bytes())
+	if got != string(schema.json) {
+		t.Errorf("embedded schema = %s", got)
+	}
+	want := []any{map[string]any{
+		"level": int64(1), "status": int64(503), "host": "unknown", "ratio": 0.5,
+		"tags": []any{"x", "y"}, "labels": map[string]any{"n": int64(1)}, "ts": int64(0),
+	}}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records = %v, want %v", records, want)
+	}
+}
+
+func TestParseAvroSchema_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+	}{
+		{name: "invalid JSON", schema: `{`},
+		{name: "not a record", schema: `"string"`},
+		{name: "unnamed record", schema: `{"type":"record","fields":[]}`},
+		{name: "unknown type", schema: `{"type":"record","name":"R","fields":[{"name":"a","type":"uuid4"}]}`},
+		{name: "unnamed field", schema: `{"type":"record","name":"R","fields":[{"type":"int"}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseAvroSchema([]byte(tt.schema)); err == nil {
+				t.Error("ParseAvroSchema() expected error")
+			}
+		})
+	}
+}
+
+func TestAvroWriter_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	a := NewAvro(&buf, Options{})
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+	schema, records, blocks := readAvro(t, buf.Bytes())
+	if len(records) != 0 || blocks != 0 || !strings.Contains(schema, ExtraColumn) {
+		t.Errorf("empty file: schema %s, %d records, %d blocks", schema, len(records), blocks)
+	}
+}
+
+func TestAvroName(t *testing.T) {
+	tests := map[string]string{
+		"level":       "level",
+		"http.status": "http_status",
+		"@timestamp":  "_timestamp",
+		"2xx":         "_xx",
+		"":            "_",
+	}
+	for in, want := range tests {
+		if got := avroName(in); got != want {
+			t.Errorf("avroName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package emitter
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Batching defaults for network outputs.
+const (
+	DefaultBatchSize     = 512
+	DefaultFlushInterval = time.Second
+
+	defaultRetries = 5
+	defaultBackoff = 500 * time.Millisecond
+)
+
+// BatchConfig controls how network outputs group entries into requests.
+type BatchConfig struct {
+	Size     int           // Entries per request (default DefaultBatchSize)
+	Interval time.Duration // Longest an entry waits to be sent (default DefaultFlushInterval)
+	OnError  func(error)   // Reports failed sends from interval flushes (may be nil)
+}
+
+// retryableError marks a send failure worth retrying, optionally after a
+// delay requested by the server. If items is set, only those are resent,
+// and rejected reports the rest if they were not all delivered.
+type retryableError struct {
+	err      error
+	after    time.Duration
+	items    [][]byte
+	rejected error
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// partialError reports that a send delivered all but some of its items,
+// which are dropped.
+type partialError struct {
+	err error
+}
+
+func (e *partialError) Error() string { return e.err.Error() }
+func (e *partialError) Unwrap() error { return e.err }
+
+// batcher accumulates encoded entries and sends them when the batch is
+// full or the flush interval passes. Failed sends marked retryable are
+// retried with exponential backoff before the batch is dropped.
+type batcher struct {
+	send    func(items [][]byte) error
+	size    int
+	onError func(error)
+	retries int
+	backoff time.Duration
+	sleep   func(time.Duration)
+
+	mu    sync.Mutex
+	items [][]byte
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func newBatcher(cfg BatchConfig, send func(items [][]byte) error) *batcher {
+	b := &batcher{
+		send:    send,
+		size:    cfg.Size,
+		onError: cfg.OnError,
+		retries: defaultRetries,
+		backoff: defaultBackoff,
+		sleep:   time.Sleep,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if b.size <= 0 {
+		b.size = DefaultBatchSize
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+	go b.run(interval)
+	return b
+}
+
+// run flushes on every interval tick until the batcher is closed.
+func (b *batcher) run(interval time.Duration) {
+	defer close(b.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			b.mu.Lock()
+			err := b.flushLocked()
+			b.mu.Unlock()
+			if err != nil && b.onError != nil {
+				b.onError(err)
+			}
+		}
+	}
+}
+
+// add queues an item, sending the batch if it is full.
+func (b *batcher) add(item []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.items = append(b.items, item)
+	if len(b.items) < b.size {
+		return nil
+	}
+	return b.flushLocked()
+}
+
+// close stops interval flushes and sends what is left.
+func (b *batcher) close() error {
+	select {
+	case <-b.stop:
+		return nil
+	default:
+	}
+	close(b.stop)
+	<-b.done
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flushLocked()
+}
+
+func (b *batcher) flushLocked() error {
+	if len(b.items) == 0 {
+		return nil
+	}
+	items := b.items
+	b.items = nil
+
+	var rejected []error // items dropped by partially delivered sends
+	for attempt := 0; ; attempt++ {
+		err := b.send(items)
+		if err == nil {
+			return errors.Join(rejected...)
+		}
+		var pe *partialError
+		if errors.As(err, &pe) {
+			return errors.Join(append(rejected, pe)...)
+		}
+		var re *retryableError
+		if !errors.As(err, &re) {
+			return fmt.Errorf("dropped %d entries: %w", len(items), err)
+		}
+		if re.rejected != nil {
+			rejected = append(rejected, re.rejected)
+		}
+		if re.items != nil {
+			items = re.items
+		}
+		if attempt >= b.retries {
+			return errors.Join(append(rejected, fmt.Errorf("dropped %d entries: %w", len(items), err))...)
+		}
+		delay := b.backoff << attempt
+		if re.after > 0 {
+			delay = re.after
+		}
+		b.sleep(delay)
+	}
+}
@@ -0,0 +1,126 @@
+package emitter
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatcher_SizeAndClose(t *testing.T) {
+	var sent [][]string
+	b := newBatcher(BatchConfig{Size: 2, Interval: time.Hour}, func(items [][]byte) error {
+		var batch []string
+		for _, it := range items {
+			batch = append(batch, string(it))
+		}
+		sent = append(sent, batch)
+		return nil
+	})
+	for _, s := range []string{"a", "b", "c"} {
+		if err := b.add([]byte(s)); err != nil {
+			t.Fatalf("add() error: %v", err)
+		}
+	}
+	if len(sent) != 1 || strings.Join(sent[0], ",") != "a,b" {
+		t.Fatalf("sent = %v before close, want [[a b]]", sent)
+	}
+	if err := b.close(); err != nil {
+		t.Fatalf("close() error: %v", err)
+	}
+	if err := b.close(); err != nil {
+		t.Fatalf("second close() error: %v", err)
+	}
+	if len(sent) != 2 || strings.Join(sent[1], ",") != "c" {
+		t.Errorf("sent = %v, want [[a b] [c]]", sent)
+	}
+}
+
+func TestBatcher_Interval(t *testing.T) {
+	var mu sync.Mutex
+	var sent int
+	b := newBatcher(BatchConfig{Size: 100, Interval: 10 * time.Millisecond}, func(items [][]byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent += len(items)
+		return nil
+	})
+	defer func() { _ = b.close() }()
+
+	if err := b.add([]byte("x")); err != nil {
+		t.Fatalf("add() error: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := sent
+		mu.Unlock()
+		if n == 1 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("entry not sent by the interval flush")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBatcher_Retry(t *testing.T) {
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   string
+		wantSleep []time.Duration
+	}{
+		{
+			name:      "recovers",
+			errs:      []error{&retryableError{err: errors.New("503")}, &retryableError{err: errors.New("503"), after: 3 * time.Second}, nil},
+			wantCalls: 3,
+			wantSleep: []time.Duration{defaultBackoff, 3 * time.Second},
+		},
+		{
+			name:      "permanent",
+			errs:      []error{errors.New("400 bad request")},
+			wantCalls: 1,
+			wantErr:   "dropped 1 entries: 400 bad request",
+		},
+		{
+			name:      "gives up",
+			errs:      []error{&retryableError{err: errors.New("down")}},
+			wantCalls: defaultRetries + 1,
+			wantErr:   "dropped 1 entries: down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			b := newBatcher(BatchConfig{Size: 1, Interval: time.Hour}, func([][]byte) error {
+				err := tt.errs[min(calls, len(tt.errs)-1)]
+				calls++
+				return err
+			})
+			defer func() { _ = b.close() }()
+			var slept []time.Duration
+			b.sleep = func(d time.Duration) { slept = append(slept, d) }
+
+			err := b.add([]byte("x"))
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("add() error = %v, want %q", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("send called %d times, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantSleep != nil && len(slept) != len(tt.wantSleep) {
+				t.Errorf("slept %v, want %v", slept, tt.wantSleep)
+			}
+			for i := range tt.wantSleep {
+				if i < len(slept) && slept[i] != tt.wantSleep[i] {
+					t.Errorf("sleep %d = %v, want %v", i, slept[i], tt.wantSleep[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package emitter
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// CBOR major types.
+const (
+	cborUint   = 0
+	cborNegInt = 1
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborSimple = 7
+)
+
+// CBORWriter writes entries as a CBOR sequence (RFC 8742): one encoded
+// map per entry, with no framing between them. Encoding follows the RFC
+// 8949 core deterministic rules: map keys are sorted, and numbers use
+// their shortest form. As in JSON output, floats with an integral value
+// are written as integers.
+type CBORWriter struct {
+	writer  *flushWriter
+	options Options
+	buf     []byte
+}
+
+// NewCBOR creates a CBOR sequence writer.
+func NewCBOR(output io.Writer, opts Options) *CBORWriter {
+	return &CBORWriter{
+		writer:  newFlushWriter(output, opts),
+		options: opts,
+	}
+}
+
+// Emit writes an entry as one CBOR data item.
+func (c *CBORWriter) Emit(entry *parser.Entry) error {
+	if c.options.OmitEmpty && entry.ParseError != nil {
+		return nil
+	}
+
+	c.buf = appendCBOR(c.buf[:0], buildOutput(&c.options, entry))
+	if _, err := c.writer.Write(c.buf); err != nil {
+		return err
+	}
+	return c.writer.entryDone()
+}
+
+// Close flushes any remaining data.
+func (c *CBORWriter) Close() error {
+	return c.writer.Flush()
+}
+
+// appendCBOR appends the encoding of v. Types without a direct CBOR
+// mapping are encoded as their JSON representation would decode.
+func appendCBOR(buf []byte, v any) []byte {
+	switch x := v.(type) {
+	case nil:
+		return append(buf, cborSimple<<5|22)
+	case bool:
+		if x {
+			return append(buf, cborSimple<<5|21)
+		}
+		return append(buf, cborSimple<<5|20)
+	case int:
+		return appendCBORInt(buf, int64(x))
+	case int64:
+		return appendCBORInt(buf, x)
+	case uint64:
+		return appendCBORHead(buf, cborUint, x)
+	case float64:
+		if x == math.Trunc(x) && math.Abs(x) < 1<<63 {
+			return appendCBORInt(buf, int64(x))
+		}
+		return appendCBORFloat(buf, x)
+	case string:
+		buf = appendCBORHead(buf, cborText, uint64(len(x)))
+		return append(buf, x...)
+	case []any:
+		buf = appendCBORHead(buf, cborArray, uint64(len(x)))
+		for _, item := range x {
+			buf = appendCBOR(buf, item)
+		}
+		return buf
+	case map[string]any:
+		return appendCBORMap(buf, x)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return appendCBOR(buf, nil)
+	}
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return appendCBOR(buf, nil)
+	}
+	return appendCBOR(buf, decoded)
+}
+
+// appendCBORMap encodes a map with keys in bytewise order of their
+// encodings, which for text keys means shorter keys first.
+func appendCBORMap(buf []byte, m map[string]any) []byte {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) < len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+
+	buf = appendCBORHead(buf, cborMap, uint64(len(m)))
+	for _, k := range keys {
+		buf = appendCBOR(buf, k)
+		buf = appendCBOR(buf, m[k])
+	}
+	return buf
+}
+
+func appendCBORInt(buf []byte, n int64) []byte {
+	if n < 0 {
+		return appendCBORHead(buf, cborNegInt, uint64(-(n + 1)))
+	}
+	return appendCBORHead(buf, cborUint, uint64(n))
+}
+
+// appendCBORHead writes a major type and argument in the shortest form.
+func appendCBORHead(buf []byte, major byte, n uint64) []byte {
+	m := major << 5
+	switch {
+	case n < 24:
+		return append(buf, m|byte(n))
+	case n <= math.MaxUint8:
+		return append(buf, m|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, m|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, m|26), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, m|27), n)
+}
+
+// appendCBORFloat writes f as the shortest of half, single or double
+// precision that represents it exactly.
+func appendCBORFloat(buf []byte, f float64) []byte {
+	if math.IsNaN(f) {
+		return append(buf, cborSimple<<5|25, 0x7e, 0x00)
+	}
+	if f32 := float32(f); float64(f32) == f {
+		if h, ok := float16Bits(f32); ok {
+			return binary.BigEndian.AppendUint16(append(buf, cborSimple<<5|25), h)
+		}
+		return binary.BigEndian.AppendUint32(append(buf, cborSimple<<5|26), math.Float32bits(f32))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, cborSimple<<5|27), math.Float64bits(f))
+}
+
+// float16Bits converts f to IEEE 754 half precision if that is exact.
+func float16Bits(f float32) (uint16, bool) {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23&0xff) - 127
+	mant := bits & 0x7fffff
+
+	switch {
+	case exp == 128: // infinity
+		if mant != 0 {
+			return 0, false
+		}
+		return sign | 0x7c00, true
+	case exp == -127 && mant == 0: // zero
+		return sign, true
+	case exp >= -14 && exp <= 15: // normal
+		if mant&0x1fff != 0 {
+			return 0, false
+		}
+		return sign | uint16(exp+15)<<10 | uint16(mant>>13), true
+	case exp >= -24 && exp < -14: // subnormal
+		full := mant | 0x800000
+		shift := uint(-exp - 1)
+		if full&(1<<shift-1) != 0 {
+			return 0, false
+		}
+		return sign | uint16(full>>shift), true
+	}
+	return 0, false
+}
@@ -0,0 +1,85 @@
+package emitter
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func TestAppendCBOR(t *testing.T) {
+	// Expected encodings are from RFC 8949 Appendix A.
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{name: "zero", value: int64(0), want: "00"},
+		{name: "small int", value: int64(23), want: "17"},
+		{name: "one byte int", value: int64(24), want: "1818"},
+		{name: "two byte int", value: int64(1000), want: "1903e8"},
+		{name: "four byte int", value: int64(1000000), want: "1a000f4240"},
+		{name: "eight byte int", value: int64(1000000000000), want: "1b000000e8d4a51000"},
+		{name: "max uint64", value: uint64(math.MaxUint64), want: "1bffffffffffffffff"},
+		{name: "negative", value: int64(-1), want: "20"},
+		{name: "negative large", value: int64(-1000), want: "3903e7"},
+		{name: "int", value: 10, want: "0a"},
+		{name: "integral float", value: float64(100), want: "1864"},
+		{name: "half float", value: 1.5, want: "f93e00"},
+		{name: "half subnormal", value: 5.960464477539063e-8, want: "f90001"},
+		{name: "beyond half precision", value: 65504.5, want: "fa477fe080"},
+		{name: "single float", value: 100000.5, want: "fa47c35040"},
+		{name: "double float", value: 1.1, want: "fb3ff199999999999a"},
+		{name: "infinity", value: math.Inf(1), want: "f97c00"},
+		{name: "negative infinity", value: math.Inf(-1), want: "f9fc00"},
+		{name: "NaN", value: math.NaN(), want: "f97e00"},
+		{name: "false", value: false, want: "f4"},
+		{name: "true", value: true, want: "f5"},
+		{name: "null", value: nil, want: "f6"},
+		{name: "empty string", value: "", want: "60"},
+		{name: "string", value: "IETF", want: "6449455446"},
+		{name: "unicode", value: "ü", want: "62c3bc"},
+		{name: "array", value: []any{int64(1), []any{int64(2), int64(3)}}, want: "8201820203"},
+		{name: "empty map", value: map[string]any{}, want: "a0"},
+		{name: "map", value: map[string]any{"a": int64(1), "b": []any{int64(2), int64(3)}}, want: "a26161016162820203"},
+		{name: "sorted keys", value: map[string]any{"bb": nil, "a": nil, "c": nil}, want: "a36161f66163f6626262f6"},
+		{name: "other map type", value: map[string]string{"a": "b"}, want: "a161616162"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := hex.EncodeToString(appendCBOR(nil, tt.value))
+			if got != tt.want {
+				t.Errorf("appendCBOR(%v) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCBORWriter_Emit(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewCBOR(&buf, Options{OmitEmpty: true})
+
+	entry := parser.NewEntry("level=info")
+	entry.Fields["level"] = "info"
+	bad := parser.NewEntry("garbage")
+	bad.ParseError = errors.New("no match")
+
+	for _, e := range []*parser.Entry{entry, bad, entry} {
+		if err := c.Emit(e); err != nil {
+			t.Fatalf("Emit() error: %v", err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	// Two concatenated maps of {"level": "info"}; the error entry is omitted.
+	one := "a1656c6576656c64696e666f"
+	if got := hex.EncodeToString(buf.Bytes()); got != one+one {
+		t.Errorf("output = %s, want %s", got, one+one)
+	}
+}
@@ -0,0 +1,173 @@
+package emitter
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/juliosaraiva/log2json/internal/transform"
+)
+
+// ANSI escape sequences used for colored output.
+const (
+	ansiReset   = "\x1b[0m"
+	ansiDim     = "\x1b[2m"
+	ansiReverse = "\x1b[7m"
+	ansiRed     = "\x1b[31m"
+	ansiYellow  = "\x1b[33m"
+)
+
+// levelColors colors level values by normalized severity.
+var levelColors = map[transform.Level]string{
+	transform.LevelWarn:     ansiYellow,
+	transform.LevelError:    ansiRed,
+	transform.LevelCritical: ansiRed,
+	transform.LevelFatal:    ansiRed,
+}
+
+// encodeColor writes output as JSON with ANSI colors: the level value
+// colored by severity, metadata keys dimmed and Highlight matches in
+// string values reversed. Keys are ordered as without Color.
+func (e *Emitter) encodeColor(output map[string]any) error {
+	e.ordered.Reset()
+	if err := e.appendColorObject(output, e.options.FieldOrder, true, 0); err != nil {
+		return err
+	}
+	e.ordered.WriteByte('\n')
+	_, err := e.writer.Write(e.ordered.Bytes())
+	return err
+}
+
+// appendColorObject adds an object to the one being built. Only the
+// top-level object has its level and metadata keys colored.
+func (e *Emitter) appendColorObject(m map[string]any, order []string, top bool, depth int) error {
+	levelKey := ""
+	if top {
+		for _, f := range transform.LevelFields {
+			if _, ok := m[f]; ok {
+				levelKey = f
+				break
+			}
+		}
+	}
+
+	keys := orderKeys(m, order)
+	e.ordered.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			e.ordered.WriteByte(',')
+		}
+		e.appendIndent(depth + 1)
+		if top && strings.HasPrefix(k, "_") {
+			e.ordered.WriteString(ansiDim)
+			if err := e.appendValue(k); err != nil {
+				return err
+			}
+			e.ordered.WriteString(ansiReset)
+		} else if err := e.appendValue(k); err != nil {
+			return err
+		}
+		e.ordered.WriteByte(':')
+		if e.options.Pretty {
+			e.ordered.WriteByte(' ')
+		}
+
+		v := m[k]
+		if k == levelKey {
+			if l, ok := transform.ParseLevel(v); ok && levelColors[l] != "" {
+				e.ordered.WriteString(levelColors[l])
+				if err := e.appendValue(v); err != nil {
+					return err
+				}
+				e.ordered.WriteString(ansiReset)
+				continue
+			}
+		}
+		if err := e.appendColorValue(v, depth+1); err != nil {
+			return err
+		}
+	}
+	if len(keys) > 0 {
+		e.appendIndent(depth)
+	}
+	e.ordered.WriteByte('}')
+	return nil
+}
+
+// appendColorValue adds a value below the top level.
+func (e *Emitter) appendColorValue(v any, depth int) error {
+	switch x := v.(type) {
+	case map[string]any:
+		return e.appendColorObject(x, nil, false, depth)
+	case []any:
+		e.ordered.WriteByte('[')
+		for i, item := range x {
+			if i > 0 {
+				e.ordered.WriteByte(',')
+			}
+			e.appendIndent(depth + 1)
+			if err := e.appendColorValue(item, depth+1); err != nil {
+				return err
+			}
+		}
+		if len(x) > 0 {
+			e.appendIndent(depth)
+		}
+		e.ordered.WriteByte(']')
+		return nil
+	case string:
+		if e.options.Highlight != nil {
+			return e.appendHighlighted(x)
+		}
+	}
+
+	if !e.options.Pretty {
+		return e.appendValue(v)
+	}
+	// Other types (say, []string from a transform) are indented as a whole
+	b, err := appendJSON(e.buf[:0], v)
+	if err != nil {
+		return err
+	}
+	e.buf = b
+	return json.Indent(&e.ordered, b, strings.Repeat("  ", depth), "  ")
+}
+
+// appendHighlighted adds a string value with Highlight matches reversed.
+// Each piece is escaped separately so escapes never straddle a color.
+func (e *Emitter) appendHighlighted(s string) error {
+	locs := e.options.Highlight.FindAllStringIndex(s, -1)
+	if len(locs) == 0 {
+		return e.appendValue(s)
+	}
+	e.ordered.WriteByte('"')
+	prev := 0
+	for _, loc := range locs {
+		if loc[0] == loc[1] {
+			continue
+		}
+		e.appendStringPart(s[prev:loc[0]])
+		e.ordered.WriteString(ansiReverse)
+		e.appendStringPart(s[loc[0]:loc[1]])
+		e.ordered.WriteString(ansiReset)
+		prev = loc[1]
+	}
+	e.appendStringPart(s[prev:])
+	e.ordered.WriteByte('"')
+	return nil
+}
+
+// appendStringPart adds part of a string value, escaped, without quotes.
+func (e *Emitter) appendStringPart(s string) {
+	e.ordered.Write(appendJSONEscaped(e.ordered.AvailableBuffer(), s))
+}
+
+// appendIndent starts a new line at depth when pretty-printing.
+func (e *Emitter) appendIndent(depth int) {
+	if !e.options.Pretty {
+		return
+	}
+	e.ordered.WriteByte('\n')
+	for i := 0; i < depth; i++ {
+		e.ordered.WriteString("  ")
+	}
+}
@@ -0,0 +1,108 @@
+package emitter
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func TestEmitter_Emit_Color(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   Options
+		fields map[string]any
+		want   string
+	}{
+		{
+			name:   "error level red",
+			fields: map[string]any{"level": "ERROR", "msg": "boom"},
+			want:   "{\"level\":\x1b[31m\"ERROR\"\x1b[0m,\"msg\":\"boom\"}\n",
+		},
+		{
+			name:   "warning level yellow",
+			fields: map[string]any{"severity": "warning"},
+			want:   "{\"severity\":\x1b[33m\"warning\"\x1b[0m}\n",
+		},
+		{
+			name:   "numeric level",
+			fields: map[string]any{"level": int64(50)},
+			want:   "{\"level\":\x1b[31m50\x1b[0m}\n",
+		},
+		{
+			name:   "info level plain",
+			fields: map[string]any{"level": "info"},
+			want:   "{\"level\":\"info\"}\n",
+		},
+		{
+			name:   "metadata keys dimmed",
+			opts:   Options{AddLineNumber: true},
+			fields: map[string]any{"msg": "hi"},
+			want:   "{\x1b[2m\"_lineNumber\"\x1b[0m:1,\"msg\":\"hi\"}\n",
+		},
+		{
+			name:   "highlight",
+			opts:   Options{Highlight: regexp.MustCompile(`time(out)?`)},
+			fields: map[string]any{"msg": "read timeout \"db\"", "n": 1, "tags": []any{"time"}},
+			want:   "{\"msg\":\"read \x1b[7mtimeout\x1b[0m \\\"db\\\"\",\"n\":1,\"tags\":[\"\x1b[7mtime\x1b[0m\"]}\n",
+		},
+		{
+			name:   "field order",
+			opts:   Options{FieldOrder: []string{"msg"}},
+			fields: map[string]any{"a": 1, "msg": "hi"},
+			want:   "{\"msg\":\"hi\",\"a\":1}\n",
+		},
+		{
+			name:   "pretty",
+			opts:   Options{Pretty: true},
+			fields: map[string]any{"level": "warn", "req": map[string]any{"ids": []any{1, 2}}, "empty": map[string]any{}},
+			want:   "{\n  \"empty\": {},\n  \"level\": \x1b[33m\"warn\"\x1b[0m,\n  \"req\": {\n    \"ids\": [\n      1,\n      2\n    ]\n  }\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.opts.Color = true
+			em := New(&buf, tt.opts)
+			entry := parser.NewEntry("raw")
+			entry.LineNum = 1
+			entry.Fields = tt.fields
+			if err := em.Emit(entry); err != nil {
+				t.Fatalf("Emit() error = %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Without ANSI sequences, colored output is the same JSON.
+func TestEmitter_Emit_ColorMatchesPlain(t *testing.T) {
+	fields := map[string]any{"level": "error", "msg": "a<b>&c", "nested": map[string]any{"x": []any{"y", nil, true}}}
+	ansi := regexp.MustCompile("\x1b\\[[0-9]+m")
+	for _, pretty := range []bool{false, true} {
+		var plain, colored bytes.Buffer
+		for _, out := range []struct {
+			buf   *bytes.Buffer
+			color bool
+		}{{&plain, false}, {&colored, true}} {
+			em := New(out.buf, Options{Pretty: pretty, Color: out.color, Highlight: regexp.MustCompile("b")})
+			entry := parser.NewEntry("raw")
+			entry.Fields = fields
+			if err := em.Emit(entry); err != nil {
+				t.Fatal(err)
+			}
+		}
+		stripped := ansi.ReplaceAllString(colored.String(), "")
+		if stripped != plain.String() {
+			t.Errorf("pretty=%v: colored %q, plain %q", pretty, stripped, plain.String())
+		}
+		if !json.Valid([]byte(stripped)) {
+			t.Errorf("pretty=%v: invalid JSON %q", pretty, stripped)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package emitter
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Output compression formats.
+const (
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+)
+
+// NewCompressor returns a writer that compresses what is written to it
+// into w, in the given format. Close finishes the compressed stream but
+// does not close w.
+func NewCompressor(w io.Writer, format string) (io.WriteCloser, error) {
+	switch format {
+	case CompressGzip:
+		return gzip.NewWriter(w), nil
+	case CompressZstd:
+		return newZstdWriter(w), nil
+	}
+	return nil, fmt.Errorf("unknown compression %q: must be %s or %s", format, CompressGzip, CompressZstd)
+}
@@ -0,0 +1,56 @@
+package emitter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+)
+
+func TestNewCompressor(t *testing.T) {
+	input := bytes.Repeat([]byte(`{"level":"info","msg":"hello"}`+"\n"), 100)
+	tests := []struct {
+		format string
+		decode func([]byte) ([]byte, error)
+	}{
+		{
+			format: CompressGzip,
+			decode: func(data []byte) ([]byte, error) {
+				zr, err := gzip.NewReader(bytes.NewReader(data))
+				if err != nil {
+					return nil, err
+				}
+				return io.ReadAll(zr)
+			},
+		},
+		{format: CompressZstd, decode: zstdDecode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewCompressor(&buf, tt.format)
+			if err != nil {
+				t.Fatalf("NewCompressor() error: %v", err)
+			}
+			_, _ = w.Write(input)
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close() error: %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Errorf("second Close() error: %v", err)
+			}
+			if buf.Len() >= len(input)/4 {
+				t.Errorf("compressed %d bytes to %d", len(input), buf.Len())
+			}
+			got, err := tt.decode(buf.Bytes())
+			if err != nil || !bytes.Equal(got, input) {
+				t.Errorf("round trip failed: %v", err)
+			}
+		})
+	}
+
+	if _, err := NewCompressor(io.Discard, "lz4"); err == nil {
+		t.Error("NewCompressor(lz4) expected error")
+	}
+}
@@ -0,0 +1,211 @@
+package emitter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// Elasticsearch output URL schemes: es:// for HTTP, es+https:// for TLS.
+const (
+	ESScheme      = "es"
+	ESHTTPSScheme = "es+https"
+)
+
+// ElasticsearchWriter indexes entries through the _bulk API, in batches.
+// Documents the cluster rejects with 429 are retried on their own; other
+// rejections are reported and dropped.
+type ElasticsearchWriter struct {
+	options  Options
+	endpoint string
+	action   []byte // bulk action line, with its newline
+	user     *url.Userinfo
+	apiKey   string
+	headers  http.Header
+	client   *http.Client
+	batch    *batcher
+}
+
+// ESOption configures an ElasticsearchWriter.
+type ESOption func(*ElasticsearchWriter)
+
+// WithESAPIKey authenticates with an API key (the base64 "id:key" form)
+// instead of the URL's basic auth credentials.
+func WithESAPIKey(key string) ESOption {
+	return func(w *ElasticsearchWriter) {
+		w.apiKey = key
+	}
+}
+
+// WithESHeaders sets headers, such as authentication, sent with each
+// request; an Authorization header replaces the URL's credentials.
+func WithESHeaders(h http.Header) ESOption {
+	return func(w *ElasticsearchWriter) {
+		w.headers = h
+	}
+}
+
+// IsESURL reports whether an output names an Elasticsearch index.
+func IsESURL(s string) bool {
+	return strings.HasPrefix(s, ESScheme+"://") || strings.HasPrefix(s, ESHTTPSScheme+"://")
+}
+
+// NewElasticsearch creates a writer for a URL of the form
+// es://[user:pass@]host:port/index (es+https:// for TLS).
+func NewElasticsearch(rawURL string, opts Options, batch BatchConfig, eopts ...ESOption) (*ElasticsearchWriter, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	scheme := "http"
+	switch u.Scheme {
+	case ESScheme:
+	case ESHTTPSScheme:
+		scheme = "https"
+	default:
+		return nil, fmt.Errorf("URL must start with %s:// or %s://", ESScheme, ESHTTPSScheme)
+	}
+	index := strings.Trim(u.Path, "/")
+	if u.Host == "" || index == "" || strings.Contains(index, "/") {
+		return nil, fmt.Errorf("URL must name a host and an index: %s://host:9200/index", ESScheme)
+	}
+
+	action, err := json.Marshal(map[string]any{"index": map[string]string{"_index": index}})
+	if err != nil {
+		return nil, err
+	}
+	w := &ElasticsearchWriter{
+		options:  opts,
+		endpoint: (&url.URL{Scheme: scheme, Host: u.Host, Path: "/_bulk"}).String(),
+		action:   append(action, '\n'),
+		user:     u.User,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, opt := range eopts {
+		opt(w)
+	}
+	w.batch = newBatcher(batch, w.send)
+	return w, nil
+}
+
+// Emit queues an entry, sending a bulk request when the batch is full.
+func (w *ElasticsearchWriter) Emit(entry *parser.Entry) error {
+	if w.options.OmitEmpty && entry.ParseError != nil {
+		return nil
+	}
+	doc, err := json.Marshal(buildOutput(&w.options, entry))
+	if err != nil {
+		return err
+	}
+	return w.batch.add(append(doc, '\n'))
+}
+
+// Close sends any queued entries.
+func (w *ElasticsearchWriter) Close() error {
+	return w.batch.close()
+}
+
+// bulkResponse is the part of a _bulk response needed to find rejected
+// documents.
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// send issues one _bulk request.
+func (w *ElasticsearchWriter) send(docs [][]byte) error {
+	var body bytes.Buffer
+	for _, doc := range docs {
+		body.Write(w.action)
+		body.Write(doc)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	for name, values := range w.headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if w.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+w.apiKey)
+	} else if w.user != nil && req.Header.Get("Authorization") == "" {
+		pass, _ := w.user.Password()
+		req.SetBasicAuth(w.user.Username(), pass)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return &retryableError{err: err}
+	}
+	defer func() { _ = resp.Body.Close() }()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return &retryableError{err: err}
+	}
+	if err := httpStatusError(resp, respBody); err != nil {
+		return err
+	}
+
+	var result bulkResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return fmt.Errorf("invalid _bulk response: %w", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+	return bulkError(docs, result)
+}
+
+// bulkError reports the documents a partially failed bulk request
+// rejected. If any were throttled (429), they alone are retried.
+func bulkError(docs [][]byte, result bulkResponse) error {
+	var retry [][]byte
+	var rejected int
+	var reason string
+	for i, item := range result.Items {
+		for _, r := range item {
+			switch {
+			case r.Status < 300:
+			case r.Status == http.StatusTooManyRequests && i < len(docs):
+				retry = append(retry, docs[i])
+			default:
+				rejected++
+				if reason == "" {
+					reason = r.Error.Type + ": " + r.Error.Reason
+				}
+			}
+		}
+	}
+
+	var rejectErr error
+	if rejected > 0 {
+		rejectErr = fmt.Errorf("%d of %d documents rejected (%s)", rejected, len(docs), reason)
+	}
+	switch {
+	case len(retry) > 0:
+		return &retryableError{
+			err:      fmt.Errorf("%d of %d documents throttled", len(retry), len(docs)),
+			items:    retry,
+			rejected: rejectErr,
+		}
+	case rejectErr != nil:
+		return &partialError{err: rejectErr}
+	}
+	return errors.New("bulk request reported errors")
+}
@@ -0,0 +1,194 @@
+package emitter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// bulkServer is a fake _bulk endpoint. reply decides each document's
+// status from its "msg" field and the attempt number.
+type bulkServer struct {
+	mu      sync.Mutex
+	reply   func(msg string, attempt int) int
+	auth    []string
+	actions []string
+	indexed []string
+	calls   int
+}
+
+func (s *bulkServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	s.auth = append(s.auth, r.Header.Get("Authorization"))
+
+	var items []map[string]any
+	hasErrors := false
+	sc := bufio.NewScanner(r.Body)
+	for sc.Scan() {
+		s.actions = append(s.actions, sc.Text())
+		if !sc.Scan() {
+			break
+		}
+		var doc map[string]any
+		_ = json.Unmarshal(sc.Bytes(), &doc)
+		msg, _ := doc["msg"].(string)
+
+		status := http.StatusCreated
+		if s.reply != nil {
+			status = s.reply(msg, s.calls)
+		}
+		item := map[string]any{"status": status}
+		if status >= 300 {
+			hasErrors = true
+			item["error"] = map[string]string{"type": "mapper_parsing_exception", "reason": "bad " + msg}
+		} else {
+			s.indexed = append(s.indexed, msg)
+		}
+		items = append(items, map[string]any{"index": item})
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"errors": hasErrors, "items": items})
+}
+
+func esEntry(msg string) *parser.Entry {
+	e := parser.NewEntry(msg)
+	e.Fields["msg"] = msg
+	return e
+}
+
+func newTestES(t *testing.T, srv *httptest.Server, path string, size int, opts ...ESOption) *ElasticsearchWriter {
+	t.Helper()
+	u := strings.Replace(srv.URL, "http://", "es://", 1) + path
+	w, err := NewElasticsearch(u, Options{}, BatchConfig{Size: size, Interval: time.Hour}, opts...)
+	if err != nil {
+		t.Fatalf("NewElasticsearch() error: %v", err)
+	}
+	w.batch.sleep = func(time.Duration) {}
+	return w
+}
+
+func TestElasticsearchWriter(t *testing.T) {
+	s := &bulkServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	w := newTestES(t, srv, "/logs", 2)
+	for _, msg := range []string{"a", "b", "c"} {
+		if err := w.Emit(esEntry(msg)); err != nil {
+			t.Fatalf("Emit() error: %v", err)
+		}
+	}
+	if s.calls != 1 {
+		t.Errorf("%d bulk requests before Close, want 1", s.calls)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	if got := strings.Join(s.indexed, ","); got != "a,b,c" {
+		t.Errorf("indexed %s, want a,b,c", got)
+	}
+	if s.actions[0] != `{"index":{"_index":"logs"}}` {
+		t.Errorf("action line = %s", s.actions[0])
+	}
+}
+
+func TestElasticsearchWriter_Auth(t *testing.T) {
+	s := &bulkServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	u := strings.Replace(srv.URL, "http://", "es://elastic:s3cret@", 1) + "/logs"
+	w, err := NewElasticsearch(u, Options{}, BatchConfig{Size: 1, Interval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewElasticsearch() error: %v", err)
+	}
+	_ = w.Emit(esEntry("a"))
+	_ = w.Close()
+
+	w = newTestES(t, srv, "/logs", 1, WithESAPIKey("a2V5"))
+	_ = w.Emit(esEntry("b"))
+	_ = w.Close()
+
+	// An Authorization header replaces the URL's credentials
+	w, err = NewElasticsearch(u, Options{}, BatchConfig{Size: 1, Interval: time.Hour},
+		WithESHeaders(http.Header{"Authorization": {"Bearer t0ken"}}))
+	if err != nil {
+		t.Fatalf("NewElasticsearch() error: %v", err)
+	}
+	_ = w.Emit(esEntry("c"))
+	_ = w.Close()
+
+	want := []string{"Basic ZWxhc3RpYzpzM2NyZXQ=", "ApiKey a2V5", "Bearer t0ken"}
+	if fmt.Sprint(s.auth) != fmt.Sprint(want) {
+		t.Errorf("Authorization = %v, want %v", s.auth, want)
+	}
+}
+
+func TestElasticsearchWriter_PartialFailure(t *testing.T) {
+	s := &bulkServer{reply: func(msg string, attempt int) int {
+		switch {
+		case msg == "bad":
+			return http.StatusBadRequest
+		case msg == "busy" && attempt == 1:
+			return http.StatusTooManyRequests
+		}
+		return http.StatusCreated
+	}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	w := newTestES(t, srv, "/logs", 3)
+	_ = w.Emit(esEntry("ok"))
+	_ = w.Emit(esEntry("busy"))
+	err := w.Emit(esEntry("bad"))
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 documents rejected (mapper_parsing_exception: bad bad)") {
+		t.Errorf("Emit() error = %v, want the rejected document reported", err)
+	}
+	_ = w.Close()
+
+	// Only the throttled document is resent.
+	if s.calls != 2 || strings.Join(s.indexed, ",") != "ok,busy" {
+		t.Errorf("calls = %d, indexed = %v", s.calls, s.indexed)
+	}
+}
+
+func TestElasticsearchWriter_Unavailable(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	w := newTestES(t, srv, "/logs", 1)
+	err := w.Emit(esEntry("a"))
+	if err == nil || !strings.Contains(err.Error(), "dropped 1 entries: 503") {
+		t.Errorf("Emit() error = %v", err)
+	}
+	if calls != defaultRetries+1 {
+		t.Errorf("server called %d times, want %d", calls, defaultRetries+1)
+	}
+	_ = w.Close()
+}
+
+func TestNewElasticsearch_Errors(t *testing.T) {
+	for _, u := range []string{"http://localhost:9200/logs", "es://localhost:9200", "es://localhost:9200/a/b", "es:///logs"} {
+		if _, err := NewElasticsearch(u, Options{}, BatchConfig{}); err == nil {
+			t.Errorf("NewElasticsearch(%q) expected error", u)
+		}
+	}
+}
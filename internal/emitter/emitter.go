@@ -2,9 +2,14 @@
 package emitter
 
 import (
-	"bufio"
+	"bytes"
 	"encoding/json"
 	"io"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/juliosaraiva/log2json/internal/parser"
@@ -20,6 +25,23 @@ type Options struct {
 	// Empty means output all fields.
 	Fields []string
 
+	// FieldOrder lists keys to write first, in this order; the rest
+	// follow sorted. Parquet and Avro order inferred columns the same way.
+	// Empty means all keys are sorted.
+	FieldOrder []string
+
+	// KeyPrefix is prepended to the name of every parsed field, and
+	// Namespace, if set, nests them all under one key. Metadata fields
+	// stay at the top level. Fields and FieldOrder use the names before
+	// and after these are applied, respectively.
+	KeyPrefix string
+	Namespace string
+
+	// GroupOutput writes every entry as an envelope: parsed fields under
+	// "fields", metadata under "meta" and errors under "error". See
+	// groupOutput.
+	GroupOutput bool
+
 	// AddTimestamp adds _ingestTime with current timestamp.
 	AddTimestamp bool
 
@@ -29,33 +51,58 @@ type Options struct {
 	// AddRaw includes the original line as _raw field.
 	AddRaw bool
 
+	// AddFormat adds _format, the name of the parser that produced the
+	// entry.
+	AddFormat bool
+
 	// OmitEmpty skips entries with parse errors.
 	OmitEmpty bool
+
+	// Host, if non-nil, is attached to every entry as the _host block.
+	// See HostMetadata.
+	Host map[string]any
+
+	// Color adds ANSI colors for terminals: error and warning levels in
+	// red and yellow, metadata keys dimmed.
+	Color bool
+
+	// Highlight, with Color, marks its matches in string values.
+	Highlight *regexp.Regexp
+
+	// FlushLines and FlushInterval batch writes: output is flushed every
+	// FlushLines entries and at most FlushInterval after an entry is
+	// written. With neither set, every entry is flushed at once, unless
+	// Buffering is BufferBlock.
+	FlushLines    int
+	FlushInterval time.Duration
+
+	// Buffering is BufferLine (the default) or BufferBlock, and
+	// BufferSize the bytes buffered before output is written regardless.
+	// Without it, BufferBlock starts at DefaultBufferSize, and a buffer
+	// that batches entries is resized to the entries written.
+	Buffering  BufferMode
+	BufferSize int
 }
 
 // Emitter serializes parsed log entries to JSON and writes to output.
 type Emitter struct {
-	writer  *bufio.Writer
+	writer  *flushWriter
 	options Options
-	encoder *json.Encoder
+
+	// The encoded entry, reused from one to the next
+	buf []byte
+
+	// For FieldOrder and Color: the object being built, and Pretty's
+	// indented copy of it
+	ordered bytes.Buffer
+	value   bytes.Buffer
 }
 
 // New creates a new JSON emitter writing to the given output.
 func New(output io.Writer, opts Options) *Emitter {
-	writer := bufio.NewWriter(output)
-	encoder := json.NewEncoder(writer)
-
-	if opts.Pretty {
-		encoder.SetIndent("", "  ")
-	}
-
-	// Don't escape HTML characters (cleaner output)
-	encoder.SetEscapeHTML(false)
-
 	return &Emitter{
-		writer:  writer,
+		writer:  newFlushWriter(output, opts),
 		options: opts,
-		encoder: encoder,
 	}
 }
 
@@ -68,26 +115,119 @@ func (e *Emitter) Emit(entry *parser.Entry) error {
 	}
 
 	// Build output object
-	output := e.buildOutput(entry)
+	output := buildOutput(&e.options, entry)
 
 	// Encode and write
-	if err := e.encoder.Encode(output); err != nil {
+	if e.options.Color {
+		if err := e.encodeColor(output); err != nil {
+			return err
+		}
+	} else if len(e.options.FieldOrder) > 0 {
+		if err := e.encodeOrdered(output); err != nil {
+			return err
+		}
+	} else if err := e.encode(output); err != nil {
 		return err
 	}
 
-	// Flush immediately for real-time output
-	return e.writer.Flush()
+	// Flush for real-time output, unless batching
+	return e.writer.entryDone()
+}
+
+// encode writes output as encoding/json would, keys sorted.
+func (e *Emitter) encode(output map[string]any) error {
+	b, err := appendJSON(e.buf[:0], output)
+	if err != nil {
+		return err
+	}
+	e.buf = b
+	if e.options.Pretty {
+		e.value.Reset()
+		if err := json.Indent(&e.value, b, "", "  "); err != nil {
+			return err
+		}
+		e.value.WriteByte('\n')
+		_, err = e.writer.Write(e.value.Bytes())
+		return err
+	}
+	e.buf = append(e.buf, '\n')
+	_, err = e.writer.Write(e.buf)
+	return err
+}
+
+// encodeOrdered writes output with its keys in FieldOrder. encoding/json
+// always sorts map keys, so the object is assembled by hand.
+func (e *Emitter) encodeOrdered(output map[string]any) error {
+	e.ordered.Reset()
+	e.ordered.WriteByte('{')
+	for i, k := range orderKeys(output, e.options.FieldOrder) {
+		if i > 0 {
+			e.ordered.WriteByte(',')
+		}
+		if err := e.appendValue(k); err != nil {
+			return err
+		}
+		e.ordered.WriteByte(':')
+		if err := e.appendValue(output[k]); err != nil {
+			return err
+		}
+	}
+	e.ordered.WriteByte('}')
+
+	out := &e.ordered
+	if e.options.Pretty {
+		e.value.Reset()
+		if err := json.Indent(&e.value, e.ordered.Bytes(), "", "  "); err != nil {
+			return err
+		}
+		out = &e.value
+	}
+	out.WriteByte('\n')
+	_, err := e.writer.Write(out.Bytes())
+	return err
+}
+
+// appendValue adds v to the object being built, encoded like the rest of
+// the output.
+func (e *Emitter) appendValue(v any) error {
+	b, err := appendJSON(e.ordered.AvailableBuffer(), v)
+	if err != nil {
+		return err
+	}
+	e.ordered.Write(b)
+	return nil
+}
+
+// orderKeys returns the keys of m: those in order first, in that order,
+// then the rest sorted.
+func orderKeys(m map[string]any, order []string) []string {
+	keys := make([]string, 0, len(m))
+	first := make(map[string]bool, len(order))
+	for _, k := range order {
+		if _, ok := m[k]; ok && !first[k] {
+			keys = append(keys, k)
+			first[k] = true
+		}
+	}
+	n := len(keys)
+	for k := range m {
+		if !first[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys[n:])
+	return keys
 }
 
 // buildOutput constructs the output map from an entry.
-func (e *Emitter) buildOutput(entry *parser.Entry) map[string]any {
+func buildOutput(opts *Options, entry *parser.Entry) map[string]any {
 	// Start with entry fields or create new map
 	var output map[string]any
 
-	if len(e.options.Fields) > 0 {
+	if len(opts.Fields) > 0 {
 		// Filter to only requested fields
 		output = make(map[string]any)
-		for _, field := range e.options.Fields {
+		for _, field := range opts.Fields {
 			if val, ok := entry.Fields[field]; ok {
 				output[field] = val
 			}
@@ -100,27 +240,109 @@ func (e *Emitter) buildOutput(entry *parser.Entry) map[string]any {
 		}
 	}
 
+	// Keep parsed fields clear of keys in documents they are merged into
+	if opts.KeyPrefix != "" {
+		prefixed := make(map[string]any, len(output)+3)
+		for k, v := range output {
+			prefixed[opts.KeyPrefix+k] = v
+		}
+		output = prefixed
+	}
+	if opts.Namespace != "" {
+		output = map[string]any{opts.Namespace: output}
+	}
+
 	// Add metadata fields (prefixed with _)
-	if e.options.AddTimestamp {
+	if opts.AddTimestamp {
 		output["_ingestTime"] = time.Now().UTC().Format(time.RFC3339Nano)
 	}
 
-	if e.options.AddLineNumber {
+	if opts.AddLineNumber {
 		output["_lineNumber"] = entry.LineNum
 	}
 
-	if e.options.AddRaw {
+	if opts.AddRaw {
 		output["_raw"] = entry.Raw
 	}
 
+	if opts.AddFormat && entry.Format != "" {
+		output["_format"] = entry.Format
+	}
+
+	if opts.Host != nil {
+		output["_host"] = opts.Host
+	}
+
 	// Add parse error if present
 	if entry.ParseError != nil {
 		output["_parseError"] = entry.ParseError.Error()
 	}
 
+	if opts.GroupOutput {
+		output = groupOutput(output)
+	}
 	return output
 }
 
+// groupOutput turns a flat output map into the GroupOutput envelope.
+// Keys starting with _ are metadata, whether added here or by a
+// transform; those ending in Error (_parseError, _scriptError, ...) go
+// under "error", the rest under "meta", both without the _ prefix or
+// Error suffix. Everything else goes under "fields", which is always
+// present; "meta" and "error" only when not empty.
+func groupOutput(flat map[string]any) map[string]any {
+	fields := make(map[string]any, len(flat))
+	meta := make(map[string]any)
+	errs := make(map[string]any)
+	for k, v := range flat {
+		name, isMeta := strings.CutPrefix(k, "_")
+		switch {
+		case !isMeta || name == "":
+			fields[k] = v
+		case strings.HasSuffix(name, "Error") && name != "Error":
+			errs[strings.TrimSuffix(name, "Error")] = v
+		default:
+			meta[name] = v
+		}
+	}
+
+	grouped := map[string]any{"fields": fields}
+	if len(meta) > 0 {
+		grouped["meta"] = meta
+	}
+	if len(errs) > 0 {
+		grouped["error"] = errs
+	}
+	return grouped
+}
+
+// HostMetadata collects the _host block: hostname, OS, architecture,
+// process ID and log2json version, plus the named environment variables
+// under "env" (unset variables are omitted).
+func HostMetadata(version string, envVars []string) map[string]any {
+	host := map[string]any{
+		"os":      runtime.GOOS,
+		"arch":    runtime.GOARCH,
+		"pid":     os.Getpid(),
+		"version": version,
+	}
+	if name, err := os.Hostname(); err == nil {
+		host["hostname"] = name
+	}
+
+	if len(envVars) > 0 {
+		env := make(map[string]string, len(envVars))
+		for _, k := range envVars {
+			if v, ok := os.LookupEnv(k); ok {
+				env[k] = v
+			}
+		}
+		host["env"] = env
+	}
+
+	return host
+}
+
 // Close flushes any remaining data.
 func (e *Emitter) Close() error {
 	return e.writer.Flush()
@@ -143,6 +143,104 @@ func TestEmitter_Emit_AddLineNumber(t *testing.T) {
 	}
 }
 
+func TestEmitter_Emit_KeyPrefixNamespace(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{
+			name: "prefix",
+			opts: Options{KeyPrefix: "app_", AddLineNumber: true},
+			want: `{"_lineNumber":3,"app_message":"hi","app_timestamp":"t"}`,
+		},
+		{
+			name: "namespace",
+			opts: Options{Namespace: "app", AddLineNumber: true},
+			want: `{"_lineNumber":3,"app":{"message":"hi","timestamp":"t"}}`,
+		},
+		{
+			name: "both, with field selection",
+			opts: Options{KeyPrefix: "x.", Namespace: "app", Fields: []string{"message"}},
+			want: `{"app":{"x.message":"hi"}}`,
+		},
+		{
+			name: "field order uses prefixed names",
+			opts: Options{KeyPrefix: "app_", FieldOrder: []string{"app_timestamp"}},
+			want: `{"app_timestamp":"t","app_message":"hi"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			em := New(&buf, tt.opts)
+			entry := parser.NewEntry("raw")
+			entry.Fields["message"] = "hi"
+			entry.Fields["timestamp"] = "t"
+			entry.LineNum = 3
+			if err := em.Emit(entry); err != nil {
+				t.Fatalf("Emit returned error: %v", err)
+			}
+			if got := strings.TrimSpace(buf.String()); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmitter_Emit_GroupOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   Options
+		fields map[string]any
+		err    error
+		want   string
+	}{
+		{
+			name:   "fields only",
+			fields: map[string]any{"level": "info", "msg": "hi"},
+			want:   `{"fields":{"level":"info","msg":"hi"}}`,
+		},
+		{
+			name:   "metadata",
+			opts:   Options{AddLineNumber: true, AddRaw: true},
+			fields: map[string]any{"msg": "hi", "_seq": 2},
+			want:   `{"fields":{"msg":"hi"},"meta":{"lineNumber":7,"raw":"raw line","seq":2}}`,
+		},
+		{
+			name:   "errors",
+			fields: map[string]any{"_raw": "x", "_scriptError": "boom"},
+			err:    errors.New("no parser matched"),
+			want:   `{"error":{"parse":"no parser matched","script":"boom"},"fields":{},"meta":{"raw":"x"}}`,
+		},
+		{
+			name:   "namespace inside fields",
+			opts:   Options{Namespace: "app"},
+			fields: map[string]any{"msg": "hi"},
+			want:   `{"fields":{"app":{"msg":"hi"}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.opts.GroupOutput = true
+			em := New(&buf, tt.opts)
+			entry := parser.NewEntry("raw line")
+			entry.Fields = tt.fields
+			entry.LineNum = 7
+			entry.ParseError = tt.err
+			if err := em.Emit(entry); err != nil {
+				t.Fatalf("Emit returned error: %v", err)
+			}
+			if got := strings.TrimSpace(buf.String()); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestEmitter_Emit_AddTimestamp(t *testing.T) {
 	var buf bytes.Buffer
 	em := New(&buf, Options{AddTimestamp: true})
@@ -205,6 +303,38 @@ func TestEmitter_Emit_AddRaw(t *testing.T) {
 	}
 }
 
+func TestEmitter_Emit_AddFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		want   any
+	}{
+		{name: "parsed", format: "syslog", want: "syslog"},
+		{name: "no parser", format: "", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			em := New(&buf, Options{AddFormat: true})
+
+			entry := parser.NewEntry("line")
+			entry.Format = tt.format
+			if err := em.Emit(entry); err != nil {
+				t.Fatalf("Emit returned error: %v", err)
+			}
+
+			var decoded map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+				t.Fatalf("output is not valid JSON: %v", err)
+			}
+			if decoded["_format"] != tt.want {
+				t.Errorf("_format = %v, want %v", decoded["_format"], tt.want)
+			}
+		})
+	}
+}
+
 func TestEmitter_Emit_OmitEmpty(t *testing.T) {
 	var buf bytes.Buffer
 	em := New(&buf, Options{OmitEmpty: true})
@@ -314,6 +444,83 @@ func TestEmitter_Emit_HTMLEscaping(t *testing.T) {
 	}
 }
 
+func TestEmitter_Emit_SortedKeys(t *testing.T) {
+	var buf bytes.Buffer
+	em := New(&buf, Options{AddLineNumber: true})
+
+	entry := parser.NewEntry("x")
+	entry.LineNum = 3
+	entry.Fields["zeta"] = 1
+	entry.Fields["Alpha"] = 2
+	entry.Fields["mid"] = map[string]any{"b": true, "a": []any{map[string]any{"y": 1, "x": 2}}}
+	entry.Fields["_tag"] = "t"
+
+	// Output is stable across runs: keys sort bytewise at every level,
+	// so diffs and golden files of output work.
+	want := `{"Alpha":2,"_lineNumber":3,"_tag":"t","mid":{"a":[{"x":2,"y":1}],"b":true},"zeta":1}` + "\n"
+	for i := 0; i < 20; i++ {
+		buf.Reset()
+		if err := em.Emit(entry); err != nil {
+			t.Fatalf("Emit returned error: %v", err)
+		}
+		if buf.String() != want {
+			t.Fatalf("got %s, want %s", buf.String(), want)
+		}
+	}
+}
+
+func TestEmitter_Emit_FieldOrder(t *testing.T) {
+	fields := map[string]any{
+		"message":   "<b>hi</b>",
+		"level":     "info",
+		"timestamp": "2024-01-15T10:00:00Z",
+		"zeta":      1,
+		"alpha":     map[string]any{"y": 1, "x": 2},
+	}
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{
+			name: "named keys first, rest sorted",
+			opts: Options{FieldOrder: []string{"timestamp", "level", "message"}},
+			want: `{"timestamp":"2024-01-15T10:00:00Z","level":"info","message":"<b>hi</b>","alpha":{"x":2,"y":1},"zeta":1}` + "\n",
+		},
+		{
+			name: "absent and repeated keys skipped",
+			opts: Options{FieldOrder: []string{"missing", "zeta", "zeta"}},
+			want: `{"zeta":1,"alpha":{"x":2,"y":1},"level":"info","message":"<b>hi</b>","timestamp":"2024-01-15T10:00:00Z"}` + "\n",
+		},
+		{
+			name: "metadata can be ordered",
+			opts: Options{FieldOrder: []string{"_lineNumber", "level"}, AddLineNumber: true, Fields: []string{"level", "zeta"}},
+			want: `{"_lineNumber":4,"level":"info","zeta":1}` + "\n",
+		},
+		{
+			name: "pretty",
+			opts: Options{FieldOrder: []string{"zeta"}, Fields: []string{"level", "zeta"}, Pretty: true},
+			want: "{\n  \"zeta\": 1,\n  \"level\": \"info\"\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			em := New(&buf, tt.opts)
+			entry := parser.NewEntry("x")
+			entry.LineNum = 4
+			entry.Fields = fields
+			if err := em.Emit(entry); err != nil {
+				t.Fatalf("Emit returned error: %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("got  %s\nwant %s", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
 func TestEmitter_Close(t *testing.T) {
 	var buf bytes.Buffer
 	em := New(&buf, Options{})
@@ -343,3 +550,46 @@ func TestEmitter_Close(t *testing.T) {
 		t.Errorf("expected msg=%q, got %v", "flush check", decoded["msg"])
 	}
 }
+
+func TestEmitter_Emit_Host(t *testing.T) {
+	t.Setenv("LOG2JSON_TEST_REGION", "eu-west-1")
+
+	var buf bytes.Buffer
+	em := New(&buf, Options{Host: HostMetadata("1.2.3", []string{"LOG2JSON_TEST_REGION", "LOG2JSON_TEST_UNSET"})})
+
+	entry := parser.NewEntry("line")
+	entry.Fields["msg"] = "test"
+
+	if err := em.Emit(entry); err != nil {
+		t.Fatalf("Emit returned error: %v", err)
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+
+	host, ok := decoded["_host"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected _host object, got %v", decoded["_host"])
+	}
+	if host["version"] != "1.2.3" {
+		t.Errorf("expected version=1.2.3, got %v", host["version"])
+	}
+	for _, key := range []string{"os", "arch", "pid", "hostname"} {
+		if _, ok := host[key]; !ok {
+			t.Errorf("expected %s in _host", key)
+		}
+	}
+
+	env, ok := host["env"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected env object, got %v", host["env"])
+	}
+	if env["LOG2JSON_TEST_REGION"] != "eu-west-1" {
+		t.Errorf("expected region env var, got %v", env["LOG2JSON_TEST_REGION"])
+	}
+	if _, ok := env["LOG2JSON_TEST_UNSET"]; ok {
+		t.Error("unset env var should be omitted")
+	}
+}
@@ -0,0 +1,136 @@
+package emitter
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// marshal encodes v as the emitter did before appendJSON.
+func marshal(v any) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSuffix(buf.Bytes(), []byte{'\n'})), nil
+}
+
+type level string
+
+func TestAppendJSON_MatchesEncodingJSON(t *testing.T) {
+	values := []any{
+		nil,
+		"",
+		"plain",
+		`quote " backslash \ slash /`,
+		"<html> & 'amp'",
+		"tab\tnewline\nreturn\rbell\afeed\fback\bnul\x00unit\x1fdel\x7f",
+		"café ünïcödé 日本語 😀",
+		"line para sep",
+		"bad \xff\xfe utf8 \xc3",
+		"truncated \xe2\x82",
+		true,
+		false,
+		0,
+		-42,
+		int64(math.MaxInt64),
+		int64(math.MinInt64),
+		int32(-7),
+		uint(7),
+		uint64(math.MaxUint64),
+		0.0,
+		math.Copysign(0, -1),
+		1.5,
+		-3.25,
+		1e20,
+		1e21,
+		123456789e15,
+		1e-6,
+		1e-7,
+		-2.5e-9,
+		1.2345e-300,
+		5e-324,
+		math.MaxFloat64,
+		float32(0.1),
+		float32(1e-7),
+		float32(1e21),
+		float32(3.4e38),
+		map[string]any{},
+		map[string]any(nil),
+		map[string]any{"b": 1, "a": "x", "c": map[string]any{"z": nil, "y": []any{1.5, "s", true}}},
+		map[string]string{"k2": "v\n2", "k1": "v1"},
+		map[string]string(nil),
+		[]any{},
+		[]any(nil),
+		[]any{nil, 1, "two", []any{3}},
+		[]string{"a", "b\"c"},
+		[]string(nil),
+		json.Number("12.5"),
+		time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+		level("warn"),
+		map[string]any{"when": time.Unix(0, 0).UTC(), "tags": []int{1, 2}},
+		struct{ A string }{"<b>"},
+	}
+
+	// Strings of random bytes, leaning on the ones that need escaping
+	rng := rand.New(rand.NewSource(1))
+	pool := []byte("ab \"\\\n\t\x00\x1f\x7f<>&\xc3\xa9\xe2\x80\xa8\xa9\xff\xf0\x9f\x98\x80")
+	for i := 0; i < 500; i++ {
+		b := make([]byte, rng.Intn(12))
+		for j := range b {
+			b[j] = pool[rng.Intn(len(pool))]
+		}
+		values = append(values, string(b), map[string]any{string(b): i})
+	}
+
+	for _, v := range values {
+		want, err := marshal(v)
+		if err != nil {
+			t.Fatalf("marshal(%#v): %v", v, err)
+		}
+		got, err := appendJSON(nil, v)
+		if err != nil {
+			t.Fatalf("appendJSON(%#v): %v", v, err)
+		}
+		if string(got) != want {
+			t.Errorf("appendJSON(%#v) = %s, want %s", v, got, want)
+		}
+	}
+}
+
+func TestAppendJSON_Appends(t *testing.T) {
+	got, err := appendJSON([]byte("prefix "), map[string]any{"a": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `prefix {"a":1}` {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestAppendJSON_UnsupportedValues(t *testing.T) {
+	tests := []struct {
+		name string
+		v    any
+	}{
+		{"NaN", math.NaN()},
+		{"+Inf", math.Inf(1)},
+		{"-Inf float32", float32(math.Inf(-1))},
+		{"nested NaN", map[string]any{"a": []any{math.NaN()}}},
+		{"channel", make(chan int)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, want := marshal(tt.v)
+			_, err := appendJSON(nil, tt.v)
+			if err == nil || want == nil || err.Error() != want.Error() {
+				t.Errorf("err = %v, want %v", err, want)
+			}
+		})
+	}
+}
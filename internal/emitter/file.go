@@ -0,0 +1,84 @@
+package emitter
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// OpenOutputFile opens path for writing, creating it if needed. It is
+// truncated, or with appendExisting written after its current contents.
+func OpenOutputFile(path string, appendExisting bool) (*os.File, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendExisting {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	return os.OpenFile(path, flags, 0o666) // #nosec G304 -- the user's --output path
+}
+
+// AtomicFile is a file writer that replaces its path only once it is
+// closed: it writes to a temporary file in the same directory, then
+// renames it over path, so readers never see a partial file. If a write
+// fails, Close removes the temporary file and leaves path as it was.
+type AtomicFile struct {
+	path string
+	tmp  *os.File
+	err  error
+}
+
+// NewAtomicFile starts writing a replacement for path. The new file gets
+// the permissions of the one it replaces, or 0644.
+func NewAtomicFile(path string) (*AtomicFile, error) {
+	mode := fs.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return nil, err
+	}
+	return &AtomicFile{path: path, tmp: tmp}, nil
+}
+
+// Write writes p to the temporary file.
+func (f *AtomicFile) Write(p []byte) (int, error) {
+	if f.tmp == nil {
+		return 0, os.ErrClosed
+	}
+	n, err := f.tmp.Write(p)
+	if err != nil && f.err == nil {
+		f.err = err
+	}
+	return n, err
+}
+
+// Close syncs the temporary file and renames it to path.
+func (f *AtomicFile) Close() error {
+	if f.tmp == nil {
+		return nil
+	}
+	tmp := f.tmp
+	f.tmp = nil
+
+	err := f.err
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return errors.Join(errors.New("output file not replaced"), err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package emitter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenOutputFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out")
+	if err := os.WriteFile(path, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		append bool
+		want   string
+	}{
+		{name: "truncates", want: "new\n"},
+		{name: "appends", append: true, want: "new\nnew\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := OpenOutputFile(path, tt.append)
+			if err != nil {
+				t.Fatalf("OpenOutputFile() error: %v", err)
+			}
+			_, _ = f.WriteString("new\n")
+			_ = f.Close()
+			if got := readRotated(t, path); got != tt.want {
+				t.Errorf("file = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAtomicFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out")
+	if err := os.WriteFile(path, []byte("old\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewAtomicFile(path)
+	if err != nil {
+		t.Fatalf("NewAtomicFile() error: %v", err)
+	}
+	_, _ = f.Write([]byte("new\n"))
+
+	// The old contents stay until Close
+	if got := readRotated(t, path); got != "old\n" {
+		t.Errorf("before Close, file = %q, want old", got)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+	if got := readRotated(t, path); got != "new\n" {
+		t.Errorf("after Close, file = %q, want new", got)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, %v; want the replaced file's 0600", info.Mode().Perm(), err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("directory has %d files, want the temporary file gone", len(entries))
+	}
+}
+
+func TestAtomicFile_WriteError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out")
+	if err := os.WriteFile(path, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewAtomicFile(path)
+	if err != nil {
+		t.Fatalf("NewAtomicFile() error: %v", err)
+	}
+	// Closing the temporary file behind its back makes the next write fail
+	_ = f.tmp.Close()
+	if _, err := f.Write([]byte("new\n")); err == nil {
+		t.Fatal("Write() expected error, got nil")
+	}
+	if err := f.Close(); err == nil {
+		t.Error("Close() expected error, got nil")
+	}
+	if got := readRotated(t, path); got != "old\n" {
+		t.Errorf("file = %q, want it unchanged", got)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("directory has %d files, want the temporary file removed", len(entries))
+	}
+}
@@ -0,0 +1,186 @@
+package emitter
+
+import (
+	"bufio"
+	"io"
+	"sync"
+	"time"
+)
+
+// BufferMode says when buffered output is written out.
+type BufferMode string
+
+// Output buffering modes.
+const (
+	// BufferLine flushes after every entry, unless FlushLines or
+	// FlushInterval batch them. It is the default.
+	BufferLine BufferMode = "line"
+
+	// BufferBlock writes output out once BufferSize bytes are buffered,
+	// and also every FlushLines entries or FlushInterval, if set.
+	BufferBlock BufferMode = "block"
+)
+
+// DefaultBufferSize is the output buffer of BufferBlock, if BufferSize is
+// not set. Line buffering defaults to bufio's smaller buffer, which only
+// an entry longer than it fills.
+const DefaultBufferSize = 64 * 1024
+
+// Without BufferSize, a buffer that batches entries (BufferBlock,
+// FlushLines or FlushInterval) adapts to them: once adaptiveSamples
+// entries are seen, it is resized between writes to hold about
+// adaptiveEntries entries (or FlushLines, if set) of their average size,
+// within minAdaptiveBuffer and maxAdaptiveBuffer.
+const (
+	adaptiveEntries   = 512
+	adaptiveSamples   = 64
+	minAdaptiveBuffer = 4 * 1024
+	maxAdaptiveBuffer = 1024 * 1024
+)
+
+// flushWriter buffers a writer's output and flushes it as Options say:
+// after every entry by default, or every FlushLines entries and at most
+// FlushInterval after the oldest unflushed one. With BufferBlock, output
+// is also written whenever the buffer fills. Each Write must hold a whole
+// entry, so that a timed flush never splits one.
+type flushWriter struct {
+	mu       sync.Mutex
+	w        *bufio.Writer
+	out      io.Writer
+	block    bool
+	lines    int
+	interval time.Duration
+	pending  int         // entries written since the last flush
+	timer    *time.Timer // pending timed flush
+	err      error       // from a timed flush, returned by the next call
+
+	// For an adaptive buffer: the average entry size, and the entries
+	// seen, up to adaptiveSamples
+	adaptive bool
+	average  int
+	seen     int
+}
+
+func newFlushWriter(output io.Writer, opts Options) *flushWriter {
+	block := opts.Buffering == BufferBlock
+	size := opts.BufferSize
+	if size <= 0 && block {
+		size = DefaultBufferSize
+	}
+	var w *bufio.Writer
+	if size > 0 {
+		w = bufio.NewWriterSize(output, size)
+	} else {
+		w = bufio.NewWriter(output)
+	}
+	return &flushWriter{
+		w:        w,
+		out:      output,
+		block:    block,
+		lines:    opts.FlushLines,
+		interval: opts.FlushInterval,
+		adaptive: opts.BufferSize <= 0 && (block || opts.FlushLines > 0 || opts.FlushInterval > 0),
+	}
+}
+
+// Write buffers one entry.
+func (f *flushWriter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.adaptive {
+		f.observe(len(p))
+		if len(p) > f.w.Available() && f.w.Buffered() > 0 {
+			// Write out the entries before this one whole, and resize
+			// while the buffer is empty
+			if err := f.w.Flush(); err != nil {
+				return 0, err
+			}
+		}
+		if f.w.Buffered() == 0 {
+			f.resize()
+		}
+	}
+	return f.w.Write(p)
+}
+
+// observe adds an entry of n bytes to the average.
+func (f *flushWriter) observe(n int) {
+	if f.seen == 0 {
+		f.average = n
+	} else {
+		f.average += (n - f.average) / 16
+	}
+	if f.seen < adaptiveSamples {
+		f.seen++
+	}
+}
+
+// resize replaces the empty buffer with one sized to the entries seen, if
+// that is over twice as large or under half as large.
+func (f *flushWriter) resize() {
+	if f.seen < adaptiveSamples {
+		return
+	}
+	batch := adaptiveEntries
+	if f.lines > 0 {
+		batch = min(f.lines, maxAdaptiveBuffer)
+	}
+	size := min(max(f.average*batch, minAdaptiveBuffer), maxAdaptiveBuffer)
+	if current := f.w.Size(); size <= 2*current && 2*size >= current {
+		return
+	}
+	f.w = bufio.NewWriterSize(f.out, size)
+}
+
+// entryDone counts a written entry and flushes if one is due.
+func (f *flushWriter) entryDone() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.pending++
+	switch {
+	case f.lines <= 0 && f.interval <= 0 && !f.block:
+		return f.flushLocked()
+	case f.lines > 0 && f.pending >= f.lines:
+		return f.flushLocked()
+	case f.interval > 0 && f.timer == nil:
+		f.timer = time.AfterFunc(f.interval, f.timedFlush)
+	}
+	return f.takeErr()
+}
+
+// Flush writes out anything buffered.
+func (f *flushWriter) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.flushLocked()
+}
+
+func (f *flushWriter) flushLocked() error {
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	f.pending = 0
+	if err := f.w.Flush(); err != nil {
+		return err
+	}
+	return f.takeErr()
+}
+
+func (f *flushWriter) timedFlush() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.timer = nil
+	f.pending = 0
+	if err := f.w.Flush(); err != nil && f.err == nil {
+		f.err = err
+	}
+}
+
+// takeErr returns and clears the error of an earlier timed flush.
+func (f *flushWriter) takeErr() error {
+	err := f.err
+	f.err = nil
+	return err
+}
@@ -0,0 +1,193 @@
+package emitter
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// lockedBuffer is a bytes.Buffer safe for use by timed flushes.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) lines() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Count(b.buf.String(), "\n")
+}
+
+func TestEmitter_FlushLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines int
+		want  []int // lines written after each of 5 entries
+	}{
+		{name: "every entry by default", want: []int{1, 2, 3, 4, 5}},
+		{name: "every entry", lines: 1, want: []int{1, 2, 3, 4, 5}},
+		{name: "every 2", lines: 2, want: []int{0, 2, 2, 4, 4}},
+		{name: "every 10", lines: 10, want: []int{0, 0, 0, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out lockedBuffer
+			em := New(&out, Options{FlushLines: tt.lines})
+			for i, want := range tt.want {
+				if err := em.Emit(&parser.Entry{Fields: map[string]any{"n": i}}); err != nil {
+					t.Fatal(err)
+				}
+				if got := out.lines(); got != want {
+					t.Errorf("after entry %d: %d lines written, want %d", i+1, got, want)
+				}
+			}
+			if err := em.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.lines(); got != len(tt.want) {
+				t.Errorf("after Close: %d lines written, want %d", got, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestEmitter_Buffering(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want []int // lines written after each of 8 entries of 8 bytes
+	}{
+		{name: "line", opts: Options{Buffering: BufferLine}, want: []int{1, 2, 3, 4, 5, 6, 7, 8}},
+		{name: "block", opts: Options{Buffering: BufferBlock}, want: []int{0, 0, 0, 0, 0, 0, 0, 0}},
+		{name: "block fills", opts: Options{Buffering: BufferBlock, BufferSize: 20}, want: []int{0, 0, 2, 2, 2, 5, 5, 7}},
+		{name: "block every 3", opts: Options{Buffering: BufferBlock, FlushLines: 3}, want: []int{0, 0, 3, 3, 3, 6, 6, 6}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out lockedBuffer
+			em := New(&out, tt.opts)
+			for i, want := range tt.want {
+				if err := em.Emit(&parser.Entry{Fields: map[string]any{"n": i}}); err != nil {
+					t.Fatal(err)
+				}
+				if got := out.lines(); got != want {
+					t.Errorf("after entry %d: %d lines written, want %d", i+1, got, want)
+				}
+			}
+			if err := em.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.lines(); got != len(tt.want) {
+				t.Errorf("after Close: %d lines written, want %d", got, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestEmitter_FlushInterval(t *testing.T) {
+	var out lockedBuffer
+	em := New(&out, Options{FlushLines: 100, FlushInterval: 20 * time.Millisecond})
+	defer func() { _ = em.Close() }()
+
+	for i := 0; i < 3; i++ {
+		if err := em.Emit(&parser.Entry{Fields: map[string]any{"n": i}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := out.lines(); got != 0 {
+		t.Fatalf("%d lines written before the interval, want 0", got)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for out.lines() != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d lines written after the interval, want 3", out.lines())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestTemplateWriter_FlushLines(t *testing.T) {
+	var out lockedBuffer
+	tmpl, err := ParseTemplate("{{.msg}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewTemplate(&out, Options{FlushLines: 2}, tmpl)
+	_ = w.Emit(&parser.Entry{Fields: map[string]any{"msg": "a"}})
+	if got := out.lines(); got != 0 {
+		t.Errorf("%d lines written after 1 entry, want 0", got)
+	}
+	_ = w.Emit(&parser.Entry{Fields: map[string]any{"msg": "b"}})
+	if got := out.lines(); got != 2 {
+		t.Errorf("%d lines written after 2 entries, want 2", got)
+	}
+}
+
+// writeRecorder records the size of each write.
+type writeRecorder struct {
+	writes []int
+	split  bool // a write ended mid-entry
+}
+
+func (w *writeRecorder) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, len(p))
+	if len(p) > 0 && p[len(p)-1] != '\n' {
+		w.split = true
+	}
+	return len(p), nil
+}
+
+func TestFlushWriter_AdaptsToEntries(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		entry int // bytes per entry, with its newline
+		want  int // buffer size after 20000 entries
+	}{
+		{name: "block, small entries", opts: Options{Buffering: BufferBlock}, entry: 20, want: 20 * adaptiveEntries},
+		{name: "block, tiny entries", opts: Options{Buffering: BufferBlock}, entry: 4, want: minAdaptiveBuffer},
+		{name: "block, large entries", opts: Options{Buffering: BufferBlock}, entry: 10000, want: maxAdaptiveBuffer},
+		{name: "block, entries as expected", opts: Options{Buffering: BufferBlock}, entry: 100, want: DefaultBufferSize},
+		{name: "every 100 lines", opts: Options{FlushLines: 100}, entry: 300, want: 30000},
+		{name: "block, fixed size", opts: Options{Buffering: BufferBlock, BufferSize: 8192}, entry: 10000, want: 8192},
+		{name: "line", opts: Options{}, entry: 10000, want: 4096},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out writeRecorder
+			f := newFlushWriter(&out, tt.opts)
+			entry := append(bytes.Repeat([]byte("x"), tt.entry-1), '\n')
+			for i := 0; i < 20000; i++ {
+				if _, err := f.Write(entry); err != nil {
+					t.Fatal(err)
+				}
+				if err := f.entryDone(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := f.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := f.w.Size(); got != tt.want {
+				t.Errorf("buffer = %d bytes, want %d", got, tt.want)
+			}
+			if f.adaptive && out.split {
+				t.Error("an adaptive buffer split an entry across writes")
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package emitter
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/forward"
+	"github.com/juliosaraiva/log2json/internal/parser"
+	"github.com/juliosaraiva/log2json/internal/transform"
+)
+
+// DefaultForwardTimeout bounds connecting to a Fluentd forward receiver,
+// and writing a batch and waiting for its acknowledgements.
+const DefaultForwardTimeout = 30 * time.Second
+
+// DefaultForwardTag is the tag of entries sent without --forward-tag, or
+// whose tag template renders empty.
+const DefaultForwardTag = "log2json"
+
+// ForwardWriter sends entries to a Fluentd or Fluent Bit forward input,
+// over TCP for forward:// URLs or TLS for forward+tls://. Each batch goes
+// as one PackedForward message per tag, and each message must be
+// acknowledged: those that are not are resent on a new connection, so
+// the receiver may see an entry twice but does not lose one.
+//
+// The event time is taken from the entry's timestamp field, if it has
+// one, else the time it is sent; the fields are the record.
+type ForwardWriter struct {
+	options   Options
+	network   string // tcp or tls
+	addr      string
+	tag       string             // a fixed tag, or
+	tagTmpl   *template.Template // a template rendering each entry's tag
+	tagFields []string           // top-level fields tagTmpl refers to
+	timeout   time.Duration
+	conn      net.Conn
+	r         *bufio.Reader
+	batch     *batcher
+	now       func() time.Time
+}
+
+// ForwardOption configures a ForwardWriter.
+type ForwardOption func(*ForwardWriter)
+
+// WithForwardTag sets the tag of every entry (default DefaultForwardTag).
+func WithForwardTag(tag string) ForwardOption {
+	return func(w *ForwardWriter) {
+		w.tag = tag
+	}
+}
+
+// WithForwardTagTemplate renders each entry's tag from its fields, as
+// ParseTemplate parses, such as app.{{.program}}.
+func WithForwardTagTemplate(tmpl *template.Template) ForwardOption {
+	return func(w *ForwardWriter) {
+		w.tagTmpl = tmpl
+	}
+}
+
+// WithForwardTimeout bounds connecting, and each batch's write and
+// acknowledgements (default DefaultForwardTimeout).
+func WithForwardTimeout(d time.Duration) ForwardOption {
+	return func(w *ForwardWriter) {
+		if d > 0 {
+			w.timeout = d
+		}
+	}
+}
+
+// IsForwardURL reports whether an output names a Fluentd forward
+// receiver.
+func IsForwardURL(s string) bool {
+	return strings.HasPrefix(s, "forward://") || strings.HasPrefix(s, "forward+")
+}
+
+// NewForward connects to the forward receiver at rawURL:
+// forward://host[:port], or forward+tls:// for TLS. The port defaults
+// to 24224.
+func NewForward(rawURL string, opts Options, batch BatchConfig, fopts ...ForwardOption) (*ForwardWriter, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	w := &ForwardWriter{
+		options: opts,
+		tag:     DefaultForwardTag,
+		timeout: DefaultForwardTimeout,
+		now:     time.Now,
+	}
+	switch u.Scheme {
+	case "forward":
+		w.network = "tcp"
+	case "forward+tls":
+		w.network = "tls"
+	default:
+		return nil, fmt.Errorf("URL must be forward:// or forward+tls://, got %q", rawURL)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("forward URL %q has no host", rawURL)
+	}
+	port := "24224"
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	w.addr = net.JoinHostPort(u.Hostname(), port)
+	for _, opt := range fopts {
+		opt(w)
+	}
+	if w.tagTmpl != nil {
+		seen := make(map[string]bool)
+		for _, tt := range w.tagTmpl.Templates() {
+			if tt.Tree != nil {
+				collectFields(tt.Tree.Root, seen)
+			}
+		}
+		for f := range seen {
+			w.tagFields = append(w.tagFields, f)
+		}
+	}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	w.batch = newBatcher(batch, w.send)
+	return w, nil
+}
+
+// Emit queues an entry, sending a batch when it is full.
+func (w *ForwardWriter) Emit(entry *parser.Entry) error {
+	if w.options.OmitEmpty && entry.ParseError != nil {
+		return nil
+	}
+	record := buildOutput(&w.options, entry)
+	tag, err := w.entryTag(record)
+	if err != nil {
+		return err
+	}
+	t := w.now()
+	for _, f := range transform.TimestampFields {
+		if ts, ok := transform.ParseTimestamp(record[f]); ok {
+			t = ts
+			break
+		}
+	}
+
+	// An item is its tag, length first, then its encoded entry
+	item := binary.AppendUvarint(nil, uint64(len(tag)))
+	item = append(item, tag...)
+	return w.batch.add(forward.AppendEntry(item, t, record))
+}
+
+// Close sends any queued entries and closes the connection.
+func (w *ForwardWriter) Close() error {
+	err := w.batch.close()
+	if w.conn != nil {
+		_ = w.conn.Close()
+	}
+	return err
+}
+
+// entryTag renders an entry's tag.
+func (w *ForwardWriter) entryTag(record map[string]any) (string, error) {
+	if w.tagTmpl == nil {
+		return w.tag, nil
+	}
+	// Fields the template names but the entry lacks render empty
+	data := maps.Clone(record)
+	for _, f := range w.tagFields {
+		if _, ok := data[f]; !ok {
+			data[f] = ""
+		}
+	}
+	var buf strings.Builder
+	if err := w.tagTmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("forward tag: %w", err)
+	}
+	if tag := strings.TrimSpace(buf.String()); tag != "" {
+		return tag, nil
+	}
+	return DefaultForwardTag, nil
+}
+
+func (w *ForwardWriter) connect() error {
+	dialer := &net.Dialer{Timeout: w.timeout}
+	var err error
+	if w.network == "tls" {
+		host, _, _ := net.SplitHostPort(w.addr)
+		w.conn, err = tls.DialWithDialer(dialer, "tcp", w.addr, &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+	} else {
+		w.conn, err = dialer.Dial("tcp", w.addr)
+	}
+	if err != nil {
+		w.conn = nil
+		return fmt.Errorf("forward connect: %w", err)
+	}
+	w.r = bufio.NewReader(w.conn)
+	return nil
+}
+
+// forwardMessage is the PackedForward message of one tag's items.
+type forwardMessage struct {
+	tag     string
+	chunk   string
+	entries bytes.Buffer
+	items   [][]byte
+}
+
+// send writes one batch, a message per tag, then waits for their
+// acknowledgements. The items of messages not acknowledged are retried
+// on a new connection.
+func (w *ForwardWriter) send(items [][]byte) error {
+	var messages []*forwardMessage
+	byTag := make(map[string]*forwardMessage)
+	for _, item := range items {
+		n, size := binary.Uvarint(item)
+		tag := string(item[size : size+int(n)])
+		m := byTag[tag]
+		if m == nil {
+			m = &forwardMessage{tag: tag, chunk: newChunkID()}
+			byTag[tag] = m
+			messages = append(messages, m)
+		}
+		m.entries.Write(item[size+int(n):])
+		m.items = append(m.items, item)
+	}
+
+	if w.conn == nil {
+		if err := w.connect(); err != nil {
+			return &retryableError{err: err}
+		}
+	}
+	_ = w.conn.SetDeadline(time.Now().Add(w.timeout))
+	var buf []byte
+	for _, m := range messages {
+		buf = forward.AppendPackedForward(buf, m.tag, m.entries.Bytes(), len(m.items), m.chunk)
+	}
+	if _, err := w.conn.Write(buf); err != nil {
+		return w.retry(fmt.Errorf("forward write: %w", err), messages)
+	}
+	for i, m := range messages {
+		ack, err := forward.ReadAck(w.r)
+		if err == nil && ack != m.chunk {
+			err = fmt.Errorf("acknowledgement for chunk %q, want %q", ack, m.chunk)
+		}
+		if err != nil {
+			return w.retry(fmt.Errorf("forward acknowledgement: %w", err), messages[i:])
+		}
+	}
+	return nil
+}
+
+// retry drops the connection, which is out of step with the receiver,
+// and marks the items of the unacknowledged messages for resending.
+func (w *ForwardWriter) retry(err error, unacked []*forwardMessage) error {
+	_ = w.conn.Close()
+	w.conn = nil
+	var items [][]byte
+	for _, m := range unacked {
+		items = append(items, m.items...)
+	}
+	return &retryableError{err: err, items: items}
+}
+
+// newChunkID returns a random chunk id, as Fluentd generates them.
+func newChunkID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return base64.StdEncoding.EncodeToString(b[:])
+}
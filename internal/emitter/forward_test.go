@@ -0,0 +1,156 @@
+package emitter
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/forward"
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// forwardReceiver serves the forward protocol on a local port, passing
+// each message's events to handle.
+func forwardReceiver(t *testing.T, handle forward.Handler) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = forward.Serve(ctx, l, handle)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return "forward://" + l.Addr().String()
+}
+
+func TestForwardWriter(t *testing.T) {
+	var mu sync.Mutex
+	var messages [][]forward.Event
+	url := forwardReceiver(t, func(events []forward.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		messages = append(messages, events)
+		return nil
+	})
+
+	tmpl, err := ParseTemplate("app.{{.program}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	w, err := NewForward(url, Options{}, BatchConfig{Size: 10, Interval: time.Hour}, WithForwardTagTemplate(tmpl))
+	if err != nil {
+		t.Fatalf("NewForward() error: %v", err)
+	}
+	w.now = func() time.Time { return now }
+
+	entries := []map[string]any{
+		{"program": "web", "msg": "a", "timestamp": "2024-01-15T10:30:45.5Z"},
+		{"program": "db", "msg": "b"},
+		{"program": "web", "msg": "c", "status": float64(200)},
+	}
+	for _, fields := range entries {
+		if err := w.Emit(&parser.Entry{Fields: fields}); err != nil {
+			t.Fatalf("Emit() error: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(messages) != 2 {
+		t.Fatalf("got %d messages, want one per tag: %+v", len(messages), messages)
+	}
+	web, db := messages[0], messages[1]
+	if len(web) != 2 || web[0].Tag != "app.web" || web[0].Record["msg"] != "a" || web[1].Record["msg"] != "c" {
+		t.Errorf("first message = %+v, want the app.web entries in order", web)
+	}
+	if want := time.Date(2024, 1, 15, 10, 30, 45, 500000000, time.UTC); !web[0].Time.Equal(want) {
+		t.Errorf("time from timestamp field = %v, want %v", web[0].Time, want)
+	}
+	if web[1].Record["status"] != float64(200) {
+		t.Errorf("status = %#v, want 200", web[1].Record["status"])
+	}
+	if len(db) != 1 || db[0].Tag != "app.db" || !db[0].Time.Equal(now) {
+		t.Errorf("second message = %+v, want the app.db entry at the send time", db)
+	}
+}
+
+func TestForwardWriter_ResendsUnacknowledged(t *testing.T) {
+	var mu sync.Mutex
+	var calls int
+	var delivered []forward.Event
+	url := forwardReceiver(t, func(events []forward.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			return errors.New("buffer full")
+		}
+		delivered = append(delivered, events...)
+		return nil
+	})
+
+	w, err := NewForward(url, Options{}, BatchConfig{Size: 10, Interval: time.Hour}, WithForwardTag("app"))
+	if err != nil {
+		t.Fatalf("NewForward() error: %v", err)
+	}
+	w.batch.sleep = func(time.Duration) {}
+	if err := w.Emit(&parser.Entry{Fields: map[string]any{"msg": "retry me"}}); err != nil {
+		t.Fatalf("Emit() error: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 2 || len(delivered) != 1 || delivered[0].Tag != "app" || delivered[0].Record["msg"] != "retry me" {
+		t.Errorf("calls = %d, delivered = %+v; want the entry resent once", calls, delivered)
+	}
+}
+
+func TestForwardWriter_EmptyTagUsesDefault(t *testing.T) {
+	tmpl, err := ParseTemplate("{{.service}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &ForwardWriter{tagTmpl: tmpl, tagFields: []string{"service"}}
+	if tag, err := w.entryTag(map[string]any{"msg": "m"}); err != nil || tag != DefaultForwardTag {
+		t.Errorf("entryTag() = %q, %v; want %q", tag, err, DefaultForwardTag)
+	}
+}
+
+func TestNewForward_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{"wrong scheme", "http://localhost:24224", "must be forward://"},
+		{"no host", "forward://", "has no host"},
+		{"refused", "forward://127.0.0.1:1", "forward connect"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewForward(tt.url, Options{}, BatchConfig{}, WithForwardTimeout(time.Second))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewForward() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package emitter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// DefaultHTTPTimeout bounds each request of an HTTP output.
+const DefaultHTTPTimeout = 30 * time.Second
+
+// HTTPWriter POSTs entries to a URL as NDJSON, in batches.
+type HTTPWriter struct {
+	options  Options
+	url      string
+	headers  http.Header
+	compress string
+	client   *http.Client
+	batch    *batcher
+}
+
+// HTTPOption configures an HTTPWriter.
+type HTTPOption func(*HTTPWriter)
+
+// WithHTTPHeaders sets headers, such as authentication, sent with each
+// request.
+func WithHTTPHeaders(h http.Header) HTTPOption {
+	return func(w *HTTPWriter) {
+		w.headers = h
+	}
+}
+
+// WithHTTPTimeout bounds each request attempt (default DefaultHTTPTimeout).
+func WithHTTPTimeout(d time.Duration) HTTPOption {
+	return func(w *HTTPWriter) {
+		if d > 0 {
+			w.client.Timeout = d
+		}
+	}
+}
+
+// WithHTTPCompression compresses request bodies (CompressGzip or
+// CompressZstd), setting Content-Encoding.
+func WithHTTPCompression(format string) HTTPOption {
+	return func(w *HTTPWriter) {
+		w.compress = format
+	}
+}
+
+// IsHTTPURL reports whether an output names an HTTP endpoint.
+func IsHTTPURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// NewHTTP creates a writer that POSTs batches to rawURL.
+func NewHTTP(rawURL string, opts Options, batch BatchConfig, hopts ...HTTPOption) (*HTTPWriter, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("URL must be http:// or https://, got %q", rawURL)
+	}
+	w := &HTTPWriter{
+		options: opts,
+		url:     u.String(),
+		client:  &http.Client{Timeout: DefaultHTTPTimeout},
+	}
+	for _, opt := range hopts {
+		opt(w)
+	}
+	if w.compress != "" {
+		if _, err := NewCompressor(io.Discard, w.compress); err != nil {
+			return nil, err
+		}
+	}
+	w.batch = newBatcher(batch, w.send)
+	return w, nil
+}
+
+// Emit queues an entry, sending a batch when it is full.
+func (w *HTTPWriter) Emit(entry *parser.Entry) error {
+	if w.options.OmitEmpty && entry.ParseError != nil {
+		return nil
+	}
+	line, err := json.Marshal(buildOutput(&w.options, entry))
+	if err != nil {
+		return err
+	}
+	return w.batch.add(append(line, '\n'))
+}
+
+// Close sends any queued entries.
+func (w *HTTPWriter) Close() error {
+	return w.batch.close()
+}
+
+// send POSTs one batch.
+func (w *HTTPWriter) send(lines [][]byte) error {
+	body := bytes.Join(lines, nil)
+	if w.compress != "" {
+		var buf bytes.Buffer
+		zw, err := NewCompressor(&buf, w.compress)
+		if err != nil {
+			return err
+		}
+		_, _ = zw.Write(body)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if w.compress != "" {
+		req.Header.Set("Content-Encoding", w.compress)
+	}
+	for k, vs := range w.headers {
+		req.Header[k] = vs
+	}
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return &retryableError{err: err}
+	}
+	defer func() { _ = resp.Body.Close() }()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return &retryableError{err: err}
+	}
+	return httpStatusError(resp, respBody)
+}
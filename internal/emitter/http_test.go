@@ -0,0 +1,208 @@
+package emitter
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ingestServer is a fake NDJSON collector. status decides the response
+// code for each request from the request number.
+type ingestServer struct {
+	mu       sync.Mutex
+	status   func(call int) int
+	calls    int
+	received []string
+	headers  []http.Header
+}
+
+func (s *ingestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	s.headers = append(s.headers, r.Header.Clone())
+	if s.status != nil {
+		if code := s.status(s.calls); code >= 300 {
+			http.Error(w, "try later", code)
+			return
+		}
+	}
+	sc := bufio.NewScanner(r.Body)
+	for sc.Scan() {
+		var doc map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &doc); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		msg, _ := doc["msg"].(string)
+		s.received = append(s.received, msg)
+	}
+}
+
+func newTestHTTP(t *testing.T, url string, size int, opts ...HTTPOption) *HTTPWriter {
+	t.Helper()
+	w, err := NewHTTP(url, Options{}, BatchConfig{Size: size, Interval: time.Hour}, opts...)
+	if err != nil {
+		t.Fatalf("NewHTTP() error: %v", err)
+	}
+	w.batch.sleep = func(time.Duration) {}
+	return w
+}
+
+func TestHTTPWriter(t *testing.T) {
+	s := &ingestServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	headers := http.Header{"Authorization": {"Bearer t0ken"}}
+	w := newTestHTTP(t, srv.URL+"/ingest", 2, WithHTTPHeaders(headers))
+	for _, msg := range []string{"a", "b", "c"} {
+		if err := w.Emit(esEntry(msg)); err != nil {
+			t.Fatalf("Emit() error: %v", err)
+		}
+	}
+	if s.calls != 1 {
+		t.Errorf("%d requests before Close, want 1", s.calls)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	if got := strings.Join(s.received, ","); got != "a,b,c" {
+		t.Errorf("received %s, want a,b,c", got)
+	}
+	for _, h := range s.headers {
+		if h.Get("Content-Type") != "application/x-ndjson" || h.Get("Authorization") != "Bearer t0ken" {
+			t.Errorf("request headers = %v", h)
+		}
+	}
+}
+
+func TestHTTPWriter_Compression(t *testing.T) {
+	decoders := map[string]func([]byte) ([]byte, error){
+		CompressGzip: func(data []byte) ([]byte, error) {
+			zr, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			return io.ReadAll(zr)
+		},
+		CompressZstd: zstdDecode,
+	}
+
+	for format, decode := range decoders {
+		t.Run(format, func(t *testing.T) {
+			var body []byte
+			var encoding string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				encoding = r.Header.Get("Content-Encoding")
+				data, _ := io.ReadAll(r.Body)
+				body, _ = decode(data)
+			}))
+			defer srv.Close()
+
+			w := newTestHTTP(t, srv.URL, 1, WithHTTPCompression(format))
+			if err := w.Emit(esEntry("a")); err != nil {
+				t.Fatalf("Emit() error: %v", err)
+			}
+			_ = w.Close()
+			if encoding != format || string(body) != `{"msg":"a"}`+"\n" {
+				t.Errorf("Content-Encoding %q, body %q", encoding, body)
+			}
+		})
+	}
+
+	if _, err := NewHTTP("http://localhost/x", Options{}, BatchConfig{}, WithHTTPCompression("lz4")); err == nil {
+		t.Error("NewHTTP() with unknown compression expected error")
+	}
+}
+
+func TestHTTPWriter_Retry(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    func(call int) int
+		wantErr   string
+		wantCalls int
+		wantSent  string
+	}{
+		{
+			name: "recovers",
+			status: func(call int) int {
+				if call < 3 {
+					return http.StatusServiceUnavailable
+				}
+				return http.StatusOK
+			},
+			wantCalls: 3,
+			wantSent:  "a",
+		},
+		{
+			name:      "gives up",
+			status:    func(int) int { return http.StatusBadGateway },
+			wantErr:   "dropped 1 entries: 502",
+			wantCalls: defaultRetries + 1,
+		},
+		{
+			name:      "client error is not retried",
+			status:    func(int) int { return http.StatusUnauthorized },
+			wantErr:   "dropped 1 entries: 401",
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &ingestServer{status: tt.status}
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+
+			w := newTestHTTP(t, srv.URL, 1)
+			err := w.Emit(esEntry("a"))
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Emit() error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Emit() error = %v, want %q", err, tt.wantErr)
+			}
+			_ = w.Close()
+			if s.calls != tt.wantCalls {
+				t.Errorf("server called %d times, want %d", s.calls, tt.wantCalls)
+			}
+			if got := strings.Join(s.received, ","); got != tt.wantSent {
+				t.Errorf("received %q, want %q", got, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestHTTPWriter_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	w := newTestHTTP(t, srv.URL, 1, WithHTTPTimeout(10*time.Millisecond))
+	w.batch.retries = 0
+	if err := w.Emit(esEntry("a")); err == nil || !strings.Contains(err.Error(), "dropped 1 entries") {
+		t.Errorf("Emit() error = %v, want a timeout", err)
+	}
+	_ = w.Close()
+}
+
+func TestNewHTTP_Errors(t *testing.T) {
+	for _, u := range []string{"ftp://localhost/x", "http://", "es://localhost:9200/logs"} {
+		if _, err := NewHTTP(u, Options{}, BatchConfig{}); err == nil {
+			t.Errorf("NewHTTP(%q) expected error", u)
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package emitter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// JSONSchemaDraft is the $schema of inferred schemas.
+const JSONSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// MaxDistinct caps the distinct values tracked per field; beyond it a
+// field's cardinality is reported as "MaxDistinct+".
+const MaxDistinct = 1000
+
+// maxExamples is the number of example values kept per field.
+const maxExamples = 3
+
+// maxTopValues is the number of most frequent values a description lists
+// per field.
+const maxTopValues = 5
+
+// SchemaInferrer observes entries instead of writing them, and on Close
+// writes a JSON Schema describing every field seen, with WithSchemaReport
+// a summary of field types, presence and cardinality, or with
+// WithFieldDescription that summary with value statistics.
+type SchemaInferrer struct {
+	writer   *bufio.Writer
+	options  Options
+	report   bool
+	describe bool
+	root     *fieldStats
+	entries  int
+	closed   bool
+}
+
+// SchemaOption configures a SchemaInferrer.
+type SchemaOption func(*SchemaInferrer)
+
+// WithSchemaReport writes a text report rather than a JSON Schema.
+func WithSchemaReport() SchemaOption {
+	return func(s *SchemaInferrer) {
+		s.report = true
+	}
+}
+
+// WithFieldDescription writes a text report that adds, to the fields'
+// types, presence and cardinality, their most frequent values and the
+// range of their numeric values.
+func WithFieldDescription() SchemaOption {
+	return func(s *SchemaInferrer) {
+		s.describe = true
+	}
+}
+
+// NewSchemaInferrer creates a SchemaInferrer writing to output on Close.
+func NewSchemaInferrer(output io.Writer, opts Options, schemaOpts ...SchemaOption) *SchemaInferrer {
+	s := &SchemaInferrer{
+		writer:  bufio.NewWriter(output),
+		options: opts,
+		root:    newFieldStats(),
+	}
+	for _, opt := range schemaOpts {
+		opt(s)
+	}
+	return s
+}
+
+// Emit records an entry's fields.
+func (s *SchemaInferrer) Emit(entry *parser.Entry) error {
+	if s.options.OmitEmpty && entry.ParseError != nil {
+		return nil
+	}
+	s.entries++
+	s.root.observe(buildOutput(&s.options, entry))
+	return nil
+}
+
+// Close writes the schema or report.
+func (s *SchemaInferrer) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	switch {
+	case s.describe:
+		if err := s.writeDescription(); err != nil {
+			return err
+		}
+	case s.report:
+		if err := s.writeReport(); err != nil {
+			return err
+		}
+	default:
+		schema := s.root.schema()
+		schema["$schema"] = JSONSchemaDraft
+		data, err := json.MarshalIndent(schema, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, _ = s.writer.Write(append(data, '\n'))
+	}
+	return s.writer.Flush()
+}
+
+// writeReport writes one row per field, nested fields as dotted paths
+// and array elements as "field[]".
+func (s *SchemaInferrer) writeReport() error {
+	tw := tabwriter.NewWriter(s.writer, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "%d entries\n\n", s.entries)
+	_, _ = fmt.Fprintln(tw, "FIELD\tTYPE\tPRESENT\tDISTINCT\tEXAMPLES")
+	s.walk(func(path string, f *fieldStats) {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%.1f%%\t%s\t%s\n",
+			path, strings.Join(f.typeNames(), "|"), s.presence(f), f.cardinality(), f.exampleText())
+	})
+	return tw.Flush()
+}
+
+// writeDescription writes the report's rows with the range of numeric
+// values and the most frequent values, with their share of the field's
+// values.
+func (s *SchemaInferrer) writeDescription() error {
+	tw := tabwriter.NewWriter(s.writer, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "%d entries\n\n", s.entries)
+	_, _ = fmt.Fprintln(tw, "FIELD\tTYPE\tPRESENT\tDISTINCT\tMIN\tMAX\tTOP VALUES")
+	s.walk(func(path string, f *fieldStats) {
+		lo, hi := "-", "-"
+		if f.numbers > 0 {
+			lo, hi = formatNumber(f.min), formatNumber(f.max)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%.1f%%\t%s\t%s\t%s\t%s\n",
+			path, strings.Join(f.typeNames(), "|"), s.presence(f), f.cardinality(), lo, hi, f.topValuesText())
+	})
+	return tw.Flush()
+}
+
+// walk calls fn for every field, in name order, nested fields as dotted
+// paths and array elements as "field[]".
+func (s *SchemaInferrer) walk(fn func(path string, f *fieldStats)) {
+	var walk func(prefix string, f *fieldStats)
+	walk = func(prefix string, f *fieldStats) {
+		for _, name := range fieldNames(f.props) {
+			child := f.props[name]
+			path := prefix + name
+			fn(path, child)
+			walk(path+".", child)
+			if child.items != nil && child.items.count > 0 {
+				walk(path+"[].", child.items)
+			}
+		}
+	}
+	walk("", s.root)
+}
+
+// presence returns the percentage of entries that had the field.
+func (s *SchemaInferrer) presence(f *fieldStats) float64 {
+	if s.entries == 0 {
+		return 0
+	}
+	return 100 * float64(f.count) / float64(s.entries)
+}
+
+// fieldStats accumulates what has been seen of one field.
+type fieldStats struct {
+	count    int                    // times present
+	types    map[string]int         // JSON Schema type name -> times seen
+	values   map[string]*valueCount // distinct scalar values, up to MaxDistinct
+	overflow bool                   // more than MaxDistinct distinct values
+	examples []any                  // first few distinct scalar values
+	strings  int                    // string values seen
+	times    int                    // string values that are RFC 3339 times
+	numbers  int                    // numeric values seen
+	min, max float64                // range of the numeric values
+	props    map[string]*fieldStats // object properties
+	items    *fieldStats            // array elements
+}
+
+// valueCount is a distinct scalar value and the times it was seen.
+type valueCount struct {
+	value any
+	count int
+}
+
+func newFieldStats() *fieldStats {
+	return &fieldStats{types: make(map[string]int), values: make(map[string]*valueCount)}
+}
+
+// observe records one value of the field.
+func (f *fieldStats) observe(v any) {
+	v = normalizeValue(v)
+	f.count++
+	typ := schemaType(v)
+	f.types[typ]++
+
+	switch x := v.(type) {
+	case map[string]any:
+		if f.props == nil {
+			f.props = make(map[string]*fieldStats)
+		}
+		for k, val := range x {
+			child, ok := f.props[k]
+			if !ok {
+				child = newFieldStats()
+				f.props[k] = child
+			}
+			child.observe(val)
+		}
+		return
+	case []any:
+		if f.items == nil {
+			f.items = newFieldStats()
+		}
+		for _, item := range x {
+			f.items.observe(item)
+		}
+		return
+	case string:
+		f.strings++
+		if _, err := time.Parse(time.RFC3339Nano, x); err == nil {
+			f.times++
+		}
+	case float64:
+		if f.numbers == 0 || x < f.min {
+			f.min = x
+		}
+		if f.numbers == 0 || x > f.max {
+			f.max = x
+		}
+		f.numbers++
+	}
+
+	// Values already tracked keep being counted past the cap
+	key := typ + ":" + fmt.Sprint(v)
+	if vc, ok := f.values[key]; ok {
+		vc.count++
+		return
+	}
+	if f.overflow {
+		return
+	}
+	if len(f.values) == MaxDistinct {
+		f.overflow = true
+		return
+	}
+	// A string may be a slice of the line, sharing its memory with other
+	// lines, so a copy is kept
+	if s, ok := v.(string); ok {
+		v = strings.Clone(s)
+	}
+	f.values[key] = &valueCount{value: v, count: 1}
+	if len(f.examples) < maxExamples {
+		f.examples = append(f.examples, v)
+	}
+}
+
+// typeNames returns the JSON Schema types seen, sorted, with integer
+// folded into number when both were seen.
+func (f *fieldStats) typeNames() []string {
+	names := make([]string, 0, len(f.types))
+	for name := range f.types {
+		if name == "integer" && f.types["number"] > 0 {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cardinality returns the number of distinct scalar values seen, or
+// "-" for a field that only held objects and arrays.
+func (f *fieldStats) cardinality() string {
+	switch {
+	case len(f.values) == 0 && f.types["object"]+f.types["array"] == f.count:
+		return "-"
+	case f.overflow:
+		return fmt.Sprintf("%d+", MaxDistinct)
+	}
+	return fmt.Sprint(len(f.values))
+}
+
+// exampleText returns the examples as compact JSON, comma-separated.
+func (f *fieldStats) exampleText() string {
+	parts := make([]string, 0, len(f.examples))
+	for _, ex := range f.examples {
+		data, _ := json.Marshal(ex)
+		parts = append(parts, string(data))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// topValuesText returns the most frequent scalar values as compact JSON,
+// each with its share of the field's scalar values. Once more than
+// MaxDistinct values were seen, the counts only cover the values tracked.
+func (f *fieldStats) topValuesText() string {
+	top := make([]*valueCount, 0, len(f.values))
+	total := 0
+	for _, vc := range f.values {
+		top = append(top, vc)
+		total += vc.count
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].count != top[j].count {
+			return top[i].count > top[j].count
+		}
+		return fmt.Sprint(top[i].value) < fmt.Sprint(top[j].value)
+	})
+	if len(top) > maxTopValues {
+		top = top[:maxTopValues]
+	}
+	parts := make([]string, 0, len(top))
+	for _, vc := range top {
+		data, _ := json.Marshal(vc.value)
+		parts = append(parts, fmt.Sprintf("%s %.0f%%", data, 100*float64(vc.count)/float64(total)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatNumber formats a numeric value the way JSON would.
+func formatNumber(x float64) string {
+	return strconv.FormatFloat(x, 'f', -1, 64)
+}
+
+// schema returns the JSON Schema for the field. Properties present in
+// every object seen are required.
+func (f *fieldStats) schema() map[string]any {
+	s := make(map[string]any)
+	types := f.typeNames()
+	switch len(types) {
+	case 0:
+	case 1:
+		s["type"] = types[0]
+	default:
+		s["type"] = types
+	}
+
+	if f.props != nil {
+		props := make(map[string]any, len(f.props))
+		var required []string
+		for _, name := range fieldNames(f.props) {
+			child := f.props[name]
+			props[name] = child.schema()
+			if child.count == f.types["object"] {
+				required = append(required, name)
+			}
+		}
+		s["properties"] = props
+		if len(required) > 0 {
+			s["required"] = required
+		}
+	}
+	if f.items != nil && f.items.count > 0 {
+		s["items"] = f.items.schema()
+	}
+	if f.strings > 0 && f.times == f.strings {
+		s["format"] = "date-time"
+	}
+	if len(f.examples) > 0 {
+		s["examples"] = f.examples
+	}
+	return s
+}
+
+// schemaType returns the JSON Schema type name of a normalized value.
+func schemaType(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if x == math.Trunc(x) && math.Abs(x) < 1<<53 {
+			return "integer"
+		}
+		return "number"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	}
+	return "string"
+}
+
+// normalizeValue converts a value to the types encoding/json decodes
+// into, so that, say, int64 and float64 fields are treated alike.
+func normalizeValue(v any) any {
+	switch v.(type) {
+	case nil, bool, string, float64, map[string]any, []any:
+		return v
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return string(data)
+	}
+	return decoded
+}
+
+// fieldNames returns the keys of m, sorted.
+func fieldNames(m map[string]*fieldStats) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
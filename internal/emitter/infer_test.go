@@ -0,0 +1,178 @@
+package emitter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func inferSchema(t *testing.T, entries []map[string]any, opts ...SchemaOption) string {
+	t.Helper()
+	var buf bytes.Buffer
+	s := NewSchemaInferrer(&buf, Options{}, opts...)
+	for i, fields := range entries {
+		if err := s.Emit(&parser.Entry{Fields: fields, LineNum: i + 1}); err != nil {
+			t.Fatalf("Emit() error = %v", err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return buf.String()
+}
+
+func TestSchemaInferrer_Schema(t *testing.T) {
+	out := inferSchema(t, []map[string]any{
+		{"time": "2024-01-15T10:00:00Z", "level": "info", "status": int64(200), "user": map[string]any{"id": 1.0}},
+		{"time": "2024-01-15T10:00:01Z", "level": "error", "status": int64(500), "latency": 0.25, "user": map[string]any{"id": 2.0, "name": "bob"}},
+		{"time": "2024-01-15T10:00:02Z", "level": "info", "status": "n/a", "latency": 1.0, "tags": []any{"a", "b"}, "user": nil},
+	})
+
+	var got map[string]any
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+	if got["$schema"] != JSONSchemaDraft || got["type"] != "object" {
+		t.Errorf("root = %v", got)
+	}
+	if want := []any{"level", "status", "time", "user"}; !reflect.DeepEqual(got["required"], want) {
+		t.Errorf("required = %v, want %v", got["required"], want)
+	}
+
+	props := got["properties"].(map[string]any)
+	tests := []struct {
+		field string
+		key   string
+		want  any
+	}{
+		{"level", "type", "string"},
+		{"level", "examples", []any{"info", "error"}},
+		{"time", "format", "date-time"},
+		{"status", "type", []any{"integer", "string"}},
+		{"latency", "type", "number"},
+		{"tags", "type", "array"},
+		{"tags", "items", map[string]any{"type": "string", "examples": []any{"a", "b"}}},
+		{"user", "type", []any{"null", "object"}},
+		{"user", "required", []any{"id"}},
+	}
+	for _, tt := range tests {
+		prop, ok := props[tt.field].(map[string]any)
+		if !ok {
+			t.Errorf("no property %q in %v", tt.field, props)
+			continue
+		}
+		if !reflect.DeepEqual(prop[tt.key], tt.want) {
+			t.Errorf("%s.%s = %v, want %v", tt.field, tt.key, prop[tt.key], tt.want)
+		}
+	}
+	if _, ok := props["level"].(map[string]any)["format"]; ok {
+		t.Error("level should have no format")
+	}
+}
+
+func TestSchemaInferrer_Report(t *testing.T) {
+	out := inferSchema(t, []map[string]any{
+		{"level": "info", "req": map[string]any{"method": "GET"}},
+		{"level": "warn"},
+		{"level": "info", "req": map[string]any{"method": "POST"}},
+		{"level": "info"},
+	}, WithSchemaReport())
+
+	for _, want := range []string{
+		"4 entries",
+		"FIELD",
+		"level       string  100.0%   2         \"info\", \"warn\"",
+		"req         object  50.0%    -",
+		"req.method  string  50.0%    2         \"GET\", \"POST\"",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestSchemaInferrer_CopiesValues(t *testing.T) {
+	// The value is a view of a buffer, as values sliced from lines in the
+	// reader's shared blocks are; the report must not refer to it
+	buf := []byte("alice")
+	var out bytes.Buffer
+	s := NewSchemaInferrer(&out, Options{}, WithSchemaReport())
+	if err := s.Emit(&parser.Entry{Fields: map[string]any{"user": unsafe.String(unsafe.SliceData(buf), len(buf))}, LineNum: 1}); err != nil {
+		t.Fatalf("Emit() error = %v", err)
+	}
+	copy(buf, "xxxxx")
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if !strings.Contains(out.String(), `"alice"`) {
+		t.Errorf("report does not keep the value:\n%s", out.String())
+	}
+}
+
+func TestSchemaInferrer_Description(t *testing.T) {
+	out := inferSchema(t, []map[string]any{
+		{"level": "info", "status": 200, "req": map[string]any{"ms": 1.5}},
+		{"level": "warn", "status": 503},
+		{"level": "info", "status": 200, "req": map[string]any{"ms": 12}},
+		{"level": "info", "status": 404},
+	}, WithFieldDescription())
+
+	for _, want := range []string{
+		"4 entries",
+		"FIELD   TYPE     PRESENT  DISTINCT  MIN  MAX  TOP VALUES",
+		"level   string   100.0%   2         -    -    \"info\" 75%, \"warn\" 25%",
+		"req     object   50.0%    -         -    -",
+		"req.ms  number   50.0%    2         1.5  12   1.5 50%, 12 50%",
+		"status  integer  100.0%   3         200  503  200 50%, 404 25%, 503 25%",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("description missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestSchemaInferrer_TopValuesPastCap(t *testing.T) {
+	// Values seen before the cap are still counted after it
+	entries := make([]map[string]any, 0, 2*MaxDistinct)
+	for i := 0; i < MaxDistinct+10; i++ {
+		entries = append(entries, map[string]any{"id": fmt.Sprint(i)})
+	}
+	for i := 0; i < 10; i++ {
+		entries = append(entries, map[string]any{"id": "7"})
+	}
+	out := inferSchema(t, entries, WithFieldDescription())
+	if !strings.Contains(out, `"7" 1%`) || !strings.Contains(out, fmt.Sprintf("%d+", MaxDistinct)) {
+		t.Errorf("description = %s", out)
+	}
+}
+
+func TestSchemaInferrer_CardinalityCap(t *testing.T) {
+	entries := make([]map[string]any, MaxDistinct+5)
+	for i := range entries {
+		entries[i] = map[string]any{"id": fmt.Sprint(i)}
+	}
+	out := inferSchema(t, entries, WithSchemaReport())
+	if want := fmt.Sprintf("%d+", MaxDistinct); !strings.Contains(out, want) {
+		t.Errorf("report missing %q:\n%s", want, out)
+	}
+}
+
+func TestSchemaInferrer_OmitEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewSchemaInferrer(&buf, Options{OmitEmpty: true}, WithSchemaReport())
+	_ = s.Emit(&parser.Entry{Fields: map[string]any{"msg": "ok"}})
+	_ = s.Emit(&parser.Entry{Fields: map[string]any{"_parseError": "bad"}, ParseError: fmt.Errorf("bad")})
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_ = s.Close() // a second Close writes nothing
+	if out := buf.String(); !strings.HasPrefix(out, "1 entries") || strings.Contains(out, "_parseError") {
+		t.Errorf("report = %s", out)
+	}
+}
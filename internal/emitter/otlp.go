@@ -0,0 +1,387 @@
+package emitter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+	"github.com/juliosaraiva/log2json/internal/transform"
+)
+
+// OTLP transport protocols, named as in OTEL_EXPORTER_OTLP_PROTOCOL.
+const (
+	OTLPHTTP = "http/protobuf"
+	OTLPGRPC = "grpc"
+)
+
+const (
+	otlpHTTPPath = "/v1/logs"
+	otlpGRPCPath = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+)
+
+// MessageFields lists field names used as an OTLP log record's body.
+var MessageFields = []string{"message", "msg", "log"}
+
+// OTLPExporter sends entries to an OpenTelemetry collector as OTLP log
+// records, in batches, over HTTP/protobuf or gRPC. The level field sets
+// the severity, the timestamp field the record time, message (or the raw
+// line) the body, and the remaining fields become attributes.
+type OTLPExporter struct {
+	options  Options
+	endpoint string
+	protocol string
+	headers  http.Header
+	client   *http.Client
+	service  string
+	now      func() time.Time
+
+	resource []byte // encoded ResourceLogs.resource field
+	batch    *batcher
+}
+
+// OTLPOption configures an OTLPExporter.
+type OTLPOption func(*OTLPExporter)
+
+// WithOTLPProtocol selects OTLPHTTP (the default) or OTLPGRPC. gRPC needs
+// an https endpoint, since plaintext HTTP/2 is not supported.
+func WithOTLPProtocol(protocol string) OTLPOption {
+	return func(o *OTLPExporter) {
+		o.protocol = protocol
+	}
+}
+
+// WithOTLPHeaders adds headers, such as authentication, to each request.
+func WithOTLPHeaders(h http.Header) OTLPOption {
+	return func(o *OTLPExporter) {
+		o.headers = h
+	}
+}
+
+// WithOTLPService sets the service.name resource attribute.
+func WithOTLPService(name string) OTLPOption {
+	return func(o *OTLPExporter) {
+		o.service = name
+	}
+}
+
+// WithHTTPClient sets the client used for requests.
+func WithHTTPClient(c *http.Client) OTLPOption {
+	return func(o *OTLPExporter) {
+		o.client = c
+	}
+}
+
+// NewOTLP creates an exporter for the collector at endpoint. For
+// HTTP/protobuf, an endpoint without a path is sent to /v1/logs.
+func NewOTLP(endpoint string, opts Options, batch BatchConfig, oopts ...OTLPOption) (*OTLPExporter, error) {
+	o := &OTLPExporter{
+		options:  opts,
+		protocol: OTLPHTTP,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		service:  "log2json",
+		now:      time.Now,
+	}
+	for _, opt := range oopts {
+		opt(o)
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("endpoint must be an http:// or https:// URL, got %q", endpoint)
+	}
+	switch o.protocol {
+	case OTLPHTTP:
+		if u.Path == "" || u.Path == "/" {
+			u.Path = otlpHTTPPath
+		}
+	case OTLPGRPC:
+		if u.Scheme != "https" {
+			return nil, errors.New("grpc requires an https:// endpoint; use http/protobuf for plaintext collectors")
+		}
+		u.Path = otlpGRPCPath
+	default:
+		return nil, fmt.Errorf("unknown protocol %q (want %s or %s)", o.protocol, OTLPHTTP, OTLPGRPC)
+	}
+	o.endpoint = u.String()
+
+	resource := appendProtoBytes(nil, 1, otlpKeyValue("service.name", o.service))
+	o.resource = appendProtoBytes(nil, 1, resource)
+
+	o.batch = newBatcher(batch, o.send)
+	return o, nil
+}
+
+// Emit queues an entry, sending a batch when it is full.
+func (o *OTLPExporter) Emit(entry *parser.Entry) error {
+	if o.options.OmitEmpty && entry.ParseError != nil {
+		return nil
+	}
+	return o.batch.add(o.logRecord(entry))
+}
+
+// Close sends any queued entries.
+func (o *OTLPExporter) Close() error {
+	return o.batch.close()
+}
+
+// send exports one batch of encoded LogRecords.
+func (o *OTLPExporter) send(records [][]byte) error {
+	var scope []byte
+	scope = appendProtoBytes(scope, 1, appendProtoString(nil, 1, "log2json"))
+	for _, r := range records {
+		scope = appendProtoBytes(scope, 2, r)
+	}
+	rl := appendProtoBytes(append([]byte(nil), o.resource...), 2, scope)
+	body := appendProtoBytes(nil, 1, rl)
+
+	contentType := "application/x-protobuf"
+	if o.protocol == OTLPGRPC {
+		framed := make([]byte, 5, 5+len(body))
+		binary.BigEndian.PutUint32(framed[1:], uint32(len(body)))
+		body = append(framed, body...)
+		contentType = "application/grpc"
+	}
+
+	req, err := http.NewRequest(http.MethodPost, o.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, vs := range o.headers {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", contentType)
+	if o.protocol == OTLPGRPC {
+		req.Header.Set("TE", "trailers")
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return &retryableError{err: err}
+	}
+	defer func() { _ = resp.Body.Close() }()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return &retryableError{err: err}
+	}
+
+	if err := httpStatusError(resp, respBody); err != nil {
+		return err
+	}
+	if o.protocol == OTLPGRPC {
+		return grpcStatusError(resp)
+	}
+	return nil
+}
+
+// httpStatusError turns a non-2xx response into an error, retryable for
+// the statuses the OTLP specification names.
+func httpStatusError(resp *http.Response, body []byte) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	msg := strings.TrimSpace(string(body))
+	if len(msg) > 200 {
+		msg = msg[:200]
+	}
+	err := fmt.Errorf("%s: %s", resp.Status, msg)
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		re := &retryableError{err: err}
+		if secs, perr := strconv.Atoi(resp.Header.Get("Retry-After")); perr == nil && secs > 0 {
+			re.after = time.Duration(secs) * time.Second
+		}
+		return re
+	}
+	return err
+}
+
+// grpcStatusError checks the grpc-status trailer (or header, for
+// trailers-only responses).
+func grpcStatusError(resp *http.Response) error {
+	status := resp.Trailer.Get("Grpc-Status")
+	msg := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, msg = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if status == "" || status == "0" {
+		return nil
+	}
+	if m, err := url.PathUnescape(msg); err == nil {
+		msg = m
+	}
+	err := fmt.Errorf("grpc status %s: %s", status, msg)
+	switch status {
+	case "1", "4", "8", "10", "11", "14", "15": // retryable per the OTLP specification
+		return &retryableError{err: err}
+	}
+	return err
+}
+
+// Severity numbers for normalized levels.
+var otlpSeverity = map[transform.Level]int64{
+	transform.LevelTrace:    1,
+	transform.LevelDebug:    5,
+	transform.LevelInfo:     9,
+	transform.LevelNotice:   10,
+	transform.LevelWarn:     13,
+	transform.LevelError:    17,
+	transform.LevelCritical: 20,
+	transform.LevelFatal:    21,
+}
+
+// logRecord encodes an entry as an OTLP LogRecord.
+func (o *OTLPExporter) logRecord(entry *parser.Entry) []byte {
+	fields := buildOutput(&o.options, entry)
+	var rec []byte
+
+	for _, f := range transform.TimestampFields {
+		if ts, ok := transform.ParseTimestamp(fields[f]); ok {
+			rec = appendProtoFixed64(rec, 1, uint64(ts.UnixNano()))
+			delete(fields, f)
+			break
+		}
+	}
+	for _, f := range transform.LevelFields {
+		v, ok := fields[f]
+		if !ok {
+			continue
+		}
+		if level, ok := transform.ParseLevel(v); ok {
+			rec = appendProtoVarint(rec, 2, uint64(otlpSeverity[level]))
+			rec = appendProtoString(rec, 3, fmt.Sprint(v))
+			delete(fields, f)
+		}
+		break
+	}
+
+	body := any(entry.Raw)
+	for _, f := range MessageFields {
+		if v, ok := fields[f]; ok {
+			body = v
+			delete(fields, f)
+			break
+		}
+	}
+	rec = appendProtoBytes(rec, 5, otlpAnyValue(body))
+
+	traceID := takeHexID(fields, 16, "trace_id", "traceId", "trace.id")
+	spanID := takeHexID(fields, 8, "span_id", "spanId", "span.id")
+
+	for _, k := range sortedKeys(fields) {
+		rec = appendProtoBytes(rec, 6, otlpKeyValue(k, fields[k]))
+	}
+	if traceID != nil {
+		rec = appendProtoBytes(rec, 9, traceID)
+	}
+	if spanID != nil {
+		rec = appendProtoBytes(rec, 10, spanID)
+	}
+	return appendProtoFixed64(rec, 11, uint64(o.now().UnixNano()))
+}
+
+// takeHexID removes and decodes the first of the named fields holding a
+// hex id of size bytes.
+func takeHexID(fields map[string]any, size int, names ...string) []byte {
+	for _, name := range names {
+		s, _ := fields[name].(string)
+		if b, err := hex.DecodeString(s); err == nil && len(b) == size {
+			delete(fields, name)
+			return b
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// otlpKeyValue encodes a KeyValue.
+func otlpKeyValue(k string, v any) []byte {
+	b := appendProtoString(nil, 1, k)
+	return appendProtoBytes(b, 2, otlpAnyValue(v))
+}
+
+// otlpAnyValue encodes an AnyValue.
+func otlpAnyValue(v any) []byte {
+	switch x := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return appendProtoString(nil, 1, x)
+	case bool:
+		n := uint64(0)
+		if x {
+			n = 1
+		}
+		return appendProtoVarint(nil, 2, n)
+	case int:
+		return appendProtoVarint(nil, 3, uint64(x))
+	case int64:
+		return appendProtoVarint(nil, 3, uint64(x))
+	case float64:
+		if x == math.Trunc(x) && math.Abs(x) < 1<<63 {
+			return appendProtoVarint(nil, 3, uint64(int64(x)))
+		}
+		return appendProtoFixed64(nil, 4, math.Float64bits(x))
+	case []any:
+		var arr []byte
+		for _, item := range x {
+			arr = appendProtoBytes(arr, 1, otlpAnyValue(item))
+		}
+		return appendProtoBytes(nil, 5, arr)
+	case map[string]any:
+		var kvs []byte
+		for _, k := range sortedKeys(x) {
+			kvs = appendProtoBytes(kvs, 1, otlpKeyValue(k, x[k]))
+		}
+		return appendProtoBytes(nil, 6, kvs)
+	}
+	s, _ := convertValue(parquetByteArray, v)
+	str, _ := s.(string)
+	return appendProtoString(nil, 1, str)
+}
+
+// Protocol buffers wire encoding.
+
+func appendProtoTag(b []byte, num, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(num)<<3|uint64(wireType))
+}
+
+func appendProtoVarint(b []byte, num int, v uint64) []byte {
+	return binary.AppendUvarint(appendProtoTag(b, num, 0), v)
+}
+
+func appendProtoFixed64(b []byte, num int, v uint64) []byte {
+	return binary.LittleEndian.AppendUint64(appendProtoTag(b, num, 1), v)
+}
+
+func appendProtoBytes(b []byte, num int, v []byte) []byte {
+	b = binary.AppendUvarint(appendProtoTag(b, num, 2), uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendProtoString(b []byte, num int, s string) []byte {
+	b = binary.AppendUvarint(appendProtoTag(b, num, 2), uint64(len(s)))
+	return append(b, s...)
+}
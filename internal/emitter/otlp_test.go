@@ -0,0 +1,358 @@
+package emitter
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// protoMessage is a decoded protobuf message: field number to values,
+// which are uint64 for varint and fixed64 fields and []byte otherwise.
+type protoMessage map[int][]any
+
+func decodeProto(t *testing.T, b []byte) protoMessage {
+	t.Helper()
+	m := protoMessage{}
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("bad tag in %x", b)
+		}
+		b = b[n:]
+		num := int(tag >> 3)
+		switch tag & 7 {
+		case 0:
+			v, n := binary.Uvarint(b)
+			m[num] = append(m[num], v)
+			b = b[n:]
+		case 1:
+			m[num] = append(m[num], binary.LittleEndian.Uint64(b))
+			b = b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			m[num] = append(m[num], b[n:n+int(l)])
+			b = b[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type %d", tag&7)
+		}
+	}
+	return m
+}
+
+func (m protoMessage) msg(t *testing.T, num int) protoMessage {
+	t.Helper()
+	if len(m[num]) == 0 {
+		return protoMessage{}
+	}
+	return decodeProto(t, m[num][0].([]byte))
+}
+
+func (m protoMessage) str(num int) string {
+	if len(m[num]) == 0 {
+		return ""
+	}
+	return string(m[num][0].([]byte))
+}
+
+func (m protoMessage) uint(num int) uint64 {
+	if len(m[num]) == 0 {
+		return 0
+	}
+	return m[num][0].(uint64)
+}
+
+// anyValue renders a decoded AnyValue as kind:value.
+func anyValue(t *testing.T, v protoMessage) string {
+	t.Helper()
+	switch {
+	case v[1] != nil:
+		return "s:" + v.str(1)
+	case v[2] != nil:
+		return fmt.Sprintf("b:%v", v.uint(2) == 1)
+	case v[3] != nil:
+		return fmt.Sprintf("i:%d", int64(v.uint(3)))
+	case v[4] != nil:
+		return fmt.Sprintf("d:%v", math.Float64frombits(v.uint(4)))
+	case v[5] != nil:
+		var items []string
+		for _, it := range v.msg(t, 5)[1] {
+			items = append(items, anyValue(t, decodeProto(t, it.([]byte))))
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	case v[6] != nil:
+		var kvs []string
+		for _, kv := range v.msg(t, 6)[1] {
+			m := decodeProto(t, kv.([]byte))
+			kvs = append(kvs, m.str(1)+"="+anyValue(t, m.msg(t, 2)))
+		}
+		return "{" + strings.Join(kvs, " ") + "}"
+	}
+	return "empty"
+}
+
+// otlpRequest is a decoded ExportLogsServiceRequest.
+type otlpRequest struct {
+	resource map[string]string
+	records  []protoMessage
+}
+
+func decodeOTLP(t *testing.T, body []byte) otlpRequest {
+	t.Helper()
+	req := otlpRequest{resource: map[string]string{}}
+	rl := decodeProto(t, body).msg(t, 1)
+	for _, kv := range rl.msg(t, 1)[1] {
+		m := decodeProto(t, kv.([]byte))
+		req.resource[m.str(1)] = anyValue(t, m.msg(t, 2))
+	}
+	scope := rl.msg(t, 2)
+	if got := scope.msg(t, 1).str(1); got != "log2json" {
+		t.Errorf("scope name = %q", got)
+	}
+	for _, r := range scope[2] {
+		req.records = append(req.records, decodeProto(t, r.([]byte)))
+	}
+	return req
+}
+
+// recordAttrs renders a LogRecord's attributes.
+func recordAttrs(t *testing.T, rec protoMessage) map[string]string {
+	t.Helper()
+	out := map[string]string{}
+	for _, kv := range rec[6] {
+		m := decodeProto(t, kv.([]byte))
+		out[m.str(1)] = anyValue(t, m.msg(t, 2))
+	}
+	return out
+}
+
+func otlpEntry(raw string, fields map[string]any) *parser.Entry {
+	e := parser.NewEntry(raw)
+	for k, v := range fields {
+		e.Fields[k] = v
+	}
+	return e
+}
+
+// collector records request bodies and replies with the given statuses
+// in turn (the last one repeating).
+type collector struct {
+	mu       sync.Mutex
+	bodies   [][]byte
+	headers  []http.Header
+	statuses []int
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	c.mu.Lock()
+	c.bodies = append(c.bodies, body)
+	c.headers = append(c.headers, r.Header.Clone())
+	status := http.StatusOK
+	if n := len(c.statuses); n > 0 {
+		status = c.statuses[min(len(c.bodies)-1, n-1)]
+	}
+	c.mu.Unlock()
+	w.WriteHeader(status)
+}
+
+func TestOTLPExporter_HTTP(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	o, err := NewOTLP(srv.URL, Options{}, BatchConfig{Size: 2, Interval: time.Hour},
+		WithOTLPService("api"),
+		WithOTLPHeaders(http.Header{"Authorization": {"Bearer token"}}))
+	if err != nil {
+		t.Fatalf("NewOTLP() error: %v", err)
+	}
+	o.now = func() time.Time { return time.Unix(1700000000, 0) }
+
+	entries := []*parser.Entry{
+		otlpEntry("raw one", map[string]any{
+			"timestamp": "2024-01-15T10:30:45.5Z", "level": "WARN", "message": "slow request",
+			"status": int64(200), "latency": 1.5, "ok": true, "tags": []any{"a", float64(1)},
+			"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736", "span_id": "00f067aa0ba902b7",
+		}),
+		otlpEntry("raw two", map[string]any{"ts": float64(1705314645000), "user": map[string]any{"id": "u1"}}),
+		otlpEntry("raw three", map[string]any{"level": "bogus"}),
+	}
+	for _, e := range entries {
+		if err := o.Emit(e); err != nil {
+			t.Fatalf("Emit() error: %v", err)
+		}
+	}
+	if err := o.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	if len(c.bodies) != 2 {
+		t.Fatalf("collector got %d requests, want 2", len(c.bodies))
+	}
+	h := c.headers[0]
+	if h.Get("Content-Type") != "application/x-protobuf" || h.Get("Authorization") != "Bearer token" {
+		t.Errorf("request headers = %v", h)
+	}
+
+	first := decodeOTLP(t, c.bodies[0])
+	if first.resource["service.name"] != "s:api" {
+		t.Errorf("resource = %v", first.resource)
+	}
+	if len(first.records) != 2 {
+		t.Fatalf("first request has %d records, want 2", len(first.records))
+	}
+
+	rec := first.records[0]
+	if got := time.Unix(0, int64(rec.uint(1))).UTC(); !got.Equal(time.Date(2024, 1, 15, 10, 30, 45, 5e8, time.UTC)) {
+		t.Errorf("time = %v", got)
+	}
+	if rec.uint(2) != 13 || rec.str(3) != "WARN" {
+		t.Errorf("severity = %d %q, want 13 WARN", rec.uint(2), rec.str(3))
+	}
+	if got := anyValue(t, rec.msg(t, 5)); got != "s:slow request" {
+		t.Errorf("body = %s", got)
+	}
+	if hex.EncodeToString(rec[9][0].([]byte)) != "4bf92f3577b34da6a3ce929d0e0e4736" || hex.EncodeToString(rec[10][0].([]byte)) != "00f067aa0ba902b7" {
+		t.Errorf("trace/span id = %x %x", rec[9], rec[10])
+	}
+	if got := time.Unix(0, int64(rec.uint(11))); got.Unix() != 1700000000 {
+		t.Errorf("observed time = %v", got)
+	}
+	wantAttrs := map[string]string{"status": "i:200", "latency": "d:1.5", "ok": "b:true", "tags": "[s:a i:1]"}
+	if got := recordAttrs(t, rec); !reflect.DeepEqual(got, wantAttrs) {
+		t.Errorf("attributes = %v, want %v", got, wantAttrs)
+	}
+
+	rec = first.records[1]
+	if got := time.Unix(0, int64(rec.uint(1))).UTC(); got.Unix() != 1705314645 {
+		t.Errorf("epoch ms time = %v", got)
+	}
+	if got := anyValue(t, rec.msg(t, 5)); got != "s:raw two" {
+		t.Errorf("body without message = %s, want the raw line", got)
+	}
+	if got := recordAttrs(t, rec); got["user"] != "{id=s:u1}" {
+		t.Errorf("attributes = %v", got)
+	}
+
+	// An unrecognized level is kept as an attribute.
+	last := decodeOTLP(t, c.bodies[1]).records[0]
+	if last.uint(2) != 0 || recordAttrs(t, last)["level"] != "s:bogus" {
+		t.Errorf("unknown level record = %v", last)
+	}
+}
+
+func TestOTLPExporter_Retry(t *testing.T) {
+	c := &collector{statuses: []int{http.StatusServiceUnavailable, http.StatusOK}}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	o, err := NewOTLP(srv.URL+"/custom/path", Options{}, BatchConfig{Size: 1, Interval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewOTLP() error: %v", err)
+	}
+	o.batch.sleep = func(time.Duration) {}
+	if err := o.Emit(otlpEntry("x", nil)); err != nil {
+		t.Fatalf("Emit() error: %v", err)
+	}
+	if len(c.bodies) != 2 {
+		t.Errorf("collector got %d requests, want a retry", len(c.bodies))
+	}
+
+	// Client errors are not retried.
+	c.statuses = []int{http.StatusBadRequest}
+	c.bodies = nil
+	if err := o.Emit(otlpEntry("x", nil)); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("Emit() error = %v, want 400", err)
+	}
+	if len(c.bodies) != 1 {
+		t.Errorf("collector got %d requests, want 1", len(c.bodies))
+	}
+	_ = o.Close()
+}
+
+func TestOTLPExporter_GRPC(t *testing.T) {
+	var gotPath, gotType string
+	var gotBody []byte
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotType = r.URL.Path, r.Header.Get("Content-Type")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		_, _ = w.Write([]byte{0, 0, 0, 0, 0})
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	o, err := NewOTLP(srv.URL, Options{}, BatchConfig{Size: 1, Interval: time.Hour},
+		WithOTLPProtocol(OTLPGRPC), WithHTTPClient(srv.Client()))
+	if err != nil {
+		t.Fatalf("NewOTLP() error: %v", err)
+	}
+	if err := o.Emit(otlpEntry("hello", nil)); err != nil {
+		t.Fatalf("Emit() error: %v", err)
+	}
+	_ = o.Close()
+
+	if gotPath != otlpGRPCPath || gotType != "application/grpc" {
+		t.Errorf("request = %s (%s)", gotPath, gotType)
+	}
+	if len(gotBody) < 5 || gotBody[0] != 0 || int(binary.BigEndian.Uint32(gotBody[1:5])) != len(gotBody)-5 {
+		t.Fatalf("body is not a gRPC frame: %x", gotBody)
+	}
+	if recs := decodeOTLP(t, gotBody[5:]).records; len(recs) != 1 || anyValue(t, recs[0].msg(t, 5)) != "s:hello" {
+		t.Errorf("records = %v", recs)
+	}
+}
+
+func TestGRPCStatusError(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}, Trailer: http.Header{"Grpc-Status": {"14"}, "Grpc-Message": {"try%20later"}}}
+	err := grpcStatusError(resp)
+	var re *retryableError
+	if err == nil || !strings.Contains(err.Error(), "try later") || !errors.As(err, &re) {
+		t.Errorf("grpcStatusError() = %v, want retryable unavailable", err)
+	}
+
+	resp.Trailer.Set("Grpc-Status", "3")
+	if err := grpcStatusError(resp); err == nil || errors.As(err, &re) {
+		t.Errorf("grpcStatusError() = %v, want permanent error", err)
+	}
+}
+
+func TestNewOTLP_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		protocol string
+		want     string
+	}{
+		{name: "not a URL", endpoint: "localhost:4318", want: "http:// or https://"},
+		{name: "grpc plaintext", endpoint: "http://localhost:4317", protocol: OTLPGRPC, want: "https://"},
+		{name: "unknown protocol", endpoint: "http://localhost:4318", protocol: "http/json", want: "unknown protocol"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []OTLPOption
+			if tt.protocol != "" {
+				opts = append(opts, WithOTLPProtocol(tt.protocol))
+			}
+			if _, err := NewOTLP(tt.endpoint, Options{}, BatchConfig{}, opts...); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewOTLP() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,503 @@
+package emitter
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// DefaultRowGroupSize is the number of rows buffered per Parquet row group.
+const DefaultRowGroupSize = 10000
+
+// ExtraColumn holds, as a JSON object, fields that are not in the
+// inferred Parquet schema or whose value does not fit its column type.
+const ExtraColumn = "_extra"
+
+const parquetMagic = "PAR1"
+
+// Parquet physical types, encodings and codecs used by the writer.
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetOptional = 1 // FieldRepetitionType
+	parquetUTF8     = 0 // ConvertedType
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetGzip     = 2
+	parquetDataPage = 0
+)
+
+// parquetColumn is one column of the inferred schema.
+type parquetColumn struct {
+	name string
+	typ  int32 // physical type
+}
+
+// chunkMeta records where a column chunk was written.
+type chunkMeta struct {
+	offset       int64
+	uncompressed int64
+	compressed   int64
+}
+
+// rowGroupMeta records a written row group.
+type rowGroupMeta struct {
+	chunks  []chunkMeta
+	numRows int64
+}
+
+// ParquetWriter writes entries as a Parquet file. The schema is inferred
+// from the first row group: each field becomes an optional column typed
+// BOOLEAN, INT64, DOUBLE or UTF8 string (mixed types and nested values
+// become strings, the latter JSON-encoded). Later fields that do not fit
+// the schema are kept as JSON in the _extra column. Row groups are
+// gzip-compressed and written every RowGroupSize entries; the file is
+// only readable once Close writes the footer.
+type ParquetWriter struct {
+	out          *countingWriter
+	options      Options
+	rowGroupSize int
+
+	rows      []map[string]any
+	columns   []parquetColumn // nil until the schema is inferred
+	rowGroups []rowGroupMeta
+	numRows   int64
+	closed    bool
+}
+
+// ParquetOption configures a ParquetWriter.
+type ParquetOption func(*ParquetWriter)
+
+// WithRowGroupSize sets the number of entries per row group.
+func WithRowGroupSize(n int) ParquetOption {
+	return func(p *ParquetWriter) {
+		if n > 0 {
+			p.rowGroupSize = n
+		}
+	}
+}
+
+// NewParquet creates a Parquet writer. Output needs no seeking, so it can
+// be a pipe.
+func NewParquet(output io.Writer, opts Options, popts ...ParquetOption) *ParquetWriter {
+	p := &ParquetWriter{
+		out:          &countingWriter{w: bufio.NewWriter(output)},
+		options:      opts,
+		rowGroupSize: DefaultRowGroupSize,
+	}
+	for _, opt := range popts {
+		opt(p)
+	}
+	return p
+}
+
+// Emit buffers an entry, writing a row group when the buffer is full.
+func (p *ParquetWriter) Emit(entry *parser.Entry) error {
+	if p.closed {
+		return errors.New("parquet writer is closed")
+	}
+	if p.options.OmitEmpty && entry.ParseError != nil {
+		return nil
+	}
+	p.rows = append(p.rows, buildOutput(&p.options, entry))
+	if len(p.rows) >= p.rowGroupSize {
+		return p.writeRowGroup()
+	}
+	return nil
+}
+
+// Close writes any buffered rows and the file footer.
+func (p *ParquetWriter) Close() error {
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+
+	if p.columns == nil {
+		p.columns = inferColumns(p.rows, p.options.FieldOrder)
+	}
+	if len(p.rows) > 0 {
+		if err := p.writeRowGroup(); err != nil {
+			return err
+		}
+	}
+	if p.out.n == 0 {
+		if _, err := io.WriteString(p.out, parquetMagic); err != nil {
+			return err
+		}
+	}
+
+	footer := p.footer()
+	if _, err := p.out.Write(footer); err != nil {
+		return err
+	}
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(footer)))
+	if _, err := p.out.Write(size[:]); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(p.out, parquetMagic); err != nil {
+		return err
+	}
+	return p.out.w.Flush()
+}
+
+// writeRowGroup writes the buffered rows as one row group.
+func (p *ParquetWriter) writeRowGroup() error {
+	if p.columns == nil {
+		p.columns = inferColumns(p.rows, p.options.FieldOrder)
+	}
+	if p.out.n == 0 {
+		if _, err := io.WriteString(p.out, parquetMagic); err != nil {
+			return err
+		}
+	}
+
+	// Values that do not fit their column go to _extra, which is last.
+	extras := make([]map[string]any, len(p.rows))
+	inSchema := make(map[string]bool, len(p.columns))
+	for _, col := range p.columns {
+		inSchema[col.name] = true
+	}
+	for i, row := range p.rows {
+		for k, v := range row {
+			if !inSchema[k] || k == ExtraColumn {
+				addExtra(extras, i, k, v)
+			}
+		}
+	}
+
+	rg := rowGroupMeta{numRows: int64(len(p.rows))}
+	for _, col := range p.columns {
+		values := make([]any, len(p.rows))
+		if col.name == ExtraColumn {
+			for i, extra := range extras {
+				if extra != nil {
+					values[i], _ = convertValue(parquetByteArray, extra)
+				}
+			}
+		} else {
+			for i, row := range p.rows {
+				v, ok := row[col.name]
+				if !ok || v == nil {
+					continue
+				}
+				if cv, ok := convertValue(col.typ, v); ok {
+					values[i] = cv
+				} else {
+					addExtra(extras, i, col.name, v)
+				}
+			}
+		}
+
+		chunk, err := p.writeChunk(col.typ, values)
+		if err != nil {
+			return err
+		}
+		rg.chunks = append(rg.chunks, chunk)
+	}
+
+	p.rowGroups = append(p.rowGroups, rg)
+	p.numRows += rg.numRows
+	p.rows = p.rows[:0]
+	return p.out.w.Flush()
+}
+
+func addExtra(extras []map[string]any, row int, k string, v any) {
+	if extras[row] == nil {
+		extras[row] = make(map[string]any)
+	}
+	extras[row][k] = v
+}
+
+// writeChunk writes one column chunk as a single gzip-compressed data
+// page. values holds converted values, or nil for nulls.
+func (p *ParquetWriter) writeChunk(typ int32, values []any) (chunkMeta, error) {
+	var page bytes.Buffer
+
+	// Definition levels: bit width 1, one bit-packed run.
+	levels := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		if v != nil {
+			levels[i/8] |= 1 << (i % 8)
+		}
+	}
+	var run bytes.Buffer
+	var hdr [binary.MaxVarintLen64]byte
+	run.Write(hdr[:binary.PutUvarint(hdr[:], uint64(len(levels))<<1|1)])
+	run.Write(levels)
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(run.Len()))
+	page.Write(size[:])
+	page.Write(run.Bytes())
+
+	// Values, PLAIN encoded.
+	var bits []byte
+	nbits := 0
+	for _, v := range values {
+		switch x := v.(type) {
+		case nil:
+		case bool:
+			if nbits%8 == 0 {
+				bits = append(bits, 0)
+			}
+			if x {
+				bits[nbits/8] |= 1 << (nbits % 8)
+			}
+			nbits++
+		case int64:
+			var b [8]byte
+			binary.LittleEndian.PutUint64(b[:], uint64(x))
+			page.Write(b[:])
+		case float64:
+			var b [8]byte
+			binary.LittleEndian.PutUint64(b[:], math.Float64bits(x))
+			page.Write(b[:])
+		case string:
+			binary.LittleEndian.PutUint32(size[:], uint32(len(x)))
+			page.Write(size[:])
+			page.WriteString(x)
+		}
+	}
+	page.Write(bits)
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write(page.Bytes()); err != nil {
+		return chunkMeta{}, err
+	}
+	if err := zw.Close(); err != nil {
+		return chunkMeta{}, err
+	}
+
+	h := newThriftWriter()
+	h.i32(1, parquetDataPage)
+	h.i32(2, int32(page.Len()))
+	h.i32(3, int32(compressed.Len()))
+	h.beginStruct(5) // DataPageHeader
+	h.i32(1, int32(len(values)))
+	h.i32(2, parquetPlain)
+	h.i32(3, parquetRLE)
+	h.i32(4, parquetRLE)
+	h.endStruct()
+	h.endStruct()
+
+	meta := chunkMeta{
+		offset:       p.out.n,
+		uncompressed: int64(len(h.Bytes()) + page.Len()),
+		compressed:   int64(len(h.Bytes()) + compressed.Len()),
+	}
+	if _, err := p.out.Write(h.Bytes()); err != nil {
+		return chunkMeta{}, err
+	}
+	if _, err := p.out.Write(compressed.Bytes()); err != nil {
+		return chunkMeta{}, err
+	}
+	return meta, nil
+}
+
+// footer encodes the FileMetaData.
+func (p *ParquetWriter) footer() []byte {
+	w := newThriftWriter()
+	w.i32(1, 1) // version
+
+	w.list(2, thriftStruct, len(p.columns)+1)
+	w.beginStruct(0)
+	w.binary(4, "schema")
+	w.i32(5, int32(len(p.columns)))
+	w.endStruct()
+	for _, col := range p.columns {
+		w.beginStruct(0)
+		w.i32(1, col.typ)
+		w.i32(3, parquetOptional)
+		w.binary(4, col.name)
+		if col.typ == parquetByteArray {
+			w.i32(6, parquetUTF8)
+		}
+		w.endStruct()
+	}
+
+	w.i64(3, p.numRows)
+
+	w.list(4, thriftStruct, len(p.rowGroups))
+	for _, rg := range p.rowGroups {
+		w.beginStruct(0)
+		var total int64
+		w.list(1, thriftStruct, len(rg.chunks))
+		for i, c := range rg.chunks {
+			col := p.columns[i]
+			total += c.uncompressed
+			w.beginStruct(0)
+			w.i64(2, c.offset)
+			w.beginStruct(3) // ColumnMetaData
+			w.i32(1, col.typ)
+			w.list(2, thriftI32, 2)
+			w.i32Elem(parquetPlain)
+			w.i32Elem(parquetRLE)
+			w.list(3, thriftBinary, 1)
+			w.binaryElem(col.name)
+			w.i32(4, parquetGzip)
+			w.i64(5, rg.numRows)
+			w.i64(6, c.uncompressed)
+			w.i64(7, c.compressed)
+			w.i64(9, c.offset)
+			w.endStruct()
+			w.endStruct()
+		}
+		w.i64(2, total)
+		w.i64(3, rg.numRows)
+		w.endStruct()
+	}
+
+	w.binary(6, "log2json")
+	w.endStruct()
+	return w.Bytes()
+}
+
+// inferColumns builds the schema from sample rows, with the columns in
+// order first and the rest sorted by name, then the _extra column.
+// Columns with only nulls are strings.
+func inferColumns(rows []map[string]any, order []string) []parquetColumn {
+	const unknown = -1
+
+	types := make(map[string]int32)
+	for _, row := range rows {
+		for k, v := range row {
+			if k == ExtraColumn {
+				continue
+			}
+			cur, seen := types[k]
+			switch {
+			case v == nil:
+				if !seen {
+					types[k] = unknown
+				}
+			case !seen || cur == unknown:
+				types[k] = valueType(v)
+			default:
+				types[k] = mergeType(cur, valueType(v))
+			}
+		}
+	}
+
+	names := make(map[string]any, len(types))
+	for name := range types {
+		names[name] = nil
+	}
+	cols := make([]parquetColumn, 0, len(types)+1)
+	for _, name := range orderKeys(names, order) {
+		typ := types[name]
+		if typ == unknown {
+			typ = parquetByteArray
+		}
+		cols = append(cols, parquetColumn{name: name, typ: typ})
+	}
+	return append(cols, parquetColumn{name: ExtraColumn, typ: parquetByteArray})
+}
+
+// mergeType widens a column type to accommodate another value's type.
+// Integers widen to doubles; other mixes become strings.
+func mergeType(cur, next int32) int32 {
+	switch {
+	case cur == next:
+		return cur
+	case (cur == parquetInt64 && next == parquetDouble) || (cur == parquetDouble && next == parquetInt64):
+		return parquetDouble
+	}
+	return parquetByteArray
+}
+
+// valueType returns the Parquet type a value would be stored as.
+func valueType(v any) int32 {
+	switch x := v.(type) {
+	case bool:
+		return parquetBoolean
+	case int, int32, int64, uint32:
+		return parquetInt64
+	case float64:
+		if x == math.Trunc(x) && math.Abs(x) < 1<<53 {
+			return parquetInt64
+		}
+		return parquetDouble
+	case float32, uint64:
+		return parquetDouble
+	}
+	return parquetByteArray
+}
+
+// convertValue converts v to the Go type written for a column type, or
+// reports that it does not fit.
+func convertValue(typ int32, v any) (any, bool) {
+	switch typ {
+	case parquetBoolean:
+		b, ok := v.(bool)
+		return b, ok
+	case parquetInt64:
+		switch x := v.(type) {
+		case int:
+			return int64(x), true
+		case int32:
+			return int64(x), true
+		case int64:
+			return x, true
+		case uint32:
+			return int64(x), true
+		case float64:
+			if x == math.Trunc(x) && math.Abs(x) < 1<<53 {
+				return int64(x), true
+			}
+		}
+		return nil, false
+	case parquetDouble:
+		switch x := v.(type) {
+		case int:
+			return float64(x), true
+		case int32:
+			return float64(x), true
+		case int64:
+			return float64(x), true
+		case uint32:
+			return float64(x), true
+		case uint64:
+			return float64(x), true
+		case float32:
+			return float64(x), true
+		case float64:
+			return x, true
+		}
+		return nil, false
+	}
+
+	if s, ok := v.(string); ok {
+		return s, true
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	return string(b), true
+}
+
+// countingWriter tracks the number of bytes written, for file offsets.
+type countingWriter struct {
+	w *bufio.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,250 @@
+package emitter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// parquetFile is a decoded file written by ParquetWriter.
+type parquetFile struct {
+	columns   []parquetColumn
+	numRows   int64
+	rowGroups int
+	rows      []map[string]any // null values omitted
+}
+
+// readParquet decodes a file produced by ParquetWriter.
+func readParquet(t *testing.T, data []byte) parquetFile {
+	t.Helper()
+	if len(data) < 12 || string(data[:4]) != parquetMagic || string(data[len(data)-4:]) != parquetMagic {
+		t.Fatalf("missing %s magic", parquetMagic)
+	}
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	r := &thriftReader{data: data[len(data)-8-size : len(data)-8]}
+	meta := r.structure()
+
+	var f parquetFile
+	schema := meta[2].([]any)
+	for _, el := range schema[1:] {
+		s := el.(map[int16]any)
+		if s[3] != int64(parquetOptional) {
+			t.Errorf("column %v is not optional", s[4])
+		}
+		f.columns = append(f.columns, parquetColumn{name: s[4].(string), typ: int32(s[1].(int64))})
+	}
+	f.numRows = meta[3].(int64)
+
+	for _, el := range meta[4].([]any) {
+		rg := el.(map[int16]any)
+		n := int(rg[3].(int64))
+		rows := make([]map[string]any, n)
+		for i := range rows {
+			rows[i] = make(map[string]any)
+		}
+		for i, ch := range rg[1].([]any) {
+			cm := ch.(map[int16]any)[3].(map[int16]any)
+			col := f.columns[i]
+			if cm[3].([]any)[0] != col.name {
+				t.Fatalf("chunk %d path = %v, want %s", i, cm[3], col.name)
+			}
+			values := readPage(t, data[cm[9].(int64):], col.typ, n)
+			for j, v := range values {
+				if v != nil {
+					rows[j][col.name] = v
+				}
+			}
+		}
+		f.rows = append(f.rows, rows...)
+		f.rowGroups++
+	}
+	return f
+}
+
+// readPage decodes the single data page of a column chunk.
+func readPage(t *testing.T, data []byte, typ int32, n int) []any {
+	t.Helper()
+	r := &thriftReader{data: data}
+	hdr := r.structure()
+	zr, err := gzip.NewReader(bytes.NewReader(data[r.pos : r.pos+int(hdr[3].(int64))]))
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	page, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	if len(page) != int(hdr[2].(int64)) {
+		t.Errorf("page size = %d, header says %d", len(page), hdr[2])
+	}
+
+	levelsLen := int(binary.LittleEndian.Uint32(page))
+	levels := &thriftReader{data: page[4 : 4+levelsLen]}
+	groups := levels.uvarint() >> 1
+	bits := page[4+levels.pos : 4+levels.pos+int(groups)]
+	page = page[4+levelsLen:]
+
+	values := make([]any, n)
+	nbool := 0
+	for i := range values {
+		if bits[i/8]&(1<<(i%8)) == 0 {
+			continue
+		}
+		switch typ {
+		case parquetBoolean:
+			values[i] = page[nbool/8]&(1<<(nbool%8)) != 0
+			nbool++
+		case parquetInt64:
+			values[i] = int64(binary.LittleEndian.Uint64(page))
+			page = page[8:]
+		case parquetDouble:
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(page))
+			page = page[8:]
+		case parquetByteArray:
+			l := int(binary.LittleEndian.Uint32(page))
+			values[i] = string(page[4 : 4+l])
+			page = page[4+l:]
+		}
+	}
+	return values
+}
+
+func parquetEntry(fields map[string]any) *parser.Entry {
+	e := parser.NewEntry("")
+	for k, v := range fields {
+		e.Fields[k] = v
+	}
+	return e
+}
+
+func TestParquetWriter(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewParquet(&buf, Options{})
+	for _, fields := range []map[string]any{
+		{"level": "info", "status": float64(200), "ok": true, "latency": 1.5, "tags": []any{"a"}},
+		{"level": "error", "status": float64(500), "ok": false, "latency": float64(2), "empty": nil},
+		{"level": "warn"},
+	} {
+		if err := p.Emit(parquetEntry(fields)); err != nil {
+			t.Fatalf("Emit() error: %v", err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	f := readParquet(t, buf.Bytes())
+	wantCols := []parquetColumn{
+		{"empty", parquetByteArray},
+		{"latency", parquetDouble},
+		{"level", parquetByteArray},
+		{"ok", parquetBoolean},
+		{"status", parquetInt64},
+		{"tags", parquetByteArray},
+		{ExtraColumn, parquetByteArray},
+	}
+	if !reflect.DeepEqual(f.columns, wantCols) {
+		t.Errorf("columns = %v, want %v", f.columns, wantCols)
+	}
+	if f.numRows != 3 || f.rowGroups != 1 {
+		t.Errorf("numRows = %d, rowGroups = %d", f.numRows, f.rowGroups)
+	}
+	wantRows := []map[string]any{
+		{"level": "info", "status": int64(200), "ok": true, "latency": 1.5, "tags": `["a"]`},
+		{"level": "error", "status": int64(500), "ok": false, "latency": float64(2)},
+		{"level": "warn"},
+	}
+	if !reflect.DeepEqual(f.rows, wantRows) {
+		t.Errorf("rows = %v, want %v", f.rows, wantRows)
+	}
+}
+
+func TestParquetWriter_RowGroupsAndExtra(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewParquet(&buf, Options{AddLineNumber: true}, WithRowGroupSize(2))
+	for i, fields := range []map[string]any{
+		{"n": float64(1)},
+		{"n": float64(2)},
+		{"n": "three", "new": "field"}, // after the schema is fixed
+	} {
+		e := parquetEntry(fields)
+		e.LineNum = i + 1
+		if err := p.Emit(e); err != nil {
+			t.Fatalf("Emit() error: %v", err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	f := readParquet(t, buf.Bytes())
+	if f.rowGroups != 2 || f.numRows != 3 {
+		t.Errorf("rowGroups = %d, numRows = %d, want 2, 3", f.rowGroups, f.numRows)
+	}
+	wantRows := []map[string]any{
+		{"n": int64(1), "_lineNumber": int64(1)},
+		{"n": int64(2), "_lineNumber": int64(2)},
+		{"_lineNumber": int64(3), ExtraColumn: `{"n":"three","new":"field"}`},
+	}
+	if !reflect.DeepEqual(f.rows, wantRows) {
+		t.Errorf("rows = %v, want %v", f.rows, wantRows)
+	}
+}
+
+func TestParquetWriter_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewParquet(&buf, Options{})
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+	f := readParquet(t, buf.Bytes())
+	if f.numRows != 0 || len(f.columns) != 1 || f.columns[0].name != ExtraColumn {
+		t.Errorf("empty file = %+v", f)
+	}
+	if err := p.Emit(parquetEntry(nil)); err == nil {
+		t.Error("Emit() after Close() expected error")
+	}
+}
+
+func TestParquetWriter_OmitEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewParquet(&buf, Options{OmitEmpty: true})
+	bad := parser.NewEntry("garbage")
+	bad.ParseError = io.ErrUnexpectedEOF
+	if err := p.Emit(bad); err != nil {
+		t.Fatalf("Emit() error: %v", err)
+	}
+	if err := p.Emit(parquetEntry(map[string]any{"a": "b"})); err != nil {
+		t.Fatalf("Emit() error: %v", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+	if f := readParquet(t, buf.Bytes()); f.numRows != 1 {
+		t.Errorf("numRows = %d, want 1", f.numRows)
+	}
+}
+
+func TestParquetWriter_FieldOrder(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewParquet(&buf, Options{FieldOrder: []string{"ts", "level", "absent"}})
+	_ = p.Emit(parquetEntry(map[string]any{"msg": "hi", "level": "info", "ts": "t1", "code": float64(1)}))
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	var names []string
+	for _, col := range readParquet(t, buf.Bytes()).columns {
+		names = append(names, col.name)
+	}
+	want := []string{"ts", "level", "code", "msg", ExtraColumn}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("columns = %v, want %v", names, want)
+	}
+}
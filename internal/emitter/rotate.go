@@ -0,0 +1,203 @@
+package emitter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// RotateConfig controls when a RotatingFile starts a new file and what
+// happens to the old ones.
+type RotateConfig struct {
+	Size     int64         // Rotate once the file reaches this many bytes (0: never)
+	Interval time.Duration // Rotate once the file is this old (0: never)
+	Keep     int           // Rotated files to keep (0: all)
+	Compress bool          // Gzip rotated files
+	Append   bool          // Add to an existing file instead of truncating it
+}
+
+// RotatingFile is a file writer that rotates by size and age, in the
+// style of logrotate: the current file keeps its name, and rotated files
+// are numbered path.1 (newest), path.2, ... with a .gz suffix when
+// compressed.
+//
+// Rotation only happens at the end of a line, so an NDJSON entry is never
+// split across files. A write of several lines, as from a buffered
+// emitter, is split at the line that reaches the size limit.
+type RotatingFile struct {
+	path   string
+	cfg    RotateConfig
+	now    func() time.Time
+	file   *os.File
+	size   int64
+	opened time.Time
+	atEOL  bool
+}
+
+// NewRotatingFile creates (or truncates, or with cfg.Append appends to)
+// path and rotates it according to cfg. An appended file's size counts
+// toward cfg.Size; its age counts from now.
+func NewRotatingFile(path string, cfg RotateConfig) (*RotatingFile, error) {
+	if cfg.Size < 0 || cfg.Interval < 0 || cfg.Keep < 0 {
+		return nil, errors.New("rotation settings must not be negative")
+	}
+	f := &RotatingFile{path: path, cfg: cfg, now: time.Now}
+	if err := f.open(cfg.Append); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write appends p to the current file, rotating first if it is due.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	written := 0
+	for len(p) > 0 {
+		if f.atEOL && f.due() {
+			if err := f.rotate(); err != nil {
+				return written, fmt.Errorf("cannot rotate %s: %w", f.path, err)
+			}
+		}
+
+		// Up to the end of the line reaching the size limit, if any
+		chunk := p
+		if room := f.cfg.Size - f.size; f.cfg.Size > 0 && room < int64(len(p)) {
+			start := int(max(room, 1)) - 1
+			if i := bytes.IndexByte(p[start:], '\n'); i >= 0 {
+				chunk = p[:start+i+1]
+			}
+		}
+
+		n, err := f.file.Write(chunk)
+		written += n
+		f.size += int64(n)
+		if n > 0 {
+			f.atEOL = chunk[n-1] == '\n'
+		}
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Close closes the current file.
+func (f *RotatingFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// due reports whether the current file has reached its size or age limit.
+func (f *RotatingFile) due() bool {
+	if f.cfg.Size > 0 && f.size >= f.cfg.Size {
+		return true
+	}
+	return f.cfg.Interval > 0 && f.now().Sub(f.opened) >= f.cfg.Interval
+}
+
+func (f *RotatingFile) open(appendExisting bool) error {
+	file, err := OpenOutputFile(f.path, appendExisting)
+	if err != nil {
+		return err
+	}
+	f.size = 0
+	if appendExisting {
+		info, err := file.Stat()
+		if err != nil {
+			_ = file.Close()
+			return err
+		}
+		f.size = info.Size()
+	}
+	f.file = file
+	f.opened = f.now()
+	f.atEOL = true
+	return nil
+}
+
+// rotate closes the current file, shifts the numbered files up by one,
+// dropping any beyond Keep, and starts a new file.
+func (f *RotatingFile) rotate() error {
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	last := f.cfg.Keep
+	if last == 0 {
+		// Keep everything: shift up to the first free number.
+		last = 1
+		for exists(f.rotatedName(last)) {
+			last++
+		}
+	} else if err := os.Remove(f.rotatedName(last)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for i := last - 1; i >= 1; i-- {
+		if err := os.Rename(f.rotatedName(i), f.rotatedName(i+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	if f.cfg.Compress {
+		if err := gzipFile(f.path, f.rotatedName(1)); err != nil {
+			return err
+		}
+		if err := os.Remove(f.path); err != nil {
+			return err
+		}
+	} else if err := os.Rename(f.path, f.rotatedName(1)); err != nil {
+		return err
+	}
+	return f.open(false)
+}
+
+// rotatedName returns the name of the nth newest rotated file.
+func (f *RotatingFile) rotatedName(n int) string {
+	name := fmt.Sprintf("%s.%d", f.path, n)
+	if f.cfg.Compress {
+		name += ".gz"
+	}
+	return name
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// gzipFile writes a gzip-compressed copy of src to dst.
+func gzipFile(src, dst string) (err error) {
+	in, err := os.Open(src) // #nosec G304 -- the user's --output path
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := os.Create(dst) // #nosec G304 -- derived from the user's --output path
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		return err
+	}
+	return zw.Close()
+}
@@ -0,0 +1,159 @@
+package emitter
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readRotated returns the contents of a file, decompressing .gz files, or
+// "" if it does not exist.
+func readRotated(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer func() { _ = f.Close() }()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("gzip.NewReader(%s) error: %v", path, err)
+		}
+		r = zr
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestRotatingFile_Size(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  RotateConfig
+		want map[string]string
+	}{
+		{
+			name: "keep all",
+			cfg:  RotateConfig{Size: 4},
+			want: map[string]string{"out": "e\n", "out.1": "c\nd\n", "out.2": "a\nb\n"},
+		},
+		{
+			name: "keep one",
+			cfg:  RotateConfig{Size: 4, Keep: 1},
+			want: map[string]string{"out": "e\n", "out.1": "c\nd\n", "out.2": ""},
+		},
+		{
+			name: "compressed",
+			cfg:  RotateConfig{Size: 4, Compress: true},
+			want: map[string]string{"out": "e\n", "out.1.gz": "c\nd\n", "out.2.gz": "a\nb\n", "out.1": ""},
+		},
+	}
+
+	// Lines rotate alike written one by one or together, as a buffered
+	// emitter writes them
+	writes := map[string][]string{
+		"line by line": {"a\n", "b\n", "c\n", "d\n", "e\n"},
+		"one write":    {"a\nb\nc\nd\ne\n"},
+	}
+	for _, tt := range tests {
+		for mode, lines := range writes {
+			t.Run(tt.name+" "+mode, func(t *testing.T) {
+				dir := t.TempDir()
+				f, err := NewRotatingFile(filepath.Join(dir, "out"), tt.cfg)
+				if err != nil {
+					t.Fatalf("NewRotatingFile() error: %v", err)
+				}
+				for _, line := range lines {
+					if n, err := f.Write([]byte(line)); err != nil || n != len(line) {
+						t.Fatalf("Write() = %d, %v; want %d", n, err, len(line))
+					}
+				}
+				if err := f.Close(); err != nil {
+					t.Fatalf("Close() error: %v", err)
+				}
+				for name, want := range tt.want {
+					if got := readRotated(t, filepath.Join(dir, name)); got != want {
+						t.Errorf("%s = %q, want %q", name, got, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestRotatingFile_Interval(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out")
+	f, err := NewRotatingFile(path, RotateConfig{Interval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewRotatingFile() error: %v", err)
+	}
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	f.now = func() time.Time { return now }
+	f.opened = now
+
+	_, _ = f.Write([]byte("a\n"))
+	now = now.Add(59 * time.Minute)
+	_, _ = f.Write([]byte("b\n"))
+	now = now.Add(time.Minute)
+	_, _ = f.Write([]byte("c\n"))
+	_ = f.Close()
+
+	if got := readRotated(t, path+".1"); got != "a\nb\n" {
+		t.Errorf("out.1 = %q", got)
+	}
+	if got := readRotated(t, path); got != "c\n" {
+		t.Errorf("out = %q", got)
+	}
+}
+
+func TestRotatingFile_KeepsLinesWhole(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out")
+	f, err := NewRotatingFile(path, RotateConfig{Size: 2})
+	if err != nil {
+		t.Fatalf("NewRotatingFile() error: %v", err)
+	}
+	for _, part := range []string{"abc", "def\n", "g\n"} {
+		_, _ = f.Write([]byte(part))
+	}
+	_ = f.Close()
+
+	if got := readRotated(t, path+".1"); got != "abcdef\n" {
+		t.Errorf("out.1 = %q, want the whole first line", got)
+	}
+	if got := readRotated(t, path); got != "g\n" {
+		t.Errorf("out = %q", got)
+	}
+}
+
+func TestRotatingFile_Append(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out")
+	if err := os.WriteFile(path, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewRotatingFile(path, RotateConfig{Size: 6, Append: true})
+	if err != nil {
+		t.Fatalf("NewRotatingFile() error: %v", err)
+	}
+
+	// The existing 4 bytes count toward the size limit
+	_, _ = f.Write([]byte("a\n"))
+	_, _ = f.Write([]byte("b\n"))
+	_ = f.Close()
+
+	if got := readRotated(t, path+".1"); got != "old\na\n" {
+		t.Errorf("out.1 = %q", got)
+	}
+	if got := readRotated(t, path); got != "b\n" {
+		t.Errorf("out = %q", got)
+	}
+}
@@ -0,0 +1,53 @@
+package emitter
+
+import (
+	"github.com/juliosaraiva/log2json/internal/expr"
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// Route sends entries matching a predicate to a destination emitter.
+type Route struct {
+	// Match selects entries for this route; nil matches everything
+	// (the default route).
+	Match *expr.Expr
+
+	// Dest receives matching entries.
+	Dest *Emitter
+}
+
+// Router dispatches each entry to the first route whose predicate
+// matches. Entries matching no route are dropped.
+type Router struct {
+	routes []Route
+}
+
+// NewRouter creates a router over the given routes, tried in order.
+func NewRouter(routes []Route) *Router {
+	return &Router{routes: routes}
+}
+
+// Emit writes the entry to the first matching route's destination.
+func (r *Router) Emit(entry *parser.Entry) error {
+	for _, route := range r.routes {
+		if route.Match == nil || route.Match.Match(entry.Fields) {
+			return route.Dest.Emit(entry)
+		}
+	}
+	return nil
+}
+
+// Close flushes every destination once, returning the first error.
+func (r *Router) Close() error {
+	var firstErr error
+	closed := make(map[*Emitter]bool, len(r.routes))
+	for _, route := range r.routes {
+		if closed[route.Dest] {
+			continue
+		}
+		closed[route.Dest] = true
+		if err := route.Dest.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,66 @@
+package emitter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/expr"
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func TestRouter_Emit(t *testing.T) {
+	var errBuf, warnBuf, defBuf bytes.Buffer
+	errEm := New(&errBuf, Options{})
+	warnEm := New(&warnBuf, Options{})
+	defEm := New(&defBuf, Options{})
+
+	isErr, _ := expr.Compile(`level == "error"`)
+	isWarn, _ := expr.Compile(`level == "warn"`)
+
+	r := NewRouter([]Route{
+		{Match: isErr, Dest: errEm},
+		{Match: isWarn, Dest: warnEm},
+		{Dest: defEm},
+	})
+
+	for _, level := range []string{"error", "warn", "info", "error"} {
+		e := parser.NewEntry(level)
+		e.Fields["level"] = level
+		if err := r.Emit(e); err != nil {
+			t.Fatalf("Emit error: %v", err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	count := func(b *bytes.Buffer) int { return strings.Count(b.String(), "\n") }
+	if count(&errBuf) != 2 || count(&warnBuf) != 1 || count(&defBuf) != 1 {
+		t.Errorf("routed counts error=%d warn=%d default=%d, want 2/1/1", count(&errBuf), count(&warnBuf), count(&defBuf))
+	}
+}
+
+func TestRouter_NoDefaultDrops(t *testing.T) {
+	var buf bytes.Buffer
+	isErr, _ := expr.Compile(`level == "error"`)
+	r := NewRouter([]Route{{Match: isErr, Dest: New(&buf, Options{})}})
+
+	e := parser.NewEntry("info")
+	e.Fields["level"] = "info"
+	if err := r.Emit(e); err != nil {
+		t.Fatalf("Emit error: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("unmatched entry should be dropped, got %q", buf.String())
+	}
+}
+
+func TestRouter_SharedDestClosedOnce(t *testing.T) {
+	var buf bytes.Buffer
+	em := New(&buf, Options{})
+	r := NewRouter([]Route{{Dest: em}, {Dest: em}})
+	if err := r.Close(); err != nil {
+		t.Errorf("Close error: %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package emitter
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// DefaultMaxShards is how many files a ShardWriter keeps open by default.
+const DefaultMaxShards = 64
+
+// Shard file names stand for values that cannot name a file themselves.
+const (
+	shardMissing = "_none" // the field is missing or null
+	shardEmpty   = "_empty"
+)
+
+// maxShardName bounds the length of a value in a shard's file name.
+const maxShardName = 128
+
+// ShardOpenFunc opens the file of a shard for writing. reopen is set when
+// the shard was open before and closed to make room for another, so its
+// file must be appended to.
+type ShardOpenFunc func(path string, reopen bool) (io.WriteCloser, error)
+
+// ShardWriter writes each entry as JSON to a file named after the value
+// of a field, splitting one stream into a file per value. The value is
+// made safe as a file name first, so it cannot leave the directory the
+// path names. At most maxOpen files are kept open: the one written least
+// recently is closed to open another, and reopened to append to when its
+// value comes up again.
+type ShardWriter struct {
+	field    string
+	template string // the path, with {field} where the value goes
+	options  Options
+	open     ShardOpenFunc
+	maxOpen  int
+
+	shards map[string]*list.Element // open shards by path
+	lru    *list.List               // open shards, most recently written first
+	opened map[string]bool          // paths opened before
+}
+
+// shard is an open file of a ShardWriter.
+type shard struct {
+	path string
+	file io.WriteCloser
+	em   *Emitter
+}
+
+// NewShardWriter creates a writer from a spec of the form
+// "field:path", where the path holds {field}, as in
+// "program:out/{program}.ndjson". Entries are written with opts; maxOpen
+// of 0 means DefaultMaxShards.
+func NewShardWriter(spec string, opts Options, open ShardOpenFunc, maxOpen int) (*ShardWriter, error) {
+	field, template, ok := strings.Cut(spec, ":")
+	field, template = strings.TrimSpace(field), strings.TrimSpace(template)
+	if !ok || field == "" || template == "" {
+		return nil, fmt.Errorf("expected field:path, got %q", spec)
+	}
+	if !strings.Contains(template, "{"+field+"}") {
+		return nil, fmt.Errorf("path %q does not hold {%s}", template, field)
+	}
+	if maxOpen < 0 {
+		return nil, fmt.Errorf("open file limit %d is negative", maxOpen)
+	}
+	if maxOpen == 0 {
+		maxOpen = DefaultMaxShards
+	}
+	return &ShardWriter{
+		field:    field,
+		template: template,
+		options:  opts,
+		open:     open,
+		maxOpen:  maxOpen,
+		shards:   make(map[string]*list.Element),
+		lru:      list.New(),
+		opened:   make(map[string]bool),
+	}, nil
+}
+
+// Emit writes the entry to the file of its field's value.
+func (w *ShardWriter) Emit(entry *parser.Entry) error {
+	value := shardMissing
+	if v, ok := entry.Fields[w.field]; ok && v != nil {
+		value = ShardName(fmt.Sprint(v))
+	}
+	s, err := w.shard(strings.ReplaceAll(w.template, "{"+w.field+"}", value))
+	if err != nil {
+		return err
+	}
+	return s.em.Emit(entry)
+}
+
+// shard returns the open shard for path, opening it, and closing the
+// least recently written one if too many are open.
+func (w *ShardWriter) shard(path string) (*shard, error) {
+	if el, ok := w.shards[path]; ok {
+		w.lru.MoveToFront(el)
+		return el.Value.(*shard), nil
+	}
+	if w.lru.Len() >= w.maxOpen {
+		if err := w.closeShard(w.lru.Back()); err != nil {
+			return nil, err
+		}
+	}
+	f, err := w.open(path, w.opened[path])
+	if err != nil {
+		return nil, err
+	}
+	w.opened[path] = true
+	s := &shard{path: path, file: f, em: New(f, w.options)}
+	w.shards[path] = w.lru.PushFront(s)
+	return s, nil
+}
+
+// closeShard flushes and closes an open shard.
+func (w *ShardWriter) closeShard(el *list.Element) error {
+	s := w.lru.Remove(el).(*shard)
+	delete(w.shards, s.path)
+	err := s.em.Close()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+	return nil
+}
+
+// Close flushes and closes every open file, returning the first error.
+func (w *ShardWriter) Close() error {
+	var firstErr error
+	for w.lru.Len() > 0 {
+		if err := w.closeShard(w.lru.Front()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ShardName makes a field value safe as part of a file name: characters
+// other than ASCII letters, digits, '.', '-' and '_' become '_', and a
+// long value is cut short. An empty value, and one of only dots, which
+// would name a directory, get names of their own.
+func ShardName(value string) string {
+	if len(value) > maxShardName {
+		value = value[:maxShardName]
+	}
+	b := []byte(value)
+	dots := true
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+			dots = false
+		case c == '.':
+		default:
+			b[i] = '_'
+			dots = false
+		}
+	}
+	switch {
+	case len(b) == 0:
+		return shardEmpty
+	case dots:
+		return strings.Repeat("_", len(b))
+	}
+	return string(b)
+}
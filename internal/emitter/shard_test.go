@@ -0,0 +1,143 @@
+package emitter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// memFiles is a ShardOpenFunc over in-memory files, recording opens.
+type memFiles struct {
+	files map[string]*bytes.Buffer
+	opens []string
+	open  int // files open now
+}
+
+type memFile struct {
+	*bytes.Buffer
+	m *memFiles
+}
+
+func (f memFile) Close() error {
+	f.m.open--
+	return nil
+}
+
+func (m *memFiles) Open(path string, reopen bool) (io.WriteCloser, error) {
+	if m.files == nil {
+		m.files = make(map[string]*bytes.Buffer)
+	}
+	if !reopen || m.files[path] == nil {
+		m.files[path] = &bytes.Buffer{}
+	}
+	m.opens = append(m.opens, fmt.Sprintf("%s reopen=%v", path, reopen))
+	m.open++
+	return memFile{m.files[path], m}, nil
+}
+
+func programEntry(program any) *parser.Entry {
+	e := parser.NewEntry("x")
+	e.Fields["msg"] = "x"
+	if program != nil {
+		e.Fields["program"] = program
+	}
+	return e
+}
+
+func TestShardWriter(t *testing.T) {
+	m := &memFiles{}
+	w, err := NewShardWriter("program:out/{program}.ndjson", Options{}, m.Open, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, program := range []any{"sshd", "cron", "sshd", nil, "../etc/passwd", 42, ""} {
+		if err := w.Emit(programEntry(program)); err != nil {
+			t.Fatalf("Emit(%v) error: %v", program, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	want := map[string]int{
+		"out/sshd.ndjson":          2,
+		"out/cron.ndjson":          1,
+		"out/_none.ndjson":         1,
+		"out/.._etc_passwd.ndjson": 1,
+		"out/42.ndjson":            1,
+		"out/_empty.ndjson":        1,
+	}
+	if len(m.files) != len(want) {
+		t.Errorf("wrote %d files, want %d: %v", len(m.files), len(want), m.opens)
+	}
+	for path, n := range want {
+		if got := strings.Count(m.files[path].String(), "\n"); got != n {
+			t.Errorf("%s has %d entries, want %d", path, got, n)
+		}
+	}
+	if m.open != 0 {
+		t.Errorf("%d files left open", m.open)
+	}
+}
+
+func TestShardWriter_LimitsOpenFiles(t *testing.T) {
+	m := &memFiles{}
+	w, err := NewShardWriter("program:{program}", Options{}, m.Open, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, program := range []string{"a", "b", "a", "c", "a", "b"} {
+		if err := w.Emit(programEntry(program)); err != nil {
+			t.Fatal(err)
+		}
+		if m.open > 2 {
+			t.Fatalf("%d files open, want at most 2", m.open)
+		}
+	}
+	_ = w.Close()
+
+	// b was closed for c, and is appended to once reopened
+	wantOpens := "a reopen=false,b reopen=false,c reopen=false,b reopen=true"
+	if got := strings.Join(m.opens, ","); got != wantOpens {
+		t.Errorf("opens = %s, want %s", got, wantOpens)
+	}
+	for path, n := range map[string]int{"a": 3, "b": 2, "c": 1} {
+		if got := strings.Count(m.files[path].String(), "\n"); got != n {
+			t.Errorf("%s has %d entries, want %d", path, got, n)
+		}
+	}
+}
+
+func TestNewShardWriter_Errors(t *testing.T) {
+	m := &memFiles{}
+	for _, spec := range []string{"program", ":out/{program}", "program:", "program:out/{host}.ndjson"} {
+		if _, err := NewShardWriter(spec, Options{}, m.Open, 0); err == nil {
+			t.Errorf("NewShardWriter(%q) succeeded", spec)
+		}
+	}
+	if _, err := NewShardWriter("program:{program}", Options{}, m.Open, -1); err == nil || err.Error() != "open file limit -1 is negative" {
+		t.Errorf("NewShardWriter with a negative limit: error = %v", err)
+	}
+}
+
+func TestShardName(t *testing.T) {
+	tests := []struct{ value, want string }{
+		{"nginx", "nginx"},
+		{"kube-proxy_1.2", "kube-proxy_1.2"},
+		{"a/b\\c d", "a_b_c_d"},
+		{"..", "__"},
+		{".", "_"},
+		{"", "_empty"},
+		{"naïve", "na__ve"},
+		{strings.Repeat("x", 300), strings.Repeat("x", maxShardName)},
+	}
+	for _, tt := range tests {
+		if got := ShardName(tt.value); got != tt.want {
+			t.Errorf("ShardName(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
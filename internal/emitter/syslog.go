@@ -0,0 +1,377 @@
+package emitter
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+	"github.com/juliosaraiva/log2json/internal/transform"
+)
+
+// DefaultSyslogTimeout bounds connecting to and writing to a syslog
+// collector.
+const DefaultSyslogTimeout = 10 * time.Second
+
+// DefaultSyslogSDID is the SD-ID of the structured-data element holding
+// fields with no RFC 5424 header slot. 32473 is the enterprise number
+// reserved for documentation (RFC 5612); collectors treat the element as
+// opaque.
+const DefaultSyslogSDID = "fields@32473"
+
+// Header fields are taken from the first of these entry fields present.
+var (
+	SyslogHostFields    = []string{"host", "hostname"}
+	SyslogAppFields     = []string{"program", "app", "appname", "app_name", "service"}
+	SyslogProcIDFields  = []string{"pid", "procid", "process_id"}
+	SyslogMsgIDFields   = []string{"msgid", "msg_id"}
+	syslogHeaderLengths = [...]int{255, 48, 128, 32} // HOSTNAME, APP-NAME, PROCID, MSGID
+)
+
+// syslogSeverity maps normalized levels to RFC 5424 severities.
+var syslogSeverity = map[transform.Level]int{
+	transform.LevelTrace:    7,
+	transform.LevelDebug:    7,
+	transform.LevelInfo:     6,
+	transform.LevelNotice:   5,
+	transform.LevelWarn:     4,
+	transform.LevelError:    3,
+	transform.LevelCritical: 2,
+	transform.LevelFatal:    2,
+}
+
+// syslogFacilities names the RFC 5424 facilities.
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"ntp": 12, "security": 13, "console": 14, "solaris-cron": 15,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// ParseSyslogFacility reads a facility name (user, local0, ...) or number.
+func ParseSyslogFacility(s string) (int, error) {
+	if n, ok := syslogFacilities[strings.ToLower(s)]; ok {
+		return n, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 && n <= 23 {
+		return n, nil
+	}
+	return 0, fmt.Errorf("unknown syslog facility %q (use a name such as user or local0, or 0-23)", s)
+}
+
+// SyslogWriter sends entries to a syslog collector as RFC 5424
+// messages: over UDP, one per datagram, for syslog:// URLs, or over TCP
+// (syslog+tcp://) or TLS (syslog+tls://) with RFC 6587 octet-counting
+// framing.
+//
+// The timestamp, level, host, program, pid and message fields fill the
+// message header and body; the other fields become parameters of one
+// structured-data element.
+type SyslogWriter struct {
+	options  Options
+	network  string // udp, tcp or tls
+	addr     string
+	sdID     string
+	facility int
+	hostname string // HOSTNAME for entries without a host field
+	timeout  time.Duration
+	conn     net.Conn
+	buf      []byte
+	now      func() time.Time
+}
+
+// SyslogOption configures a SyslogWriter.
+type SyslogOption func(*SyslogWriter)
+
+// WithSyslogFacility sets the facility of every message (default user).
+func WithSyslogFacility(facility int) SyslogOption {
+	return func(w *SyslogWriter) {
+		w.facility = facility
+	}
+}
+
+// WithSyslogSDID sets the SD-ID of the element carrying extra fields
+// (default DefaultSyslogSDID).
+func WithSyslogSDID(id string) SyslogOption {
+	return func(w *SyslogWriter) {
+		w.sdID = id
+	}
+}
+
+// WithSyslogTimeout bounds connecting and each write (default
+// DefaultSyslogTimeout).
+func WithSyslogTimeout(d time.Duration) SyslogOption {
+	return func(w *SyslogWriter) {
+		if d > 0 {
+			w.timeout = d
+		}
+	}
+}
+
+// IsSyslogURL reports whether an output names a syslog collector.
+func IsSyslogURL(s string) bool {
+	return strings.HasPrefix(s, "syslog://") || strings.HasPrefix(s, "syslog+")
+}
+
+// NewSyslog connects to the collector at rawURL: syslog://host[:port]
+// or syslog+udp:// for UDP, syslog+tcp:// or syslog+tls:// otherwise.
+// The port defaults to 514, or 6514 for TLS.
+func NewSyslog(rawURL string, opts Options, sopts ...SyslogOption) (*SyslogWriter, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	w := &SyslogWriter{
+		options:  opts,
+		sdID:     DefaultSyslogSDID,
+		facility: 1,
+		timeout:  DefaultSyslogTimeout,
+		now:      time.Now,
+	}
+	port := "514"
+	switch u.Scheme {
+	case "syslog", "syslog+udp":
+		w.network = "udp"
+	case "syslog+tcp":
+		w.network = "tcp"
+	case "syslog+tls":
+		w.network = "tls"
+		port = "6514"
+	default:
+		return nil, fmt.Errorf("URL must be syslog://, syslog+udp://, syslog+tcp:// or syslog+tls://, got %q", rawURL)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("syslog URL %q has no host", rawURL)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	w.addr = net.JoinHostPort(u.Hostname(), port)
+	for _, opt := range sopts {
+		opt(w)
+	}
+	if !validSDName(w.sdID) {
+		return nil, fmt.Errorf("invalid structured-data ID %q", w.sdID)
+	}
+	if h, err := os.Hostname(); err == nil {
+		w.hostname = h
+	}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Emit sends an entry. A failed TCP or TLS write is retried once on a
+// new connection.
+func (w *SyslogWriter) Emit(entry *parser.Entry) error {
+	if w.options.OmitEmpty && entry.ParseError != nil {
+		return nil
+	}
+
+	msg := w.appendMessage(nil, entry)
+	if w.network != "udp" {
+		w.buf = strconv.AppendInt(w.buf[:0], int64(len(msg)), 10)
+		w.buf = append(w.buf, ' ')
+		msg = append(w.buf, msg...)
+	}
+	err := w.write(msg)
+	if err != nil && w.network != "udp" {
+		_ = w.conn.Close()
+		if err = w.connect(); err == nil {
+			err = w.write(msg)
+		}
+	}
+	return err
+}
+
+// Close closes the connection.
+func (w *SyslogWriter) Close() error {
+	return w.conn.Close()
+}
+
+func (w *SyslogWriter) connect() error {
+	dialer := &net.Dialer{Timeout: w.timeout}
+	var err error
+	if w.network == "tls" {
+		host, _, _ := net.SplitHostPort(w.addr)
+		w.conn, err = tls.DialWithDialer(dialer, "tcp", w.addr, &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+	} else {
+		w.conn, err = dialer.Dial(w.network, w.addr)
+	}
+	if err != nil {
+		return fmt.Errorf("syslog connect: %w", err)
+	}
+	return nil
+}
+
+func (w *SyslogWriter) write(msg []byte) error {
+	_ = w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+	_, err := w.conn.Write(msg)
+	return err
+}
+
+// appendMessage formats an entry as an RFC 5424 message:
+//
+//	<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD-ID name="value"...] MSG
+func (w *SyslogWriter) appendMessage(buf []byte, entry *parser.Entry) []byte {
+	fields := buildOutput(&w.options, entry)
+
+	ts := w.now()
+	for _, f := range transform.TimestampFields {
+		if t, ok := transform.ParseSyslogTime(fields[f], ts); ok {
+			ts = t
+			delete(fields, f)
+			break
+		}
+	}
+	severity := 6
+	for _, f := range transform.LevelFields {
+		v, ok := fields[f]
+		if !ok {
+			continue
+		}
+		if level, ok := transform.ParseLevel(v); ok {
+			severity = syslogSeverity[level]
+			delete(fields, f)
+		}
+		break
+	}
+
+	buf = append(buf, '<')
+	buf = strconv.AppendInt(buf, int64(w.facility*8+severity), 10)
+	buf = append(buf, ">1 "...)
+	buf = ts.AppendFormat(buf, "2006-01-02T15:04:05.999999Z07:00")
+
+	header := [...][]string{SyslogHostFields, SyslogAppFields, SyslogProcIDFields, SyslogMsgIDFields}
+	for i, names := range header {
+		value := ""
+		if i == 0 {
+			value = w.hostname
+		}
+		for _, f := range names {
+			if v, ok := fields[f]; ok && v != nil && v != "" {
+				value = fmt.Sprint(v)
+				delete(fields, f)
+				break
+			}
+		}
+		buf = append(buf, ' ')
+		buf = appendHeaderField(buf, value, syslogHeaderLengths[i])
+	}
+
+	msg := entry.Raw
+	for _, f := range MessageFields {
+		if v, ok := fields[f]; ok {
+			msg = syslogParamValue(v)
+			delete(fields, f)
+			break
+		}
+	}
+
+	buf = append(buf, ' ')
+	buf = w.appendStructuredData(buf, fields)
+	if msg != "" {
+		buf = append(buf, ' ')
+		buf = append(buf, msg...)
+	}
+	return buf
+}
+
+// appendStructuredData writes the remaining fields as one SD-ELEMENT,
+// or the nil value "-" if there are none.
+func (w *SyslogWriter) appendStructuredData(buf []byte, fields map[string]any) []byte {
+	if len(fields) == 0 {
+		return append(buf, '-')
+	}
+	names := make([]string, 0, len(fields))
+	for k := range fields {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	buf = append(buf, '[')
+	buf = append(buf, w.sdID...)
+	for _, k := range names {
+		buf = append(buf, ' ')
+		buf = appendSDName(buf, k)
+		buf = append(buf, '=', '"')
+		for _, r := range syslogParamValue(fields[k]) {
+			if r == '"' || r == '\\' || r == ']' {
+				buf = append(buf, '\\')
+			}
+			buf = append(buf, string(r)...)
+		}
+		buf = append(buf, '"')
+	}
+	return append(buf, ']')
+}
+
+// syslogParamValue renders a field value: strings as is, others as JSON.
+func syslogParamValue(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// appendHeaderField writes a header field: printable ASCII, at most max
+// bytes, with other characters replaced by "_", or "-" if empty.
+func appendHeaderField(buf []byte, s string, max int) []byte {
+	if s == "" {
+		return append(buf, '-')
+	}
+	for i := 0; i < len(s) && i < max; i++ {
+		c := s[i]
+		if c < 33 || c > 126 {
+			c = '_'
+		}
+		buf = append(buf, c)
+	}
+	return buf
+}
+
+// appendSDName writes a field name as a PARAM-NAME: at most 32
+// printable ASCII characters other than '=', ' ', ']' and '"'.
+func appendSDName(buf []byte, s string) []byte {
+	if s == "" {
+		return append(buf, '_')
+	}
+	for i := 0; i < len(s) && i < 32; i++ {
+		c := s[i]
+		if c < 33 || c > 126 || c == '=' || c == ']' || c == '"' {
+			c = '_'
+		}
+		buf = append(buf, c)
+	}
+	return buf
+}
+
+// validSDName reports whether s is a valid SD-NAME.
+func validSDName(s string) bool {
+	if s == "" || len(s) > 32 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 33 || c > 126 || c == '=' || c == ']' || c == '"' {
+			return false
+		}
+	}
+	return true
+}
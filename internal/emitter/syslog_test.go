@@ -0,0 +1,199 @@
+package emitter
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func TestSyslogWriter_Message(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		opts   Options
+		fields map[string]any
+		raw    string
+		err    error
+		want   string
+	}{
+		{
+			name: "syslog fields",
+			fields: map[string]any{
+				"timestamp": "2024-01-15T10:30:45.123Z", "host": "web1", "program": "sshd",
+				"pid": 1234, "message": "Accepted password for bob",
+			},
+			want: "<14>1 2024-01-15T10:30:45.123Z web1 sshd 1234 - - Accepted password for bob",
+		},
+		{
+			name:   "level and extra fields",
+			fields: map[string]any{"level": "ERROR", "msg": "upstream failed", "status": 502, "path": "/api", "tags": []any{"a"}},
+			want:   `<11>1 2024-03-01T12:00:00Z myhost - - - [fields@32473 path="/api" status="502" tags="[\"a\"\]"] upstream failed`,
+		},
+		{
+			name:   "escaping and sanitizing",
+			fields: map[string]any{"app": "my app", "q": `say "hi" \ ]`, "a=b": "x", "message": "m"},
+			want:   `<14>1 2024-03-01T12:00:00Z myhost my_app - - [fields@32473 a_b="x" q="say \"hi\" \\ \]"] m`,
+		},
+		{
+			name:   "raw line without message field",
+			fields: map[string]any{"level": "warn"},
+			raw:    "WARN disk almost full",
+			want:   "<12>1 2024-03-01T12:00:00Z myhost - - - - WARN disk almost full",
+		},
+		{
+			name:   "rfc 3164 timestamp",
+			fields: map[string]any{"timestamp": "Feb 28 23:59:59", "message": "m"},
+			want:   "<14>1 2024-02-28T23:59:59Z myhost - - - - m",
+		},
+		{
+			name:   "rfc 3164 timestamp from last year",
+			fields: map[string]any{"timestamp": "Dec 31 23:00:00", "message": "m"},
+			want:   "<14>1 2023-12-31T23:00:00Z myhost - - - - m",
+		},
+		{
+			name:   "metadata",
+			opts:   Options{AddLineNumber: true},
+			fields: map[string]any{"message": "m"},
+			err:    errors.New("bad"),
+			want:   `<14>1 2024-03-01T12:00:00Z myhost - - - [fields@32473 _lineNumber="9" _parseError="bad"] m`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &SyslogWriter{options: tt.opts, sdID: DefaultSyslogSDID, facility: 1, hostname: "myhost", now: func() time.Time { return now }}
+			entry := parser.NewEntry(tt.raw)
+			entry.Fields = tt.fields
+			entry.LineNum = 9
+			entry.ParseError = tt.err
+			if got := string(w.appendMessage(nil, entry)); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyslogWriter_UDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	w, err := NewSyslog("syslog://"+pc.LocalAddr().String(), Options{}, WithSyslogFacility(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for _, msg := range []string{"one", "two"} {
+		if err := w.Emit(&parser.Entry{Fields: map[string]any{"message": msg, "level": "info"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := make([]byte, 2048)
+	_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, want := range []string{"one", "two"} {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := string(buf[:n])
+		if !strings.HasPrefix(got, "<134>1 ") || !strings.HasSuffix(got, " - "+want) {
+			t.Errorf("datagram = %q", got)
+		}
+	}
+}
+
+func TestSyslogWriter_TCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+		// Octet-counting framing: "LEN SP MSG"
+		r := bufio.NewReader(conn)
+		var msgs []string
+		for {
+			size, err := r.ReadString(' ')
+			if err != nil {
+				break
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(size))
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(r, msg); err != nil {
+				break
+			}
+			msgs = append(msgs, string(msg))
+		}
+		received <- msgs
+	}()
+
+	w, err := NewSyslog("syslog+tcp://"+ln.Addr().String(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{"first line", "multi\nline"} {
+		if err := w.Emit(&parser.Entry{Fields: map[string]any{"message": msg}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = w.Close()
+
+	msgs := <-received
+	if len(msgs) != 2 || !strings.HasSuffix(msgs[0], " first line") || !strings.HasSuffix(msgs[1], " multi\nline") {
+		t.Errorf("received %q", msgs)
+	}
+}
+
+func TestNewSyslog_Errors(t *testing.T) {
+	tests := []struct {
+		url  string
+		opts []SyslogOption
+	}{
+		{url: "syslog+quic://localhost"},
+		{url: "syslog://"},
+		{url: "syslog://localhost:1", opts: []SyslogOption{WithSyslogSDID("bad id")}},
+	}
+	for _, tt := range tests {
+		if _, err := NewSyslog(tt.url, Options{}, tt.opts...); err == nil {
+			t.Errorf("NewSyslog(%q) succeeded", tt.url)
+		}
+	}
+}
+
+func TestParseSyslogFacility(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{in: "user", want: 1},
+		{in: "LOCAL7", want: 23},
+		{in: "3", want: 3},
+		{in: "24", wantErr: true},
+		{in: "nope", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSyslogFacility(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseSyslogFacility(%q) = %d, %v", tt.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package emitter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// templateFuncs are available to output templates in addition to Go's
+// builtins.
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"default": func(def, v any) any {
+		if v == nil || v == "" {
+			return def
+		}
+		return v
+	},
+}
+
+// ParseTemplate parses an output template. Fields are referenced as
+// {{.level}}, or {{index . "http.status"}} for names that are not Go
+// identifiers.
+func ParseTemplate(text string) (*template.Template, error) {
+	return template.New("output").Funcs(templateFuncs).Parse(text)
+}
+
+// TemplateWriter renders each entry through a text/template, one line
+// per entry. Fields the template names but an entry lacks render empty
+// rather than as "<no value>".
+type TemplateWriter struct {
+	writer  *flushWriter
+	options Options
+	tmpl    *template.Template
+	fields  []string // top-level fields the template refers to
+	buf     bytes.Buffer
+}
+
+// NewTemplate creates a writer rendering entries with tmpl.
+func NewTemplate(output io.Writer, opts Options, tmpl *template.Template) *TemplateWriter {
+	t := &TemplateWriter{
+		writer:  newFlushWriter(output, opts),
+		options: opts,
+		tmpl:    tmpl,
+	}
+	seen := make(map[string]bool)
+	for _, tt := range tmpl.Templates() {
+		if tt.Tree != nil {
+			collectFields(tt.Tree.Root, seen)
+		}
+	}
+	for f := range seen {
+		t.fields = append(t.fields, f)
+	}
+	return t
+}
+
+// Emit renders an entry, adding a newline unless the template ends
+// with one.
+func (t *TemplateWriter) Emit(entry *parser.Entry) error {
+	if t.options.OmitEmpty && entry.ParseError != nil {
+		return nil
+	}
+
+	data := buildOutput(&t.options, entry)
+	for _, f := range t.fields {
+		if _, ok := data[f]; !ok {
+			data[f] = ""
+		}
+	}
+	t.buf.Reset()
+	if err := t.tmpl.Execute(&t.buf, data); err != nil {
+		return fmt.Errorf("template: %w", err)
+	}
+	if t.buf.Len() == 0 || t.buf.Bytes()[t.buf.Len()-1] != '\n' {
+		t.buf.WriteByte('\n')
+	}
+	if _, err := t.writer.Write(t.buf.Bytes()); err != nil {
+		return err
+	}
+	return t.writer.entryDone()
+}
+
+// Close flushes any remaining data.
+func (t *TemplateWriter) Close() error {
+	return t.writer.Flush()
+}
+
+// collectFields records the top-level fields a template refers to, such
+// as "level" in {{.level}}. Inside range and with, dot is something else,
+// so their bodies are skipped.
+func collectFields(node parse.Node, seen map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			collectFields(c, seen)
+		}
+	case *parse.ActionNode:
+		collectFields(n.Pipe, seen)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectFields(cmd, seen)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectFields(arg, seen)
+		}
+	case *parse.FieldNode:
+		if len(n.Ident) == 1 {
+			seen[n.Ident[0]] = true
+		}
+	case *parse.ChainNode:
+		collectFields(n.Node, seen)
+	case *parse.IfNode:
+		collectFields(n.Pipe, seen)
+		collectFields(n.List, seen)
+		collectFields(n.ElseList, seen)
+	case *parse.RangeNode:
+		collectFields(n.Pipe, seen)
+		collectFields(n.ElseList, seen)
+	case *parse.WithNode:
+		collectFields(n.Pipe, seen)
+		collectFields(n.ElseList, seen)
+	}
+}
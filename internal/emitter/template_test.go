@@ -0,0 +1,111 @@
+package emitter
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func TestTemplateWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		tmpl   string
+		fields map[string]any
+		opts   Options
+		want   string
+	}{
+		{
+			name:   "fields",
+			tmpl:   "{{.timestamp}} {{.level}} {{.message}}",
+			fields: map[string]any{"timestamp": "2024-01-15T10:00:00Z", "level": "info", "message": "started"},
+			want:   "2024-01-15T10:00:00Z info started\n",
+		},
+		{
+			name:   "missing field renders empty",
+			tmpl:   "[{{.level}}] {{.user}}",
+			fields: map[string]any{"level": "warn"},
+			want:   "[warn] \n",
+		},
+		{
+			name:   "trailing newline kept",
+			tmpl:   "{{.level}}\n",
+			fields: map[string]any{"level": "info"},
+			want:   "info\n",
+		},
+		{
+			name:   "functions",
+			tmpl:   `{{upper .level}} {{default "-" .user}} {{json .tags}} {{index . "http.status"}}`,
+			fields: map[string]any{"level": "error", "tags": []any{"a", "b"}, "http.status": 500},
+			want:   `ERROR - ["a","b"] 500` + "\n",
+		},
+		{
+			name:   "conditional",
+			tmpl:   `{{.msg}}{{if .error}} error={{.error}}{{end}}`,
+			fields: map[string]any{"msg": "done"},
+			want:   "done\n",
+		},
+		{
+			name:   "range keeps element fields",
+			tmpl:   `{{range .items}}{{.name}};{{end}}`,
+			fields: map[string]any{"items": []any{map[string]any{"name": "x"}, map[string]any{"name": "y"}}},
+			want:   "x;y;\n",
+		},
+		{
+			name:   "metadata",
+			tmpl:   "{{._lineNumber}}: {{.msg}}",
+			fields: map[string]any{"msg": "hi"},
+			opts:   Options{AddLineNumber: true},
+			want:   "7: hi\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate(tt.tmpl)
+			if err != nil {
+				t.Fatalf("ParseTemplate() error: %v", err)
+			}
+			var buf bytes.Buffer
+			w := NewTemplate(&buf, tt.opts, tmpl)
+			entry := parser.NewEntry("raw")
+			entry.LineNum = 7
+			entry.Fields = tt.fields
+			if err := w.Emit(entry); err != nil {
+				t.Fatalf("Emit() error: %v", err)
+			}
+			_ = w.Close()
+			if buf.String() != tt.want {
+				t.Errorf("got %q, want %q", buf.String(), tt.want)
+			}
+			if _, ok := entry.Fields["user"]; ok {
+				t.Error("Emit() modified the entry")
+			}
+		})
+	}
+}
+
+func TestTemplateWriter_Errors(t *testing.T) {
+	if _, err := ParseTemplate("{{.level"); err == nil {
+		t.Error("ParseTemplate() expected error for unclosed action")
+	}
+
+	tmpl, err := ParseTemplate("{{.http.status}}")
+	if err != nil {
+		t.Fatalf("ParseTemplate() error: %v", err)
+	}
+	var buf bytes.Buffer
+	w := NewTemplate(&buf, Options{OmitEmpty: true}, tmpl)
+	e := parser.NewEntry("x")
+	e.Fields["http"] = "not a map"
+	if err := w.Emit(e); err == nil || !strings.Contains(err.Error(), "template") {
+		t.Errorf("Emit() error = %v, want a template error", err)
+	}
+
+	e.ParseError = errors.New("no parser")
+	if err := w.Emit(e); err != nil || buf.Len() != 0 {
+		t.Errorf("OmitEmpty entry rendered %q (err %v)", buf.String(), err)
+	}
+}
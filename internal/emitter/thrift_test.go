@@ -0,0 +1,128 @@
+package emitter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// thriftReader decodes the compact protocol subset written by
+// thriftWriter. Structs decode to map[int16]any, lists to []any.
+type thriftReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *thriftReader) byte() byte {
+	if r.pos >= len(r.data) {
+		panic("thrift: unexpected end of data")
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		panic("thrift: bad varint")
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.uvarint())
+		s := string(r.data[r.pos : r.pos+n])
+		r.pos += n
+		return s
+	case thriftList:
+		h := r.byte()
+		n, elem := int(h>>4), h&0x0f
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]any, n)
+		for i := range list {
+			list[i] = r.value(elem)
+		}
+		return list
+	case thriftStruct:
+		return r.structure()
+	}
+	panic(fmt.Sprintf("thrift: unsupported type %d", typ))
+}
+
+func (r *thriftReader) structure() map[int16]any {
+	fields := make(map[int16]any)
+	var last int16
+	for {
+		h := r.byte()
+		if h == 0 {
+			return fields
+		}
+		id := last + int16(h>>4)
+		if h>>4 == 0 {
+			id = int16(r.zigzag())
+		}
+		fields[id] = r.value(h & 0x0f)
+		last = id
+	}
+}
+
+func TestThriftWriter(t *testing.T) {
+	w := newThriftWriter()
+	w.i32(1, -3)
+	w.i64(2, 1<<40)
+	w.binary(20, "far") // long form field header
+	w.list(21, thriftI32, 2)
+	w.i32Elem(7)
+	w.i32Elem(-8)
+	w.list(22, thriftBinary, 16) // long form list header
+	for i := 0; i < 16; i++ {
+		w.binaryElem("x")
+	}
+	w.list(23, thriftStruct, 1)
+	w.beginStruct(0)
+	w.i32(5, 1)
+	w.endStruct()
+	w.beginStruct(24)
+	w.binary(1, "nested")
+	w.endStruct()
+	w.i32(25, 9) // field ids continue from the parent after a nested struct
+	w.endStruct()
+
+	r := &thriftReader{data: w.Bytes()}
+	got := r.structure()
+	if r.pos != len(r.data) {
+		t.Errorf("decoded %d of %d bytes", r.pos, len(r.data))
+	}
+
+	xs := make([]any, 16)
+	for i := range xs {
+		xs[i] = "x"
+	}
+	want := map[int16]any{
+		1:  int64(-3),
+		2:  int64(1 << 40),
+		20: "far",
+		21: []any{int64(7), int64(-8)},
+		22: xs,
+		23: []any{map[int16]any{5: int64(1)}},
+		24: map[int16]any{1: "nested"},
+		25: int64(9),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded %v, want %v", got, want)
+	}
+}
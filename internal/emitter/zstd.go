@@ -0,0 +1,393 @@
+package emitter
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// A minimal Zstandard (RFC 8878) encoder: one frame of blocks holding
+// raw literals and LZ77 sequences coded with the predefined FSE tables.
+// It compresses repetitive log output well without Huffman coding or
+// custom tables, and any zstd decoder can read it.
+const (
+	zstdMagic      = 0xFD2FB528
+	zstdBlockSize  = 128 << 10
+	zstdWindowDesc = 0x38 // 128 KiB window (exponent 7, mantissa 0); matches never cross blocks
+	zstdMinMatch   = 4
+	zstdHashLog    = 15
+
+	zstdBlockRaw        = 0
+	zstdBlockCompressed = 2
+)
+
+// Literal length codes: baseline and extra bits (RFC 8878, 3.1.1.3.2.1.1).
+var (
+	zstdLLBase = [36]uint32{
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512, 1024, 2048, 4096,
+		8192, 16384, 32768, 65536,
+	}
+	zstdLLBits = [36]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12,
+		13, 14, 15, 16,
+	}
+)
+
+// Match length codes: baseline and extra bits.
+var (
+	zstdMLBase = [53]uint32{
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18,
+		19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34,
+		35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051,
+		4099, 8195, 16387, 32771, 65539,
+	}
+	zstdMLBits = [53]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11,
+		12, 13, 14, 15, 16,
+	}
+)
+
+// Predefined FSE distributions (RFC 8878, 3.1.1.3.2.2); -1 marks a
+// "less than one" probability.
+var (
+	zstdLLNorm = []int16{
+		4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1,
+	}
+	zstdMLNorm = []int16{
+		1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1, -1, -1,
+	}
+	zstdOFNorm = []int16{
+		1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1,
+	}
+
+	zstdLLTable = newFSECTable(zstdLLNorm, 6)
+	zstdMLTable = newFSECTable(zstdMLNorm, 6)
+	zstdOFTable = newFSECTable(zstdOFNorm, 5)
+)
+
+// zstdWriter compresses everything written to it into one zstd frame,
+// completed by Close.
+type zstdWriter struct {
+	w      io.Writer
+	buf    []byte
+	out    []byte
+	seqs   []zstdSequence
+	lits   []byte
+	table  []int32
+	header bool
+	closed bool
+}
+
+type zstdSequence struct {
+	litLen, offset, matchLen uint32
+}
+
+func newZstdWriter(w io.Writer) *zstdWriter {
+	return &zstdWriter{w: w, table: make([]int32, 1<<zstdHashLog)}
+}
+
+// Write buffers p, compressing each full block.
+func (z *zstdWriter) Write(p []byte) (int, error) {
+	if z.closed {
+		return 0, errors.New("zstd: write after close")
+	}
+	z.buf = append(z.buf, p...)
+	var n int
+	for len(z.buf)-n >= zstdBlockSize {
+		if err := z.writeBlock(z.buf[n:n+zstdBlockSize], false); err != nil {
+			return 0, err
+		}
+		n += zstdBlockSize
+	}
+	z.buf = z.buf[:copy(z.buf, z.buf[n:])]
+	return len(p), nil
+}
+
+// Close writes the last block, ending the frame. It does not close the
+// underlying writer.
+func (z *zstdWriter) Close() error {
+	if z.closed {
+		return nil
+	}
+	z.closed = true
+	return z.writeBlock(z.buf, true)
+}
+
+func (z *zstdWriter) writeBlock(src []byte, last bool) error {
+	z.out = z.out[:0]
+	if !z.header {
+		z.out = binary.LittleEndian.AppendUint32(z.out, zstdMagic)
+		// Frame header descriptor 0: no content size, checksum or dictionary.
+		z.out = append(z.out, 0, zstdWindowDesc)
+		z.header = true
+	}
+
+	start := len(z.out)
+	z.out = append(z.out, 0, 0, 0) // block header, filled in below
+	blockType := zstdBlockCompressed
+	z.out = z.compressBlock(z.out, src)
+	if size := len(z.out) - start - 3; size == 0 || size >= len(src) {
+		blockType = zstdBlockRaw
+		z.out = append(z.out[:start+3], src...)
+	}
+
+	header := uint32(len(z.out)-start-3)<<3 | uint32(blockType)<<1
+	if last {
+		header |= 1
+	}
+	z.out[start] = byte(header)
+	z.out[start+1] = byte(header >> 8)
+	z.out[start+2] = byte(header >> 16)
+	_, err := z.w.Write(z.out)
+	return err
+}
+
+// compressBlock appends src as a compressed block body, or nothing if
+// it has no matches.
+func (z *zstdWriter) compressBlock(dst, src []byte) []byte {
+	z.findSequences(src)
+	if len(z.seqs) == 0 {
+		return dst
+	}
+
+	// Literals section: raw literals.
+	switch n := len(z.lits); {
+	case n < 32:
+		dst = append(dst, byte(n<<3))
+	case n < 4096:
+		dst = append(dst, byte(n<<4|1<<2), byte(n>>4))
+	default:
+		dst = append(dst, byte(n<<4|3<<2), byte(n>>4), byte(n>>12))
+	}
+	dst = append(dst, z.lits...)
+
+	// Sequences section header: count, then all three codes in
+	// predefined mode.
+	switch n := len(z.seqs); {
+	case n < 128:
+		dst = append(dst, byte(n))
+	case n < 0x7F00:
+		dst = append(dst, byte(n>>8+128), byte(n))
+	default:
+		dst = append(dst, 255, byte(n-0x7F00), byte((n-0x7F00)>>8))
+	}
+	dst = append(dst, 0)
+
+	// The bitstream is read backwards, so sequences are written last
+	// to first.
+	bw := bitWriter{out: dst}
+	codes := func(s zstdSequence) (ll, ml, of uint8) {
+		return zstdLLCode(s.litLen), zstdMLCode(s.matchLen), uint8(bits.Len32(s.offset+3) - 1)
+	}
+	addExtra := func(s zstdSequence, ll, ml, of uint8) {
+		bw.add(s.litLen-zstdLLBase[ll], zstdLLBits[ll])
+		bw.add(s.matchLen-zstdMLBase[ml], zstdMLBits[ml])
+		bw.add(s.offset+3-1<<of, of)
+	}
+
+	last := z.seqs[len(z.seqs)-1]
+	ll, ml, of := codes(last)
+	mlState := zstdMLTable.init(ml)
+	ofState := zstdOFTable.init(of)
+	llState := zstdLLTable.init(ll)
+	addExtra(last, ll, ml, of)
+	for i := len(z.seqs) - 2; i >= 0; i-- {
+		s := z.seqs[i]
+		ll, ml, of := codes(s)
+		ofState = zstdOFTable.encode(&bw, ofState, of)
+		mlState = zstdMLTable.encode(&bw, mlState, ml)
+		llState = zstdLLTable.encode(&bw, llState, ll)
+		addExtra(s, ll, ml, of)
+	}
+	zstdMLTable.flush(&bw, mlState)
+	zstdOFTable.flush(&bw, ofState)
+	zstdLLTable.flush(&bw, llState)
+	return bw.close()
+}
+
+// findSequences splits src into literals and matches within the block,
+// using a greedy single-entry hash table.
+func (z *zstdWriter) findSequences(src []byte) {
+	z.seqs = z.seqs[:0]
+	z.lits = z.lits[:0]
+	for i := range z.table {
+		z.table[i] = 0
+	}
+
+	anchor := 0
+	for i := 0; i+zstdMinMatch <= len(src); {
+		cur := binary.LittleEndian.Uint32(src[i:])
+		h := (cur * 2654435761) >> (32 - zstdHashLog)
+		cand := int(z.table[h]) - 1
+		z.table[h] = int32(i + 1)
+		if cand < 0 || binary.LittleEndian.Uint32(src[cand:]) != cur {
+			i++
+			continue
+		}
+
+		n := zstdMinMatch
+		for i+n < len(src) && src[cand+n] == src[i+n] {
+			n++
+		}
+		z.seqs = append(z.seqs, zstdSequence{
+			litLen:   uint32(i - anchor),
+			offset:   uint32(i - cand),
+			matchLen: uint32(n),
+		})
+		z.lits = append(z.lits, src[anchor:i]...)
+		i += n
+		anchor = i
+	}
+	z.lits = append(z.lits, src[anchor:]...)
+}
+
+func zstdLLCode(n uint32) uint8 {
+	if n < 16 {
+		return uint8(n)
+	}
+	code := len(zstdLLBase) - 1
+	for zstdLLBase[code] > n {
+		code--
+	}
+	return uint8(code)
+}
+
+func zstdMLCode(n uint32) uint8 {
+	if n < 35 {
+		return uint8(n - 3)
+	}
+	code := len(zstdMLBase) - 1
+	for zstdMLBase[code] > n {
+		code--
+	}
+	return uint8(code)
+}
+
+// fseCTable is an FSE encoding table built from a normalized
+// distribution.
+type fseCTable struct {
+	tableLog uint8
+	states   []uint16
+	symbols  []fseSymbol
+}
+
+type fseSymbol struct {
+	deltaNbBits    uint32
+	deltaFindState int32
+}
+
+func newFSECTable(norm []int16, tableLog uint8) *fseCTable {
+	size := 1 << tableLog
+	high := size - 1
+	cumul := make([]int, len(norm)+1)
+	symbolAt := make([]uint8, size)
+	for s, n := range norm {
+		if n == -1 {
+			cumul[s+1] = cumul[s] + 1
+			symbolAt[high] = uint8(s)
+			high--
+		} else {
+			cumul[s+1] = cumul[s] + int(n)
+		}
+	}
+
+	// Spread symbols exactly as decoders do.
+	pos, step, mask := 0, size>>1+size>>3+3, size-1
+	for s, n := range norm {
+		for i := 0; i < int(n); i++ {
+			symbolAt[pos] = uint8(s)
+			pos = (pos + step) & mask
+			for pos > high {
+				pos = (pos + step) & mask
+			}
+		}
+	}
+
+	t := &fseCTable{
+		tableLog: tableLog,
+		states:   make([]uint16, size),
+		symbols:  make([]fseSymbol, len(norm)),
+	}
+	next := append([]int(nil), cumul[:len(norm)]...)
+	for u := 0; u < size; u++ {
+		s := symbolAt[u]
+		t.states[next[s]] = uint16(size + u)
+		next[s]++
+	}
+
+	total := 0
+	for s, n := range norm {
+		switch n {
+		case 0:
+			t.symbols[s].deltaNbBits = uint32(tableLog+1)<<16 - uint32(size)
+		case -1, 1:
+			t.symbols[s] = fseSymbol{uint32(tableLog)<<16 - uint32(size), int32(total - 1)}
+			total++
+		default:
+			maxBitsOut := uint32(tableLog) - uint32(bits.Len16(uint16(n-1))-1)
+			minStatePlus := uint32(n) << maxBitsOut
+			t.symbols[s] = fseSymbol{maxBitsOut<<16 - minStatePlus, int32(total - int(n))}
+			total += int(n)
+		}
+	}
+	return t
+}
+
+// init returns the state for the first symbol encoded (the last one
+// decoded), which costs no bits.
+func (t *fseCTable) init(sym uint8) uint32 {
+	tt := t.symbols[sym]
+	nbBitsOut := (tt.deltaNbBits + 1<<15) >> 16
+	value := nbBitsOut<<16 - tt.deltaNbBits
+	return uint32(t.states[int32(value>>nbBitsOut)+tt.deltaFindState])
+}
+
+// encode writes the bits moving from state to sym's state.
+func (t *fseCTable) encode(bw *bitWriter, state uint32, sym uint8) uint32 {
+	tt := t.symbols[sym]
+	nbBitsOut := (state + tt.deltaNbBits) >> 16
+	bw.add(state, uint8(nbBitsOut))
+	return uint32(t.states[int32(state>>nbBitsOut)+tt.deltaFindState])
+}
+
+// flush writes the final state, which decoders read first.
+func (t *fseCTable) flush(bw *bitWriter, state uint32) {
+	bw.add(state, t.tableLog)
+}
+
+// bitWriter appends bits least significant first.
+type bitWriter struct {
+	out []byte
+	acc uint64
+	n   uint8
+}
+
+func (b *bitWriter) add(v uint32, n uint8) {
+	b.acc |= uint64(v) & (1<<n - 1) << b.n
+	b.n += n
+	for b.n >= 8 {
+		b.out = append(b.out, byte(b.acc))
+		b.acc >>= 8
+		b.n -= 8
+	}
+}
+
+// close ends the stream with a 1 bit, which marks where decoders start.
+func (b *bitWriter) close() []byte {
+	b.add(1, 1)
+	if b.n > 0 {
+		b.out = append(b.out, byte(b.acc))
+	}
+	return b.out
+}
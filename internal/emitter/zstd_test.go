@@ -0,0 +1,291 @@
+package emitter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// fseDTable is an FSE decoding table, built as RFC 8878 describes
+// (independently of the encoder's tables).
+type fseDTable struct {
+	tableLog uint8
+	cells    []fseCell
+}
+
+type fseCell struct {
+	symbol uint8
+	nbBits uint8
+	base   int
+}
+
+func newFSEDTable(norm []int16, tableLog uint8) *fseDTable {
+	size := 1 << tableLog
+	cells := make([]fseCell, size)
+	high := size - 1
+	for s, n := range norm {
+		if n == -1 {
+			cells[high].symbol = uint8(s)
+			high--
+		}
+	}
+	pos, step := 0, size>>1+size>>3+3
+	for s, n := range norm {
+		for i := 0; i < int(n); i++ {
+			cells[pos].symbol = uint8(s)
+			pos = (pos + step) % size
+			for pos > high {
+				pos = (pos + step) % size
+			}
+		}
+	}
+	next := make([]int, len(norm))
+	for s, n := range norm {
+		next[s] = int(n)
+		if n == -1 {
+			next[s] = 1
+		}
+	}
+	for u := range cells {
+		x := next[cells[u].symbol]
+		next[cells[u].symbol]++
+		nb := int(tableLog) - (bits.Len(uint(x)) - 1)
+		cells[u].nbBits = uint8(nb)
+		cells[u].base = x<<nb - size
+	}
+	return &fseDTable{tableLog: tableLog, cells: cells}
+}
+
+// backwardBits reads a zstd bitstream from its end.
+type backwardBits struct {
+	data []byte
+	pos  int // bits left
+}
+
+func newBackwardBits(data []byte) (*backwardBits, error) {
+	if len(data) == 0 || data[len(data)-1] == 0 {
+		return nil, errors.New("missing end mark")
+	}
+	return &backwardBits{data: data, pos: (len(data)-1)*8 + bits.Len8(data[len(data)-1]) - 1}, nil
+}
+
+func (b *backwardBits) read(n uint8) (int, error) {
+	if int(n) > b.pos {
+		return 0, errors.New("bitstream overrun")
+	}
+	b.pos -= int(n)
+	v := 0
+	for i := 0; i < int(n); i++ {
+		bit := b.pos + i
+		v |= int(b.data[bit/8]>>(bit%8)&1) << i
+	}
+	return v, nil
+}
+
+// zstdDecode decodes the subset of zstd the writer produces: one frame
+// of raw or compressed blocks with raw literals and predefined tables.
+func zstdDecode(data []byte) ([]byte, error) {
+	if len(data) < 6 || binary.LittleEndian.Uint32(data) != zstdMagic {
+		return nil, errors.New("bad magic")
+	}
+	if data[4] != 0 {
+		return nil, fmt.Errorf("unexpected frame header descriptor %#x", data[4])
+	}
+	data = data[6:]
+
+	llT := newFSEDTable(zstdLLNorm, 6)
+	mlT := newFSEDTable(zstdMLNorm, 6)
+	ofT := newFSEDTable(zstdOFNorm, 5)
+	var out []byte
+	for {
+		if len(data) < 3 {
+			return nil, errors.New("truncated block header")
+		}
+		header := int(data[0]) | int(data[1])<<8 | int(data[2])<<16
+		last, typ, size := header&1 == 1, header>>1&3, header>>3
+		data = data[3:]
+		if size > len(data) || size > zstdBlockSize {
+			return nil, errors.New("bad block size")
+		}
+		block := data[:size]
+		data = data[size:]
+
+		switch typ {
+		case zstdBlockRaw:
+			out = append(out, block...)
+		case zstdBlockCompressed:
+			var err error
+			if out, err = zstdDecodeBlock(out, block, llT, mlT, ofT); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unexpected block type %d", typ)
+		}
+		if last {
+			if len(data) != 0 {
+				return nil, errors.New("data after last block")
+			}
+			return out, nil
+		}
+	}
+}
+
+func zstdDecodeBlock(out, block []byte, llT, mlT, ofT *fseDTable) ([]byte, error) {
+	// Raw literals section.
+	var n, hdr int
+	switch block[0] >> 2 & 3 {
+	case 0, 2:
+		n, hdr = int(block[0]>>3), 1
+	case 1:
+		n, hdr = int(block[0]>>4)|int(block[1])<<4, 2
+	case 3:
+		n, hdr = int(block[0]>>4)|int(block[1])<<4|int(block[2])<<12, 3
+	}
+	if block[0]&3 != 0 || hdr+n > len(block) {
+		return nil, errors.New("bad literals section")
+	}
+	lits := block[hdr : hdr+n]
+	block = block[hdr+n:]
+
+	nseq := int(block[0])
+	switch {
+	case nseq < 128:
+		block = block[1:]
+	case nseq < 255:
+		nseq = (nseq-128)<<8 | int(block[1])
+		block = block[2:]
+	default:
+		nseq = int(block[1]) | int(block[2])<<8 + 0x7F00
+		block = block[3:]
+	}
+	if block[0] != 0 {
+		return nil, errors.New("expected predefined modes")
+	}
+	br, err := newBackwardBits(block[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	read := func(n uint8) int {
+		v, rerr := br.read(n)
+		if rerr != nil {
+			err = rerr
+		}
+		return v
+	}
+	llState, ofState, mlState := read(6), read(5), read(6)
+	for i := 0; i < nseq; i++ {
+		ofCode := ofT.cells[ofState].symbol
+		mlCode := mlT.cells[mlState].symbol
+		llCode := llT.cells[llState].symbol
+		offValue := 1<<ofCode + read(ofCode)
+		ml := int(zstdMLBase[mlCode]) + read(zstdMLBits[mlCode])
+		ll := int(zstdLLBase[llCode]) + read(zstdLLBits[llCode])
+		if offValue <= 3 {
+			return nil, errors.New("unexpected repeat offset")
+		}
+		if ll > len(lits) {
+			return nil, errors.New("literal length overrun")
+		}
+		out = append(out, lits[:ll]...)
+		lits = lits[ll:]
+		from := len(out) - (offValue - 3)
+		if from < 0 {
+			return nil, errors.New("offset before start")
+		}
+		for j := 0; j < ml; j++ {
+			out = append(out, out[from+j])
+		}
+		if i < nseq-1 {
+			c := llT.cells[llState]
+			llState = c.base + read(c.nbBits)
+			c = mlT.cells[mlState]
+			mlState = c.base + read(c.nbBits)
+			c = ofT.cells[ofState]
+			ofState = c.base + read(c.nbBits)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if br.pos != 0 {
+		return nil, fmt.Errorf("%d bits left in bitstream", br.pos)
+	}
+	return append(out, lits...), nil
+}
+
+func TestZstdNormSums(t *testing.T) {
+	for name, tt := range map[string]struct {
+		norm []int16
+		log  uint8
+	}{"literals": {zstdLLNorm, 6}, "matches": {zstdMLNorm, 6}, "offsets": {zstdOFNorm, 5}} {
+		sum := 0
+		for _, n := range tt.norm {
+			if n < 0 {
+				n = 1
+			}
+			sum += int(n)
+		}
+		if sum != 1<<tt.log {
+			t.Errorf("%s distribution sums to %d, want %d", name, sum, 1<<tt.log)
+		}
+	}
+}
+
+func TestZstdWriter(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 200000)
+	rng.Read(random)
+	var logs strings.Builder
+	for i := 0; logs.Len() < 400000; i++ {
+		fmt.Fprintf(&logs, `{"level":"info","msg":"request %d handled","status":%d}`+"\n", rng.Intn(1000), 200+i%3*100)
+	}
+
+	tests := []struct {
+		name     string
+		input    []byte
+		maxRatio float64 // compressed size / input size
+	}{
+		{name: "empty", input: nil},
+		{name: "short", input: []byte("hello")},
+		{name: "overlapping match", input: bytes.Repeat([]byte("a"), 1000), maxRatio: 0.05},
+		{name: "random", input: random, maxRatio: 1.01},
+		{name: "logs", input: []byte(logs.String()), maxRatio: 0.4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			z := newZstdWriter(&buf)
+			// Odd-sized writes exercise block boundaries.
+			for rest := tt.input; len(rest) > 0; {
+				n := min(len(rest), 7777)
+				if _, err := z.Write(rest[:n]); err != nil {
+					t.Fatalf("Write() error: %v", err)
+				}
+				rest = rest[n:]
+			}
+			if err := z.Close(); err != nil {
+				t.Fatalf("Close() error: %v", err)
+			}
+
+			got, err := zstdDecode(buf.Bytes())
+			if err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+			if !bytes.Equal(got, tt.input) {
+				t.Fatalf("round trip mismatch: got %d bytes, want %d", len(got), len(tt.input))
+			}
+			if tt.maxRatio > 0 {
+				if ratio := float64(buf.Len()) / float64(len(tt.input)); ratio > tt.maxRatio {
+					t.Errorf("compression ratio %.2f, want at most %.2f", ratio, tt.maxRatio)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,388 @@
+// Package expr implements a small boolean expression language for
+// selecting log entries by their parsed fields.
+//
+// Example:
+//
+//	status >= 500 && method == "POST"
+//	level =~ "(?i)err" || !(user == null)
+//
+// Supported operators, in increasing precedence: ||, &&, ! and the
+// comparisons ==, !=, <, <=, >, >=, =~ (regex match), !~ (regex non-match).
+// Operands are field names (dotted paths reach into nested objects),
+// numbers, quoted strings, true, false and null.
+package expr
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Expr is a compiled expression, safe for concurrent use.
+type Expr struct {
+	src  string
+	root node
+}
+
+// Compile parses an expression. Regular expressions used with =~ and !~
+// are compiled here, so evaluation never fails.
+func Compile(src string) (*Expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+	}
+
+	return &Expr{src: src, root: root}, nil
+}
+
+// String returns the source text of the expression.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Match evaluates the expression against a field map and reports
+// whether it is truthy.
+func (e *Expr) Match(fields map[string]any) bool {
+	return truthy(e.root.eval(fields))
+}
+
+// Eval evaluates the expression and returns its raw value.
+func (e *Expr) Eval(fields map[string]any) any {
+	return e.root.eval(fields)
+}
+
+// Lookup returns the value of a field by name. An exact key match wins;
+// otherwise a dotted name is resolved as a path into nested objects.
+func Lookup(fields map[string]any, name string) (any, bool) {
+	if v, ok := fields[name]; ok {
+		return v, true
+	}
+	if !strings.Contains(name, ".") {
+		return nil, false
+	}
+
+	var cur any = fields
+	for _, part := range strings.Split(name, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// node is an expression tree element.
+type node interface {
+	eval(fields map[string]any) any
+}
+
+type literalNode struct{ val any }
+
+func (n literalNode) eval(map[string]any) any { return n.val }
+
+type fieldNode struct{ name string }
+
+func (n fieldNode) eval(fields map[string]any) any {
+	v, _ := Lookup(fields, n.name)
+	return v
+}
+
+type notNode struct{ x node }
+
+func (n notNode) eval(fields map[string]any) any { return !truthy(n.x.eval(fields)) }
+
+type andNode struct{ l, r node }
+
+func (n andNode) eval(fields map[string]any) any {
+	return truthy(n.l.eval(fields)) && truthy(n.r.eval(fields))
+}
+
+type orNode struct{ l, r node }
+
+func (n orNode) eval(fields map[string]any) any {
+	return truthy(n.l.eval(fields)) || truthy(n.r.eval(fields))
+}
+
+type compareNode struct {
+	op   string
+	l, r node
+	re   *regexp.Regexp // for =~ and !~
+}
+
+func (n compareNode) eval(fields map[string]any) any {
+	lv := n.l.eval(fields)
+
+	if n.re != nil {
+		if lv == nil {
+			return n.op == "!~"
+		}
+		return n.re.MatchString(toString(lv)) == (n.op == "=~")
+	}
+
+	rv := n.r.eval(fields)
+	switch n.op {
+	case "==":
+		return equal(lv, rv)
+	case "!=":
+		return !equal(lv, rv)
+	}
+
+	c, ok := compare(lv, rv)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// exprParser is a recursive-descent parser over the token stream.
+type exprParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *exprParser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOp && p.peek().text == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOp && p.peek().text == "&&" {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (node, error) {
+	if tok := p.peek(); tok.kind == tokOp && tok.text == "!" {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (node, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	if tok.kind != tokOp {
+		return left, nil
+	}
+	switch tok.text {
+	case "==", "!=", "<", "<=", ">", ">=", "=~", "!~":
+	default:
+		return left, nil
+	}
+	p.next()
+
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	cmp := compareNode{op: tok.text, l: left, r: right}
+	if tok.text == "=~" || tok.text == "!~" {
+		lit, ok := right.(literalNode)
+		pattern, isString := lit.val.(string)
+		if !ok || !isString {
+			return nil, fmt.Errorf("operator %s at position %d requires a string pattern", tok.text, tok.pos)
+		}
+		if cmp.re, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid regex at position %d: %w", tok.pos, err)
+		}
+	}
+	return cmp, nil
+}
+
+func (p *exprParser) parsePrimary() (node, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokRParen {
+			return nil, fmt.Errorf("missing ) for ( at position %d", tok.pos)
+		}
+		return inner, nil
+
+	case tokNumber:
+		if i, err := strconv.ParseInt(tok.text, 10, 64); err == nil {
+			return literalNode{i}, nil
+		}
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", tok.text, tok.pos)
+		}
+		return literalNode{f}, nil
+
+	case tokString:
+		return literalNode{tok.text}, nil
+
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return literalNode{true}, nil
+		case "false":
+			return literalNode{false}, nil
+		case "null", "nil":
+			return literalNode{nil}, nil
+		}
+		return fieldNode{tok.text}, nil
+
+	case tokEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+}
+
+// truthy reports whether a value counts as true in a boolean context:
+// missing, false, zero and empty values are false.
+func truthy(v any) bool {
+	switch x := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return x
+	case string:
+		return x != ""
+	}
+	if f, ok := toNumber(v); ok {
+		return f != 0
+	}
+	return true
+}
+
+// equal compares two values, numerically when both look like numbers.
+func equal(a, b any) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if fa, ok := toNumber(a); ok {
+		if fb, ok := toNumber(b); ok {
+			return fa == fb
+		}
+	}
+	if ba, ok := a.(bool); ok {
+		bb, ok := b.(bool)
+		return ok && ba == bb
+	}
+	return toString(a) == toString(b)
+}
+
+// compare orders two values: numerically if both are numbers,
+// lexically if both are strings. ok is false if they are not comparable.
+func compare(a, b any) (result int, ok bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	if fa, ok := toNumber(a); ok {
+		if fb, ok := toNumber(b); ok {
+			switch {
+			case fa < fb:
+				return -1, true
+			case fa > fb:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	sa, okA := a.(string)
+	sb, okB := b.(string)
+	if !okA || !okB {
+		return 0, false
+	}
+	return strings.Compare(sa, sb), true
+}
+
+// toNumber converts numeric values (and numeric strings) to float64.
+func toNumber(v any) (float64, bool) {
+	switch x := v.(type) {
+	case int:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case float64:
+		return x, true
+	case json.Number:
+		f, err := x.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(x, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// toString renders a value for string comparison and regex matching.
+func toString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
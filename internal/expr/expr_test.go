@@ -0,0 +1,121 @@
+package expr
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCompile_Errors(t *testing.T) {
+	tests := []string{
+		``,
+		`status >=`,
+		`(status == 1`,
+		`status == 1)`,
+		`a b`,
+		`msg =~ 5`,
+		`msg =~ "(unclosed"`,
+		`&& a`,
+	}
+
+	for _, src := range tests {
+		t.Run(src, func(t *testing.T) {
+			if _, err := Compile(src); err == nil {
+				t.Errorf("Compile(%q) expected error, got nil", src)
+			}
+		})
+	}
+}
+
+func TestExpr_Match(t *testing.T) {
+	fields := map[string]any{
+		"status":  int(503),
+		"size":    int64(1024),
+		"latency": 0.25,
+		"method":  "POST",
+		"level":   "ERROR",
+		"code":    "042",
+		"debug":   false,
+		"empty":   "",
+		"count":   json.Number("7"),
+		"_host":   map[string]any{"os": "linux"},
+	}
+
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{`status >= 500`, true},
+		{`status >= 500 && method == "POST"`, true},
+		{`status >= 500 && method == "GET"`, false},
+		{`status < 500 || method == "POST"`, true},
+		{`!(status < 500)`, true},
+		{`size == 1024`, true},
+		{`size != 1024`, false},
+		{`latency > 0.1`, true},
+		{`latency <= 0.25`, true},
+		{`count == 7`, true},
+		{`code == 42`, true},
+		{`code == "042"`, true},
+		{`level == "ERROR"`, true},
+		{`level =~ "(?i)^err"`, true},
+		{`level !~ "WARN"`, true},
+		{`method > "GET"`, true},
+		{`missing == null`, true},
+		{`missing != null`, false},
+		{`missing > 1`, false},
+		{`missing =~ "x"`, false},
+		{`missing !~ "x"`, true},
+		{`status`, true},
+		{`debug`, false},
+		{`!debug`, true},
+		{`empty`, false},
+		{`debug == false`, true},
+		{`_host.os == "linux"`, true},
+		{`method > 5`, false},
+		{`true && !false`, true},
+		{`status >= 500 && (method == "GET" || level == "ERROR")`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			e, err := Compile(tt.src)
+			if err != nil {
+				t.Fatalf("Compile(%q) error: %v", tt.src, err)
+			}
+			if got := e.Match(fields); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpr_String(t *testing.T) {
+	src := `a == 1`
+	e, err := Compile(src)
+	if err != nil {
+		t.Fatalf("Compile error: %v", err)
+	}
+	if e.String() != src {
+		t.Errorf("String() = %q, want %q", e.String(), src)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	fields := map[string]any{
+		"a.b": "flat",
+		"x":   map[string]any{"y": map[string]any{"z": 1}},
+	}
+
+	if v, ok := Lookup(fields, "a.b"); !ok || v != "flat" {
+		t.Errorf("Lookup(a.b) = %v, %v; want flat (exact key wins)", v, ok)
+	}
+	if v, ok := Lookup(fields, "x.y.z"); !ok || v != 1 {
+		t.Errorf("Lookup(x.y.z) = %v, %v; want 1", v, ok)
+	}
+	if _, ok := Lookup(fields, "x.q"); ok {
+		t.Error("Lookup(x.q) should not be found")
+	}
+	if _, ok := Lookup(fields, "nope"); ok {
+		t.Error("Lookup(nope) should not be found")
+	}
+}
@@ -0,0 +1,47 @@
+package expr
+
+import "testing"
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    []string
+		wantErr bool
+	}{
+		{name: "comparison", src: `status >= 500`, want: []string{"status", ">=", "500"}},
+		{name: "no spaces", src: `a==1&&b!=2`, want: []string{"a", "==", "1", "&&", "b", "!=", "2"}},
+		{name: "double-quoted string", src: `method == "POST"`, want: []string{"method", "==", "POST"}},
+		{name: "single-quoted string", src: `msg == 'a b'`, want: []string{"msg", "==", "a b"}},
+		{name: "escaped quote", src: `msg == "say \"hi\""`, want: []string{"msg", "==", `say "hi"`}},
+		{name: "negative number", src: `x > -1.5`, want: []string{"x", ">", "-1.5"}},
+		{name: "dotted ident", src: `_host.os == "linux"`, want: []string{"_host.os", "==", "linux"}},
+		{name: "parens and not", src: `!(a)`, want: []string{"!", "(", "a", ")"}},
+		{name: "regex op", src: `msg =~ "err"`, want: []string{"msg", "=~", "err"}},
+		{name: "unterminated string", src: `msg == "oops`, wantErr: true},
+		{name: "bad character", src: `a # b`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := lex(tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("lex(%q) error = %v, wantErr %v", tt.src, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			// Drop trailing EOF token
+			tokens = tokens[:len(tokens)-1]
+			if len(tokens) != len(tt.want) {
+				t.Fatalf("lex(%q) returned %d tokens, want %d: %v", tt.src, len(tokens), len(tt.want), tokens)
+			}
+			for i, tok := range tokens {
+				if tok.text != tt.want[i] {
+					t.Errorf("token[%d] = %q, want %q", i, tok.text, tt.want[i])
+				}
+			}
+		})
+	}
+}
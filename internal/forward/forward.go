@@ -0,0 +1,302 @@
+// Package forward implements the Fluentd forward protocol, which Fluentd
+// and Fluent Bit use to ship events between agents: msgpack messages over
+// TCP carrying a tag and one or more timestamped records, acknowledged by
+// the receiver when the sender asks for it.
+package forward
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event is a Fluentd event: a tag, a time and a record.
+type Event struct {
+	Tag    string
+	Time   time.Time
+	Record map[string]any
+}
+
+// Handler receives the events of one forward message. A message the
+// sender wants acknowledged is acknowledged once Handler returns nil; an
+// error closes the connection without the acknowledgement, so the sender
+// retries.
+type Handler func(events []Event) error
+
+// Option configures Serve.
+type Option func(*server)
+
+// WithReadCounter counts the bytes read from all connections into n.
+func WithReadCounter(n *atomic.Int64) Option {
+	return func(s *server) {
+		s.read = n
+	}
+}
+
+// WithErrorLog reports connections closed on a protocol error to logf.
+func WithErrorLog(logf func(format string, args ...any)) Option {
+	return func(s *server) {
+		s.logf = logf
+	}
+}
+
+type server struct {
+	handle Handler
+	read   *atomic.Int64
+	logf   func(format string, args ...any)
+
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+}
+
+// Serve accepts forward connections on l and passes their events to
+// handle until ctx is done, then closes l and the connections and waits
+// for their handlers to return. Handlers for different connections run
+// concurrently.
+func Serve(ctx context.Context, l net.Listener, handle Handler, opts ...Option) error {
+	s := &server{handle: handle, conns: make(map[net.Conn]bool)}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	var wg sync.WaitGroup
+	stop := context.AfterFunc(ctx, func() {
+		_ = l.Close()
+		s.mu.Lock()
+		for conn := range s.conns {
+			_ = conn.Close()
+		}
+		s.mu.Unlock()
+	})
+	defer stop()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			wg.Wait()
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		s.mu.Lock()
+		if ctx.Err() != nil {
+			s.mu.Unlock()
+			_ = conn.Close()
+			continue
+		}
+		s.conns[conn] = true
+		s.mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.serveConn(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			_ = conn.Close()
+			if err != nil && ctx.Err() == nil && s.logf != nil {
+				s.logf("forward connection from %s: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// serveConn reads messages from conn until it closes.
+func (s *server) serveConn(conn net.Conn) error {
+	var r io.Reader = conn
+	if s.read != nil {
+		r = countingReader{r: conn, n: s.read}
+	}
+	d := &decoder{r: bufio.NewReader(r)}
+	for {
+		v, err := d.value()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		events, chunk, err := decodeMessage(v)
+		if err != nil {
+			return err
+		}
+		if err := s.handle(events); err != nil {
+			return err
+		}
+		if chunk != "" {
+			ack := AppendValue(nil, map[string]any{"ack": chunk})
+			if _, err := conn.Write(ack); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// decodeMessage decodes a forward message in any of its modes:
+//
+//	Message:       [tag, time, record, option]
+//	Forward:       [tag, [[time, record], ...], option]
+//	PackedForward: [tag, msgpack stream of [time, record], option]
+//
+// The last may be gzipped ("compressed": "gzip" in the option). The option
+// map is optional; its "chunk" is the id the acknowledgement must echo.
+func decodeMessage(v any) ([]Event, string, error) {
+	msg, ok := v.([]any)
+	if !ok || len(msg) < 2 || len(msg) > 4 {
+		return nil, "", errors.New("forward message is not an array of 2 to 4 items")
+	}
+	tag, ok := msg[0].(string)
+	if !ok {
+		return nil, "", errors.New("forward message tag is not a string")
+	}
+
+	var events []Event
+	var optionValue any
+	switch entries := msg[1].(type) {
+	case []any: // Forward
+		for _, e := range entries {
+			event, err := decodeEntry(tag, e)
+			if err != nil {
+				return nil, "", err
+			}
+			events = append(events, event)
+		}
+		if len(msg) > 2 {
+			optionValue = msg[2]
+		}
+	case string: // PackedForward, or CompressedPackedForward
+		if len(msg) > 2 {
+			optionValue = msg[2]
+		}
+		option, _ := optionValue.(map[string]any)
+		var r io.Reader = bytes.NewReader([]byte(entries))
+		if option["compressed"] == "gzip" {
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, "", fmt.Errorf("compressed forward entries: %w", err)
+			}
+			r = gz
+		}
+		d := &decoder{r: bufio.NewReader(r)}
+		for {
+			e, err := d.value()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, "", fmt.Errorf("packed forward entries: %w", err)
+			}
+			event, err := decodeEntry(tag, e)
+			if err != nil {
+				return nil, "", err
+			}
+			events = append(events, event)
+		}
+	default: // Message
+		if len(msg) < 3 {
+			return nil, "", errors.New("forward message has no record")
+		}
+		event, err := decodeEntry(tag, []any{msg[1], msg[2]})
+		if err != nil {
+			return nil, "", err
+		}
+		events = append(events, event)
+		if len(msg) > 3 {
+			optionValue = msg[3]
+		}
+	}
+
+	option, _ := optionValue.(map[string]any)
+	chunk, _ := option["chunk"].(string)
+	return events, chunk, nil
+}
+
+// decodeEntry decodes a [time, record] pair.
+func decodeEntry(tag string, v any) (Event, error) {
+	pair, ok := v.([]any)
+	if !ok || len(pair) != 2 {
+		return Event{}, errors.New("forward entry is not a [time, record] pair")
+	}
+	t, err := eventTime(pair[0])
+	if err != nil {
+		return Event{}, err
+	}
+	record, ok := pair[1].(map[string]any)
+	if !ok {
+		return Event{}, errors.New("forward record is not a map")
+	}
+	return Event{Tag: tag, Time: t, Record: record}, nil
+}
+
+// eventTime converts an event time: an EventTime, or Unix seconds as an
+// integer or float.
+func eventTime(v any) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case int64:
+		return time.Unix(t, 0).UTC(), nil
+	case uint64:
+		return time.Unix(int64(min(t, math.MaxInt64)), 0).UTC(), nil
+	case float64:
+		sec, frac := math.Modf(t)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("forward event time is a %T", v)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// AppendEntry appends an event's [time, record] pair, the unit a
+// PackedForward message carries.
+func AppendEntry(b []byte, t time.Time, record map[string]any) []byte {
+	b = append(b, 0x92) // fixarray of 2
+	b = AppendValue(b, t)
+	return AppendValue(b, record)
+}
+
+// AppendPackedForward appends a PackedForward message carrying count
+// entries encoded by AppendEntry. A non-empty chunk asks the receiver to
+// acknowledge the message with it.
+func AppendPackedForward(b []byte, tag string, entries []byte, count int, chunk string) []byte {
+	option := map[string]any{"size": count}
+	if chunk != "" {
+		option["chunk"] = chunk
+	}
+	return AppendValue(b, []any{tag, entries, option})
+}
+
+// ReadAck reads a receiver's acknowledgement and returns its chunk id.
+func ReadAck(r *bufio.Reader) (string, error) {
+	v, err := (&decoder{r: r}).value()
+	if err != nil {
+		return "", unexpected(err)
+	}
+	m, _ := v.(map[string]any)
+	ack, ok := m["ack"].(string)
+	if !ok {
+		return "", errors.New("forward acknowledgement has no ack id")
+	}
+	return ack, nil
+}
@@ -0,0 +1,302 @@
+package forward
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	t1 = time.Unix(1700000000, 500000000).UTC()
+	t2 = time.Unix(1700000001, 0).UTC()
+)
+
+func gzipped(t *testing.T, b []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeMessage(t *testing.T) {
+	packed := AppendValue(nil, []any{t1, map[string]any{"log": "a"}})
+	packed = AppendValue(packed, []any{t2, map[string]any{"log": "b"}})
+	two := []Event{
+		{Tag: "app", Time: t1, Record: map[string]any{"log": "a"}},
+		{Tag: "app", Time: t2, Record: map[string]any{"log": "b"}},
+	}
+
+	tests := []struct {
+		name      string
+		msg       any
+		want      []Event
+		wantChunk string
+	}{
+		{
+			name: "message",
+			msg:  []any{"app", t1, map[string]any{"log": "a"}},
+			want: two[:1],
+		},
+		{
+			name:      "message with option",
+			msg:       []any{"app", t1, map[string]any{"log": "a"}, map[string]any{"chunk": "c1"}},
+			want:      two[:1],
+			wantChunk: "c1",
+		},
+		{
+			name: "message with integer time",
+			msg:  []any{"app", 1700000001, map[string]any{"log": "b"}},
+			want: two[1:],
+		},
+		{
+			name: "message with float time",
+			msg:  []any{"app", 1700000000.5, map[string]any{"log": "a"}},
+			want: two[:1],
+		},
+		{
+			name: "forward",
+			msg: []any{"app", []any{
+				[]any{t1, map[string]any{"log": "a"}},
+				[]any{t2, map[string]any{"log": "b"}},
+			}, map[string]any{"chunk": "c2"}},
+			want:      two,
+			wantChunk: "c2",
+		},
+		{
+			name: "packed forward",
+			msg:  []any{"app", string(packed)},
+			want: two,
+		},
+		{
+			name:      "packed forward as bin",
+			msg:       []any{"app", packed, map[string]any{"chunk": "c3"}},
+			want:      two,
+			wantChunk: "c3",
+		},
+		{
+			name: "compressed packed forward",
+			msg:  []any{"app", gzipped(t, packed), map[string]any{"compressed": "gzip", "size": 2}},
+			want: two,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := decode(AppendValue(nil, tt.msg))
+			if err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+			events, chunk, err := decodeMessage(v)
+			if err != nil {
+				t.Fatalf("decodeMessage() error: %v", err)
+			}
+			if !reflect.DeepEqual(events, tt.want) {
+				t.Errorf("events = %+v, want %+v", events, tt.want)
+			}
+			if chunk != tt.wantChunk {
+				t.Errorf("chunk = %q, want %q", chunk, tt.wantChunk)
+			}
+		})
+	}
+}
+
+func TestDecodeMessage_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  any
+		want string
+	}{
+		{"not an array", map[string]any{"tag": "app"}, "not an array"},
+		{"too short", []any{"app"}, "not an array"},
+		{"tag not a string", []any{1, t1, map[string]any{}}, "tag is not a string"},
+		{"no record", []any{"app", t1}, "has no record"},
+		{"record not a map", []any{"app", t1, "text"}, "record is not a map"},
+		{"bad time", []any{"app", true, map[string]any{}}, "event time is a bool"},
+		{"bad entry", []any{"app", []any{[]any{t1}}}, "not a [time, record] pair"},
+		{"bad packed entries", []any{"app", string([]byte{0x92, 0xc1})}, "packed forward entries"},
+		{"bad gzip", []any{"app", "not gzip", map[string]any{"compressed": "gzip"}}, "compressed forward entries"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := decode(AppendValue(nil, tt.msg))
+			if err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+			_, _, err = decodeMessage(v)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("decodeMessage() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// serve runs Serve on a local listener and returns its address and a
+// function stopping it.
+func serve(t *testing.T, handle Handler, opts ...Option) (string, func() error) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Serve(ctx, l, handle, opts...) }()
+	return l.Addr().String(), func() error {
+		cancel()
+		return <-done
+	}
+}
+
+func TestServe_Ack(t *testing.T) {
+	var mu sync.Mutex
+	var got []Event
+	var read atomic.Int64
+	addr, stop := serve(t, func(events []Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, events...)
+		return nil
+	}, WithReadCounter(&read))
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	msg := AppendValue(nil, []any{"app", t1, map[string]any{"log": "a"}, map[string]any{"chunk": "abc"}})
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	ack, err := (&decoder{r: bufio.NewReader(conn)}).value()
+	if err != nil {
+		t.Fatalf("reading ack: %v", err)
+	}
+	if want := map[string]any{"ack": "abc"}; !reflect.DeepEqual(ack, want) {
+		t.Errorf("ack = %v, want %v", ack, want)
+	}
+
+	if err := stop(); err != nil {
+		t.Errorf("Serve() = %v, want nil", err)
+	}
+	want := []Event{{Tag: "app", Time: t1, Record: map[string]any{"log": "a"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %+v, want %+v", got, want)
+	}
+	if n := read.Load(); n != int64(len(msg)) {
+		t.Errorf("read counter = %d, want %d", n, len(msg))
+	}
+}
+
+func TestServe_HandlerErrorWithholdsAck(t *testing.T) {
+	addr, stop := serve(t, func(events []Event) error {
+		return errors.New("pipeline stopped")
+	})
+	defer func() { _ = stop() }()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	msg := AppendValue(nil, []any{"app", t1, map[string]any{"log": "a"}, map[string]any{"chunk": "abc"}})
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var buf [16]byte
+	if n, err := conn.Read(buf[:]); err == nil {
+		t.Errorf("read %x, want the connection closed without an ack", buf[:n])
+	}
+}
+
+func TestServe_ProtocolErrorLogged(t *testing.T) {
+	logged := make(chan string, 1)
+	addr, stop := serve(t, func(events []Event) error { return nil },
+		WithErrorLog(func(format string, args ...any) {
+			logged <- format
+		}))
+	defer func() { _ = stop() }()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(AppendValue(nil, "not a message")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-logged:
+	case <-time.After(5 * time.Second):
+		t.Fatal("protocol error not logged")
+	}
+}
+
+func TestAppendPackedForward(t *testing.T) {
+	entries := AppendEntry(nil, t1, map[string]any{"log": "a"})
+	entries = AppendEntry(entries, t2, map[string]any{"log": "b"})
+	v, err := decode(AppendPackedForward(nil, "app", entries, 2, "c1"))
+	if err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	events, chunk, err := decodeMessage(v)
+	if err != nil {
+		t.Fatalf("decodeMessage() error: %v", err)
+	}
+	want := []Event{
+		{Tag: "app", Time: t1, Record: map[string]any{"log": "a"}},
+		{Tag: "app", Time: t2, Record: map[string]any{"log": "b"}},
+	}
+	if !reflect.DeepEqual(events, want) || chunk != "c1" {
+		t.Errorf("got %+v, chunk %q; want %+v, chunk c1", events, chunk, want)
+	}
+}
+
+func TestReadAck(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      []byte
+		want    string
+		wantErr string
+	}{
+		{"ack", AppendValue(nil, map[string]any{"ack": "c1"}), "c1", ""},
+		{"no ack id", AppendValue(nil, map[string]any{"other": "c1"}), "", "no ack id"},
+		{"not a map", AppendValue(nil, "c1"), "", "no ack id"},
+		{"closed", nil, "", "unexpected EOF"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadAck(bufio.NewReader(bytes.NewReader(tt.in)))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ReadAck() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ReadAck() = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
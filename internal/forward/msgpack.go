@@ -0,0 +1,334 @@
+package forward
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// maxObjectSize bounds a single msgpack string, binary or extension value,
+// and maxObjectCount the items of an array or map, so a corrupt or hostile
+// stream cannot make the decoder allocate without limit.
+const (
+	maxObjectSize  = 64 << 20
+	maxObjectCount = 1 << 20
+)
+
+// eventTimeExt is the msgpack extension type of a Fluentd EventTime:
+// seconds and nanoseconds as big-endian uint32s.
+const eventTimeExt = 0
+
+// Ext is a msgpack extension value other than EventTime.
+type Ext struct {
+	Type int8
+	Data []byte
+}
+
+// decoder reads msgpack values. Integers decode to int64 (uint64 above
+// its range), floats to float64, strings and binary to string, arrays to
+// []any, maps to map[string]any and EventTime to time.Time.
+type decoder struct {
+	r *bufio.Reader
+}
+
+func (d *decoder) value() (any, error) {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xf0 == 0x80:
+		return d.mapOf(int(b & 0x0f))
+	case b&0xf0 == 0x90:
+		return d.array(int(b & 0x0f))
+	case b&0xe0 == 0xa0:
+		return d.str(int(b & 0x1f))
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xd9:
+		n, err := d.uint(1)
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+	case 0xc5, 0xda:
+		n, err := d.uint(2)
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+	case 0xc6, 0xdb:
+		n, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uint(1 << (b - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(int(n))
+	case 0xca:
+		n, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(uint32(n))), nil
+	case 0xcb:
+		n, err := d.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(n), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := d.uint(1 << (b - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (b - 0xd0)
+		n, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		// Sign-extend from the encoded width
+		shift := 64 - 8*size
+		return int64(n<<shift) >> shift, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1 << (b - 0xd4))
+	case 0xdc:
+		n, err := d.uint(2)
+		if err != nil {
+			return nil, err
+		}
+		return d.array(int(n))
+	case 0xdd:
+		n, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return d.array(int(n))
+	case 0xde:
+		n, err := d.uint(2)
+		if err != nil {
+			return nil, err
+		}
+		return d.mapOf(int(n))
+	case 0xdf:
+		n, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return d.mapOf(int(n))
+	}
+	return nil, fmt.Errorf("invalid msgpack type byte 0x%02x", b)
+}
+
+// uint reads a big-endian unsigned integer of size bytes.
+func (d *decoder) uint(size int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(d.r, buf[8-size:]); err != nil {
+		return 0, unexpected(err)
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+func (d *decoder) bytes(n int) ([]byte, error) {
+	if n > maxObjectSize {
+		return nil, fmt.Errorf("msgpack value of %d bytes exceeds %d", n, maxObjectSize)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		return nil, unexpected(err)
+	}
+	return buf, nil
+}
+
+func (d *decoder) str(n int) (any, error) {
+	b, err := d.bytes(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *decoder) ext(n int) (any, error) {
+	typ, err := d.r.ReadByte()
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	data, err := d.bytes(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(typ) == eventTimeExt && n == 8 {
+		sec := binary.BigEndian.Uint32(data[:4])
+		nsec := binary.BigEndian.Uint32(data[4:])
+		return time.Unix(int64(sec), int64(nsec)).UTC(), nil
+	}
+	return Ext{Type: int8(typ), Data: data}, nil
+}
+
+func (d *decoder) array(n int) (any, error) {
+	if n > maxObjectCount {
+		return nil, fmt.Errorf("msgpack array of %d items exceeds %d", n, maxObjectCount)
+	}
+	arr := make([]any, 0, min(n, 1024))
+	for i := 0; i < n; i++ {
+		v, err := d.value()
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		arr = append(arr, v)
+	}
+	return arr, nil
+}
+
+func (d *decoder) mapOf(n int) (any, error) {
+	if n > maxObjectCount {
+		return nil, fmt.Errorf("msgpack map of %d items exceeds %d", n, maxObjectCount)
+	}
+	m := make(map[string]any, min(n, 1024))
+	for i := 0; i < n; i++ {
+		k, err := d.value()
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		v, err := d.value()
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		key, ok := k.(string)
+		if !ok {
+			key = fmt.Sprint(k)
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+// unexpected turns an EOF inside a value into io.ErrUnexpectedEOF.
+func unexpected(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// AppendValue appends v to b in msgpack. It encodes nil, bools, integers,
+// floats, strings, []byte, []any, map[string]any (keys sorted, so the
+// encoding is deterministic), time.Time as an EventTime and Ext; other
+// values are written as their fmt.Sprint text.
+func AppendValue(b []byte, v any) []byte {
+	switch x := v.(type) {
+	case nil:
+		return append(b, 0xc0)
+	case bool:
+		if x {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+	case int:
+		return appendInt(b, int64(x))
+	case int64:
+		return appendInt(b, x)
+	case int32:
+		return appendInt(b, int64(x))
+	case uint64:
+		if x > math.MaxInt64 {
+			return binary.BigEndian.AppendUint64(append(b, 0xcf), x)
+		}
+		return appendInt(b, int64(x))
+	case float64:
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(x))
+	case float32:
+		return binary.BigEndian.AppendUint32(append(b, 0xca), math.Float32bits(x))
+	case string:
+		return append(appendLen(b, len(x), 0xa0, 0x1f, 0xd9, 0xda, 0xdb), x...)
+	case []byte:
+		return append(appendLen(b, len(x), 0, -1, 0xc4, 0xc5, 0xc6), x...)
+	case []any:
+		b = appendLen(b, len(x), 0x90, 0x0f, 0, 0xdc, 0xdd)
+		for _, item := range x {
+			b = AppendValue(b, item)
+		}
+		return b
+	case []string:
+		b = appendLen(b, len(x), 0x90, 0x0f, 0, 0xdc, 0xdd)
+		for _, item := range x {
+			b = AppendValue(b, item)
+		}
+		return b
+	case map[string]any:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b = appendLen(b, len(x), 0x80, 0x0f, 0, 0xde, 0xdf)
+		for _, k := range keys {
+			b = AppendValue(b, k)
+			b = AppendValue(b, x[k])
+		}
+		return b
+	case time.Time:
+		b = append(b, 0xd7, eventTimeExt)
+		b = binary.BigEndian.AppendUint32(b, uint32(x.Unix()))
+		return binary.BigEndian.AppendUint32(b, uint32(x.Nanosecond()))
+	case Ext:
+		b = appendLen(b, len(x.Data), 0, -1, 0xc7, 0xc8, 0xc9)
+		return append(append(b, byte(x.Type)), x.Data...)
+	}
+	return AppendValue(b, fmt.Sprint(v))
+}
+
+func appendInt(b []byte, n int64) []byte {
+	switch {
+	case n >= 0 && n <= 0x7f, n < 0 && n >= -32:
+		return append(b, byte(n))
+	case n >= math.MinInt8 && n <= math.MaxInt8:
+		return append(b, 0xd0, byte(n))
+	case n >= math.MinInt16 && n <= math.MaxInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(n))
+	case n >= math.MinInt32 && n <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(n))
+}
+
+// appendLen writes the header of a string, binary, array, map or
+// extension of n bytes or items: the fix form, fix|n, when n is at most
+// fixMax, else the 8-, 16- or 32-bit form. A type without a fix form
+// passes -1 for fixMax, and one without an 8-bit form 0 for t8.
+func appendLen(b []byte, n int, fix byte, fixMax int, t8, t16, t32 byte) []byte {
+	switch {
+	case n <= fixMax:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint8 && t8 != 0:
+		return append(b, t8, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, t16), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, t32), uint32(n))
+}
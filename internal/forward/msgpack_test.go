@@ -0,0 +1,111 @@
+package forward
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func decode(b []byte) (any, error) {
+	d := &decoder{r: bufio.NewReader(bytes.NewReader(b))}
+	return d.value()
+}
+
+func TestAppendValue_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		in   any
+		want any
+	}{
+		{"nil", nil, nil},
+		{"true", true, true},
+		{"false", false, false},
+		{"positive fixint", 7, int64(7)},
+		{"negative fixint", -5, int64(-5)},
+		{"int8", -100, int64(-100)},
+		{"int16", 30000, int64(30000)},
+		{"int32", -2000000, int64(-2000000)},
+		{"int64", int64(1) << 40, int64(1) << 40},
+		{"uint64", uint64(math.MaxUint64), uint64(math.MaxUint64)},
+		{"float64", 1.5, 1.5},
+		{"float32", float32(0.25), 0.25},
+		{"fixstr", "hello", "hello"},
+		{"str8", strings.Repeat("a", 200), strings.Repeat("a", 200)},
+		{"str16", strings.Repeat("b", 70000), strings.Repeat("b", 70000)},
+		{"empty string", "", ""},
+		{"bin", []byte("raw"), "raw"},
+		{"empty bin", []byte{}, ""},
+		{"array", []any{1, "two", nil}, []any{int64(1), "two", nil}},
+		{"string array", []string{"a", "b"}, []any{"a", "b"}},
+		{"map", map[string]any{"a": 1, "b": map[string]any{"c": true}}, map[string]any{"a": int64(1), "b": map[string]any{"c": true}}},
+		{"event time", time.Unix(1700000000, 123456789).UTC(), time.Unix(1700000000, 123456789).UTC()},
+		{"ext", Ext{Type: 5, Data: []byte{1, 2, 3}}, Ext{Type: 5, Data: []byte{1, 2, 3}}},
+		{"empty ext", Ext{Type: 5, Data: []byte{}}, Ext{Type: 5, Data: []byte{}}},
+		{"other", time.Second, "1s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decode(AppendValue(nil, tt.in))
+			if err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendValue_SortsMapKeys(t *testing.T) {
+	m := map[string]any{"b": 2, "a": 1, "c": 3}
+	first := AppendValue(nil, m)
+	for i := 0; i < 10; i++ {
+		if got := AppendValue(nil, m); !bytes.Equal(got, first) {
+			t.Fatalf("encoding differs between calls: %x vs %x", got, first)
+		}
+	}
+	want := []byte{0x83, 0xa1, 'a', 1, 0xa1, 'b', 2, 0xa1, 'c', 3}
+	if !bytes.Equal(first, want) {
+		t.Errorf("AppendValue() = %x, want %x", first, want)
+	}
+}
+
+func TestDecoder_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want string
+	}{
+		{"invalid type", []byte{0xc1}, "invalid msgpack type byte 0xc1"},
+		{"truncated string", []byte{0xa5, 'h', 'i'}, io.ErrUnexpectedEOF.Error()},
+		{"truncated array", []byte{0x92, 1}, io.ErrUnexpectedEOF.Error()},
+		{"truncated length", []byte{0xda, 0x01}, io.ErrUnexpectedEOF.Error()},
+		{"oversized string", []byte{0xdb, 0xff, 0xff, 0xff, 0xff}, "exceeds"},
+		{"oversized map", []byte{0xdf, 0xff, 0xff, 0xff, 0xff}, "exceeds"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decode(tt.in)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("decode() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecoder_NonStringKeys(t *testing.T) {
+	got, err := decode([]byte{0x81, 0x01, 0xa1, 'x'})
+	if err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if want := map[string]any{"1": "x"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
@@ -0,0 +1,87 @@
+// Package kubelog reads the container logs the kubelet keeps on a node:
+// the lines of the CRI logging format the container runtime writes, and
+// the names of the links to them in /var/log/containers, which identify
+// the pod, namespace and container.
+package kubelog
+
+import (
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Record is one line of a CRI container log.
+type Record struct {
+	Time    time.Time
+	Stream  string // "stdout" or "stderr"
+	Partial bool   // the message continues in the next record of the stream
+	Message string
+}
+
+// ParseRecord parses a line of the CRI logging format,
+//
+//	2024-01-15T10:30:45.123456789Z stdout F message
+//
+// whose third field holds tags separated by colons, the first of them P
+// for a partial line or F for a full one. It reports false for a line
+// that is not in the format.
+func ParseRecord(line string) (Record, bool) {
+	ts, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		return Record{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return Record{}, false
+	}
+	stream, rest, ok := strings.Cut(rest, " ")
+	if !ok || stream != "stdout" && stream != "stderr" {
+		return Record{}, false
+	}
+	// The message may be empty, and its separator with it
+	tags, msg, _ := strings.Cut(rest, " ")
+	tag, _, _ := strings.Cut(tags, ":")
+	if tag != "P" && tag != "F" {
+		return Record{}, false
+	}
+	return Record{Time: t, Stream: stream, Partial: tag == "P", Message: msg}, true
+}
+
+// Meta identifies the container a log file is for.
+type Meta struct {
+	Pod         string
+	Namespace   string
+	Container   string
+	ContainerID string
+}
+
+// ParseFileName parses the name of a link in /var/log/containers,
+//
+//	<pod>_<namespace>_<container>-<container id>.log
+//
+// where the container id is 64 hex digits. Neither the pod, the namespace
+// nor the container can hold an underscore, as Kubernetes names them. It
+// reports false for a name not of that form; any directory is ignored.
+func ParseFileName(name string) (Meta, bool) {
+	base, ok := strings.CutSuffix(filepath.Base(name), ".log")
+	if !ok {
+		return Meta{}, false
+	}
+	parts := strings.Split(base, "_")
+	if len(parts) != 3 {
+		return Meta{}, false
+	}
+	i := strings.LastIndexByte(parts[2], '-')
+	if i < 0 {
+		return Meta{}, false
+	}
+	container, id := parts[2][:i], parts[2][i+1:]
+	if parts[0] == "" || parts[1] == "" || container == "" || len(id) != 64 {
+		return Meta{}, false
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return Meta{}, false
+	}
+	return Meta{Pod: parts[0], Namespace: parts[1], Container: container, ContainerID: id}, true
+}
@@ -0,0 +1,97 @@
+package kubelog
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRecord(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   string
+		want   Record
+		wantOK bool
+	}{
+		{
+			name:   "full line",
+			line:   "2024-01-15T10:30:45.123456789Z stdout F GET /health 200",
+			want:   Record{Time: time.Date(2024, 1, 15, 10, 30, 45, 123456789, time.UTC), Stream: "stdout", Message: "GET /health 200"},
+			wantOK: true,
+		},
+		{
+			name:   "partial line",
+			line:   "2024-01-15T10:30:45Z stderr P part one ",
+			want:   Record{Time: time.Date(2024, 1, 15, 10, 30, 45, 0, time.UTC), Stream: "stderr", Partial: true, Message: "part one "},
+			wantOK: true,
+		},
+		{
+			name:   "more tags",
+			line:   "2024-01-15T10:30:45+02:00 stdout F:x:y {\"level\":\"info\"}",
+			want:   Record{Time: time.Date(2024, 1, 15, 8, 30, 45, 0, time.UTC), Stream: "stdout", Message: `{"level":"info"}`},
+			wantOK: true,
+		},
+		{
+			name:   "empty message",
+			line:   "2024-01-15T10:30:45Z stdout F",
+			want:   Record{Time: time.Date(2024, 1, 15, 10, 30, 45, 0, time.UTC), Stream: "stdout"},
+			wantOK: true,
+		},
+		{name: "docker json", line: `{"log":"hello\n","stream":"stdout","time":"2024-01-15T10:30:45Z"}`},
+		{name: "bad time", line: "yesterday stdout F hello"},
+		{name: "bad stream", line: "2024-01-15T10:30:45Z stdin F hello"},
+		{name: "bad tag", line: "2024-01-15T10:30:45Z stdout X hello"},
+		{name: "no tag", line: "2024-01-15T10:30:45Z stdout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseRecord(tt.line)
+			if ok != tt.wantOK {
+				t.Fatalf("ParseRecord() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if !got.Time.Equal(tt.want.Time) || got.Stream != tt.want.Stream || got.Partial != tt.want.Partial || got.Message != tt.want.Message {
+				t.Errorf("ParseRecord() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFileName(t *testing.T) {
+	id := strings.Repeat("0123456789abcdef", 4)
+	tests := []struct {
+		name   string
+		file   string
+		want   Meta
+		wantOK bool
+	}{
+		{
+			name:   "link",
+			file:   "/var/log/containers/web-7d4b9c-x2x4z_shop_nginx-" + id + ".log",
+			want:   Meta{Pod: "web-7d4b9c-x2x4z", Namespace: "shop", Container: "nginx", ContainerID: id},
+			wantOK: true,
+		},
+		{
+			name:   "dashes in the container",
+			file:   "coredns-5d78c9869d-abcde_kube-system_coredns-sidecar-" + id + ".log",
+			want:   Meta{Pod: "coredns-5d78c9869d-abcde", Namespace: "kube-system", Container: "coredns-sidecar", ContainerID: id},
+			wantOK: true,
+		},
+		{name: "not a log", file: "web_shop_nginx-" + id + ".txt"},
+		{name: "short id", file: "web_shop_nginx-abc123.log"},
+		{name: "id not hex", file: "web_shop_nginx-" + strings.Repeat("z", 64) + ".log"},
+		{name: "no namespace", file: "web_nginx-" + id + ".log"},
+		{name: "no container", file: "web_shop_-" + id + ".log"},
+		{name: "rotated", file: "0.log.20240115-103045"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseFileName(tt.file)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("ParseFileName() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
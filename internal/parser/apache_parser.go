@@ -1,30 +1,97 @@
 package parser
 
 import (
+	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 )
 
 // ApacheParser handles Apache/Nginx Combined Log Format.
 // Example: 192.168.1.1 - user [15/Jan/2024:10:30:45 +0000] "GET /page HTTP/1.1" 200 1234 "http://ref.com" "Mozilla/5.0"
 type ApacheParser struct {
+	// pattern, if set, matches lines in place of scanApache
 	pattern *regexp.Regexp
+	variant ApacheVariant
+	regex   bool
+}
+
+// ApacheVariant selects the access log format an ApacheParser reads.
+type ApacheVariant string
+
+// Apache access log formats.
+const (
+	// ApacheCombined is the Combined Log Format; the referer and user
+	// agent are optional, so Common Log Format lines parse too.
+	ApacheCombined ApacheVariant = "combined"
+
+	// ApacheCommon is the Common Log Format, without referer and user
+	// agent.
+	ApacheCommon ApacheVariant = "common"
+
+	// ApacheVHostCombined is the Combined Log Format preceded by the
+	// virtual host and port (vhost_combined in Debian's apache2.conf).
+	ApacheVHostCombined ApacheVariant = "vhost_combined"
+)
+
+// ParseApacheVariant converts a variant name.
+func ParseApacheVariant(s string) (ApacheVariant, error) {
+	switch v := ApacheVariant(strings.ToLower(s)); v {
+	case ApacheCombined, ApacheCommon, ApacheVHostCombined:
+		return v, nil
+	}
+	return "", fmt.Errorf("unknown apache format %q (want combined, common or vhost_combined)", s)
+}
+
+// ApacheOption configures an ApacheParser.
+type ApacheOption func(*ApacheParser)
+
+// WithApacheVariant sets the log format (default ApacheCombined).
+func WithApacheVariant(v ApacheVariant) ApacheOption {
+	return func(p *ApacheParser) {
+		p.variant = v
+	}
+}
+
+// WithApacheRegex matches lines with the regular expression the
+// hand-written scanner replaced, which finds the same fields more slowly;
+// it is kept to check the scanner against.
+func WithApacheRegex() ApacheOption {
+	return func(p *ApacheParser) {
+		p.regex = true
+	}
 }
 
 // NewApacheParser creates a new Apache combined log format parser.
-func NewApacheParser() *ApacheParser {
-	// Combined Log Format pattern
-	pattern := regexp.MustCompile(
-		`^(?P<ip>\S+)\s+` + // IP address
-			`(?P<ident>\S+)\s+` + // Ident (usually -)
-			`(?P<user>\S+)\s+` + // User (usually -)
-			`\[(?P<timestamp>[^\]]+)\]\s+` + // Timestamp in brackets
-			`"(?P<method>\S+)\s+(?P<path>\S+)\s+(?P<protocol>[^"]+)"\s+` + // Request line
-			`(?P<status>\d+)\s+` + // Status code
-			`(?P<size>\S+)` + // Response size (or -)
-			`(?:\s+"(?P<referer>[^"]*)"\s+"(?P<useragent>[^"]*)")?`, // Optional referer and user agent
-	)
-	return &ApacheParser{pattern: pattern}
+func NewApacheParser(opts ...ApacheOption) *ApacheParser {
+	p := &ApacheParser{variant: ApacheCombined}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if !p.regex {
+		return p
+	}
+
+	// Common Log Format pattern
+	common := `(?P<ip>\S+)\s+` + // IP address
+		`(?P<ident>\S+)\s+` + // Ident (usually -)
+		`(?P<user>\S+)\s+` + // User (usually -)
+		`\[(?P<timestamp>[^\]]+)\]\s+` + // Timestamp in brackets
+		`"(?P<method>\S+)\s+(?P<path>\S+)\s+(?P<protocol>[^"]+)"\s+` + // Request line
+		`(?P<status>\d+)\s+` + // Status code
+		`(?P<size>\S+)` // Response size (or -)
+	combined := `(?:\s+"(?P<referer>[^"]*)"\s+"(?P<useragent>[^"]*)")` // Referer and user agent
+
+	switch p.variant {
+	case ApacheCommon:
+		p.pattern = regexp.MustCompile(`^` + common + `\s*$`)
+	case ApacheVHostCombined:
+		p.pattern = regexp.MustCompile(`^(?P<vhost>[^\s:]+)(?::(?P<port>\d+))?\s+` + common + combined)
+	default:
+		p.pattern = regexp.MustCompile(`^` + common + combined + `?`)
+	}
+	return p
 }
 
 // Name returns the parser identifier.
@@ -34,19 +101,50 @@ func (p *ApacheParser) Name() string {
 
 // Description returns a human-readable description.
 func (p *ApacheParser) Description() string {
+	switch p.variant {
+	case ApacheCommon:
+		return "Apache/Nginx Common Log Format"
+	case ApacheVHostCombined:
+		return "Apache Combined Log Format with virtual host"
+	}
 	return "Apache/Nginx Combined Log Format"
 }
 
 // CanParse checks if the line matches Apache log format.
 // Quick check: contains timestamp in brackets and quoted request.
 func (p *ApacheParser) CanParse(line string) bool {
-	return p.pattern.MatchString(line)
+	if p.pattern != nil {
+		return p.pattern.MatchString(line)
+	}
+	_, ok := scanApache(line, p.variant)
+	return ok
 }
 
 // Parse extracts fields from an Apache log line.
 func (p *ApacheParser) Parse(line string) (*Entry, error) {
+	return p.ParseFields(line, nil)
+}
+
+// ParseFields is like Parse, converting and storing only the wanted
+// fields.
+func (p *ApacheParser) ParseFields(line string, wanted map[string]bool) (*Entry, error) {
 	entry := NewEntry(line)
 
+	if p.pattern == nil {
+		fields, ok := scanApache(line, p.variant)
+		if !ok {
+			entry.ParseError = ErrNoMatch
+			entry.Fields["raw"] = line
+			return entry, nil
+		}
+		for i, value := range fields {
+			if wants(wanted, apacheFieldNames[i]) {
+				setApacheField(entry, apacheFieldNames[i], value)
+			}
+		}
+		return entry, nil
+	}
+
 	matches := p.pattern.FindStringSubmatch(line)
 	if matches == nil {
 		entry.ParseError = ErrNoMatch
@@ -56,28 +154,199 @@ func (p *ApacheParser) Parse(line string) (*Entry, error) {
 
 	names := p.pattern.SubexpNames()
 	for i, match := range matches {
-		if i == 0 || names[i] == "" || match == "" || match == "-" {
-			continue
+		if i > 0 && names[i] != "" && wants(wanted, names[i]) {
+			setApacheField(entry, names[i], match)
 		}
+	}
 
-		name := names[i]
+	return entry, nil
+}
 
-		// Convert numeric fields
-		switch name {
-		case "status":
-			if status, err := strconv.Atoi(match); err == nil {
-				entry.Fields[name] = status
-				continue
-			}
-		case "size":
-			if size, err := strconv.ParseInt(match, 10, 64); err == nil {
-				entry.Fields[name] = size
-				continue
+// setApacheField stores a field found in a line, unless it is empty or -.
+func setApacheField(entry *Entry, name, value string) {
+	if value == "" || value == "-" {
+		return
+	}
+
+	// Convert numeric fields
+	switch name {
+	case "status", "port":
+		if status, err := strconv.Atoi(value); err == nil {
+			entry.Fields[name] = status
+			return
+		}
+	case "size":
+		if size, err := strconv.ParseInt(value, 10, 64); err == nil {
+			entry.Fields[name] = size
+			return
+		}
+	case "vhost", "ident", "user", "method", "protocol":
+		// Few and repeated from line to line
+		entry.Fields[name] = internValue(value)
+		return
+	}
+
+	entry.Fields[name] = value
+}
+
+// apacheFieldNames names the fields scanApache returns, in order.
+var apacheFieldNames = [...]string{
+	"vhost", "port", "ip", "ident", "user", "timestamp", "method", "path",
+	"protocol", "status", "size", "referer", "useragent",
+}
+
+// Indexes of the fields scanApache returns.
+const (
+	apacheVHost = iota
+	apachePort
+	apacheIP
+	apacheIdent
+	apacheUser
+	apacheTimestamp
+	apacheMethod
+	apachePath
+	apacheProtocol
+	apacheStatus
+	apacheSize
+	apacheReferer
+	apacheUserAgent
+)
+
+// scanApache splits a line as the variant's pattern matches it, reporting
+// whether it does. Fields the line lacks are empty.
+func scanApache(line string, variant ApacheVariant) (fields [len(apacheFieldNames)]string, ok bool) {
+	var i int
+	if variant == ApacheVHostCombined {
+		for i < len(line) && !isSpaceByte(line[i]) && line[i] != ':' {
+			i++
+		}
+		if i == 0 {
+			return fields, false
+		}
+		fields[apacheVHost] = line[:i]
+		if i < len(line) && line[i] == ':' {
+			end := skipDigits(line, i+1)
+			if end == i+1 {
+				return fields, false
 			}
+			fields[apachePort] = line[i+1 : end]
+			i = end
+		}
+		next := skipSpace(line, i)
+		if next == i {
+			return fields, false
 		}
+		i = next
+	}
 
-		entry.Fields[name] = match
+	// word takes a run of non-space bytes ending at a space (\S+\s+)
+	word := func(field int) bool {
+		end := skipNonSpace(line, i)
+		next := skipSpace(line, end)
+		if end == i || next == end {
+			return false
+		}
+		fields[field] = line[i:end]
+		i = next
+		return true
+	}
+	// quoted takes the text up to the next quote, which it must find
+	quoted := func(field int) bool {
+		n := strings.IndexByte(line[i:], '"')
+		if n < 0 {
+			return false
+		}
+		fields[field] = line[i : i+n]
+		i += n + 1
+		return true
 	}
 
-	return entry, nil
+	if !word(apacheIP) || !word(apacheIdent) || !word(apacheUser) {
+		return fields, false
+	}
+
+	// [timestamp]
+	if i == len(line) || line[i] != '[' {
+		return fields, false
+	}
+	n := strings.IndexByte(line[i+1:], ']')
+	if n <= 0 {
+		return fields, false
+	}
+	fields[apacheTimestamp] = line[i+1 : i+1+n]
+	end := i + n + 2
+	if i = skipSpace(line, end); i == end {
+		return fields, false
+	}
+
+	// "method path protocol"
+	if i == len(line) || line[i] != '"' {
+		return fields, false
+	}
+	i++
+	if !word(apacheMethod) {
+		return fields, false
+	}
+	end = skipNonSpace(line, i)
+	if end == i {
+		return fields, false
+	}
+	fields[apachePath] = line[i:end]
+	if i = skipSpace(line, end); i == end {
+		return fields, false
+	}
+	spaces := i - end
+	if !quoted(apacheProtocol) {
+		return fields, false
+	}
+	if fields[apacheProtocol] == "" {
+		// The protocol is not empty: with nothing else before the quote,
+		// the pattern takes the last of two or more spaces
+		if spaces < 2 {
+			return fields, false
+		}
+		fields[apacheProtocol] = line[i-2 : i-1]
+	}
+
+	// status size
+	if end = skipSpace(line, i); end == i {
+		return fields, false
+	}
+	i = end
+	end = skipDigits(line, i)
+	if end == i || end == len(line) || !isSpaceByte(line[end]) {
+		return fields, false
+	}
+	fields[apacheStatus] = line[i:end]
+	i = skipSpace(line, end)
+	end = skipNonSpace(line, i)
+	if end == i {
+		return fields, false
+	}
+	fields[apacheSize] = line[i:end]
+	i = end
+
+	if variant == ApacheCommon {
+		return fields, skipSpace(line, i) == len(line)
+	}
+
+	// "referer" "user agent", required for vhost_combined
+	combined := func() bool {
+		for _, field := range [...]int{apacheReferer, apacheUserAgent} {
+			next := skipSpace(line, i)
+			if next == i || next == len(line) || line[next] != '"' {
+				return false
+			}
+			i = next + 1
+			if !quoted(field) {
+				return false
+			}
+		}
+		return true
+	}
+	if !combined() {
+		fields[apacheReferer], fields[apacheUserAgent] = "", ""
+		return fields, variant != ApacheVHostCombined
+	}
+	return fields, true
 }
@@ -141,3 +141,69 @@ func TestApacheParser_Parse(t *testing.T) {
 		})
 	}
 }
+
+func TestApacheParser_Variants(t *testing.T) {
+	common := `10.0.0.1 - - [15/Jan/2024:10:30:45 +0000] "GET / HTTP/1.1" 200 512`
+	combined := common + ` "-" "curl/8.0"`
+	vhost := `example.com:443 ` + combined
+
+	tests := []struct {
+		variant ApacheVariant
+		line    string
+		want    map[string]any // nil if the line must not match
+	}{
+		{variant: ApacheCombined, line: combined, want: map[string]any{"ip": "10.0.0.1", "useragent": "curl/8.0"}},
+		{variant: ApacheCombined, line: common, want: map[string]any{"ip": "10.0.0.1", "status": 200}},
+		{variant: ApacheCommon, line: common, want: map[string]any{"ip": "10.0.0.1", "size": int64(512)}},
+		{variant: ApacheCommon, line: combined},
+		{variant: ApacheVHostCombined, line: vhost, want: map[string]any{"vhost": "example.com", "port": 443, "ip": "10.0.0.1", "useragent": "curl/8.0"}},
+		{variant: ApacheVHostCombined, line: combined},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.variant), func(t *testing.T) {
+			p := NewApacheParser(WithApacheVariant(tt.variant))
+			entry, err := p.Parse(tt.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == nil {
+				if entry.ParseError == nil {
+					t.Errorf("Parse(%q): expected ParseError, got %v", tt.line, entry.Fields)
+				}
+				return
+			}
+			for k, v := range tt.want {
+				if entry.Fields[k] != v {
+					t.Errorf("Parse(%q): %s = %v (%T), want %v", tt.line, k, entry.Fields[k], entry.Fields[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestParseApacheVariant(t *testing.T) {
+	if v, err := ParseApacheVariant("VHOST_COMBINED"); err != nil || v != ApacheVHostCombined {
+		t.Errorf("ParseApacheVariant(VHOST_COMBINED) = %q, %v", v, err)
+	}
+	if _, err := ParseApacheVariant("extended"); err == nil {
+		t.Error("ParseApacheVariant(extended): expected error")
+	}
+}
+
+func TestApacheParser_ScannerMatchesRegex(t *testing.T) {
+	lines := mutations([]string{
+		`192.168.1.1 - user [15/Jan/2024:10:30:45 +0000] "GET /page HTTP/1.1" 200 1234 "http://ref.com" "Mozilla/5.0"`,
+		`10.0.0.1 - - [15/Jan/2024:10:30:45 +0000] "POST /api HTTP/2" 201 - "-" "curl/8"`,
+		`10.0.0.1 - - [15/Jan/2024:10:30:45 +0000] "GET / HTTP/1.0" 304 0`,
+		`10.0.0.1 - - [15/Jan/2024:10:30:45 +0000] "GET /  " 400 0  `,
+		`example.com:443 10.0.0.1 - - [15/Jan/2024:10:30:45 +0000] "GET / HTTP/1.1" 200 5 "" "ua"`,
+		`example.com 10.0.0.1 - - [ts] "GET / HTTP/1.1" 200 5 "r" "ua" trailing`,
+	}, " \t\n\"[]:-0123456789x", 5000)
+
+	for _, variant := range []ApacheVariant{ApacheCombined, ApacheCommon, ApacheVHostCombined} {
+		t.Run(string(variant), func(t *testing.T) {
+			sameParse(t, NewApacheParser(WithApacheVariant(variant)), NewApacheParser(WithApacheVariant(variant), WithApacheRegex()), lines)
+		})
+	}
+}
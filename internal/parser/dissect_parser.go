@@ -0,0 +1,166 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DissectParser splits lines on the literal text between field references,
+// which is faster and easier to write than a regex for delimited formats.
+// Example pattern: %{date} %{time} [%{level}] %{pid}#%{tid}: %{message}
+//
+// A reference is %{name}; %{?name} or %{} skips the text, %{+name}
+// appends it to an earlier field (space-separated), and a -> suffix, as
+// in %{name->}, skips repeats of the following delimiter (padding).
+type DissectParser struct {
+	patternText string
+	prefix      string
+	keys        []dissectKey
+	inference   TypeInference
+}
+
+// dissectKey is one field reference and the literal text after it.
+type dissectKey struct {
+	name   string
+	skip   bool
+	append bool
+	padded bool
+	delim  string
+}
+
+// NewDissectParser creates a parser from a dissect pattern.
+// Returns error if the pattern has no fields or two adjacent references.
+func NewDissectParser(patternText string) (*DissectParser, error) {
+	p := &DissectParser{patternText: patternText}
+
+	rest := patternText
+	start := strings.Index(rest, "%{")
+	if start < 0 {
+		return nil, fmt.Errorf("dissect pattern must have at least one %%{field}")
+	}
+	p.prefix, rest = rest[:start], rest[start:]
+	named := false
+	for rest != "" {
+		end := strings.IndexByte(rest, '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated field reference in %q", patternText)
+		}
+		key := dissectKey{name: rest[2:end]}
+		rest = rest[end+1:]
+
+		if name, ok := strings.CutSuffix(key.name, "->"); ok {
+			key.name, key.padded = name, true
+		}
+		switch {
+		case key.name == "":
+			key.skip = true
+		case key.name[0] == '?':
+			key.name, key.skip = key.name[1:], true
+		case key.name[0] == '+':
+			key.name, key.append = key.name[1:], true
+		}
+		if !key.skip {
+			if key.name == "" {
+				return nil, fmt.Errorf("empty field name in %q", patternText)
+			}
+			named = true
+		}
+
+		next := strings.Index(rest, "%{")
+		if next < 0 {
+			next = len(rest)
+		}
+		key.delim, rest = rest[:next], rest[next:]
+		if key.delim == "" && rest != "" {
+			return nil, fmt.Errorf("field references need a delimiter between them in %q", patternText)
+		}
+		p.keys = append(p.keys, key)
+	}
+	if !named {
+		return nil, fmt.Errorf("dissect pattern must have at least one named field")
+	}
+	return p, nil
+}
+
+// Name returns the parser identifier.
+func (p *DissectParser) Name() string {
+	return "dissect"
+}
+
+// Description returns a human-readable description.
+func (p *DissectParser) Description() string {
+	return fmt.Sprintf("Dissect pattern: %s", p.patternText)
+}
+
+// SetTypeInference configures which values are converted from strings.
+func (p *DissectParser) SetTypeInference(ti TypeInference) {
+	p.inference = ti
+}
+
+// CanParse checks if the line splits on the pattern's delimiters.
+func (p *DissectParser) CanParse(line string) bool {
+	return p.dissect(line) != nil
+}
+
+// Parse extracts the referenced fields from the log line.
+func (p *DissectParser) Parse(line string) (*Entry, error) {
+	return p.ParseFields(line, nil)
+}
+
+// ParseFields is like Parse, converting and storing only the wanted
+// fields.
+func (p *DissectParser) ParseFields(line string, wanted map[string]bool) (*Entry, error) {
+	entry := NewEntry(line)
+
+	values := p.dissect(line)
+	if values == nil {
+		entry.ParseError = ErrNoMatch
+		entry.Fields["raw"] = line
+		return entry, nil
+	}
+
+	for k, v := range values {
+		if wants(wanted, k) {
+			entry.Fields[k] = p.inference.value(k, v)
+		}
+	}
+	return entry, nil
+}
+
+// dissect splits line into field values, or returns nil if the line does
+// not fit the pattern.
+func (p *DissectParser) dissect(line string) map[string]string {
+	rest, ok := strings.CutPrefix(line, p.prefix)
+	if !ok {
+		return nil
+	}
+
+	values := make(map[string]string, len(p.keys))
+	for _, key := range p.keys {
+		var value string
+		if key.delim == "" {
+			value, rest = rest, ""
+		} else {
+			i := strings.Index(rest, key.delim)
+			if i < 0 {
+				return nil
+			}
+			value, rest = rest[:i], rest[i+len(key.delim):]
+			for key.padded && strings.HasPrefix(rest, key.delim) {
+				rest = rest[len(key.delim):]
+			}
+		}
+
+		switch {
+		case key.skip:
+		case key.append && values[key.name] != "":
+			values[key.name] += " " + value
+		default:
+			values[key.name] = value
+		}
+	}
+	if rest != "" {
+		return nil
+	}
+	return values
+}
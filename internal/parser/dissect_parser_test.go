@@ -0,0 +1,95 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewDissectParser_Errors(t *testing.T) {
+	tests := []string{
+		"no fields",
+		"%{a}%{b}",
+		"%{a",
+		"%{?a} %{}",
+		"%{+}",
+	}
+
+	for _, pattern := range tests {
+		t.Run(pattern, func(t *testing.T) {
+			if _, err := NewDissectParser(pattern); err == nil {
+				t.Errorf("NewDissectParser(%q) expected error, got nil", pattern)
+			}
+		})
+	}
+}
+
+func TestDissectParser_Parse(t *testing.T) {
+	tests := []struct {
+		name       string
+		pattern    string
+		line       string
+		wantFields map[string]any // nil if the line must not match
+	}{
+		{
+			name:    "nginx error",
+			pattern: "%{date} %{time} [%{level}] %{pid}#%{tid}: %{message}",
+			line:    "2024/01/15 10:30:45 [error] 1234#0: open() failed: No such file",
+			wantFields: map[string]any{
+				"date": "2024/01/15", "time": "10:30:45", "level": "error",
+				"pid": int64(1234), "tid": int64(0), "message": "open() failed: No such file",
+			},
+		},
+		{
+			name:       "prefix and skip",
+			pattern:    "<%{?pri}>%{host} %{}: %{msg}",
+			line:       "<13>web1 ignored: hello",
+			wantFields: map[string]any{"host": "web1", "msg": "hello"},
+		},
+		{
+			name:       "append",
+			pattern:    "%{ts} %{+ts} %{msg}",
+			line:       "2024-01-15 10:30:45 started",
+			wantFields: map[string]any{"ts": "2024-01-15 10:30:45", "msg": "started"},
+		},
+		{
+			name:       "padding",
+			pattern:    "%{level->} %{msg}",
+			line:       "INFO    ready",
+			wantFields: map[string]any{"level": "INFO", "msg": "ready"},
+		},
+		{
+			name:       "trailing literal",
+			pattern:    "[%{level}]",
+			line:       "[warn]",
+			wantFields: map[string]any{"level": "warn"},
+		},
+		{name: "missing delimiter", pattern: "%{a} [%{b}]", line: "x y"},
+		{name: "wrong prefix", pattern: "<%{a}>", line: "a>"},
+		{name: "text after trailing literal", pattern: "[%{level}]", line: "[warn] extra"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewDissectParser(tt.pattern)
+			if err != nil {
+				t.Fatalf("NewDissectParser(%q) error: %v", tt.pattern, err)
+			}
+			if got := p.CanParse(tt.line); got != (tt.wantFields != nil) {
+				t.Errorf("CanParse(%q) = %v", tt.line, got)
+			}
+			entry, err := p.Parse(tt.line)
+			if err != nil {
+				t.Fatalf("Parse(%q) error: %v", tt.line, err)
+			}
+			if tt.wantFields == nil {
+				if entry.ParseError == nil {
+					t.Errorf("Parse(%q): expected ParseError, got fields %v", tt.line, entry.Fields)
+				}
+				return
+			}
+			if !reflect.DeepEqual(entry.Fields, tt.wantFields) {
+				t.Errorf("Parse(%q) fields = %v, want %v", tt.line, entry.Fields, tt.wantFields)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// ExecParser delegates parsing to a child process, so parsers can be
+// written in any language. Each line is written to the process's stdin,
+// newline-terminated, and the process answers with one line on stdout:
+// a JSON object of the line's fields, or null (or an empty line) if the
+// line is not in its format. The process must flush after every answer.
+type ExecParser struct {
+	name    string
+	command []string
+
+	// mu serializes the request/response exchanges with the process.
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+
+	// err is set once the process cannot be talked to; later lines fail
+	// with it instead of blocking.
+	err error
+}
+
+// NewExecParser starts command (a program and its arguments) and returns
+// a parser named name that talks to it. The process's stderr goes to
+// stderr. Returns error if the command cannot be started.
+func NewExecParser(name string, command []string, stderr io.Writer) (*ExecParser, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+
+	cmd := exec.Command(command[0], command[1:]...) // #nosec G204 -- command is supplied by the user
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &ExecParser{
+		name:    name,
+		command: command,
+		cmd:     cmd,
+		stdin:   stdin,
+		stdout:  bufio.NewReader(stdout),
+	}, nil
+}
+
+// Name returns the parser identifier.
+func (p *ExecParser) Name() string {
+	return p.name
+}
+
+// Description returns a human-readable description.
+func (p *ExecParser) Description() string {
+	return fmt.Sprintf("External command: %s", strings.Join(p.command, " "))
+}
+
+// CanParse asks the process to parse the line. There is no cheaper
+// check, so this costs as much as Parse.
+func (p *ExecParser) CanParse(line string) bool {
+	entry, err := p.Parse(line)
+	return err == nil && entry.ParseError == nil
+}
+
+// Parse sends the line to the process and decodes its answer.
+func (p *ExecParser) Parse(line string) (*Entry, error) {
+	entry := NewEntry(line)
+
+	if strings.ContainsAny(line, "\r\n") {
+		entry.ParseError = fmt.Errorf("%w: line breaks cannot be sent to %s", ErrInvalidData, p.name)
+		entry.Fields["raw"] = line
+		return entry, nil
+	}
+
+	output, err := p.exchange(line)
+	if err != nil {
+		entry.ParseError = err
+		entry.Fields["raw"] = line
+		return entry, nil
+	}
+
+	var fields map[string]any
+	if output = bytes.TrimSpace(output); len(output) > 0 {
+		if err := json.Unmarshal(output, &fields); err != nil {
+			entry.ParseError = fmt.Errorf("%w: %s returned %v", ErrInvalidData, p.name, err)
+			entry.Fields["raw"] = line
+			return entry, nil
+		}
+	}
+	if fields == nil {
+		entry.ParseError = ErrNoMatch
+		entry.Fields["raw"] = line
+		return entry, nil
+	}
+
+	entry.Fields = fields
+	return entry, nil
+}
+
+// exchange writes line to the process and reads its answer.
+func (p *ExecParser) exchange(line string) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return nil, p.err
+	}
+	if _, err := io.WriteString(p.stdin, line+"\n"); err != nil {
+		p.err = fmt.Errorf("%s: %w", p.name, err)
+		return nil, p.err
+	}
+	output, err := p.stdout.ReadBytes('\n')
+	if err != nil {
+		if err == io.EOF {
+			err = fmt.Errorf("process exited")
+		}
+		p.err = fmt.Errorf("%s: %w", p.name, err)
+		return nil, p.err
+	}
+	return output, nil
+}
+
+// Close closes the process's stdin and waits for it to exit.
+func (p *ExecParser) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_ = p.stdin.Close()
+	if p.err == nil {
+		p.err = fmt.Errorf("%s: parser closed", p.name)
+	}
+	return p.cmd.Wait()
+}
@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestExecParserHelper is the child process of the ExecParser tests, run
+// from the test binary: it answers key=value lines with their fields as
+// JSON, "bad" with invalid JSON, "exit" by exiting, and anything else
+// with null.
+func TestExecParserHelper(t *testing.T) {
+	if os.Getenv("LOG2JSON_EXEC_PARSER_HELPER") != "1" {
+		t.Skip("helper process for TestExecParser")
+	}
+	in := bufio.NewScanner(os.Stdin)
+	for in.Scan() {
+		line := in.Text()
+		switch {
+		case line == "bad":
+			fmt.Println("{oops")
+		case line == "exit":
+			os.Exit(0)
+		case strings.Contains(line, "="):
+			k, v, _ := strings.Cut(line, "=")
+			fmt.Printf("{%q:%q}\n", k, v)
+		default:
+			fmt.Println("null")
+		}
+	}
+	os.Exit(0)
+}
+
+func TestExecParser(t *testing.T) {
+	t.Setenv("LOG2JSON_EXEC_PARSER_HELPER", "1")
+	p, err := NewExecParser("helper", []string{os.Args[0], "-test.run=^TestExecParserHelper$"}, os.Stderr)
+	if err != nil {
+		t.Fatalf("NewExecParser() error: %v", err)
+	}
+	defer func() { _ = p.Close() }()
+
+	if p.Name() != "helper" {
+		t.Errorf("Name() = %q, want helper", p.Name())
+	}
+
+	tests := []struct {
+		name      string
+		line      string
+		wantField string
+		wantErr   error
+	}{
+		{name: "fields", line: "user=alice", wantField: "alice"},
+		{name: "no match", line: "plain text", wantErr: ErrNoMatch},
+		{name: "invalid JSON", line: "bad", wantErr: ErrInvalidData},
+		{name: "line break", line: "a=1\nb=2", wantErr: ErrInvalidData},
+		{name: "after invalid JSON", line: "user=bob", wantField: "bob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := p.Parse(tt.line)
+			if err != nil {
+				t.Fatalf("Parse() error: %v", err)
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(entry.ParseError, tt.wantErr) {
+					t.Errorf("ParseError = %v, want %v", entry.ParseError, tt.wantErr)
+				}
+				if entry.Fields["raw"] != tt.line {
+					t.Errorf("raw = %v, want %q", entry.Fields["raw"], tt.line)
+				}
+				return
+			}
+			if entry.ParseError != nil {
+				t.Fatalf("ParseError = %v", entry.ParseError)
+			}
+			if entry.Fields[strings.SplitN(tt.line, "=", 2)[0]] != tt.wantField {
+				t.Errorf("Fields = %v, want %q", entry.Fields, tt.wantField)
+			}
+		})
+	}
+
+	if !p.CanParse("a=1") || p.CanParse("plain") {
+		t.Error("CanParse() should accept only lines the process parses")
+	}
+
+	// Once the process is gone every line fails without blocking
+	entry, _ := p.Parse("exit")
+	if entry.ParseError == nil {
+		t.Fatal("expected an error when the process exits")
+	}
+	entry, _ = p.Parse("a=1")
+	if entry.ParseError == nil || !strings.Contains(entry.ParseError.Error(), "exited") {
+		t.Errorf("ParseError = %v, want process exited", entry.ParseError)
+	}
+}
+
+func TestNewExecParser_Errors(t *testing.T) {
+	if _, err := NewExecParser("none", nil, nil); err == nil {
+		t.Error("expected an error for an empty command")
+	}
+	if _, err := NewExecParser("missing", []string{"/nonexistent/parser"}, nil); err == nil {
+		t.Error("expected an error for a missing program")
+	}
+}
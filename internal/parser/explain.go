@@ -0,0 +1,138 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// How Parse chooses the parser for a line; see Explanation.
+const (
+	ChoiceEmpty    = "empty"    // a blank line, which no parser is given
+	ChoiceForced   = "forced"   // the format named by WithForcedFormat
+	ChoiceCached   = "cached"   // the format detected for earlier lines
+	ChoiceDetected = "detected" // the most confident parser that parsed it
+	ChoiceFallback = "fallback" // no parser parsed it; the fallback did
+	ChoiceNone     = "none"     // no parser parsed it and there is no fallback
+)
+
+// Explanation is how Parse would handle a line: how the parser was
+// chosen, which one it was, and how each registered parser fared.
+type Explanation struct {
+	Choice  string
+	Format  string // the chosen parser; empty for ChoiceEmpty and ChoiceNone
+	Parsers []ParserVerdict
+}
+
+// ParserVerdict is how one parser fared with a line. A parser whose
+// confidence is 0 turned the line down without parsing it; the others
+// were tried, and Err is why one failed.
+type ParserVerdict struct {
+	Name       string
+	Confidence float64
+	Matched    bool
+	Err        error
+}
+
+// String describes the verdict: "matched", "rejected" or the error.
+func (v ParserVerdict) String() string {
+	switch {
+	case v.Matched:
+		return "matched"
+	case v.Err != nil:
+		return "failed: " + v.Err.Error()
+	}
+	return "rejected"
+}
+
+// Explain reports how Parse would handle line, without parsing it for
+// real: the parser statistics, the cached format and the redetection
+// count are left as they are. Call it before Parse, which may cache the
+// format it detects. Every parser is tried, in detection order, even
+// after one matched, so the explanation shows which others could have.
+func (r *Registry) Explain(line string) *Explanation {
+	ex := &Explanation{}
+	if strings.TrimSpace(line) == "" {
+		ex.Choice = ChoiceEmpty
+		return ex
+	}
+
+	// A forced or cached parser is given the line whatever its confidence
+	cached := r.cached.Load()
+	given := func(p Parser) bool {
+		return r.forcedFormat == strings.ToLower(p.Name()) || !r.adaptive && cached != nil && (*cached).Name() == p.Name()
+	}
+
+	best := -1
+	for _, p := range r.parsers {
+		v := ParserVerdict{Name: p.Name(), Confidence: confidence(p, line)}
+		if v.Confidence > 0 || given(p) {
+			entry, err := safeParse(p, line)
+			switch {
+			case err != nil:
+				v.Err = err
+			case entry.ParseError != nil:
+				v.Err = entry.ParseError
+			default:
+				v.Matched = true
+			}
+		}
+		// Parse tries the most confident first; ties go to the first registered
+		if v.Matched && v.Confidence > 0 && (best < 0 || v.Confidence > ex.Parsers[best].Confidence) {
+			best = len(ex.Parsers)
+		}
+		ex.Parsers = append(ex.Parsers, v)
+	}
+
+	switch {
+	case r.forcedFormat != "":
+		ex.Choice, ex.Format = ChoiceForced, r.forcedFormat
+	case !r.adaptive && cached != nil && (ex.verdict((*cached).Name()).Matched ||
+		r.redetectAfter == 0 || r.misses.Load()+1 < r.redetectAfter):
+		// The cached format keeps the line even if it fails, until
+		// redetection is due
+		ex.Choice, ex.Format = ChoiceCached, (*cached).Name()
+	case best >= 0:
+		ex.Choice, ex.Format = ChoiceDetected, ex.Parsers[best].Name
+	case r.GetParser(r.fallback) != nil:
+		ex.Choice, ex.Format = ChoiceFallback, r.GetParser(r.fallback).Name()
+	default:
+		ex.Choice = ChoiceNone
+	}
+	return ex
+}
+
+// verdict returns the verdict on the named parser.
+func (ex *Explanation) verdict(name string) ParserVerdict {
+	for _, v := range ex.Parsers {
+		if v.Name == name {
+			return v
+		}
+	}
+	return ParserVerdict{Name: name}
+}
+
+// String describes the choice, e.g. "syslog (detected)".
+func (ex *Explanation) String() string {
+	if ex.Format == "" {
+		return ex.Choice
+	}
+	return fmt.Sprintf("%s (%s)", ex.Format, ex.Choice)
+}
+
+// Fields returns the explanation as a JSON-friendly map, for the
+// _detection field.
+func (ex *Explanation) Fields() map[string]any {
+	parsers := make([]any, 0, len(ex.Parsers))
+	for _, v := range ex.Parsers {
+		parsers = append(parsers, map[string]any{
+			"name":       v.Name,
+			"confidence": v.Confidence,
+			"result":     v.String(),
+		})
+	}
+	fields := map[string]any{"choice": ex.Choice, "parsers": parsers}
+	if ex.Format != "" {
+		fields["format"] = ex.Format
+	}
+	return fields
+}
@@ -0,0 +1,83 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegistry_Explain(t *testing.T) {
+	syslogLine := "Jan 15 10:30:45 myhost sshd[1234]: Accepted key"
+
+	tests := []struct {
+		name        string
+		opts        []RegistryOption
+		before      string // a line parsed first, which may cache a format
+		line        string
+		wantChoice  string
+		wantFormat  string
+		wantMatched []string
+	}{
+		{name: "empty", line: "  ", wantChoice: ChoiceEmpty},
+		{name: "detected", line: syslogLine, wantChoice: ChoiceDetected, wantFormat: "syslog", wantMatched: []string{"syslog"}},
+		{name: "json", line: `{"level":"info"}`, wantChoice: ChoiceDetected, wantFormat: "json", wantMatched: []string{"json"}},
+		{name: "fallback", opts: []RegistryOption{WithAdaptiveMode()}, line: "just words", wantChoice: ChoiceFallback, wantFormat: "generic"},
+		{name: "no fallback", opts: []RegistryOption{WithFallback("")}, line: "just words", wantChoice: ChoiceNone},
+		{name: "forced", opts: []RegistryOption{WithForcedFormat("json")}, line: syslogLine, wantChoice: ChoiceForced, wantFormat: "json", wantMatched: []string{"syslog"}},
+		{name: "cached", before: syslogLine, line: `{"level":"info"}`, wantChoice: ChoiceCached, wantFormat: "syslog", wantMatched: []string{"json"}},
+		{name: "redetect due", opts: []RegistryOption{WithRedetectAfter(1)}, before: syslogLine, line: `{"level":"info"}`, wantChoice: ChoiceDetected, wantFormat: "json", wantMatched: []string{"json"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry(tt.opts...)
+			if tt.before != "" {
+				_, _ = r.Parse(tt.before)
+			}
+			before := r.Stats()
+
+			ex := r.Explain(tt.line)
+			if ex.Choice != tt.wantChoice || ex.Format != tt.wantFormat {
+				t.Errorf("Explain() = %s, want %s (%s)", ex, tt.wantFormat, tt.wantChoice)
+			}
+			var matched []string
+			for _, v := range ex.Parsers {
+				if v.Matched {
+					matched = append(matched, v.Name)
+				}
+			}
+			if !reflect.DeepEqual(matched, tt.wantMatched) {
+				t.Errorf("matched = %v, want %v", matched, tt.wantMatched)
+			}
+			if !reflect.DeepEqual(r.Stats(), before) {
+				t.Error("Explain() changed the parser statistics")
+			}
+
+			// Parse makes the choice Explain reported
+			if entry, err := r.Parse(tt.line); err == nil && tt.wantFormat != "" && entry.Format != tt.wantFormat {
+				t.Errorf("Parse() used %s, Explain() reported %s", entry.Format, tt.wantFormat)
+			}
+		})
+	}
+}
+
+func TestRegistry_ExplainVerdicts(t *testing.T) {
+	r := NewRegistry(WithFallback(""))
+	if err := r.Select([]string{"json", "syslog"}); err != nil {
+		t.Fatal(err)
+	}
+	ex := r.Explain(`{"level": }`)
+
+	if ex.Choice != ChoiceNone || ex.Format != "" {
+		t.Errorf("Explain() = %s, want none", ex)
+	}
+	want := map[string]string{"json": "failed: ", "syslog": "rejected"}
+	for _, v := range ex.Parsers {
+		if got := v.String(); len(got) < len(want[v.Name]) || got[:len(want[v.Name])] != want[v.Name] {
+			t.Errorf("%s verdict = %q, want %q...", v.Name, got, want[v.Name])
+		}
+	}
+	fields := ex.Fields()
+	if fields["choice"] != ChoiceNone || len(fields["parsers"].([]any)) != 2 {
+		t.Errorf("Fields() = %v", fields)
+	}
+}
@@ -58,6 +58,18 @@ func (p *GenericParser) CanParse(line string) bool {
 	return true
 }
 
+// Score claims lines matching one of the timestamp/level patterns, with
+// less confidence than any specific format. Other lines are left to the
+// registry's fallback, which is this parser by default.
+func (p *GenericParser) Score(line string) float64 {
+	for _, pattern := range p.patterns {
+		if pattern.MatchString(line) {
+			return 0.5
+		}
+	}
+	return 0
+}
+
 // Parse attempts to extract fields using common patterns.
 // Falls back to wrapping the line as "message" if no pattern matches.
 func (p *GenericParser) Parse(line string) (*Entry, error) {
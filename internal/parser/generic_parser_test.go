@@ -29,6 +29,16 @@ func TestGenericParser_CanParse(t *testing.T) {
 	}
 }
 
+func TestGenericParser_Score(t *testing.T) {
+	p := NewGenericParser()
+
+	pattern := p.Score("2024-01-15 10:30:45 INFO hello")
+	plain := p.Score("just some text")
+	if pattern <= 0 || pattern >= 1 || plain != 0 {
+		t.Errorf("Score: pattern match = %v, plain text = %v; want 0 < pattern < 1 and plain 0", pattern, plain)
+	}
+}
+
 func TestGenericParser_Parse(t *testing.T) {
 	p := NewGenericParser()
 
@@ -0,0 +1,152 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// GrokParser matches lines with grok patterns, tried in order, such as
+// %{IPORHOST:client} %{WORD:method} %{URIPATHPARAM:path}, which is
+// compiled to a regex from a library of named patterns (see
+// grokPatterns). %{NAME:field} captures into field, %{NAME} matches
+// without capturing, and a type suffix (%{INT:code:int}) is accepted but
+// values are typed by inference, as for regex patterns.
+type GrokParser struct {
+	*RegexParser
+	grokTexts []string
+}
+
+// grokReference matches %{NAME}, %{NAME:field} and %{NAME:field:type}.
+var grokReference = regexp.MustCompile(`%\{(\w+)(?::(\w+))?(?::(?:int|float|string))?\}`)
+
+// grokPatterns are the named patterns grok references can use, adapted
+// from Logstash's to RE2 syntax (no lookaround).
+var grokPatterns = map[string]string{
+	"USERNAME":          `[a-zA-Z0-9._-]+`,
+	"USER":              `%{USERNAME}`,
+	"EMAILLOCAL":        `[a-zA-Z0-9._%+-]+`,
+	"EMAILADDRESS":      `%{EMAILLOCAL}@%{HOSTNAME}`,
+	"INT":               `[+-]?[0-9]+`,
+	"BASE10NUM":         `[+-]?(?:[0-9]+(?:\.[0-9]+)?|\.[0-9]+)`,
+	"NUMBER":            `%{BASE10NUM}`,
+	"BASE16NUM":         `[+-]?(?:0x)?[0-9A-Fa-f]+`,
+	"POSINT":            `\b[1-9][0-9]*\b`,
+	"NONNEGINT":         `\b[0-9]+\b`,
+	"WORD":              `\b\w+\b`,
+	"NOTSPACE":          `\S+`,
+	"SPACE":             `\s*`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"QUOTEDSTRING":      `"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`,
+	"QS":                `%{QUOTEDSTRING}`,
+	"UUID":              `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+	"MAC":               `(?:[A-Fa-f0-9]{2}[:-]){5}[A-Fa-f0-9]{2}`,
+	"IPV4":              `(?:(?:25[0-5]|2[0-4][0-9]|1?[0-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1?[0-9]?[0-9])`,
+	"IPV6":              `(?:[0-9A-Fa-f]{0,4}:){2,7}[0-9A-Fa-f]{0,4}(?:%[0-9A-Za-z]+)?`,
+	"IP":                `%{IPV6}|%{IPV4}`,
+	"HOSTNAME":          `\b[0-9A-Za-z][0-9A-Za-z-]{0,62}(?:\.[0-9A-Za-z][0-9A-Za-z-]{0,62})*\.?`,
+	"IPORHOST":          `%{IP}|%{HOSTNAME}`,
+	"HOSTPORT":          `%{IPORHOST}:%{POSINT}`,
+	"UNIXPATH":          `(?:/[\w%!$@:.,+~-]*)+`,
+	"PATH":              `%{UNIXPATH}`,
+	"URIPROTO":          `[A-Za-z][A-Za-z0-9+.-]*`,
+	"URIPATH":           `(?:/[A-Za-z0-9$.+!*'(){},~:;=@#%&_-]*)+`,
+	"URIPARAM":          `\?[A-Za-z0-9$.+!*'|(){},~@#%&/=:;_?\[\]<>-]*`,
+	"URIPATHPARAM":      `%{URIPATH}(?:%{URIPARAM})?`,
+	"URI":               `%{URIPROTO}://\S+`,
+	"MONTH":             `\b(?:Jan(?:uary)?|Feb(?:ruary)?|Mar(?:ch)?|Apr(?:il)?|May|Jun(?:e)?|Jul(?:y)?|Aug(?:ust)?|Sep(?:tember)?|Oct(?:ober)?|Nov(?:ember)?|Dec(?:ember)?)\b`,
+	"MONTHNUM":          `0?[1-9]|1[0-2]`,
+	"MONTHDAY":          `0[1-9]|[12][0-9]|3[01]|[1-9]`,
+	"DAY":               `Mon(?:day)?|Tue(?:sday)?|Wed(?:nesday)?|Thu(?:rsday)?|Fri(?:day)?|Sat(?:urday)?|Sun(?:day)?`,
+	"YEAR":              `(?:\d\d){1,2}`,
+	"HOUR":              `2[0123]|[01]?[0-9]`,
+	"MINUTE":            `[0-5][0-9]`,
+	"SECOND":            `(?:[0-5]?[0-9]|60)(?:[:.,][0-9]+)?`,
+	"TIME":              `%{HOUR}:%{MINUTE}(?::%{SECOND})?`,
+	"ISO8601_TIMEZONE":  `Z|[+-]%{HOUR}(?::?%{MINUTE})`,
+	"TIMESTAMP_ISO8601": `%{YEAR}-%{MONTHNUM}-%{MONTHDAY}[T ]%{HOUR}:?%{MINUTE}(?::?%{SECOND})?(?:%{ISO8601_TIMEZONE})?`,
+	"DATE_US":           `%{MONTHNUM}[/-]%{MONTHDAY}[/-]%{YEAR}`,
+	"DATE_EU":           `%{MONTHDAY}[./-]%{MONTHNUM}[./-]%{YEAR}`,
+	"DATE":              `%{DATE_US}|%{DATE_EU}`,
+	"HTTPDATE":          `%{MONTHDAY}/%{MONTH}/%{YEAR}:%{TIME} %{INT}`,
+	"SYSLOGTIMESTAMP":   `%{MONTH} +%{MONTHDAY} %{TIME}`,
+	"LOGLEVEL":          `[Aa]lert|ALERT|[Tt]race|TRACE|[Dd]ebug|DEBUG|[Nn]otice|NOTICE|[Ii]nfo(?:rmation)?|INFO(?:RMATION)?|[Ww]arn(?:ing)?|WARN(?:ING)?|[Ee]rr(?:or)?|ERR(?:OR)?|[Cc]rit(?:ical)?|CRIT(?:ICAL)?|[Ff]atal|FATAL|[Ss]evere|SEVERE|[Ee]merg(?:ency)?|EMERG(?:ENCY)?`,
+}
+
+// NewGrokParser creates a parser from one or more grok patterns, tried
+// in order until one matches. defs adds named patterns to the library, or
+// replaces its own, for these patterns only. Returns error if there is no
+// pattern, or one references an unknown or recursive pattern or compiles
+// to an invalid regex.
+func NewGrokParser(defs map[string]string, grokTexts ...string) (*GrokParser, error) {
+	expanded := make([]string, len(grokTexts))
+	for i, grokText := range grokTexts {
+		var err error
+		if expanded[i], err = expandGrok(grokText, defs, nil); err != nil {
+			if len(grokTexts) > 1 {
+				return nil, fmt.Errorf("pattern %d: %w", i+1, err)
+			}
+			return nil, err
+		}
+	}
+	regex, err := NewRegexParser(expanded...)
+	if err != nil {
+		return nil, err
+	}
+	return &GrokParser{RegexParser: regex, grokTexts: grokTexts}, nil
+}
+
+// expandGrok replaces the references in pattern with their definitions.
+// seen holds the patterns being expanded, to catch recursion.
+func expandGrok(pattern string, defs map[string]string, seen []string) (string, error) {
+	var err error
+	expanded := grokReference.ReplaceAllStringFunc(pattern, func(ref string) string {
+		if err != nil {
+			return ""
+		}
+		m := grokReference.FindStringSubmatch(ref)
+		name, field := m[1], m[2]
+		for _, s := range seen {
+			if s == name {
+				err = fmt.Errorf("grok pattern %s refers to itself", name)
+				return ""
+			}
+		}
+		def, ok := defs[name]
+		if !ok {
+			def, ok = grokPatterns[name]
+		}
+		if !ok {
+			err = fmt.Errorf("unknown grok pattern %s", name)
+			return ""
+		}
+
+		var inner string
+		inner, err = expandGrok(def, defs, append(seen, name))
+		if field == "" {
+			return "(?:" + inner + ")"
+		}
+		return "(?P<" + field + ">" + inner + ")"
+	})
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(expanded, "%{") {
+		return "", fmt.Errorf("invalid grok reference in %q", pattern)
+	}
+	return expanded, nil
+}
+
+// Name returns the parser identifier.
+func (p *GrokParser) Name() string {
+	return "grok"
+}
+
+// Description returns a human-readable description.
+func (p *GrokParser) Description() string {
+	if len(p.grokTexts) == 1 {
+		return fmt.Sprintf("Grok pattern: %s", p.grokTexts[0])
+	}
+	return fmt.Sprintf("Grok patterns: %s", strings.Join(p.grokTexts, " ; "))
+}
@@ -0,0 +1,120 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewGrokParser_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		defs    map[string]string
+		want    string
+	}{
+		{name: "unknown pattern", pattern: "%{NOPE:x}", want: "unknown grok pattern NOPE"},
+		{name: "recursive pattern", pattern: "%{A:x}", defs: map[string]string{"A": "a%{B}", "B": "%{A}"}, want: "refers to itself"},
+		{name: "invalid field name", pattern: "%{WORD:a.b}", want: "invalid grok reference"},
+		{name: "invalid regex", pattern: "%{WORD:x}(", want: "missing closing )"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewGrokParser(tt.defs, tt.pattern)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewGrokParser(%q) error = %v, want it to contain %q", tt.pattern, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrokParser_Parse(t *testing.T) {
+	tests := []struct {
+		name       string
+		pattern    string
+		defs       map[string]string
+		line       string
+		wantFields map[string]any // nil if the line must not match
+	}{
+		{
+			name:    "apache access",
+			pattern: `%{IPORHOST:client} %{USER:ident} %{USER:auth} \[%{HTTPDATE:time}\] "%{WORD:method} %{URIPATHPARAM:path} HTTP/%{NUMBER:version}" %{INT:status:int} %{INT:bytes}`,
+			line:    `192.168.1.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif?x=1 HTTP/1.0" 200 2326`,
+			wantFields: map[string]any{
+				"client": "192.168.1.1", "ident": "-", "auth": "frank", "time": "10/Oct/2000:13:55:36 -0700",
+				"method": "GET", "path": "/a.gif?x=1", "version": 1.0, "status": int64(200), "bytes": int64(2326),
+			},
+		},
+		{
+			name:    "application log",
+			pattern: `%{TIMESTAMP_ISO8601:time} %{LOGLEVEL:level} %{UUID:request} %{GREEDYDATA:msg}`,
+			line:    "2024-01-15T10:30:45.123Z WARN 123e4567-e89b-12d3-a456-426614174000 disk almost full",
+			wantFields: map[string]any{
+				"time": "2024-01-15T10:30:45.123Z", "level": "WARN",
+				"request": "123e4567-e89b-12d3-a456-426614174000", "msg": "disk almost full",
+			},
+		},
+		{
+			name:       "unnamed references do not capture",
+			pattern:    `%{SYSLOGTIMESTAMP} %{HOSTNAME:host} %{WORD:program}: %{GREEDYDATA:msg}`,
+			line:       "Jan  5 14:02:01 web-1.example.com cron: job done",
+			wantFields: map[string]any{"host": "web-1.example.com", "program": "cron", "msg": "job done"},
+		},
+		{
+			name:       "custom patterns",
+			pattern:    `%{TICKET:ticket} %{GREEDYDATA:msg}`,
+			defs:       map[string]string{"TICKET": `%{PROJECT}-%{POSINT}`, "PROJECT": `[A-Z]+`},
+			line:       "OPS-42 restart required",
+			wantFields: map[string]any{"ticket": "OPS-42", "msg": "restart required"},
+		},
+		{
+			name:    "no match",
+			pattern: `^%{IPV4:ip}$`,
+			line:    "not an address",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewGrokParser(tt.defs, tt.pattern)
+			if err != nil {
+				t.Fatalf("NewGrokParser() error: %v", err)
+			}
+			entry, err := p.Parse(tt.line)
+			if err != nil {
+				t.Fatalf("Parse() error: %v", err)
+			}
+			if tt.wantFields == nil {
+				if entry.ParseError == nil {
+					t.Errorf("Parse() matched %v, want no match", entry.Fields)
+				}
+				return
+			}
+			if entry.ParseError != nil {
+				t.Fatalf("Parse() ParseError: %v", entry.ParseError)
+			}
+			if !reflect.DeepEqual(entry.Fields, tt.wantFields) {
+				t.Errorf("Fields = %v, want %v", entry.Fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestGrokParser_Patterns(t *testing.T) {
+	p, err := NewGrokParser(nil, `%{LOGLEVEL:level}: %{GREEDYDATA:msg}`, `%{IPV4:client} %{WORD:method} %{URIPATH:path}`)
+	if err != nil {
+		t.Fatalf("NewGrokParser() error: %v", err)
+	}
+	entry, _ := p.Parse("10.0.0.1 GET /health")
+	if entry.ParseError != nil || entry.Fields["method"] != "GET" {
+		t.Errorf("Parse() = %v, %v", entry.Fields, entry.ParseError)
+	}
+	if d := p.Description(); !strings.HasPrefix(d, "Grok patterns: ") {
+		t.Errorf("Description() = %q", d)
+	}
+
+	if _, err := NewGrokParser(nil, `%{WORD:a}`, `%{NOPE:b}`); err == nil || !strings.Contains(err.Error(), "pattern 2") {
+		t.Errorf("NewGrokParser() error = %v, want it to name pattern 2", err)
+	}
+}
@@ -0,0 +1,50 @@
+package parser
+
+import (
+	"strings"
+	"sync"
+)
+
+// maxInternLen and maxInterned bound the intern table: long values are
+// rarely repeated, and once maxInterned values are held no more are
+// added, so a high-cardinality field cannot grow it without limit.
+const (
+	maxInternLen = 32
+	maxInterned  = 1 << 14
+)
+
+// interned maps short field values to the interface values holding them.
+var interned = struct {
+	sync.RWMutex
+	values map[string]any
+}{values: make(map[string]any)}
+
+// internValue returns s as an interface value. Storing a string in an
+// Entry's fields boxes it, an allocation per field; short values repeat
+// from line to line (levels, methods, hosts), so they are boxed once and
+// shared instead. The shared copy does not refer to s's memory, so it
+// does not keep the line it came from alive.
+func internValue(s string) any {
+	if s == "" || len(s) > maxInternLen {
+		return s
+	}
+	interned.RLock()
+	v, ok := interned.values[s]
+	interned.RUnlock()
+	if ok {
+		return v
+	}
+
+	interned.Lock()
+	defer interned.Unlock()
+	if v, ok := interned.values[s]; ok {
+		return v
+	}
+	if len(interned.values) >= maxInterned {
+		return s
+	}
+	s = strings.Clone(s)
+	v = s
+	interned.values[s] = v
+	return v
+}
@@ -0,0 +1,35 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInternValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		shared bool
+	}{
+		{"short value", "info", true},
+		{"empty boxes without allocating", "", true},
+		{"long value", strings.Repeat("x", maxInternLen+1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Each value comes from its own line, as the parser sees them
+			a := internValue(strings.Clone(tt.value))
+			b := internValue(strings.Clone(tt.value))
+			if a != tt.value || b != tt.value {
+				t.Fatalf("internValue() = %q, %q; want %q", a, b, tt.value)
+			}
+			allocs := testing.AllocsPerRun(10, func() {
+				_ = internValue(tt.value)
+			})
+			if shared := allocs == 0; shared != tt.shared {
+				t.Errorf("boxing %q allocates %v times, want shared = %v", tt.value, allocs, tt.shared)
+			}
+		})
+	}
+}
@@ -1,17 +1,38 @@
 package parser
 
 import (
+	"bytes"
 	"encoding/json"
 	"strings"
+	"unsafe"
 )
 
 // JSONParser handles lines that are already valid JSON.
 // This is the highest priority parser since JSON is already structured.
-type JSONParser struct{}
+type JSONParser struct {
+	// maxDepth, if positive, is the deepest nesting decoded
+	maxDepth int
+}
+
+// JSONOption configures a JSONParser.
+type JSONOption func(*JSONParser)
+
+// WithMaxDepth keeps objects and arrays nested more than n levels deep
+// (the line's object is level 1) as their JSON text, so that deeply
+// nested input does not turn into deeply nested output.
+func WithMaxDepth(n int) JSONOption {
+	return func(p *JSONParser) {
+		p.maxDepth = n
+	}
+}
 
 // NewJSONParser creates a new JSON parser.
-func NewJSONParser() *JSONParser {
-	return &JSONParser{}
+func NewJSONParser(opts ...JSONOption) *JSONParser {
+	p := &JSONParser{}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
 // Name returns the parser identifier.
@@ -35,10 +56,24 @@ func (p *JSONParser) CanParse(line string) bool {
 
 // Parse extracts data from a JSON log line.
 func (p *JSONParser) Parse(line string) (*Entry, error) {
+	// The decoder only reads its input and copies the strings it returns,
+	// so it can be given the line's own bytes rather than a copy
+	// #nosec G103 -- the bytes are read, never written
+	data := unsafe.Slice(unsafe.StringData(line), len(line))
+	return p.parse(data, line)
+}
+
+func (p *JSONParser) parse(data []byte, line string) (*Entry, error) {
 	entry := NewEntry(line)
 
 	// Unmarshal into the fields map directly
-	if err := json.Unmarshal([]byte(line), &entry.Fields); err != nil {
+	var err error
+	if p.maxDepth > 0 {
+		err = p.decodeShallow(data, entry.Fields)
+	} else {
+		err = json.Unmarshal(data, &entry.Fields)
+	}
+	if err != nil {
 		entry.ParseError = err
 		entry.Fields["raw"] = line
 		entry.Fields["_parseError"] = err.Error()
@@ -46,3 +81,67 @@ func (p *JSONParser) Parse(line string) (*Entry, error) {
 
 	return entry, nil
 }
+
+// decodeShallow decodes an object into fields, keeping containers nested
+// deeper than maxDepth as compact JSON text.
+func (p *JSONParser) decodeShallow(data []byte, fields map[string]any) error {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(data, &top); err != nil {
+		return err
+	}
+	for k, raw := range top {
+		v, err := p.decodeValue(raw, 2)
+		if err != nil {
+			return err
+		}
+		fields[k] = v
+	}
+	return nil
+}
+
+// decodeValue decodes a value at the given nesting level.
+func (p *JSONParser) decodeValue(raw json.RawMessage, depth int) (any, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		var v any
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	}
+	if depth > p.maxDepth {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, trimmed); err != nil {
+			return nil, err
+		}
+		return buf.String(), nil
+	}
+
+	if trimmed[0] == '[' {
+		var items []json.RawMessage
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, err
+		}
+		values := make([]any, len(items))
+		for i, item := range items {
+			v, err := p.decodeValue(item, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return values, nil
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &members); err != nil {
+		return nil, err
+	}
+	values := make(map[string]any, len(members))
+	for k, member := range members {
+		v, err := p.decodeValue(member, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		values[k] = v
+	}
+	return values, nil
+}
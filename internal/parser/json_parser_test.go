@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -147,3 +148,44 @@ func TestJSONParser_Parse(t *testing.T) {
 		})
 	}
 }
+
+func TestJSONParser_MaxDepth(t *testing.T) {
+	line := `{"a": 1, "obj": {"b": {"c": [1, 2]}}, "list": [{"d": 1}], "s": "x"}`
+
+	tests := []struct {
+		name  string
+		depth int
+		want  map[string]any
+	}{
+		{
+			name:  "top level only",
+			depth: 1,
+			want:  map[string]any{"a": float64(1), "obj": `{"b":{"c":[1,2]}}`, "list": `[{"d":1}]`, "s": "x"},
+		},
+		{
+			name:  "two levels",
+			depth: 2,
+			want: map[string]any{
+				"a": float64(1), "obj": map[string]any{"b": `{"c":[1,2]}`},
+				"list": []any{`{"d":1}`}, "s": "x",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := NewJSONParser(WithMaxDepth(tt.depth)).Parse(line)
+			if err != nil || entry.ParseError != nil {
+				t.Fatalf("Parse() error: %v, %v", err, entry.ParseError)
+			}
+			if !reflect.DeepEqual(entry.Fields, tt.want) {
+				t.Errorf("fields = %#v\nwant %#v", entry.Fields, tt.want)
+			}
+		})
+	}
+
+	entry, _ := NewJSONParser(WithMaxDepth(1)).Parse(`{"a": {"b": }}`)
+	if entry.ParseError == nil {
+		t.Error("invalid JSON: expected ParseError")
+	}
+}
@@ -2,21 +2,60 @@ package parser
 
 import (
 	"regexp"
+	"strings"
+	"unicode/utf8"
 )
 
 // KeyValueParser handles logs in key=value format.
 // Common in structured logging frameworks like logfmt.
 // Example: level=info msg="User logged in" user_id=123 duration=0.5
 type KeyValueParser struct {
-	// pattern matches key=value or key="quoted value" pairs
+	// pattern matches key=value or key="quoted value" pairs; it is used
+	// only for a separator scanPairs cannot handle
 	pattern *regexp.Regexp
+
+	// separator goes between key and value, and minPairs is the number
+	// of pairs a line needs for CanParse
+	separator string
+	minPairs  int
+
+	// inference controls conversion of values to numbers/booleans
+	inference TypeInference
+}
+
+// DefaultKVMinPairs is the number of pairs a line needs to be detected as
+// key=value; a single pair is too common in free text.
+const DefaultKVMinPairs = 2
+
+// KeyValueOption configures a KeyValueParser.
+type KeyValueOption func(*KeyValueParser)
+
+// WithKVSeparator sets the text between key and value (default "="),
+// such as ":" for key:value pairs.
+func WithKVSeparator(sep string) KeyValueOption {
+	return func(p *KeyValueParser) {
+		p.separator = sep
+	}
+}
+
+// WithKVMinPairs sets the number of pairs a line needs to be detected as
+// key=value (default DefaultKVMinPairs).
+func WithKVMinPairs(n int) KeyValueOption {
+	return func(p *KeyValueParser) {
+		p.minPairs = n
+	}
 }
 
 // NewKeyValueParser creates a new key-value parser.
-func NewKeyValueParser() *KeyValueParser {
+func NewKeyValueParser(opts ...KeyValueOption) *KeyValueParser {
+	p := &KeyValueParser{separator: "=", minPairs: DefaultKVMinPairs}
+	for _, opt := range opts {
+		opt(p)
+	}
+
 	// Match: key=value or key="value with spaces" or key='value'
-	pattern := regexp.MustCompile(`(\w+)=(?:"([^"]*)"|'([^']*)'|(\S+))`)
-	return &KeyValueParser{pattern: pattern}
+	p.pattern = regexp.MustCompile(`(\w+)` + regexp.QuoteMeta(p.separator) + `(?:"([^"]*)"|'([^']*)'|(\S+))`)
+	return p
 }
 
 // Name returns the parser identifier.
@@ -29,41 +68,138 @@ func (p *KeyValueParser) Description() string {
 	return "Key=value format (logfmt style)"
 }
 
+// SetTypeInference configures which values are converted from strings.
+func (p *KeyValueParser) SetTypeInference(ti TypeInference) {
+	p.inference = ti
+}
+
 // CanParse checks if the line contains key=value patterns.
-// Requires at least 2 key=value pairs to avoid false positives.
+// Requires at least 2 key=value pairs (see WithKVMinPairs) to avoid false
+// positives.
 func (p *KeyValueParser) CanParse(line string) bool {
-	matches := p.pattern.FindAllString(line, -1)
-	return len(matches) >= 2
+	pairs := 0
+	p.scanPairs(line, func(_, _ string, _, _ int) bool {
+		pairs++
+		return pairs < p.minPairs
+	})
+	return pairs >= p.minPairs
+}
+
+// Score returns the share of the line covered by key=value pairs, so that
+// a line of pairs outranks, say, a syslog line whose message holds a few.
+func (p *KeyValueParser) Score(line string) float64 {
+	trimmed := strings.TrimSpace(line)
+	pairs, covered := 0, 0
+	p.scanPairs(trimmed, func(_, _ string, start, end int) bool {
+		pairs++
+		covered += end - start
+		return true
+	})
+	if pairs == 0 || pairs < p.minPairs {
+		return 0
+	}
+	// Count one separator between pairs as covered.
+	covered += pairs - 1
+	return min(float64(covered)/float64(len(trimmed)), 1)
 }
 
 // Parse extracts key-value pairs from the log line.
 func (p *KeyValueParser) Parse(line string) (*Entry, error) {
+	return p.ParseFields(line, nil)
+}
+
+// ParseFields is like Parse, converting and storing only the wanted
+// pairs.
+func (p *KeyValueParser) ParseFields(line string, wanted map[string]bool) (*Entry, error) {
 	entry := NewEntry(line)
 
-	matches := p.pattern.FindAllStringSubmatch(line, -1)
-	if len(matches) == 0 {
+	pairs := 0
+	p.scanPairs(line, func(key, value string, _, _ int) bool {
+		pairs++
+		if wants(wanted, key) {
+			// Try to convert to appropriate type
+			entry.Fields[key] = p.inference.value(key, value)
+		}
+		return true
+	})
+	if pairs == 0 {
 		entry.ParseError = ErrNoMatch
 		entry.Fields["raw"] = line
-		return entry, nil
 	}
 
-	for _, match := range matches {
-		key := match[1]
+	return entry, nil
+}
 
-		// Value is in one of the capture groups (quoted or unquoted)
-		var value string
-		switch {
-		case match[2] != "": // double-quoted
-			value = match[2]
-		case match[3] != "": // single-quoted
-			value = match[3]
-		default: // unquoted
-			value = match[4]
+// scanPairs calls fn with each pair in line, as the pattern finds them,
+// and the pair's start and end offsets, until fn returns false. Slicing
+// the line by hand instead of with the pattern's submatches allocates
+// nothing; a separator containing word characters, which the pattern may
+// match by backtracking into a key, is left to the pattern.
+func (p *KeyValueParser) scanPairs(line string, fn func(key, value string, start, end int) bool) {
+	sep := p.separator
+	if sep == "" || strings.IndexFunc(sep, func(r rune) bool { return r < utf8.RuneSelf && isWordByte(byte(r)) }) >= 0 {
+		for _, m := range p.pattern.FindAllStringSubmatchIndex(line, -1) {
+			var value string
+			switch {
+			case m[4] >= 0 && m[5] > m[4]: // double-quoted
+				value = line[m[4]:m[5]]
+			case m[6] >= 0 && m[7] > m[6]: // single-quoted
+				value = line[m[6]:m[7]]
+			case m[8] >= 0: // unquoted
+				value = line[m[8]:m[9]]
+			}
+			if !fn(line[m[2]:m[3]], value, m[0], m[1]) {
+				return
+			}
 		}
-
-		// Try to convert to appropriate type
-		entry.Fields[key] = inferType(value)
+		return
 	}
 
-	return entry, nil
+	for i := 0; i < len(line); {
+		// A key is a run of word characters followed by the separator;
+		// a later start in the same run ends at the same place, so a run
+		// that fails is skipped whole
+		start := i
+		for i < len(line) && isWordByte(line[i]) {
+			i++
+		}
+		if i == start {
+			i++
+			continue
+		}
+		if !strings.HasPrefix(line[i:], sep) {
+			continue
+		}
+		key := line[start:i]
+		v := i + len(sep)
+
+		// "quoted", 'quoted', or else up to the next space
+		var value string
+		end := -1
+		if v < len(line) && (line[v] == '"' || line[v] == '\'') {
+			if n := strings.IndexByte(line[v+1:], line[v]); n >= 0 {
+				value, end = line[v+1:v+1+n], v+n+2
+			}
+		}
+		if end < 0 {
+			end = v
+			for end < len(line) && !isSpaceByte(line[end]) {
+				end++
+			}
+			if end == v {
+				// No value: the pattern tries again from the next byte,
+				// which is inside the separator or beyond it
+				i = start + 1
+				for i < len(line) && isWordByte(line[i]) {
+					i++
+				}
+				continue
+			}
+			value = line[v:end]
+		}
+		if !fn(key, value, start, end) {
+			return
+		}
+		i = end
+	}
 }
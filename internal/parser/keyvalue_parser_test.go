@@ -2,6 +2,7 @@ package parser
 
 import (
 	"errors"
+	"math/rand"
 	"testing"
 )
 
@@ -55,6 +56,67 @@ func TestKeyValueParser_CanParse(t *testing.T) {
 	}
 }
 
+func TestKeyValueParser_Score(t *testing.T) {
+	p := NewKeyValueParser()
+
+	tests := []struct {
+		name    string
+		line    string
+		wantMin float64
+		wantMax float64
+	}{
+		{name: "only pairs", line: `level=info msg="hello world" user=alice`, wantMin: 1, wantMax: 1},
+		{name: "single pair", line: `level=info`, wantMin: 0, wantMax: 0},
+		{name: "pairs after a header", line: "Jan 15 10:30:45 web1 app[12]: user=bob action=login", wantMin: 0.3, wantMax: 0.5},
+		{name: "plain text", line: "this is plain text", wantMin: 0, wantMax: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := p.Score(tt.line)
+			if got < tt.wantMin || got > tt.wantMax {
+				t.Errorf("Score(%q) = %v, want between %v and %v", tt.line, got, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestKeyValueParser_Options(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []KeyValueOption
+		line      string
+		wantParse bool
+		want      map[string]any
+	}{
+		{name: "colon separator", opts: []KeyValueOption{WithKVSeparator(":")}, line: `level:info msg:"hi there"`, wantParse: true, want: map[string]any{"level": "info", "msg": "hi there"}},
+		{name: "colon separator ignores =", opts: []KeyValueOption{WithKVSeparator(":")}, line: "a=1 b=2", wantParse: false},
+		{name: "single pair", opts: []KeyValueOption{WithKVMinPairs(1)}, line: "status=ok", wantParse: true, want: map[string]any{"status": "ok"}},
+		{name: "three pairs needed", opts: []KeyValueOption{WithKVMinPairs(3)}, line: "a=1 b=2", wantParse: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewKeyValueParser(tt.opts...)
+			if got := p.CanParse(tt.line); got != tt.wantParse {
+				t.Fatalf("CanParse(%q) = %v, want %v", tt.line, got, tt.wantParse)
+			}
+			if got := p.Score(tt.line) > 0; got != tt.wantParse {
+				t.Errorf("Score(%q) > 0 = %v, want %v", tt.line, got, tt.wantParse)
+			}
+			if !tt.wantParse {
+				return
+			}
+			entry, _ := p.Parse(tt.line)
+			for k, v := range tt.want {
+				if entry.Fields[k] != v {
+					t.Errorf("Parse(%q): %s = %v, want %v", tt.line, k, entry.Fields[k], v)
+				}
+			}
+		})
+	}
+}
+
 func TestKeyValueParser_Parse(t *testing.T) {
 	p := NewKeyValueParser()
 
@@ -212,3 +274,96 @@ func TestInferType(t *testing.T) {
 		})
 	}
 }
+
+func TestKeyValueParser_TypeInference(t *testing.T) {
+	line := `zip=02134 version=1.10 count=5 ok=true`
+
+	tests := []struct {
+		name string
+		ti   TypeInference
+		want map[string]any
+	}{
+		{
+			name: "default infers",
+			ti:   TypeInference{},
+			want: map[string]any{"zip": int64(2134), "version": 1.1, "count": int64(5), "ok": true},
+		},
+		{
+			name: "disabled keeps strings",
+			ti:   TypeInference{Disabled: true},
+			want: map[string]any{"zip": "02134", "version": "1.10", "count": "5", "ok": "true"},
+		},
+		{
+			name: "per-field strings",
+			ti:   TypeInference{StringFields: map[string]bool{"zip": true, "version": true}},
+			want: map[string]any{"zip": "02134", "version": "1.10", "count": int64(5), "ok": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewKeyValueParser()
+			p.SetTypeInference(tt.ti)
+
+			entry, err := p.Parse(line)
+			if err != nil {
+				t.Fatalf("Parse error: %v", err)
+			}
+			for k, want := range tt.want {
+				if got := entry.Fields[k]; got != want {
+					t.Errorf("%s = %v (%T), want %v (%T)", k, got, got, want, want)
+				}
+			}
+		})
+	}
+}
+
+// TestKeyValueParser_ScanPairsMatchesPattern checks the hand-written
+// scanner finds the same pairs as the pattern, on fixed edge cases and on
+// random lines drawn from the characters that matter to it.
+func TestKeyValueParser_ScanPairsMatchesPattern(t *testing.T) {
+	lines := []string{
+		`a=1 b=2`,
+		`a= b=2`,
+		`a==b c=`,
+		`a="unterminated b=2`,
+		`a="x y"z=1 'q'=2`,
+		`a='' b="" c=3`,
+		`=1 _=2 9=3`,
+		`héllo=wörld k=v`,
+		"a=1\tb=2\r\nc=3",
+	}
+	rng := rand.New(rand.NewSource(1))
+	const chars = "ab_9=:\"' \t-é"
+	runes := []rune(chars)
+	for i := 0; i < 2000; i++ {
+		b := make([]rune, rng.Intn(24))
+		for j := range b {
+			b[j] = runes[rng.Intn(len(runes))]
+		}
+		lines = append(lines, string(b))
+	}
+
+	for _, sep := range []string{"=", ":", "=>", " "} {
+		p := NewKeyValueParser(WithKVSeparator(sep))
+		for _, line := range lines {
+			var got [][2]string
+			p.scanPairs(line, func(key, value string, start, end int) bool {
+				got = append(got, [2]string{key, value}, [2]string{line[start:end]})
+				return true
+			})
+			var want [][2]string
+			for _, m := range p.pattern.FindAllStringSubmatch(line, -1) {
+				want = append(want, [2]string{m[1], m[2] + m[3] + m[4]}, [2]string{m[0]})
+			}
+			if len(got) != len(want) {
+				t.Fatalf("sep %q, line %q: scanPairs = %q, pattern = %q", sep, line, got, want)
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Fatalf("sep %q, line %q: scanPairs = %q, pattern = %q", sep, line, got, want)
+				}
+			}
+		}
+	}
+}
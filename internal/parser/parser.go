@@ -1,13 +1,21 @@
 // Package parser provides interfaces and types for log parsing.
 package parser
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
 
 // Common errors returned by parsers.
 var (
 	ErrNoMatch     = errors.New("line does not match parser pattern")
 	ErrEmptyLine   = errors.New("empty line")
 	ErrInvalidData = errors.New("invalid data in line")
+
+	// ErrPanic is wrapped by the ParseError of a line a parser panicked
+	// on, with the panic's value: "panic: runtime error: ...".
+	ErrPanic = errors.New("panic")
 )
 
 // Entry represents a parsed log line with extracted fields.
@@ -21,17 +29,48 @@ type Entry struct {
 	// LineNum is the line number in the input stream (1-based).
 	LineNum int
 
+	// Format is the name of the parser that produced the entry, or empty
+	// if none did (an empty line, for one).
+	Format string
+
 	// ParseError contains any error that occurred during parsing.
 	// If set, Fields may be empty or partial.
 	ParseError error
 }
 
-// NewEntry creates a new Entry with initialized fields map.
+// maxPooledFields is the most fields an entry returned to the pool may
+// have held: the map keeps its size once cleared, and an unusually wide
+// entry would otherwise pin a large one for every entry after it.
+const maxPooledFields = 64
+
+// entryPool holds released entries, their fields maps cleared but still
+// sized for a typical line.
+var entryPool = sync.Pool{
+	New: func() any {
+		return &Entry{Fields: make(map[string]any)}
+	},
+}
+
+// NewEntry creates a new Entry with initialized fields map. The entry may
+// be one given back with Release.
 func NewEntry(raw string) *Entry {
-	return &Entry{
-		Fields: make(map[string]any),
-		Raw:    raw,
+	e := entryPool.Get().(*Entry)
+	e.Raw = raw
+	return e
+}
+
+// Release gives the entry back to be reused by NewEntry. The caller must
+// hold the only reference to it and to its fields map: neither may be
+// used after Release. Releasing is optional; an entry that is not
+// released is garbage collected as usual.
+func (e *Entry) Release() {
+	fields := e.Fields
+	if fields == nil || len(fields) > maxPooledFields {
+		return
 	}
+	clear(fields)
+	*e = Entry{Fields: fields}
+	entryPool.Put(e)
 }
 
 // Parser defines the interface that all log format parsers must implement.
@@ -54,3 +93,64 @@ type Parser interface {
 	// Even on error, Entry.Raw will contain the original line.
 	Parse(line string) (*Entry, error)
 }
+
+// FieldsParser is implemented by parsers that can skip extracting and
+// converting fields nobody reads, such as the capture groups --fields
+// leaves out of the output. ParseFields behaves like Parse, except that
+// the returned Entry holds only the fields in wanted (or raw, for a line
+// that does not match); a nil wanted keeps every field. See
+// Registry.WantFields.
+type FieldsParser interface {
+	ParseFields(line string, wanted map[string]bool) (*Entry, error)
+}
+
+// wants reports whether a field belongs in an entry limited to wanted.
+func wants(wanted map[string]bool, name string) bool {
+	return wanted == nil || wanted[name]
+}
+
+// Scorer is implemented by parsers whose CanParse check is ambiguous.
+// Score returns how confident the parser is that it owns the line, from
+// 0 (cannot parse it) to 1 (certain). Auto-detection prefers the most
+// confident parser; a parser without Score is certain of every line its
+// CanParse accepts.
+type Scorer interface {
+	Score(line string) float64
+}
+
+// confidence returns p's score for line, falling back to CanParse. A
+// parser that panics cannot parse the line.
+func confidence(p Parser, line string) (c float64) {
+	defer func() {
+		if recover() != nil {
+			c = 0
+		}
+	}()
+	if s, ok := p.(Scorer); ok {
+		return s.Score(line)
+	}
+	if p.CanParse(line) {
+		return 1
+	}
+	return 0
+}
+
+// safeParse calls p.Parse, turning a panic into an entry whose ParseError
+// wraps ErrPanic, so that one pathological line, or a bug in a plugin,
+// fails alone instead of stopping the run.
+func safeParse(p Parser, line string) (entry *Entry, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			entry, err = panicEntry(line, v), nil
+		}
+	}()
+	return p.Parse(line)
+}
+
+// panicEntry returns the entry of a line a parser panicked on.
+func panicEntry(line string, v any) *Entry {
+	entry := NewEntry(line)
+	entry.Fields["raw"] = line
+	entry.ParseError = fmt.Errorf("%w: %v", ErrPanic, v)
+	return entry
+}
@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestEntry_Release(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields int
+	}{
+		{"typical entry", 8},
+		{"wide entry", maxPooledFields + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEntry("line")
+			for i := 0; i < tt.fields; i++ {
+				e.Fields[fmt.Sprint("f", i)] = i
+			}
+			e.LineNum, e.Format, e.ParseError = 7, "kv", ErrNoMatch
+			e.Release()
+
+			// Whichever entry comes next, reused or not, starts empty
+			next := NewEntry("next")
+			if len(next.Fields) != 0 || next.Raw != "next" || next.LineNum != 0 || next.Format != "" || next.ParseError != nil {
+				t.Errorf("NewEntry() after Release = %+v, want an empty entry", next)
+			}
+		})
+	}
+}
+
+func TestEntry_ReleaseWithoutFields(t *testing.T) {
+	// An entry built by hand may have no map; it is not pooled
+	(&Entry{}).Release()
+	if e := NewEntry(""); e.Fields == nil {
+		t.Error("NewEntry() returned an entry without a fields map")
+	}
+}
+
+func TestFieldsParser_MatchesParse(t *testing.T) {
+	mustParser := func(p Parser, err error) Parser {
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	parsers := []Parser{
+		NewApacheParser(),
+		NewApacheParser(WithApacheRegex()),
+		NewApacheParser(WithApacheVariant(ApacheVHostCombined)),
+		NewSyslogParser(),
+		NewSyslogParser(WithSyslogRegex()),
+		NewSyslogParser(WithMessageParsing()),
+		NewKeyValueParser(),
+		mustParser(NewRegexParser(`^(?P<level>\w+) (?P<code>\d+) (?P<message>.*)$`)),
+		mustParser(NewDissectParser(`%{level} %{code} %{message}`)),
+		mustParser(NewGrokParser(map[string]string{"WORD": `\w+`}, `%{WORD:level} %{WORD:code}`)),
+	}
+	lines := []string{
+		`192.168.1.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200 2326 "http://x/" "Mozilla/5.0"`,
+		`example.com:443 10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "POST /b HTTP/1.1" 500 - "-" "curl"`,
+		`Jan 15 10:30:45 web1 app[12]: user=bob action=login level=warn`,
+		`Jan 15 10:30:45 web1 app: {"level":"info","status":200}`,
+		`level=error status=500 message="upstream timed out" latency=1.5`,
+		`error 42 disk full`,
+		`free text`,
+		``,
+	}
+	wanted := []map[string]bool{
+		{},
+		{"status": true},
+		{"level": true, "message": true},
+		{"host": true, "user": true, "pid": true},
+		{"missing": true},
+	}
+
+	for _, p := range parsers {
+		fp, ok := p.(FieldsParser)
+		if !ok {
+			t.Fatalf("%T does not implement FieldsParser", p)
+		}
+		for _, line := range lines {
+			full, err := p.Parse(line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range wanted {
+				want := make(map[string]any)
+				for k, v := range full.Fields {
+					if w[k] || full.ParseError != nil {
+						want[k] = v
+					}
+				}
+				got, err := fp.ParseFields(line, w)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got.Fields, want) || got.ParseError != full.ParseError {
+					t.Errorf("%T.ParseFields(%q, %v) = %v (%v), want %v (%v)", p, line, w, got.Fields, got.ParseError, want, full.ParseError)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/juliosaraiva/log2json/internal/yaml"
+)
+
+// LoadPatterns reads a patterns file defining named regex, dissect or
+// grok parsers, so that format definitions can be shared instead of passed as
+// long --pattern flags:
+//
+//	patterns:
+//	  myapp:
+//	    description: My app's logs
+//	    regex: '^(?P<time>\S+) \[(?P<level>\w+)\] (?P<msg>.*)$'
+//	    priority: 10
+//	  nginx-error:
+//	    dissect: '%{date} %{time} [%{level}] %{pid}#%{tid}: %{message}'
+//
+// Each pattern has one of a regex, a dissect pattern (see DissectParser)
+// or a grok pattern (see GrokParser), which may define grok_patterns of
+// its own. regex and grok also take a list of patterns, tried in order
+// until one matches, for applications logging several line shapes. Parsers are returned highest priority first (the
+// default is 0), then by name.
+func LoadPatterns(path string) ([]Parser, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := yaml.Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	root, ok := doc.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected a mapping with a patterns key", path)
+	}
+	for key := range root {
+		if key != "patterns" {
+			return nil, fmt.Errorf("%s: unknown key %q", path, key)
+		}
+	}
+	defs, ok := root["patterns"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: patterns must map names to definitions", path)
+	}
+
+	parsers := make([]*patternParser, 0, len(defs))
+	for name, def := range defs {
+		p, err := newPatternParser(name, def)
+		if err != nil {
+			return nil, fmt.Errorf("%s: pattern %q: %w", path, name, err)
+		}
+		parsers = append(parsers, p)
+	}
+	return byPriority(parsers), nil
+}
+
+// LoadFormatsDirs reads the format definitions in the *.yaml and *.yml
+// files of dirs, one format per file, so that installed formats extend
+// the built-in ones:
+//
+//	# ~/.config/log2json/formats/myapp.yaml
+//	description: My app's logs
+//	grok: '%{TIMESTAMP_ISO8601:time} \[%{LOGLEVEL:level}\] %{GREEDYDATA:msg}'
+//	priority: 10
+//
+// A definition has the keys of a patterns file entry (see LoadPatterns)
+// and an optional name, which defaults to the file name without its
+// extension. Names must be unique across dirs. Parsers are returned
+// highest priority first, then by name.
+func LoadFormatsDirs(dirs ...string) ([]Parser, error) {
+	var parsers []*patternParser
+	paths := make(map[string]string)
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			ext := filepath.Ext(e.Name())
+			if e.IsDir() || (ext != ".yaml" && ext != ".yml") {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			p, err := loadFormatFile(path, strings.TrimSuffix(e.Name(), ext))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			if other, ok := paths[p.name]; ok {
+				return nil, fmt.Errorf("%s: format %q is already defined in %s", path, p.name, other)
+			}
+			paths[p.name] = path
+			parsers = append(parsers, p)
+		}
+	}
+	return byPriority(parsers), nil
+}
+
+func loadFormatFile(path, name string) (*patternParser, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := yaml.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	def, ok := doc.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a mapping")
+	}
+	if v, ok := def["name"]; ok {
+		if name, err = stringValue("name", v); err != nil {
+			return nil, err
+		}
+		delete(def, "name")
+	}
+	return newPatternParser(name, def)
+}
+
+// byPriority sorts parsers highest priority first, then by name.
+func byPriority(parsers []*patternParser) []Parser {
+	sort.Slice(parsers, func(i, j int) bool {
+		if parsers[i].priority != parsers[j].priority {
+			return parsers[i].priority > parsers[j].priority
+		}
+		return parsers[i].name < parsers[j].name
+	})
+
+	result := make([]Parser, len(parsers))
+	for i, p := range parsers {
+		result[i] = p
+	}
+	return result
+}
+
+// patternParser gives a regex, dissect or grok parser from a patterns
+// file or format definition its name, description and priority.
+type patternParser struct {
+	Parser
+	name        string
+	description string
+	priority    int64
+}
+
+func newPatternParser(name string, def any) (*patternParser, error) {
+	fields, ok := def.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a mapping")
+	}
+	if strings.TrimSpace(name) == "" || strings.ContainsAny(name, " ,") {
+		return nil, fmt.Errorf("name must be a single word")
+	}
+
+	p := &patternParser{name: name}
+	var dissect string
+	var regex, grok []string
+	var grokDefs map[string]string
+	for key, v := range fields {
+		var err error
+		switch key {
+		case "description":
+			p.description, err = stringValue(key, v)
+		case "regex":
+			regex, err = stringValues(key, v)
+		case "dissect":
+			dissect, err = stringValue(key, v)
+		case "grok":
+			grok, err = stringValues(key, v)
+		case "grok_patterns":
+			grokDefs, err = stringMap(key, v)
+		case "priority":
+			n, ok := v.(int64)
+			if !ok {
+				err = fmt.Errorf("priority must be an integer")
+			}
+			p.priority = n
+		default:
+			err = fmt.Errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var set []string
+	for key, given := range map[string]bool{"regex": regex != nil, "dissect": dissect != "", "grok": grok != nil} {
+		if given {
+			set = append(set, key)
+		}
+	}
+	if len(set) > 1 {
+		sort.Strings(set)
+		return nil, fmt.Errorf("%s and %s cannot both be set", set[0], set[1])
+	}
+	if grokDefs != nil && grok == nil {
+		return nil, fmt.Errorf("grok_patterns requires grok")
+	}
+
+	var err error
+	switch {
+	case regex != nil:
+		p.Parser, err = NewRegexParser(regex...)
+	case dissect != "":
+		p.Parser, err = NewDissectParser(dissect)
+	case grok != nil:
+		p.Parser, err = NewGrokParser(grokDefs, grok...)
+	default:
+		return nil, fmt.Errorf("regex, dissect or grok is required")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.description == "" {
+		p.description = p.Parser.Description()
+	}
+	return p, nil
+}
+
+func stringValue(key string, v any) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string", key)
+	}
+	return s, nil
+}
+
+// stringValues accepts a string or a non-empty list of strings.
+func stringValues(key string, v any) ([]string, error) {
+	if s, ok := v.(string); ok {
+		return []string{s}, nil
+	}
+	items, ok := v.([]any)
+	if !ok || len(items) == 0 {
+		return nil, fmt.Errorf("%s must be a string or a list of strings", key)
+	}
+	values := make([]string, len(items))
+	for i, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a string or a list of strings", key)
+		}
+		values[i] = s
+	}
+	return values, nil
+}
+
+func stringMap(key string, v any) (map[string]string, error) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must map names to strings", key)
+	}
+	result := make(map[string]string, len(m))
+	for k, item := range m {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: %s must be a string", key, k)
+		}
+		result[k] = s
+	}
+	return result, nil
+}
+
+// Name returns the pattern's name.
+func (p *patternParser) Name() string {
+	return p.name
+}
+
+// Description returns the pattern's description, or its regex, dissect
+// or grok pattern.
+func (p *patternParser) Description() string {
+	return p.description
+}
+
+// SetTypeInference configures the underlying parser.
+func (p *patternParser) SetTypeInference(ti TypeInference) {
+	if inf, ok := p.Parser.(typeInferrer); ok {
+		inf.SetTypeInference(ti)
+	}
+}
@@ -0,0 +1,212 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writePatterns(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "patterns.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPatterns(t *testing.T) {
+	path := writePatterns(t, `
+patterns:
+  low:
+    regex: '^(?P<msg>.*)$'
+  high:
+    description: High priority
+    dissect: '%{level} %{msg}'
+    priority: 10
+  also-low:
+    regex: '^(?P<a>\d+)$'
+`)
+
+	parsers, err := LoadPatterns(path)
+	if err != nil {
+		t.Fatalf("LoadPatterns() error: %v", err)
+	}
+
+	var names []string
+	for _, p := range parsers {
+		names = append(names, p.Name())
+	}
+	if got := strings.Join(names, ","); got != "high,also-low,low" {
+		t.Errorf("order = %s, want high,also-low,low", got)
+	}
+	if d := parsers[0].Description(); d != "High priority" {
+		t.Errorf("Description() = %q", d)
+	}
+	if d := parsers[2].Description(); !strings.Contains(d, "(?P<msg>.*)") {
+		t.Errorf("default Description() = %q, want the regex", d)
+	}
+
+	entry, err := parsers[0].Parse("INFO hello world")
+	if err != nil || entry.Fields["level"] != "INFO" || entry.Fields["msg"] != "hello world" {
+		t.Errorf("Parse() = %v, %v", entry.Fields, err)
+	}
+}
+
+func TestLoadPatterns_TypeInference(t *testing.T) {
+	parsers, err := LoadPatterns(writePatterns(t, "patterns:\n  n:\n    dissect: '%{id} %{code}'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRegistry(WithForcedFormat("n"), WithTypeInference(TypeInference{StringFields: map[string]bool{"id": true}}))
+	r.RegisterFirst(parsers[0])
+
+	entry, _ := r.Parse("007 200")
+	if entry.Fields["id"] != "007" || entry.Fields["code"] != int64(200) {
+		t.Errorf("fields = %v", entry.Fields)
+	}
+}
+
+func TestLoadPatterns_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "not a mapping", content: "- a", want: "patterns key"},
+		{name: "unknown top-level key", content: "formats: {}", want: `"formats"`},
+		{name: "no pattern", content: "patterns:\n  a:\n    priority: 1", want: "regex, dissect or grok"},
+		{name: "both patterns", content: "patterns:\n  a:\n    regex: '(?P<x>.)'\n    dissect: '%{x}'", want: "both"},
+		{name: "grok and regex", content: "patterns:\n  a:\n    regex: '(?P<x>.)'\n    grok: '%{WORD:x}'", want: "both"},
+		{name: "grok_patterns without grok", content: "patterns:\n  a:\n    regex: '(?P<x>.)'\n    grok_patterns: {A: x}", want: "requires grok"},
+		{name: "unknown grok pattern", content: "patterns:\n  a:\n    grok: '%{NOPE:x}'", want: "NOPE"},
+		{name: "empty regex list", content: "patterns:\n  a:\n    regex: []", want: "list of strings"},
+		{name: "bad regex in list", content: "patterns:\n  a:\n    regex:\n      - '(?P<x>.)'\n      - '(?P<y>'", want: "pattern 2"},
+		{name: "bad regex", content: "patterns:\n  a:\n    regex: '(?P<x>'", want: `pattern "a"`},
+		{name: "bad priority", content: "patterns:\n  a:\n    regex: '(?P<x>.)'\n    priority: high", want: "priority"},
+		{name: "unknown key", content: "patterns:\n  a:\n    regexp: '(?P<x>.)'", want: `"regexp"`},
+		{name: "bad name", content: "patterns:\n  a b:\n    regex: '(?P<x>.)'", want: "single word"},
+		{name: "bad yaml", content: "patterns:\n  a: [", want: "line 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadPatterns(writePatterns(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadPatterns() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadPatterns_Grok(t *testing.T) {
+	parsers, err := LoadPatterns(writePatterns(t, `
+patterns:
+  app:
+    grok: '%{APPID:app} %{LOGLEVEL:level} %{GREEDYDATA:msg}'
+    grok_patterns:
+      APPID: 'app-\d+'
+`))
+	if err != nil {
+		t.Fatalf("LoadPatterns() error: %v", err)
+	}
+	entry, err := parsers[0].Parse("app-7 WARN disk almost full")
+	if err != nil || entry.Fields["app"] != "app-7" || entry.Fields["level"] != "WARN" || entry.Fields["msg"] != "disk almost full" {
+		t.Errorf("Parse() = %v, %v", entry.Fields, err)
+	}
+	if d := parsers[0].Description(); !strings.Contains(d, "%{APPID:app}") {
+		t.Errorf("default Description() = %q, want the grok pattern", d)
+	}
+}
+
+func TestLoadPatterns_List(t *testing.T) {
+	parsers, err := LoadPatterns(writePatterns(t, `
+patterns:
+  app:
+    regex:
+      - '^(?P<level>INFO|WARN|ERROR) (?P<msg>.*)$'
+      - '^(?P<method>GET|POST) (?P<path>\S+)$'
+`))
+	if err != nil {
+		t.Fatalf("LoadPatterns() error: %v", err)
+	}
+
+	entry, err := parsers[0].Parse("POST /login")
+	if err != nil || entry.ParseError != nil || entry.Fields["path"] != "/login" {
+		t.Errorf("Parse() = %v, %v", entry.Fields, entry.ParseError)
+	}
+	entry, _ = parsers[0].Parse("INFO ready")
+	if entry.Fields["level"] != "INFO" {
+		t.Errorf("Parse() = %v", entry.Fields)
+	}
+}
+
+func writeFormat(t *testing.T, dir, file, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadFormatsDirs(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	writeFormat(t, first, "myapp.yaml", "grok: '%{LOGLEVEL:level} %{GREEDYDATA:msg}'\n")
+	writeFormat(t, first, "other.yml", "name: renamed\ndescription: Renamed\nregex: '^(?P<a>\\d+)$'\npriority: 5\n")
+	writeFormat(t, first, "README.md", "not a format")
+	writeFormat(t, second, "nginx.yaml", "dissect: '%{date} %{time} [%{level}] %{message}'\n")
+
+	parsers, err := LoadFormatsDirs(first, second)
+	if err != nil {
+		t.Fatalf("LoadFormatsDirs() error: %v", err)
+	}
+	var names []string
+	for _, p := range parsers {
+		names = append(names, p.Name())
+	}
+	if got := strings.Join(names, ","); got != "renamed,myapp,nginx" {
+		t.Errorf("names = %s, want renamed,myapp,nginx", got)
+	}
+	if d := parsers[0].Description(); d != "Renamed" {
+		t.Errorf("Description() = %q", d)
+	}
+
+	entry, err := parsers[1].Parse("ERROR disk full")
+	if err != nil || entry.Fields["level"] != "ERROR" || entry.Fields["msg"] != "disk full" {
+		t.Errorf("Parse() = %v, %v", entry.Fields, err)
+	}
+}
+
+func TestLoadFormatsDirs_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{name: "not a mapping", files: map[string]string{"a.yaml": "- a"}, want: "a.yaml: expected a mapping"},
+		{name: "no pattern", files: map[string]string{"a.yaml": "priority: 1"}, want: "regex, dissect or grok"},
+		{name: "bad name", files: map[string]string{"a.yaml": "name: 1\nregex: '(?P<x>.)'"}, want: "name must be a string"},
+		{
+			name:  "duplicate name",
+			files: map[string]string{"a.yaml": "regex: '(?P<x>.)'", "b.yaml": "name: a\nregex: '(?P<x>.)'"},
+			want:  `format "a" is already defined`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for file, content := range tt.files {
+				writeFormat(t, dir, file, content)
+			}
+			_, err := LoadFormatsDirs(dir)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadFormatsDirs() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := LoadFormatsDirs(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("LoadFormatsDirs() of a missing directory expected error, got nil")
+	}
+}
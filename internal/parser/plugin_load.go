@@ -0,0 +1,30 @@
+//go:build (linux || darwin || freebsd) && cgo
+
+package parser
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// LoadPlugin opens a Go plugin (built with -buildmode=plugin) and returns
+// the parser created by its NewParser function.
+func LoadPlugin(path string) (Parser, error) {
+	plug, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := plug.Lookup(PluginSymbol)
+	if err != nil {
+		return nil, err
+	}
+	newParser, ok := sym.(func() any)
+	if !ok {
+		return nil, fmt.Errorf("%s: %s has type %T, want func() any", path, PluginSymbol, sym)
+	}
+	p, err := newPluginParser(newParser())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
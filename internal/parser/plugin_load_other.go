@@ -0,0 +1,14 @@
+//go:build !((linux || darwin || freebsd) && cgo)
+
+package parser
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// LoadPlugin reports that Go plugins are unavailable: the plugin package
+// needs cgo on Linux, macOS or FreeBSD.
+func LoadPlugin(path string) (Parser, error) {
+	return nil, fmt.Errorf("%s: Go plugins are not supported on %s or without cgo", path, runtime.GOOS)
+}
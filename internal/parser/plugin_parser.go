@@ -0,0 +1,75 @@
+package parser
+
+import "fmt"
+
+// PluginSymbol is the function a Go plugin must export to provide a
+// parser. It has the signature func() any and returns either a Parser or,
+// for plugins built outside this module (which cannot import an internal
+// package), a FieldParser.
+const PluginSymbol = "NewParser"
+
+// FieldParser is the parser interface for out-of-tree plugins. It mirrors
+// Parser but uses only standard types.
+type FieldParser interface {
+	Name() string
+	Description() string
+	CanParse(line string) bool
+
+	// ParseFields returns the fields extracted from the line, or nil if
+	// the line does not match.
+	ParseFields(line string) (map[string]any, error)
+}
+
+// fieldParser adapts a FieldParser to the Parser interface.
+type fieldParser struct {
+	FieldParser
+}
+
+// Score calls the plugin's Score method, if it has one (with the Scorer
+// signature, which needs only standard types).
+func (p fieldParser) Score(line string) float64 {
+	if s, ok := p.FieldParser.(Scorer); ok {
+		return s.Score(line)
+	}
+	if p.CanParse(line) {
+		return 1
+	}
+	return 0
+}
+
+// Parse calls the plugin's ParseFields.
+func (p fieldParser) Parse(line string) (*Entry, error) {
+	entry := NewEntry(line)
+
+	fields, err := p.ParseFields(line)
+	if err != nil {
+		entry.ParseError = err
+		entry.Fields["raw"] = line
+		return entry, nil
+	}
+	if fields == nil {
+		entry.ParseError = ErrNoMatch
+		entry.Fields["raw"] = line
+		return entry, nil
+	}
+
+	// Copied rather than adopted: the plugin may reuse its map, and the
+	// entry's own may be given back with Release
+	for k, v := range fields {
+		entry.Fields[k] = v
+	}
+	return entry, nil
+}
+
+// newPluginParser converts the value returned by a plugin's NewParser.
+func newPluginParser(v any) (Parser, error) {
+	switch p := v.(type) {
+	case Parser:
+		return p, nil
+	case FieldParser:
+		return fieldParser{p}, nil
+	case nil:
+		return nil, fmt.Errorf("%s returned nil", PluginSymbol)
+	}
+	return nil, fmt.Errorf("%s returned %T, which implements neither Parser nor FieldParser", PluginSymbol, v)
+}
@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// colonParser is a FieldParser for "key: value" lines.
+type colonParser struct{}
+
+func (colonParser) Name() string              { return "colon" }
+func (colonParser) Description() string       { return "key: value lines" }
+func (colonParser) CanParse(line string) bool { return strings.Contains(line, ": ") }
+func (colonParser) ParseFields(line string) (map[string]any, error) {
+	if line == "fail" {
+		return nil, errors.New("plugin failure")
+	}
+	k, v, ok := strings.Cut(line, ": ")
+	if !ok {
+		return nil, nil
+	}
+	return map[string]any{k: v}, nil
+}
+
+func TestNewPluginParser(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    any
+		wantName string
+		wantErr  bool
+	}{
+		{name: "parser", value: NewJSONParser(), wantName: "json"},
+		{name: "field parser", value: colonParser{}, wantName: "colon"},
+		{name: "nil", value: nil, wantErr: true},
+		{name: "wrong type", value: "parser", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newPluginParser(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newPluginParser() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && p.Name() != tt.wantName {
+				t.Errorf("Name() = %q, want %q", p.Name(), tt.wantName)
+			}
+		})
+	}
+}
+
+func TestFieldParser_Parse(t *testing.T) {
+	p, err := newPluginParser(colonParser{})
+	if err != nil {
+		t.Fatalf("newPluginParser() error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		line           string
+		wantFields     map[string]any
+		wantParseError bool
+	}{
+		{name: "match", line: "user: alice", wantFields: map[string]any{"user": "alice"}},
+		{name: "no match", line: "plain", wantFields: map[string]any{"raw": "plain"}, wantParseError: true},
+		{name: "error", line: "fail", wantFields: map[string]any{"raw": "fail"}, wantParseError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := p.Parse(tt.line)
+			if err != nil {
+				t.Fatalf("Parse() error: %v", err)
+			}
+			if (entry.ParseError != nil) != tt.wantParseError {
+				t.Errorf("ParseError = %v, wantParseError %v", entry.ParseError, tt.wantParseError)
+			}
+			if entry.Raw != tt.line {
+				t.Errorf("Raw = %q, want %q", entry.Raw, tt.line)
+			}
+			for k, v := range tt.wantFields {
+				if entry.Fields[k] != v {
+					t.Errorf("Fields[%q] = %v, want %v", k, entry.Fields[k], v)
+				}
+			}
+		})
+	}
+}
+
+// scoredColonParser is a colonParser that reports its own confidence.
+type scoredColonParser struct{ colonParser }
+
+func (scoredColonParser) Score(line string) float64 { return 0.25 }
+
+func TestFieldParser_Score(t *testing.T) {
+	tests := []struct {
+		name  string
+		value FieldParser
+		line  string
+		want  float64
+	}{
+		{name: "from CanParse", value: colonParser{}, line: "user: alice", want: 1},
+		{name: "from CanParse no match", value: colonParser{}, line: "plain", want: 0},
+		{name: "from plugin", value: scoredColonParser{}, line: "user: alice", want: 0.25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newPluginParser(tt.value)
+			if err != nil {
+				t.Fatalf("newPluginParser() error: %v", err)
+			}
+			if got := confidence(p, tt.line); got != tt.want {
+				t.Errorf("confidence(%q) = %v, want %v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadPlugin_Missing(t *testing.T) {
+	if _, err := LoadPlugin(t.TempDir() + "/missing.so"); err == nil {
+		t.Error("LoadPlugin() expected error for a missing file")
+	}
+}
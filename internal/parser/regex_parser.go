@@ -3,19 +3,43 @@ package parser
 import (
 	"fmt"
 	"regexp"
+	"strings"
 )
 
 // RegexParser handles custom user-defined patterns.
-// Users provide a regex with named capture groups like (?P<field>pattern).
+// Users provide a regex with named capture groups like (?P<field>pattern),
+// or several, tried in order, for applications logging lines of more than
+// one shape.
 type RegexParser struct {
-	pattern     *regexp.Regexp
-	patternText string
+	patterns     []*regexp.Regexp
+	patternTexts []string
+	inference    TypeInference
 }
 
-// NewRegexParser creates a parser from a custom regex pattern.
-// The pattern should use named capture groups: (?P<name>pattern)
-// Returns error if the pattern is invalid.
-func NewRegexParser(patternText string) (*RegexParser, error) {
+// NewRegexParser creates a parser from one or more custom regex patterns,
+// tried in order until one matches.
+// Each pattern should use named capture groups: (?P<name>pattern)
+// Returns error if there is no pattern or one is invalid.
+func NewRegexParser(patternTexts ...string) (*RegexParser, error) {
+	if len(patternTexts) == 0 {
+		return nil, fmt.Errorf("at least one pattern is required")
+	}
+
+	p := &RegexParser{patternTexts: patternTexts}
+	for i, patternText := range patternTexts {
+		pattern, err := compileRegexPattern(patternText)
+		if err != nil {
+			if len(patternTexts) > 1 {
+				return nil, fmt.Errorf("pattern %d: %w", i+1, err)
+			}
+			return nil, err
+		}
+		p.patterns = append(p.patterns, pattern)
+	}
+	return p, nil
+}
+
+func compileRegexPattern(patternText string) (*regexp.Regexp, error) {
 	// Validate pattern compiles
 	pattern, err := regexp.Compile(patternText)
 	if err != nil {
@@ -34,11 +58,7 @@ func NewRegexParser(patternText string) (*RegexParser, error) {
 	if !hasNamedGroup {
 		return nil, fmt.Errorf("pattern must have at least one named group: (?P<name>...)")
 	}
-
-	return &RegexParser{
-		pattern:     pattern,
-		patternText: patternText,
-	}, nil
+	return pattern, nil
 }
 
 // Name returns the parser identifier.
@@ -48,33 +68,55 @@ func (p *RegexParser) Name() string {
 
 // Description returns a human-readable description.
 func (p *RegexParser) Description() string {
-	return fmt.Sprintf("Custom regex pattern: %s", p.patternText)
+	if len(p.patternTexts) == 1 {
+		return fmt.Sprintf("Custom regex pattern: %s", p.patternTexts[0])
+	}
+	return fmt.Sprintf("Custom regex patterns: %s", strings.Join(p.patternTexts, " ; "))
+}
+
+// SetTypeInference configures which values are converted from strings.
+func (p *RegexParser) SetTypeInference(ti TypeInference) {
+	p.inference = ti
 }
 
-// CanParse checks if the line matches the custom pattern.
+// CanParse checks if the line matches one of the custom patterns.
 func (p *RegexParser) CanParse(line string) bool {
-	return p.pattern.MatchString(line)
+	for _, pattern := range p.patterns {
+		if pattern.MatchString(line) {
+			return true
+		}
+	}
+	return false
 }
 
-// Parse extracts named groups from the log line.
+// Parse extracts named groups from the log line, using the first pattern
+// that matches.
 func (p *RegexParser) Parse(line string) (*Entry, error) {
-	entry := NewEntry(line)
+	return p.ParseFields(line, nil)
+}
 
-	matches := p.pattern.FindStringSubmatch(line)
-	if matches == nil {
-		entry.ParseError = ErrNoMatch
-		entry.Fields["raw"] = line
-		return entry, nil
-	}
+// ParseFields is like Parse, converting and storing only the wanted
+// groups.
+func (p *RegexParser) ParseFields(line string, wanted map[string]bool) (*Entry, error) {
+	entry := NewEntry(line)
 
-	names := p.pattern.SubexpNames()
-	for i, match := range matches {
-		if i == 0 || names[i] == "" {
+	for _, pattern := range p.patterns {
+		matches := pattern.FindStringSubmatch(line)
+		if matches == nil {
 			continue
 		}
-		// Try to infer type for numeric values
-		entry.Fields[names[i]] = inferType(match)
+		names := pattern.SubexpNames()
+		for i, match := range matches {
+			if i == 0 || names[i] == "" || !wants(wanted, names[i]) {
+				continue
+			}
+			// Try to infer type for numeric values
+			entry.Fields[names[i]] = p.inference.value(names[i], match)
+		}
+		return entry, nil
 	}
 
+	entry.ParseError = ErrNoMatch
+	entry.Fields["raw"] = line
 	return entry, nil
 }
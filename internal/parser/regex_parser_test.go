@@ -2,6 +2,8 @@ package parser
 
 import (
 	"errors"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -168,3 +170,45 @@ func TestRegexParser_Parse(t *testing.T) {
 		})
 	}
 }
+
+func TestRegexParser_Patterns(t *testing.T) {
+	p, err := NewRegexParser(
+		`^(?P<level>INFO|ERROR) (?P<message>.+)$`,
+		`^(?P<method>GET|POST) (?P<path>\S+) (?P<status>\d+)$`,
+		`^(?P<message>.+)$`,
+	)
+	if err != nil {
+		t.Fatalf("NewRegexParser() error: %v", err)
+	}
+
+	tests := []struct {
+		line string
+		want map[string]any
+	}{
+		{line: "ERROR disk full", want: map[string]any{"level": "ERROR", "message": "disk full"}},
+		{line: "GET /health 200", want: map[string]any{"method": "GET", "path": "/health", "status": int64(200)}},
+		{line: "anything else", want: map[string]any{"message": "anything else"}},
+	}
+	for _, tt := range tests {
+		if !p.CanParse(tt.line) {
+			t.Errorf("CanParse(%q) = false", tt.line)
+		}
+		entry, err := p.Parse(tt.line)
+		if err != nil || entry.ParseError != nil {
+			t.Fatalf("Parse(%q) = %v, %v", tt.line, err, entry.ParseError)
+		}
+		if !reflect.DeepEqual(entry.Fields, tt.want) {
+			t.Errorf("Parse(%q) = %v, want %v (first matching pattern only)", tt.line, entry.Fields, tt.want)
+		}
+	}
+}
+
+func TestNewRegexParser_Patterns_Errors(t *testing.T) {
+	if _, err := NewRegexParser(); err == nil {
+		t.Error("NewRegexParser() with no pattern: expected error, got nil")
+	}
+	_, err := NewRegexParser(`(?P<a>\w+)`, `(\w+)`)
+	if err == nil || !strings.Contains(err.Error(), "pattern 2") {
+		t.Errorf("NewRegexParser() error = %v, want it to name pattern 2", err)
+	}
+}
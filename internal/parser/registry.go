@@ -2,27 +2,75 @@ package parser
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"sync/atomic"
 )
 
+// DefaultSampleSize is the number of lines auto-detection looks at before
+// choosing a format. See Registry.Detect.
+const DefaultSampleSize = 20
+
 // Registry manages parser registration and format auto-detection.
 // It maintains an ordered list of parsers and can automatically
 // detect the appropriate parser for a log line.
+//
+// Parse, Detect and Stats are safe for concurrent use, so goroutines can
+// share one registry. Register, RegisterFirst and Select are not; set up
+// the parsers before sharing it.
 type Registry struct {
 	// parsers holds all registered parsers in priority order.
 	parsers []Parser
 
 	// cached stores the auto-detected parser after first successful match.
 	// Used in strict mode to avoid re-detection on every line.
-	cached Parser
+	cached atomic.Pointer[Parser]
 
 	// adaptive determines detection behavior:
 	// - true: re-detect format for each line (mixed formats)
 	// - false: cache first detected format (strict mode, default)
 	adaptive bool
 
+	// redetectAfter is the number of consecutive lines the cached parser
+	// may fail before detection runs again; 0 never re-detects.
+	redetectAfter int64
+
+	// misses counts the cached parser's consecutive failures.
+	misses atomic.Int64
+
 	// forcedFormat specifies a parser by name, skipping auto-detection.
 	forcedFormat string
+
+	// fallback names the parser for lines no parser claims; empty means
+	// they are returned unparsed with ErrNoMatch.
+	fallback string
+
+	// inference is applied to every registered parser that supports it.
+	inference *TypeInference
+
+	// builtins replace the default built-in parsers of the same name.
+	builtins map[string]Parser
+
+	// wanted limits the fields FieldsParsers extract; nil extracts all.
+	wanted map[string]bool
+
+	// counters holds each registered parser's statistics, by name.
+	counters map[string]*parserCounters
+}
+
+// ParserStats counts the lines a parser was given by Parse (detection
+// samples are not counted): Matched were parsed cleanly, Failed came back
+// with a ParseError. Lines a parser turned down in auto-detection without
+// parsing them are not attempts.
+type ParserStats struct {
+	Name      string
+	Attempted int64
+	Matched   int64
+	Failed    int64
+}
+
+type parserCounters struct {
+	attempted, matched, failed atomic.Int64
 }
 
 // RegistryOption configures the Registry.
@@ -36,6 +84,15 @@ func WithAdaptiveMode() RegistryOption {
 	}
 }
 
+// WithRedetectAfter makes strict mode re-detect the format once the
+// cached parser fails n lines in a row, so a stream whose format changes
+// recovers without adaptive mode's per-line detection. 0 disables it.
+func WithRedetectAfter(n int) RegistryOption {
+	return func(r *Registry) {
+		r.redetectAfter = int64(n)
+	}
+}
+
 // WithForcedFormat specifies a parser by name, skipping auto-detection.
 func WithForcedFormat(format string) RegistryOption {
 	return func(r *Registry) {
@@ -43,11 +100,43 @@ func WithForcedFormat(format string) RegistryOption {
 	}
 }
 
+// WithFallback sets the parser, by name, for lines that no parser claims
+// during auto-detection. The default is "generic", which wraps them as a
+// message; an empty name returns them with ErrNoMatch and a raw field, so
+// that detection failures show.
+func WithFallback(name string) RegistryOption {
+	return func(r *Registry) {
+		r.fallback = strings.ToLower(name)
+	}
+}
+
+// WithBuiltin replaces the built-in parser of the same name, keeping its
+// place in the detection order; use it to register a tuned parser, such
+// as NewKeyValueParser(WithKVSeparator(":")).
+func WithBuiltin(p Parser) RegistryOption {
+	return func(r *Registry) {
+		if r.builtins == nil {
+			r.builtins = make(map[string]Parser)
+		}
+		r.builtins[p.Name()] = p
+	}
+}
+
+// WithTypeInference configures type inference for parsers that convert
+// extracted strings (kv, regex), including parsers registered later.
+func WithTypeInference(ti TypeInference) RegistryOption {
+	return func(r *Registry) {
+		r.inference = &ti
+	}
+}
+
 // NewRegistry creates a new parser registry with default parsers.
-// Parsers are registered in priority order (first match wins).
+// Parsers are registered in priority order, which breaks ties between
+// equally confident parsers.
 func NewRegistry(opts ...RegistryOption) *Registry {
 	r := &Registry{
-		parsers: make([]Parser, 0),
+		parsers:  make([]Parser, 0),
+		fallback: "generic",
 	}
 
 	// Apply options
@@ -57,19 +146,108 @@ func NewRegistry(opts ...RegistryOption) *Registry {
 
 	// Register built-in parsers in priority order.
 	// JSON first (already structured), then more specific formats.
-	r.Register(NewJSONParser())
-	r.Register(NewKeyValueParser())
-	r.Register(NewSyslogParser())
-	r.Register(NewApacheParser())
-	r.Register(NewGenericParser())
+	for _, p := range []Parser{
+		NewJSONParser(),
+		NewKeyValueParser(),
+		NewSyslogParser(),
+		NewApacheParser(),
+		NewGenericParser(),
+	} {
+		if tuned, ok := r.builtins[p.Name()]; ok {
+			p = tuned
+		}
+		r.Register(p)
+	}
 
 	return r
 }
 
 // Register adds a parser to the registry.
-// Parsers are tried in the order they are registered.
+// Parsers are ranked by confidence, then by the order they are registered.
 func (r *Registry) Register(p Parser) {
+	if ti, ok := p.(typeInferrer); ok && r.inference != nil {
+		ti.SetTypeInference(*r.inference)
+	}
 	r.parsers = append(r.parsers, p)
+	r.track(p)
+}
+
+// RegisterFirst adds a parser ahead of all registered parsers, so
+// auto-detection tries it before the built-in formats.
+func (r *Registry) RegisterFirst(p Parser) {
+	if ti, ok := p.(typeInferrer); ok && r.inference != nil {
+		ti.SetTypeInference(*r.inference)
+	}
+	r.parsers = append([]Parser{p}, r.parsers...)
+	r.track(p)
+}
+
+func (r *Registry) track(p Parser) {
+	if r.counters == nil {
+		r.counters = make(map[string]*parserCounters)
+	}
+	if r.counters[p.Name()] == nil {
+		r.counters[p.Name()] = &parserCounters{}
+	}
+}
+
+// Stats returns the statistics of the registered parsers, in detection
+// order.
+func (r *Registry) Stats() []ParserStats {
+	stats := make([]ParserStats, len(r.parsers))
+	for i, p := range r.parsers {
+		c := r.counters[p.Name()]
+		stats[i] = ParserStats{
+			Name:      p.Name(),
+			Attempted: c.attempted.Load(),
+			Matched:   c.matched.Load(),
+			Failed:    c.failed.Load(),
+		}
+	}
+	return stats
+}
+
+// Select keeps only the named parsers, in the order given, which breaks
+// ties between equally confident parsers. Leaving out "generic" also
+// leaves lines no format claims without the default fallback.
+func (r *Registry) Select(names []string) error {
+	selected := make([]Parser, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = strings.ToLower(name)
+		p := r.GetParser(name)
+		if p == nil {
+			return fmt.Errorf("unknown format %q", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("format %q listed more than once", name)
+		}
+		seen[name] = true
+		selected = append(selected, p)
+	}
+	if len(selected) == 0 {
+		return fmt.Errorf("no formats selected")
+	}
+	r.parsers = selected
+	r.cached.Store(nil)
+	r.misses.Store(0)
+	return nil
+}
+
+// WantFields limits the fields parsers that implement FieldsParser
+// extract to the named ones; the others are neither sliced from the line
+// nor converted. Only lines are affected, not Detect or Explain. Use it
+// when nothing reads an entry's fields but an output limited to these
+// fields; no fields restores full parsing.
+func (r *Registry) WantFields(fields []string) {
+	if len(fields) == 0 {
+		r.wanted = nil
+		return
+	}
+	r.wanted = make(map[string]bool, len(fields))
+	for _, f := range fields {
+		r.wanted[f] = true
+	}
 }
 
 // GetParser returns the parser for the given format name.
@@ -101,6 +279,56 @@ func (r *Registry) ListParsers() []struct {
 	return result
 }
 
+// AutoDetects reports whether the registry picks the format from the
+// input: no format is forced and adaptive mode is off.
+func (r *Registry) AutoDetects() bool {
+	return r.forcedFormat == "" && !r.adaptive
+}
+
+// Detect scores every parser against a sample of lines and caches the
+// best one for the lines that follow, so that a banner or a stray line
+// at the start of a stream cannot lock it to the wrong format. A parser
+// scores its confidence (see Scorer) for each line it parses without
+// error, and must parse most of the sample; ties go to the parser
+// registered first. The generic parser, which accepts anything, is left
+// to the per-line fallback. Returns the chosen parser, or nil if none
+// qualifies, in which case detection goes on line by line.
+func (r *Registry) Detect(sample []string) Parser {
+	lines := make([]string, 0, len(sample))
+	for _, line := range sample {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	var best Parser
+	var bestScore float64
+	for _, p := range r.parsers {
+		if p.Name() == "generic" {
+			continue
+		}
+		parsed, score := 0, 0.0
+		for _, line := range lines {
+			c := confidence(p, line)
+			if c <= 0 {
+				continue
+			}
+			if entry, err := safeParse(p, line); err == nil && entry.ParseError == nil {
+				parsed++
+				score += c
+			}
+		}
+		if parsed > len(lines)/2 && score > bestScore {
+			best, bestScore = p, score
+		}
+	}
+	if best != nil {
+		r.cached.Store(&best)
+		r.misses.Store(0)
+	}
+	return best
+}
+
 // Parse parses a log line using the appropriate parser.
 // Uses forced format if specified, otherwise auto-detects.
 func (r *Registry) Parse(line string) (*Entry, error) {
@@ -117,37 +345,106 @@ func (r *Registry) Parse(line string) (*Entry, error) {
 		if parser == nil {
 			return nil, fmt.Errorf("unknown format: %s", r.forcedFormat)
 		}
-		return parser.Parse(line)
+		return r.parseWith(parser, line)
 	}
 
 	// Use cached parser in strict mode
-	if !r.adaptive && r.cached != nil {
-		return r.cached.Parse(line)
+	if cached := r.cached.Load(); !r.adaptive && cached != nil {
+		entry, err := r.parseWith(*cached, line)
+		if err == nil && entry.ParseError == nil {
+			r.misses.Store(0)
+			return entry, nil
+		}
+		if r.redetectAfter == 0 || r.misses.Add(1) < r.redetectAfter {
+			return entry, err
+		}
+		// Too many failures in a row: detect again, starting with this line
+		r.misses.Store(0)
+		r.cached.CompareAndSwap(cached, nil)
 	}
 
-	// Auto-detect: try each parser until one succeeds
-	for _, p := range r.parsers {
-		if p.CanParse(line) {
-			entry, err := p.Parse(line)
-			if err == nil && entry.ParseError == nil {
-				// Cache successful parser in strict mode
-				if !r.adaptive && r.cached == nil {
-					r.cached = p
-				}
-				return entry, nil
+	// Auto-detect: try parsers from the most to the least confident
+	for _, p := range r.rank(line) {
+		entry, err := r.parseWith(p, line)
+		if err == nil && entry.ParseError == nil {
+			// Cache successful parser in strict mode; when lines race,
+			// the first to finish wins
+			if !r.adaptive {
+				r.cached.CompareAndSwap(nil, &p)
 			}
+			return entry, nil
+		}
+		if entry != nil {
+			entry.Release()
 		}
 	}
 
-	// Fallback: use generic parser (always succeeds)
-	generic := r.GetParser("generic")
-	if generic != nil {
-		return generic.Parse(line)
+	// Fallback: generic by default, which always succeeds
+	if fallback := r.GetParser(r.fallback); fallback != nil {
+		return r.parseWith(fallback, line)
 	}
 
-	// Last resort: wrap as raw
+	// No fallback: wrap as raw
 	entry := NewEntry(line)
 	entry.Fields["raw"] = line
 	entry.ParseError = ErrNoMatch
 	return entry, nil
 }
+
+// parseWith parses line with p, records p as the entry's format and
+// counts the attempt.
+func (r *Registry) parseWith(p Parser, line string) (*Entry, error) {
+	entry, err := r.call(p, line)
+	if entry != nil {
+		entry.Format = p.Name()
+	}
+
+	if c := r.counters[p.Name()]; c != nil {
+		c.attempted.Add(1)
+		if err == nil && entry.ParseError == nil {
+			c.matched.Add(1)
+		} else {
+			c.failed.Add(1)
+		}
+	}
+	return entry, err
+}
+
+// call has p parse line, extracting only the wanted fields if it can. A
+// panic in p becomes an entry whose ParseError wraps ErrPanic, as in
+// safeParse.
+func (r *Registry) call(p Parser, line string) (entry *Entry, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			entry, err = panicEntry(line, v), nil
+		}
+	}()
+	if fp, ok := p.(FieldsParser); ok && r.wanted != nil {
+		return fp.ParseFields(line, r.wanted)
+	}
+	return p.Parse(line)
+}
+
+// rank returns the parsers that may handle line, most confident first.
+// Parsers with equal confidence keep their registration order.
+func (r *Registry) rank(line string) []Parser {
+	type candidate struct {
+		parser Parser
+		score  float64
+	}
+	candidates := make([]candidate, 0, len(r.parsers))
+	for _, p := range r.parsers {
+		if score := confidence(p, line); score > 0 {
+			candidates = append(candidates, candidate{p, score})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	ranked := make([]Parser, len(candidates))
+	for i, c := range candidates {
+		ranked[i] = c.parser
+	}
+	return ranked
+}
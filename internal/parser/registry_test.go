@@ -2,7 +2,10 @@ package parser
 
 import (
 	"errors"
+	"fmt"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -104,6 +107,105 @@ func TestRegistry_Parse_AutoDetect(t *testing.T) {
 	}
 }
 
+func TestRegistry_Parse_Confidence(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want map[string]any // fields that must be present with these values
+	}{
+		{
+			name: "syslog with key=value message",
+			line: "Jan 15 10:30:45 web1 app[12]: user=bob action=login",
+			want: map[string]any{"host": "web1", "program": "app", "message": "user=bob action=login"},
+		},
+		{
+			name: "logfmt",
+			line: `ts=2024-01-15T10:30:45Z level=info msg="user logged in"`,
+			want: map[string]any{"level": "info", "msg": "user logged in"},
+		},
+		{
+			name: "timestamp and level with a few pairs",
+			line: "2024-01-15 10:30:45 INFO request done user=bob status=200",
+			want: map[string]any{"level": "INFO", "message": "request done user=bob status=200"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := NewRegistry(WithAdaptiveMode()).Parse(tt.line)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tt.line, err)
+			}
+			for k, v := range tt.want {
+				if entry.Fields[k] != v {
+					t.Errorf("Parse(%q): %s = %v, want %v (fields: %v)", tt.line, k, entry.Fields[k], v, entry.Fields)
+				}
+			}
+		})
+	}
+}
+
+func TestRegistry_Parse_Format(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []RegistryOption
+		line string
+		want string
+	}{
+		{name: "detected", line: `{"a":1}`, want: "json"},
+		{name: "fallback", line: "just text", want: "generic"},
+		{name: "forced", opts: []RegistryOption{WithForcedFormat("KV")}, line: "a=1 b=2", want: "kv"},
+		{name: "empty line", line: "  ", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := NewRegistry(tt.opts...).Parse(tt.line)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tt.line, err)
+			}
+			if entry.Format != tt.want {
+				t.Errorf("Parse(%q): Format = %q, want %q", tt.line, entry.Format, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistry_Parse_Fallback(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           []RegistryOption
+		wantField      string
+		wantParseError bool
+	}{
+		{name: "generic", wantField: "message"},
+		{name: "none", opts: []RegistryOption{WithFallback("")}, wantField: "raw", wantParseError: true},
+		{name: "json", opts: []RegistryOption{WithFallback("JSON")}, wantField: "raw", wantParseError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry(tt.opts...)
+			entry, err := r.Parse("just some text")
+			if err != nil {
+				t.Fatalf("Parse returned error: %v", err)
+			}
+			if (entry.ParseError != nil) != tt.wantParseError {
+				t.Errorf("ParseError = %v, wantParseError %v", entry.ParseError, tt.wantParseError)
+			}
+			if entry.Fields[tt.wantField] != "just some text" {
+				t.Errorf("Fields = %v, want %s set to the line", entry.Fields, tt.wantField)
+			}
+
+			// The fallback does not lock the stream to a format
+			entry, _ = r.Parse(`{"a":1}`)
+			if entry.Format != "json" {
+				t.Errorf("next line parsed by %q, want json", entry.Format)
+			}
+		})
+	}
+}
+
 func TestRegistry_Parse_EmptyLine(t *testing.T) {
 	r := NewRegistry()
 
@@ -223,6 +325,77 @@ func TestRegistry_Parse_AdaptiveMode(t *testing.T) {
 	}
 }
 
+func TestRegistry_Detect(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample []string
+		want   string // "" for no choice
+	}{
+		{
+			name:   "json banner before kv",
+			sample: []string{`{"banner":"app v1.2 starting"}`, "level=info msg=a", "level=warn msg=b", "level=info msg=c"},
+			want:   "kv",
+		},
+		{
+			name:   "syslog",
+			sample: []string{"Jan 15 10:30:45 host sshd[1]: a", "Jan 15 10:30:46 host sshd[1]: b"},
+			want:   "syslog",
+		},
+		{
+			name:   "no majority",
+			sample: []string{`{"a":1}`, "level=info", `{"b":2}`, "level=warn"},
+			want:   "",
+		},
+		{
+			name:   "empty lines ignored",
+			sample: []string{"", `{"a":1}`, "  ", `{"b":2}`},
+			want:   "json",
+		},
+		{
+			name:   "syslog with key=value messages",
+			sample: []string{"Jan 15 10:30:45 host app[1]: user=bob action=login", "Jan 15 10:30:46 host app[1]: user=eve action=logout"},
+			want:   "syslog",
+		},
+		{
+			name:   "free text left to fallback",
+			sample: []string{"hello", "world"},
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			got := r.Detect(tt.sample)
+			name := ""
+			if got != nil {
+				name = got.Name()
+			}
+			if name != tt.want {
+				t.Errorf("Detect() = %q, want %q", name, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistry_Detect_Caches(t *testing.T) {
+	r := NewRegistry()
+	r.Detect([]string{`{"banner":true}`, "a=1 b=x", "a=2 b=y"})
+
+	// The banner is parsed by the detected kv parser
+	entry, err := r.Parse(`{"banner":true}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := entry.Fields["banner"]; ok {
+		t.Errorf("banner parsed as JSON after kv was detected: %v", entry.Fields)
+	}
+	entry, _ = r.Parse("a=3 b=z")
+	if entry.Fields["a"] != int64(3) {
+		t.Errorf("a = %v (%T), want 3", entry.Fields["a"], entry.Fields["a"])
+	}
+}
+
 func TestRegistry_ListParsers(t *testing.T) {
 	r := NewRegistry()
 	parsers := r.ListParsers()
@@ -265,6 +438,92 @@ func TestRegistry_Register(t *testing.T) {
 	}
 }
 
+func TestRegistry_Select(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "restrict and reorder", names: []string{"Syslog", "kv", "generic"}, want: []string{"syslog", "kv", "generic"}},
+		{name: "unknown", names: []string{"kv", "xml"}, wantErr: true},
+		{name: "duplicate", names: []string{"kv", "KV"}, wantErr: true},
+		{name: "empty", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			err := r.Select(tt.names)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Select(%v) error = %v, wantErr %v", tt.names, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var got []string
+			for _, p := range r.ListParsers() {
+				got = append(got, p.Name)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("parsers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistry_Select_Parse(t *testing.T) {
+	r := NewRegistry(WithAdaptiveMode())
+	if err := r.Select([]string{"syslog", "generic"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// kv is left out, so a key=value line falls back to generic
+	entry, err := r.Parse("level=info msg=hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Format != "generic" {
+		t.Errorf("Format = %q, want generic", entry.Format)
+	}
+}
+
+func TestRegistry_WithBuiltin(t *testing.T) {
+	r := NewRegistry(WithBuiltin(NewKeyValueParser(WithKVSeparator(":"))))
+
+	names := r.ListParsers()
+	if len(names) != 5 || names[1].Name != "kv" {
+		t.Fatalf("parsers = %v, want the tuned kv in place of the built-in", names)
+	}
+	entry, _ := r.Parse("a:1 b:2")
+	if entry.Format != "kv" || entry.Fields["a"] != int64(1) {
+		t.Errorf("Parse() = %q %v", entry.Format, entry.Fields)
+	}
+}
+
+func TestRegistry_RegisterFirst(t *testing.T) {
+	r := NewRegistry()
+
+	custom, err := NewRegexParser(`^(?P<msg>custom .+)$`)
+	if err != nil {
+		t.Fatalf("NewRegexParser failed: %v", err)
+	}
+	r.RegisterFirst(custom)
+
+	if first := r.ListParsers()[0]; first.Name != "regex" {
+		t.Errorf("RegisterFirst: first parser name = %q, want %q", first.Name, "regex")
+	}
+
+	// Auto-detection tries the new parser before the generic fallback.
+	entry, err := r.Parse("custom line")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if entry.Fields["msg"] != "custom line" {
+		t.Errorf("Parse: fields = %v, want msg from the custom parser", entry.Fields)
+	}
+}
+
 // fieldKeys returns a sorted list of keys from a map for diagnostic output.
 func fieldKeys(m map[string]any) []string {
 	keys := make([]string, 0, len(m))
@@ -273,3 +532,232 @@ func fieldKeys(m map[string]any) []string {
 	}
 	return keys
 }
+
+func TestRegistry_WithTypeInference(t *testing.T) {
+	r := NewRegistry(WithTypeInference(TypeInference{Disabled: true}), WithForcedFormat("regex"))
+
+	// Parsers registered after construction pick up the setting too.
+	rp, err := NewRegexParser(`(?P<code>\d+)`)
+	if err != nil {
+		t.Fatalf("NewRegexParser error: %v", err)
+	}
+	r.Register(rp)
+
+	entry, err := r.Parse("007")
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if entry.Fields["code"] != "007" {
+		t.Errorf("code = %v (%T), want string 007", entry.Fields["code"], entry.Fields["code"])
+	}
+
+	kv := r.GetParser("kv")
+	entry, _ = kv.Parse("a=1 b=2")
+	if entry.Fields["a"] != "1" {
+		t.Errorf("kv a = %v (%T), want string 1", entry.Fields["a"], entry.Fields["a"])
+	}
+}
+
+func TestRegistry_Stats(t *testing.T) {
+	r := NewRegistry(WithForcedFormat("json"))
+	for _, line := range []string{`{"a":1}`, `{"b":2}`, `not json`} {
+		_, _ = r.Parse(line)
+	}
+
+	want := map[string]ParserStats{
+		"json": {Name: "json", Attempted: 3, Matched: 2, Failed: 1},
+		"kv":   {Name: "kv"},
+	}
+	stats := r.Stats()
+	if len(stats) != len(r.ListParsers()) {
+		t.Fatalf("Stats() has %d entries, want one per parser", len(stats))
+	}
+	for _, s := range stats {
+		if w, ok := want[s.Name]; ok && s != w {
+			t.Errorf("Stats() %s = %+v, want %+v", s.Name, s, w)
+		}
+	}
+
+	// Adaptive detection counts the parser used for each line, including
+	// the fallback
+	r = NewRegistry(WithAdaptiveMode())
+	for _, line := range []string{`{"a":1}`, `a=1 b=2`, `free text`} {
+		_, _ = r.Parse(line)
+	}
+	for _, s := range r.Stats() {
+		var want int64
+		switch s.Name {
+		case "json", "kv", "generic":
+			want = 1
+		}
+		if s.Attempted != want || s.Matched != want || s.Failed != 0 {
+			t.Errorf("Stats() %s = %+v, want %d matched", s.Name, s, want)
+		}
+	}
+}
+
+func TestRegistry_Parse_Concurrent(t *testing.T) {
+	r := NewRegistry()
+	lines := []string{`{"a":1}`, `{"b":2}`, `{"c":3}`}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				entry, err := r.Parse(lines[j%len(lines)])
+				if err != nil || entry.ParseError != nil || entry.Format != "json" {
+					t.Errorf("Parse() = %v, %v", entry, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, s := range r.Stats() {
+		if s.Name == "json" && s.Matched != 800 {
+			t.Errorf("json matched %d lines, want 800", s.Matched)
+		}
+	}
+}
+
+func TestRegistry_Parse_RedetectAfter(t *testing.T) {
+	lines := []string{`{"a":1}`, `x=1 y=2`, `x=3 y=4`, `x=5 y=6`}
+
+	tests := []struct {
+		name    string
+		opts    []RegistryOption
+		formats []string
+	}{
+		{
+			name:    "strict mode keeps the cached parser",
+			formats: []string{"json", "json", "json", "json"},
+		},
+		{
+			name:    "re-detects after two failures",
+			opts:    []RegistryOption{WithRedetectAfter(2)},
+			formats: []string{"json", "json", "kv", "kv"},
+		},
+		{
+			name:    "re-detects after every failure",
+			opts:    []RegistryOption{WithRedetectAfter(1)},
+			formats: []string{"json", "kv", "kv", "kv"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry(tt.opts...)
+			for i, line := range lines {
+				entry, _ := r.Parse(line)
+				if entry.Format != tt.formats[i] {
+					t.Errorf("Parse(%q) format = %q, want %q", line, entry.Format, tt.formats[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRegistry_WantFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []string
+		line   string
+		want   map[string]any
+	}{
+		{
+			name:   "extracts wanted fields",
+			fields: []string{"status", "path"},
+			line:   `10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /a HTTP/1.0" 200 12`,
+			want:   map[string]any{"status": 200, "path": "/a"},
+		},
+		{
+			name: "no fields extracts all",
+			line: `x=1 y=two`,
+			want: map[string]any{"x": int64(1), "y": "two"},
+		},
+		{
+			name:   "parsers without ParseFields extract all",
+			fields: []string{"a"},
+			line:   `{"a":1,"b":2}`,
+			want:   map[string]any{"a": float64(1), "b": float64(2)},
+		},
+		{
+			name:   "no wanted field still parses",
+			fields: []string{"missing"},
+			line:   `x=1 y=two`,
+			want:   map[string]any{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry(WithAdaptiveMode())
+			r.WantFields(tt.fields)
+			entry, err := r.Parse(tt.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.ParseError != nil {
+				t.Fatalf("ParseError = %v", entry.ParseError)
+			}
+			if !reflect.DeepEqual(entry.Fields, tt.want) {
+				t.Errorf("Fields = %#v, want %#v", entry.Fields, tt.want)
+			}
+		})
+	}
+}
+
+// panicParser panics on every line, in CanParse too if canParsePanics.
+type panicParser struct{ canParsePanics bool }
+
+func (panicParser) Name() string        { return "panicky" }
+func (panicParser) Description() string { return "panics" }
+
+func (p panicParser) CanParse(string) bool {
+	if p.canParsePanics {
+		panic("CanParse failed")
+	}
+	return true
+}
+
+func (panicParser) Parse(line string) (*Entry, error) {
+	return nil, fmt.Errorf("unreachable %c", line[len(line)])
+}
+
+func TestRegistry_RecoversFromPanics(t *testing.T) {
+	t.Run("forced format", func(t *testing.T) {
+		r := NewRegistry(WithForcedFormat("panicky"))
+		r.Register(panicParser{})
+		entry, err := r.Parse("a=1 b=2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !errors.Is(entry.ParseError, ErrPanic) || !strings.HasPrefix(entry.ParseError.Error(), "panic: runtime error: index out of range") {
+			t.Errorf("ParseError = %v, want a panic", entry.ParseError)
+		}
+		if entry.Fields["raw"] != "a=1 b=2" || entry.Format != "panicky" {
+			t.Errorf("entry = %+v, want the raw line from panicky", entry)
+		}
+		if stats := r.Stats(); stats[len(stats)-1] != (ParserStats{Name: "panicky", Attempted: 1, Failed: 1}) {
+			t.Errorf("Stats() = %+v, want a failed attempt", stats)
+		}
+	})
+
+	for _, p := range []panicParser{{}, {canParsePanics: true}} {
+		t.Run(fmt.Sprintf("auto-detection, CanParse panics: %v", p.canParsePanics), func(t *testing.T) {
+			r := NewRegistry(WithAdaptiveMode())
+			r.RegisterFirst(p)
+			if got := r.Detect([]string{"a=1 b=2", "c=3 d=4"}); got == nil || got.Name() != "kv" {
+				t.Errorf("Detect() = %v, want kv", got)
+			}
+			entry, err := r.Parse("a=1 b=2")
+			if err != nil || entry.ParseError != nil || entry.Format != "kv" {
+				t.Errorf("Parse() = %+v, %v; want kv", entry, err)
+			}
+			if ex := r.Explain("a=1 b=2"); ex.Format != "kv" {
+				t.Errorf("Explain() chose %q, want kv", ex.Format)
+			}
+		})
+	}
+}
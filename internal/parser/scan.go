@@ -0,0 +1,46 @@
+package parser
+
+// Helpers for the hand-written scanners, which read a line byte by byte
+// where a regular expression would find the same fields more slowly.
+// Their classes are the ASCII ones of Go's regexp syntax, so a scanner
+// and the pattern it replaces agree on every line.
+
+// isWordByte reports whether c is in the regexp class \w.
+func isWordByte(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+// isSpaceByte reports whether c is in the regexp class \s.
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
+// isDigitByte reports whether c is in the regexp class \d.
+func isDigitByte(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// skipSpace returns the index of the first byte at or after i that is not
+// space (\s*).
+func skipSpace(s string, i int) int {
+	for i < len(s) && isSpaceByte(s[i]) {
+		i++
+	}
+	return i
+}
+
+// skipNonSpace returns the index of the first space at or after i (\S*).
+func skipNonSpace(s string, i int) int {
+	for i < len(s) && !isSpaceByte(s[i]) {
+		i++
+	}
+	return i
+}
+
+// skipDigits returns the index of the first non-digit at or after i (\d*).
+func skipDigits(s string, i int) int {
+	for i < len(s) && isDigitByte(s[i]) {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// mutations returns the seed lines and n random variants of them, each
+// with a few bytes inserted, deleted or replaced by bytes from alphabet,
+// for checking a scanner against the pattern it replaces.
+func mutations(seeds []string, alphabet string, n int) []string {
+	rng := rand.New(rand.NewSource(1))
+	lines := append([]string(nil), seeds...)
+	for len(lines) < len(seeds)+n {
+		b := []byte(seeds[rng.Intn(len(seeds))])
+		for edits := 1 + rng.Intn(3); edits > 0; edits-- {
+			i := rng.Intn(len(b) + 1)
+			c := alphabet[rng.Intn(len(alphabet))]
+			switch op := rng.Intn(3); {
+			case op == 0 || i == len(b):
+				b = append(b[:i], append([]byte{c}, b[i:]...)...)
+			case op == 1:
+				b = append(b[:i], b[i+1:]...)
+			default:
+				b[i] = c
+			}
+		}
+		lines = append(lines, string(b))
+	}
+	return lines
+}
+
+// sameParse checks that two parsers agree on whether each line matches
+// and on the fields found.
+func sameParse(t *testing.T, got, want Parser, lines []string) {
+	t.Helper()
+	for _, line := range lines {
+		if g, w := got.CanParse(line), want.CanParse(line); g != w {
+			t.Fatalf("CanParse(%q) = %v, pattern %v", line, g, w)
+		}
+		g, _ := got.Parse(line)
+		w, _ := want.Parse(line)
+		if !reflect.DeepEqual(g.Fields, w.Fields) || g.ParseError != w.ParseError {
+			t.Fatalf("Parse(%q) = %v (%v), pattern %v (%v)", line, g.Fields, g.ParseError, w.Fields, w.ParseError)
+		}
+	}
+}
+
+func TestMatchDigits(t *testing.T) {
+	tests := []struct {
+		s      string
+		i      int
+		layout string
+		want   bool
+	}{
+		{"10:30:45", 0, "00:00:00", true},
+		{"x10:30:45", 1, "00:00:00", true},
+		{"10:30:4", 0, "00:00:00", false},
+		{"10-30:45", 0, "00:00:00", false},
+		{"1a:30:45", 0, "00:00:00", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchDigits(tt.s, tt.i, tt.layout); got != tt.want {
+			t.Errorf("matchDigits(%q, %d, %q) = %v, want %v", tt.s, tt.i, tt.layout, got, tt.want)
+		}
+	}
+}
@@ -3,26 +3,57 @@ package parser
 import (
 	"regexp"
 	"strconv"
+	"strings"
 )
 
 // SyslogParser handles traditional syslog format.
 // Example: Jan 15 10:30:45 myhost sshd[1234]: Accepted password for user
 type SyslogParser struct {
+	// pattern, if set, matches lines in place of scanSyslog
 	pattern *regexp.Regexp
+
+	// messages, if set, parse JSON or key=value messages into fields
+	messages []Parser
+}
+
+// SyslogOption configures a SyslogParser.
+type SyslogOption func(*SyslogParser)
+
+// WithMessageParsing parses messages that are JSON objects or key=value
+// pairs, adding their fields to the entry. Header fields (host, program,
+// ...) win over message fields of the same name.
+func WithMessageParsing() SyslogOption {
+	return func(p *SyslogParser) {
+		p.messages = []Parser{NewJSONParser(), NewKeyValueParser()}
+	}
 }
 
+// WithSyslogRegex matches lines with the regular expression the
+// hand-written scanner replaced, which finds the same fields more slowly;
+// it is kept to check the scanner against.
+func WithSyslogRegex() SyslogOption {
+	return func(p *SyslogParser) {
+		p.pattern = syslogPattern
+	}
+}
+
+// syslogPattern is the syslog format: timestamp hostname program[pid]:
+// message, the timestamp "Jan 15 10:30:45" or "2024-01-15T10:30:45".
+var syslogPattern = regexp.MustCompile(
+	`^(?P<timestamp>(?:\w{3}\s+\d{1,2}\s+\d{2}:\d{2}:\d{2})|(?:\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:\d{2})?))` +
+		`\s+(?P<host>\S+)` +
+		`\s+(?P<program>[^\s\[:]+)` +
+		`(?:\[(?P<pid>\d+)\])?` +
+		`:\s*(?P<message>.*)$`,
+)
+
 // NewSyslogParser creates a new syslog format parser.
-func NewSyslogParser() *SyslogParser {
-	// Syslog format: timestamp hostname program[pid]: message
-	// Timestamp: "Jan 15 10:30:45" or "2024-01-15T10:30:45"
-	pattern := regexp.MustCompile(
-		`^(?P<timestamp>(?:\w{3}\s+\d{1,2}\s+\d{2}:\d{2}:\d{2})|(?:\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:\d{2})?))` +
-			`\s+(?P<host>\S+)` +
-			`\s+(?P<program>[^\s\[:]+)` +
-			`(?:\[(?P<pid>\d+)\])?` +
-			`:\s*(?P<message>.*)$`,
-	)
-	return &SyslogParser{pattern: pattern}
+func NewSyslogParser(opts ...SyslogOption) *SyslogParser {
+	p := &SyslogParser{}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
 // Name returns the parser identifier.
@@ -37,37 +68,221 @@ func (p *SyslogParser) Description() string {
 
 // CanParse checks if the line matches syslog format.
 func (p *SyslogParser) CanParse(line string) bool {
-	return p.pattern.MatchString(line)
+	if p.pattern != nil {
+		return p.pattern.MatchString(line)
+	}
+	_, ok := scanSyslog(line)
+	return ok
 }
 
 // Parse extracts fields from a syslog line.
 func (p *SyslogParser) Parse(line string) (*Entry, error) {
-	entry := NewEntry(line)
+	return p.ParseFields(line, nil)
+}
 
-	matches := p.pattern.FindStringSubmatch(line)
-	if matches == nil {
-		entry.ParseError = ErrNoMatch
-		entry.Fields["raw"] = line
-		return entry, nil
-	}
+// ParseFields is like Parse, storing only the wanted fields. A message
+// left out is still parsed for the wanted fields it holds.
+func (p *SyslogParser) ParseFields(line string, wanted map[string]bool) (*Entry, error) {
+	entry := NewEntry(line)
 
-	// Extract named groups
-	names := p.pattern.SubexpNames()
-	for i, match := range matches {
-		if i == 0 || names[i] == "" || match == "" {
-			continue
+	var message string
+	if p.pattern != nil {
+		matches := p.pattern.FindStringSubmatch(line)
+		if matches == nil {
+			entry.ParseError = ErrNoMatch
+			entry.Fields["raw"] = line
+			return entry, nil
 		}
 
-		// Convert PID to integer
-		if names[i] == "pid" {
-			if pid, err := strconv.Atoi(match); err == nil {
-				entry.Fields[names[i]] = pid
+		// Extract named groups
+		names := p.pattern.SubexpNames()
+		for i, match := range matches {
+			if i == 0 || names[i] == "" {
 				continue
 			}
+			if names[i] == "message" {
+				message = match
+			}
+			if wants(wanted, names[i]) {
+				setSyslogField(entry, names[i], match)
+			}
 		}
-
-		entry.Fields[names[i]] = match
+	} else {
+		h, ok := scanSyslog(line)
+		if !ok {
+			entry.ParseError = ErrNoMatch
+			entry.Fields["raw"] = line
+			return entry, nil
+		}
+		for _, f := range [...]struct{ name, value string }{
+			{"timestamp", h.timestamp},
+			{"host", h.host},
+			{"program", h.program},
+			{"pid", h.pid},
+			{"message", h.message},
+		} {
+			if wants(wanted, f.name) {
+				setSyslogField(entry, f.name, f.value)
+			}
+		}
+		message = h.message
 	}
 
+	if message != "" && p.messages != nil {
+		p.parseMessage(entry, message, wanted)
+	}
 	return entry, nil
 }
+
+// setSyslogField stores a field found in a line, unless it is empty.
+func setSyslogField(entry *Entry, name, value string) {
+	switch {
+	case value == "":
+		return
+	case name == "pid":
+		// Convert PID to integer
+		if pid, err := strconv.Atoi(value); err == nil {
+			entry.Fields[name] = pid
+			return
+		}
+	case name == "host" || name == "program":
+		// Few and repeated from line to line
+		entry.Fields[name] = internValue(value)
+		return
+	}
+	entry.Fields[name] = value
+}
+
+// syslogHeader holds the parts of a syslog line; pid is empty if the line
+// has none.
+type syslogHeader struct {
+	timestamp, host, program, pid, message string
+}
+
+// scanSyslog splits a line as syslogPattern matches it, reporting whether
+// it does.
+func scanSyslog(line string) (h syslogHeader, ok bool) {
+	i, ok := scanSyslogTimestamp(line)
+	if !ok {
+		return h, false
+	}
+	h.timestamp = line[:i]
+
+	// Host and program, each after at least one space
+	start := skipSpace(line, i)
+	if start == i {
+		return h, false
+	}
+	i = skipNonSpace(line, start)
+	if i == start {
+		return h, false
+	}
+	h.host = line[start:i]
+	start = skipSpace(line, i)
+	if start == i {
+		return h, false
+	}
+	i = start
+	for i < len(line) && !isSpaceByte(line[i]) && line[i] != '[' && line[i] != ':' {
+		i++
+	}
+	if i == start {
+		return h, false
+	}
+	h.program = line[start:i]
+
+	// An optional [pid], then the colon
+	if i < len(line) && line[i] == '[' {
+		end := skipDigits(line, i+1)
+		if end == i+1 || end == len(line) || line[end] != ']' {
+			return h, false
+		}
+		h.pid = line[i+1 : end]
+		i = end + 1
+	}
+	if i == len(line) || line[i] != ':' {
+		return h, false
+	}
+
+	// The message is the rest of the line, which . does not match past
+	h.message = line[skipSpace(line, i+1):]
+	if strings.IndexByte(h.message, '\n') >= 0 {
+		return h, false
+	}
+	return h, true
+}
+
+// scanSyslogTimestamp returns the end of the timestamp starting line:
+// "Jan 15 10:30:45", or RFC 3339 with an optional fraction and zone.
+func scanSyslogTimestamp(line string) (int, bool) {
+	if len(line) > 3 && isWordByte(line[0]) && isWordByte(line[1]) && isWordByte(line[2]) && isSpaceByte(line[3]) {
+		// The day has one or two digits, between spaces
+		start := skipSpace(line, 3)
+		i := skipDigits(line, start)
+		if i == start || i-start > 2 {
+			return 0, false
+		}
+		start = skipSpace(line, i)
+		if start == i || !matchDigits(line, start, "00:00:00") {
+			return 0, false
+		}
+		return start + len("00:00:00"), true
+	}
+
+	if !matchDigits(line, 0, "0000-00-00T00:00:00") {
+		return 0, false
+	}
+	i := len("0000-00-00T00:00:00")
+	if i+1 < len(line) && line[i] == '.' && isDigitByte(line[i+1]) {
+		i = skipDigits(line, i+1)
+	}
+	switch {
+	case i < len(line) && line[i] == 'Z':
+		i++
+	case i < len(line) && (line[i] == '+' || line[i] == '-') && matchDigits(line, i+1, "00:00"):
+		i += len("+00:00")
+	}
+	return i, true
+}
+
+// matchDigits reports whether s has layout at offset i, where each 0 in
+// layout stands for any digit and every other byte for itself.
+func matchDigits(s string, i int, layout string) bool {
+	if len(s)-i < len(layout) {
+		return false
+	}
+	for j := 0; j < len(layout); j++ {
+		if c := s[i+j]; layout[j] == '0' && !isDigitByte(c) || layout[j] != '0' && c != layout[j] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseMessage adds the wanted fields of a JSON or key=value message.
+func (p *SyslogParser) parseMessage(entry *Entry, message string, wanted map[string]bool) {
+	for _, parser := range p.messages {
+		if !parser.CanParse(message) {
+			continue
+		}
+		parsed, err := parser.Parse(message)
+		if err != nil || parsed.ParseError != nil {
+			continue
+		}
+		for k, v := range parsed.Fields {
+			if _, exists := entry.Fields[k]; !exists && wants(wanted, k) {
+				entry.Fields[k] = v
+			}
+		}
+		return
+	}
+}
+
+// SetTypeInference configures conversion of key=value message fields.
+func (p *SyslogParser) SetTypeInference(ti TypeInference) {
+	for _, parser := range p.messages {
+		if inf, ok := parser.(typeInferrer); ok {
+			inf.SetTypeInference(ti)
+		}
+	}
+}
@@ -142,3 +142,64 @@ func TestSyslogParser_Parse(t *testing.T) {
 		})
 	}
 }
+
+func TestSyslogParser_MessageParsing(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want map[string]any
+	}{
+		{
+			name: "key=value",
+			line: "Jan 15 10:30:45 web1 app[12]: user=bob latency=12",
+			want: map[string]any{"user": "bob", "latency": int64(12), "message": "user=bob latency=12"},
+		},
+		{
+			name: "json",
+			line: `Jan 15 10:30:45 web1 app: {"user":"bob","host":"inner"}`,
+			want: map[string]any{"user": "bob", "host": "web1"},
+		},
+		{
+			name: "plain text",
+			line: "Jan 15 10:30:45 web1 app: user logged in",
+			want: map[string]any{"message": "user logged in", "user": nil},
+		},
+	}
+
+	p := NewSyslogParser(WithMessageParsing())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := p.Parse(tt.line)
+			if err != nil || entry.ParseError != nil {
+				t.Fatalf("Parse(%q) error: %v, %v", tt.line, err, entry.ParseError)
+			}
+			for k, v := range tt.want {
+				if entry.Fields[k] != v {
+					t.Errorf("Parse(%q): %s = %v, want %v", tt.line, k, entry.Fields[k], v)
+				}
+			}
+		})
+	}
+
+	// Without the option the message is left alone
+	entry, _ := NewSyslogParser().Parse(tests[0].line)
+	if _, ok := entry.Fields["user"]; ok {
+		t.Errorf("message parsed without WithMessageParsing: %v", entry.Fields)
+	}
+}
+
+func TestSyslogParser_ScannerMatchesRegex(t *testing.T) {
+	lines := mutations([]string{
+		"Jan 15 10:30:45 myhost sshd[1234]: Accepted password for user",
+		"Jan  5 10:30:45 myhost kernel: message",
+		"2024-01-15T10:30:45.123+02:00 web-1 nginx[7]:   spaced message",
+		"2024-01-15T10:30:45Z host app: ",
+		"Jan 15 10:30:45 host app[99999999999999999999]: pid overflows",
+		"Jan 15 10:30:45\thost\tapp:\n\nafter newlines",
+		"Jan 15 10:30:45 host app: a\nb",
+	}, " \t\n:[]0123456789Z+-.Tx", 5000)
+
+	for _, opts := range [][]SyslogOption{nil, {WithMessageParsing()}} {
+		sameParse(t, NewSyslogParser(opts...), NewSyslogParser(append(opts, WithSyslogRegex())...), lines)
+	}
+}
@@ -8,26 +8,92 @@ import (
 // inferType attempts to convert a string to its most appropriate type.
 // Returns int64 for integers, float64 for decimals, bool for true/false,
 // or the original string if no conversion applies.
+//
+// Most values are plain strings, so those that cannot be numbers are
+// recognized before strconv is tried: its errors are allocated.
 func inferType(s string) any {
 	// Try integer
-	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
-		return i
+	if isInteger(s) {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
 	}
 
 	// Try float
-	if f, err := strconv.ParseFloat(s, 64); err == nil {
-		return f
+	if mayBeFloat(s) {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
 	}
 
 	// Try boolean
-	lower := strings.ToLower(s)
-	if lower == "true" {
+	if strings.EqualFold(s, "true") {
 		return true
 	}
-	if lower == "false" {
+	if strings.EqualFold(s, "false") {
 		return false
 	}
 
 	// Return as string
-	return s
+	return internValue(s)
+}
+
+// isInteger reports whether s has the form ParseInt accepts in base 10:
+// an optional sign and digits.
+func isInteger(s string) bool {
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		s = s[1:]
+	}
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// mayBeFloat reports whether ParseFloat could accept s: after an optional
+// sign, it starts with a digit or a point, or spells infinity or NaN.
+func mayBeFloat(s string) bool {
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		s = s[1:]
+	}
+	if s == "" {
+		return false
+	}
+	switch c := s[0]; {
+	case c >= '0' && c <= '9', c == '.':
+		return true
+	case c == 'i' || c == 'I':
+		return strings.EqualFold(s, "inf") || strings.EqualFold(s, "infinity")
+	case c == 'n' || c == 'N':
+		return strings.EqualFold(s, "nan")
+	}
+	return false
+}
+
+// TypeInference controls which extracted values are converted by inferType.
+// The zero value infers types for every field.
+type TypeInference struct {
+	// Disabled keeps every value as a string.
+	Disabled bool
+
+	// StringFields keeps only these fields as strings.
+	StringFields map[string]bool
+}
+
+// value converts s for the given field according to the inference settings.
+func (ti TypeInference) value(field, s string) any {
+	if ti.Disabled || ti.StringFields[field] {
+		return internValue(s)
+	}
+	return inferType(s)
+}
+
+// typeInferrer is implemented by parsers whose type inference is configurable.
+type typeInferrer interface {
+	SetTypeInference(ti TypeInference)
 }
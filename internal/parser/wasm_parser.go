@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/juliosaraiva/log2json/internal/wasm"
+)
+
+// WasmParser delegates parsing to a WebAssembly plugin's parse function,
+// which returns the line's fields as a JSON object, or nothing if the
+// line is not in its format.
+type WasmParser struct {
+	name   string
+	plugin *wasm.Plugin
+}
+
+// NewWasmParser creates a parser named name backed by plugin.
+// Returns error if the plugin does not export a parse function.
+func NewWasmParser(name string, plugin *wasm.Plugin) (*WasmParser, error) {
+	if !plugin.HasParse() {
+		return nil, fmt.Errorf("plugin does not export %s", wasm.PluginParse)
+	}
+	return &WasmParser{name: name, plugin: plugin}, nil
+}
+
+// Name returns the parser identifier.
+func (p *WasmParser) Name() string {
+	return p.name
+}
+
+// Description returns a human-readable description.
+func (p *WasmParser) Description() string {
+	return "WebAssembly plugin parser"
+}
+
+// CanParse asks the plugin to parse the line. Plugins have no cheaper
+// check, so this costs as much as Parse.
+func (p *WasmParser) CanParse(line string) bool {
+	entry, err := p.Parse(line)
+	return err == nil && entry.ParseError == nil
+}
+
+// Parse calls the plugin's parse function.
+func (p *WasmParser) Parse(line string) (*Entry, error) {
+	entry := NewEntry(line)
+
+	output, err := p.plugin.Parse([]byte(line))
+	if err != nil {
+		entry.ParseError = err
+		entry.Fields["raw"] = line
+		return entry, nil
+	}
+
+	var fields map[string]any
+	if output != nil {
+		if err := json.Unmarshal(output, &fields); err != nil {
+			entry.ParseError = fmt.Errorf("%w: plugin returned %v", ErrInvalidData, err)
+			entry.Fields["raw"] = line
+			return entry, nil
+		}
+	}
+	if fields == nil {
+		entry.ParseError = ErrNoMatch
+		entry.Fields["raw"] = line
+		return entry, nil
+	}
+
+	entry.Fields = fields
+	return entry, nil
+}
@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/wasm"
+)
+
+// echoObjectsPlugin is a test plugin (assembled by internal/wasm's test
+// helpers) whose parse function returns lines starting with '{' as-is
+// and nothing for anything else.
+const echoObjectsPlugin = "0061736d0100000001110360017f017f60027f7f017e60027f7f00020b0103656e76036c6f67000203040300010105030100010607017f014180080b072604066d656d6f7279020005616c6c6f630001097472616e73666f726d000205706172736500030a3c030b002300230020006a24000b12002000200110002000ad4220862001ad840b1b0020002d000041fb0047044042000f0b2000ad4220862001ad840b0b06010041000b00"
+
+func TestWasmParser(t *testing.T) {
+	data, err := hex.DecodeString(echoObjectsPlugin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := wasm.Compile(data)
+	if err != nil {
+		t.Fatalf("Compile() error: %v", err)
+	}
+	plugin, err := wasm.NewPlugin(m, nil)
+	if err != nil {
+		t.Fatalf("NewPlugin() error: %v", err)
+	}
+	p, err := NewWasmParser("custom", plugin)
+	if err != nil {
+		t.Fatalf("NewWasmParser() error: %v", err)
+	}
+
+	if p.Name() != "custom" {
+		t.Errorf("Name() = %q, want custom", p.Name())
+	}
+
+	tests := []struct {
+		name           string
+		line           string
+		wantCanParse   bool
+		wantFields     map[string]any
+		wantParseError error
+	}{
+		{
+			name:         "object",
+			line:         `{"level":"info","n":2}`,
+			wantCanParse: true,
+			wantFields:   map[string]any{"level": "info", "n": float64(2)},
+		},
+		{
+			name:           "no match",
+			line:           "plain text",
+			wantFields:     map[string]any{"raw": "plain text"},
+			wantParseError: ErrNoMatch,
+		},
+		{
+			name:           "invalid JSON",
+			line:           "{not json",
+			wantCanParse:   false,
+			wantFields:     map[string]any{"raw": "{not json"},
+			wantParseError: ErrInvalidData,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.CanParse(tt.line); got != tt.wantCanParse {
+				t.Errorf("CanParse() = %v, want %v", got, tt.wantCanParse)
+			}
+
+			entry, err := p.Parse(tt.line)
+			if err != nil {
+				t.Fatalf("Parse() error: %v", err)
+			}
+			if !errors.Is(entry.ParseError, tt.wantParseError) {
+				t.Errorf("ParseError = %v, want %v", entry.ParseError, tt.wantParseError)
+			}
+			if len(entry.Fields) != len(tt.wantFields) {
+				t.Fatalf("Fields = %v, want %v", entry.Fields, tt.wantFields)
+			}
+			for k, v := range tt.wantFields {
+				if entry.Fields[k] != v {
+					t.Errorf("Fields[%q] = %v, want %v", k, entry.Fields[k], v)
+				}
+			}
+		})
+	}
+}
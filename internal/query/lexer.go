@@ -0,0 +1,157 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// tokenKind identifies the type of a lexical token.
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+	tokComma
+	tokStar
+	tokLParen
+	tokRParen
+)
+
+// token is a single lexical element of a query.
+type token struct {
+	kind   tokenKind
+	text   string
+	pos    int
+	quoted bool // a `quoted` identifier, never a keyword
+}
+
+// is reports whether the token is the keyword kw, in any case.
+func (t token) is(kw string) bool {
+	return t.kind == tokIdent && !t.quoted && strings.EqualFold(t.text, kw)
+}
+
+// operators lists recognized comparison operators, longest first so that
+// "<=" is matched before "<".
+var operators = []string{"<>", "<=", ">=", "!=", "==", "=~", "!~", "=", "<", ">"}
+
+// lex splits a query into tokens. Strings are quoted with ' or ", and
+// field names that are not plain identifiers with `; a quote is written
+// twice inside them.
+func lex(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+
+	for i < len(src) {
+		c := rune(src[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i})
+			i++
+
+		case c == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i})
+			i++
+
+		case c == ',':
+			tokens = append(tokens, token{kind: tokComma, text: ",", pos: i})
+			i++
+
+		case c == '*':
+			tokens = append(tokens, token{kind: tokStar, text: "*", pos: i})
+			i++
+
+		case c == '\'' || c == '"' || c == '`':
+			text, n, err := lexQuoted(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("at position %d: %w", i, err)
+			}
+			if c == '`' {
+				tokens = append(tokens, token{kind: tokIdent, text: text, pos: i, quoted: true})
+			} else {
+				tokens = append(tokens, token{kind: tokString, text: text, pos: i})
+			}
+			i += n
+
+		case isDigit(c) || (c == '-' && i+1 < len(src) && isDigit(rune(src[i+1]))):
+			start := i
+			i++
+			for i < len(src) && (isDigit(rune(src[i])) || src[i] == '.' || src[i] == 'e' || src[i] == 'E') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: src[start:i], pos: start})
+
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && isIdentPart(rune(src[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: src[start:i], pos: start})
+
+		default:
+			op := matchOperator(src[i:])
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokEOF, pos: len(src)})
+	return tokens, nil
+}
+
+// lexQuoted reads a quoted string or identifier starting at s[0], in
+// which the quote is written twice, as in SQL. Returns the unquoted value
+// and the number of bytes consumed.
+func lexQuoted(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+
+	for i := 1; i < len(s); i++ {
+		if s[i] != quote {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == quote {
+			b.WriteByte(quote)
+			i++
+			continue
+		}
+		return b.String(), i + 1, nil
+	}
+
+	return "", 0, fmt.Errorf("unterminated %c", quote)
+}
+
+// matchOperator returns the operator at the start of s, or "".
+func matchOperator(s string) string {
+	for _, op := range operators {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c rune) bool {
+	return c == '_' || unicode.IsLetter(c)
+}
+
+// isIdentPart allows dots and dashes, as the filter language does, so
+// nested fields can be addressed as a.b.c.
+func isIdentPart(c rune) bool {
+	return isIdentStart(c) || isDigit(c) || c == '.' || c == '-'
+}
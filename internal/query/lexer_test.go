@@ -0,0 +1,55 @@
+package query
+
+import "testing"
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    []string
+		wantErr bool
+	}{
+		{name: "select", src: `SELECT path, count(*) FROM stream`, want: []string{"SELECT", "path", ",", "count", "(", "*", ")", "FROM", "stream"}},
+		{name: "comparisons", src: `a<>1 AND b<=2`, want: []string{"a", "<>", "1", "AND", "b", "<=", "2"}},
+		{name: "single-quoted string", src: `msg = 'a b'`, want: []string{"msg", "=", "a b"}},
+		{name: "doubled quote", src: `msg = 'it''s'`, want: []string{"msg", "=", "it's"}},
+		{name: "quoted field", src: "`user agent` = \"curl\"", want: []string{"user agent", "=", "curl"}},
+		{name: "negative number", src: `x > -1.5`, want: []string{"x", ">", "-1.5"}},
+		{name: "dotted field", src: `_host.os = 'linux'`, want: []string{"_host.os", "=", "linux"}},
+		{name: "unterminated string", src: `msg = 'oops`, wantErr: true},
+		{name: "bad character", src: `a # b`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := lex(tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("lex(%q) error = %v, wantErr %v", tt.src, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			// Drop trailing EOF token
+			tokens = tokens[:len(tokens)-1]
+			if len(tokens) != len(tt.want) {
+				t.Fatalf("lex(%q) returned %d tokens, want %d: %v", tt.src, len(tokens), len(tt.want), tokens)
+			}
+			for i, tok := range tokens {
+				if tok.text != tt.want[i] {
+					t.Errorf("token %d = %q, want %q", i, tok.text, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLex_QuotedFieldIsNoKeyword(t *testing.T) {
+	tokens, err := lex("`from`")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens[0].is("FROM") {
+		t.Error("a quoted field was taken for a keyword")
+	}
+}
@@ -0,0 +1,571 @@
+// Package query implements a small SQL subset for ad-hoc analyses of a
+// stream of log entries, without loading them into another tool first.
+//
+// Example:
+//
+//	SELECT path, count(*), avg(duration) FROM stream
+//	WHERE status >= 500 GROUP BY path HAVING count(*) > 10
+//	ORDER BY count(*) DESC LIMIT 5
+//
+// The SELECT list holds fields (dotted paths reach into nested objects),
+// the aggregates count(*), count(field), sum, avg, min and max, each with
+// an optional AS alias, or * for whole entries. FROM, if given, names the
+// one table, stream. WHERE and HAVING conditions take the comparisons =,
+// <> (or !=), <, <=, >, >=, [NOT] LIKE with % and _ wildcards, [NOT] IN
+// (...), IS [NOT] NULL, and the filter language's =~ and !~, combined
+// with AND, OR, NOT and parentheses. ORDER BY takes columns, GROUP BY
+// fields or aggregates, each ASC or DESC, and LIMIT a row count.
+//
+// A query without aggregates or GROUP BY selects from each entry as it
+// comes; one with them adds entries up into groups, whose rows are ready
+// when its input, or a window of it, ends.
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/juliosaraiva/log2json/internal/expr"
+)
+
+// Query is a parsed query. It holds no state of its own: each Run over
+// it does, so one Query can serve several windows of the stream.
+type Query struct {
+	src     string
+	star    bool
+	columns []column
+	aggs    []aggregate // those of the columns, then those only HAVING or ORDER BY use
+	where   *expr.Expr
+	groupBy []string
+	having  *expr.Expr
+	orderBy []orderKey
+	limit   int // rows to return, 0 for all
+}
+
+// column is an item of the SELECT list.
+type column struct {
+	name  string // the column's name in rows: its alias, field or aggregate
+	field string // the field selected, or "" for an aggregate
+	agg   int    // the aggregate selected
+}
+
+// aggregate is an aggregate function over a field.
+type aggregate struct {
+	fn    string // count, sum, avg, min or max
+	field string // "" for count(*)
+	name  string // as written, normalized: count(*), avg(duration)
+}
+
+// orderKey is an item of ORDER BY, by its name in a group's values.
+type orderKey struct {
+	name string
+	desc bool
+}
+
+// aggregateFuncs are the aggregate functions, by name.
+var aggregateFuncs = map[string]bool{"count": true, "sum": true, "avg": true, "min": true, "max": true}
+
+// clauses are the keywords that end a clause.
+var clauses = []string{"FROM", "WHERE", "GROUP", "HAVING", "ORDER", "LIMIT"}
+
+// Parse parses a query.
+func Parse(src string) (*Query, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, q: &Query{src: src}}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return p.q, nil
+}
+
+// String returns the source text of the query.
+func (q *Query) String() string {
+	return q.src
+}
+
+// Grouped reports whether the query adds entries up into groups, and so
+// returns rows only at the end of its input, or of a window.
+func (q *Query) Grouped() bool {
+	return len(q.groupBy) > 0 || len(q.aggs) > 0
+}
+
+// Columns returns the names of the query's columns, in the order of the
+// SELECT list, or nil for SELECT *.
+func (q *Query) Columns() []string {
+	if q.star {
+		return nil
+	}
+	names := make([]string, len(q.columns))
+	for i, c := range q.columns {
+		names[i] = c.name
+	}
+	return names
+}
+
+// parser is a recursive-descent parser over the token stream.
+type parser struct {
+	tokens []token
+	pos    int
+	q      *Query
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// unexpected returns the error for a token the query cannot have there.
+func unexpected(tok token) error {
+	if tok.kind == tokEOF {
+		return fmt.Errorf("unexpected end of query")
+	}
+	return fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+}
+
+func (p *parser) parse() error {
+	if !p.next().is("SELECT") {
+		return fmt.Errorf("query must start with SELECT")
+	}
+	if err := p.parseSelect(); err != nil {
+		return err
+	}
+	if p.peek().is("FROM") {
+		p.next()
+		if tok := p.next(); !tok.is("stream") {
+			return fmt.Errorf("unknown table %q: the entries are FROM stream", tok.text)
+		}
+	}
+	if p.peek().is("WHERE") {
+		p.next()
+		where, err := p.condition("WHERE", p.clause(), false)
+		if err != nil {
+			return err
+		}
+		p.q.where = where
+	}
+	if p.peek().is("GROUP") {
+		p.next()
+		if err := p.parseGroupBy(); err != nil {
+			return err
+		}
+	}
+	if p.peek().is("HAVING") {
+		p.next()
+		having, err := p.condition("HAVING", p.clause(), true)
+		if err != nil {
+			return err
+		}
+		p.q.having = having
+	}
+	if p.peek().is("ORDER") {
+		p.next()
+		if err := p.parseOrderBy(); err != nil {
+			return err
+		}
+	}
+	if p.peek().is("LIMIT") {
+		p.next()
+		tok := p.next()
+		n, err := strconv.Atoi(tok.text)
+		if tok.kind != tokNumber || err != nil || n < 1 {
+			return fmt.Errorf("invalid LIMIT %q: expected a positive row count", tok.text)
+		}
+		p.q.limit = n
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return unexpected(tok)
+	}
+	return p.check()
+}
+
+// check rejects queries whose clauses do not fit together.
+func (p *parser) check() error {
+	q := p.q
+	if q.star && (len(q.columns) > 0 || q.Grouped()) {
+		return fmt.Errorf("SELECT * cannot be combined with other columns, aggregates or GROUP BY")
+	}
+	if !q.Grouped() {
+		if q.having != nil || len(q.orderBy) > 0 {
+			return fmt.Errorf("HAVING and ORDER BY need GROUP BY or an aggregate")
+		}
+		return nil
+	}
+	for _, c := range q.columns {
+		if c.field != "" && !slices.Contains(q.groupBy, c.field) {
+			return fmt.Errorf("column %s must be in GROUP BY or inside an aggregate", c.field)
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseSelect() error {
+	names := make(map[string]bool)
+	for {
+		tok := p.peek()
+		var c column
+		switch {
+		case tok.kind == tokStar:
+			p.next()
+			p.q.star = true
+		case p.atAggregate():
+			agg, err := p.parseAggregate()
+			if err != nil {
+				return err
+			}
+			c = column{name: p.q.aggs[agg].name, agg: agg}
+		case tok.kind == tokIdent && !p.atClause():
+			p.next()
+			c = column{name: tok.text, field: tok.text}
+		default:
+			return unexpected(tok)
+		}
+
+		if c.name != "" {
+			if p.peek().is("AS") {
+				p.next()
+				if p.peek().kind != tokIdent {
+					return unexpected(p.peek())
+				}
+				c.name = p.next().text
+			} else if tok := p.peek(); tok.kind == tokIdent && !p.atClause() {
+				c.name = p.next().text
+			}
+			if names[c.name] {
+				return fmt.Errorf("column %s is selected twice; name one with AS", c.name)
+			}
+			names[c.name] = true
+			p.q.columns = append(p.q.columns, c)
+		}
+
+		if p.peek().kind != tokComma {
+			return nil
+		}
+		p.next()
+	}
+}
+
+// atClause reports whether the next token starts a clause.
+func (p *parser) atClause() bool {
+	for _, kw := range clauses {
+		if p.peek().is(kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// atAggregate reports whether the next tokens are an aggregate call.
+func (p *parser) atAggregate() bool {
+	tok := p.peek()
+	return tok.kind == tokIdent && !tok.quoted && aggregateFuncs[strings.ToLower(tok.text)] &&
+		p.tokens[p.pos+1].kind == tokLParen
+}
+
+// parseAggregate parses an aggregate call and returns its index in the
+// query's aggregates, adding it if it is new.
+func (p *parser) parseAggregate() (int, error) {
+	fn := strings.ToLower(p.next().text)
+	p.next() // (
+	arg := p.next()
+	var field string
+	switch {
+	case arg.kind == tokStar && fn == "count":
+	case arg.kind == tokIdent:
+		field = arg.text
+	default:
+		return 0, fmt.Errorf("%s() at position %d takes a field", fn, arg.pos)
+	}
+	if tok := p.next(); tok.kind != tokRParen {
+		return 0, fmt.Errorf("missing ) for %s( at position %d", fn, arg.pos)
+	}
+
+	name := fn + "(" + arg.text + ")"
+	for i, a := range p.q.aggs {
+		if a.name == name {
+			return i, nil
+		}
+	}
+	p.q.aggs = append(p.q.aggs, aggregate{fn: fn, field: field, name: name})
+	return len(p.q.aggs) - 1, nil
+}
+
+func (p *parser) parseGroupBy() error {
+	if !p.next().is("BY") {
+		return fmt.Errorf("expected BY after GROUP")
+	}
+	for {
+		tok := p.next()
+		if tok.kind != tokIdent {
+			return unexpected(tok)
+		}
+		p.q.groupBy = append(p.q.groupBy, tok.text)
+		if p.peek().kind != tokComma {
+			return nil
+		}
+		p.next()
+	}
+}
+
+func (p *parser) parseOrderBy() error {
+	if !p.next().is("BY") {
+		return fmt.Errorf("expected BY after ORDER")
+	}
+	for {
+		var key orderKey
+		switch tok := p.peek(); {
+		case p.atAggregate():
+			agg, err := p.parseAggregate()
+			if err != nil {
+				return err
+			}
+			key.name = aggValueName(agg)
+		case tok.kind == tokIdent && (p.q.hasColumn(tok.text) || slices.Contains(p.q.groupBy, tok.text)):
+			p.next()
+			key.name = tok.text
+		case tok.kind == tokIdent:
+			return fmt.Errorf("ORDER BY %s: not a column, GROUP BY field or aggregate", tok.text)
+		default:
+			return unexpected(tok)
+		}
+		if p.peek().is("DESC") {
+			p.next()
+			key.desc = true
+		} else if p.peek().is("ASC") {
+			p.next()
+		}
+		p.q.orderBy = append(p.q.orderBy, key)
+		if p.peek().kind != tokComma {
+			return nil
+		}
+		p.next()
+	}
+}
+
+// clause returns the tokens up to the next clause, outside parentheses.
+func (p *parser) clause() []token {
+	start, depth := p.pos, 0
+	for tok := p.peek(); tok.kind != tokEOF; tok = p.peek() {
+		switch {
+		case tok.kind == tokLParen:
+			depth++
+		case tok.kind == tokRParen:
+			depth--
+		case depth == 0 && p.atClause():
+			return p.tokens[start:p.pos]
+		}
+		p.next()
+	}
+	return p.tokens[start:p.pos]
+}
+
+// condition compiles a WHERE or HAVING condition, translated to the
+// filter language. In HAVING, aggregate calls stand for their values.
+func (p *parser) condition(clause string, tokens []token, aggs bool) (*expr.Expr, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%s needs a condition", clause)
+	}
+	// The tokens are read through a parser of their own, which shares the
+	// query's aggregates.
+	sub := &parser{tokens: append(tokens[:len(tokens):len(tokens)], token{kind: tokEOF}), q: p.q}
+	var out []string // the condition in the filter language
+	operand := false // whether out ends with an operand
+	for tok := sub.peek(); tok.kind != tokEOF; tok = sub.peek() {
+		negate := false
+		if tok.is("NOT") && (sub.tokens[sub.pos+1].is("LIKE") || sub.tokens[sub.pos+1].is("IN")) {
+			sub.next()
+			tok, negate = sub.peek(), true
+		}
+
+		switch {
+		case tok.is("AND"), tok.is("OR"), tok.is("NOT"):
+			sub.next()
+			out = append(out, map[string]string{"AND": "&&", "OR": "||", "NOT": "!"}[strings.ToUpper(tok.text)])
+			operand = false
+			continue
+		case tok.is("LIKE"):
+			sub.next()
+			pattern := sub.next()
+			if pattern.kind != tokString {
+				return nil, fmt.Errorf("%s: LIKE at position %d takes a quoted pattern", clause, tok.pos)
+			}
+			op := "=~"
+			if negate {
+				op = "!~"
+			}
+			out = append(out, op, quote(likePattern(pattern.text)))
+		case tok.is("IN"):
+			sub.next()
+			if !operand {
+				return nil, fmt.Errorf("%s: IN at position %d needs a field before it", clause, tok.pos)
+			}
+			in, err := sub.inList(out[len(out)-1], negate)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", clause, err)
+			}
+			out[len(out)-1] = in
+		case tok.is("IS"):
+			sub.next()
+			op := "=="
+			if sub.peek().is("NOT") {
+				sub.next()
+				op = "!="
+			}
+			if !sub.next().is("NULL") {
+				return nil, fmt.Errorf("%s: expected NULL after IS at position %d", clause, tok.pos)
+			}
+			out = append(out, op, "null")
+		case sub.atAggregate():
+			if !aggs {
+				return nil, fmt.Errorf("%s cannot use aggregates; filter groups with HAVING", clause)
+			}
+			agg, err := sub.parseAggregate()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", clause, err)
+			}
+			out = append(out, aggValueName(agg))
+		case tok.kind == tokOp:
+			sub.next()
+			op := tok.text
+			switch op {
+			case "=":
+				op = "=="
+			case "<>":
+				op = "!="
+			}
+			out = append(out, op)
+			operand = false
+			continue
+		case tok.kind == tokLParen, tok.kind == tokRParen:
+			sub.next()
+			out = append(out, tok.text)
+			operand = tok.kind == tokRParen
+			continue
+		default:
+			sub.next()
+			lit, err := literal(tok)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", clause, err)
+			}
+			out = append(out, lit)
+		}
+		operand = true
+	}
+
+	e, err := expr.Compile(strings.Join(out, " "))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", clause, err)
+	}
+	return e, nil
+}
+
+// inList parses the (value, ...) list of IN and returns the filter
+// language comparing field to each value.
+func (p *parser) inList(field string, negate bool) (string, error) {
+	if tok := p.next(); tok.kind != tokLParen {
+		return "", fmt.Errorf("expected ( after IN at position %d", tok.pos)
+	}
+	var alts []string
+	for {
+		tok := p.next()
+		if tok.kind != tokNumber && tok.kind != tokString && !tok.is("TRUE") && !tok.is("FALSE") && !tok.is("NULL") {
+			return "", fmt.Errorf("IN lists values, not %q at position %d", tok.text, tok.pos)
+		}
+		lit, err := literal(tok)
+		if err != nil {
+			return "", err
+		}
+		alts = append(alts, field+" == "+lit)
+		if tok := p.next(); tok.kind == tokRParen {
+			break
+		} else if tok.kind != tokComma {
+			return "", unexpected(tok)
+		}
+	}
+	in := "(" + strings.Join(alts, " || ") + ")"
+	if negate {
+		in = "!" + in
+	}
+	return in, nil
+}
+
+// literal translates a field name, number, string, TRUE, FALSE or NULL to
+// the filter language.
+func literal(tok token) (string, error) {
+	switch {
+	case tok.kind == tokNumber:
+		return tok.text, nil
+	case tok.kind == tokString:
+		return quote(tok.text), nil
+	case tok.is("TRUE"), tok.is("FALSE"), tok.is("NULL"):
+		return strings.ToLower(tok.text), nil
+	case tok.kind == tokIdent:
+		if !filterIdent(tok.text) {
+			return "", fmt.Errorf("field %q cannot be used in a condition", tok.text)
+		}
+		return tok.text, nil
+	}
+	return "", unexpected(tok)
+}
+
+// filterIdent reports whether name reads as a field in the filter
+// language.
+func filterIdent(name string) bool {
+	switch name {
+	case "", "true", "false", "null", "nil":
+		return false
+	}
+	for i, c := range name {
+		if !isIdentPart(c) || i == 0 && !isIdentStart(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// quote quotes s as a filter language string.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// likePattern translates a LIKE pattern to a regular expression: % matches
+// any run of characters and _ any one.
+func likePattern(pattern string) string {
+	var b strings.Builder
+	b.WriteString("(?s)^")
+	for _, c := range pattern {
+		switch c {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// aggValueName is the name an aggregate's value has in the values of a
+// group that HAVING and ORDER BY see.
+func aggValueName(agg int) string {
+	return "_agg" + strconv.Itoa(agg)
+}
+
+// hasColumn reports whether the query has a column of that name.
+func (q *Query) hasColumn(name string) bool {
+	return slices.ContainsFunc(q.columns, func(c column) bool { return c.name == name })
+}
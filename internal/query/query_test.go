@@ -0,0 +1,105 @@
+package query
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse_Columns(t *testing.T) {
+	tests := []struct {
+		src     string
+		want    []string
+		grouped bool
+	}{
+		{src: "SELECT * FROM stream", want: nil},
+		{src: "select path, status from stream", want: []string{"path", "status"}},
+		{src: "SELECT path AS p, COUNT(*) n FROM stream GROUP BY path", want: []string{"p", "n"}, grouped: true},
+		{src: "SELECT count(*), avg(duration), max(`resp.bytes`)", want: []string{"count(*)", "avg(duration)", "max(resp.bytes)"}, grouped: true},
+		{src: "SELECT host FROM stream GROUP BY host, path", want: []string{"host"}, grouped: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			q, err := Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse() error: %v", err)
+			}
+			if got := q.Columns(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Columns() = %v, want %v", got, tt.want)
+			}
+			if q.Grouped() != tt.grouped {
+				t.Errorf("Grouped() = %v, want %v", q.Grouped(), tt.grouped)
+			}
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{name: "empty", src: "", want: "start with SELECT"},
+		{name: "no columns", src: "SELECT FROM stream", want: "unexpected"},
+		{name: "other table", src: "SELECT * FROM logs", want: "unknown table"},
+		{name: "star and columns", src: "SELECT *, path FROM stream", want: "SELECT *"},
+		{name: "column not grouped", src: "SELECT path, count(*) FROM stream", want: "must be in GROUP BY"},
+		{name: "aggregate in where", src: "SELECT count(*) FROM stream WHERE count(*) > 1", want: "HAVING"},
+		{name: "order without groups", src: "SELECT path FROM stream ORDER BY path", want: "need GROUP BY"},
+		{name: "order by unknown", src: "SELECT count(*) FROM stream ORDER BY path", want: "ORDER BY path"},
+		{name: "sum of star", src: "SELECT sum(*) FROM stream", want: "takes a field"},
+		{name: "unclosed call", src: "SELECT count(path FROM stream", want: "missing )"},
+		{name: "column twice", src: "SELECT path, path FROM stream", want: "selected twice"},
+		{name: "bad limit", src: "SELECT path FROM stream LIMIT -1", want: "invalid LIMIT"},
+		{name: "empty where", src: "SELECT path FROM stream WHERE", want: "needs a condition"},
+		{name: "incomplete where", src: "SELECT path FROM stream WHERE status =", want: "WHERE"},
+		{name: "in without list", src: "SELECT path FROM stream WHERE status IN 200", want: "expected ("},
+		{name: "in with fields", src: "SELECT path FROM stream WHERE status IN (a)", want: "IN lists values"},
+		{name: "like without pattern", src: "SELECT path FROM stream WHERE path LIKE 1", want: "quoted pattern"},
+		{name: "is without null", src: "SELECT path FROM stream WHERE path IS 1", want: "NULL"},
+		{name: "odd field in condition", src: "SELECT path FROM stream WHERE `user agent` = 'x'", want: "cannot be used"},
+		{name: "trailing tokens", src: "SELECT path FROM stream LIMIT 1 2", want: "unexpected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.src)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse(%q) error = %v, want it to mention %q", tt.src, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_Conditions(t *testing.T) {
+	entry := map[string]any{"status": 503, "path": "/api/users", "method": "GET", "user": nil, "msg": `say "hi" \o/`}
+	tests := []struct {
+		where string
+		want  bool
+	}{
+		{where: "status >= 500", want: true},
+		{where: "status = 503 AND method = 'GET'", want: true},
+		{where: "status <> 503 OR method = 'POST'", want: false},
+		{where: "NOT (status < 500)", want: true},
+		{where: "path LIKE '/api/%'", want: true},
+		{where: "path LIKE '/api/user_'", want: true},
+		{where: "path LIKE '/api'", want: false},
+		{where: "path NOT LIKE '%.css'", want: true},
+		{where: "method IN ('GET', 'HEAD')", want: true},
+		{where: "status NOT IN (500, 503)", want: false},
+		{where: "user IS NULL AND path IS NOT NULL", want: true},
+		{where: "missing IS NULL", want: true},
+		{where: "path =~ '^/api/'", want: true},
+		{where: `msg = 'say "hi" \o/'`, want: true},
+		{where: "(status = 200 OR status = 503) AND method != 'PUT'", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.where, func(t *testing.T) {
+			q, err := Parse("SELECT * FROM stream WHERE " + tt.where)
+			if err != nil {
+				t.Fatalf("Parse() error: %v", err)
+			}
+			if got := q.where.Match(entry); got != tt.want {
+				t.Errorf("WHERE %s = %v, want %v", tt.where, got, tt.want)
+			}
+		})
+	}
+}
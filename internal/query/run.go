@@ -0,0 +1,255 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juliosaraiva/log2json/internal/expr"
+)
+
+// maxGroups bounds the groups a Run adds up: entries of further groups
+// are left out of its rows, rather than letting memory grow.
+const maxGroups = 100000
+
+// Run is one execution of a query, over the whole input or a window of
+// it. It is not safe for concurrent use.
+type Run struct {
+	q      *Query
+	groups map[string]*group
+	order  []*group // groups in the order they were first seen
+	rows   int      // rows returned, for LIMIT without groups
+}
+
+// group is what a Run keeps of the entries sharing GROUP BY values.
+type group struct {
+	values []any // the GROUP BY fields' values
+	aggs   []aggState
+}
+
+// aggState is the running state of an aggregate in a group.
+type aggState struct {
+	count    int     // entries for count(*), values for count(field), numbers for the rest
+	sum      float64 // of the numbers
+	min, max float64
+}
+
+// Start begins a run of the query.
+func (q *Query) Start() *Run {
+	return &Run{q: q, groups: make(map[string]*group)}
+}
+
+// Add runs the query over an entry's fields. Without groups, it returns
+// the entry's row, and ok once it matches WHERE and is within LIMIT; for
+// SELECT * the row is fields itself. With groups, the entry is added to
+// its group and Add returns no row: Rows returns them at the end.
+func (r *Run) Add(fields map[string]any) (row map[string]any, ok bool) {
+	q := r.q
+	if q.where != nil && !q.where.Match(fields) {
+		return nil, false
+	}
+	if !q.Grouped() {
+		if q.limit > 0 && r.rows >= q.limit {
+			return nil, false
+		}
+		r.rows++
+		if q.star {
+			return fields, true
+		}
+		row = make(map[string]any, len(q.columns))
+		for _, c := range q.columns {
+			row[c.name], _ = expr.Lookup(fields, c.field)
+		}
+		return row, true
+	}
+
+	values := make([]any, len(q.groupBy))
+	var key strings.Builder
+	for i, f := range q.groupBy {
+		values[i], _ = expr.Lookup(fields, f)
+		writeKey(&key, values[i])
+	}
+	g := r.groups[key.String()]
+	if g == nil {
+		if len(r.order) >= maxGroups {
+			return nil, false
+		}
+		// The values may be slices of the line, sharing its memory with
+		// other lines, so the group keeps copies
+		for i, v := range values {
+			if s, ok := v.(string); ok {
+				values[i] = strings.Clone(s)
+			}
+		}
+		g = &group{values: values, aggs: make([]aggState, len(q.aggs))}
+		r.groups[key.String()] = g
+		r.order = append(r.order, g)
+	}
+	for i, a := range q.aggs {
+		var v any = true // counted by count(*)
+		if a.field != "" {
+			v, _ = expr.Lookup(fields, a.field)
+		}
+		g.aggs[i].add(a.fn, v)
+	}
+	return nil, false
+}
+
+// Rows returns the rows of the groups: those HAVING keeps, in ORDER BY
+// order, or the order they were first seen, up to LIMIT. A query with
+// aggregates but no GROUP BY has one row even without entries, as its
+// count of 0. Without groups, Rows returns nil.
+func (r *Run) Rows() []map[string]any {
+	q := r.q
+	if !q.Grouped() {
+		return nil
+	}
+	if len(r.order) == 0 && len(q.groupBy) == 0 {
+		r.order = append(r.order, &group{aggs: make([]aggState, len(q.aggs))})
+	}
+
+	type result struct {
+		row  map[string]any
+		vals map[string]any // what HAVING and ORDER BY see
+	}
+	var results []result
+	for _, g := range r.order {
+		vals := make(map[string]any, len(q.groupBy)+len(q.aggs)+len(q.columns))
+		for i, f := range q.groupBy {
+			vals[f] = g.values[i]
+		}
+		for i, a := range q.aggs {
+			vals[aggValueName(i)] = g.aggs[i].value(a.fn)
+		}
+		row := make(map[string]any, len(q.columns))
+		for _, c := range q.columns {
+			if c.field != "" {
+				row[c.name] = vals[c.field]
+			} else {
+				row[c.name] = vals[aggValueName(c.agg)]
+			}
+			vals[c.name] = row[c.name]
+		}
+		if q.having != nil && !q.having.Match(vals) {
+			continue
+		}
+		results = append(results, result{row, vals})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		for _, k := range q.orderBy {
+			c := compareValues(results[i].vals[k.name], results[j].vals[k.name])
+			if c != 0 {
+				return c < 0 != k.desc
+			}
+		}
+		return false
+	})
+	if q.limit > 0 && len(results) > q.limit {
+		results = results[:q.limit]
+	}
+	rows := make([]map[string]any, len(results))
+	for i, res := range results {
+		rows[i] = res.row
+	}
+	return rows
+}
+
+// add counts a value of the aggregate's field.
+func (s *aggState) add(fn string, v any) {
+	if v == nil {
+		return
+	}
+	if fn == "count" {
+		s.count++
+		return
+	}
+	f, ok := number(v)
+	if !ok {
+		return
+	}
+	if s.count == 0 || f < s.min {
+		s.min = f
+	}
+	if s.count == 0 || f > s.max {
+		s.max = f
+	}
+	s.count++
+	s.sum += f
+}
+
+// value returns the aggregate's value: null for sum, avg, min and max of
+// no numbers, as in SQL.
+func (s *aggState) value(fn string) any {
+	if fn == "count" {
+		return s.count
+	}
+	if s.count == 0 {
+		return nil
+	}
+	switch fn {
+	case "sum":
+		return s.sum
+	case "avg":
+		return s.sum / float64(s.count)
+	case "min":
+		return s.min
+	}
+	return s.max
+}
+
+// writeKey adds a GROUP BY value to a group's key.
+func writeKey(b *strings.Builder, v any) {
+	if v == nil {
+		b.WriteString("\x01")
+	} else {
+		_, _ = fmt.Fprint(b, v)
+	}
+	b.WriteByte(0)
+}
+
+// compareValues orders two values for ORDER BY: nulls first, then
+// numerically if both are numbers, and otherwise as text.
+func compareValues(a, b any) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	if fa, ok := number(a); ok {
+		if fb, ok := number(b); ok {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// number converts numeric values (and numeric strings) to float64.
+func number(v any) (float64, bool) {
+	switch x := v.(type) {
+	case int:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case float64:
+		return x, true
+	case json.Number:
+		f, err := x.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(x, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,145 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+var requests = []map[string]any{
+	{"path": "/a", "status": 200, "duration": 10},
+	{"path": "/b", "status": 500, "duration": 300},
+	{"path": "/a", "status": 503, "duration": "50"},
+	{"path": "/c", "status": 500},
+	{"path": "/a", "status": 500, "duration": 90},
+	{"status": 502, "duration": 5},
+}
+
+func runAll(t *testing.T, src string) (streamed, rows []map[string]any) {
+	t.Helper()
+	q, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	run := q.Start()
+	for _, fields := range requests {
+		if row, ok := run.Add(fields); ok {
+			streamed = append(streamed, row)
+		}
+	}
+	return streamed, run.Rows()
+}
+
+func TestRun_GroupCopiesValues(t *testing.T) {
+	// The value is a view of a buffer, as values sliced from lines in the
+	// reader's shared blocks are; the group must not refer to it
+	q, err := Parse("SELECT path, count(*) AS n FROM stream GROUP BY path")
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	buf := []byte("/a")
+	run := q.Start()
+	run.Add(map[string]any{"path": unsafe.String(unsafe.SliceData(buf), len(buf))})
+	copy(buf, "/x")
+	want := []map[string]any{{"path": "/a", "n": 1}}
+	if rows := run.Rows(); !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %v, want %v", rows, want)
+	}
+}
+
+func TestRun_Select(t *testing.T) {
+	streamed, rows := runAll(t, "SELECT path, duration AS ms FROM stream WHERE status >= 500 LIMIT 3")
+	want := []map[string]any{
+		{"path": "/b", "ms": 300},
+		{"path": "/a", "ms": "50"},
+		{"path": "/c", "ms": nil},
+	}
+	if !reflect.DeepEqual(streamed, want) {
+		t.Errorf("rows = %v, want %v", streamed, want)
+	}
+	if rows != nil {
+		t.Errorf("Rows() = %v for a query without groups", rows)
+	}
+
+	streamed, _ = runAll(t, "SELECT * FROM stream WHERE path IS NULL")
+	if len(streamed) != 1 || streamed[0]["status"] != 502 {
+		t.Errorf("SELECT * rows = %v", streamed)
+	}
+}
+
+func TestRun_GroupBy(t *testing.T) {
+	streamed, rows := runAll(t, "SELECT path, count(*) AS n, count(duration), sum(duration), avg(duration), min(duration), max(duration) FROM stream WHERE status >= 500 GROUP BY path")
+	if streamed != nil {
+		t.Errorf("a grouping query streamed %v", streamed)
+	}
+	want := []map[string]any{
+		{"path": "/b", "n": 1, "count(duration)": 1, "sum(duration)": 300.0, "avg(duration)": 300.0, "min(duration)": 300.0, "max(duration)": 300.0},
+		{"path": "/a", "n": 2, "count(duration)": 2, "sum(duration)": 140.0, "avg(duration)": 70.0, "min(duration)": 50.0, "max(duration)": 90.0},
+		{"path": "/c", "n": 1, "count(duration)": 0, "sum(duration)": nil, "avg(duration)": nil, "min(duration)": nil, "max(duration)": nil},
+		{"path": nil, "n": 1, "count(duration)": 1, "sum(duration)": 5.0, "avg(duration)": 5.0, "min(duration)": 5.0, "max(duration)": 5.0},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %v, want %v", rows, want)
+	}
+}
+
+func TestRun_HavingOrderLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []map[string]any
+	}{
+		{
+			name: "having an aggregate not selected",
+			src:  "SELECT path FROM stream GROUP BY path HAVING count(*) > 1",
+			want: []map[string]any{{"path": "/a"}},
+		},
+		{
+			name: "having an alias",
+			src:  "SELECT path, count(*) AS n FROM stream GROUP BY path HAVING n = 1 AND path IS NOT NULL",
+			want: []map[string]any{{"path": "/b", "n": 1}, {"path": "/c", "n": 1}},
+		},
+		{
+			name: "order by an aggregate, then a field",
+			src:  "SELECT path, max(duration) FROM stream GROUP BY path ORDER BY count(*) DESC, path LIMIT 3",
+			want: []map[string]any{{"path": "/a", "max(duration)": 90.0}, {"path": nil, "max(duration)": 5.0}, {"path": "/b", "max(duration)": 300.0}},
+		},
+		{
+			name: "order by a column",
+			src:  "SELECT status, count(*) AS n FROM stream GROUP BY status ORDER BY status DESC LIMIT 2",
+			want: []map[string]any{{"status": 503, "n": 1}, {"status": 502, "n": 1}},
+		},
+		{
+			name: "aggregates of no entries",
+			src:  "SELECT count(*), sum(duration) FROM stream WHERE status = 404",
+			want: []map[string]any{{"count(*)": 0, "sum(duration)": nil}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, rows := runAll(t, tt.src)
+			if !reflect.DeepEqual(rows, tt.want) {
+				t.Errorf("rows = %v, want %v", rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareValues(t *testing.T) {
+	tests := []struct {
+		a, b any
+		want int
+	}{
+		{nil, 1, -1},
+		{2, nil, 1},
+		{nil, nil, 0},
+		{9, "10", -1},
+		{"b", "a", 1},
+		{1.5, 1.5, 0},
+	}
+	for _, tt := range tests {
+		if got := compareValues(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareValues(%v, %v) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package reader
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// Bounds of the read buffer when it adapts to the input.
+const (
+	minReadBuffer = 4 * 1024
+	maxReadBuffer = 1024 * 1024
+)
+
+// maxEmptyReads is how many reads in a row may return nothing before
+// reading fails with io.ErrNoProgress, as in bufio.Scanner.
+const maxEmptyReads = 100
+
+// bufferedLines splits its input into lines as bufio.Scanner does with
+// ScanLines, through a buffer sized to the input rather than a fixed one.
+// The buffer starts small, so a trickle of short lines costs little, and
+// doubles up to maxReadBuffer while reads keep filling it, as they do
+// from a file or a busy pipe, so that large inputs take fewer, larger
+// reads. A fixed buffer keeps its size. Either way, the buffer grows to
+// fit a long line, and a line that does not fit in limit bytes with its
+// newline fails with bufio.ErrTooLong.
+type bufferedLines struct {
+	r     io.Reader
+	buf   []byte
+	start int // first byte not yet returned
+	end   int // end of the bytes read
+	limit int
+	fixed bool
+	full  bool // the last read filled the buffer
+	line  []byte
+	err   error
+}
+
+func newBufferedLines(r io.Reader, size, limit int, fixed bool) *bufferedLines {
+	return &bufferedLines{r: r, buf: make([]byte, size), limit: limit, fixed: fixed}
+}
+
+func (s *bufferedLines) Scan() bool {
+	for {
+		data := s.buf[s.start:s.end]
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			if i >= s.limit {
+				return s.tooLong()
+			}
+			s.line = dropCR(data[:i])
+			s.start += i + 1
+			return true
+		}
+		if len(data) >= s.limit {
+			return s.tooLong()
+		}
+		if s.err != nil {
+			// The last line, without a newline
+			if len(data) == 0 {
+				s.line = nil
+				return false
+			}
+			s.line = dropCR(data)
+			s.start = s.end
+			return true
+		}
+		s.fill()
+	}
+}
+
+func (s *bufferedLines) Bytes() []byte {
+	return s.line
+}
+
+func (s *bufferedLines) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
+
+// tooLong stops reading at a line over the limit.
+func (s *bufferedLines) tooLong() bool {
+	s.err = bufio.ErrTooLong
+	s.start, s.end = 0, 0
+	s.line = nil
+	return false
+}
+
+// fill reads more input after the bytes not yet returned, first moving
+// them to the front of the buffer and growing it if it is due.
+func (s *bufferedLines) fill() {
+	pending := s.end - s.start
+	size := len(s.buf)
+	if pending == size {
+		size = min(2*size, s.limit)
+	}
+	if s.full && !s.fixed && size < maxReadBuffer {
+		size = max(size, min(2*len(s.buf), maxReadBuffer))
+	}
+	if size != len(s.buf) {
+		buf := make([]byte, size)
+		copy(buf, s.buf[s.start:s.end])
+		s.buf = buf
+	} else if s.start > 0 {
+		copy(s.buf, s.buf[s.start:s.end])
+	}
+	s.start, s.end = 0, pending
+
+	for i := 0; i < maxEmptyReads; i++ {
+		n, err := s.r.Read(s.buf[s.end:])
+		s.full = n == len(s.buf)-s.end
+		s.end += n
+		if err != nil {
+			s.err = err
+			return
+		}
+		if n > 0 {
+			return
+		}
+	}
+	s.err = io.ErrNoProgress
+}
+
+// dropCR drops a trailing \r, as ScanLines does.
+func dropCR(b []byte) []byte {
+	if len(b) > 0 && b[len(b)-1] == '\r' {
+		return b[:len(b)-1]
+	}
+	return b
+}
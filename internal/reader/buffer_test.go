@@ -0,0 +1,128 @@
+package reader
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// scanAll returns src's lines and the read error.
+func scanAll(src lineSource) ([]string, error) {
+	var lines []string
+	for src.Scan() {
+		lines = append(lines, string(src.Bytes()))
+	}
+	return lines, src.Err()
+}
+
+func TestBufferedLines_MatchesScanner(t *testing.T) {
+	limit := DefaultBufferSize
+	errRead := errors.New("read failed")
+	inputs := []struct {
+		name  string
+		input string
+	}{
+		{"empty", ""},
+		{"lines", "a=1\nb=2\nc=3\n"},
+		{"no final newline", "a\nb"},
+		{"blank and CRLF lines", "a\r\n\r\n\nb\r\nc\r"},
+		{"only newlines", "\n\n\n"},
+		{"lines over the initial buffer", strings.Repeat(strings.Repeat("y", 5000)+"\n", 20)},
+		{"many short lines", strings.Repeat("<13>Jan 1 00:00:00 host app: hi\n", 5000)},
+		{"longest line", "a\n" + strings.Repeat("x", limit-1) + "\nb\n"},
+		{"line too long", "a\n" + strings.Repeat("x", limit) + "\nb\n"},
+		{"last line too long", "a\n" + strings.Repeat("x", limit)},
+		{"longest last line", "a\n" + strings.Repeat("x", limit-1)},
+		{"CRLF line too long", "a\n" + strings.Repeat("x", limit-1) + "\r\nb\n"},
+	}
+	readers := []struct {
+		name string
+		wrap func(io.Reader) io.Reader
+	}{
+		{"whole", func(r io.Reader) io.Reader { return r }},
+		{"one byte", iotest.OneByteReader},
+		{"half", iotest.HalfReader},
+		{"data with EOF", iotest.DataErrReader},
+		{"read error", func(r io.Reader) io.Reader { return io.MultiReader(r, iotest.ErrReader(errRead)) }},
+	}
+	sizes := []struct {
+		name  string
+		size  int
+		fixed bool
+	}{
+		{"adaptive", minReadBuffer, false},
+		{"fixed small", 16, true},
+		{"fixed large", 4 * limit, true},
+	}
+
+	for _, in := range inputs {
+		for _, rd := range readers {
+			if in.name == "last line too long" && rd.name == "data with EOF" {
+				// bufio.Scanner takes a last line that fills its buffer if
+				// EOF comes with the read that filled it; bufferedLines, like
+				// mappedLines, rejects it however the input is read
+				continue
+			}
+			scanner := bufio.NewScanner(rd.wrap(strings.NewReader(in.input)))
+			scanner.Buffer(make([]byte, 16), limit)
+			want, wantErr := scanAll(scanner)
+			for _, sz := range sizes {
+				t.Run(in.name+"/"+rd.name+"/"+sz.name, func(t *testing.T) {
+					src := newBufferedLines(rd.wrap(strings.NewReader(in.input)), sz.size, limit, sz.fixed)
+					got, err := scanAll(src)
+					if err != wantErr {
+						t.Errorf("error = %v, want %v", err, wantErr)
+					}
+					if !reflect.DeepEqual(got, want) {
+						t.Errorf("got %d lines, want %d", len(got), len(want))
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestBufferedLines_AdaptsToInput(t *testing.T) {
+	input := bytes.Repeat([]byte("0123456789abcdef\n"), 200000)
+
+	tests := []struct {
+		name  string
+		r     io.Reader
+		size  int
+		fixed bool
+		want  int
+	}{
+		{name: "grows while reads fill it", r: bytes.NewReader(input), size: minReadBuffer, want: maxReadBuffer},
+		{name: "stays small for a trickle", r: iotest.HalfReader(iotest.OneByteReader(bytes.NewReader(input[:50000]))), size: minReadBuffer, want: minReadBuffer},
+		{name: "fixed", r: bytes.NewReader(input), size: 8192, fixed: true, want: 8192},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := newBufferedLines(tt.r, tt.size, DefaultMaxLineSize, tt.fixed)
+			for src.Scan() {
+			}
+			if err := src.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if got := len(src.buf); got != tt.want {
+				t.Errorf("buffer = %d bytes, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithBufferSize(t *testing.T) {
+	input := "a\n" + strings.Repeat("x", 100) + "\nb"
+	lines, err := New(strings.NewReader(input), WithBufferSize(8)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 3 || len(lines[1].Text) != 100 || lines[2].Text != "b" {
+		t.Errorf("lines = %v", lines)
+	}
+}
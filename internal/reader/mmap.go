@@ -0,0 +1,73 @@
+package reader
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// errNotMappable reports a file that mapFile cannot map.
+var errNotMappable = errors.New("not a regular file that can be mapped")
+
+// mappedLines reads the lines of a memory-mapped file as bufio.Scanner
+// splits them with ScanLines: a trailing \r is dropped, a last line
+// without a newline counts, and a line that does not fit in the scanner's
+// buffer (bufSize) fails with bufio.ErrTooLong.
+type mappedLines struct {
+	data    []byte // the whole mapping
+	pos     int    // offset of the next line
+	line    []byte
+	bufSize int
+	err     error
+	read    *atomic.Int64
+}
+
+// mapLines maps f and starts at its current offset. The mapping is never
+// released, since lines are views of it.
+func mapLines(f *os.File, bufSize int, read *atomic.Int64) (*mappedLines, error) {
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	data, err := mapFile(f)
+	if err != nil {
+		return nil, err
+	}
+	if offset > int64(len(data)) {
+		_ = unmapFile(data)
+		return nil, errNotMappable
+	}
+	return &mappedLines{data: data, pos: int(offset), bufSize: bufSize, read: read}, nil
+}
+
+func (m *mappedLines) Scan() bool {
+	if m.err != nil || m.pos >= len(m.data) {
+		return false
+	}
+	rest := m.data[m.pos:]
+	line, n := rest, len(rest)
+	if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+		line, n = rest[:i], i+1
+	}
+	if len(line) >= m.bufSize {
+		m.err = bufio.ErrTooLong
+		return false
+	}
+	m.pos += n
+	if m.read != nil {
+		m.read.Add(int64(n))
+	}
+	m.line = dropCR(line)
+	return true
+}
+
+func (m *mappedLines) Bytes() []byte {
+	return m.line
+}
+
+func (m *mappedLines) Err() error {
+	return m.err
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd
+
+package reader
+
+import "os"
+
+// mapFile is not supported here; files are read as usual.
+func mapFile(*os.File) ([]byte, error) {
+	return nil, errNotMappable
+}
+
+func unmapFile([]byte) error {
+	return nil
+}
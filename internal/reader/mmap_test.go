@@ -0,0 +1,101 @@
+package reader
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// readFile reads path's lines with opts, from offset, returning them, the
+// bytes counted and the read error.
+func readFile(t *testing.T, path string, offset int64, opts ...Option) ([]Line, int64, error) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	var n atomic.Int64
+	lines, err := New(f, append(opts, WithReadCounter(&n))...).ReadAll()
+	return lines, n.Load(), err
+}
+
+func TestWithMmap_MatchesScanner(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		offset int64
+	}{
+		{name: "lines", input: "a=1\nb=2\nc=3\n"},
+		{name: "no final newline", input: "a\nb"},
+		{name: "blank and CRLF lines", input: "a\r\n\r\n\nb\r\nc\r"},
+		{name: "only newlines", input: "\n\n\n"},
+		{name: "from the file offset", input: "skip\nkeep\nthis\n", offset: 5},
+		{name: "offset at the end", input: "done\n", offset: 5},
+		{name: "longest line", input: "a\n" + strings.Repeat("x", DefaultBufferSize-1) + "\nb\n"},
+		{name: "line too long", input: "a\n" + strings.Repeat("x", DefaultBufferSize) + "\nb\n"},
+		{name: "last line too long", input: "a\n" + strings.Repeat("x", DefaultBufferSize)},
+		{name: "CRLF line too long", input: "a\n" + strings.Repeat("x", DefaultBufferSize-1) + "\r\nb\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "input.log")
+			if err := os.WriteFile(path, []byte(tt.input), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			want, wantRead, wantErr := readFile(t, path, tt.offset)
+			got, read, err := readFile(t, path, tt.offset, WithMmap())
+			if err != wantErr {
+				t.Errorf("error = %v, want %v", err, wantErr)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("lines = %v, want %v", got, want)
+			}
+			if wantErr == nil && read != wantRead {
+				t.Errorf("read %d bytes, want %d", read, wantRead)
+			}
+		})
+	}
+}
+
+func TestWithMmap_MapsRegularFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.log")
+	if err := os.WriteFile(path, []byte("a\nb\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	r := New(f, WithMmap())
+	r.open()
+	if !r.mapped {
+		if _, err := mapFile(f); err == errNotMappable {
+			t.Skip("memory mapping is not supported here")
+		}
+		t.Fatal("regular file was not mapped")
+	}
+
+	// A pipe cannot be mapped, and is read as usual
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_, _ = pw.WriteString("a\nb\n")
+		_ = pw.Close()
+	}()
+	lines, err := New(pr, WithMmap()).ReadAll()
+	if err != nil || len(lines) != 2 || lines[1].Text != "b" {
+		t.Errorf("pipe lines = %v, %v", lines, err)
+	}
+}
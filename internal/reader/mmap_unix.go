@@ -0,0 +1,25 @@
+//go:build linux || darwin || freebsd
+
+package reader
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps the whole of a regular file, read-only.
+func mapFile(f *os.File) ([]byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if !info.Mode().IsRegular() || size <= 0 || int64(int(size)) != size {
+		return nil, errNotMappable
+	}
+	return syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func unmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
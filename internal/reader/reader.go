@@ -2,14 +2,22 @@
 package reader
 
 import (
-	"bufio"
+	"context"
 	"io"
+	"os"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
 )
 
 // Default configuration values.
 const (
 	DefaultMaxLineSize = 1024 * 1024 // 1MB max line size
-	DefaultBufferSize  = 64 * 1024   // 64KB initial buffer
+	DefaultBufferSize  = 64 * 1024   // 64KB: lines this long always fit
+
+	// arenaBlockSize is the size of the blocks lines are copied into.
+	arenaBlockSize = 64 * 1024
 )
 
 // Line represents a single line read from the input stream.
@@ -23,14 +31,43 @@ type Line struct {
 	// Err contains any error that occurred reading this line.
 	// If Err is non-nil, Text may be empty.
 	Err error
+
+	// Fields holds fields that arrived with the line, from inputs that
+	// carry structured records rather than plain text. Fields parsed from
+	// Text take precedence over them.
+	Fields map[string]any
+
+	// Entry, if set, is the line already parsed, by an input that parses
+	// lines itself (such as one ordering lines from several files by
+	// their timestamps); it is used instead of parsing Text again.
+	Entry *parser.Entry
 }
 
 // StreamReader reads lines from an io.Reader in a streaming fashion.
 // Designed for processing stdin in real-time (pipe-friendly).
 type StreamReader struct {
-	scanner    *bufio.Scanner
+	scanner    lineSource
 	lineNumber int
 	maxSize    int
+	bufSize    int // fixed read buffer, for WithBufferSize
+	arena      lineArena
+
+	// For WithMmap: the file to map once reading starts, and whether
+	// lines come from the mapping
+	mmap   bool
+	file   *os.File
+	mapped bool
+
+	// read counts the bytes consumed, for WithReadCounter
+	read *atomic.Int64
+}
+
+// lineSource yields the input's lines, without their newlines, as
+// bufio.Scanner does.
+type lineSource interface {
+	Scan() bool
+	Bytes() []byte
+	Err() error
 }
 
 // Option configures the StreamReader.
@@ -44,6 +81,39 @@ func WithMaxLineSize(size int) Option {
 	}
 }
 
+// WithBufferSize reads through a buffer of size bytes, grown only to fit
+// a long line, instead of one that adapts to the input: it starts at
+// 4KB and doubles up to 1MB while reads keep filling it.
+func WithBufferSize(size int) Option {
+	return func(r *StreamReader) {
+		r.bufSize = size
+	}
+}
+
+// WithMmap reads an input that is a regular file by mapping it into
+// memory: lines are the mapping's own bytes, found without copying the
+// file through a scanner buffer, which is faster on large files. The file
+// is read from its current offset up to its size when reading starts;
+// other inputs, and files that cannot be mapped, are read as usual.
+//
+// As lines, and any strings sliced from them, may be kept anywhere, the
+// mapping is never released: use it once per process, for a file that is
+// not truncated while the process runs (on most systems, touching the
+// lost pages kills it).
+func WithMmap() Option {
+	return func(r *StreamReader) {
+		r.mmap = true
+	}
+}
+
+// WithReadCounter adds the number of bytes read from the input to n as
+// reading goes.
+func WithReadCounter(n *atomic.Int64) Option {
+	return func(r *StreamReader) {
+		r.read = n
+	}
+}
+
 // New creates a StreamReader from an io.Reader.
 // The reader processes input line-by-line, suitable for streaming.
 func New(input io.Reader, opts ...Option) *StreamReader {
@@ -55,39 +125,68 @@ func New(input io.Reader, opts ...Option) *StreamReader {
 	for _, opt := range opts {
 		opt(reader)
 	}
+	if f, ok := input.(*os.File); ok && reader.mmap {
+		reader.file = f
+	}
+	if reader.read != nil {
+		input = countingReader{r: input, n: reader.read}
+	}
 
-	// Create scanner with custom buffer
-	scanner := bufio.NewScanner(input)
-	buf := make([]byte, DefaultBufferSize)
-	scanner.Buffer(buf, reader.maxSize)
-
-	reader.scanner = scanner
+	if reader.bufSize > 0 {
+		reader.scanner = newBufferedLines(input, reader.bufSize, reader.lineLimit(), true)
+	} else {
+		reader.scanner = newBufferedLines(input, minReadBuffer, reader.lineLimit(), false)
+	}
 	return reader
 }
 
+// lineLimit is the bytes a line and its newline may take: the larger of
+// the maximum line size and DefaultBufferSize, as bufio.Scanner allows
+// lines as long as its initial buffer.
+func (r *StreamReader) lineLimit() int {
+	return max(r.maxSize, DefaultBufferSize)
+}
+
 // Lines returns a channel that yields lines as they are read.
 // The channel is closed when EOF is reached or an error occurs.
 // This method should only be called once per reader.
 func (r *StreamReader) Lines() <-chan Line {
+	return r.LinesContext(context.Background())
+}
+
+// LinesContext is like Lines, but also stops reading and closes the
+// channel once ctx is done, so callers can stop early without leaking
+// the reading goroutine. A read already blocked in the underlying
+// reader still has to return first.
+func (r *StreamReader) LinesContext(ctx context.Context) <-chan Line {
 	lines := make(chan Line)
 
 	go func() {
 		defer close(lines)
+		r.open()
+
+		send := func(line Line) bool {
+			select {
+			case lines <- line:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
 
 		for r.scanner.Scan() {
 			r.lineNumber++
-			lines <- Line{
-				Text:   r.scanner.Text(),
-				Number: r.lineNumber,
+			if !send(Line{Text: r.text(), Number: r.lineNumber}) {
+				return
 			}
 		}
 
 		// Check for scanner errors (not EOF)
 		if err := r.scanner.Err(); err != nil {
-			lines <- Line{
+			send(Line{
 				Number: r.lineNumber + 1,
 				Err:    err,
-			}
+			})
 		}
 	}()
 
@@ -97,12 +196,13 @@ func (r *StreamReader) Lines() <-chan Line {
 // ReadAll reads all lines synchronously and returns them as a slice.
 // Useful for testing; for production use Lines() for streaming.
 func (r *StreamReader) ReadAll() ([]Line, error) {
+	r.open()
 	var lines []Line
 
 	for r.scanner.Scan() {
 		r.lineNumber++
 		lines = append(lines, Line{
-			Text:   r.scanner.Text(),
+			Text:   r.text(),
 			Number: r.lineNumber,
 		})
 	}
@@ -113,3 +213,66 @@ func (r *StreamReader) ReadAll() ([]Line, error) {
 
 	return lines, nil
 }
+
+// open switches to reading the file WithMmap asked for through a memory
+// mapping, if it can be mapped.
+func (r *StreamReader) open() {
+	f := r.file
+	r.file = nil
+	if f == nil {
+		return
+	}
+	if m, err := mapLines(f, r.lineLimit(), r.read); err == nil {
+		r.scanner, r.mapped = m, true
+	}
+}
+
+// text returns the line just scanned as a string: a view of the mapping,
+// which is never released, or a copy in the arena.
+func (r *StreamReader) text() string {
+	b := r.scanner.Bytes()
+	if r.mapped {
+		// #nosec G103 -- the mapping is read-only and never released
+		return unsafe.String(unsafe.SliceData(b), len(b))
+	}
+	return r.arena.text(b)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// lineArena copies lines out of the scanner's buffer into shared blocks,
+// so that reading a line costs a copy but not an allocation of its own.
+// A block stays alive while any line in it, or any field value sliced
+// from one, is still referenced.
+type lineArena struct {
+	block []byte
+}
+
+// text returns b as a string in the arena. Lines over a quarter of a
+// block get their own allocation, so that a block is not mostly wasted.
+func (a *lineArena) text(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	if len(b) > arenaBlockSize/4 {
+		return string(b)
+	}
+	if len(b) > cap(a.block)-len(a.block) {
+		a.block = make([]byte, 0, arenaBlockSize)
+	}
+	start := len(a.block)
+	a.block = append(a.block, b...)
+	line := a.block[start:len(a.block):len(a.block)]
+	// #nosec G103 -- the block's bytes are never modified after this
+	return unsafe.String(unsafe.SliceData(line), len(line))
+}
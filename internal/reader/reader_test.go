@@ -2,6 +2,7 @@ package reader
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"strings"
 	"testing"
@@ -226,3 +227,51 @@ func TestStreamReader_WithMaxLineSize(t *testing.T) {
 		}
 	})
 }
+
+func TestStreamReader_LinesContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	lines := New(strings.NewReader(strings.Repeat("line\n", 1000))).LinesContext(ctx)
+
+	if line := <-lines; line.Text != "line" || line.Number != 1 {
+		t.Fatalf("first line = %+v", line)
+	}
+	cancel()
+
+	// The channel closes without the rest of the input being read
+	n := 0
+	for range lines {
+		n++
+	}
+	if n > 1 {
+		t.Errorf("received %d lines after cancel, want at most 1", n)
+	}
+}
+
+func TestLineArena(t *testing.T) {
+	var a lineArena
+	buf := []byte("first")
+	first := a.text(buf)
+	copy(buf, "XXXXX")
+	if first != "first" {
+		t.Errorf("text = %q after the source changed, want %q", first, "first")
+	}
+
+	// Fill past a block, and past the size lines are copied in blocks
+	var texts, want []string
+	for _, n := range []int{arenaBlockSize / 4, arenaBlockSize/4 + 1, 100, arenaBlockSize / 4, arenaBlockSize / 4, 1} {
+		b := []byte(strings.Repeat(string(rune('a'+len(texts))), n))
+		texts = append(texts, a.text(b))
+		want = append(want, string(b))
+		for i := range b {
+			b[i] = '!'
+		}
+	}
+	for i := range texts {
+		if texts[i] != want[i] {
+			t.Errorf("text %d changed: got %d bytes starting %q", i, len(texts[i]), texts[i][:1])
+		}
+	}
+	if got := a.text(nil); got != "" {
+		t.Errorf("text(nil) = %q, want empty", got)
+	}
+}
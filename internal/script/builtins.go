@@ -0,0 +1,678 @@
+package script
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// builtins are the predeclared functions available to every script.
+// Populated in init because several builtins call back into the
+// interpreter, which itself looks names up here.
+var builtins map[string]*builtin
+
+func init() {
+	builtins = make(map[string]*builtin)
+	for name, fn := range map[string]func(*interp, []any, map[string]any) (any, error){
+		"abs":       builtinAbs,
+		"bool":      builtinBool,
+		"dict":      builtinDict,
+		"enumerate": builtinEnumerate,
+		"fail":      builtinFail,
+		"float":     builtinFloat,
+		"int":       builtinInt,
+		"len":       builtinLen,
+		"list":      builtinList,
+		"max":       builtinMinMax(1),
+		"min":       builtinMinMax(-1),
+		"print":     builtinPrint,
+		"range":     builtinRange,
+		"repr":      builtinRepr,
+		"sorted":    builtinSorted,
+		"str":       builtinStr,
+		"tuple":     builtinTuple,
+		"type":      builtinType,
+	} {
+		builtins[name] = &builtin{name: name, fn: fn}
+	}
+}
+
+// checkArgs validates the positional argument count and rejects kwargs.
+func checkArgs(args []any, kwargs map[string]any, minArgs, maxArgs int) error {
+	if len(kwargs) > 0 {
+		return fmt.Errorf("unexpected keyword arguments")
+	}
+	if len(args) < minArgs || len(args) > maxArgs {
+		if minArgs == maxArgs {
+			return fmt.Errorf("got %d arguments, want %d", len(args), minArgs)
+		}
+		return fmt.Errorf("got %d arguments, want %d to %d", len(args), minArgs, maxArgs)
+	}
+	return nil
+}
+
+func builtinAbs(_ *interp, args []any, kwargs map[string]any) (any, error) {
+	if err := checkArgs(args, kwargs, 1, 1); err != nil {
+		return nil, err
+	}
+	switch x := args[0].(type) {
+	case int64:
+		if x < 0 {
+			return -x, nil
+		}
+		return x, nil
+	case float64:
+		return math.Abs(x), nil
+	}
+	return nil, fmt.Errorf("bad operand type %s", typeName(args[0]))
+}
+
+func builtinBool(_ *interp, args []any, kwargs map[string]any) (any, error) {
+	if err := checkArgs(args, kwargs, 0, 1); err != nil {
+		return nil, err
+	}
+	return len(args) == 1 && truthy(args[0]), nil
+}
+
+func builtinDict(_ *interp, args []any, kwargs map[string]any) (any, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("got %d positional arguments, want at most 1", len(args))
+	}
+	m := make(map[string]any)
+	if len(args) == 1 {
+		if err := updateDict(m, args[0]); err != nil {
+			return nil, err
+		}
+	}
+	for k, v := range kwargs {
+		m[k] = v
+	}
+	return m, nil
+}
+
+// updateDict copies a dict, or a sequence of key/value pairs, into m.
+func updateDict(m map[string]any, src any) error {
+	if d, ok := src.(map[string]any); ok {
+		for k, v := range d {
+			m[k] = v
+		}
+		return nil
+	}
+	pairs, err := elements(src)
+	if err != nil {
+		return err
+	}
+	for _, p := range pairs {
+		kv, err := elements(p)
+		if err != nil || len(kv) != 2 {
+			return fmt.Errorf("dictionary update sequence element is not a pair")
+		}
+		k, ok := kv[0].(string)
+		if !ok {
+			return fmt.Errorf("dict keys must be strings, not %s", typeName(kv[0]))
+		}
+		m[k] = kv[1]
+	}
+	return nil
+}
+
+func builtinEnumerate(_ *interp, args []any, kwargs map[string]any) (any, error) {
+	if err := checkArgs(args, kwargs, 1, 1); err != nil {
+		return nil, err
+	}
+	elems, err := elements(args[0])
+	if err != nil {
+		return nil, err
+	}
+	out := make([]any, len(elems))
+	for i, e := range elems {
+		out[i] = tuple{int64(i), e}
+	}
+	return &list{elems: out}, nil
+}
+
+func builtinFail(_ *interp, args []any, _ map[string]any) (any, error) {
+	parts := make([]string, len(args))
+	for i, a := range args {
+		parts[i] = str(a)
+	}
+	return nil, fmt.Errorf("%s", strings.Join(parts, " "))
+}
+
+func builtinFloat(_ *interp, args []any, kwargs map[string]any) (any, error) {
+	if err := checkArgs(args, kwargs, 1, 1); err != nil {
+		return nil, err
+	}
+	switch x := args[0].(type) {
+	case int64:
+		return float64(x), nil
+	case float64:
+		return x, nil
+	case bool:
+		if x {
+			return 1.0, nil
+		}
+		return 0.0, nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float literal %q", x)
+		}
+		return f, nil
+	}
+	return nil, fmt.Errorf("cannot convert %s to float", typeName(args[0]))
+}
+
+func builtinInt(_ *interp, args []any, kwargs map[string]any) (any, error) {
+	if err := checkArgs(args, kwargs, 1, 2); err != nil {
+		return nil, err
+	}
+	switch x := args[0].(type) {
+	case int64:
+		return x, nil
+	case float64:
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return nil, fmt.Errorf("cannot convert %v to int", x)
+		}
+		return int64(x), nil
+	case bool:
+		if x {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case string:
+		base := int64(10)
+		if len(args) == 2 {
+			b, ok := args[1].(int64)
+			if !ok {
+				return nil, fmt.Errorf("base must be an int")
+			}
+			base = b
+		}
+		i, err := strconv.ParseInt(strings.TrimSpace(x), int(base), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int literal %q", x)
+		}
+		return i, nil
+	}
+	return nil, fmt.Errorf("cannot convert %s to int", typeName(args[0]))
+}
+
+func builtinLen(_ *interp, args []any, kwargs map[string]any) (any, error) {
+	if err := checkArgs(args, kwargs, 1, 1); err != nil {
+		return nil, err
+	}
+	switch x := args[0].(type) {
+	case string:
+		return int64(len(x)), nil
+	case *list:
+		return int64(len(x.elems)), nil
+	case tuple:
+		return int64(len(x)), nil
+	case map[string]any:
+		return int64(len(x)), nil
+	}
+	return nil, fmt.Errorf("%s has no len()", typeName(args[0]))
+}
+
+func builtinList(_ *interp, args []any, kwargs map[string]any) (any, error) {
+	if err := checkArgs(args, kwargs, 0, 1); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return &list{}, nil
+	}
+	elems, err := elements(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return &list{elems: append([]any(nil), elems...)}, nil
+}
+
+func builtinTuple(_ *interp, args []any, kwargs map[string]any) (any, error) {
+	if err := checkArgs(args, kwargs, 0, 1); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return tuple{}, nil
+	}
+	elems, err := elements(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return append(tuple(nil), elems...), nil
+}
+
+// builtinMinMax returns min (sign -1) or max (sign 1).
+func builtinMinMax(sign int) func(*interp, []any, map[string]any) (any, error) {
+	return func(_ *interp, args []any, kwargs map[string]any) (any, error) {
+		if len(kwargs) > 0 {
+			return nil, fmt.Errorf("unexpected keyword arguments")
+		}
+		elems := args
+		if len(args) == 1 {
+			var err error
+			if elems, err = elements(args[0]); err != nil {
+				return nil, err
+			}
+		}
+		if len(elems) == 0 {
+			return nil, fmt.Errorf("empty sequence")
+		}
+		best := elems[0]
+		for _, e := range elems[1:] {
+			c, err := compare(e, best)
+			if err != nil {
+				return nil, err
+			}
+			if c*sign > 0 {
+				best = e
+			}
+		}
+		return best, nil
+	}
+}
+
+func builtinPrint(in *interp, args []any, _ map[string]any) (any, error) {
+	parts := make([]string, len(args))
+	for i, a := range args {
+		parts[i] = str(a)
+	}
+	if in.print != nil {
+		in.print(strings.Join(parts, " "))
+	}
+	return nil, nil
+}
+
+func builtinRange(in *interp, args []any, kwargs map[string]any) (any, error) {
+	if err := checkArgs(args, kwargs, 1, 3); err != nil {
+		return nil, err
+	}
+	nums := make([]int64, len(args))
+	for i, a := range args {
+		n, ok := a.(int64)
+		if !ok {
+			return nil, fmt.Errorf("arguments must be integers, not %s", typeName(a))
+		}
+		nums[i] = n
+	}
+
+	start, stop, step := int64(0), nums[0], int64(1)
+	if len(nums) >= 2 {
+		start, stop = nums[0], nums[1]
+	}
+	if len(nums) == 3 {
+		step = nums[2]
+	}
+	if step == 0 {
+		return nil, fmt.Errorf("step must not be zero")
+	}
+
+	var elems []any
+	for i := start; (step > 0 && i < stop) || (step < 0 && i > stop); i += step {
+		// Building the range counts against the budget, so range(10**12)
+		// cannot allocate without bound.
+		if err := in.step(); err != nil {
+			return nil, err
+		}
+		elems = append(elems, i)
+	}
+	return &list{elems: elems}, nil
+}
+
+func builtinRepr(_ *interp, args []any, kwargs map[string]any) (any, error) {
+	if err := checkArgs(args, kwargs, 1, 1); err != nil {
+		return nil, err
+	}
+	return repr(args[0]), nil
+}
+
+func builtinSorted(in *interp, args []any, kwargs map[string]any) (any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("got %d arguments, want 1", len(args))
+	}
+	elems, err := elements(args[0])
+	if err != nil {
+		return nil, err
+	}
+	elems = append([]any(nil), elems...)
+
+	keys := elems
+	if key, ok := kwargs["key"]; ok && key != nil {
+		keys = make([]any, len(elems))
+		for i, e := range elems {
+			if keys[i], err = in.call(key, []any{e}, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+	reverse := truthy(kwargs["reverse"])
+
+	idx := make([]int, len(elems))
+	for i := range idx {
+		idx[i] = i
+	}
+	var cmpErr error
+	sort.SliceStable(idx, func(a, b int) bool {
+		c, err := compare(keys[idx[a]], keys[idx[b]])
+		if err != nil && cmpErr == nil {
+			cmpErr = err
+		}
+		if reverse {
+			return c > 0
+		}
+		return c < 0
+	})
+	if cmpErr != nil {
+		return nil, cmpErr
+	}
+
+	out := make([]any, len(elems))
+	for i, j := range idx {
+		out[i] = elems[j]
+	}
+	return &list{elems: out}, nil
+}
+
+func builtinStr(_ *interp, args []any, kwargs map[string]any) (any, error) {
+	if err := checkArgs(args, kwargs, 1, 1); err != nil {
+		return nil, err
+	}
+	return str(args[0]), nil
+}
+
+func builtinType(_ *interp, args []any, kwargs map[string]any) (any, error) {
+	if err := checkArgs(args, kwargs, 1, 1); err != nil {
+		return nil, err
+	}
+	return typeName(args[0]), nil
+}
+
+// method returns the bound method name of v.
+func method(v any, name string) (*builtin, error) {
+	var fn func(args []any) (any, error)
+
+	switch x := v.(type) {
+	case string:
+		fn = stringMethod(x, name)
+	case *list:
+		fn = listMethod(x, name)
+	case map[string]any:
+		fn = dictMethod(x, name)
+	}
+	if fn == nil {
+		return nil, fmt.Errorf("%s has no attribute %q", typeName(v), name)
+	}
+
+	return &builtin{
+		name: typeName(v) + "." + name,
+		fn: func(_ *interp, args []any, kwargs map[string]any) (any, error) {
+			if len(kwargs) > 0 {
+				return nil, fmt.Errorf("unexpected keyword arguments")
+			}
+			return fn(args)
+		},
+	}, nil
+}
+
+// stringArgs checks that args holds between minArgs and maxArgs strings.
+func stringArgs(args []any, minArgs, maxArgs int) ([]string, error) {
+	if err := checkArgs(args, nil, minArgs, maxArgs); err != nil {
+		return nil, err
+	}
+	out := make([]string, len(args))
+	for i, a := range args {
+		s, ok := a.(string)
+		if !ok {
+			return nil, fmt.Errorf("argument must be a string, not %s", typeName(a))
+		}
+		out[i] = s
+	}
+	return out, nil
+}
+
+func stringMethod(s, name string) func([]any) (any, error) {
+	switch name {
+	case "upper", "lower":
+		return func(args []any) (any, error) {
+			if _, err := stringArgs(args, 0, 0); err != nil {
+				return nil, err
+			}
+			if name == "upper" {
+				return strings.ToUpper(s), nil
+			}
+			return strings.ToLower(s), nil
+		}
+	case "strip", "lstrip", "rstrip":
+		return func(args []any) (any, error) {
+			a, err := stringArgs(args, 0, 1)
+			if err != nil {
+				return nil, err
+			}
+			cutset := " \t\r\n"
+			if len(a) == 1 {
+				cutset = a[0]
+			}
+			switch name {
+			case "lstrip":
+				return strings.TrimLeft(s, cutset), nil
+			case "rstrip":
+				return strings.TrimRight(s, cutset), nil
+			}
+			return strings.Trim(s, cutset), nil
+		}
+	case "startswith", "endswith":
+		return func(args []any) (any, error) {
+			a, err := stringArgs(args, 1, 1)
+			if err != nil {
+				return nil, err
+			}
+			if name == "startswith" {
+				return strings.HasPrefix(s, a[0]), nil
+			}
+			return strings.HasSuffix(s, a[0]), nil
+		}
+	case "split":
+		return func(args []any) (any, error) {
+			if len(args) == 0 {
+				return stringList(strings.Fields(s)), nil
+			}
+			if len(args) > 2 {
+				return nil, fmt.Errorf("got %d arguments, want at most 2", len(args))
+			}
+			sep, ok := args[0].(string)
+			if !ok || sep == "" {
+				return nil, fmt.Errorf("separator must be a non-empty string")
+			}
+			n := -1
+			if len(args) == 2 {
+				maxSplit, ok := args[1].(int64)
+				if !ok {
+					return nil, fmt.Errorf("maxsplit must be an int")
+				}
+				if maxSplit >= 0 {
+					n = int(maxSplit) + 1
+				}
+			}
+			return stringList(strings.SplitN(s, sep, n)), nil
+		}
+	case "join":
+		return func(args []any) (any, error) {
+			if err := checkArgs(args, nil, 1, 1); err != nil {
+				return nil, err
+			}
+			elems, err := elements(args[0])
+			if err != nil {
+				return nil, err
+			}
+			parts := make([]string, len(elems))
+			for i, e := range elems {
+				p, ok := e.(string)
+				if !ok {
+					return nil, fmt.Errorf("join: element %d is %s, not string", i, typeName(e))
+				}
+				parts[i] = p
+			}
+			return strings.Join(parts, s), nil
+		}
+	case "replace":
+		return func(args []any) (any, error) {
+			a, err := stringArgs(args, 2, 2)
+			if err != nil {
+				return nil, err
+			}
+			return strings.ReplaceAll(s, a[0], a[1]), nil
+		}
+	case "find":
+		return func(args []any) (any, error) {
+			a, err := stringArgs(args, 1, 1)
+			if err != nil {
+				return nil, err
+			}
+			return int64(strings.Index(s, a[0])), nil
+		}
+	case "count":
+		return func(args []any) (any, error) {
+			a, err := stringArgs(args, 1, 1)
+			if err != nil {
+				return nil, err
+			}
+			return int64(strings.Count(s, a[0])), nil
+		}
+	}
+	return nil
+}
+
+func stringList(parts []string) *list {
+	elems := make([]any, len(parts))
+	for i, p := range parts {
+		elems[i] = p
+	}
+	return &list{elems: elems}
+}
+
+func listMethod(l *list, name string) func([]any) (any, error) {
+	switch name {
+	case "append":
+		return func(args []any) (any, error) {
+			if err := checkArgs(args, nil, 1, 1); err != nil {
+				return nil, err
+			}
+			l.elems = append(l.elems, args[0])
+			return nil, nil
+		}
+	case "extend":
+		return func(args []any) (any, error) {
+			if err := checkArgs(args, nil, 1, 1); err != nil {
+				return nil, err
+			}
+			elems, err := elements(args[0])
+			if err != nil {
+				return nil, err
+			}
+			l.elems = append(l.elems, elems...)
+			return nil, nil
+		}
+	case "pop":
+		return func(args []any) (any, error) {
+			if err := checkArgs(args, nil, 0, 1); err != nil {
+				return nil, err
+			}
+			var key any = int64(-1)
+			if len(args) == 1 {
+				key = args[0]
+			}
+			i, err := index(key, len(l.elems))
+			if err != nil {
+				return nil, err
+			}
+			v := l.elems[i]
+			l.elems = append(l.elems[:i], l.elems[i+1:]...)
+			return v, nil
+		}
+	}
+	return nil
+}
+
+func dictMethod(m map[string]any, name string) func([]any) (any, error) {
+	switch name {
+	case "get":
+		return func(args []any) (any, error) {
+			if err := checkArgs(args, nil, 1, 2); err != nil {
+				return nil, err
+			}
+			if k, ok := args[0].(string); ok {
+				if v, ok := m[k]; ok {
+					return v, nil
+				}
+			}
+			if len(args) == 2 {
+				return args[1], nil
+			}
+			return nil, nil
+		}
+	case "pop":
+		return func(args []any) (any, error) {
+			if err := checkArgs(args, nil, 1, 2); err != nil {
+				return nil, err
+			}
+			k, _ := args[0].(string)
+			if v, ok := m[k]; ok {
+				delete(m, k)
+				return v, nil
+			}
+			if len(args) == 2 {
+				return args[1], nil
+			}
+			return nil, fmt.Errorf("key %s not found", repr(args[0]))
+		}
+	case "setdefault":
+		return func(args []any) (any, error) {
+			if err := checkArgs(args, nil, 1, 2); err != nil {
+				return nil, err
+			}
+			k, ok := args[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("dict keys must be strings, not %s", typeName(args[0]))
+			}
+			if v, ok := m[k]; ok {
+				return v, nil
+			}
+			var def any
+			if len(args) == 2 {
+				def = args[1]
+			}
+			m[k] = def
+			return def, nil
+		}
+	case "update":
+		return func(args []any) (any, error) {
+			if err := checkArgs(args, nil, 1, 1); err != nil {
+				return nil, err
+			}
+			return nil, updateDict(m, args[0])
+		}
+	case "keys", "values", "items":
+		return func(args []any) (any, error) {
+			if err := checkArgs(args, nil, 0, 0); err != nil {
+				return nil, err
+			}
+			keys := sortedKeys(m)
+			out := make([]any, len(keys))
+			for i, k := range keys {
+				switch name {
+				case "keys":
+					out[i] = k
+				case "values":
+					out[i] = m[k]
+				default:
+					out[i] = tuple{k, m[k]}
+				}
+			}
+			return &list{elems: out}, nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package script
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuiltins(t *testing.T) {
+	tests := []struct {
+		src  string
+		want any
+	}{
+		{`len("abc")`, int64(3)},
+		{`len([1, 2])`, int64(2)},
+		{`len({"a": 1})`, int64(1)},
+		{`str(12)`, "12"},
+		{`str(1.0)`, "1.0"},
+		{`str(None)`, "None"},
+		{`str([1, "a"])`, `[1, "a"]`},
+		{`repr("a")`, `"a"`},
+		{`int("42")`, int64(42)},
+		{`int("ff", 16)`, int64(255)},
+		{`int(3.9)`, int64(3)},
+		{`float("1.5")`, 1.5},
+		{`float(2)`, 2.0},
+		{`bool("")`, false},
+		{`bool([0])`, true},
+		{`abs(-3)`, int64(3)},
+		{`min(3, 1, 2)`, int64(1)},
+		{`max([3, 1, 2])`, int64(3)},
+		{`range(3)`, []any{int64(0), int64(1), int64(2)}},
+		{`range(5, 0, -2)`, []any{int64(5), int64(3), int64(1)}},
+		{`list((1, 2))`, []any{int64(1), int64(2)}},
+		{`tuple([1])`, []any{int64(1)}},
+		{`dict([("a", 1)], b=2)`, map[string]any{"a": int64(1), "b": int64(2)}},
+		{`sorted([3, 1, 2])`, []any{int64(1), int64(2), int64(3)}},
+		{`sorted(["bb", "a"], key=len, reverse=True)`, []any{"bb", "a"}},
+		{`enumerate(["x"])`, []any{[]any{int64(0), "x"}}},
+		{`type(1.5)`, "float"},
+		{`type({})`, "dict"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			got, err := evalExpr(t, tt.src)
+			if err != nil {
+				t.Fatalf("%s: error: %v", tt.src, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %#v, want %#v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMethods(t *testing.T) {
+	tests := []struct {
+		src  string
+		want any
+	}{
+		{`"Ab".upper()`, "AB"},
+		{`"Ab".lower()`, "ab"},
+		{`"  x ".strip()`, "x"},
+		{`"xxaxx".lstrip("x")`, "axx"},
+		{`"xxaxx".rstrip("x")`, "xxa"},
+		{`"a b  c".split()`, []any{"a", "b", "c"}},
+		{`"a=b=c".split("=", 1)`, []any{"a", "b=c"}},
+		{`"-".join(["a", "b"])`, "a-b"},
+		{`"hello".startswith("he")`, true},
+		{`"hello".endswith("lo")`, true},
+		{`"a.b.c".replace(".", "/")`, "a/b/c"},
+		{`"hello".find("l")`, int64(2)},
+		{`"hello".count("l")`, int64(2)},
+		{`[1, 2, 3].pop()`, int64(3)},
+		{`[1, 2, 3].pop(0)`, int64(1)},
+		{`{"a": 1}.get("a")`, int64(1)},
+		{`{"a": 1}.get("b", 0)`, int64(0)},
+		{`{"a": 1}.get("b")`, nil},
+		{`{"a": 1}.pop("a")`, int64(1)},
+		{`{"a": 1}.pop("b", "none")`, "none"},
+		{`{"a": 1}.setdefault("b", 2)`, int64(2)},
+		{`{"b": 2, "a": 1}.keys()`, []any{"a", "b"}},
+		{`{"b": 2, "a": 1}.values()`, []any{int64(1), int64(2)}},
+		{`{"a": 1}.items()`, []any{[]any{"a", int64(1)}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			got, err := evalExpr(t, tt.src)
+			if err != nil {
+				t.Fatalf("%s: error: %v", tt.src, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %#v, want %#v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuiltins_Errors(t *testing.T) {
+	tests := []string{
+		`len(1)`,
+		`int("x")`,
+		`float([])`,
+		`range(1, 2, 0)`,
+		`min([])`,
+		`sorted([1, "a"])`,
+		`"a".split("")`,
+		`"-".join([1])`,
+		`{"a": 1}.pop("b")`,
+		`fail("boom")`,
+		`len()`,
+	}
+
+	for _, src := range tests {
+		t.Run(src, func(t *testing.T) {
+			if _, err := evalExpr(t, src); err == nil {
+				t.Errorf("%s: expected error", src)
+			}
+		})
+	}
+}
@@ -0,0 +1,855 @@
+package script
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxCallDepth bounds recursion so a runaway script fails cleanly
+// instead of exhausting the Go stack.
+const maxCallDepth = 200
+
+// errStepLimit is returned when a call exceeds its step budget.
+var errStepLimit = errors.New("step limit exceeded")
+
+// env is a variable scope. Function bodies get a fresh env whose parent
+// is the env the function was defined in.
+type env struct {
+	vars   map[string]any
+	parent *env
+}
+
+func newEnv(parent *env) *env {
+	return &env{vars: make(map[string]any), parent: parent}
+}
+
+func (e *env) lookup(name string) (any, bool) {
+	for ; e != nil; e = e.parent {
+		if v, ok := e.vars[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// control describes how a statement finished.
+type control int
+
+const (
+	ctlNone control = iota
+	ctlBreak
+	ctlContinue
+	ctlReturn
+)
+
+// interp holds the state of a single evaluation.
+type interp struct {
+	steps    int
+	maxSteps int
+	depth    int
+	print    func(string)
+}
+
+// lineError is a runtime error annotated with the script line.
+func lineError(line int, err error) error {
+	if strings.HasPrefix(err.Error(), "line ") {
+		return err
+	}
+	return fmt.Errorf("line %d: %w", line, err)
+}
+
+// step charges one unit against the budget.
+func (in *interp) step() error {
+	in.steps++
+	if in.maxSteps > 0 && in.steps > in.maxSteps {
+		return errStepLimit
+	}
+	return nil
+}
+
+func (in *interp) execBlock(stmts []stmt, e *env) (control, any, error) {
+	for _, s := range stmts {
+		ctl, v, err := in.exec(s, e)
+		if err != nil || ctl != ctlNone {
+			return ctl, v, err
+		}
+	}
+	return ctlNone, nil, nil
+}
+
+func (in *interp) exec(s stmt, e *env) (control, any, error) {
+	if err := in.step(); err != nil {
+		return ctlNone, nil, lineError(s.stmtLine(), err)
+	}
+
+	switch s := s.(type) {
+	case *exprStmt:
+		_, err := in.eval(s.x, e)
+		return ctlNone, nil, err
+
+	case *assignStmt:
+		return ctlNone, nil, in.execAssign(s, e)
+
+	case *ifStmt:
+		cond, err := in.eval(s.cond, e)
+		if err != nil {
+			return ctlNone, nil, err
+		}
+		if truthy(cond) {
+			return in.execBlock(s.then, e)
+		}
+		return in.execBlock(s.els, e)
+
+	case *forStmt:
+		iter, err := in.eval(s.iter, e)
+		if err != nil {
+			return ctlNone, nil, err
+		}
+		elems, err := elements(iter)
+		if err != nil {
+			return ctlNone, nil, lineError(s.line, err)
+		}
+		for _, elem := range elems {
+			if err := in.assign(s.target, elem, e); err != nil {
+				return ctlNone, nil, lineError(s.line, err)
+			}
+			ctl, v, err := in.execBlock(s.body, e)
+			if err != nil {
+				return ctlNone, nil, err
+			}
+			switch ctl {
+			case ctlBreak:
+				return ctlNone, nil, nil
+			case ctlReturn:
+				return ctl, v, nil
+			}
+		}
+		return ctlNone, nil, nil
+
+	case *defStmt:
+		e.vars[s.name] = &function{def: s, env: e}
+		return ctlNone, nil, nil
+
+	case *returnStmt:
+		if s.value == nil {
+			return ctlReturn, nil, nil
+		}
+		v, err := in.eval(s.value, e)
+		return ctlReturn, v, err
+
+	case *branchStmt:
+		switch s.kind {
+		case "break":
+			return ctlBreak, nil, nil
+		case "continue":
+			return ctlContinue, nil, nil
+		}
+		return ctlNone, nil, nil
+	}
+
+	return ctlNone, nil, fmt.Errorf("line %d: unsupported statement", s.stmtLine())
+}
+
+func (in *interp) execAssign(s *assignStmt, e *env) error {
+	value, err := in.eval(s.value, e)
+	if err != nil {
+		return err
+	}
+
+	if s.op != "=" {
+		cur, err := in.eval(s.target, e)
+		if err != nil {
+			return err
+		}
+		// A list += extends in place, like Python.
+		if l, ok := cur.(*list); ok && s.op == "+=" {
+			elems, err := elements(value)
+			if err != nil {
+				return lineError(s.line, err)
+			}
+			l.elems = append(l.elems, elems...)
+			return nil
+		}
+		if value, err = binary(strings.TrimSuffix(s.op, "="), cur, value); err != nil {
+			return lineError(s.line, err)
+		}
+	}
+
+	if err := in.assign(s.target, value, e); err != nil {
+		return lineError(s.line, err)
+	}
+	return nil
+}
+
+func (in *interp) assign(target expr, value any, e *env) error {
+	switch t := target.(type) {
+	case *nameExpr:
+		e.vars[t.name] = value
+		return nil
+
+	case *indexExpr:
+		x, err := in.eval(t.x, e)
+		if err != nil {
+			return err
+		}
+		key, err := in.eval(t.key, e)
+		if err != nil {
+			return err
+		}
+		return setIndex(x, key, value)
+
+	case *tupleExpr:
+		elems, err := elements(value)
+		if err != nil {
+			return err
+		}
+		if len(elems) != len(t.elems) {
+			return fmt.Errorf("cannot unpack %d values into %d variables", len(elems), len(t.elems))
+		}
+		for i, target := range t.elems {
+			if err := in.assign(target, elems[i], e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("cannot assign to expression")
+}
+
+func setIndex(x, key, value any) error {
+	switch c := x.(type) {
+	case map[string]any:
+		k, ok := key.(string)
+		if !ok {
+			return fmt.Errorf("dict keys must be strings, not %s", typeName(key))
+		}
+		c[k] = value
+		return nil
+	case *list:
+		i, err := index(key, len(c.elems))
+		if err != nil {
+			return err
+		}
+		c.elems[i] = value
+		return nil
+	}
+	return fmt.Errorf("%s does not support item assignment", typeName(x))
+}
+
+func (in *interp) eval(x expr, e *env) (any, error) {
+	switch x := x.(type) {
+	case *literalExpr:
+		return x.val, nil
+
+	case *nameExpr:
+		if v, ok := e.lookup(x.name); ok {
+			return v, nil
+		}
+		if b, ok := builtins[x.name]; ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("line %d: undefined name %q", x.line, x.name)
+
+	case *unaryExpr:
+		v, err := in.eval(x.x, e)
+		if err != nil {
+			return nil, err
+		}
+		switch x.op {
+		case "not":
+			return !truthy(v), nil
+		case "-":
+			switch n := v.(type) {
+			case int64:
+				return -n, nil
+			case float64:
+				return -n, nil
+			}
+		case "+":
+			switch v.(type) {
+			case int64, float64:
+				return v, nil
+			}
+		}
+		return nil, fmt.Errorf("line %d: bad operand type for unary %s: %s", x.line, x.op, typeName(v))
+
+	case *binaryExpr:
+		l, err := in.eval(x.l, e)
+		if err != nil {
+			return nil, err
+		}
+		// Short-circuit operators return the deciding operand.
+		switch x.op {
+		case "and":
+			if !truthy(l) {
+				return l, nil
+			}
+			return in.eval(x.r, e)
+		case "or":
+			if truthy(l) {
+				return l, nil
+			}
+			return in.eval(x.r, e)
+		}
+		r, err := in.eval(x.r, e)
+		if err != nil {
+			return nil, err
+		}
+		v, err := binary(x.op, l, r)
+		if err != nil {
+			return nil, lineError(x.line, err)
+		}
+		return v, nil
+
+	case *condExpr:
+		cond, err := in.eval(x.cond, e)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(cond) {
+			return in.eval(x.then, e)
+		}
+		return in.eval(x.els, e)
+
+	case *callExpr:
+		return in.evalCall(x, e)
+
+	case *indexExpr:
+		v, err := in.eval(x.x, e)
+		if err != nil {
+			return nil, err
+		}
+		key, err := in.eval(x.key, e)
+		if err != nil {
+			return nil, err
+		}
+		r, err := getIndex(v, key)
+		if err != nil {
+			return nil, lineError(x.line, err)
+		}
+		return r, nil
+
+	case *sliceExpr:
+		return in.evalSlice(x, e)
+
+	case *attrExpr:
+		v, err := in.eval(x.x, e)
+		if err != nil {
+			return nil, err
+		}
+		m, err := method(v, x.name)
+		if err != nil {
+			return nil, lineError(x.line, err)
+		}
+		return m, nil
+
+	case *listExpr:
+		elems, err := in.evalAll(x.elems, e)
+		if err != nil {
+			return nil, err
+		}
+		return &list{elems: elems}, nil
+
+	case *tupleExpr:
+		elems, err := in.evalAll(x.elems, e)
+		if err != nil {
+			return nil, err
+		}
+		return tuple(elems), nil
+
+	case *dictExpr:
+		m := make(map[string]any, len(x.keys))
+		for i := range x.keys {
+			k, err := in.eval(x.keys[i], e)
+			if err != nil {
+				return nil, err
+			}
+			ks, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("line %d: dict keys must be strings, not %s", x.line, typeName(k))
+			}
+			if m[ks], err = in.eval(x.values[i], e); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("line %d: unsupported expression", x.exprLine())
+}
+
+func (in *interp) evalAll(xs []expr, e *env) ([]any, error) {
+	out := make([]any, len(xs))
+	for i, x := range xs {
+		v, err := in.eval(x, e)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func (in *interp) evalCall(x *callExpr, e *env) (any, error) {
+	fn, err := in.eval(x.fn, e)
+	if err != nil {
+		return nil, err
+	}
+	args, err := in.evalAll(x.args, e)
+	if err != nil {
+		return nil, err
+	}
+	var kwargs map[string]any
+	if len(x.kwargs) > 0 {
+		kwargs = make(map[string]any, len(x.kwargs))
+		for _, kw := range x.kwargs {
+			if kwargs[kw.name], err = in.eval(kw.value, e); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	v, err := in.call(fn, args, kwargs)
+	if err != nil {
+		return nil, lineError(x.line, err)
+	}
+	return v, nil
+}
+
+// call invokes a function or builtin.
+func (in *interp) call(fn any, args []any, kwargs map[string]any) (any, error) {
+	switch f := fn.(type) {
+	case *builtin:
+		v, err := f.fn(in, args, kwargs)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.name, err)
+		}
+		return v, nil
+
+	case *function:
+		if in.depth >= maxCallDepth {
+			return nil, fmt.Errorf("maximum recursion depth exceeded")
+		}
+
+		local := newEnv(f.env)
+		params := f.def.params
+		if len(args) > len(params) {
+			return nil, fmt.Errorf("%s() takes %d arguments, got %d", f.def.name, len(params), len(args))
+		}
+		for i, a := range args {
+			local.vars[params[i].name] = a
+		}
+		for name, v := range kwargs {
+			found := false
+			for _, p := range params {
+				if p.name == name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("%s() got an unexpected keyword argument %q", f.def.name, name)
+			}
+			if _, dup := local.vars[name]; dup {
+				return nil, fmt.Errorf("%s() got multiple values for argument %q", f.def.name, name)
+			}
+			local.vars[name] = v
+		}
+		for _, p := range params {
+			if _, ok := local.vars[p.name]; ok {
+				continue
+			}
+			if p.def == nil {
+				return nil, fmt.Errorf("%s() missing argument %q", f.def.name, p.name)
+			}
+			v, err := in.eval(p.def, f.env)
+			if err != nil {
+				return nil, err
+			}
+			local.vars[p.name] = v
+		}
+
+		in.depth++
+		defer func() { in.depth-- }()
+
+		_, v, err := in.execBlock(f.def.body, local)
+		return v, err
+	}
+
+	return nil, fmt.Errorf("%s is not callable", typeName(fn))
+}
+
+func (in *interp) evalSlice(x *sliceExpr, e *env) (any, error) {
+	v, err := in.eval(x.x, e)
+	if err != nil {
+		return nil, err
+	}
+
+	var n int
+	switch c := v.(type) {
+	case string:
+		n = len(c)
+	case *list:
+		n = len(c.elems)
+	case tuple:
+		n = len(c)
+	default:
+		return nil, fmt.Errorf("line %d: %s cannot be sliced", x.line, typeName(v))
+	}
+
+	bound := func(b expr, def int) (int, error) {
+		if b == nil {
+			return def, nil
+		}
+		bv, err := in.eval(b, e)
+		if err != nil {
+			return 0, err
+		}
+		i, ok := bv.(int64)
+		if !ok {
+			return 0, fmt.Errorf("line %d: slice indices must be integers", x.line)
+		}
+		if i < 0 {
+			i += int64(n)
+		}
+		return int(max(0, min(i, int64(n)))), nil
+	}
+	lo, err := bound(x.lo, 0)
+	if err != nil {
+		return nil, err
+	}
+	hi, err := bound(x.hi, n)
+	if err != nil {
+		return nil, err
+	}
+	hi = max(hi, lo)
+
+	switch c := v.(type) {
+	case string:
+		return c[lo:hi], nil
+	case *list:
+		return &list{elems: append([]any(nil), c.elems[lo:hi]...)}, nil
+	default:
+		return append(tuple(nil), v.(tuple)[lo:hi]...), nil
+	}
+}
+
+// index resolves a (possibly negative) sequence index.
+func index(key any, n int) (int, error) {
+	i, ok := key.(int64)
+	if !ok {
+		return 0, fmt.Errorf("indices must be integers, not %s", typeName(key))
+	}
+	if i < 0 {
+		i += int64(n)
+	}
+	if i < 0 || i >= int64(n) {
+		return 0, fmt.Errorf("index out of range")
+	}
+	return int(i), nil
+}
+
+func getIndex(x, key any) (any, error) {
+	switch c := x.(type) {
+	case map[string]any:
+		k, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("dict keys must be strings, not %s", typeName(key))
+		}
+		v, ok := c[k]
+		if !ok {
+			return nil, fmt.Errorf("key %q not found", k)
+		}
+		return v, nil
+	case *list:
+		i, err := index(key, len(c.elems))
+		if err != nil {
+			return nil, err
+		}
+		return c.elems[i], nil
+	case tuple:
+		i, err := index(key, len(c))
+		if err != nil {
+			return nil, err
+		}
+		return c[i], nil
+	case string:
+		i, err := index(key, len(c))
+		if err != nil {
+			return nil, err
+		}
+		return c[i : i+1], nil
+	}
+	return nil, fmt.Errorf("%s is not indexable", typeName(x))
+}
+
+// binary applies a non-short-circuit binary operator.
+func binary(op string, l, r any) (any, error) {
+	switch op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case "<", "<=", ">", ">=":
+		c, err := compare(l, r)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	case "in", "not in":
+		ok, err := contains(r, l)
+		if err != nil {
+			return nil, err
+		}
+		return ok == (op == "in"), nil
+	}
+
+	// Integer arithmetic stays integral, except for true division.
+	if a, ok := l.(int64); ok {
+		if b, ok := r.(int64); ok {
+			return intOp(op, a, b)
+		}
+	}
+	if a, ok := toFloat(l); ok {
+		if b, ok := toFloat(r); ok {
+			return floatOp(op, a, b)
+		}
+	}
+
+	switch a := l.(type) {
+	case string:
+		if op == "%" {
+			return interpolate(a, r)
+		}
+		switch b := r.(type) {
+		case string:
+			if op == "+" {
+				return a + b, nil
+			}
+		case int64:
+			if op == "*" {
+				return strings.Repeat(a, int(max(b, 0))), nil
+			}
+		}
+	case *list:
+		switch b := r.(type) {
+		case *list:
+			if op == "+" {
+				elems := make([]any, 0, len(a.elems)+len(b.elems))
+				elems = append(append(elems, a.elems...), b.elems...)
+				return &list{elems: elems}, nil
+			}
+		case int64:
+			if op == "*" {
+				var elems []any
+				for i := int64(0); i < b; i++ {
+					elems = append(elems, a.elems...)
+				}
+				return &list{elems: elems}, nil
+			}
+		}
+	case tuple:
+		if b, ok := r.(tuple); ok && op == "+" {
+			return append(append(tuple(nil), a...), b...), nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported operand types for %s: %s and %s", op, typeName(l), typeName(r))
+}
+
+func intOp(op string, a, b int64) (any, error) {
+	switch op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return float64(a) / float64(b), nil
+	case "//":
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		q := a / b
+		if (a%b != 0) && ((a < 0) != (b < 0)) {
+			q--
+		}
+		return q, nil
+	case "%":
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		m := a % b
+		if m != 0 && ((m < 0) != (b < 0)) {
+			m += b
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("unsupported operand types for %s: int and int", op)
+}
+
+func floatOp(op string, a, b float64) (any, error) {
+	switch op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/", "//", "%":
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		switch op {
+		case "/":
+			return a / b, nil
+		case "//":
+			return math.Floor(a / b), nil
+		}
+		return a - b*math.Floor(a/b), nil
+	}
+	return nil, fmt.Errorf("unsupported operand types for %s: float and float", op)
+}
+
+// interpolate implements the string % operator: format's conversions
+// %s, %r, %d, %i, %o, %x, %X, %e, %f, %g and %% take their values from
+// arg, a tuple of them or a single value, or with %(key)s from the dict
+// arg.
+func interpolate(format string, arg any) (string, error) {
+	args, ok := arg.(tuple)
+	if !ok {
+		args = tuple{arg}
+	}
+	dict, _ := arg.(map[string]any)
+
+	var b strings.Builder
+	next := 0
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i == len(format) {
+			return "", fmt.Errorf("incomplete format")
+		}
+		if format[i] == '%' {
+			b.WriteByte('%')
+			continue
+		}
+
+		var v any
+		if format[i] == '(' {
+			end := strings.IndexByte(format[i:], ')')
+			if end < 0 {
+				return "", fmt.Errorf("incomplete format key")
+			}
+			if dict == nil {
+				return "", fmt.Errorf("format requires a dict")
+			}
+			key := format[i+1 : i+end]
+			if v, ok = dict[key]; !ok {
+				return "", fmt.Errorf("key %q not found", key)
+			}
+			i += end + 1
+			if i == len(format) {
+				return "", fmt.Errorf("incomplete format")
+			}
+		} else {
+			if next == len(args) {
+				return "", fmt.Errorf("not enough arguments for format string")
+			}
+			v = args[next]
+			next++
+		}
+
+		switch verb := format[i]; verb {
+		case 's':
+			b.WriteString(str(v))
+		case 'r':
+			b.WriteString(repr(v))
+		case 'd', 'i', 'o', 'x', 'X':
+			var n int64
+			switch x := v.(type) {
+			case int64:
+				n = x
+			case float64:
+				n = int64(x)
+			default:
+				return "", fmt.Errorf("%%%c format requires a number, not %s", verb, typeName(v))
+			}
+			switch verb {
+			case 'o':
+				b.WriteString(strconv.FormatInt(n, 8))
+			case 'x':
+				b.WriteString(strconv.FormatInt(n, 16))
+			case 'X':
+				b.WriteString(strings.ToUpper(strconv.FormatInt(n, 16)))
+			default:
+				b.WriteString(strconv.FormatInt(n, 10))
+			}
+		case 'e', 'f', 'g':
+			f, ok := toFloat(v)
+			if !ok {
+				return "", fmt.Errorf("%%%c format requires a number, not %s", verb, typeName(v))
+			}
+			b.WriteString(strconv.FormatFloat(f, verb, 6, 64))
+		default:
+			return "", fmt.Errorf("unsupported format character %q", verb)
+		}
+	}
+	if dict == nil && next < len(args) {
+		return "", fmt.Errorf("too many arguments for format string")
+	}
+	return b.String(), nil
+}
+
+// contains implements the "in" operator: substring for strings,
+// key membership for dicts, element membership for sequences.
+func contains(container, item any) (bool, error) {
+	switch c := container.(type) {
+	case string:
+		s, ok := item.(string)
+		if !ok {
+			return false, fmt.Errorf("'in <string>' requires string as left operand, not %s", typeName(item))
+		}
+		return strings.Contains(c, s), nil
+	case map[string]any:
+		k, ok := item.(string)
+		if !ok {
+			return false, nil
+		}
+		_, found := c[k]
+		return found, nil
+	case *list:
+		return containsElem(c.elems, item), nil
+	case tuple:
+		return containsElem(c, item), nil
+	}
+	return false, fmt.Errorf("argument of type %s is not iterable", typeName(container))
+}
+
+func containsElem(elems []any, item any) bool {
+	for _, e := range elems {
+		if equal(e, item) {
+			return true
+		}
+	}
+	return false
+}
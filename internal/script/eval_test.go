@@ -0,0 +1,219 @@
+package script
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// evalExpr compiles "def f(): return <src>" and calls it.
+func evalExpr(t *testing.T, src string) (any, error) {
+	t.Helper()
+	s, err := Compile("test", "def f():\n    return "+src+"\n")
+	if err != nil {
+		t.Fatalf("Compile(%q) error: %v", src, err)
+	}
+	return s.Call("f")
+}
+
+func TestEval_Expressions(t *testing.T) {
+	tests := []struct {
+		src  string
+		want any
+	}{
+		{`1 + 2 * 3`, int64(7)},
+		{`(1 + 2) * 3`, int64(9)},
+		{`7 / 2`, 3.5},
+		{`7 // 2`, int64(3)},
+		{`-7 // 2`, int64(-4)},
+		{`-7 % 3`, int64(2)},
+		{`7.5 // 2`, 3.0},
+		{`1 + 0.5`, 1.5},
+		{`-(3)`, int64(-3)},
+		{`"ab" + "cd"`, "abcd"},
+		{`"ab" * 2`, "abab"},
+		{`"%s=%d" % ("k", 3)`, "k=3"},
+		{`"%r, %s" % ("a", None)`, `"a", None`},
+		{`"%d%%" % 99.9`, "99%"},
+		{`"%x %X %o" % (255, 255, 8)`, "ff FF 10"},
+		{`"%f %e %g" % (1.5, 1.5, 1.5)`, "1.500000 1.500000e+00 1.5"},
+		{`"%(host)s:%(port)d" % {"host": "db", "port": 5432}`, "db:5432"},
+		{`"%s" % [1, 2]`, "[1, 2]"},
+		{`[1] + [2]`, []any{int64(1), int64(2)}},
+		{`(1,) + (2,)`, []any{int64(1), int64(2)}},
+		{`1 == 1.0`, true},
+		{`"a" != "b"`, true},
+		{`"abc" < "abd"`, true},
+		{`[1, 2] < [1, 3]`, true},
+		{`"b" in "abc"`, true},
+		{`"k" in {"k": 1}`, true},
+		{`2 not in [1, 2]`, false},
+		{`not 0`, true},
+		{`0 or "x"`, "x"},
+		{`1 and 2`, int64(2)},
+		{`None or []`, []any{}},
+		{`"yes" if 1 > 0 else "no"`, "yes"},
+		{`"hello"[1:3]`, "el"},
+		{`"hello"[-1]`, "o"},
+		{`[1, 2, 3][-2:]`, []any{int64(2), int64(3)}},
+		{`{"a": {"b": 2}}["a"]["b"]`, int64(2)},
+		{`None`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			got, err := evalExpr(t, tt.src)
+			if err != nil {
+				t.Fatalf("%s: error: %v", tt.src, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %#v, want %#v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEval_RuntimeErrors(t *testing.T) {
+	tests := []struct {
+		src     string
+		wantErr string
+	}{
+		{`1 / 0`, "division by zero"},
+		{`1 % 0`, "division by zero"},
+		{`"a" + 1`, "unsupported operand"},
+		{`"%s %s" % ("a",)`, "not enough arguments"},
+		{`"%s" % ("a", "b")`, "too many arguments"},
+		{`"%d" % "a"`, "requires a number"},
+		{`"%q" % 1`, "unsupported format character"},
+		{`"%(a)s" % 1`, "requires a dict"},
+		{`"50%" % ()`, "incomplete format"},
+		{`undefined_name`, "undefined name"},
+		{`[1][5]`, "index out of range"},
+		{`{"a": 1}["b"]`, "not found"},
+		{`{1: 2}`, "dict keys must be strings"},
+		{`1 < "a"`, "cannot compare"},
+		{`(1)()`, "not callable"},
+		{`"s".nope()`, "has no attribute"},
+		{`1 in 2`, "not iterable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := evalExpr(t, tt.src)
+			if err == nil {
+				t.Fatalf("%s: expected error", tt.src)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want it to contain %q", tt.src, err, tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), "line 2") {
+				t.Errorf("%s: error %v should name the line", tt.src, err)
+			}
+		})
+	}
+}
+
+func TestEval_Statements(t *testing.T) {
+	src := `
+def fib(n):
+    if n < 2:
+        return n
+    return fib(n - 1) + fib(n - 2)
+
+def loops():
+    total = 0
+    for i in range(10):
+        if i == 3:
+            continue
+        if i == 6:
+            break
+        total += i
+    return total
+
+def unpack():
+    a, b = 1, 2
+    a, b = b, a
+    return [a, b]
+
+def mutate():
+    l = [1]
+    l.append(2)
+    l += [3]
+    d = {}
+    d["k"] = l
+    return d
+
+def closure():
+    base = 10
+    def add(x):
+        return base + x
+    return add(5)
+
+def defaults(a, b=2, c=3):
+    return [a, b, c]
+`
+	s, err := Compile("test", src)
+	if err != nil {
+		t.Fatalf("Compile() error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		fn   string
+		args []any
+		want any
+	}{
+		{name: "recursion", fn: "fib", args: []any{10}, want: int64(55)},
+		{name: "break and continue", fn: "loops", want: int64(0 + 1 + 2 + 4 + 5)},
+		{name: "tuple unpacking", fn: "unpack", want: []any{int64(2), int64(1)}},
+		{name: "mutation", fn: "mutate", want: map[string]any{"k": []any{int64(1), int64(2), int64(3)}}},
+		{name: "closure", fn: "closure", want: int64(15)},
+		{name: "default arguments", fn: "defaults", args: []any{1}, want: []any{int64(1), int64(2), int64(3)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Call(tt.fn, tt.args...)
+			if err != nil {
+				t.Fatalf("Call(%s) error: %v", tt.fn, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Call(%s) = %#v, want %#v", tt.fn, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEval_Limits(t *testing.T) {
+	t.Run("step limit", func(t *testing.T) {
+		s, err := Compile("test", "def f():\n    for i in range(10):\n        for j in range(10):\n            pass\n", WithMaxSteps(50))
+		if err != nil {
+			t.Fatalf("Compile() error: %v", err)
+		}
+		if _, err := s.Call("f"); err == nil || !strings.Contains(err.Error(), "step limit") {
+			t.Errorf("Call() error = %v, want step limit error", err)
+		}
+	})
+
+	t.Run("budget resets per call", func(t *testing.T) {
+		s, err := Compile("test", "def f():\n    for i in range(10):\n        pass\n", WithMaxSteps(50))
+		if err != nil {
+			t.Fatalf("Compile() error: %v", err)
+		}
+		for i := 0; i < 10; i++ {
+			if _, err := s.Call("f"); err != nil {
+				t.Fatalf("call %d: %v", i, err)
+			}
+		}
+	})
+
+	t.Run("recursion depth", func(t *testing.T) {
+		s, err := Compile("test", "def f(n):\n    return f(n + 1)\n", WithMaxSteps(0))
+		if err != nil {
+			t.Fatalf("Compile() error: %v", err)
+		}
+		if _, err := s.Call("f", 0); err == nil || !strings.Contains(err.Error(), "recursion") {
+			t.Errorf("Call() error = %v, want recursion error", err)
+		}
+	})
+}
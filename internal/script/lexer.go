@@ -0,0 +1,303 @@
+package script
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tokenKind identifies the type of a lexical token.
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNewline
+	tokIndent
+	tokDedent
+	tokName
+	tokInt
+	tokFloat
+	tokString
+	tokOp
+)
+
+// token is a single lexical element of a script.
+type token struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of file"
+	case tokNewline:
+		return "newline"
+	case tokIndent:
+		return "indent"
+	case tokDedent:
+		return "dedent"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// operators lists punctuation, longest first.
+var operators = []string{
+	"//=", "==", "!=", "<=", ">=", "+=", "-=", "*=", "/=", "%=", "//", "**",
+	"+", "-", "*", "/", "%", "<", ">", "=", "(", ")", "[", "]", "{", "}",
+	",", ":", ".",
+}
+
+// lexer turns source text into tokens, tracking indentation the way
+// Python does: INDENT/DEDENT tokens bracket each block, and newlines
+// inside brackets are ignored.
+type lexer struct {
+	src    string
+	pos    int
+	line   int
+	depth  int   // bracket nesting
+	indent []int // indentation stack
+	tokens []token
+}
+
+// lex tokenizes a whole script.
+func lex(src string) ([]token, error) {
+	l := &lexer{src: src, line: 1, indent: []int{0}}
+	if err := l.run(); err != nil {
+		return nil, err
+	}
+	return l.tokens, nil
+}
+
+func (l *lexer) emit(kind tokenKind, text string) {
+	l.tokens = append(l.tokens, token{kind: kind, text: text, line: l.line})
+}
+
+func (l *lexer) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", l.line, fmt.Sprintf(format, args...))
+}
+
+func (l *lexer) run() error {
+	atLineStart := true
+
+	for l.pos < len(l.src) {
+		if atLineStart && l.depth == 0 {
+			blank, err := l.lexIndent()
+			if err != nil {
+				return err
+			}
+			// A blank line leaves us at the start of the next line.
+			atLineStart = blank
+			if blank {
+				continue
+			}
+		}
+
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			if l.depth == 0 && len(l.tokens) > 0 && l.tokens[len(l.tokens)-1].kind != tokNewline {
+				l.emit(tokNewline, "")
+			}
+			l.pos++
+			l.line++
+			atLineStart = true
+
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+
+		case c == '\\' && l.pos+1 < len(l.src) && l.src[l.pos+1] == '\n':
+			// Explicit line continuation
+			l.pos += 2
+			l.line++
+
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+
+		case c == '"' || c == '\'':
+			s, err := l.lexString()
+			if err != nil {
+				return err
+			}
+			l.emit(tokString, s)
+
+		case isDigit(c) || (c == '.' && l.pos+1 < len(l.src) && isDigit(l.src[l.pos+1])):
+			l.lexNumber()
+
+		case isNameStart(c):
+			start := l.pos
+			for l.pos < len(l.src) && isNamePart(l.src[l.pos]) {
+				l.pos++
+			}
+			l.emit(tokName, l.src[start:l.pos])
+
+		default:
+			op := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(l.src[l.pos:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return l.errorf("unexpected character %q", c)
+			}
+			switch op {
+			case "(", "[", "{":
+				l.depth++
+			case ")", "]", "}":
+				if l.depth > 0 {
+					l.depth--
+				}
+			}
+			l.emit(tokOp, op)
+			l.pos += len(op)
+		}
+	}
+
+	if len(l.tokens) > 0 && l.tokens[len(l.tokens)-1].kind != tokNewline {
+		l.emit(tokNewline, "")
+	}
+	for len(l.indent) > 1 {
+		l.indent = l.indent[:len(l.indent)-1]
+		l.emit(tokDedent, "")
+	}
+	l.emit(tokEOF, "")
+	return nil
+}
+
+// lexIndent measures leading whitespace and emits INDENT/DEDENT tokens.
+// Reports blank (whitespace/comment-only) lines so they are skipped.
+func (l *lexer) lexIndent() (blank bool, err error) {
+	width := 0
+scan:
+	for l.pos < len(l.src) {
+		switch l.src[l.pos] {
+		case ' ':
+			width++
+		case '\t':
+			width += 8 - width%8
+		case '\r':
+		default:
+			break scan
+		}
+		l.pos++
+	}
+
+	if l.pos >= len(l.src) || l.src[l.pos] == '\n' || l.src[l.pos] == '#' {
+		for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+			l.pos++
+		}
+		if l.pos < len(l.src) {
+			l.pos++
+			l.line++
+		}
+		return true, nil
+	}
+
+	cur := l.indent[len(l.indent)-1]
+	switch {
+	case width > cur:
+		l.indent = append(l.indent, width)
+		l.emit(tokIndent, "")
+	case width < cur:
+		for width < l.indent[len(l.indent)-1] {
+			l.indent = l.indent[:len(l.indent)-1]
+			l.emit(tokDedent, "")
+		}
+		if width != l.indent[len(l.indent)-1] {
+			return false, l.errorf("unindent does not match any outer indentation level")
+		}
+	}
+	return false, nil
+}
+
+// lexString reads a quoted string literal (single, double or triple quoted).
+func (l *lexer) lexString() (string, error) {
+	quote := l.src[l.pos : l.pos+1]
+	if strings.HasPrefix(l.src[l.pos:], strings.Repeat(quote, 3)) {
+		quote = strings.Repeat(quote, 3)
+	}
+	l.pos += len(quote)
+
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		if strings.HasPrefix(l.src[l.pos:], quote) {
+			l.pos += len(quote)
+			return b.String(), nil
+		}
+		c := l.src[l.pos]
+		if c == '\n' {
+			if len(quote) == 1 {
+				return "", l.errorf("unterminated string")
+			}
+			l.line++
+		}
+		if c == '\\' && l.pos+1 < len(l.src) {
+			l.pos++
+			switch e := l.src[l.pos]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '0':
+				b.WriteByte(0)
+			case '\n':
+				l.line++
+			default:
+				b.WriteByte(e)
+			}
+			l.pos++
+			continue
+		}
+		b.WriteByte(c)
+		l.pos++
+	}
+	return "", l.errorf("unterminated string")
+}
+
+// lexNumber reads an integer or float literal.
+func (l *lexer) lexNumber() {
+	start := l.pos
+	isFloat := false
+scan:
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case isDigit(c) || c == '_':
+		case c == '.':
+			isFloat = true
+		case c == 'e' || c == 'E':
+			isFloat = true
+			if l.pos+1 < len(l.src) && (l.src[l.pos+1] == '+' || l.src[l.pos+1] == '-') {
+				l.pos++
+			}
+		default:
+			break scan
+		}
+		l.pos++
+	}
+
+	text := strings.ReplaceAll(l.src[start:l.pos], "_", "")
+	if isFloat {
+		l.emit(tokFloat, text)
+	} else {
+		l.emit(tokInt, text)
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNamePart(c byte) bool {
+	return isNameStart(c) || isDigit(c)
+}
@@ -0,0 +1,71 @@
+package script
+
+import "testing"
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    []string
+		wantErr bool
+	}{
+		{name: "assignment", src: "x = 1\n", want: []string{"x", "=", "1", "newline"}},
+		{name: "augmented", src: "x //= 2", want: []string{"x", "//=", "2", "newline"}},
+		{name: "float", src: "x = 1.5e3", want: []string{"x", "=", "1.5e3", "newline"}},
+		{name: "underscore digits", src: "x = 1_000", want: []string{"x", "=", "1000", "newline"}},
+		{name: "strings", src: `s = "a\tb" + 'c'`, want: []string{"s", "=", "a\tb", "+", "c", "newline"}},
+		{name: "triple quoted", src: "s = \"\"\"a\nb\"\"\"", want: []string{"s", "=", "a\nb", "newline"}},
+		{name: "comment", src: "x = 1  # set x\n", want: []string{"x", "=", "1", "newline"}},
+		{
+			name: "indent and dedent",
+			src:  "if x:\n    y = 1\nz = 2\n",
+			want: []string{"if", "x", ":", "newline", "indent", "y", "=", "1", "newline", "dedent", "z", "=", "2", "newline"},
+		},
+		{
+			name: "blank lines inside block",
+			src:  "if x:\n    y = 1\n\n    # note\n    z = 2\n",
+			want: []string{"if", "x", ":", "newline", "indent", "y", "=", "1", "newline", "z", "=", "2", "newline", "dedent"},
+		},
+		{
+			name: "newline inside brackets",
+			src:  "x = [1,\n     2]\n",
+			want: []string{"x", "=", "[", "1", ",", "2", "]", "newline"},
+		},
+		{name: "line continuation", src: "x = 1 + \\\n 2", want: []string{"x", "=", "1", "+", "2", "newline"}},
+		{name: "unterminated string", src: `s = "oops`, wantErr: true},
+		{name: "bad character", src: "x = $", wantErr: true},
+		{name: "inconsistent dedent", src: "if x:\n    y = 1\n  z = 2\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := lex(tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("lex(%q) error = %v, wantErr %v", tt.src, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			// Drop trailing EOF token
+			tokens = tokens[:len(tokens)-1]
+			got := make([]string, len(tokens))
+			for i, tok := range tokens {
+				switch tok.kind {
+				case tokNewline, tokIndent, tokDedent:
+					got[i] = tok.String()
+				default:
+					got[i] = tok.text
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("lex(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("token[%d] = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,816 @@
+package script
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Statements.
+
+type stmt interface{ stmtLine() int }
+
+type exprStmt struct {
+	line int
+	x    expr
+}
+
+type assignStmt struct {
+	line   int
+	target expr // nameExpr, indexExpr or tupleExpr
+	op     string
+	value  expr
+}
+
+type ifStmt struct {
+	line int
+	cond expr
+	then []stmt
+	els  []stmt
+}
+
+type forStmt struct {
+	line   int
+	target expr
+	iter   expr
+	body   []stmt
+}
+
+type defStmt struct {
+	line   int
+	name   string
+	params []param
+	body   []stmt
+}
+
+type returnStmt struct {
+	line  int
+	value expr // nil for a bare return
+}
+
+type branchStmt struct {
+	line int
+	kind string // "pass", "break" or "continue"
+}
+
+func (s *exprStmt) stmtLine() int   { return s.line }
+func (s *assignStmt) stmtLine() int { return s.line }
+func (s *ifStmt) stmtLine() int     { return s.line }
+func (s *forStmt) stmtLine() int    { return s.line }
+func (s *defStmt) stmtLine() int    { return s.line }
+func (s *returnStmt) stmtLine() int { return s.line }
+func (s *branchStmt) stmtLine() int { return s.line }
+
+// param is a function parameter with an optional default value.
+type param struct {
+	name string
+	def  expr
+}
+
+// Expressions.
+
+type expr interface{ exprLine() int }
+
+type literalExpr struct {
+	line int
+	val  any
+}
+
+type nameExpr struct {
+	line int
+	name string
+}
+
+type unaryExpr struct {
+	line int
+	op   string
+	x    expr
+}
+
+type binaryExpr struct {
+	line int
+	op   string
+	l, r expr
+}
+
+type condExpr struct {
+	line            int
+	cond, then, els expr
+}
+
+type callExpr struct {
+	line   int
+	fn     expr
+	args   []expr
+	kwargs []kwarg
+}
+
+type kwarg struct {
+	name  string
+	value expr
+}
+
+type indexExpr struct {
+	line int
+	x    expr
+	key  expr
+}
+
+type sliceExpr struct {
+	line   int
+	x      expr
+	lo, hi expr // either may be nil
+}
+
+type attrExpr struct {
+	line int
+	x    expr
+	name string
+}
+
+type listExpr struct {
+	line  int
+	elems []expr
+}
+
+type tupleExpr struct {
+	line  int
+	elems []expr
+}
+
+type dictExpr struct {
+	line         int
+	keys, values []expr
+}
+
+func (e *literalExpr) exprLine() int { return e.line }
+func (e *nameExpr) exprLine() int    { return e.line }
+func (e *unaryExpr) exprLine() int   { return e.line }
+func (e *binaryExpr) exprLine() int  { return e.line }
+func (e *condExpr) exprLine() int    { return e.line }
+func (e *callExpr) exprLine() int    { return e.line }
+func (e *indexExpr) exprLine() int   { return e.line }
+func (e *sliceExpr) exprLine() int   { return e.line }
+func (e *attrExpr) exprLine() int    { return e.line }
+func (e *listExpr) exprLine() int    { return e.line }
+func (e *tupleExpr) exprLine() int   { return e.line }
+func (e *dictExpr) exprLine() int    { return e.line }
+
+// parser is a recursive-descent parser over the token stream.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// parse compiles source text into a list of top-level statements.
+func parse(src string) ([]stmt, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+
+	var stmts []stmt
+	for p.peek().kind != tokEOF {
+		s, err := p.parseStmt()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, s)
+	}
+	return stmts, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// isOp reports whether the next token is the given operator or keyword.
+func (p *parser) isOp(text string) bool {
+	tok := p.peek()
+	return (tok.kind == tokOp || tok.kind == tokName) && tok.text == text
+}
+
+func (p *parser) errorf(tok token, format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", tok.line, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) expect(text string) error {
+	if !p.isOp(text) {
+		return p.errorf(p.peek(), "expected %q, found %s", text, p.peek())
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) expectKind(kind tokenKind, what string) (token, error) {
+	tok := p.next()
+	if tok.kind != kind {
+		return tok, p.errorf(tok, "expected %s, found %s", what, tok)
+	}
+	return tok, nil
+}
+
+func (p *parser) parseStmt() (stmt, error) {
+	tok := p.peek()
+	if tok.kind == tokName {
+		switch tok.text {
+		case "def":
+			return p.parseDef()
+		case "if":
+			return p.parseIf()
+		case "for":
+			return p.parseFor()
+		}
+	}
+
+	s, err := p.parseSimpleStmt()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expectKind(tokNewline, "newline"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (p *parser) parseSimpleStmt() (stmt, error) {
+	tok := p.peek()
+	if tok.kind == tokName {
+		switch tok.text {
+		case "return":
+			p.next()
+			if p.peek().kind == tokNewline {
+				return &returnStmt{line: tok.line}, nil
+			}
+			x, err := p.parseExprList()
+			if err != nil {
+				return nil, err
+			}
+			return &returnStmt{line: tok.line, value: x}, nil
+		case "pass", "break", "continue":
+			p.next()
+			return &branchStmt{line: tok.line, kind: tok.text}, nil
+		}
+	}
+
+	x, err := p.parseExprList()
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.peek()
+	if op.kind != tokOp {
+		return &exprStmt{line: tok.line, x: x}, nil
+	}
+	switch op.text {
+	case "=", "+=", "-=", "*=", "/=", "//=", "%=":
+	default:
+		return &exprStmt{line: tok.line, x: x}, nil
+	}
+	p.next()
+
+	if err := checkTarget(x, op.text != "="); err != nil {
+		return nil, p.errorf(op, "%v", err)
+	}
+	value, err := p.parseExprList()
+	if err != nil {
+		return nil, err
+	}
+	return &assignStmt{line: tok.line, target: x, op: op.text, value: value}, nil
+}
+
+// checkTarget verifies that x can be assigned to.
+func checkTarget(x expr, augmented bool) error {
+	switch t := x.(type) {
+	case *nameExpr, *indexExpr:
+		return nil
+	case *tupleExpr:
+		if augmented {
+			return fmt.Errorf("augmented assignment to a tuple")
+		}
+		for _, elem := range t.elems {
+			if err := checkTarget(elem, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("cannot assign to expression")
+}
+
+// parseBlock reads ":" NEWLINE INDENT stmts DEDENT, or a single
+// simple statement on the same line.
+func (p *parser) parseBlock() ([]stmt, error) {
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+
+	if p.peek().kind != tokNewline {
+		s, err := p.parseSimpleStmt()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expectKind(tokNewline, "newline"); err != nil {
+			return nil, err
+		}
+		return []stmt{s}, nil
+	}
+
+	p.next()
+	if _, err := p.expectKind(tokIndent, "indented block"); err != nil {
+		return nil, err
+	}
+	var body []stmt
+	for p.peek().kind != tokDedent && p.peek().kind != tokEOF {
+		s, err := p.parseStmt()
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, s)
+	}
+	p.next()
+	return body, nil
+}
+
+func (p *parser) parseDef() (stmt, error) {
+	tok := p.next()
+	name, err := p.expectKind(tokName, "function name")
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	var params []param
+	for !p.isOp(")") {
+		pn, err := p.expectKind(tokName, "parameter name")
+		if err != nil {
+			return nil, err
+		}
+		prm := param{name: pn.text}
+		if p.isOp("=") {
+			p.next()
+			if prm.def, err = p.parseTest(); err != nil {
+				return nil, err
+			}
+		} else if len(params) > 0 && params[len(params)-1].def != nil {
+			return nil, p.errorf(pn, "non-default parameter follows default parameter")
+		}
+		params = append(params, prm)
+		if !p.isOp(",") {
+			break
+		}
+		p.next()
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	return &defStmt{line: tok.line, name: name.text, params: params, body: body}, nil
+}
+
+func (p *parser) parseIf() (stmt, error) {
+	tok := p.next() // "if" or "elif"
+	cond, err := p.parseTest()
+	if err != nil {
+		return nil, err
+	}
+	then, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	s := &ifStmt{line: tok.line, cond: cond, then: then}
+
+	switch {
+	case p.isOp("elif"):
+		elif, err := p.parseIf()
+		if err != nil {
+			return nil, err
+		}
+		s.els = []stmt{elif}
+	case p.isOp("else"):
+		p.next()
+		if s.els, err = p.parseBlock(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (p *parser) parseFor() (stmt, error) {
+	tok := p.next()
+
+	var elems []expr
+	for {
+		name, err := p.expectKind(tokName, "loop variable")
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, &nameExpr{line: name.line, name: name.text})
+		if !p.isOp(",") {
+			break
+		}
+		p.next()
+	}
+	var target expr = elems[0]
+	if len(elems) > 1 {
+		target = &tupleExpr{line: tok.line, elems: elems}
+	}
+
+	if err := p.expect("in"); err != nil {
+		return nil, err
+	}
+	iter, err := p.parseExprList()
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	return &forStmt{line: tok.line, target: target, iter: iter, body: body}, nil
+}
+
+// parseExprList parses "a, b, c" as a tuple, or a single expression.
+func (p *parser) parseExprList() (expr, error) {
+	first, err := p.parseTest()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOp(",") {
+		return first, nil
+	}
+
+	elems := []expr{first}
+	for p.isOp(",") {
+		p.next()
+		if p.atExprEnd() {
+			break
+		}
+		x, err := p.parseTest()
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, x)
+	}
+	return &tupleExpr{line: first.exprLine(), elems: elems}, nil
+}
+
+// atExprEnd reports whether the next token cannot start an expression.
+func (p *parser) atExprEnd() bool {
+	tok := p.peek()
+	switch tok.kind {
+	case tokNewline, tokEOF:
+		return true
+	case tokOp:
+		switch tok.text {
+		case ")", "]", "}", "=", ":":
+			return true
+		}
+	}
+	return false
+}
+
+// parseTest parses a conditional expression: x if cond else y.
+func (p *parser) parseTest() (expr, error) {
+	x, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOp("if") {
+		return x, nil
+	}
+	tok := p.next()
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("else"); err != nil {
+		return nil, err
+	}
+	els, err := p.parseTest()
+	if err != nil {
+		return nil, err
+	}
+	return &condExpr{line: tok.line, cond: cond, then: x, els: els}, nil
+}
+
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("or") {
+		tok := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{line: tok.line, op: "or", l: left, r: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("and") {
+		tok := p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{line: tok.line, op: "and", l: left, r: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.isOp("not") {
+		tok := p.next()
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{line: tok.line, op: "not", x: x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (expr, error) {
+	left, err := p.parseArith()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		op := ""
+		switch {
+		case tok.kind == tokOp && (tok.text == "==" || tok.text == "!=" || tok.text == "<" ||
+			tok.text == "<=" || tok.text == ">" || tok.text == ">="):
+			op = tok.text
+			p.next()
+		case p.isOp("in"):
+			op = "in"
+			p.next()
+		case p.isOp("not") && p.tokens[p.pos+1].kind == tokName && p.tokens[p.pos+1].text == "in":
+			op = "not in"
+			p.pos += 2
+		default:
+			return left, nil
+		}
+		right, err := p.parseArith()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{line: tok.line, op: op, l: left, r: right}
+	}
+}
+
+func (p *parser) parseArith() (expr, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+") || p.isOp("-") {
+		tok := p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{line: tok.line, op: tok.text, l: left, r: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseTerm() (expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("*") || p.isOp("/") || p.isOp("//") || p.isOp("%") {
+		tok := p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{line: tok.line, op: tok.text, l: left, r: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if p.isOp("-") || p.isOp("+") {
+		tok := p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{line: tok.line, op: tok.text, x: x}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (expr, error) {
+	x, err := p.parseAtom()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		switch {
+		case p.isOp("."):
+			p.next()
+			name, err := p.expectKind(tokName, "attribute name")
+			if err != nil {
+				return nil, err
+			}
+			x = &attrExpr{line: tok.line, x: x, name: name.text}
+
+		case p.isOp("("):
+			p.next()
+			call := &callExpr{line: tok.line, fn: x}
+			for !p.isOp(")") {
+				if p.peek().kind == tokName && p.tokens[p.pos+1].kind == tokOp && p.tokens[p.pos+1].text == "=" {
+					name := p.next()
+					p.next()
+					v, err := p.parseTest()
+					if err != nil {
+						return nil, err
+					}
+					call.kwargs = append(call.kwargs, kwarg{name: name.text, value: v})
+				} else {
+					if len(call.kwargs) > 0 {
+						return nil, p.errorf(p.peek(), "positional argument follows keyword argument")
+					}
+					v, err := p.parseTest()
+					if err != nil {
+						return nil, err
+					}
+					call.args = append(call.args, v)
+				}
+				if !p.isOp(",") {
+					break
+				}
+				p.next()
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			x = call
+
+		case p.isOp("["):
+			p.next()
+			var lo, hi expr
+			if !p.isOp(":") {
+				if lo, err = p.parseTest(); err != nil {
+					return nil, err
+				}
+			}
+			if p.isOp(":") {
+				p.next()
+				if !p.isOp("]") {
+					if hi, err = p.parseTest(); err != nil {
+						return nil, err
+					}
+				}
+				x = &sliceExpr{line: tok.line, x: x, lo: lo, hi: hi}
+			} else {
+				x = &indexExpr{line: tok.line, x: x, key: lo}
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *parser) parseAtom() (expr, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokInt:
+		i, err := strconv.ParseInt(tok.text, 10, 64)
+		if err != nil {
+			return nil, p.errorf(tok, "invalid integer %q", tok.text)
+		}
+		return &literalExpr{line: tok.line, val: i}, nil
+
+	case tokFloat:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf(tok, "invalid number %q", tok.text)
+		}
+		return &literalExpr{line: tok.line, val: f}, nil
+
+	case tokString:
+		s := tok.text
+		// Adjacent string literals are concatenated.
+		for p.peek().kind == tokString {
+			s += p.next().text
+		}
+		return &literalExpr{line: tok.line, val: s}, nil
+
+	case tokName:
+		switch tok.text {
+		case "True":
+			return &literalExpr{line: tok.line, val: true}, nil
+		case "False":
+			return &literalExpr{line: tok.line, val: false}, nil
+		case "None":
+			return &literalExpr{line: tok.line, val: nil}, nil
+		}
+		if keywords[tok.text] {
+			return nil, p.errorf(tok, "unexpected keyword %q", tok.text)
+		}
+		return &nameExpr{line: tok.line, name: tok.text}, nil
+
+	case tokOp:
+		switch tok.text {
+		case "(":
+			if p.isOp(")") {
+				p.next()
+				return &tupleExpr{line: tok.line}, nil
+			}
+			x, err := p.parseExprList()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+
+		case "[":
+			list := &listExpr{line: tok.line}
+			for !p.isOp("]") {
+				x, err := p.parseTest()
+				if err != nil {
+					return nil, err
+				}
+				list.elems = append(list.elems, x)
+				if !p.isOp(",") {
+					break
+				}
+				p.next()
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			return list, nil
+
+		case "{":
+			dict := &dictExpr{line: tok.line}
+			for !p.isOp("}") {
+				k, err := p.parseTest()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				v, err := p.parseTest()
+				if err != nil {
+					return nil, err
+				}
+				dict.keys = append(dict.keys, k)
+				dict.values = append(dict.values, v)
+				if !p.isOp(",") {
+					break
+				}
+				p.next()
+			}
+			if err := p.expect("}"); err != nil {
+				return nil, err
+			}
+			return dict, nil
+		}
+	}
+
+	return nil, p.errorf(tok, "unexpected %s", tok)
+}
+
+// keywords cannot be used as names.
+var keywords = map[string]bool{
+	"and": true, "def": true, "elif": true, "else": true, "for": true,
+	"if": true, "in": true, "not": true, "or": true, "pass": true,
+	"return": true, "break": true, "continue": true,
+}
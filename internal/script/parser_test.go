@@ -0,0 +1,62 @@
+package script
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		src       string
+		wantStmts int
+	}{
+		{name: "empty", src: "", wantStmts: 0},
+		{name: "assignments", src: "a = 1\nb, c = 2, 3\nd[\"k\"] = 4\n", wantStmts: 3},
+		{name: "def with defaults", src: "def f(a, b=1):\n    return a + b\n", wantStmts: 1},
+		{name: "if elif else", src: "if a:\n    pass\nelif b:\n    pass\nelse:\n    pass\n", wantStmts: 1},
+		{name: "for tuple target", src: "for k, v in d.items():\n    continue\n", wantStmts: 1},
+		{name: "one-line block", src: "if a: b = 1\n", wantStmts: 1},
+		{name: "conditional expression", src: "x = 1 if a else 2\n", wantStmts: 1},
+		{name: "not in", src: "x = a not in b\n", wantStmts: 1},
+		{name: "call with kwargs", src: "x = sorted(l, key=f, reverse=True)\n", wantStmts: 1},
+		{name: "slices", src: "x = s[1:]\ny = s[:-1]\nz = s[:]\n", wantStmts: 3},
+		{name: "trailing commas", src: "x = [1, 2,]\ny = {\"a\": 1,}\nz = (1,)\n", wantStmts: 3},
+		{name: "adjacent strings", src: "x = \"a\" \"b\"\n", wantStmts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmts, err := parse(tt.src)
+			if err != nil {
+				t.Fatalf("parse(%q) error: %v", tt.src, err)
+			}
+			if len(stmts) != tt.wantStmts {
+				t.Errorf("parse(%q) returned %d statements, want %d", tt.src, len(stmts), tt.wantStmts)
+			}
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []string{
+		"x = \n",
+		"def f(:\n    pass\n",
+		"def f(a=1, b):\n    pass\n",
+		"if x\n    pass\n",
+		"if x:\npass\n",
+		"1 = x\n",
+		"f() = 1\n",
+		"a, b += 1\n",
+		"x = (1, 2\n",
+		"x = {1: }\n",
+		"for 1 in x:\n    pass\n",
+		"f(a=1, 2)\n",
+		"x = if\n",
+	}
+
+	for _, src := range tests {
+		t.Run(src, func(t *testing.T) {
+			if _, err := parse(src); err == nil {
+				t.Errorf("parse(%q) expected error, got nil", src)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+// Package script implements a small, sandboxed subset of Starlark
+// (a Python dialect) used to transform log entries.
+//
+// Example:
+//
+//	def transform(entry):
+//	    if entry.get("level") == "debug":
+//	        return None
+//	    entry["service"] = entry.get("service", "unknown").upper()
+//	    return entry
+//
+// Supported: def (with default arguments), if/elif/else, for loops
+// with break/continue, assignment including tuple unpacking and +=,
+// conditional expressions, and/or/not, in/not in, slicing, string
+// formatting with %, and list, tuple and dict literals. Comprehensions,
+// lambda, load, *args/**kwargs parameters and the bitwise operators are
+// not supported. Values are None, bools, ints, floats, strings,
+// lists, tuples and dicts with string keys; dicts iterate in key order.
+// Scripts cannot access files, the network or the clock, and every call
+// runs under a step budget so that a runaway loop fails instead of
+// hanging the pipeline.
+package script
+
+import (
+	"fmt"
+	"os"
+)
+
+// DefaultMaxSteps is the default per-call statement budget.
+const DefaultMaxSteps = 100000
+
+// Script is a loaded program. Top-level statements run once at load
+// time; functions they define can then be called any number of times.
+// A Script is not safe for concurrent use.
+type Script struct {
+	name     string
+	globals  *env
+	maxSteps int
+	print    func(string)
+}
+
+// Option configures a Script.
+type Option func(*Script)
+
+// WithPrint sets the destination for print(). By default output is
+// discarded.
+func WithPrint(fn func(string)) Option {
+	return func(s *Script) {
+		s.print = fn
+	}
+}
+
+// WithMaxSteps sets the statement budget for loading and for each call.
+// Zero disables the limit.
+func WithMaxSteps(n int) Option {
+	return func(s *Script) {
+		s.maxSteps = n
+	}
+}
+
+// Load reads and compiles a script file.
+func Load(path string, opts ...Option) (*Script, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // path comes from the command line
+	if err != nil {
+		return nil, err
+	}
+	return Compile(path, string(data), opts...)
+}
+
+// Compile parses src and runs its top-level statements. name is used
+// in error messages.
+func Compile(name, src string, opts ...Option) (*Script, error) {
+	s := &Script{name: name, globals: newEnv(nil), maxSteps: DefaultMaxSteps}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	stmts, err := parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	in := s.interp()
+	ctl, _, err := in.execBlock(stmts, s.globals)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if ctl != ctlNone {
+		return nil, fmt.Errorf("%s: return, break or continue outside a function or loop", name)
+	}
+	return s, nil
+}
+
+func (s *Script) interp() *interp {
+	return &interp{maxSteps: s.maxSteps, print: s.print}
+}
+
+// Has reports whether the script defines a function called name.
+func (s *Script) Has(name string) bool {
+	_, ok := s.globals.vars[name].(*function)
+	return ok
+}
+
+// Call invokes the function name with the given arguments. Arguments
+// are converted from Go values (maps, slices, numbers, strings) and the
+// result is converted back: lists and tuples become []any, dicts become
+// map[string]any and ints become int64.
+func (s *Script) Call(name string, args ...any) (any, error) {
+	fn, ok := s.globals.vars[name].(*function)
+	if !ok {
+		return nil, fmt.Errorf("%s: function %q is not defined", s.name, name)
+	}
+
+	vals := make([]any, len(args))
+	for i, a := range args {
+		vals[i] = toValue(a)
+	}
+
+	v, err := s.interp().call(fn, vals, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", s.name, name, err)
+	}
+	return fromValue(v), nil
+}
@@ -0,0 +1,121 @@
+package script
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transform.star")
+	src := "def transform(entry):\n    entry[\"seen\"] = True\n    return entry\n"
+	if err := os.WriteFile(path, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if !s.Has("transform") {
+		t.Error("Has(transform) = false, want true")
+	}
+	if s.Has("missing") {
+		t.Error("Has(missing) = true, want false")
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.star")); err == nil {
+		t.Error("Load() of a missing file should fail")
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantErr string
+	}{
+		{name: "syntax error", src: "def f(\n", wantErr: "line"},
+		{name: "top-level runtime error", src: "x = 1 / 0\n", wantErr: "division by zero"},
+		{name: "return at top level", src: "return 1\n", wantErr: "outside a function"},
+		{name: "infinite top-level loop", src: "for i in range(1000000):\n    pass\n", wantErr: "step limit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile("test.star", tt.src)
+			if err == nil {
+				t.Fatal("Compile() expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Compile() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if !strings.HasPrefix(err.Error(), "test.star:") {
+				t.Errorf("Compile() error = %v, want it to name the script", err)
+			}
+		})
+	}
+}
+
+func TestScript_Call(t *testing.T) {
+	src := `
+TAGS = ["a", "b"]
+
+def transform(entry):
+    entry["tags"] = TAGS + entry.get("extra", [])
+    entry["status"] = entry["status"] + 1
+    return entry
+`
+	s, err := Compile("test", src)
+	if err != nil {
+		t.Fatalf("Compile() error: %v", err)
+	}
+
+	in := map[string]any{"status": 200, "extra": []any{"c"}, "nested": map[string]any{"n": 1.5}}
+	got, err := s.Call("transform", in)
+	if err != nil {
+		t.Fatalf("Call() error: %v", err)
+	}
+
+	want := map[string]any{
+		"status": int64(201),
+		"extra":  []any{"c"},
+		"tags":   []any{"a", "b", "c"},
+		"nested": map[string]any{"n": 1.5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Call() = %#v, want %#v", got, want)
+	}
+
+	// The caller's map is converted, not shared.
+	if _, ok := in["tags"]; ok {
+		t.Error("Call() modified the input map")
+	}
+
+	if _, err := s.Call("nope"); err == nil {
+		t.Error("Call() of an undefined function should fail")
+	}
+	if _, err := s.Call("transform"); err == nil {
+		t.Error("Call() with missing arguments should fail")
+	}
+}
+
+func TestScript_Print(t *testing.T) {
+	var lines []string
+	s, err := Compile("test", "print(\"loaded\", 1)\ndef f():\n    print([1])\n", WithPrint(func(s string) {
+		lines = append(lines, s)
+	}))
+	if err != nil {
+		t.Fatalf("Compile() error: %v", err)
+	}
+	if _, err := s.Call("f"); err != nil {
+		t.Fatalf("Call() error: %v", err)
+	}
+
+	want := []string{"loaded 1", "[1]"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("printed %q, want %q", lines, want)
+	}
+}
@@ -0,0 +1,350 @@
+package script
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Script values are represented with plain Go types:
+//
+//	None   nil
+//	bool   bool
+//	int    int64
+//	float  float64
+//	string string
+//	list   *list
+//	tuple  tuple
+//	dict   map[string]any (string keys only)
+//
+// plus *function and *builtin for callables.
+
+// list is a mutable sequence; it is a pointer so that appends are
+// visible through every reference.
+type list struct {
+	elems []any
+}
+
+// tuple is an immutable sequence.
+type tuple []any
+
+// function is a user-defined function.
+type function struct {
+	def *defStmt
+	env *env
+}
+
+// builtin is a function implemented in Go.
+type builtin struct {
+	name string
+	fn   func(in *interp, args []any, kwargs map[string]any) (any, error)
+}
+
+// typeName returns the script-level type name of v.
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "NoneType"
+	case bool:
+		return "bool"
+	case int64:
+		return "int"
+	case float64:
+		return "float"
+	case string:
+		return "string"
+	case *list:
+		return "list"
+	case tuple:
+		return "tuple"
+	case map[string]any:
+		return "dict"
+	case *function, *builtin:
+		return "function"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// toValue converts a Go value (as found in entry fields) to a script value.
+func toValue(v any) any {
+	switch x := v.(type) {
+	case int:
+		return int64(x)
+	case int32:
+		return int64(x)
+	case float32:
+		return float64(x)
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return i
+		}
+		f, _ := x.Float64()
+		return f
+	case []any:
+		elems := make([]any, len(x))
+		for i, e := range x {
+			elems[i] = toValue(e)
+		}
+		return &list{elems: elems}
+	case []string:
+		elems := make([]any, len(x))
+		for i, e := range x {
+			elems[i] = e
+		}
+		return &list{elems: elems}
+	case map[string]any:
+		m := make(map[string]any, len(x))
+		for k, e := range x {
+			m[k] = toValue(e)
+		}
+		return m
+	}
+	return v
+}
+
+// fromValue converts a script value back to plain Go values.
+// Integral floats are left alone; ints stay int64.
+func fromValue(v any) any {
+	switch x := v.(type) {
+	case *list:
+		return fromElems(x.elems)
+	case tuple:
+		return fromElems(x)
+	case map[string]any:
+		m := make(map[string]any, len(x))
+		for k, e := range x {
+			m[k] = fromValue(e)
+		}
+		return m
+	case *function, *builtin:
+		return str(v)
+	}
+	return v
+}
+
+func fromElems(elems []any) []any {
+	out := make([]any, len(elems))
+	for i, e := range elems {
+		out[i] = fromValue(e)
+	}
+	return out
+}
+
+// truthy implements Python truthiness.
+func truthy(v any) bool {
+	switch x := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return x
+	case int64:
+		return x != 0
+	case float64:
+		return x != 0
+	case string:
+		return x != ""
+	case *list:
+		return len(x.elems) > 0
+	case tuple:
+		return len(x) > 0
+	case map[string]any:
+		return len(x) > 0
+	}
+	return true
+}
+
+// str renders v the way str() does: strings are returned as is.
+func str(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return repr(v)
+}
+
+// repr renders v as a script literal.
+func repr(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return "None"
+	case bool:
+		if x {
+			return "True"
+		}
+		return "False"
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		if x == math.Trunc(x) && math.Abs(x) < 1e16 {
+			return strconv.FormatFloat(x, 'f', 1, 64)
+		}
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	case string:
+		return strconv.Quote(x)
+	case *list:
+		return "[" + joinRepr(x.elems) + "]"
+	case tuple:
+		if len(x) == 1 {
+			return "(" + repr(x[0]) + ",)"
+		}
+		return "(" + joinRepr(x) + ")"
+	case map[string]any:
+		parts := make([]string, 0, len(x))
+		for _, k := range sortedKeys(x) {
+			parts = append(parts, strconv.Quote(k)+": "+repr(x[k]))
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case *function:
+		return "<function " + x.def.name + ">"
+	case *builtin:
+		return "<built-in function " + x.name + ">"
+	}
+	return fmt.Sprint(v)
+}
+
+func joinRepr(elems []any) string {
+	parts := make([]string, len(elems))
+	for i, e := range elems {
+		parts[i] = repr(e)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sortedKeys returns the keys of a dict in sorted order, which is the
+// order in which dicts are iterated.
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// toFloat converts ints and floats to float64.
+func toFloat(v any) (float64, bool) {
+	switch x := v.(type) {
+	case int64:
+		return float64(x), true
+	case float64:
+		return x, true
+	}
+	return 0, false
+}
+
+// equal reports deep equality; ints and floats compare numerically.
+func equal(a, b any) bool {
+	switch x := a.(type) {
+	case int64, float64:
+		fa, _ := toFloat(x)
+		fb, ok := toFloat(b)
+		return ok && fa == fb
+	case *list:
+		y, ok := b.(*list)
+		return ok && equalElems(x.elems, y.elems)
+	case tuple:
+		y, ok := b.(tuple)
+		return ok && equalElems(x, y)
+	case map[string]any:
+		y, ok := b.(map[string]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			w, ok := y[k]
+			if !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case *function, *builtin:
+		return a == b
+	}
+	switch b.(type) {
+	case int64, float64, *list, tuple, map[string]any:
+		return false
+	}
+	return a == b
+}
+
+func equalElems(a, b []any) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// compare orders two values of the same kind: numbers, strings,
+// or sequences compared element by element.
+func compare(a, b any) (int, error) {
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			switch {
+			case fa < fb:
+				return -1, nil
+			case fa > fb:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), nil
+		}
+	case *list:
+		if y, ok := b.(*list); ok {
+			return compareElems(x.elems, y.elems)
+		}
+	case tuple:
+		if y, ok := b.(tuple); ok {
+			return compareElems(x, y)
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %s with %s", typeName(a), typeName(b))
+}
+
+func compareElems(a, b []any) (int, error) {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		c, err := compare(a[i], b[i])
+		if err != nil || c != 0 {
+			return c, err
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1, nil
+	case len(a) > len(b):
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// elements returns the items produced by iterating over v.
+// Dicts iterate over their keys in sorted order; strings are not iterable.
+func elements(v any) ([]any, error) {
+	switch x := v.(type) {
+	case *list:
+		// Copy so that mutation during iteration is harmless.
+		return append([]any(nil), x.elems...), nil
+	case tuple:
+		return x, nil
+	case map[string]any:
+		keys := sortedKeys(x)
+		out := make([]any, len(keys))
+		for i, k := range keys {
+			out[i] = k
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("%s is not iterable", typeName(v))
+}
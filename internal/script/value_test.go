@@ -0,0 +1,86 @@
+package script
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestToValue(t *testing.T) {
+	tests := []struct {
+		name string
+		in   any
+		want any
+	}{
+		{name: "int", in: 5, want: int64(5)},
+		{name: "json integer", in: json.Number("7"), want: int64(7)},
+		{name: "json float", in: json.Number("1.5"), want: 1.5},
+		{name: "slice", in: []any{1, "a"}, want: &list{elems: []any{int64(1), "a"}}},
+		{name: "string slice", in: []string{"a"}, want: &list{elems: []any{"a"}}},
+		{name: "nested map", in: map[string]any{"a": []any{2}}, want: map[string]any{"a": &list{elems: []any{int64(2)}}}},
+		{name: "passthrough", in: "s", want: "s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := toValue(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("toValue(%#v) = %#v, want %#v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromValue(t *testing.T) {
+	in := map[string]any{
+		"l": &list{elems: []any{int64(1), tuple{"a", nil}}},
+		"f": builtins["len"],
+	}
+	want := map[string]any{
+		"l": []any{int64(1), []any{"a", nil}},
+		"f": "<built-in function len>",
+	}
+	if got := fromValue(in); !reflect.DeepEqual(got, want) {
+		t.Errorf("fromValue() = %#v, want %#v", got, want)
+	}
+}
+
+func TestRepr(t *testing.T) {
+	tests := []struct {
+		in   any
+		want string
+	}{
+		{nil, "None"},
+		{true, "True"},
+		{int64(-3), "-3"},
+		{2.0, "2.0"},
+		{0.25, "0.25"},
+		{"a\"b", `"a\"b"`},
+		{&list{elems: []any{int64(1), "x"}}, `[1, "x"]`},
+		{tuple{int64(1)}, "(1,)"},
+		{tuple{int64(1), int64(2)}, "(1, 2)"},
+		{map[string]any{"b": int64(2), "a": nil}, `{"a": None, "b": 2}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := repr(tt.in); got != tt.want {
+				t.Errorf("repr(%#v) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruthy(t *testing.T) {
+	falsy := []any{nil, false, int64(0), 0.0, "", &list{}, tuple{}, map[string]any{}}
+	for _, v := range falsy {
+		if truthy(v) {
+			t.Errorf("truthy(%#v) = true, want false", v)
+		}
+	}
+	truthyVals := []any{true, int64(1), 0.5, "x", &list{elems: []any{nil}}, tuple{nil}, map[string]any{"a": nil}}
+	for _, v := range truthyVals {
+		if !truthy(v) {
+			t.Errorf("truthy(%#v) = false, want true", v)
+		}
+	}
+}
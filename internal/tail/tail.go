@@ -0,0 +1,348 @@
+// Package tail follows the files matching a glob pattern as they grow, as
+// tail -F does for a directory of logs: files that appear are picked up,
+// a file replaced by a new one under its name (rotated) is finished and
+// the new one read from its start, a truncated file is read again from
+// its start, and a removed file is finished and dropped. Files are polled,
+// so that following needs nothing from the platform but stat.
+package tail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults for a Follower.
+const (
+	DefaultInterval    = 250 * time.Millisecond
+	DefaultMaxLineSize = 1024 * 1024
+)
+
+// readSize is how much of a file is read at a time.
+const readSize = 64 * 1024
+
+// Line is a line of a followed file, or the end of one.
+type Line struct {
+	// Path is the file's path, as the pattern matched it.
+	Path string
+
+	// Text is the line, without its newline. A line longer than the
+	// maximum line size is cut into pieces of that size.
+	Text string
+
+	// Number is the 1-based line number in the file; lines of a file
+	// rotated under the same path count on.
+	Number int
+
+	// Err is an error reading the file, which stops following it until it
+	// is replaced.
+	Err error
+
+	// Gone marks the end of a file that was removed, after its last line;
+	// it carries no text.
+	Gone bool
+}
+
+// Option configures a Follower.
+type Option func(*Follower)
+
+// WithInterval sets how often files are polled for new lines and the
+// pattern for new files.
+func WithInterval(d time.Duration) Option {
+	return func(f *Follower) {
+		if d > 0 {
+			f.interval = d
+		}
+	}
+}
+
+// WithFromStart reads the files that already exist when following starts
+// from their start, instead of only the lines written to them after.
+func WithFromStart() Option {
+	return func(f *Follower) {
+		f.fromStart = true
+	}
+}
+
+// WithMaxLineSize sets the longest line returned whole.
+func WithMaxLineSize(size int) Option {
+	return func(f *Follower) {
+		if size > 0 {
+			f.maxLine = size
+		}
+	}
+}
+
+// WithReadCounter adds the number of bytes read to n as reading goes.
+func WithReadCounter(n *atomic.Int64) Option {
+	return func(f *Follower) {
+		f.read = n
+	}
+}
+
+// Follower follows the files matching a pattern.
+type Follower struct {
+	pattern   string
+	interval  time.Duration
+	fromStart bool
+	maxLine   int
+	read      *atomic.Int64
+
+	files map[string]*file
+	buf   []byte
+}
+
+// file is a followed file.
+type file struct {
+	path    string
+	f       *os.File // nil after a read error, until the file is replaced
+	info    os.FileInfo
+	offset  int64
+	partial []byte // the start of a line not yet ended
+	number  int
+}
+
+// New creates a Follower of the files matching pattern, in the syntax of
+// filepath.Match.
+func New(pattern string, opts ...Option) (*Follower, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	f := &Follower{
+		pattern:  pattern,
+		interval: DefaultInterval,
+		maxLine:  DefaultMaxLineSize,
+		files:    make(map[string]*file),
+		buf:      make([]byte, readSize),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f, nil
+}
+
+// Lines follows the files until ctx is done, then closes the channel.
+// It should only be called once.
+func (f *Follower) Lines(ctx context.Context) <-chan Line {
+	lines := make(chan Line)
+	go func() {
+		defer close(lines)
+		defer f.closeAll()
+		send := func(line Line) bool {
+			select {
+			case lines <- line:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		ticker := time.NewTicker(f.interval)
+		defer ticker.Stop()
+		for first := true; ; first = false {
+			if !f.poll(first, send) {
+				return
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return lines
+}
+
+// poll picks up new files, reads what was written to every file, and
+// handles those rotated, truncated or removed. At the first poll, files
+// are opened at their end unless WithFromStart was given. It returns
+// false once send does.
+func (f *Follower) poll(first bool, send func(Line) bool) bool {
+	paths, _ := filepath.Glob(f.pattern)
+	sort.Strings(paths)
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		seen[path] = true
+		if _, ok := f.files[path]; !ok {
+			fl := &file{path: path}
+			f.files[path] = fl
+			if err := f.open(fl, first && !f.fromStart); err != nil && !send(Line{Path: path, Err: err}) {
+				return false
+			}
+		}
+	}
+
+	for _, path := range sortedPaths(f.files) {
+		fl := f.files[path]
+		if !f.readFile(fl, send) {
+			return false
+		}
+		info, err := os.Stat(path)
+		switch {
+		case err != nil || !seen[path]:
+			// Removed: whatever was written to it last is read
+			if !f.readFile(fl, send) || !f.finish(fl, send) || !send(Line{Path: path, Gone: true}) {
+				return false
+			}
+			delete(f.files, path)
+		case fl.info == nil || !os.SameFile(info, fl.info):
+			// Replaced by a new file: the old one is read to its end first
+			if !f.readFile(fl, send) || !f.finish(fl, send) {
+				return false
+			}
+			if err := f.open(fl, false); err != nil {
+				if !send(Line{Path: path, Err: err}) {
+					return false
+				}
+				continue
+			}
+			if !f.readFile(fl, send) {
+				return false
+			}
+		case fl.f != nil && info.Size() < fl.offset:
+			// Truncated: read again from the start
+			if _, err := fl.f.Seek(0, io.SeekStart); err == nil {
+				fl.offset, fl.partial = 0, fl.partial[:0]
+				if !f.readFile(fl, send) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// open opens the file at path, at its end if atEnd is set. A file that
+// cannot be opened is tried again only once it is replaced.
+func (f *Follower) open(fl *file, atEnd bool) error {
+	fl.f, fl.offset = nil, 0
+	fl.info, _ = os.Stat(fl.path)
+	// #nosec G304 -- the files followed are the ones the pattern names
+	h, err := os.Open(fl.path)
+	if err != nil {
+		return err
+	}
+	info, err := h.Stat()
+	if err != nil {
+		_ = h.Close()
+		return err
+	}
+	if atEnd {
+		if fl.offset, err = h.Seek(0, io.SeekEnd); err != nil {
+			_ = h.Close()
+			return err
+		}
+	}
+	fl.f, fl.info = h, info
+	return nil
+}
+
+// readFile sends the lines written to fl since it was last read. A read
+// error closes the file until it is replaced.
+func (f *Follower) readFile(fl *file, send func(Line) bool) bool {
+	if fl.f == nil {
+		return true
+	}
+	for {
+		n, err := fl.f.Read(f.buf)
+		if n > 0 {
+			fl.offset += int64(n)
+			if f.read != nil {
+				f.read.Add(int64(n))
+			}
+			if !f.split(fl, f.buf[:n], send) {
+				return false
+			}
+		}
+		if errors.Is(err, io.EOF) || err == nil && n == 0 {
+			return true
+		}
+		if err != nil {
+			_ = fl.f.Close()
+			fl.f = nil
+			return send(Line{Path: fl.path, Err: err})
+		}
+	}
+}
+
+// split sends the lines data ends, keeping the start of an unended one.
+func (f *Follower) split(fl *file, data []byte, send func(Line) bool) bool {
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			fl.partial = append(fl.partial, data...)
+			for len(fl.partial) >= f.maxLine {
+				if !f.sendLine(fl, fl.partial[:f.maxLine], send) {
+					return false
+				}
+				fl.partial = append(fl.partial[:0], fl.partial[f.maxLine:]...)
+			}
+			return true
+		}
+		line := data[:i]
+		if len(fl.partial) > 0 {
+			line = append(fl.partial, line...)
+			fl.partial = fl.partial[:0]
+		}
+		for len(line) > f.maxLine {
+			if !f.sendLine(fl, line[:f.maxLine], send) {
+				return false
+			}
+			line = line[f.maxLine:]
+		}
+		if !f.sendLine(fl, line, send) {
+			return false
+		}
+		data = data[i+1:]
+	}
+	return true
+}
+
+// sendLine sends a line of fl, dropping a trailing \r.
+func (f *Follower) sendLine(fl *file, line []byte, send func(Line) bool) bool {
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	fl.number++
+	return send(Line{Path: fl.path, Text: string(line), Number: fl.number})
+}
+
+// finish sends the last, unended line of a file done with, and closes it.
+func (f *Follower) finish(fl *file, send func(Line) bool) bool {
+	if fl.f != nil {
+		_ = fl.f.Close()
+		fl.f = nil
+	}
+	if len(fl.partial) == 0 {
+		return true
+	}
+	line := fl.partial
+	fl.partial = nil
+	return f.sendLine(fl, line, send)
+}
+
+// closeAll closes the files still open when following stops.
+func (f *Follower) closeAll() {
+	for _, fl := range f.files {
+		if fl.f != nil {
+			_ = fl.f.Close()
+		}
+	}
+}
+
+// sortedPaths returns the paths of files in order, so that files are read
+// in the same order at every poll.
+func sortedPaths(files map[string]*file) []string {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
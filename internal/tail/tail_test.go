@@ -0,0 +1,160 @@
+package tail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// follow starts following pattern, returning the lines channel.
+func follow(t *testing.T, pattern string, opts ...Option) <-chan Line {
+	t.Helper()
+	f, err := New(pattern, append([]Option{WithInterval(5 * time.Millisecond)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return f.Lines(ctx)
+}
+
+// expect reads lines until it has one per want, each "name:text" or
+// "name:gone", and compares them.
+func expect(t *testing.T, lines <-chan Line, want ...string) {
+	t.Helper()
+	var got []string
+	timeout := time.After(5 * time.Second)
+	for len(got) < len(want) {
+		select {
+		case line := <-lines:
+			s := filepath.Base(line.Path) + ":" + line.Text
+			switch {
+			case line.Gone:
+				s = filepath.Base(line.Path) + ":gone"
+			case line.Err != nil:
+				s = filepath.Base(line.Path) + ":error " + line.Err.Error()
+			}
+			got = append(got, s)
+		case <-timeout:
+			t.Fatalf("got %q, still waiting for %q", got, want[len(got):])
+		}
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func write(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollower_GrowingFiles(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.log")
+	write(t, a, "old\n")
+
+	lines := follow(t, filepath.Join(dir, "*.log"), WithFromStart())
+	expect(t, lines, "a.log:old")
+
+	write(t, a, "one\r\ntw")
+	expect(t, lines, "a.log:one")
+	write(t, a, "o\n")
+	expect(t, lines, "a.log:two")
+
+	// A file that appears is read from its start
+	write(t, filepath.Join(dir, "b.log"), "first\nsecond\n")
+	expect(t, lines, "b.log:first", "b.log:second")
+
+	// Files not matching the pattern are not read
+	write(t, filepath.Join(dir, "c.txt"), "skipped\n")
+	write(t, a, "three\n")
+	expect(t, lines, "a.log:three")
+}
+
+func TestFollower_StartsAtTheEnd(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.log")
+	write(t, a, "before\n")
+
+	lines := follow(t, filepath.Join(dir, "*.log"))
+	time.Sleep(20 * time.Millisecond)
+	write(t, a, "after\n")
+	expect(t, lines, "a.log:after")
+}
+
+func TestFollower_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.log")
+	write(t, a, "one\n")
+	lines := follow(t, filepath.Join(dir, "*.log"), WithFromStart())
+	expect(t, lines, "a.log:one")
+
+	// Rotated: the rest of the old file, then the new one from its start
+	write(t, a, "two\nunended")
+	if err := os.Rename(a, a+".1"); err != nil {
+		t.Fatal(err)
+	}
+	write(t, a, "three\n")
+	expect(t, lines, "a.log:two", "a.log:unended", "a.log:three")
+
+	// Truncated: read again from the start
+	time.Sleep(20 * time.Millisecond)
+	if err := os.Truncate(a, 0); err != nil {
+		t.Fatal(err)
+	}
+	write(t, a, "4\n")
+	expect(t, lines, "a.log:4")
+
+	// Removed
+	write(t, a, "last")
+	if err := os.Remove(a); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, lines, "a.log:last", "a.log:gone")
+}
+
+func TestFollower_Symlinks(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "pods", "0.log")
+	if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	write(t, target, "one\n")
+	link := filepath.Join(dir, "c.log")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	lines := follow(t, filepath.Join(dir, "*.log"), WithFromStart())
+	expect(t, lines, "c.log:one")
+
+	// The target rotated under the link
+	if err := os.Rename(target, target+".20240115"); err != nil {
+		t.Fatal(err)
+	}
+	write(t, target, "two\n")
+	expect(t, lines, "c.log:two")
+}
+
+func TestFollower_LongLines(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "a.log"), "abcdefgh\nxyz\n")
+	lines := follow(t, filepath.Join(dir, "*.log"), WithFromStart(), WithMaxLineSize(3))
+	expect(t, lines, "a.log:abc", "a.log:def", "a.log:gh", "a.log:xyz")
+}
+
+func TestNew_InvalidPattern(t *testing.T) {
+	if _, err := New("[", WithInterval(time.Second)); err == nil {
+		t.Error("New accepted a malformed pattern")
+	}
+}
@@ -0,0 +1,108 @@
+package transform
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// Default prefix lengths kept by IPAnonymizer.
+const (
+	DefaultIPv4Prefix = 24
+	DefaultIPv6Prefix = 48
+)
+
+// IPAnonymizer truncates IP addresses in selected fields to their network
+// prefix, zeroing the host bits (192.0.2.77 becomes 192.0.2.0 with the
+// default /24). Values that are not IP addresses are left alone.
+type IPAnonymizer struct {
+	fields []string
+	v4Bits int
+	v6Bits int
+}
+
+// NewIPAnonymizer creates an IPAnonymizer from a spec of the form
+// "field1,field2[:v4prefix[:v6prefix]]", e.g. "client_ip:16:32".
+func NewIPAnonymizer(spec string) (*IPAnonymizer, error) {
+	fieldList, rest, _ := strings.Cut(spec, ":")
+
+	a := &IPAnonymizer{v4Bits: DefaultIPv4Prefix, v6Bits: DefaultIPv6Prefix}
+	for _, f := range strings.Split(fieldList, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			a.fields = append(a.fields, f)
+		}
+	}
+	if len(a.fields) == 0 {
+		return nil, fmt.Errorf("no fields to anonymize in %q", spec)
+	}
+
+	if rest != "" {
+		v4, v6, hasV6 := strings.Cut(rest, ":")
+		bits, err := prefixBits(v4, 32)
+		if err != nil {
+			return nil, err
+		}
+		a.v4Bits = bits
+		if hasV6 {
+			if a.v6Bits, err = prefixBits(v6, 128); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return a, nil
+}
+
+// prefixBits parses a prefix length between 0 and limit.
+func prefixBits(s string, limit int) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 0 || n > limit {
+		return 0, fmt.Errorf("invalid prefix length %q (want 0-%d)", s, limit)
+	}
+	return n, nil
+}
+
+// Process anonymizes the configured fields in place.
+func (a *IPAnonymizer) Process(entry *parser.Entry) []*parser.Entry {
+	for _, f := range a.fields {
+		s, ok := entry.Fields[f].(string)
+		if !ok {
+			continue
+		}
+		if masked, ok := a.mask(s); ok {
+			entry.Fields[f] = masked
+		}
+	}
+	return []*parser.Entry{entry}
+}
+
+// mask returns s with its host bits zeroed. IPv4-mapped IPv6 addresses
+// use the IPv4 prefix length.
+func (a *IPAnonymizer) mask(s string) (string, bool) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(s))
+	if err != nil {
+		return "", false
+	}
+	addr = addr.WithZone("")
+
+	if addr.Is4In6() {
+		p, err := addr.Unmap().Prefix(a.v4Bits)
+		if err != nil {
+			return "", false
+		}
+		return netip.AddrFrom16(p.Addr().As16()).String(), true
+	}
+
+	bits := a.v6Bits
+	if addr.Is4() {
+		bits = a.v4Bits
+	}
+	p, err := addr.Prefix(bits)
+	if err != nil {
+		return "", false
+	}
+	return p.Addr().String(), true
+}
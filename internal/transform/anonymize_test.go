@@ -0,0 +1,76 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func TestNewIPAnonymizer(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantV4  int
+		wantV6  int
+		wantErr bool
+	}{
+		{name: "defaults", spec: "ip", wantV4: 24, wantV6: 48},
+		{name: "v4 prefix", spec: "ip,client:16", wantV4: 16, wantV6: 48},
+		{name: "both prefixes", spec: "ip:8:32", wantV4: 8, wantV6: 32},
+		{name: "no fields", spec: ":24", wantErr: true},
+		{name: "bad v4 prefix", spec: "ip:33", wantErr: true},
+		{name: "bad v6 prefix", spec: "ip:24:129", wantErr: true},
+		{name: "not a number", spec: "ip:abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewIPAnonymizer(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewIPAnonymizer(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if err == nil && (a.v4Bits != tt.wantV4 || a.v6Bits != tt.wantV6) {
+				t.Errorf("prefixes = /%d, /%d, want /%d, /%d", a.v4Bits, a.v6Bits, tt.wantV4, tt.wantV6)
+			}
+		})
+	}
+}
+
+func TestIPAnonymizer_Process(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  string
+		value any
+		want  any
+	}{
+		{name: "ipv4 default", spec: "ip", value: "192.0.2.77", want: "192.0.2.0"},
+		{name: "ipv4 /16", spec: "ip:16", value: "203.0.113.9", want: "203.0.0.0"},
+		{name: "ipv4 /0", spec: "ip:0", value: "203.0.113.9", want: "0.0.0.0"},
+		{name: "ipv6 default", spec: "ip", value: "2001:db8:abcd:12::1", want: "2001:db8:abcd::"},
+		{name: "ipv6 /32", spec: "ip:24:32", value: "2001:db8:abcd:12::1", want: "2001:db8::"},
+		{name: "ipv6 zone dropped", spec: "ip:24:64", value: "fe80::1%eth0", want: "fe80::"},
+		{name: "ipv4-mapped", spec: "ip", value: "::ffff:192.0.2.77", want: "::ffff:192.0.2.0"},
+		{name: "not an ip", spec: "ip", value: "example.com", want: "example.com"},
+		{name: "not a string", spec: "ip", value: int64(42), want: int64(42)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewIPAnonymizer(tt.spec)
+			if err != nil {
+				t.Fatalf("NewIPAnonymizer() error: %v", err)
+			}
+			entry := parser.NewEntry("")
+			entry.Fields["ip"] = tt.value
+			entry.Fields["other"] = "192.0.2.77"
+
+			a.Process(entry)
+			if entry.Fields["ip"] != tt.want {
+				t.Errorf("ip = %v, want %v", entry.Fields["ip"], tt.want)
+			}
+			if entry.Fields["other"] != "192.0.2.77" {
+				t.Errorf("unselected field changed: %v", entry.Fields["other"])
+			}
+		})
+	}
+}
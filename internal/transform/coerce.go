@@ -0,0 +1,177 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// Field types supported by Coerce.
+const (
+	TypeInt    = "int"
+	TypeFloat  = "float"
+	TypeString = "string"
+	TypeBool   = "bool"
+)
+
+// typeAliases maps accepted type spellings to canonical type names.
+var typeAliases = map[string]string{
+	"int":     TypeInt,
+	"integer": TypeInt,
+	"long":    TypeInt,
+	"float":   TypeFloat,
+	"double":  TypeFloat,
+	"number":  TypeFloat,
+	"string":  TypeString,
+	"str":     TypeString,
+	"bool":    TypeBool,
+	"boolean": TypeBool,
+}
+
+// NormalizeType returns the canonical name for a type spelling.
+func NormalizeType(name string) (string, bool) {
+	t, ok := typeAliases[strings.ToLower(strings.TrimSpace(name))]
+	return t, ok
+}
+
+// Coerce converts a value to the given canonical type.
+// Returns false (and the original value) if the conversion isn't possible,
+// e.g. "abc" to int or 1.5 to int.
+func Coerce(v any, typ string) (any, bool) {
+	switch typ {
+	case TypeInt:
+		switch x := v.(type) {
+		case int:
+			return int64(x), true
+		case int64:
+			return x, true
+		case float64:
+			if x == math.Trunc(x) && !math.IsInf(x, 0) {
+				return int64(x), true
+			}
+		case json.Number:
+			if i, err := x.Int64(); err == nil {
+				return i, true
+			}
+		case string:
+			if i, err := strconv.ParseInt(strings.TrimSpace(x), 10, 64); err == nil {
+				return i, true
+			}
+		case bool:
+			if x {
+				return int64(1), true
+			}
+			return int64(0), true
+		}
+
+	case TypeFloat:
+		switch x := v.(type) {
+		case int:
+			return float64(x), true
+		case int64:
+			return float64(x), true
+		case float64:
+			return x, true
+		case json.Number:
+			if f, err := x.Float64(); err == nil {
+				return f, true
+			}
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(x), 64); err == nil {
+				return f, true
+			}
+		}
+
+	case TypeString:
+		switch x := v.(type) {
+		case string:
+			return x, true
+		case float64:
+			return strconv.FormatFloat(x, 'f', -1, 64), true
+		case nil:
+			return v, false
+		case map[string]any, []any:
+			if b, err := json.Marshal(x); err == nil {
+				return string(b), true
+			}
+		default:
+			return fmt.Sprint(x), true
+		}
+
+	case TypeBool:
+		switch x := v.(type) {
+		case bool:
+			return x, true
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(x)); err == nil {
+				return b, true
+			}
+		case int:
+			return x != 0, true
+		case int64:
+			return x != 0, true
+		case float64:
+			return x != 0, true
+		}
+	}
+
+	return v, false
+}
+
+// ParseTypeRules parses a spec of the form "field:type,field:type".
+func ParseTypeRules(spec string) (map[string]string, error) {
+	rules := make(map[string]string)
+	for _, rule := range strings.Split(spec, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		field, typeName, ok := strings.Cut(rule, ":")
+		field = strings.TrimSpace(field)
+		if !ok || field == "" {
+			return nil, fmt.Errorf("expected field:type, got %q", rule)
+		}
+		typ, ok := NormalizeType(typeName)
+		if !ok {
+			return nil, fmt.Errorf("unknown type %q for field %q (use int, float, string or bool)", typeName, field)
+		}
+		rules[field] = typ
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no type rules in %q", spec)
+	}
+	return rules, nil
+}
+
+// TypeCoercer forces fields to explicit types, overriding whatever the
+// parser inferred. Values that can't be converted are left unchanged.
+type TypeCoercer struct {
+	rules map[string]string
+}
+
+// NewTypeCoercer creates a coercion stage from a "field:type,..." spec.
+func NewTypeCoercer(spec string) (*TypeCoercer, error) {
+	rules, err := ParseTypeRules(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &TypeCoercer{rules: rules}, nil
+}
+
+// Process converts the configured fields in place.
+func (c *TypeCoercer) Process(entry *parser.Entry) []*parser.Entry {
+	for field, typ := range c.rules {
+		v, ok := entry.Fields[field]
+		if !ok {
+			continue
+		}
+		if converted, ok := Coerce(v, typ); ok {
+			entry.Fields[field] = converted
+		}
+	}
+	return []*parser.Entry{entry}
+}
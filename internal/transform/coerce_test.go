@@ -0,0 +1,99 @@
+package transform
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func TestCoerce(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     any
+		typ    string
+		want   any
+		wantOK bool
+	}{
+		{"string to int", "42", TypeInt, int64(42), true},
+		{"int to int64", 42, TypeInt, int64(42), true},
+		{"integral float to int", 42.0, TypeInt, int64(42), true},
+		{"fractional float to int", 1.5, TypeInt, 1.5, false},
+		{"json number to int", json.Number("7"), TypeInt, int64(7), true},
+		{"bad string to int", "abc", TypeInt, "abc", false},
+		{"bool to int", true, TypeInt, int64(1), true},
+		{"string to float", "0.25", TypeFloat, 0.25, true},
+		{"int64 to float", int64(3), TypeFloat, 3.0, true},
+		{"bad string to float", "x", TypeFloat, "x", false},
+		{"int to string", 1234, TypeString, "1234", true},
+		{"int64 to string", int64(94103), TypeString, "94103", true},
+		{"float to string", 1.1, TypeString, "1.1", true},
+		{"bool to string", false, TypeString, "false", true},
+		{"map to string", map[string]any{"a": 1}, TypeString, `{"a":1}`, true},
+		{"nil to string", nil, TypeString, nil, false},
+		{"string to bool", "true", TypeBool, true, true},
+		{"int to bool", int64(0), TypeBool, false, true},
+		{"bad string to bool", "maybe", TypeBool, "maybe", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Coerce(tt.in, tt.typ)
+			if ok != tt.wantOK {
+				t.Fatalf("Coerce(%v, %s) ok = %v, want %v", tt.in, tt.typ, ok, tt.wantOK)
+			}
+			if ok && got != tt.want {
+				t.Errorf("Coerce(%v, %s) = %v (%T), want %v (%T)", tt.in, tt.typ, got, got, tt.want, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTypeRules(t *testing.T) {
+	rules, err := ParseTypeRules("status:int, size:integer,duration:double,pid:string,ok:boolean")
+	if err != nil {
+		t.Fatalf("ParseTypeRules error: %v", err)
+	}
+	want := map[string]string{
+		"status":   TypeInt,
+		"size":     TypeInt,
+		"duration": TypeFloat,
+		"pid":      TypeString,
+		"ok":       TypeBool,
+	}
+	for k, v := range want {
+		if rules[k] != v {
+			t.Errorf("rules[%s] = %q, want %q", k, rules[k], v)
+		}
+	}
+
+	for _, bad := range []string{"", "status", "status:decimal", ":int"} {
+		if _, err := ParseTypeRules(bad); err == nil {
+			t.Errorf("ParseTypeRules(%q) expected error", bad)
+		}
+	}
+}
+
+func TestTypeCoercer_Process(t *testing.T) {
+	c, err := NewTypeCoercer("status:int,zip:string,latency:float")
+	if err != nil {
+		t.Fatalf("NewTypeCoercer error: %v", err)
+	}
+
+	e := parser.NewEntry("x")
+	e.Fields["status"] = "200"
+	e.Fields["zip"] = int64(94103)
+	e.Fields["latency"] = "fast"
+
+	c.Process(e)
+
+	if e.Fields["status"] != int64(200) {
+		t.Errorf("status = %v (%T), want int64 200", e.Fields["status"], e.Fields["status"])
+	}
+	if e.Fields["zip"] != "94103" {
+		t.Errorf("zip = %v (%T), want string", e.Fields["zip"], e.Fields["zip"])
+	}
+	if e.Fields["latency"] != "fast" {
+		t.Errorf("latency = %v, want unchanged on failed conversion", e.Fields["latency"])
+	}
+}
@@ -0,0 +1,64 @@
+package transform
+
+import "github.com/juliosaraiva/log2json/internal/parser"
+
+// Context keeps the entries matching a condition together with up to n
+// entries before and after each, as grep -C does. Context entries are
+// marked with a _context field; an entry is kept only once, when it is
+// near several matches. The entries before a match wait in a ring
+// buffer, so memory stays bounded by n.
+type Context struct {
+	match func(*parser.Entry) bool
+	n     int
+
+	ring  []*parser.Entry // the last entries not kept, oldest at next when full
+	next  int
+	after int // entries still to keep after the last match
+}
+
+// NewContext creates a context stage keeping the entries match accepts,
+// with n entries of context around each.
+func NewContext(match func(*parser.Entry) bool, n int) *Context {
+	return &Context{match: match, n: n, ring: make([]*parser.Entry, 0, n)}
+}
+
+// Process returns the entry, after the entries held before it, if it
+// matches; returns it as context if it follows a match closely enough;
+// otherwise holds it as possible context of a later match.
+func (c *Context) Process(entry *parser.Entry) []*parser.Entry {
+	if c.match(entry) {
+		out := make([]*parser.Entry, 0, len(c.ring)+1)
+		for i := range c.ring {
+			e := c.ring[(c.next+i)%len(c.ring)]
+			e.Fields["_context"] = true
+			out = append(out, e)
+		}
+		clear(c.ring)
+		c.ring, c.next = c.ring[:0], 0
+		c.after = c.n
+		return append(out, entry)
+	}
+
+	if c.after > 0 {
+		c.after--
+		entry.Fields["_context"] = true
+		return []*parser.Entry{entry}
+	}
+	if c.n == 0 {
+		return nil
+	}
+	if len(c.ring) < c.n {
+		c.ring = append(c.ring, entry)
+	} else {
+		c.ring[c.next] = entry
+		c.next = (c.next + 1) % c.n
+	}
+	return nil
+}
+
+// Flush drops the entries held: no match follows them.
+func (c *Context) Flush() []*parser.Entry {
+	clear(c.ring)
+	c.ring, c.next = c.ring[:0], 0
+	return nil
+}
@@ -0,0 +1,73 @@
+package transform
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func TestContext_Process(t *testing.T) {
+	tests := []struct {
+		name  string
+		n     int
+		input string // one letter per entry; uppercase ones match
+		want  string // kept entries, context ones in lowercase
+	}{
+		{name: "no context", n: 0, input: "abCdeFg", want: "CF"},
+		{name: "before and after", n: 2, input: "abcDefgh", want: "bcDef"},
+		{name: "fewer before than n", n: 3, input: "aBcd", want: "aBcd"},
+		{name: "overlapping", n: 2, input: "xabCdEfghiJk", want: "abCdEfghiJk"},
+		{name: "gap between groups", n: 1, input: "aBcdefGh", want: "aBcfGh"},
+		{name: "adjacent matches", n: 1, input: "abCDe", want: "bCDe"},
+		{name: "no match", n: 2, input: "abcde", want: ""},
+		{name: "ring wraps", n: 2, input: "abcdefgHi", want: "fgHi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewContext(func(e *parser.Entry) bool {
+				return strings.ToUpper(e.Raw) == e.Raw
+			}, tt.n)
+			var got strings.Builder
+			for _, r := range tt.input {
+				for _, e := range c.Process(parser.NewEntry(string(r))) {
+					_, isContext := e.Fields["_context"]
+					if isContext == (strings.ToUpper(e.Raw) == e.Raw) {
+						t.Errorf("entry %s: _context = %v", e.Raw, isContext)
+					}
+					got.WriteString(e.Raw)
+				}
+			}
+			if out := c.Flush(); len(out) != 0 {
+				t.Errorf("Flush() = %v, want nothing", out)
+			}
+			if got.String() != tt.want {
+				t.Errorf("kept %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestContext_Tag(t *testing.T) {
+	c := NewContext(func(e *parser.Entry) bool { return e.Fields["level"] == "error" }, 1)
+	entry := func(level string) *parser.Entry {
+		e := parser.NewEntry("")
+		e.Fields["level"] = level
+		return e
+	}
+	var got []map[string]any
+	for _, level := range []string{"info", "error", "debug"} {
+		for _, e := range c.Process(entry(level)) {
+			got = append(got, e.Fields)
+		}
+	}
+	want := []map[string]any{
+		{"level": "info", "_context": true},
+		{"level": "error"},
+		{"level": "debug", "_context": true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,137 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// DefaultCorrelateIdle is how long an id may go unseen before the
+// Correlator forgets it.
+const DefaultCorrelateIdle = time.Minute
+
+// Correlator tracks records sharing a correlation id (request or trace
+// id). Each record with the id is annotated with _firstSeen, the ingest
+// time of the id's first record, and _seq, its 1-based position within
+// the id. An id unseen for the idle timeout is forgotten; with summaries
+// enabled a record {<field>: id, "_count": n, "_firstSeen": ...,
+// "_lastSeen": ..., "_duration": ...} is emitted at that point.
+type Correlator struct {
+	field     string
+	idle      time.Duration
+	summaries bool
+	now       func() time.Time
+
+	ids       map[string]*correlation
+	lastSweep time.Time
+}
+
+// correlation tracks one id.
+type correlation struct {
+	first time.Time
+	last  time.Time
+	count int
+}
+
+// CorrelateOption configures a Correlator.
+type CorrelateOption func(*Correlator)
+
+// WithIdleTimeout sets how long an id may go unseen before it is closed.
+func WithIdleTimeout(d time.Duration) CorrelateOption {
+	return func(c *Correlator) {
+		if d > 0 {
+			c.idle = d
+		}
+	}
+}
+
+// WithSummaries emits a summary record when an id is closed.
+func WithSummaries() CorrelateOption {
+	return func(c *Correlator) {
+		c.summaries = true
+	}
+}
+
+// NewCorrelator creates a Correlator keyed on field.
+func NewCorrelator(field string, opts ...CorrelateOption) *Correlator {
+	c := &Correlator{
+		field: field,
+		idle:  DefaultCorrelateIdle,
+		now:   time.Now,
+		ids:   make(map[string]*correlation),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Process annotates the entry. Summaries for ids that went idle since
+// the last sweep are emitted ahead of it.
+func (c *Correlator) Process(entry *parser.Entry) []*parser.Entry {
+	now := c.now()
+	out := c.sweep(now, false)
+
+	val, ok := entry.Fields[c.field]
+	if !ok || val == nil {
+		return append(out, entry)
+	}
+	key := fmt.Sprint(val)
+
+	corr := c.ids[key]
+	if corr == nil {
+		corr = &correlation{first: now}
+		c.ids[key] = corr
+	}
+	corr.last = now
+	corr.count++
+
+	entry.Fields["_firstSeen"] = formatTime(corr.first)
+	entry.Fields["_seq"] = corr.count
+	return append(out, entry)
+}
+
+// Flush closes all open ids.
+func (c *Correlator) Flush() []*parser.Entry {
+	return c.sweep(c.now(), true)
+}
+
+// sweep closes ids idle for longer than the timeout (all ids if final)
+// and returns their summaries in id order. Runs at most once per timeout.
+func (c *Correlator) sweep(now time.Time, final bool) []*parser.Entry {
+	if !final && now.Sub(c.lastSweep) < c.idle {
+		return nil
+	}
+	c.lastSweep = now
+
+	var keys []string
+	for k, corr := range c.ids {
+		if final || now.Sub(corr.last) >= c.idle {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var out []*parser.Entry
+	for _, k := range keys {
+		corr := c.ids[k]
+		delete(c.ids, k)
+		if !c.summaries {
+			continue
+		}
+		summary := parser.NewEntry("")
+		summary.Fields[c.field] = k
+		summary.Fields["_count"] = corr.count
+		summary.Fields["_firstSeen"] = formatTime(corr.first)
+		summary.Fields["_lastSeen"] = formatTime(corr.last)
+		summary.Fields["_duration"] = corr.last.Sub(corr.first).String()
+		out = append(out, summary)
+	}
+	return out
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
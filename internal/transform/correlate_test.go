@@ -0,0 +1,87 @@
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func TestCorrelator_Process(t *testing.T) {
+	c := NewCorrelator("request_id", WithIdleTimeout(10*time.Second), WithSummaries())
+	clock := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return clock }
+
+	send := func(id string) []*parser.Entry {
+		e := parser.NewEntry(id)
+		if id != "" {
+			e.Fields["request_id"] = id
+		}
+		return c.Process(e)
+	}
+
+	send("a")
+	clock = clock.Add(2 * time.Second)
+	send("b")
+	clock = clock.Add(3 * time.Second)
+	out := send("a")
+	if len(out) != 1 {
+		t.Fatalf("got %d entries, want 1", len(out))
+	}
+	if out[0].Fields["_seq"] != 2 || out[0].Fields["_firstSeen"] != "2024-01-15T10:00:00Z" {
+		t.Errorf("unexpected annotations: %v", out[0].Fields)
+	}
+
+	if out := send(""); len(out) != 1 || out[0].Fields["_seq"] != nil {
+		t.Errorf("entry without id should pass unannotated: %v", out[0].Fields)
+	}
+
+	// "b" was last seen 12s ago and "a" 9s ago: only "b" is closed.
+	clock = clock.Add(9 * time.Second)
+	out = send("c")
+	if len(out) != 2 {
+		t.Fatalf("got %d entries after idle timeout, want summary + entry", len(out))
+	}
+	s := out[0].Fields
+	if s["request_id"] != "b" || s["_count"] != 1 || s["_duration"] != "0s" {
+		t.Errorf("unexpected summary: %v", s)
+	}
+	if out[1].Fields["request_id"] != "c" || out[1].Fields["_seq"] != 1 {
+		t.Errorf("unexpected entry: %v", out[1].Fields)
+	}
+
+	out = c.Flush()
+	if len(out) != 2 {
+		t.Fatalf("Flush() returned %d summaries, want 2", len(out))
+	}
+	s = out[0].Fields
+	if s["request_id"] != "a" || s["_count"] != 2 || s["_duration"] != "5s" || s["_lastSeen"] != "2024-01-15T10:00:05Z" {
+		t.Errorf("unexpected summary for a: %v", s)
+	}
+}
+
+func TestCorrelator_NoSummaries(t *testing.T) {
+	c := NewCorrelator("trace")
+	clock := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return clock }
+
+	for i := 1; i <= 3; i++ {
+		e := parser.NewEntry("")
+		e.Fields["trace"] = int64(7)
+		if out := c.Process(e); len(out) != 1 || out[0].Fields["_seq"] != i {
+			t.Fatalf("entry %d: %v", i, out)
+		}
+	}
+
+	// An id idle past the timeout is forgotten and starts over.
+	clock = clock.Add(DefaultCorrelateIdle)
+	e := parser.NewEntry("")
+	e.Fields["trace"] = int64(7)
+	if out := c.Process(e); len(out) != 1 || out[0].Fields["_seq"] != 1 {
+		t.Errorf("expected a fresh sequence, got %v", out)
+	}
+
+	if out := c.Flush(); len(out) != 0 {
+		t.Errorf("Flush() without summaries = %v", out)
+	}
+}
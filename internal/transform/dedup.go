@@ -0,0 +1,181 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/maphash"
+	"strconv"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// TimestampFields lists field names treated as the entry's timestamp.
+var TimestampFields = []string{"timestamp", "time", "ts", "@timestamp", "datetime", "date"}
+
+// ConsecutiveDedup collapses runs of identical entries into one record
+// carrying a _repeatCount field, like syslog's "last message repeated
+// N times". Entries are compared on all fields except timestamps.
+//
+// The most recent entry is held until a different one arrives (or the
+// input ends), so in follow mode the last record of a run is delayed.
+type ConsecutiveDedup struct {
+	held  *parser.Entry
+	key   string
+	count int
+}
+
+// NewConsecutiveDedup creates a consecutive duplicate collapser.
+func NewConsecutiveDedup() *ConsecutiveDedup {
+	return &ConsecutiveDedup{}
+}
+
+// Process holds the entry if it repeats the previous one, otherwise
+// releases the previous run.
+func (d *ConsecutiveDedup) Process(entry *parser.Entry) []*parser.Entry {
+	key := dedupKey(entry)
+	if d.held != nil && key == d.key {
+		d.count++
+		return nil
+	}
+
+	out := d.release()
+	d.held, d.key, d.count = entry, key, 1
+	return out
+}
+
+// Flush releases the final run.
+func (d *ConsecutiveDedup) Flush() []*parser.Entry {
+	return d.release()
+}
+
+// release returns the held entry annotated with its repeat count.
+func (d *ConsecutiveDedup) release() []*parser.Entry {
+	if d.held == nil {
+		return nil
+	}
+	e := d.held
+	if d.count > 1 {
+		e.Fields["_repeatCount"] = d.count
+	}
+	d.held, d.key, d.count = nil, "", 0
+	return []*parser.Entry{e}
+}
+
+// dedupKey builds a comparison key from an entry's non-timestamp fields.
+func dedupKey(entry *parser.Entry) string {
+	fields := make(map[string]any, len(entry.Fields))
+	for k, v := range entry.Fields {
+		fields[k] = v
+	}
+	for _, k := range TimestampFields {
+		delete(fields, k)
+	}
+
+	// json.Marshal sorts map keys, so the key is deterministic.
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return entry.Raw
+	}
+	return string(b)
+}
+
+// maxWindowLines bounds the lines a WindowDedup remembers, so that a long
+// time window over a busy input cannot grow without limit: past it, the
+// oldest lines are forgotten early.
+const maxWindowLines = 1 << 20
+
+// WindowDedup drops entries whose raw line is identical to one seen within
+// the last N lines or within a duration, such as the copies of a log a
+// second shipper delivers again. Lines are compared by a 64-bit hash, and
+// an entry without a raw line by its fields, as ConsecutiveDedup compares
+// them. A dropped line counts as seen again, so a line repeated steadily
+// is kept only once.
+type WindowDedup struct {
+	lines  int           // window in lines, or 0
+	period time.Duration // window in time, or 0
+	now    func() time.Time
+	seed   maphash.Seed
+
+	seen   map[uint64]int64 // hash to the line number it was last seen at
+	recent []seenLine       // the lines remembered, oldest first
+	head   int              // the oldest line in recent
+	count  int64            // lines processed
+}
+
+// seenLine records a line seen in the window.
+type seenLine struct {
+	hash uint64
+	num  int64
+	at   time.Time
+}
+
+// NewWindowDedup creates a deduplicator from a window spec: a number of
+// lines (e.g. "10000") or a duration (e.g. "30s").
+func NewWindowDedup(spec string) (*WindowDedup, error) {
+	d := &WindowDedup{
+		now:  time.Now,
+		seed: maphash.MakeSeed(),
+		seen: make(map[uint64]int64),
+	}
+	if n, err := strconv.Atoi(spec); err == nil {
+		if n < 1 {
+			return nil, fmt.Errorf("window must be at least 1 line, got %d", n)
+		}
+		d.lines = n
+		return d, nil
+	}
+	period, err := time.ParseDuration(spec)
+	if err != nil || period <= 0 {
+		return nil, fmt.Errorf("expected a number of lines or a duration (e.g. 10000 or 30s), got %q", spec)
+	}
+	d.period = period
+	return d, nil
+}
+
+// Process drops the entry if its line was seen within the window.
+func (d *WindowDedup) Process(entry *parser.Entry) []*parser.Entry {
+	d.count++
+	var now time.Time
+	if d.period > 0 {
+		now = d.now()
+	}
+	d.expire(now)
+
+	key := entry.Raw
+	if key == "" {
+		key = dedupKey(entry)
+	}
+	h := maphash.String(d.seed, key)
+	_, dup := d.seen[h]
+
+	d.seen[h] = d.count
+	d.recent = append(d.recent, seenLine{hash: h, num: d.count, at: now})
+	if dup {
+		return nil
+	}
+	return []*parser.Entry{entry}
+}
+
+// expire forgets the lines that have left the window before line d.count,
+// seen at now.
+func (d *WindowDedup) expire(now time.Time) {
+	for d.head < len(d.recent) {
+		old := d.recent[d.head]
+		inWindow := d.count-old.num <= int64(d.lines) || d.period > 0 && now.Sub(old.at) <= d.period
+		if inWindow && len(d.recent)-d.head < maxWindowLines {
+			break
+		}
+		if d.seen[old.hash] == old.num {
+			delete(d.seen, old.hash)
+		}
+		d.head++
+	}
+
+	// Reclaim the forgotten half of the queue
+	if d.head > 1024 && d.head > len(d.recent)/2 {
+		n := copy(d.recent, d.recent[d.head:])
+		d.recent = d.recent[:n]
+		d.head = 0
+	}
+}
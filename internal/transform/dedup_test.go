@@ -0,0 +1,162 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func newMsgEntry(ts, msg string) *parser.Entry {
+	e := parser.NewEntry(ts + " " + msg)
+	e.Fields["timestamp"] = ts
+	e.Fields["message"] = msg
+	return e
+}
+
+func TestConsecutiveDedup(t *testing.T) {
+	d := NewConsecutiveDedup()
+	c := NewChain(d)
+
+	var out []*parser.Entry
+	for i, msg := range []string{"a", "a", "a", "b", "a", "c", "c"} {
+		out = append(out, c.Process(newMsgEntry(string(rune('0'+i)), msg))...)
+	}
+	out = append(out, c.Flush()...)
+
+	want := []struct {
+		msg   string
+		count any
+	}{
+		{"a", 3},
+		{"b", nil},
+		{"a", nil},
+		{"c", 2},
+	}
+
+	if len(out) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(out), len(want))
+	}
+	for i, w := range want {
+		if out[i].Fields["message"] != w.msg {
+			t.Errorf("entry %d message = %v, want %s", i, out[i].Fields["message"], w.msg)
+		}
+		if out[i].Fields["_repeatCount"] != w.count {
+			t.Errorf("entry %d _repeatCount = %v, want %v", i, out[i].Fields["_repeatCount"], w.count)
+		}
+	}
+
+	// First occurrence of the run is kept.
+	if out[0].Fields["timestamp"] != "0" {
+		t.Errorf("expected first entry of run to be kept, got timestamp %v", out[0].Fields["timestamp"])
+	}
+}
+
+func TestConsecutiveDedup_FlushEmpty(t *testing.T) {
+	if out := NewConsecutiveDedup().Flush(); out != nil {
+		t.Errorf("Flush() on empty dedup = %v, want nil", out)
+	}
+}
+
+func TestWindowDedup_Lines(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  string
+		lines string
+		want  string
+	}{
+		{name: "exact copies", spec: "3", lines: "a b a c b", want: "a b c"},
+		{name: "outside the window", spec: "2", lines: "a b c a", want: "a b c a"},
+		{name: "at the window's edge", spec: "3", lines: "a b c a", want: "a b c"},
+		{name: "repeats keep a line seen", spec: "2", lines: "a a a a a b", want: "a b"},
+		{name: "one line", spec: "1", lines: "a a b a", want: "a b a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewWindowDedup(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, line := range strings.Fields(tt.lines) {
+				for _, e := range d.Process(parser.NewEntry(line)) {
+					got = append(got, e.Raw)
+				}
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("got %q, want %q", strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+}
+
+func TestWindowDedup_Duration(t *testing.T) {
+	d, err := NewWindowDedup("10s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := time.Unix(0, 0)
+	d.now = func() time.Time { return clock }
+
+	steps := []struct {
+		advance time.Duration
+		line    string
+		kept    bool
+	}{
+		{0, "a", true},
+		{5 * time.Second, "a", false},
+		{5 * time.Second, "b", true},
+		{11 * time.Second, "a", true},
+		{time.Second, "b", true},
+		{time.Second, "b", false},
+	}
+	for i, s := range steps {
+		clock = clock.Add(s.advance)
+		if kept := len(d.Process(parser.NewEntry(s.line))) == 1; kept != s.kept {
+			t.Errorf("step %d (%s): kept = %v, want %v", i, s.line, kept, s.kept)
+		}
+	}
+}
+
+func TestWindowDedup_ComparesFieldsWithoutRaw(t *testing.T) {
+	d, _ := NewWindowDedup("10")
+	entry := func(msg string) *parser.Entry {
+		e := parser.NewEntry("")
+		e.Fields["message"] = msg
+		return e
+	}
+	if len(d.Process(entry("a"))) != 1 || len(d.Process(entry("a"))) != 0 || len(d.Process(entry("b"))) != 1 {
+		t.Error("entries without a raw line not compared by their fields")
+	}
+}
+
+func TestWindowDedup_ForgetsOldLines(t *testing.T) {
+	d, _ := NewWindowDedup("100")
+	for i := 0; i < 10000; i++ {
+		d.Process(parser.NewEntry(fmt.Sprint(i)))
+	}
+	// The window, and the last line, which starts the next one
+	if len(d.seen) != 101 || len(d.recent)-d.head != 101 {
+		t.Errorf("remembering %d hashes and %d lines, want 101", len(d.seen), len(d.recent)-d.head)
+	}
+	if cap(d.recent) > 4096 {
+		t.Errorf("queue grew to %d", cap(d.recent))
+	}
+}
+
+func TestWindowDedup_HoldsNothing(t *testing.T) {
+	d, _ := NewWindowDedup("10")
+	if NewChain(d).Holds() {
+		t.Error("a chain with WindowDedup holds entries back")
+	}
+}
+
+func TestNewWindowDedup_Invalid(t *testing.T) {
+	for _, spec := range []string{"", "0", "-5", "ten", "-1s", "0s"} {
+		if _, err := NewWindowDedup(spec); err == nil {
+			t.Errorf("NewWindowDedup(%q) succeeded, want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// Derive adds a string field rendered from a Go template over the entry's
+// fields, e.g. "{{.method}} {{.path}} -> {{.status}}". Entries missing a
+// field the template refers to are left without the derived field; other
+// template errors are reported in a _deriveError field.
+type Derive struct {
+	field string
+	tmpl  *template.Template
+}
+
+// NewDerive creates a derive stage from a spec of the form "field=template".
+func NewDerive(spec string) (*Derive, error) {
+	field, text, ok := strings.Cut(spec, "=")
+	field = strings.TrimSpace(field)
+	if !ok || field == "" || text == "" {
+		return nil, fmt.Errorf("expected field=template, got %q", spec)
+	}
+
+	tmpl, err := template.New(field).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &Derive{field: field, tmpl: tmpl}, nil
+}
+
+// Process renders the template and stores the result.
+func (d *Derive) Process(entry *parser.Entry) []*parser.Entry {
+	var sb strings.Builder
+	if err := d.tmpl.Execute(&sb, entry.Fields); err != nil {
+		if !strings.Contains(err.Error(), "map has no entry for key") {
+			entry.Fields["_deriveError"] = fmt.Sprintf("%s: %v", d.field, err)
+		}
+		return []*parser.Entry{entry}
+	}
+	entry.Fields[d.field] = sb.String()
+	return []*parser.Entry{entry}
+}
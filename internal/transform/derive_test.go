@@ -0,0 +1,102 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func TestNewDerive(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{name: "valid", spec: "summary={{.method}} {{.path}}"},
+		{name: "equals in template", spec: "q=a={{.a}}"},
+		{name: "missing template", spec: "summary=", wantErr: true},
+		{name: "missing field", spec: "={{.a}}", wantErr: true},
+		{name: "no separator", spec: "summary", wantErr: true},
+		{name: "bad template", spec: "summary={{.method", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewDerive(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewDerive(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDerive_Process(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      string
+		fields    map[string]any
+		want      any
+		wantError bool
+	}{
+		{
+			name:   "compose fields",
+			spec:   "summary={{.method}} {{.path}} -> {{.status}}",
+			fields: map[string]any{"method": "GET", "path": "/api", "status": int64(200)},
+			want:   "GET /api -> 200",
+		},
+		{
+			name:   "float field",
+			spec:   "d={{.duration}}s",
+			fields: map[string]any{"duration": 1.5},
+			want:   "1.5s",
+		},
+		{
+			name:   "template functions",
+			spec:   `s={{printf "%05d" .n}}{{if .ok}} ok{{end}}`,
+			fields: map[string]any{"n": int64(42), "ok": true},
+			want:   "00042 ok",
+		},
+		{
+			name:   "missing field leaves entry alone",
+			spec:   "summary={{.method}} {{.path}}",
+			fields: map[string]any{"method": "GET"},
+			want:   nil,
+		},
+		{
+			name:      "execution error",
+			spec:      "summary={{index .tags 5}}",
+			fields:    map[string]any{"tags": []any{"a"}},
+			want:      nil,
+			wantError: true,
+		},
+		{
+			name:   "overwrites existing field",
+			spec:   "msg=[{{.level}}] {{.msg}}",
+			fields: map[string]any{"level": "ERROR", "msg": "boom"},
+			want:   "[ERROR] boom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDerive(tt.spec)
+			if err != nil {
+				t.Fatalf("NewDerive() error: %v", err)
+			}
+
+			entry := parser.NewEntry("")
+			entry.Fields = tt.fields
+			got := d.Process(entry)
+			if len(got) != 1 {
+				t.Fatalf("Process() returned %d entries, want 1", len(got))
+			}
+
+			if v := got[0].Fields[d.field]; v != tt.want {
+				t.Errorf("%s = %v, want %v", d.field, v, tt.want)
+			}
+			if _, ok := got[0].Fields["_deriveError"]; ok != tt.wantError {
+				t.Errorf("_deriveError present = %v, want %v (%v)", ok, tt.wantError, got[0].Fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package transform
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// Drain defaults.
+const (
+	// DefaultDrainSimilarity is the fraction of matching tokens a message
+	// needs to join an existing template.
+	DefaultDrainSimilarity = 0.4
+
+	drainDepth       = 1     // leading tokens used to route a message
+	drainMaxChildren = 100   // per tree node before tokens route to <*>
+	drainMaxClusters = 10000 // templates kept before new ones are refused
+)
+
+// Wildcard replaces variable tokens in a mined template.
+const Wildcard = "<*>"
+
+// TemplateMiner learns message templates from free text with the Drain
+// algorithm: messages are routed through a tree keyed on token count and
+// leading tokens, then matched against the templates in the leaf by the
+// fraction of identical tokens. Tokens that differ within a template
+// become <*>. Each entry gets _templateId (stable for the life of the
+// template), _template, and _params, the tokens at <*> positions.
+type TemplateMiner struct {
+	field      string
+	similarity float64
+	root       *drainNode
+	clusters   int
+}
+
+// drainNode is an interior tree node; leaves hold templates.
+type drainNode struct {
+	children  map[string]*drainNode
+	templates []*drainTemplate
+}
+
+// drainTemplate is one learned template.
+type drainTemplate struct {
+	id     int
+	tokens []string
+}
+
+// NewTemplateMiner creates a miner for the text in field. similarity
+// outside (0, 1] selects DefaultDrainSimilarity.
+func NewTemplateMiner(field string, similarity float64) *TemplateMiner {
+	if similarity <= 0 || similarity > 1 {
+		similarity = DefaultDrainSimilarity
+	}
+	return &TemplateMiner{
+		field:      field,
+		similarity: similarity,
+		root:       &drainNode{children: make(map[string]*drainNode)},
+	}
+}
+
+// Process annotates the entry with its template. Entries without a
+// string field pass through unchanged.
+func (m *TemplateMiner) Process(entry *parser.Entry) []*parser.Entry {
+	msg, ok := entry.Fields[m.field].(string)
+	if !ok {
+		return []*parser.Entry{entry}
+	}
+	tokens := strings.Fields(msg)
+	if len(tokens) == 0 {
+		return []*parser.Entry{entry}
+	}
+
+	t := m.learn(tokens)
+	if t == nil {
+		return []*parser.Entry{entry}
+	}
+
+	params := make([]any, 0)
+	for i, tok := range t.tokens {
+		if tok == Wildcard {
+			params = append(params, tokens[i])
+		}
+	}
+	entry.Fields["_templateId"] = t.id
+	entry.Fields["_template"] = strings.Join(t.tokens, " ")
+	entry.Fields["_params"] = params
+	return []*parser.Entry{entry}
+}
+
+// learn finds or creates the template for tokens, generalizing it as
+// needed. Returns nil if the cluster limit has been reached.
+func (m *TemplateMiner) learn(tokens []string) *drainTemplate {
+	leaf := m.leaf(tokens)
+
+	var best *drainTemplate
+	bestSim := -1.0
+	for _, t := range leaf.templates {
+		if sim := tokenSimilarity(t.tokens, tokens); sim > bestSim {
+			best, bestSim = t, sim
+		}
+	}
+
+	if best != nil && bestSim >= m.similarity {
+		for i, tok := range tokens {
+			if best.tokens[i] != tok {
+				best.tokens[i] = Wildcard
+			}
+		}
+		return best
+	}
+
+	if m.clusters >= drainMaxClusters {
+		return nil
+	}
+	m.clusters++
+	// The tokens are slices of the entry's line, which may share its
+	// memory with other lines, so the template keeps copies
+	t := &drainTemplate{id: m.clusters, tokens: make([]string, len(tokens))}
+	for i, tok := range tokens {
+		t.tokens[i] = strings.Clone(tok)
+	}
+	leaf.templates = append(leaf.templates, t)
+	return t
+}
+
+// leaf routes tokens to their leaf by length, then leading token(s).
+// Tokens containing digits, and tokens arriving at a full node, route
+// through <*> so variable values do not explode the tree.
+func (m *TemplateMiner) leaf(tokens []string) *drainNode {
+	keys := make([]string, 0, drainDepth+1)
+	keys = append(keys, strconv.Itoa(len(tokens))) // length bucket
+	for i := 0; i < drainDepth && i < len(tokens); i++ {
+		keys = append(keys, tokens[i])
+	}
+
+	node := m.root
+	for depth, key := range keys {
+		if depth > 0 && strings.ContainsAny(key, "0123456789") {
+			key = Wildcard
+		}
+		child := node.children[key]
+		if child == nil {
+			if depth > 0 && len(node.children) >= drainMaxChildren {
+				key = Wildcard
+				child = node.children[key]
+			}
+			if child == nil {
+				child = &drainNode{children: make(map[string]*drainNode)}
+				node.children[strings.Clone(key)] = child
+			}
+		}
+		node = child
+	}
+	return node
+}
+
+// tokenSimilarity is the fraction of positions where the template token equals
+// the message token. Wildcards do not count as matches, so a template
+// that is mostly <*> does not absorb everything of the same length.
+func tokenSimilarity(template, tokens []string) float64 {
+	same := 0
+	for i, tok := range template {
+		if tok == tokens[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(tokens))
+}
@@ -0,0 +1,103 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+	"unsafe"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func TestTemplateMiner_Process(t *testing.T) {
+	m := NewTemplateMiner("message", 0)
+
+	lines := []string{
+		"Connected to 10.0.0.1 port 22",
+		"Connected to 10.0.0.2 port 2222",
+		"User alice logged in",
+		"User bob logged in",
+		"Disk /dev/sda1 is 91% full",
+		"Connected to 10.0.0.9 port 22",
+	}
+	var got []*parser.Entry
+	for _, line := range lines {
+		e := parser.NewEntry(line)
+		e.Fields["message"] = line
+		got = append(got, m.Process(e)...)
+	}
+
+	tests := []struct {
+		line         int
+		wantID       int
+		wantTemplate string
+		wantParams   []any
+	}{
+		{line: 0, wantID: 1, wantTemplate: "Connected to 10.0.0.1 port 22", wantParams: []any{}},
+		{line: 1, wantID: 1, wantTemplate: "Connected to <*> port <*>", wantParams: []any{"10.0.0.2", "2222"}},
+		{line: 2, wantID: 2, wantTemplate: "User alice logged in", wantParams: []any{}},
+		{line: 3, wantID: 2, wantTemplate: "User <*> logged in", wantParams: []any{"bob"}},
+		{line: 4, wantID: 3, wantTemplate: "Disk /dev/sda1 is 91% full", wantParams: []any{}},
+		{line: 5, wantID: 1, wantTemplate: "Connected to <*> port <*>", wantParams: []any{"10.0.0.9", "22"}},
+	}
+
+	for _, tt := range tests {
+		f := got[tt.line].Fields
+		if f["_templateId"] != tt.wantID {
+			t.Errorf("line %d: _templateId = %v, want %d", tt.line, f["_templateId"], tt.wantID)
+		}
+		if f["_template"] != tt.wantTemplate {
+			t.Errorf("line %d: _template = %q, want %q", tt.line, f["_template"], tt.wantTemplate)
+		}
+		if !reflect.DeepEqual(f["_params"], tt.wantParams) {
+			t.Errorf("line %d: _params = %v, want %v", tt.line, f["_params"], tt.wantParams)
+		}
+	}
+}
+
+func TestTemplateMiner_CopiesTokens(t *testing.T) {
+	// The line is a view of a buffer, as lines in the reader's shared
+	// blocks are; the template must not refer to it once it is reused
+	buf := []byte("User alice logged in")
+	line := unsafe.String(unsafe.SliceData(buf), len(buf))
+	m := NewTemplateMiner("message", 0)
+	for _, msg := range []string{line, "User alice logged in"} {
+		e := parser.NewEntry(msg)
+		e.Fields["message"] = msg
+		out := m.Process(e)
+		copy(buf, "xxxx xxxxx xxxxxx xx")
+		if out[0].Fields["_templateId"] != 1 || out[0].Fields["_template"] != "User alice logged in" {
+			t.Errorf("%q: got template %v %q", msg, out[0].Fields["_templateId"], out[0].Fields["_template"])
+		}
+	}
+}
+
+func TestTemplateMiner_Similarity(t *testing.T) {
+	// With a strict threshold, messages differing in 2 of 4 tokens stay apart.
+	m := NewTemplateMiner("message", 0.9)
+
+	var ids []any
+	for _, line := range []string{"job a finished ok", "job b finished err", "job a finished ok"} {
+		e := parser.NewEntry(line)
+		e.Fields["message"] = line
+		ids = append(ids, m.Process(e)[0].Fields["_templateId"])
+	}
+	if want := []any{1, 2, 1}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("template ids = %v, want %v", ids, want)
+	}
+}
+
+func TestTemplateMiner_Skips(t *testing.T) {
+	m := NewTemplateMiner("message", 0)
+
+	for _, fields := range []map[string]any{
+		{"level": "info"},
+		{"message": ""},
+		{"message": int64(5)},
+	} {
+		e := parser.NewEntry("")
+		e.Fields = fields
+		if out := m.Process(e); len(out) != 1 || out[0].Fields["_templateId"] != nil {
+			t.Errorf("Process(%v) should pass through unchanged", fields)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package transform
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// Exploder splits an entry whose field holds an array into one entry per
+// element. Each new entry carries the parent's scalar fields; object
+// elements are merged in (their fields win on conflict) and other
+// elements are stored under the original field name. A string field is
+// exploded if it contains a JSON array. Entries without an array, or with
+// an empty one, pass through unchanged.
+type Exploder struct {
+	field string
+}
+
+// NewExploder creates a stage that explodes field.
+func NewExploder(field string) *Exploder {
+	return &Exploder{field: field}
+}
+
+// Process emits one entry per array element.
+func (x *Exploder) Process(entry *parser.Entry) []*parser.Entry {
+	elems := arrayValue(entry.Fields[x.field])
+	if len(elems) == 0 {
+		return []*parser.Entry{entry}
+	}
+
+	parent := make(map[string]any, len(entry.Fields))
+	for k, v := range entry.Fields {
+		switch v.(type) {
+		case map[string]any, []any:
+			continue
+		}
+		if k != x.field {
+			parent[k] = v
+		}
+	}
+
+	out := make([]*parser.Entry, 0, len(elems))
+	for _, elem := range elems {
+		fields := make(map[string]any, len(parent)+1)
+		for k, v := range parent {
+			fields[k] = v
+		}
+		if obj, ok := elem.(map[string]any); ok {
+			for k, v := range obj {
+				fields[k] = v
+			}
+		} else {
+			fields[x.field] = elem
+		}
+
+		e := *entry
+		e.Fields = fields
+		out = append(out, &e)
+	}
+	return out
+}
+
+// arrayValue returns v as a slice if it is an array or a string holding
+// a JSON array.
+func arrayValue(v any) []any {
+	switch t := v.(type) {
+	case []any:
+		return t
+	case string:
+		if !strings.HasPrefix(strings.TrimSpace(t), "[") {
+			return nil
+		}
+		var arr []any
+		if err := json.Unmarshal([]byte(t), &arr); err != nil {
+			return nil
+		}
+		return arr
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func TestExploder_Process(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]any
+		want   []map[string]any
+	}{
+		{
+			name: "objects merged with parent scalars",
+			fields: map[string]any{
+				"batch": "b1",
+				"meta":  map[string]any{"dropped": true},
+				"records": []any{
+					map[string]any{"user": "alice", "batch": "override"},
+					map[string]any{"user": "bob"},
+				},
+			},
+			want: []map[string]any{
+				{"batch": "override", "user": "alice"},
+				{"batch": "b1", "user": "bob"},
+			},
+		},
+		{
+			name:   "scalar elements",
+			fields: map[string]any{"host": "web1", "records": []any{"a", float64(2)}},
+			want: []map[string]any{
+				{"host": "web1", "records": "a"},
+				{"host": "web1", "records": float64(2)},
+			},
+		},
+		{
+			name:   "JSON array in a string",
+			fields: map[string]any{"records": `[{"id":1},{"id":2}]`},
+			want: []map[string]any{
+				{"id": float64(1)},
+				{"id": float64(2)},
+			},
+		},
+		{
+			name:   "empty array passes through",
+			fields: map[string]any{"host": "web1", "records": []any{}},
+			want:   []map[string]any{{"host": "web1", "records": []any{}}},
+		},
+		{
+			name:   "missing field passes through",
+			fields: map[string]any{"host": "web1"},
+			want:   []map[string]any{{"host": "web1"}},
+		},
+		{
+			name:   "non-array string passes through",
+			fields: map[string]any{"records": "[not json"},
+			want:   []map[string]any{{"records": "[not json"}},
+		},
+	}
+
+	x := NewExploder("records")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := parser.NewEntry("raw")
+			entry.LineNum = 3
+			entry.Fields = tt.fields
+
+			got := x.Process(entry)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Process() returned %d entries, want %d", len(got), len(tt.want))
+			}
+			for i, e := range got {
+				if !reflect.DeepEqual(e.Fields, tt.want[i]) {
+					t.Errorf("entry %d = %v, want %v", i, e.Fields, tt.want[i])
+				}
+				if e.Raw != "raw" || e.LineNum != 3 {
+					t.Errorf("entry %d lost Raw/LineNum", i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package transform
+
+import (
+	"github.com/juliosaraiva/log2json/internal/expr"
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// Filter keeps only entries whose fields satisfy an expression.
+type Filter struct {
+	expr *expr.Expr
+}
+
+// NewFilter creates a filter stage from a compiled expression.
+func NewFilter(e *expr.Expr) *Filter {
+	return &Filter{expr: e}
+}
+
+// Process drops the entry unless the expression matches.
+func (f *Filter) Process(entry *parser.Entry) []*parser.Entry {
+	if !f.expr.Match(entry.Fields) {
+		return nil
+	}
+	return []*parser.Entry{entry}
+}
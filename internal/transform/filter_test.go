@@ -0,0 +1,37 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/expr"
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func TestFilter_Process(t *testing.T) {
+	e, err := expr.Compile(`status >= 500 && method == "POST"`)
+	if err != nil {
+		t.Fatalf("Compile error: %v", err)
+	}
+	f := NewFilter(e)
+
+	tests := []struct {
+		name   string
+		fields map[string]any
+		keep   bool
+	}{
+		{name: "matches", fields: map[string]any{"status": 503, "method": "POST"}, keep: true},
+		{name: "wrong method", fields: map[string]any{"status": 503, "method": "GET"}, keep: false},
+		{name: "low status", fields: map[string]any{"status": 200, "method": "POST"}, keep: false},
+		{name: "missing fields", fields: map[string]any{}, keep: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := parser.NewEntry("line")
+			entry.Fields = tt.fields
+			if got := len(f.Process(entry)) == 1; got != tt.keep {
+				t.Errorf("Process() kept = %v, want %v", got, tt.keep)
+			}
+		})
+	}
+}
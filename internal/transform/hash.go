@@ -0,0 +1,75 @@
+package transform
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// Hasher replaces selected field values with salted hashes, HMACs keyed by
+// the salt. The same input value always hashes to the same output (for a
+// given salt), so records can still be correlated without exposing the
+// original value.
+type Hasher struct {
+	fields  []string
+	newHash func() hash.Hash
+	salt    string
+}
+
+// NewHasher creates a Hasher from a spec of the form
+// "field1,field2[:algorithm[:salt]]". Supported algorithms are
+// sha256 (default) and sha512.
+func NewHasher(spec string) (*Hasher, error) {
+	fieldList, rest, _ := strings.Cut(spec, ":")
+
+	h := &Hasher{newHash: sha256.New}
+	for _, f := range strings.Split(fieldList, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			h.fields = append(h.fields, f)
+		}
+	}
+	if len(h.fields) == 0 {
+		return nil, fmt.Errorf("no fields to hash in %q", spec)
+	}
+
+	if rest != "" {
+		algo, salt, _ := strings.Cut(rest, ":")
+		switch strings.ToLower(algo) {
+		case "", "sha256":
+			h.newHash = sha256.New
+		case "sha512":
+			h.newHash = sha512.New
+		default:
+			return nil, fmt.Errorf("unsupported hash algorithm %q (use sha256 or sha512)", algo)
+		}
+		h.salt = salt
+	}
+
+	return h, nil
+}
+
+// Process hashes the configured fields in place.
+// Fields that are absent from the entry are left alone.
+func (h *Hasher) Process(entry *parser.Entry) []*parser.Entry {
+	for _, f := range h.fields {
+		val, ok := entry.Fields[f]
+		if !ok || val == nil {
+			continue
+		}
+		entry.Fields[f] = h.sum(fmt.Sprint(val))
+	}
+	return []*parser.Entry{entry}
+}
+
+// sum returns the hex-encoded HMAC of value keyed by the salt.
+func (h *Hasher) sum(value string) string {
+	d := hmac.New(h.newHash, []byte(h.salt))
+	d.Write([]byte(value))
+	return hex.EncodeToString(d.Sum(nil))
+}
@@ -0,0 +1,91 @@
+package transform
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func TestNewHasher(t *testing.T) {
+	tests := []struct {
+		name       string
+		spec       string
+		wantErr    bool
+		wantFields int
+	}{
+		{name: "single field", spec: "user", wantFields: 1},
+		{name: "multiple fields", spec: "user,ip", wantFields: 2},
+		{name: "with algorithm", spec: "user,ip:sha512", wantFields: 2},
+		{name: "with algorithm and salt", spec: "user:sha256:pepper", wantFields: 1},
+		{name: "salt containing colon", spec: "user:sha256:a:b", wantFields: 1},
+		{name: "empty spec", spec: "", wantErr: true},
+		{name: "unknown algorithm", spec: "user:md4", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := NewHasher(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewHasher(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if err == nil && len(h.fields) != tt.wantFields {
+				t.Errorf("NewHasher(%q) fields = %v, want %d", tt.spec, h.fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestHasher_Process(t *testing.T) {
+	h, err := NewHasher("user,pid:sha256:salt")
+	if err != nil {
+		t.Fatalf("NewHasher() error: %v", err)
+	}
+
+	e := parser.NewEntry("line")
+	e.Fields["user"] = "alice"
+	e.Fields["pid"] = 42
+	e.Fields["msg"] = "hello"
+
+	out := h.Process(e)
+	if len(out) != 1 {
+		t.Fatalf("Process() returned %d entries, want 1", len(out))
+	}
+
+	mac := hmac.New(sha256.New, []byte("salt"))
+	mac.Write([]byte("alice"))
+	if want := hex.EncodeToString(mac.Sum(nil)); e.Fields["user"] != want {
+		t.Errorf("user = %v, want %s", e.Fields["user"], want)
+	}
+
+	mac = hmac.New(sha256.New, []byte("salt"))
+	mac.Write([]byte("42"))
+	if want := hex.EncodeToString(mac.Sum(nil)); e.Fields["pid"] != want {
+		t.Errorf("pid = %v, want %s", e.Fields["pid"], want)
+	}
+
+	if e.Fields["msg"] != "hello" {
+		t.Errorf("msg should be untouched, got %v", e.Fields["msg"])
+	}
+}
+
+func TestHasher_Deterministic(t *testing.T) {
+	h, _ := NewHasher("user")
+
+	a := parser.NewEntry("a")
+	a.Fields["user"] = "bob"
+	b := parser.NewEntry("b")
+	b.Fields["user"] = "bob"
+
+	h.Process(a)
+	h.Process(b)
+
+	if a.Fields["user"] != b.Fields["user"] {
+		t.Errorf("same value hashed differently: %v vs %v", a.Fields["user"], b.Fields["user"])
+	}
+	if a.Fields["user"] == "bob" {
+		t.Error("value was not hashed")
+	}
+}
@@ -0,0 +1,255 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// DefaultPercentiles are the percentiles a Histogram reports by default.
+const DefaultPercentiles = "50,90,95,99"
+
+// maxHistogramValues bounds the values a Histogram keeps per field and
+// window for its percentiles: past it, every other value is dropped and
+// only every second one after is kept, and so on, so the kept values stay
+// an even sample of the window. Counts, sums, extremes and buckets are
+// exact regardless.
+const maxHistogramValues = 1 << 20
+
+// Histogram turns entries into distributions of numeric fields, such as
+// latencies or sizes: it consumes every entry and, per window of time,
+// emits one record per field with the count, min, max, mean and sum of
+// its values, the requested percentiles (p50, p99, ...) and a histogram
+// of counts in 1-2-5 buckets ({"le": 0.5, "count": n}, each value counted
+// in the lowest bucket at least its size).
+//
+// Windows are aligned to their length (a 1m window starts on the minute)
+// and go by the entry's timestamp, or the time it is seen if it has none;
+// a window's records are emitted when an entry of a later window arrives,
+// and the last window's at the end of the input. Entries of an earlier
+// window than the current one count towards the current one. With no
+// window, one record per field covers the whole input. Numeric strings
+// count as numbers; other values, and missing fields, are skipped.
+type Histogram struct {
+	fields      []string
+	percentiles []float64
+	window      time.Duration
+	now         func() time.Time
+
+	start time.Time // the current window's start
+	dists []*distribution
+}
+
+// distribution is what a Histogram keeps of a field in a window.
+type distribution struct {
+	count    int
+	sum      float64
+	min, max float64
+	buckets  map[float64]int // counts by upper bound
+	values   []float64       // a sample of the values, for percentiles
+	stride   int             // keep one value in stride
+	skipped  int             // values since the last one kept
+}
+
+// NewHistogram creates a Histogram of the comma-separated fields,
+// reporting the comma-separated percentiles (DefaultPercentiles if
+// empty) per window; a window of 0 covers the whole input.
+func NewHistogram(fields, percentiles string, window time.Duration) (*Histogram, error) {
+	h := &Histogram{window: window, now: time.Now}
+	for _, f := range strings.Split(fields, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			h.fields = append(h.fields, f)
+		}
+	}
+	if len(h.fields) == 0 {
+		return nil, fmt.Errorf("no field given")
+	}
+	if window < 0 {
+		return nil, fmt.Errorf("window %v is negative", window)
+	}
+	if percentiles == "" {
+		percentiles = DefaultPercentiles
+	}
+	for _, s := range strings.Split(percentiles, ",") {
+		p, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil || p <= 0 || p > 100 {
+			return nil, fmt.Errorf("invalid percentile %q (expected a number in (0, 100])", s)
+		}
+		h.percentiles = append(h.percentiles, p)
+	}
+	sort.Float64s(h.percentiles)
+	h.reset()
+	return h, nil
+}
+
+// Process adds the entry's values, and returns the records of the window
+// before it once it starts a later one.
+func (h *Histogram) Process(entry *parser.Entry) []*parser.Entry {
+	var out []*parser.Entry
+	if h.window > 0 {
+		now := h.now()
+		at, ok := EntryTime(entry, now)
+		if !ok {
+			at = now
+		}
+		switch start := at.Truncate(h.window); {
+		case h.start.IsZero():
+			h.start = start
+		case start.After(h.start):
+			out = h.records()
+			h.start = start
+			h.reset()
+		}
+	}
+	for i, f := range h.fields {
+		if v, ok := histogramValue(entry.Fields[f]); ok {
+			h.dists[i].add(v)
+		}
+	}
+	return out
+}
+
+// Flush returns the records of the last window.
+func (h *Histogram) Flush() []*parser.Entry {
+	out := h.records()
+	h.reset()
+	return out
+}
+
+// reset starts a new window.
+func (h *Histogram) reset() {
+	h.dists = make([]*distribution, len(h.fields))
+	for i := range h.dists {
+		h.dists[i] = &distribution{buckets: make(map[float64]int), stride: 1}
+	}
+}
+
+// records makes the current window's records, one per field with values;
+// without a window, a field without values still gets one, of count 0.
+func (h *Histogram) records() []*parser.Entry {
+	var out []*parser.Entry
+	for i, d := range h.dists {
+		if d.count == 0 && h.window > 0 {
+			continue
+		}
+		r := parser.NewEntry("")
+		r.Fields["field"] = h.fields[i]
+		r.Fields["count"] = d.count
+		if h.window > 0 {
+			r.Fields["window_start"] = formatTime(h.start)
+			r.Fields["window_end"] = formatTime(h.start.Add(h.window))
+		}
+		if d.count > 0 {
+			r.Fields["min"] = d.min
+			r.Fields["max"] = d.max
+			r.Fields["mean"] = d.sum / float64(d.count)
+			r.Fields["sum"] = d.sum
+			sort.Float64s(d.values)
+			for _, p := range h.percentiles {
+				r.Fields["p"+strconv.FormatFloat(p, 'f', -1, 64)] = percentile(d.values, p)
+			}
+			r.Fields["buckets"] = d.bucketList()
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// add counts a value.
+func (d *distribution) add(v float64) {
+	if d.count == 0 || v < d.min {
+		d.min = v
+	}
+	if d.count == 0 || v > d.max {
+		d.max = v
+	}
+	d.count++
+	d.sum += v
+	d.buckets[bucketBound(v)]++
+
+	if d.skipped++; d.skipped < d.stride {
+		return
+	}
+	d.skipped = 0
+	d.values = append(d.values, v)
+	if len(d.values) >= maxHistogramValues {
+		kept := d.values[:0]
+		for i := 0; i < len(d.values); i += 2 {
+			kept = append(kept, d.values[i])
+		}
+		d.values = kept
+		d.stride *= 2
+	}
+}
+
+// bucketList returns the buckets with values, smallest first.
+func (d *distribution) bucketList() []any {
+	bounds := make([]float64, 0, len(d.buckets))
+	for b := range d.buckets {
+		bounds = append(bounds, b)
+	}
+	sort.Float64s(bounds)
+	list := make([]any, len(bounds))
+	for i, b := range bounds {
+		list[i] = map[string]any{"le": b, "count": d.buckets[b]}
+	}
+	return list
+}
+
+// bucketBound returns the upper bound of v's bucket: the lowest of 1, 2 or
+// 5 times a power of ten at least v, or 0 for values not above 0.
+func bucketBound(v float64) float64 {
+	if v <= 0 {
+		return 0
+	}
+	base := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if b := m * base; b >= v {
+			return b
+		}
+	}
+	return 10 * base
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+// histogramValue converts a field's value, a number or a numeric string,
+// to a float64. NaN and the infinities, which JSON cannot hold, are
+// skipped.
+func histogramValue(v any) (float64, bool) {
+	var f float64
+	switch x := v.(type) {
+	case int:
+		f = float64(x)
+	case int64:
+		f = float64(x)
+	case float64:
+		f = x
+	case json.Number:
+		var err error
+		if f, err = x.Float64(); err != nil {
+			return 0, false
+		}
+	case string:
+		var err error
+		if f, err = strconv.ParseFloat(strings.TrimSpace(x), 64); err != nil {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	return f, !math.IsNaN(f) && !math.IsInf(f, 0)
+}
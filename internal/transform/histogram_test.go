@@ -0,0 +1,158 @@
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func durationEntry(ts string, duration any) *parser.Entry {
+	e := parser.NewEntry("x")
+	if ts != "" {
+		e.Fields["timestamp"] = ts
+	}
+	if duration != nil {
+		e.Fields["duration"] = duration
+	}
+	return e
+}
+
+func TestHistogram_WholeInput(t *testing.T) {
+	h, err := NewHistogram("duration, bytes", "50,99", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 100; i++ {
+		if out := h.Process(durationEntry("", i)); out != nil {
+			t.Fatalf("Process() returned %v, want nothing", out)
+		}
+	}
+	h.Process(durationEntry("", "250.5"))
+	h.Process(durationEntry("", "slow"))
+	h.Process(durationEntry("", nil))
+
+	out := h.Flush()
+	if len(out) != 2 {
+		t.Fatalf("Flush() returned %d records, want 2", len(out))
+	}
+	r := out[0].Fields
+	if r["field"] != "duration" || r["count"] != 101 || r["min"] != 1.0 || r["max"] != 250.5 || r["sum"] != 5300.5 {
+		t.Errorf("unexpected record: %v", r)
+	}
+	if r["p50"] != 51.0 || r["p99"] != 100.0 {
+		t.Errorf("p50, p99 = %v, %v, want 51, 100", r["p50"], r["p99"])
+	}
+	if _, ok := r["window_start"]; ok {
+		t.Errorf("record without a window has window_start: %v", r)
+	}
+	// 1 | 2 | 3-5 | 6-10 | 11-20 | 21-50 | 51-100 | 250.5
+	wantBuckets := []struct {
+		le    float64
+		count int
+	}{{1, 1}, {2, 1}, {5, 3}, {10, 5}, {20, 10}, {50, 30}, {100, 50}, {500, 1}}
+	buckets := r["buckets"].([]any)
+	if len(buckets) != len(wantBuckets) {
+		t.Fatalf("buckets = %v", buckets)
+	}
+	for i, want := range wantBuckets {
+		b := buckets[i].(map[string]any)
+		if b["le"] != want.le || b["count"] != want.count {
+			t.Errorf("bucket %d = %v, want le %v count %d", i, b, want.le, want.count)
+		}
+	}
+
+	// A field without values still reports its count
+	if r := out[1].Fields; r["field"] != "bytes" || r["count"] != 0 || r["p50"] != nil {
+		t.Errorf("unexpected record for a field without values: %v", r)
+	}
+}
+
+func TestHistogram_Windows(t *testing.T) {
+	h, err := NewHistogram("duration", "", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Process(durationEntry("2024-01-15T10:00:05Z", 10))
+	h.Process(durationEntry("2024-01-15T10:00:50Z", 30))
+	h.Process(durationEntry("2024-01-15T10:00:55Z", nil))
+	out := h.Process(durationEntry("2024-01-15T10:01:10Z", 5))
+	if len(out) != 1 {
+		t.Fatalf("a later window released %d records, want 1", len(out))
+	}
+	r := out[0].Fields
+	if r["window_start"] != "2024-01-15T10:00:00Z" || r["window_end"] != "2024-01-15T10:01:00Z" || r["count"] != 2 || r["mean"] != 20.0 {
+		t.Errorf("unexpected record: %v", r)
+	}
+	for _, p := range []string{"p50", "p90", "p95", "p99"} {
+		if _, ok := r[p]; !ok {
+			t.Errorf("record lacks default percentile %s: %v", p, r)
+		}
+	}
+
+	// A late entry counts towards the current window; one without a
+	// timestamp is placed by the time it is seen.
+	h.Process(durationEntry("2024-01-15T10:00:59Z", 7))
+	h.now = func() time.Time { return time.Date(2024, 1, 15, 10, 1, 30, 0, time.UTC) }
+	h.Process(durationEntry("", 9))
+
+	out = h.Flush()
+	if len(out) != 1 || out[0].Fields["count"] != 3 || out[0].Fields["window_start"] != "2024-01-15T10:01:00Z" {
+		t.Errorf("Flush() = %v", out)
+	}
+	if out := h.Flush(); len(out) != 0 {
+		t.Errorf("a window without values released %v", out)
+	}
+}
+
+func TestHistogram_SamplesManyValues(t *testing.T) {
+	h, err := NewHistogram("duration", "50", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := maxHistogramValues*2 + 10
+	for i := 0; i < n; i++ {
+		h.Process(durationEntry("", i))
+	}
+	if kept := len(h.dists[0].values); kept >= maxHistogramValues {
+		t.Errorf("kept %d values, want fewer than %d", kept, maxHistogramValues)
+	}
+	r := h.Flush()[0].Fields
+	if r["count"] != n || r["max"] != float64(n-1) {
+		t.Errorf("count, max = %v, %v, want exact %d, %d", r["count"], r["max"], n, n-1)
+	}
+	if p50 := r["p50"].(float64); p50 < float64(n)*0.49 || p50 > float64(n)*0.51 {
+		t.Errorf("p50 = %v, want about %d", p50, n/2)
+	}
+}
+
+func TestNewHistogram_Errors(t *testing.T) {
+	tests := []struct {
+		name, fields, percentiles string
+		window                    time.Duration
+	}{
+		{name: "no field", fields: " , "},
+		{name: "percentile not a number", fields: "duration", percentiles: "50,high"},
+		{name: "percentile zero", fields: "duration", percentiles: "0"},
+		{name: "percentile over 100", fields: "duration", percentiles: "100.5"},
+		{name: "negative window", fields: "duration", window: -time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewHistogram(tt.fields, tt.percentiles, tt.window); err == nil {
+				t.Error("NewHistogram() succeeded")
+			}
+		})
+	}
+}
+
+func TestBucketBound(t *testing.T) {
+	tests := []struct{ v, want float64 }{
+		{-3, 0}, {0, 0}, {0.3, 0.5}, {1, 1}, {1.5, 2}, {3, 5}, {7, 10}, {10, 10}, {12, 20}, {999, 1000},
+	}
+	for _, tt := range tests {
+		if got := bucketBound(tt.v); got != tt.want {
+			t.Errorf("bucketBound(%v) = %v, want %v", tt.v, got, tt.want)
+		}
+	}
+}
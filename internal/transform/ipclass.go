@@ -0,0 +1,176 @@
+package transform
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// Default reverse DNS budget.
+const (
+	DefaultRDNSTimeout     = 500 * time.Millisecond
+	DefaultRDNSConcurrency = 8
+
+	// rdnsLookupTimeout bounds a background lookup that outlived the
+	// per-entry wait, so its result can still land in the cache.
+	rdnsLookupTimeout = 5 * time.Second
+)
+
+// cgnatBlock is the shared address space used by carrier-grade NAT (RFC 6598).
+var cgnatBlock = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// ClassifyIP returns the address class of ip: "loopback", "private",
+// "cgnat", "link-local", "multicast", "unspecified" or "public".
+func ClassifyIP(ip net.IP) string {
+	switch {
+	case ip.IsLoopback():
+		return "loopback"
+	case ip.IsUnspecified():
+		return "unspecified"
+	case cgnatBlock.Contains(ip):
+		return "cgnat"
+	case ip.IsPrivate():
+		return "private"
+	case ip.IsLinkLocalUnicast():
+		return "link-local"
+	case ip.IsMulticast(), ip.IsLinkLocalMulticast():
+		return "multicast"
+	default:
+		return "public"
+	}
+}
+
+// IPClassifier tags IP address fields with their class and, optionally,
+// a reverse DNS hostname. For a field "ip" it adds "ip_class" and
+// "ip_hostname". Values that are not IP addresses are ignored.
+type IPClassifier struct {
+	fields   []string
+	resolver *resolver
+}
+
+// IPOption configures the IPClassifier.
+type IPOption func(*IPClassifier)
+
+// WithReverseDNS enables cached reverse DNS lookups.
+// Each entry waits at most timeout for a lookup, and no more than
+// concurrency lookups are in flight at once; lookups that exceed the
+// budget are skipped for that entry and picked up from cache later.
+func WithReverseDNS(timeout time.Duration, concurrency int) IPOption {
+	return func(c *IPClassifier) {
+		c.resolver = newResolver(timeout, concurrency, net.DefaultResolver.LookupAddr)
+	}
+}
+
+// NewIPClassifier creates a classifier for the given fields.
+func NewIPClassifier(fields []string, opts ...IPOption) *IPClassifier {
+	c := &IPClassifier{fields: fields}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Process adds class (and hostname) fields for each configured IP field.
+func (c *IPClassifier) Process(entry *parser.Entry) []*parser.Entry {
+	for _, f := range c.fields {
+		s, ok := entry.Fields[f].(string)
+		if !ok {
+			continue
+		}
+		ip := net.ParseIP(s)
+		if ip == nil {
+			continue
+		}
+
+		entry.Fields[f+"_class"] = ClassifyIP(ip)
+
+		if c.resolver != nil {
+			if host := c.resolver.lookup(ip.String()); host != "" {
+				entry.Fields[f+"_hostname"] = host
+			}
+		}
+	}
+	return []*parser.Entry{entry}
+}
+
+// lookupFunc resolves an address to host names (net.Resolver.LookupAddr).
+type lookupFunc func(ctx context.Context, addr string) ([]string, error)
+
+// rdnsResult is a cached (or in-flight) reverse lookup.
+type rdnsResult struct {
+	done chan struct{}
+	host string
+}
+
+// resolver performs budgeted, cached reverse DNS lookups.
+type resolver struct {
+	timeout time.Duration
+	sem     chan struct{}
+	lookupF lookupFunc
+
+	mu    sync.Mutex
+	cache map[string]*rdnsResult
+}
+
+func newResolver(timeout time.Duration, concurrency int, fn lookupFunc) *resolver {
+	if timeout <= 0 {
+		timeout = DefaultRDNSTimeout
+	}
+	if concurrency <= 0 {
+		concurrency = DefaultRDNSConcurrency
+	}
+	return &resolver{
+		timeout: timeout,
+		sem:     make(chan struct{}, concurrency),
+		lookupF: fn,
+		cache:   make(map[string]*rdnsResult),
+	}
+}
+
+// lookup returns the hostname for addr, or "" if unknown or over budget.
+// Failed lookups are cached too, so a dead address is only tried once.
+func (r *resolver) lookup(addr string) string {
+	r.mu.Lock()
+	res, ok := r.cache[addr]
+	if !ok {
+		select {
+		case r.sem <- struct{}{}:
+		default:
+			// Concurrency budget exhausted; try again on a later entry.
+			r.mu.Unlock()
+			return ""
+		}
+		res = &rdnsResult{done: make(chan struct{})}
+		r.cache[addr] = res
+		go r.resolve(addr, res)
+	}
+	r.mu.Unlock()
+
+	timer := time.NewTimer(r.timeout)
+	defer timer.Stop()
+
+	select {
+	case <-res.done:
+		return res.host
+	case <-timer.C:
+		return ""
+	}
+}
+
+// resolve runs a single lookup and publishes the result.
+func (r *resolver) resolve(addr string, res *rdnsResult) {
+	defer func() { <-r.sem }()
+	defer close(res.done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), rdnsLookupTimeout)
+	defer cancel()
+
+	names, err := r.lookupF(ctx, addr)
+	if err == nil && len(names) > 0 {
+		res.host = strings.TrimSuffix(names[0], ".")
+	}
+}
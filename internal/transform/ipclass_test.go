@@ -0,0 +1,121 @@
+package transform
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func TestClassifyIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"127.0.0.1", "loopback"},
+		{"::1", "loopback"},
+		{"10.1.2.3", "private"},
+		{"192.168.1.1", "private"},
+		{"172.16.0.5", "private"},
+		{"fd00::1", "private"},
+		{"100.64.0.1", "cgnat"},
+		{"100.127.255.254", "cgnat"},
+		{"169.254.1.1", "link-local"},
+		{"224.0.0.1", "multicast"},
+		{"0.0.0.0", "unspecified"},
+		{"8.8.8.8", "public"},
+		{"2001:4860:4860::8888", "public"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := ClassifyIP(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("ClassifyIP(%s) = %q, want %q", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPClassifier_Process(t *testing.T) {
+	c := NewIPClassifier([]string{"ip", "client"})
+
+	e := parser.NewEntry("line")
+	e.Fields["ip"] = "192.168.1.1"
+	e.Fields["client"] = "not-an-ip"
+
+	c.Process(e)
+
+	if e.Fields["ip_class"] != "private" {
+		t.Errorf("ip_class = %v, want private", e.Fields["ip_class"])
+	}
+	if _, ok := e.Fields["client_class"]; ok {
+		t.Error("non-IP value should not be classified")
+	}
+	if _, ok := e.Fields["ip_hostname"]; ok {
+		t.Error("hostname should not be added without reverse DNS")
+	}
+}
+
+func TestIPClassifier_ReverseDNS(t *testing.T) {
+	var calls int32
+	c := NewIPClassifier([]string{"ip"})
+	c.resolver = newResolver(time.Second, 2, func(ctx context.Context, addr string) ([]string, error) {
+		atomic.AddInt32(&calls, 1)
+		if addr == "8.8.8.8" {
+			return []string{"dns.google."}, nil
+		}
+		return nil, errors.New("no such host")
+	})
+
+	for i := 0; i < 3; i++ {
+		e := parser.NewEntry("line")
+		e.Fields["ip"] = "8.8.8.8"
+		c.Process(e)
+		if e.Fields["ip_hostname"] != "dns.google" {
+			t.Errorf("ip_hostname = %v, want dns.google", e.Fields["ip_hostname"])
+		}
+	}
+
+	e := parser.NewEntry("line")
+	e.Fields["ip"] = "1.2.3.4"
+	c.Process(e)
+	if _, ok := e.Fields["ip_hostname"]; ok {
+		t.Error("failed lookup should not add hostname")
+	}
+
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("lookup called %d times, want 2 (results should be cached)", n)
+	}
+}
+
+func TestResolver_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	r := newResolver(10*time.Millisecond, 1, func(ctx context.Context, addr string) ([]string, error) {
+		<-release
+		return []string{"slow.example."}, nil
+	})
+
+	if host := r.lookup("1.1.1.1"); host != "" {
+		t.Errorf("lookup over budget returned %q, want empty", host)
+	}
+
+	// Concurrency budget is exhausted while the first lookup is pending.
+	if host := r.lookup("2.2.2.2"); host != "" {
+		t.Errorf("lookup with no free slot returned %q, want empty", host)
+	}
+
+	close(release)
+
+	// The background lookup completes and is served from cache.
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if host := r.lookup("1.1.1.1"); host == "slow.example" {
+			return
+		}
+	}
+	t.Error("expected cached hostname after background lookup completed")
+}
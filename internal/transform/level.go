@@ -0,0 +1,136 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// Level is a normalized log severity, ordered from least to most severe.
+type Level int
+
+// Normalized severity levels.
+const (
+	LevelTrace Level = iota
+	LevelDebug
+	LevelInfo
+	LevelNotice
+	LevelWarn
+	LevelError
+	LevelCritical
+	LevelFatal
+)
+
+var levelNames = [...]string{"trace", "debug", "info", "notice", "warn", "error", "critical", "fatal"}
+
+// String returns the canonical lowercase name of the level.
+func (l Level) String() string {
+	if l < LevelTrace || l > LevelFatal {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// levelAliases maps the spellings seen in the wild to normalized levels.
+var levelAliases = map[string]Level{
+	"trace":         LevelTrace,
+	"trc":           LevelTrace,
+	"finest":        LevelTrace,
+	"debug":         LevelDebug,
+	"dbg":           LevelDebug,
+	"fine":          LevelDebug,
+	"info":          LevelInfo,
+	"inf":           LevelInfo,
+	"information":   LevelInfo,
+	"informational": LevelInfo,
+	"notice":        LevelNotice,
+	"warn":          LevelWarn,
+	"warning":       LevelWarn,
+	"wrn":           LevelWarn,
+	"error":         LevelError,
+	"err":           LevelError,
+	"severe":        LevelError,
+	"critical":      LevelCritical,
+	"crit":          LevelCritical,
+	"alert":         LevelCritical,
+	"fatal":         LevelFatal,
+	"emerg":         LevelFatal,
+	"emergency":     LevelFatal,
+	"panic":         LevelFatal,
+}
+
+// LevelFields lists the field names checked (in order) for an entry's level.
+var LevelFields = []string{"level", "severity", "lvl", "loglevel", "log_level"}
+
+// ParseLevel normalizes a level value. It accepts names in any case
+// (WARN, warning, Err...) and the numeric levels used by bunyan/pino
+// (10=trace ... 60=fatal).
+func ParseLevel(v any) (Level, bool) {
+	switch x := v.(type) {
+	case string:
+		l, ok := levelAliases[strings.ToLower(strings.TrimSpace(x))]
+		return l, ok
+	case int:
+		return numericLevel(int64(x))
+	case int64:
+		return numericLevel(x)
+	case float64:
+		return numericLevel(int64(x))
+	}
+	return 0, false
+}
+
+// numericLevel maps bunyan/pino numeric levels.
+func numericLevel(n int64) (Level, bool) {
+	switch n {
+	case 10:
+		return LevelTrace, true
+	case 20:
+		return LevelDebug, true
+	case 30:
+		return LevelInfo, true
+	case 40:
+		return LevelWarn, true
+	case 50:
+		return LevelError, true
+	case 60:
+		return LevelFatal, true
+	}
+	return 0, false
+}
+
+// EntryLevel finds and normalizes the level of an entry.
+// Returns false if the entry has no recognizable level field.
+func EntryLevel(entry *parser.Entry) (Level, bool) {
+	for _, f := range LevelFields {
+		if v, ok := entry.Fields[f]; ok {
+			return ParseLevel(v)
+		}
+	}
+	return 0, false
+}
+
+// MinLevel drops entries whose normalized level is below a threshold.
+// Entries without a recognizable level are kept, since there is nothing
+// to judge them by.
+type MinLevel struct {
+	min Level
+}
+
+// NewMinLevel creates a severity filter from a level name (e.g. "warn").
+func NewMinLevel(name string) (*MinLevel, error) {
+	l, ok := ParseLevel(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown level %q (use trace, debug, info, notice, warn, error, critical or fatal)", name)
+	}
+	return &MinLevel{min: l}, nil
+}
+
+// Process drops the entry if it is less severe than the threshold.
+func (m *MinLevel) Process(entry *parser.Entry) []*parser.Entry {
+	if l, ok := EntryLevel(entry); ok && l < m.min {
+		return nil
+	}
+	return []*parser.Entry{entry}
+}
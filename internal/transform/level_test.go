@@ -0,0 +1,81 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in     any
+		want   Level
+		wantOK bool
+	}{
+		{"INFO", LevelInfo, true},
+		{"warning", LevelWarn, true},
+		{"Warn", LevelWarn, true},
+		{"ERR", LevelError, true},
+		{"crit", LevelCritical, true},
+		{"emerg", LevelFatal, true},
+		{" debug ", LevelDebug, true},
+		{int64(30), LevelInfo, true},
+		{float64(50), LevelError, true},
+		{60, LevelFatal, true},
+		{"verbose-ish", 0, false},
+		{int64(35), 0, false},
+		{true, 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseLevel(tt.in)
+		if ok != tt.wantOK || (ok && got != tt.want) {
+			t.Errorf("ParseLevel(%v) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestLevel_String(t *testing.T) {
+	if LevelWarn.String() != "warn" {
+		t.Errorf("LevelWarn.String() = %q, want warn", LevelWarn.String())
+	}
+	if Level(99).String() != "level(99)" {
+		t.Errorf("Level(99).String() = %q", Level(99).String())
+	}
+}
+
+func TestNewMinLevel(t *testing.T) {
+	if _, err := NewMinLevel("warn"); err != nil {
+		t.Errorf("NewMinLevel(warn) error: %v", err)
+	}
+	if _, err := NewMinLevel("loud"); err == nil {
+		t.Error("NewMinLevel(loud) expected error")
+	}
+}
+
+func TestMinLevel_Process(t *testing.T) {
+	m, _ := NewMinLevel("warn")
+
+	tests := []struct {
+		name   string
+		fields map[string]any
+		keep   bool
+	}{
+		{name: "info dropped", fields: map[string]any{"level": "INFO"}, keep: false},
+		{name: "warning kept", fields: map[string]any{"level": "warning"}, keep: true},
+		{name: "error kept", fields: map[string]any{"severity": "ERROR"}, keep: true},
+		{name: "numeric debug dropped", fields: map[string]any{"level": int64(20)}, keep: false},
+		{name: "no level kept", fields: map[string]any{"msg": "hi"}, keep: true},
+		{name: "unknown level kept", fields: map[string]any{"level": "chatty"}, keep: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := parser.NewEntry("line")
+			e.Fields = tt.fields
+			if got := len(m.Process(e)) == 1; got != tt.keep {
+				t.Errorf("Process() kept = %v, want %v", got, tt.keep)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package transform
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// Lookup joins a field against a key/value table loaded from a file,
+// adding the matched row's columns to the entry. Existing fields are
+// never overwritten.
+type Lookup struct {
+	field string
+	table map[string]map[string]any
+}
+
+// NewLookup creates a lookup stage from a spec of the form "field=path".
+// See LoadLookupTable for the supported file formats.
+func NewLookup(spec string) (*Lookup, error) {
+	field, path, ok := strings.Cut(spec, "=")
+	field, path = strings.TrimSpace(field), strings.TrimSpace(path)
+	if !ok || field == "" || path == "" {
+		return nil, fmt.Errorf("expected field=file, got %q", spec)
+	}
+
+	table, err := LoadLookupTable(field, path)
+	if err != nil {
+		return nil, err
+	}
+	return &Lookup{field: field, table: table}, nil
+}
+
+// LoadLookupTable reads a lookup file, choosing the format by extension.
+//
+// CSV (.csv): the first row is a header; the first column is the key and
+// the remaining columns are added under their header names.
+//
+//	status,status_text,class
+//	404,Not Found,client_error
+//
+// JSON (.json): an object keyed by lookup value. Object values are merged
+// into the entry; scalar values are added as "<field>_lookup".
+//
+//	{"404": {"status_text": "Not Found"}, "500": "Internal Server Error"}
+func LoadLookupTable(field, path string) (map[string]map[string]any, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return readCSVTable(f)
+	case ".json":
+		return readJSONTable(field, f)
+	}
+	return nil, fmt.Errorf("unsupported lookup file %q (use .csv or .json)", path)
+}
+
+// readCSVTable parses a CSV lookup table with a header row.
+func readCSVTable(r io.Reader) (map[string]map[string]any, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("empty lookup table")
+	}
+
+	header := records[0]
+	if len(header) < 2 {
+		return nil, fmt.Errorf("lookup CSV needs a key column and at least one value column")
+	}
+
+	table := make(map[string]map[string]any, len(records)-1)
+	for _, rec := range records[1:] {
+		row := make(map[string]any, len(header)-1)
+		for i := 1; i < len(header) && i < len(rec); i++ {
+			row[header[i]] = rec[i]
+		}
+		table[rec[0]] = row
+	}
+	return table, nil
+}
+
+// readJSONTable parses a JSON lookup table.
+func readJSONTable(field string, r io.Reader) (map[string]map[string]any, error) {
+	var raw map[string]any
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid JSON lookup table: %w", err)
+	}
+
+	table := make(map[string]map[string]any, len(raw))
+	for key, v := range raw {
+		if row, ok := v.(map[string]any); ok {
+			table[key] = row
+		} else {
+			table[key] = map[string]any{field + "_lookup": v}
+		}
+	}
+	return table, nil
+}
+
+// Process adds the columns of the matching row, if any.
+func (l *Lookup) Process(entry *parser.Entry) []*parser.Entry {
+	v, ok := entry.Fields[l.field]
+	if !ok {
+		return []*parser.Entry{entry}
+	}
+
+	if row, ok := l.table[fmt.Sprint(v)]; ok {
+		for k, val := range row {
+			if _, exists := entry.Fields[k]; !exists {
+				entry.Fields[k] = val
+			}
+		}
+	}
+	return []*parser.Entry{entry}
+}
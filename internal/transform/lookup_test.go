@@ -0,0 +1,86 @@
+package transform
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func writeTemp(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLookup_CSV(t *testing.T) {
+	path := writeTemp(t, "status.csv", "status,status_text,class\n404,Not Found,client_error\n500,Internal Server Error,server_error\n")
+
+	l, err := NewLookup("status=" + path)
+	if err != nil {
+		t.Fatalf("NewLookup error: %v", err)
+	}
+
+	e := parser.NewEntry("x")
+	e.Fields["status"] = 404
+	e.Fields["class"] = "existing"
+	l.Process(e)
+
+	if e.Fields["status_text"] != "Not Found" {
+		t.Errorf("status_text = %v, want Not Found", e.Fields["status_text"])
+	}
+	if e.Fields["class"] != "existing" {
+		t.Errorf("existing field overwritten: %v", e.Fields["class"])
+	}
+
+	miss := parser.NewEntry("y")
+	miss.Fields["status"] = 200
+	l.Process(miss)
+	if _, ok := miss.Fields["status_text"]; ok {
+		t.Error("unmatched key should not add fields")
+	}
+}
+
+func TestLookup_JSON(t *testing.T) {
+	path := writeTemp(t, "users.json", `{"42": {"team": "payments"}, "7": "ops"}`)
+
+	l, err := NewLookup("user_id=" + path)
+	if err != nil {
+		t.Fatalf("NewLookup error: %v", err)
+	}
+
+	a := parser.NewEntry("a")
+	a.Fields["user_id"] = int64(42)
+	l.Process(a)
+	if a.Fields["team"] != "payments" {
+		t.Errorf("team = %v, want payments", a.Fields["team"])
+	}
+
+	b := parser.NewEntry("b")
+	b.Fields["user_id"] = "7"
+	l.Process(b)
+	if b.Fields["user_id_lookup"] != "ops" {
+		t.Errorf("user_id_lookup = %v, want ops", b.Fields["user_id_lookup"])
+	}
+}
+
+func TestNewLookup_Errors(t *testing.T) {
+	tests := []string{
+		"status",
+		"=file.csv",
+		"status=" + filepath.Join(t.TempDir(), "missing.csv"),
+		"status=" + writeTemp(t, "table.txt", "a,b"),
+		"status=" + writeTemp(t, "one.csv", "key\n1\n"),
+		"status=" + writeTemp(t, "empty.csv", ""),
+		"status=" + writeTemp(t, "bad.json", "[1,2]"),
+	}
+	for _, spec := range tests {
+		if _, err := NewLookup(spec); err == nil {
+			t.Errorf("NewLookup(%q) expected error", spec)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package transform
+
+import (
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+	"github.com/juliosaraiva/log2json/internal/query"
+)
+
+// Query runs a SQL query over the entries, which its rows replace. A query
+// without aggregates or GROUP BY turns each entry into its row as it
+// comes. One with them returns its rows, per window of time, when an entry
+// of a later window arrives and at the end of the input, with the
+// window's bounds as window_start and window_end; with no window, its rows
+// cover the whole input. Windows go by entry timestamps, as Histogram's.
+type Query struct {
+	q      *query.Query
+	window time.Duration
+	now    func() time.Time
+
+	start time.Time // the current window's start
+	run   *query.Run
+}
+
+// NewQuery parses a query to run per window; a window of 0 covers the
+// whole input.
+func NewQuery(src string, window time.Duration) (*Query, error) {
+	q, err := query.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return &Query{q: q, window: window, now: time.Now, run: q.Start()}, nil
+}
+
+// Process runs the query over the entry, returning its row, or the rows
+// of the window before it once it starts a later one.
+func (q *Query) Process(entry *parser.Entry) []*parser.Entry {
+	if !q.q.Grouped() {
+		row, ok := q.run.Add(entry.Fields)
+		if !ok {
+			return nil
+		}
+		entry.Fields = row
+		return []*parser.Entry{entry}
+	}
+
+	var out []*parser.Entry
+	if q.window > 0 {
+		now := q.now()
+		at, ok := EntryTime(entry, now)
+		if !ok {
+			at = now
+		}
+		switch start := at.Truncate(q.window); {
+		case q.start.IsZero():
+			q.start = start
+		case start.After(q.start):
+			out = q.rows()
+			q.start = start
+			q.run = q.q.Start()
+		}
+	}
+	q.run.Add(entry.Fields)
+	return out
+}
+
+// Flush returns the rows of the last window, if the query has groups.
+func (q *Query) Flush() []*parser.Entry {
+	if !q.q.Grouped() || q.window > 0 && q.start.IsZero() {
+		return nil
+	}
+	out := q.rows()
+	q.run = q.q.Start()
+	return out
+}
+
+// rows makes entries of the current run's rows.
+func (q *Query) rows() []*parser.Entry {
+	var out []*parser.Entry
+	for _, row := range q.run.Rows() {
+		e := parser.NewEntry("")
+		e.Fields = row
+		if q.window > 0 {
+			row["window_start"] = formatTime(q.start)
+			row["window_end"] = formatTime(q.start.Add(q.window))
+		}
+		out = append(out, e)
+	}
+	return out
+}
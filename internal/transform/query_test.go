@@ -0,0 +1,76 @@
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func requestEntry(ts, path string, status int) *parser.Entry {
+	e := parser.NewEntry("x")
+	e.Fields["timestamp"] = ts
+	e.Fields["path"] = path
+	e.Fields["status"] = status
+	return e
+}
+
+func TestQuery_Select(t *testing.T) {
+	q, err := NewQuery("SELECT path FROM stream WHERE status >= 500", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := q.Process(requestEntry("2024-01-15T10:00:00Z", "/a", 200)); len(out) != 0 {
+		t.Errorf("unmatched entry gave %v", out)
+	}
+	out := q.Process(requestEntry("2024-01-15T10:00:01Z", "/b", 503))
+	if len(out) != 1 || len(out[0].Fields) != 1 || out[0].Fields["path"] != "/b" {
+		t.Errorf("matched entry gave %v", out)
+	}
+	if out := q.Flush(); len(out) != 0 {
+		t.Errorf("Flush() = %v for a query without groups", out)
+	}
+}
+
+func TestQuery_Windows(t *testing.T) {
+	q, err := NewQuery("SELECT path, count(*) AS n FROM stream GROUP BY path ORDER BY n DESC", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Process(requestEntry("2024-01-15T10:00:05Z", "/a", 200))
+	q.Process(requestEntry("2024-01-15T10:00:10Z", "/b", 200))
+	q.Process(requestEntry("2024-01-15T10:00:20Z", "/b", 500))
+	out := q.Process(requestEntry("2024-01-15T10:01:00Z", "/a", 200))
+	if len(out) != 2 {
+		t.Fatalf("a later window released %d rows, want 2", len(out))
+	}
+	r := out[0].Fields
+	if r["path"] != "/b" || r["n"] != 2 || r["window_start"] != "2024-01-15T10:00:00Z" || r["window_end"] != "2024-01-15T10:01:00Z" {
+		t.Errorf("unexpected first row: %v", r)
+	}
+
+	out = q.Flush()
+	if len(out) != 1 || out[0].Fields["path"] != "/a" || out[0].Fields["window_start"] != "2024-01-15T10:01:00Z" {
+		t.Errorf("Flush() = %v", out)
+	}
+}
+
+func TestQuery_WholeInput(t *testing.T) {
+	q, err := NewQuery("SELECT count(*) FROM stream", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := q.Flush()
+	if len(out) != 1 || out[0].Fields["count(*)"] != 0 {
+		t.Errorf("Flush() of no entries = %v, want a count of 0", out)
+	}
+	if _, ok := out[0].Fields["window_start"]; ok {
+		t.Errorf("row without a window has window_start: %v", out[0].Fields)
+	}
+}
+
+func TestNewQuery_Invalid(t *testing.T) {
+	if _, err := NewQuery("SELECT path, count(*) FROM stream", 0); err == nil {
+		t.Error("NewQuery accepted a column outside GROUP BY")
+	}
+}
@@ -0,0 +1,157 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// RateLimiter caps the number of entries emitted per value of a key
+// field within a fixed time window. When a window closes with entries
+// dropped, a summary record {<field>: value, "_dropped": n, "_interval": ...}
+// is emitted so the loss is visible downstream.
+type RateLimiter struct {
+	field    string
+	limit    int
+	interval time.Duration
+	now      func() time.Time
+
+	windows   map[string]*rateWindow
+	lastSweep time.Time
+}
+
+// rateWindow tracks one key's current window.
+type rateWindow struct {
+	start   time.Time
+	count   int
+	dropped int
+}
+
+// NewRateLimiter creates a limiter from a spec of the form "field:N/unit",
+// where unit is s, m, h or a Go duration (e.g. "program:10/s",
+// "path:100/30s"). A space may be used instead of the colon.
+func NewRateLimiter(spec string) (*RateLimiter, error) {
+	field, rate, ok := strings.Cut(spec, ":")
+	if !ok {
+		field, rate, ok = strings.Cut(spec, " ")
+	}
+	field, rate = strings.TrimSpace(field), strings.TrimSpace(rate)
+	if !ok || field == "" {
+		return nil, fmt.Errorf("expected field:N/interval, got %q", spec)
+	}
+
+	num, unit, ok := strings.Cut(rate, "/")
+	limit, err := strconv.Atoi(num)
+	if !ok || err != nil || limit < 1 {
+		return nil, fmt.Errorf("invalid rate %q (expected N/interval, e.g. 10/s)", rate)
+	}
+	interval, err := parseInterval(unit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RateLimiter{
+		field:    field,
+		limit:    limit,
+		interval: interval,
+		now:      time.Now,
+		windows:  make(map[string]*rateWindow),
+	}, nil
+}
+
+// parseInterval accepts a bare unit (s, m, h) or a Go duration.
+func parseInterval(unit string) (time.Duration, error) {
+	switch unit {
+	case "s", "sec":
+		return time.Second, nil
+	case "m", "min":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	}
+	d, err := time.ParseDuration(unit)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid interval %q", unit)
+	}
+	return d, nil
+}
+
+// Process passes the entry if its key is under the limit for the current
+// window. Summaries for windows that closed since the last sweep, and for
+// the key's own window if it has closed, are emitted ahead of the entry.
+func (r *RateLimiter) Process(entry *parser.Entry) []*parser.Entry {
+	now := r.now()
+	out := r.sweep(now, false)
+
+	val, ok := entry.Fields[r.field]
+	if !ok {
+		return append(out, entry)
+	}
+	key := fmt.Sprint(val)
+
+	// The key's window closes an interval after it started, whenever
+	// the last sweep was
+	w := r.windows[key]
+	if w != nil && now.Sub(w.start) >= r.interval {
+		if w.dropped > 0 {
+			out = append(out, r.summary(key, w.dropped))
+		}
+		w = nil
+	}
+	if w == nil {
+		w = &rateWindow{start: now}
+		r.windows[key] = w
+	}
+
+	if w.count >= r.limit {
+		w.dropped++
+		return out
+	}
+	w.count++
+	return append(out, entry)
+}
+
+// Flush emits summaries for all windows that dropped entries.
+func (r *RateLimiter) Flush() []*parser.Entry {
+	return r.sweep(r.now(), true)
+}
+
+// sweep closes expired windows (all windows if final) and returns their
+// drop summaries in key order. Runs at most once per interval.
+func (r *RateLimiter) sweep(now time.Time, final bool) []*parser.Entry {
+	if !final && now.Sub(r.lastSweep) < r.interval {
+		return nil
+	}
+	r.lastSweep = now
+
+	var keys []string
+	for k, w := range r.windows {
+		if final || now.Sub(w.start) >= r.interval {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var out []*parser.Entry
+	for _, k := range keys {
+		w := r.windows[k]
+		delete(r.windows, k)
+		if w.dropped > 0 {
+			out = append(out, r.summary(k, w.dropped))
+		}
+	}
+	return out
+}
+
+// summary is the record of the entries of key dropped in a window.
+func (r *RateLimiter) summary(key string, dropped int) *parser.Entry {
+	summary := parser.NewEntry("")
+	summary.Fields[r.field] = key
+	summary.Fields["_dropped"] = dropped
+	summary.Fields["_interval"] = r.interval.String()
+	return summary
+}
@@ -0,0 +1,135 @@
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func TestNewRateLimiter(t *testing.T) {
+	tests := []struct {
+		spec         string
+		wantErr      bool
+		wantInterval time.Duration
+	}{
+		{spec: "program:10/s", wantInterval: time.Second},
+		{spec: "program 10/m", wantInterval: time.Minute},
+		{spec: "path:5/30s", wantInterval: 30 * time.Second},
+		{spec: "program", wantErr: true},
+		{spec: "program:0/s", wantErr: true},
+		{spec: "program:x/s", wantErr: true},
+		{spec: "program:10", wantErr: true},
+		{spec: "program:10/fortnight", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			r, err := NewRateLimiter(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewRateLimiter(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if err == nil && r.interval != tt.wantInterval {
+				t.Errorf("interval = %v, want %v", r.interval, tt.wantInterval)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_Process(t *testing.T) {
+	r, err := NewRateLimiter("program:2/s")
+	if err != nil {
+		t.Fatalf("NewRateLimiter error: %v", err)
+	}
+	clock := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return clock }
+
+	send := func(program string) []*parser.Entry {
+		e := parser.NewEntry(program)
+		e.Fields["program"] = program
+		return r.Process(e)
+	}
+
+	var passed int
+	for i := 0; i < 5; i++ {
+		passed += len(send("noisy"))
+	}
+	passed += len(send("quiet"))
+	if passed != 3 {
+		t.Fatalf("passed %d entries in first window, want 3", passed)
+	}
+
+	// Next window: the summary for the closed window precedes the entry.
+	clock = clock.Add(1500 * time.Millisecond)
+	out := send("noisy")
+	if len(out) != 2 {
+		t.Fatalf("got %d entries after window close, want summary + entry", len(out))
+	}
+	if out[0].Fields["_dropped"] != 3 || out[0].Fields["program"] != "noisy" {
+		t.Errorf("unexpected summary: %v", out[0].Fields)
+	}
+	if out[1].Fields["program"] != "noisy" || out[1].Fields["_dropped"] != nil {
+		t.Errorf("unexpected entry: %v", out[1].Fields)
+	}
+}
+
+func TestRateLimiter_WindowStartsMidInterval(t *testing.T) {
+	r, err := NewRateLimiter("program:1/s")
+	if err != nil {
+		t.Fatalf("NewRateLimiter error: %v", err)
+	}
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	clock := start
+	r.now = func() time.Time { return clock }
+	send := func(at time.Duration, program string) []*parser.Entry {
+		clock = start.Add(at)
+		e := parser.NewEntry(program)
+		e.Fields["program"] = program
+		return r.Process(e)
+	}
+
+	// The sweep at 0s sets when the next one runs; "late" starts its
+	// window just after, at 0.9s
+	send(0, "early")
+	if len(send(900*time.Millisecond, "late")) != 1 {
+		t.Fatal("first late entry dropped")
+	}
+	if len(send(1500*time.Millisecond, "late")) != 0 {
+		t.Fatal("second late entry passed within its window")
+	}
+
+	// At 1.95s the window that started at 0.9s has closed, though the
+	// sweep at 1.5s did not see it close
+	out := send(1950*time.Millisecond, "late")
+	if len(out) != 2 {
+		t.Fatalf("got %d entries once the window closed, want summary + entry", len(out))
+	}
+	if out[0].Fields["_dropped"] != 1 || out[0].Fields["program"] != "late" {
+		t.Errorf("unexpected summary: %v", out[0].Fields)
+	}
+	if out[1].Fields["_dropped"] != nil {
+		t.Errorf("unexpected entry: %v", out[1].Fields)
+	}
+}
+
+func TestRateLimiter_Flush(t *testing.T) {
+	r, _ := NewRateLimiter("program:1/h")
+
+	for i := 0; i < 3; i++ {
+		e := parser.NewEntry("x")
+		e.Fields["program"] = "a"
+		r.Process(e)
+	}
+	e := parser.NewEntry("no key")
+	if len(r.Process(e)) != 1 {
+		t.Error("entry without key field should pass")
+	}
+
+	out := r.Flush()
+	if len(out) != 1 || out[0].Fields["_dropped"] != 2 {
+		t.Fatalf("Flush() = %v, want one summary with _dropped=2", out)
+	}
+	if out[0].Fields["_interval"] != "1h0m0s" {
+		t.Errorf("_interval = %v, want 1h0m0s", out[0].Fields["_interval"])
+	}
+}
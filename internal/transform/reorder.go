@@ -0,0 +1,97 @@
+package transform
+
+import (
+	"container/heap"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// maxReorderHeld bounds the entries a Reorderer holds: past it, the
+// oldest is released early rather than letting memory grow.
+const maxReorderHeld = 100000
+
+// Reorderer sorts slightly out-of-order entries by their timestamp, as
+// when several live inputs are merged and their lines interleave. Each
+// entry is held until one at least the window later has been seen, and
+// entries are released oldest first; equal times keep their input order.
+//
+// An entry without a timestamp takes that of the latest entry seen, so it
+// stays behind the entries that came before it. An entry later than the
+// window is released at once, still out of order. Held entries wait for
+// later ones, or the end of the input, to release them.
+type Reorderer struct {
+	window time.Duration
+	now    func() time.Time
+
+	held   reorderHeap
+	latest time.Time // the latest timestamp seen
+	seq    int64     // entries seen, to keep input order among equal times
+}
+
+// reorderItem is an entry held with its timestamp.
+type reorderItem struct {
+	entry *parser.Entry
+	at    time.Time
+	seq   int64
+}
+
+// NewReorderer creates a Reorderer holding entries for window.
+func NewReorderer(window time.Duration) *Reorderer {
+	return &Reorderer{window: window, now: time.Now}
+}
+
+// Process holds the entry and releases those the window has passed.
+func (r *Reorderer) Process(entry *parser.Entry) []*parser.Entry {
+	at, ok := EntryTime(entry, r.now())
+	switch {
+	case !ok && len(r.held) == 0:
+		return []*parser.Entry{entry}
+	case !ok:
+		at = r.latest
+	case at.After(r.latest):
+		r.latest = at
+	}
+	r.seq++
+	heap.Push(&r.held, reorderItem{entry: entry, at: at, seq: r.seq})
+
+	var out []*parser.Entry
+	cutoff := r.latest.Add(-r.window)
+	for len(r.held) > 0 && (!r.held[0].at.After(cutoff) || len(r.held) > maxReorderHeld) {
+		out = append(out, heap.Pop(&r.held).(reorderItem).entry)
+	}
+	return out
+}
+
+// Flush releases every held entry, in order.
+func (r *Reorderer) Flush() []*parser.Entry {
+	out := make([]*parser.Entry, 0, len(r.held))
+	for len(r.held) > 0 {
+		out = append(out, heap.Pop(&r.held).(reorderItem).entry)
+	}
+	return out
+}
+
+// reorderHeap is a min-heap of held entries by time, then input order.
+type reorderHeap []reorderItem
+
+func (h reorderHeap) Len() int { return len(h) }
+
+func (h reorderHeap) Less(i, j int) bool {
+	if !h[i].at.Equal(h[j].at) {
+		return h[i].at.Before(h[j].at)
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h reorderHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *reorderHeap) Push(x any) { *h = append(*h, x.(reorderItem)) }
+
+func (h *reorderHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = reorderItem{}
+	*h = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,117 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// timedEntry returns an entry named name with a timestamp sec seconds
+// into 2024, or none if sec is negative.
+func timedEntry(name string, sec int) *parser.Entry {
+	e := parser.NewEntry(name)
+	e.Fields["name"] = name
+	if sec >= 0 {
+		e.Fields["timestamp"] = time.Date(2024, 1, 1, 0, 0, sec, 0, time.UTC).Format(time.RFC3339)
+	}
+	return e
+}
+
+func names(entries []*parser.Entry) string {
+	var s []string
+	for _, e := range entries {
+		s = append(s, e.Fields["name"].(string))
+	}
+	return strings.Join(s, " ")
+}
+
+func TestReorderer(t *testing.T) {
+	type in struct {
+		name string
+		sec  int
+	}
+	tests := []struct {
+		name     string
+		window   time.Duration
+		input    []in
+		released []string // after each entry
+		flushed  string
+	}{
+		{
+			name:     "in order",
+			window:   5 * time.Second,
+			input:    []in{{"a", 0}, {"b", 3}, {"c", 6}, {"d", 11}},
+			released: []string{"", "", "a", "b c"},
+			flushed:  "d",
+		},
+		{
+			name:     "interleaved",
+			window:   5 * time.Second,
+			input:    []in{{"b", 2}, {"a", 1}, {"d", 4}, {"c", 3}, {"e", 9}},
+			released: []string{"", "", "", "", "a b c d"},
+			flushed:  "e",
+		},
+		{
+			name:     "equal times keep input order",
+			window:   time.Second,
+			input:    []in{{"a", 5}, {"b", 5}, {"c", 5}, {"d", 7}},
+			released: []string{"", "", "", "a b c"},
+			flushed:  "d",
+		},
+		{
+			name:     "later than the window",
+			window:   2 * time.Second,
+			input:    []in{{"a", 10}, {"b", 13}, {"c", 1}},
+			released: []string{"", "a", "c"},
+			flushed:  "b",
+		},
+		{
+			name:     "untimed entries stay behind earlier ones",
+			window:   5 * time.Second,
+			input:    []in{{"x", -1}, {"b", 4}, {"y", -1}, {"a", 2}, {"c", 10}},
+			released: []string{"x", "", "", "", "a b y"},
+			flushed:  "c",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReorderer(tt.window)
+			for i, e := range tt.input {
+				if got := names(r.Process(timedEntry(e.name, e.sec))); got != tt.released[i] {
+					t.Errorf("after %s: released %q, want %q", e.name, got, tt.released[i])
+				}
+			}
+			if got := names(r.Flush()); got != tt.flushed {
+				t.Errorf("flushed %q, want %q", got, tt.flushed)
+			}
+		})
+	}
+}
+
+func TestReorderer_SyslogTimestamps(t *testing.T) {
+	r := NewReorderer(time.Minute)
+	r.now = func() time.Time { return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC) }
+	for _, ts := range []string{"Jan 15 10:30:47", "Jan 15 10:30:45", "Jan 15 10:30:46"} {
+		e := parser.NewEntry(ts)
+		e.Fields["name"] = ts[len(ts)-2:]
+		e.Fields["timestamp"] = ts
+		r.Process(e)
+	}
+	if got := names(r.Flush()); got != "45 46 47" {
+		t.Errorf("got %q, want 45 46 47", got)
+	}
+}
+
+func TestReorderer_BoundsHeldEntries(t *testing.T) {
+	r := NewReorderer(time.Hour)
+	released := 0
+	for i := 0; i < maxReorderHeld+10; i++ {
+		released += len(r.Process(timedEntry(fmt.Sprint(i), i%60)))
+	}
+	if released != 10 || len(r.held) != maxReorderHeld {
+		t.Errorf("released %d and held %d, want 10 and %d", released, len(r.held), maxReorderHeld)
+	}
+}
@@ -0,0 +1,74 @@
+package transform
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// maxSampleKeys bounds the per-key counter map. When exceeded, counters
+// are reset so high-cardinality fields can't grow memory without limit.
+const maxSampleKeys = 100000
+
+// KeySampler downsamples entries per value of a key field.
+// The first N occurrences of each value pass through untouched, so rare
+// values are kept in full; after that only every Nth entry is kept and
+// tagged with _sampleRate so downstream counts can be re-weighted.
+// Entries without the key field are always kept.
+type KeySampler struct {
+	field  string
+	rate   int
+	counts map[string]int
+}
+
+// NewKeySampler creates a sampler from a spec of the form "field:1/N"
+// (a space may be used instead of the colon).
+func NewKeySampler(spec string) (*KeySampler, error) {
+	field, ratio, ok := strings.Cut(spec, ":")
+	if !ok {
+		field, ratio, ok = strings.Cut(spec, " ")
+	}
+	field, ratio = strings.TrimSpace(field), strings.TrimSpace(ratio)
+	if !ok || field == "" {
+		return nil, fmt.Errorf("expected field:1/N, got %q", spec)
+	}
+
+	num, den, ok := strings.Cut(ratio, "/")
+	n, err := strconv.Atoi(den)
+	if !ok || num != "1" || err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid sample ratio %q (expected 1/N)", ratio)
+	}
+
+	return &KeySampler{
+		field:  field,
+		rate:   n,
+		counts: make(map[string]int),
+	}, nil
+}
+
+// Process keeps or drops the entry based on its key's occurrence count.
+func (s *KeySampler) Process(entry *parser.Entry) []*parser.Entry {
+	val, ok := entry.Fields[s.field]
+	if !ok {
+		return []*parser.Entry{entry}
+	}
+
+	if len(s.counts) >= maxSampleKeys {
+		s.counts = make(map[string]int)
+	}
+
+	key := fmt.Sprint(val)
+	s.counts[key]++
+	count := s.counts[key]
+
+	if count <= s.rate {
+		return []*parser.Entry{entry}
+	}
+	if count%s.rate != 0 {
+		return nil
+	}
+	entry.Fields["_sampleRate"] = s.rate
+	return []*parser.Entry{entry}
+}
@@ -0,0 +1,83 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func TestNewKeySampler(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{spec: "path:1/50"},
+		{spec: "path 1/50"},
+		{spec: "path:1/1"},
+		{spec: "path", wantErr: true},
+		{spec: ":1/50", wantErr: true},
+		{spec: "path:2/50", wantErr: true},
+		{spec: "path:1/0", wantErr: true},
+		{spec: "path:1/x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := NewKeySampler(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewKeySampler(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeySampler_Process(t *testing.T) {
+	s, err := NewKeySampler("path:1/10")
+	if err != nil {
+		t.Fatalf("NewKeySampler error: %v", err)
+	}
+
+	kept := map[string]int{}
+	for i := 0; i < 100; i++ {
+		e := parser.NewEntry("hot")
+		e.Fields["path"] = "/healthz"
+		kept["/healthz"] += len(s.Process(e))
+	}
+	for i := 0; i < 5; i++ {
+		e := parser.NewEntry("rare")
+		e.Fields["path"] = "/checkout"
+		kept["/checkout"] += len(s.Process(e))
+	}
+	e := parser.NewEntry("no key")
+	kept["none"] += len(s.Process(e))
+
+	// 10 warm-up entries + every 10th of the remaining 90
+	if kept["/healthz"] != 19 {
+		t.Errorf("hot key kept %d entries, want 19", kept["/healthz"])
+	}
+	if kept["/checkout"] != 5 {
+		t.Errorf("rare key kept %d entries, want 5", kept["/checkout"])
+	}
+	if kept["none"] != 1 {
+		t.Errorf("entry without key kept %d, want 1", kept["none"])
+	}
+}
+
+func TestKeySampler_SampleRateTag(t *testing.T) {
+	s, _ := NewKeySampler("k:1/2")
+
+	var tagged int
+	for i := 0; i < 6; i++ {
+		e := parser.NewEntry("x")
+		e.Fields["k"] = "v"
+		for _, out := range s.Process(e) {
+			if out.Fields["_sampleRate"] == 2 {
+				tagged++
+			}
+		}
+	}
+	// counts 1,2 are warm-up; 4 and 6 are sampled
+	if tagged != 2 {
+		t.Errorf("got %d entries tagged with _sampleRate, want 2", tagged)
+	}
+}
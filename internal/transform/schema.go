@@ -0,0 +1,213 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// Schema describes the expected fields of an entry.
+type Schema struct {
+	// Fields maps field names to expected types (see SchemaField).
+	Fields map[string]SchemaField
+
+	// Strict rejects fields not listed in Fields. Metadata fields
+	// (leading underscore) are always allowed.
+	Strict bool
+}
+
+// SchemaField is the expectation for a single field.
+type SchemaField struct {
+	Type     string // int, float, string, bool, object, array or "" (any)
+	Required bool
+}
+
+// jsonSchemaTypes maps JSON Schema type names to field types.
+var jsonSchemaTypes = map[string]string{
+	"integer": TypeInt,
+	"number":  TypeFloat,
+	"string":  TypeString,
+	"boolean": TypeBool,
+	"object":  "object",
+	"array":   "array",
+}
+
+// LoadSchema reads a schema file. Two formats are accepted:
+//
+// A JSON Schema subset, recognized by a "properties" key:
+//
+//	{"properties": {"status": {"type": "integer"}}, "required": ["status"],
+//	 "additionalProperties": false}
+//
+// Or a simple field list mapping names to types, where a trailing "?"
+// marks the field optional:
+//
+//	{"status": "int", "message": "string", "user": "string?"}
+func LoadSchema(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSchema(data)
+}
+
+// ParseSchema parses schema JSON in either supported format.
+func ParseSchema(data []byte) (*Schema, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid schema JSON: %w", err)
+	}
+	if _, ok := raw["properties"]; ok {
+		return parseJSONSchema(data)
+	}
+	return parseFieldList(raw)
+}
+
+// parseJSONSchema handles the JSON Schema subset.
+func parseJSONSchema(data []byte) (*Schema, error) {
+	var js struct {
+		Properties map[string]struct {
+			Type string `json:"type"`
+		} `json:"properties"`
+		Required             []string `json:"required"`
+		AdditionalProperties *bool    `json:"additionalProperties"`
+	}
+	if err := json.Unmarshal(data, &js); err != nil {
+		return nil, fmt.Errorf("invalid JSON Schema: %w", err)
+	}
+
+	s := &Schema{
+		Fields: make(map[string]SchemaField, len(js.Properties)),
+		Strict: js.AdditionalProperties != nil && !*js.AdditionalProperties,
+	}
+	for name, prop := range js.Properties {
+		typ := ""
+		if prop.Type != "" {
+			var ok bool
+			if typ, ok = jsonSchemaTypes[prop.Type]; !ok {
+				return nil, fmt.Errorf("unsupported type %q for property %q", prop.Type, name)
+			}
+		}
+		s.Fields[name] = SchemaField{Type: typ}
+	}
+	for _, name := range js.Required {
+		f := s.Fields[name]
+		f.Required = true
+		s.Fields[name] = f
+	}
+	return s, nil
+}
+
+// parseFieldList handles the simple {"field": "type"} format.
+func parseFieldList(raw map[string]json.RawMessage) (*Schema, error) {
+	s := &Schema{Fields: make(map[string]SchemaField, len(raw))}
+	for name, msg := range raw {
+		var typeName string
+		if err := json.Unmarshal(msg, &typeName); err != nil {
+			return nil, fmt.Errorf("field %q: type must be a string", name)
+		}
+
+		required := !strings.HasSuffix(typeName, "?")
+		typeName = strings.TrimSuffix(typeName, "?")
+
+		typ, ok := NormalizeType(typeName)
+		if !ok {
+			if typeName != "object" && typeName != "array" && typeName != "any" {
+				return nil, fmt.Errorf("field %q: unknown type %q", name, typeName)
+			}
+			typ = typeName
+			if typ == "any" {
+				typ = ""
+			}
+		}
+		s.Fields[name] = SchemaField{Type: typ, Required: required}
+	}
+	return s, nil
+}
+
+// Validate checks fields against the schema, coercing values to their
+// declared types in place. It returns one message per violation.
+func (s *Schema) Validate(fields map[string]any) []string {
+	var violations []string
+
+	names := make([]string, 0, len(s.Fields))
+	for name := range s.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		want := s.Fields[name]
+		v, ok := fields[name]
+		if !ok {
+			if want.Required {
+				violations = append(violations, fmt.Sprintf("missing required field %q", name))
+			}
+			continue
+		}
+
+		switch want.Type {
+		case "":
+		case "object":
+			if _, ok := v.(map[string]any); !ok {
+				violations = append(violations, fmt.Sprintf("field %q: expected object, got %T", name, v))
+			}
+		case "array":
+			if _, ok := v.([]any); !ok {
+				violations = append(violations, fmt.Sprintf("field %q: expected array, got %T", name, v))
+			}
+		default:
+			converted, ok := Coerce(v, want.Type)
+			if !ok {
+				violations = append(violations, fmt.Sprintf("field %q: cannot convert %v to %s", name, v, want.Type))
+				continue
+			}
+			fields[name] = converted
+		}
+	}
+
+	if s.Strict {
+		var extra []string
+		for name := range fields {
+			if _, ok := s.Fields[name]; !ok && !strings.HasPrefix(name, "_") {
+				extra = append(extra, name)
+			}
+		}
+		sort.Strings(extra)
+		for _, name := range extra {
+			violations = append(violations, fmt.Sprintf("unexpected field %q", name))
+		}
+	}
+
+	return violations
+}
+
+// SchemaValidator enforces a schema on every entry. Entries that conform
+// (after coercion) pass through; violating entries are handed to the
+// reject callback with their violation messages and dropped.
+type SchemaValidator struct {
+	schema *Schema
+	reject func(entry *parser.Entry, violations []string)
+}
+
+// NewSchemaValidator creates a validation stage. reject may be nil, in
+// which case violating entries are silently dropped.
+func NewSchemaValidator(s *Schema, reject func(entry *parser.Entry, violations []string)) *SchemaValidator {
+	return &SchemaValidator{schema: s, reject: reject}
+}
+
+// Process validates the entry.
+func (v *SchemaValidator) Process(entry *parser.Entry) []*parser.Entry {
+	violations := v.schema.Validate(entry.Fields)
+	if len(violations) == 0 {
+		return []*parser.Entry{entry}
+	}
+	if v.reject != nil {
+		v.reject(entry, violations)
+	}
+	return nil
+}
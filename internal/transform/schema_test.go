@@ -0,0 +1,141 @@
+package transform
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func TestParseSchema_FieldList(t *testing.T) {
+	s, err := ParseSchema([]byte(`{"status":"int","message":"string","user":"string?","tags":"array","extra":"any?"}`))
+	if err != nil {
+		t.Fatalf("ParseSchema error: %v", err)
+	}
+
+	want := map[string]SchemaField{
+		"status":  {Type: TypeInt, Required: true},
+		"message": {Type: TypeString, Required: true},
+		"user":    {Type: TypeString},
+		"tags":    {Type: "array", Required: true},
+		"extra":   {},
+	}
+	for name, w := range want {
+		if got := s.Fields[name]; got != w {
+			t.Errorf("Fields[%s] = %+v, want %+v", name, got, w)
+		}
+	}
+	if s.Strict {
+		t.Error("field list schema should not be strict")
+	}
+}
+
+func TestParseSchema_JSONSchema(t *testing.T) {
+	s, err := ParseSchema([]byte(`{
+		"type": "object",
+		"properties": {"status": {"type": "integer"}, "msg": {"type": "string"}, "any": {}},
+		"required": ["status"],
+		"additionalProperties": false
+	}`))
+	if err != nil {
+		t.Fatalf("ParseSchema error: %v", err)
+	}
+
+	if got := s.Fields["status"]; got != (SchemaField{Type: TypeInt, Required: true}) {
+		t.Errorf("status = %+v", got)
+	}
+	if got := s.Fields["msg"]; got != (SchemaField{Type: TypeString}) {
+		t.Errorf("msg = %+v", got)
+	}
+	if !s.Strict {
+		t.Error("expected strict schema with additionalProperties=false")
+	}
+}
+
+func TestParseSchema_Errors(t *testing.T) {
+	tests := []string{
+		`not json`,
+		`{"status": 5}`,
+		`{"status": "decimal"}`,
+		`{"properties": {"a": {"type": "date"}}}`,
+	}
+	for _, src := range tests {
+		if _, err := ParseSchema([]byte(src)); err == nil {
+			t.Errorf("ParseSchema(%s) expected error", src)
+		}
+	}
+}
+
+func TestSchema_Validate(t *testing.T) {
+	s := &Schema{
+		Fields: map[string]SchemaField{
+			"status": {Type: TypeInt, Required: true},
+			"msg":    {Type: TypeString},
+		},
+		Strict: true,
+	}
+
+	fields := map[string]any{"status": "503", "msg": "x", "_lineNumber": 1}
+	if v := s.Validate(fields); len(v) != 0 {
+		t.Errorf("unexpected violations: %v", v)
+	}
+	if fields["status"] != int64(503) {
+		t.Errorf("status not coerced: %v (%T)", fields["status"], fields["status"])
+	}
+
+	v := s.Validate(map[string]any{"status": "abc", "other": 1})
+	if len(v) != 2 {
+		t.Fatalf("got %d violations, want 2: %v", len(v), v)
+	}
+	if !strings.Contains(v[0], "cannot convert") || !strings.Contains(v[1], "unexpected field") {
+		t.Errorf("unexpected violation messages: %v", v)
+	}
+
+	v = s.Validate(map[string]any{})
+	if len(v) != 1 || !strings.Contains(v[0], "missing required") {
+		t.Errorf("expected missing field violation, got %v", v)
+	}
+}
+
+func TestSchemaValidator_Process(t *testing.T) {
+	s := &Schema{Fields: map[string]SchemaField{"status": {Type: TypeInt, Required: true}}}
+
+	var rejected []string
+	v := NewSchemaValidator(s, func(e *parser.Entry, violations []string) {
+		rejected = append(rejected, violations...)
+	})
+
+	good := parser.NewEntry("ok")
+	good.Fields["status"] = 200
+	if len(v.Process(good)) != 1 {
+		t.Error("valid entry should pass")
+	}
+
+	bad := parser.NewEntry("bad")
+	if len(v.Process(bad)) != 0 {
+		t.Error("invalid entry should be dropped")
+	}
+	if len(rejected) != 1 {
+		t.Errorf("reject callback got %v, want one violation", rejected)
+	}
+}
+
+func TestLoadSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(path, []byte(`{"level":"string"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadSchema(path)
+	if err != nil {
+		t.Fatalf("LoadSchema error: %v", err)
+	}
+	if _, ok := s.Fields["level"]; !ok {
+		t.Error("expected level field in schema")
+	}
+
+	if _, err := LoadSchema(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
@@ -0,0 +1,71 @@
+package transform
+
+import (
+	"fmt"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+	"github.com/juliosaraiva/log2json/internal/script"
+)
+
+// ScriptFunc is the function a transform script must define.
+const ScriptFunc = "transform"
+
+// Script runs a user-provided transform(entry) function on each entry.
+// The function receives the field map and returns:
+//
+//   - a dict, which replaces the entry's fields
+//   - a list of dicts, which emits one entry per element
+//   - None, which drops the entry
+//
+// If the script fails, the entry passes through unchanged apart from a
+// _scriptError field describing the failure.
+type Script struct {
+	script *script.Script
+}
+
+// NewScript loads a transform script from path.
+func NewScript(path string, opts ...script.Option) (*Script, error) {
+	s, err := script.Load(path, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Has(ScriptFunc) {
+		return nil, fmt.Errorf("%s: script must define %s(entry)", path, ScriptFunc)
+	}
+	return &Script{script: s}, nil
+}
+
+// Process calls the script's transform function.
+func (s *Script) Process(entry *parser.Entry) []*parser.Entry {
+	result, err := s.script.Call(ScriptFunc, entry.Fields)
+	if err != nil {
+		entry.Fields["_scriptError"] = err.Error()
+		return []*parser.Entry{entry}
+	}
+
+	switch v := result.(type) {
+	case nil:
+		return nil
+
+	case map[string]any:
+		entry.Fields = v
+		return []*parser.Entry{entry}
+
+	case []any:
+		out := make([]*parser.Entry, 0, len(v))
+		for i, elem := range v {
+			fields, ok := elem.(map[string]any)
+			if !ok {
+				entry.Fields["_scriptError"] = fmt.Sprintf("%s returned a list whose element %d is not a dict", ScriptFunc, i)
+				return []*parser.Entry{entry}
+			}
+			e := *entry
+			e.Fields = fields
+			out = append(out, &e)
+		}
+		return out
+	}
+
+	entry.Fields["_scriptError"] = fmt.Sprintf("%s must return a dict, a list of dicts or None", ScriptFunc)
+	return []*parser.Entry{entry}
+}
@@ -0,0 +1,130 @@
+package transform
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func writeScript(t *testing.T, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "transform.star")
+	if err := os.WriteFile(path, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantErr bool
+	}{
+		{name: "valid", src: "def transform(entry):\n    return entry\n"},
+		{name: "missing transform", src: "def other(entry):\n    return entry\n", wantErr: true},
+		{name: "syntax error", src: "def transform(entry)\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewScript(writeScript(t, tt.src))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewScript() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScript_Process(t *testing.T) {
+	src := `
+def transform(entry):
+    kind = entry.get("kind")
+    if kind == "drop":
+        return None
+    if kind == "split":
+        out = []
+        for p in entry["msg"].split(","):
+            out.append({"part": p})
+        return out
+    if kind == "bad":
+        return 42
+    if kind == "badlist":
+        return [1]
+    if kind == "fail":
+        return entry["missing"]
+    entry["msg"] = entry["msg"].upper()
+    entry["len"] = len(entry["msg"])
+    return entry
+`
+	s, err := NewScript(writeScript(t, src))
+	if err != nil {
+		t.Fatalf("NewScript() error: %v", err)
+	}
+
+	newEntry := func(kind, msg string) *parser.Entry {
+		e := parser.NewEntry("raw")
+		e.LineNum = 7
+		e.Fields["kind"] = kind
+		e.Fields["msg"] = msg
+		return e
+	}
+
+	t.Run("reshape", func(t *testing.T) {
+		out := s.Process(newEntry("keep", "hello"))
+		if len(out) != 1 {
+			t.Fatalf("Process() returned %d entries, want 1", len(out))
+		}
+		if out[0].Fields["msg"] != "HELLO" || out[0].Fields["len"] != int64(5) {
+			t.Errorf("fields = %v", out[0].Fields)
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		if out := s.Process(newEntry("drop", "x")); len(out) != 0 {
+			t.Errorf("Process() returned %d entries, want 0", len(out))
+		}
+	})
+
+	t.Run("split", func(t *testing.T) {
+		out := s.Process(newEntry("split", "a,b,c"))
+		if len(out) != 3 {
+			t.Fatalf("Process() returned %d entries, want 3", len(out))
+		}
+		for i, want := range []string{"a", "b", "c"} {
+			if out[i].Fields["part"] != want {
+				t.Errorf("entry %d part = %v, want %s", i, out[i].Fields["part"], want)
+			}
+			if out[i].Raw != "raw" || out[i].LineNum != 7 {
+				t.Errorf("entry %d lost Raw/LineNum: %q/%d", i, out[i].Raw, out[i].LineNum)
+			}
+		}
+	})
+
+	errorCases := []struct {
+		kind    string
+		wantErr string
+	}{
+		{kind: "bad", wantErr: "must return"},
+		{kind: "badlist", wantErr: "not a dict"},
+		{kind: "fail", wantErr: "not found"},
+	}
+	for _, tc := range errorCases {
+		t.Run(tc.kind, func(t *testing.T) {
+			out := s.Process(newEntry(tc.kind, "x"))
+			if len(out) != 1 {
+				t.Fatalf("Process() returned %d entries, want 1", len(out))
+			}
+			msg, _ := out[0].Fields["_scriptError"].(string)
+			if !strings.Contains(msg, tc.wantErr) {
+				t.Errorf("_scriptError = %q, want it to contain %q", msg, tc.wantErr)
+			}
+			if out[0].Fields["msg"] != "x" {
+				t.Errorf("fields should pass through unchanged, got %v", out[0].Fields)
+			}
+		})
+	}
+}
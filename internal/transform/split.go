@@ -0,0 +1,52 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// Splitter turns a delimiter-joined string field ("a,b,c") into an array.
+// Items are trimmed of surrounding whitespace and empty items dropped, so
+// "10.0.0.1, 10.0.0.2" yields two addresses.
+type Splitter struct {
+	field string
+	delim string
+}
+
+// NewSplitter creates a Splitter from a spec of the form "field[:delim]".
+// The delimiter defaults to a comma and is used verbatim, so "path: "
+// splits on spaces.
+func NewSplitter(spec string) (*Splitter, error) {
+	field, delim, ok := strings.Cut(spec, ":")
+	field = strings.TrimSpace(field)
+	if field == "" {
+		return nil, fmt.Errorf("expected field[:delimiter], got %q", spec)
+	}
+	if !ok {
+		delim = ","
+	}
+	if delim == "" {
+		return nil, fmt.Errorf("empty delimiter in %q", spec)
+	}
+	return &Splitter{field: field, delim: delim}, nil
+}
+
+// Process splits the field in place. Non-string values are left alone.
+func (s *Splitter) Process(entry *parser.Entry) []*parser.Entry {
+	v, ok := entry.Fields[s.field].(string)
+	if !ok {
+		return []*parser.Entry{entry}
+	}
+
+	parts := strings.Split(v, s.delim)
+	items := make([]any, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			items = append(items, p)
+		}
+	}
+	entry.Fields[s.field] = items
+	return []*parser.Entry{entry}
+}
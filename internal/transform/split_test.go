@@ -0,0 +1,68 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func TestNewSplitter(t *testing.T) {
+	tests := []struct {
+		spec      string
+		wantField string
+		wantDelim string
+		wantErr   bool
+	}{
+		{spec: "tags", wantField: "tags", wantDelim: ","},
+		{spec: "tags:,", wantField: "tags", wantDelim: ","},
+		{spec: "path: ", wantField: "path", wantDelim: " "},
+		{spec: "chain:->", wantField: "chain", wantDelim: "->"},
+		{spec: "tags:", wantErr: true},
+		{spec: ":,", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := NewSplitter(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSplitter(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if err == nil && (s.field != tt.wantField || s.delim != tt.wantDelim) {
+				t.Errorf("NewSplitter(%q) = %q, %q", tt.spec, s.field, s.delim)
+			}
+		})
+	}
+}
+
+func TestSplitter_Process(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  string
+		value any
+		want  any
+	}{
+		{name: "comma list", spec: "f:,", value: "a,b,c", want: []any{"a", "b", "c"}},
+		{name: "forwarded chain", spec: "f", value: "10.0.0.1, 10.0.0.2", want: []any{"10.0.0.1", "10.0.0.2"}},
+		{name: "empty items dropped", spec: "f", value: "a,,b,", want: []any{"a", "b"}},
+		{name: "single value", spec: "f", value: "a", want: []any{"a"}},
+		{name: "empty string", spec: "f", value: "", want: []any{}},
+		{name: "multi-char delimiter", spec: "f:|", value: "x|y", want: []any{"x", "y"}},
+		{name: "not a string", spec: "f", value: int64(3), want: int64(3)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSplitter(tt.spec)
+			if err != nil {
+				t.Fatalf("NewSplitter() error: %v", err)
+			}
+			entry := parser.NewEntry("")
+			entry.Fields["f"] = tt.value
+			s.Process(entry)
+			if !reflect.DeepEqual(entry.Fields["f"], tt.want) {
+				t.Errorf("f = %#v, want %#v", entry.Fields["f"], tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package transform
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// timestampLayouts are tried in order when reading a timestamp string.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"02/Jan/2006:15:04:05 -0700",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// ParseTimestamp reads a timestamp string in a common layout, or epoch
+// seconds, milliseconds or nanoseconds. Times without a zone are UTC.
+func ParseTimestamp(v any) (time.Time, bool) {
+	switch x := v.(type) {
+	case string:
+		for _, layout := range timestampLayouts {
+			if t, err := time.Parse(layout, x); err == nil {
+				return t, true
+			}
+		}
+		if n, err := strconv.ParseFloat(x, 64); err == nil {
+			return epochTime(n)
+		}
+	case int64:
+		return epochTime(float64(x))
+	case int:
+		return epochTime(float64(x))
+	case float64:
+		return epochTime(x)
+	}
+	return time.Time{}, false
+}
+
+// epochTime interprets n by magnitude as seconds, milliseconds,
+// microseconds or nanoseconds since the epoch.
+func epochTime(n float64) (time.Time, bool) {
+	switch {
+	case n <= 0 || math.IsInf(n, 0) || math.IsNaN(n):
+		return time.Time{}, false
+	case n < 1e11:
+		return time.Unix(0, int64(n*1e9)), true
+	case n < 1e14:
+		return time.Unix(0, int64(n*1e6)), true
+	case n < 1e17:
+		return time.Unix(0, int64(n*1e3)), true
+	}
+	return time.Unix(0, int64(n)), true
+}
+
+// ParseSyslogTime reads a timestamp like ParseTimestamp does, and also
+// the RFC 3164 form "Jan 15 10:30:45", which has no year: it is taken to
+// be in the year before now's if it would otherwise be in the future.
+func ParseSyslogTime(v any, now time.Time) (time.Time, bool) {
+	if t, ok := ParseTimestamp(v); ok {
+		return t, true
+	}
+	s, ok := v.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(time.Stamp, s, now.Location())
+	if err != nil {
+		return time.Time{}, false
+	}
+	t = t.AddDate(now.Year(), 0, 0)
+	if t.After(now.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t, true
+}
+
+// EntryTime reads the entry's time from the first of TimestampFields that
+// holds one, as ParseSyslogTime reads it.
+func EntryTime(entry *parser.Entry, now time.Time) (time.Time, bool) {
+	for _, f := range TimestampFields {
+		if v, ok := entry.Fields[f]; ok {
+			if t, ok := ParseSyslogTime(v, now); ok {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
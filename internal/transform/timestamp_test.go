@@ -0,0 +1,32 @@
+package transform
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	want := time.Date(2024, 1, 15, 10, 30, 45, 0, time.UTC)
+	tests := []any{
+		"2024-01-15T10:30:45Z",
+		"2024-01-15 10:30:45",
+		"2024-01-15T12:30:45+02:00",
+		"15/Jan/2024:10:30:45 +0000",
+		"1705314645",
+		int64(1705314645),
+		float64(1705314645000),
+		int64(1705314645000000),
+		int64(1705314645000000000),
+	}
+	for _, v := range tests {
+		got, ok := ParseTimestamp(v)
+		if !ok || !got.Equal(want) {
+			t.Errorf("ParseTimestamp(%v) = %v, %v, want %v", v, got, ok, want)
+		}
+	}
+	for _, v := range []any{"yesterday", true, nil, float64(-1)} {
+		if _, ok := ParseTimestamp(v); ok {
+			t.Errorf("ParseTimestamp(%v) succeeded", v)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Package transform provides per-entry processing stages that run between
+// the parser and the emitter (enrichment, filtering, redaction, etc.).
+package transform
+
+import (
+	"fmt"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// Stage is a single step in the transform pipeline.
+// Process receives one parsed entry and returns the entries to pass on to
+// the next stage. Returning nil drops the entry; stages that aggregate or
+// split records may return more than one.
+type Stage interface {
+	Process(entry *parser.Entry) []*parser.Entry
+}
+
+// Flusher is implemented by stages that hold entries back (buffering,
+// aggregation). Flush is called once at end of input and returns any
+// entries still pending.
+type Flusher interface {
+	Flush() []*parser.Entry
+}
+
+// Chain runs entries through an ordered list of stages.
+type Chain struct {
+	stages []Stage
+}
+
+// NewChain creates a chain from the given stages, applied in order.
+func NewChain(stages ...Stage) *Chain {
+	return &Chain{stages: stages}
+}
+
+// Add appends a stage to the end of the chain.
+func (c *Chain) Add(s Stage) {
+	c.stages = append(c.stages, s)
+}
+
+// Len returns the number of stages in the chain.
+func (c *Chain) Len() int {
+	return len(c.stages)
+}
+
+// Holds reports whether any stage may keep entries after Process returns
+// them or drops them: those are the Flushers, which hold entries back.
+func (c *Chain) Holds() bool {
+	for _, s := range c.stages {
+		if _, ok := s.(Flusher); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Process runs an entry through every stage and returns the surviving entries.
+func (c *Chain) Process(entry *parser.Entry) []*parser.Entry {
+	return c.processFrom(0, []*parser.Entry{entry})
+}
+
+// Flush drains buffering stages in order. Entries released by a stage
+// still pass through the stages that follow it.
+func (c *Chain) Flush() []*parser.Entry {
+	var out []*parser.Entry
+	for i, s := range c.stages {
+		f, ok := s.(Flusher)
+		if !ok {
+			continue
+		}
+		if pending := flush(f); len(pending) > 0 {
+			out = append(out, c.processFrom(i+1, pending)...)
+		}
+	}
+	return out
+}
+
+// processFrom runs entries through stages starting at index start.
+func (c *Chain) processFrom(start int, entries []*parser.Entry) []*parser.Entry {
+	for _, s := range c.stages[start:] {
+		var next []*parser.Entry
+		for _, e := range entries {
+			next = append(next, process(s, e)...)
+		}
+		if len(next) == 0 {
+			return nil
+		}
+		entries = next
+	}
+	return entries
+}
+
+// process runs an entry through s. If s panics, the entry is passed on as
+// it is, with the panic in a _transformError field, so that one
+// pathological entry, or a bug in a script or plugin, fails alone instead
+// of stopping the run.
+func process(s Stage, e *parser.Entry) (out []*parser.Entry) {
+	defer func() {
+		if v := recover(); v != nil {
+			e.Fields["_transformError"] = fmt.Sprintf("panic: %v", v)
+			out = []*parser.Entry{e}
+		}
+	}()
+	return s.Process(e)
+}
+
+// flush drains f; the entries of a Flush that panics are lost.
+func flush(f Flusher) (out []*parser.Entry) {
+	defer func() {
+		if recover() != nil {
+			out = nil
+		}
+	}()
+	return f.Flush()
+}
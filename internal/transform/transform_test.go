@@ -0,0 +1,146 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// dropStage drops entries whose "drop" field is true.
+type dropStage struct{}
+
+func (dropStage) Process(e *parser.Entry) []*parser.Entry {
+	if e.Fields["drop"] == true {
+		return nil
+	}
+	return []*parser.Entry{e}
+}
+
+// dupStage emits every entry twice.
+type dupStage struct{}
+
+func (dupStage) Process(e *parser.Entry) []*parser.Entry {
+	return []*parser.Entry{e, e}
+}
+
+// holdStage buffers every entry until Flush.
+type holdStage struct{ held []*parser.Entry }
+
+func (h *holdStage) Process(e *parser.Entry) []*parser.Entry {
+	h.held = append(h.held, e)
+	return nil
+}
+
+func (h *holdStage) Flush() []*parser.Entry {
+	out := h.held
+	h.held = nil
+	return out
+}
+
+// panicStage panics on entries whose "panic" field is true, and in Flush.
+type panicStage struct{}
+
+func (panicStage) Process(e *parser.Entry) []*parser.Entry {
+	if e.Fields["panic"] == true {
+		var m map[string]int
+		m["boom"]++
+	}
+	return []*parser.Entry{e}
+}
+
+func (panicStage) Flush() []*parser.Entry {
+	panic("flush failed")
+}
+
+func TestChain_Process(t *testing.T) {
+	tests := []struct {
+		name   string
+		stages []Stage
+		drop   bool
+		want   int
+	}{
+		{name: "empty chain passes through", stages: nil, want: 1},
+		{name: "drop stage removes entry", stages: []Stage{dropStage{}}, drop: true, want: 0},
+		{name: "dup stage doubles entry", stages: []Stage{dupStage{}}, want: 2},
+		{name: "dup then dup", stages: []Stage{dupStage{}, dupStage{}}, want: 4},
+		{name: "drop short-circuits later stages", stages: []Stage{dropStage{}, dupStage{}}, drop: true, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChain(tt.stages...)
+			e := parser.NewEntry("x")
+			e.Fields["drop"] = tt.drop
+			if got := len(c.Process(e)); got != tt.want {
+				t.Errorf("Process() returned %d entries, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChain_Flush(t *testing.T) {
+	hold := &holdStage{}
+	c := NewChain(hold, dupStage{})
+
+	if out := c.Process(parser.NewEntry("a")); len(out) != 0 {
+		t.Fatalf("Process() returned %d entries, want 0 while held", len(out))
+	}
+
+	// Flushed entries must still run through the stages after the buffer.
+	if out := c.Flush(); len(out) != 2 {
+		t.Errorf("Flush() returned %d entries, want 2", len(out))
+	}
+	if out := c.Flush(); len(out) != 0 {
+		t.Errorf("second Flush() returned %d entries, want 0", len(out))
+	}
+}
+
+func TestChain_Add(t *testing.T) {
+	c := NewChain()
+	c.Add(dupStage{})
+	if c.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", c.Len())
+	}
+}
+
+func TestChain_Holds(t *testing.T) {
+	tests := []struct {
+		name   string
+		stages []Stage
+		want   bool
+	}{
+		{"empty", nil, false},
+		{"no buffering stage", []Stage{dropStage{}, dupStage{}}, false},
+		{"buffering stage", []Stage{dupStage{}, &holdStage{}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewChain(tt.stages...).Holds(); got != tt.want {
+				t.Errorf("Holds() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChain_RecoversFromPanics(t *testing.T) {
+	c := NewChain(panicStage{}, dupStage{})
+
+	e := parser.NewEntry("x")
+	e.Fields["panic"] = true
+	out := c.Process(e)
+	if len(out) != 2 || out[0] != e {
+		t.Fatalf("Process() returned %v, want the entry passed on", out)
+	}
+	if got, want := e.Fields["_transformError"], "panic: assignment to entry in nil map"; got != want {
+		t.Errorf("_transformError = %v, want %q", got, want)
+	}
+
+	ok := parser.NewEntry("y")
+	if out := c.Process(ok); len(out) != 2 || ok.Fields["_transformError"] != nil {
+		t.Errorf("Process() = %v, %v; want the entry untouched", out, ok.Fields)
+	}
+	if out := c.Flush(); len(out) != 0 {
+		t.Errorf("Flush() returned %d entries, want 0", len(out))
+	}
+}
@@ -0,0 +1,64 @@
+package transform
+
+import (
+	"sort"
+	"unicode/utf8"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// Truncator bounds the size of an entry: string values longer than
+// maxBytes are cut (on a UTF-8 boundary) and listed in _truncatedFields,
+// and entries with more than maxFields fields keep the first maxFields
+// in key order, recording the number removed in _omittedFields (which is
+// not counted against maxFields). A zero limit disables that check.
+type Truncator struct {
+	maxBytes  int
+	maxFields int
+}
+
+// NewTruncator creates a truncation stage.
+func NewTruncator(maxBytes, maxFields int) *Truncator {
+	return &Truncator{maxBytes: maxBytes, maxFields: maxFields}
+}
+
+// Process applies the size limits to the entry in place.
+func (t *Truncator) Process(entry *parser.Entry) []*parser.Entry {
+	if t.maxFields > 0 && len(entry.Fields) > t.maxFields {
+		keys := make([]string, 0, len(entry.Fields))
+		for k := range entry.Fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys[t.maxFields:] {
+			delete(entry.Fields, k)
+		}
+		entry.Fields["_omittedFields"] = len(keys) - t.maxFields
+	}
+
+	if t.maxBytes > 0 {
+		var truncated []string
+		for k, v := range entry.Fields {
+			s, ok := v.(string)
+			if !ok || len(s) <= t.maxBytes {
+				continue
+			}
+			entry.Fields[k] = truncateUTF8(s, t.maxBytes)
+			truncated = append(truncated, k)
+		}
+		if len(truncated) > 0 {
+			sort.Strings(truncated)
+			entry.Fields["_truncatedFields"] = truncated
+		}
+	}
+
+	return []*parser.Entry{entry}
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a rune.
+func truncateUTF8(s string, n int) string {
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
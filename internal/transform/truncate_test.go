@@ -0,0 +1,81 @@
+package transform
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func TestTruncator_MaxBytes(t *testing.T) {
+	tr := NewTruncator(5, 0)
+
+	e := parser.NewEntry("x")
+	e.Fields["message"] = "hello world"
+	e.Fields["short"] = "hi"
+	e.Fields["num"] = 1234567
+
+	tr.Process(e)
+
+	if e.Fields["message"] != "hello" {
+		t.Errorf("message = %q, want %q", e.Fields["message"], "hello")
+	}
+	if e.Fields["short"] != "hi" {
+		t.Errorf("short = %q, want hi", e.Fields["short"])
+	}
+	marker, ok := e.Fields["_truncatedFields"].([]string)
+	if !ok || len(marker) != 1 || marker[0] != "message" {
+		t.Errorf("_truncatedFields = %v, want [message]", e.Fields["_truncatedFields"])
+	}
+}
+
+func TestTruncator_UTF8Boundary(t *testing.T) {
+	tr := NewTruncator(4, 0)
+
+	e := parser.NewEntry("x")
+	e.Fields["msg"] = "aé€b" // a(1) é(2) €(3) b(1)
+
+	tr.Process(e)
+
+	if e.Fields["msg"] != "aé" {
+		t.Errorf("msg = %q, want %q (no split rune)", e.Fields["msg"], "aé")
+	}
+}
+
+func TestTruncator_MaxFields(t *testing.T) {
+	tr := NewTruncator(0, 3)
+
+	e := parser.NewEntry("x")
+	for _, k := range strings.Split("a,b,c,d,e", ",") {
+		e.Fields[k] = k
+	}
+
+	tr.Process(e)
+
+	for _, k := range []string{"a", "b", "c"} {
+		if _, ok := e.Fields[k]; !ok {
+			t.Errorf("expected field %s to be kept", k)
+		}
+	}
+	for _, k := range []string{"d", "e"} {
+		if _, ok := e.Fields[k]; ok {
+			t.Errorf("expected field %s to be removed", k)
+		}
+	}
+	if e.Fields["_omittedFields"] != 2 {
+		t.Errorf("_omittedFields = %v, want 2", e.Fields["_omittedFields"])
+	}
+}
+
+func TestTruncator_UnderLimits(t *testing.T) {
+	tr := NewTruncator(100, 10)
+
+	e := parser.NewEntry("x")
+	e.Fields["msg"] = "ok"
+
+	tr.Process(e)
+
+	if len(e.Fields) != 1 {
+		t.Errorf("expected entry unchanged, got %v", e.Fields)
+	}
+}
@@ -0,0 +1,122 @@
+package transform
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+// Suffixes of the fields added by UnitParser.
+const (
+	SuffixDuration = "_ms"
+	SuffixSize     = "_bytes"
+	SuffixPercent  = "_percent"
+)
+
+// sizeUnits maps size suffixes (lowercase) to bytes. KB, MB... are
+// decimal; KiB, MiB... are binary.
+var sizeUnits = map[string]float64{
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"pb":  1e15,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+	"pib": 1 << 50,
+}
+
+// unitPattern matches a number followed directly by a unit.
+var unitPattern = regexp.MustCompile(`^([+-]?(?:\d+\.?\d*|\.\d+))([a-zA-Zµ%]+)$`)
+
+// UnitParser converts unit-suffixed string values into numbers, added
+// alongside the original field:
+//
+//	latency=1.2s   ->  latency_ms=1200
+//	resp=3KB       ->  resp_bytes=3000
+//	cpu=15%        ->  cpu_percent=15
+//
+// Durations accept Go's units (ns, us, µs, ms, s, m, h) including
+// compound values like 1m30s. Existing fields are never overwritten.
+type UnitParser struct {
+	fields map[string]bool // nil means all string fields
+}
+
+// NewUnitParser creates a UnitParser for the given fields, or for every
+// string field if none are given.
+func NewUnitParser(fields ...string) *UnitParser {
+	u := &UnitParser{}
+	if len(fields) > 0 {
+		u.fields = make(map[string]bool, len(fields))
+		for _, f := range fields {
+			u.fields[f] = true
+		}
+	}
+	return u
+}
+
+// Process adds normalized numeric fields.
+func (u *UnitParser) Process(entry *parser.Entry) []*parser.Entry {
+	var added map[string]any
+	for k, v := range entry.Fields {
+		if u.fields != nil && !u.fields[k] {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		suffix, n, ok := ParseUnit(s)
+		if !ok {
+			continue
+		}
+		if _, exists := entry.Fields[k+suffix]; exists {
+			continue
+		}
+		if added == nil {
+			added = make(map[string]any)
+		}
+		added[k+suffix] = n
+	}
+	for k, v := range added {
+		entry.Fields[k] = v
+	}
+	return []*parser.Entry{entry}
+}
+
+// ParseUnit parses a unit-suffixed value, returning the suffix of the
+// field it belongs in (SuffixDuration, SuffixSize or SuffixPercent) and
+// the value in milliseconds, bytes or percent.
+func ParseUnit(s string) (suffix string, value float64, ok bool) {
+	m := unitPattern.FindStringSubmatch(s)
+	if m == nil {
+		// Compound durations such as 1h30m
+		if d, err := time.ParseDuration(s); err == nil && strings.ContainsAny(s, "hms") {
+			return SuffixDuration, float64(d) / float64(time.Millisecond), true
+		}
+		return "", 0, false
+	}
+
+	num, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return "", 0, false
+	}
+	unit := m[2]
+
+	if unit == "%" {
+		return SuffixPercent, num, true
+	}
+	if mult, ok := sizeUnits[strings.ToLower(unit)]; ok {
+		return SuffixSize, num * mult, true
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return SuffixDuration, float64(d) / float64(time.Millisecond), true
+	}
+	return "", 0, false
+}
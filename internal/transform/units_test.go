@@ -0,0 +1,95 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+)
+
+func TestParseUnit(t *testing.T) {
+	tests := []struct {
+		in         string
+		wantSuffix string
+		want       float64
+		wantOK     bool
+	}{
+		{in: "5ms", wantSuffix: SuffixDuration, want: 5, wantOK: true},
+		{in: "1.2s", wantSuffix: SuffixDuration, want: 1200, wantOK: true},
+		{in: "250us", wantSuffix: SuffixDuration, want: 0.25, wantOK: true},
+		{in: "250µs", wantSuffix: SuffixDuration, want: 0.25, wantOK: true},
+		{in: "2m", wantSuffix: SuffixDuration, want: 120000, wantOK: true},
+		{in: "1m30s", wantSuffix: SuffixDuration, want: 90000, wantOK: true},
+		{in: "3KB", wantSuffix: SuffixSize, want: 3000, wantOK: true},
+		{in: "3KiB", wantSuffix: SuffixSize, want: 3072, wantOK: true},
+		{in: "1.5mb", wantSuffix: SuffixSize, want: 1.5e6, wantOK: true},
+		{in: "512B", wantSuffix: SuffixSize, want: 512, wantOK: true},
+		{in: "15%", wantSuffix: SuffixPercent, want: 15, wantOK: true},
+		{in: "-0.5%", wantSuffix: SuffixPercent, want: -0.5, wantOK: true},
+		{in: "42"},
+		{in: "5 ms"},
+		{in: "5xyz"},
+		{in: "ms"},
+		{in: "v1.2s"},
+		{in: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			suffix, got, ok := ParseUnit(tt.in)
+			if ok != tt.wantOK {
+				t.Fatalf("ParseUnit(%q) ok = %v, want %v", tt.in, ok, tt.wantOK)
+			}
+			if suffix != tt.wantSuffix || got != tt.want {
+				t.Errorf("ParseUnit(%q) = %q, %v, want %q, %v", tt.in, suffix, got, tt.wantSuffix, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnitParser_Process(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []string
+		in     map[string]any
+		want   map[string]any
+	}{
+		{
+			name: "all fields",
+			in:   map[string]any{"latency": "5ms", "size": "3KB", "cpu": "15%", "msg": "ok", "n": int64(5)},
+			want: map[string]any{
+				"latency": "5ms", "latency_ms": float64(5),
+				"size": "3KB", "size_bytes": float64(3000),
+				"cpu": "15%", "cpu_percent": float64(15),
+				"msg": "ok", "n": int64(5),
+			},
+		},
+		{
+			name:   "selected fields",
+			fields: []string{"latency"},
+			in:     map[string]any{"latency": "5ms", "size": "3KB"},
+			want:   map[string]any{"latency": "5ms", "latency_ms": float64(5), "size": "3KB"},
+		},
+		{
+			name: "existing field kept",
+			in:   map[string]any{"latency": "5ms", "latency_ms": "original"},
+			want: map[string]any{"latency": "5ms", "latency_ms": "original"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := parser.NewEntry("")
+			entry.Fields = tt.in
+			NewUnitParser(tt.fields...).Process(entry)
+
+			if len(entry.Fields) != len(tt.want) {
+				t.Fatalf("Fields = %v, want %v", entry.Fields, tt.want)
+			}
+			for k, v := range tt.want {
+				if entry.Fields[k] != v {
+					t.Errorf("Fields[%q] = %v (%T), want %v", k, entry.Fields[k], entry.Fields[k], v)
+				}
+			}
+		})
+	}
+}
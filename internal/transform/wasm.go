@@ -0,0 +1,80 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+	"github.com/juliosaraiva/log2json/internal/wasm"
+)
+
+// Wasm passes each entry through a WebAssembly plugin's transform
+// function. The plugin receives the fields as a JSON object and returns:
+//
+//   - an object, which replaces the entry's fields
+//   - an array of objects, which emits one entry per element
+//   - null or nothing, which drops the entry
+//
+// If the plugin traps or returns anything else, the entry passes through
+// unchanged apart from a _wasmError field describing the failure.
+type Wasm struct {
+	plugin *wasm.Plugin
+}
+
+// NewWasm creates a transform stage backed by plugin.
+func NewWasm(plugin *wasm.Plugin) (*Wasm, error) {
+	if !plugin.HasTransform() {
+		return nil, fmt.Errorf("plugin does not export %s", wasm.PluginTransform)
+	}
+	return &Wasm{plugin: plugin}, nil
+}
+
+// Process calls the plugin's transform function.
+func (w *Wasm) Process(entry *parser.Entry) []*parser.Entry {
+	input, err := json.Marshal(entry.Fields)
+	if err != nil {
+		entry.Fields["_wasmError"] = err.Error()
+		return []*parser.Entry{entry}
+	}
+
+	output, err := w.plugin.Transform(input)
+	if err != nil {
+		entry.Fields["_wasmError"] = err.Error()
+		return []*parser.Entry{entry}
+	}
+	if output == nil {
+		return nil
+	}
+
+	var result any
+	if err := json.Unmarshal(output, &result); err != nil {
+		entry.Fields["_wasmError"] = fmt.Sprintf("%s returned invalid JSON: %v", wasm.PluginTransform, err)
+		return []*parser.Entry{entry}
+	}
+
+	switch v := result.(type) {
+	case nil:
+		return nil
+
+	case map[string]any:
+		entry.Fields = v
+		return []*parser.Entry{entry}
+
+	case []any:
+		out := make([]*parser.Entry, 0, len(v))
+		for i, elem := range v {
+			fields, ok := elem.(map[string]any)
+			if !ok {
+				entry.Fields["_wasmError"] = fmt.Sprintf("%s returned an array whose element %d is not an object", wasm.PluginTransform, i)
+				return []*parser.Entry{entry}
+			}
+			e := *entry
+			e.Fields = fields
+			out = append(out, &e)
+		}
+		return out
+	}
+
+	entry.Fields["_wasmError"] = fmt.Sprintf("%s must return an object, an array of objects or null", wasm.PluginTransform)
+	return []*parser.Entry{entry}
+}
@@ -0,0 +1,116 @@
+package transform
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/juliosaraiva/log2json/internal/parser"
+	"github.com/juliosaraiva/log2json/internal/wasm"
+)
+
+// Test plugins, assembled by internal/wasm's test helpers. Each has a
+// bump allocator and a transform function that:
+var testPlugins = map[string]string{
+	// returns its input
+	"echo": "0061736d0100000001110360017f017f60027f7f017e60027f7f00020b0103656e76036c6f67000203040300010105030100010607017f014180080b072604066d656d6f7279020005616c6c6f630001097472616e73666f726d000205706172736500030a3c030b002300230020006a24000b12002000200110002000ad4220862001ad840b1b0020002d000041fb0047044042000f0b2000ad4220862001ad840b0b06010041000b00",
+	// returns [{"n":1},{"n":2}]
+	"split": "0061736d0100000001110360017f017f60027f7f017e60027f7f00020b0103656e76036c6f670002030302000105030100010607017f014180080b071e03066d656d6f7279020005616c6c6f630001097472616e73666f726d00020a12020b002300230020006a24000b040042110b0b17010041000b115b7b226e223a317d2c7b226e223a327d5d",
+	// returns nothing
+	"drop": "0061736d0100000001110360017f017f60027f7f017e60027f7f00020b0103656e76036c6f670002030302000105030100010607017f014180080b071e03066d656d6f7279020005616c6c6f630001097472616e73666f726d00020a12020b002300230020006a24000b040042000b0b06010041000b00",
+	// returns 42
+	"number": "0061736d0100000001110360017f017f60027f7f017e60027f7f00020b0103656e76036c6f670002030302000105030100010607017f014180080b071e03066d656d6f7279020005616c6c6f630001097472616e73666f726d00020a12020b002300230020006a24000b040042020b0b08010041000b023432",
+}
+
+func loadTestPlugin(t *testing.T, name string) *wasm.Plugin {
+	t.Helper()
+	data, err := hex.DecodeString(testPlugins[name])
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := wasm.Compile(data)
+	if err != nil {
+		t.Fatalf("Compile() error: %v", err)
+	}
+	p, err := wasm.NewPlugin(m, nil)
+	if err != nil {
+		t.Fatalf("NewPlugin() error: %v", err)
+	}
+	return p
+}
+
+func TestWasm_Process(t *testing.T) {
+	tests := []struct {
+		plugin    string
+		wantCount int
+		wantErr   string
+	}{
+		{plugin: "echo", wantCount: 1},
+		{plugin: "split", wantCount: 2},
+		{plugin: "drop", wantCount: 0},
+		{plugin: "number", wantCount: 1, wantErr: "must return an object"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.plugin, func(t *testing.T) {
+			stage, err := NewWasm(loadTestPlugin(t, tt.plugin))
+			if err != nil {
+				t.Fatalf("NewWasm() error: %v", err)
+			}
+
+			entry := parser.NewEntry("raw line")
+			entry.LineNum = 7
+			entry.Fields["msg"] = "hello"
+			entry.Fields["n"] = float64(3)
+
+			got := stage.Process(entry)
+			if len(got) != tt.wantCount {
+				t.Fatalf("Process() returned %d entries, want %d", len(got), tt.wantCount)
+			}
+
+			for _, e := range got {
+				if e.Raw != "raw line" || e.LineNum != 7 {
+					t.Errorf("entry lost Raw/LineNum: %+v", e)
+				}
+				errMsg, _ := e.Fields["_wasmError"].(string)
+				if tt.wantErr == "" && errMsg != "" {
+					t.Errorf("unexpected _wasmError: %s", errMsg)
+				}
+				if tt.wantErr != "" && !strings.Contains(errMsg, tt.wantErr) {
+					t.Errorf("_wasmError = %q, want %q", errMsg, tt.wantErr)
+				}
+			}
+
+			switch tt.plugin {
+			case "echo":
+				if got[0].Fields["msg"] != "hello" || got[0].Fields["n"] != float64(3) {
+					t.Errorf("Fields = %v", got[0].Fields)
+				}
+			case "split":
+				if got[0].Fields["n"] != float64(1) || got[1].Fields["n"] != float64(2) {
+					t.Errorf("Fields = %v, %v", got[0].Fields, got[1].Fields)
+				}
+			}
+		})
+	}
+}
+
+func TestNewWasm_NoTransform(t *testing.T) {
+	// A parse-only plugin: the echo plugin with its transform export
+	// renamed.
+	data, err := hex.DecodeString(strings.Replace(testPlugins["echo"], hex.EncodeToString([]byte("transform")), hex.EncodeToString([]byte("xransform")), 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := wasm.Compile(data)
+	if err != nil {
+		t.Fatalf("Compile() error: %v", err)
+	}
+	p, err := wasm.NewPlugin(m, nil)
+	if err != nil {
+		t.Fatalf("NewPlugin() error: %v", err)
+	}
+	if _, err := NewWasm(p); err == nil {
+		t.Error("NewWasm() expected error for a plugin without transform")
+	}
+}
@@ -0,0 +1,136 @@
+package wasm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// errTruncated is returned when a module ends in the middle of an item.
+var errTruncated = errors.New("unexpected end of module")
+
+// reader decodes the primitive encodings of the binary format.
+type reader struct {
+	data []byte
+	pos  int
+}
+
+func (r *reader) eof() bool {
+	return r.pos >= len(r.data)
+}
+
+func (r *reader) byte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, errTruncated
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *reader) bytes(n int) ([]byte, error) {
+	if n < 0 || r.pos+n > len(r.data) {
+		return nil, errTruncated
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// u32 reads an unsigned LEB128 value.
+func (r *reader) u32() (uint32, error) {
+	var result uint64
+	for shift := 0; shift < 35; shift += 7 {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		result |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			if result > math.MaxUint32 {
+				return 0, fmt.Errorf("integer too large")
+			}
+			return uint32(result), nil
+		}
+	}
+	return 0, fmt.Errorf("integer representation too long")
+}
+
+// s64 reads a signed LEB128 value of up to 64 bits.
+func (r *reader) s64() (int64, error) {
+	var result int64
+	var shift uint
+	for {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		result |= int64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			if shift < 64 && b&0x40 != 0 {
+				result |= -1 << shift
+			}
+			return result, nil
+		}
+		if shift >= 70 {
+			return 0, fmt.Errorf("integer representation too long")
+		}
+	}
+}
+
+func (r *reader) name() (string, error) {
+	n, err := r.u32()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.bytes(int(n))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Immediate decoding during execution. These index the code slice
+// directly and rely on the interpreter's recover to turn a malformed
+// body into a trap instead of checking every byte.
+
+func readU32(code []byte, pc *int) uint32 {
+	var result uint32
+	var shift uint
+	for {
+		b := code[*pc]
+		*pc++
+		result |= uint32(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return result
+		}
+		shift += 7
+	}
+}
+
+func readS64(code []byte, pc *int) int64 {
+	var result int64
+	var shift uint
+	for {
+		b := code[*pc]
+		*pc++
+		result |= int64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			if shift < 64 && b&0x40 != 0 {
+				result |= -1 << shift
+			}
+			return result
+		}
+	}
+}
+
+func readU64Fixed(code []byte, pc *int, n int) uint64 {
+	var v uint64
+	for i := 0; i < n; i++ {
+		v |= uint64(code[*pc+i]) << (8 * i)
+	}
+	*pc += n
+	return v
+}
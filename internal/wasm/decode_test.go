@@ -0,0 +1,84 @@
+package wasm
+
+import (
+	"math"
+	"testing"
+)
+
+func TestReader_U32(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    uint32
+		wantErr bool
+	}{
+		{name: "zero", data: []byte{0x00}, want: 0},
+		{name: "single byte", data: []byte{0x7f}, want: 127},
+		{name: "multi byte", data: []byte{0xe5, 0x8e, 0x26}, want: 624485},
+		{name: "max", data: []byte{0xff, 0xff, 0xff, 0xff, 0x0f}, want: math.MaxUint32},
+		{name: "too large", data: []byte{0xff, 0xff, 0xff, 0xff, 0x1f}, wantErr: true},
+		{name: "too long", data: []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x00}, wantErr: true},
+		{name: "truncated", data: []byte{0x80}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &reader{data: tt.data}
+			got, err := r.u32()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("u32() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("u32() = %d, want %d", got, tt.want)
+			}
+
+			// The execution-time decoder must agree on valid input.
+			if !tt.wantErr {
+				pc := 0
+				if got := readU32(tt.data, &pc); got != tt.want || pc != len(tt.data) {
+					t.Errorf("readU32() = %d (pc %d), want %d (pc %d)", got, pc, tt.want, len(tt.data))
+				}
+			}
+		})
+	}
+}
+
+func TestReader_S64(t *testing.T) {
+	tests := []int64{0, 1, -1, 63, 64, -64, -65, 624485, -123456, math.MaxInt64, math.MinInt64}
+
+	for _, want := range tests {
+		data := sleb(want)
+		r := &reader{data: data}
+		got, err := r.s64()
+		if err != nil {
+			t.Fatalf("s64(%d) error: %v", want, err)
+		}
+		if got != want {
+			t.Errorf("s64() = %d, want %d", got, want)
+		}
+
+		pc := 0
+		if got := readS64(data, &pc); got != want || pc != len(data) {
+			t.Errorf("readS64() = %d (pc %d), want %d", got, pc, want)
+		}
+	}
+}
+
+func TestReader_Name(t *testing.T) {
+	r := &reader{data: []byte{3, 'f', 'o', 'o', 5, 'x'}}
+	got, err := r.name()
+	if err != nil || got != "foo" {
+		t.Fatalf("name() = %q, %v, want foo", got, err)
+	}
+	if _, err := r.name(); err == nil {
+		t.Error("name() on truncated input expected error")
+	}
+}
+
+func TestReadU64Fixed(t *testing.T) {
+	code := []byte{0x00, 0x01, 0x02, 0x03, 0x04}
+	pc := 1
+	if got := readU64Fixed(code, &pc, 4); got != 0x04030201 || pc != 5 {
+		t.Errorf("readU64Fixed() = %#x (pc %d)", got, pc)
+	}
+}
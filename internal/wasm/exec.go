@@ -0,0 +1,835 @@
+package wasm
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+)
+
+// label is an entry on the control stack.
+type label struct {
+	cont   int  // pc to continue at when branched to
+	height int  // operand stack height below the block's values
+	arity  int  // values carried by a branch to this label
+	loop   bool // branches re-enter the loop instead of leaving it
+}
+
+// blockArity decodes a block type and returns its parameter and result
+// counts. pc is advanced past the block type.
+func (inst *Instance) blockArity(body []byte, pc *int) (params, results int) {
+	bt := readS64(body, pc)
+	switch {
+	case bt == -64: // 0x40, empty
+		return 0, 0
+	case bt < 0: // single value type
+		return 0, 1
+	}
+	ft := inst.mod.types[bt]
+	return len(ft.Params), len(ft.Results)
+}
+
+// execute runs a function body and returns its results.
+func (inst *Instance) execute(c *code, nresults int, locals []uint64) []uint64 {
+	body := c.body
+	stack := make([]uint64, 0, 32)
+	labels := make([]label, 1, 8)
+	labels[0] = label{arity: nresults}
+
+	push := func(v uint64) { stack = append(stack, v) }
+	pop := func() uint64 {
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v
+	}
+	results := func(n int) []uint64 {
+		return append([]uint64(nil), stack[len(stack)-n:]...)
+	}
+
+	// branch unwinds to the label depth levels up. It reports true when
+	// the target is the function itself, meaning return.
+	pc := 0
+	branch := func(depth uint32) bool {
+		idx := len(labels) - 1 - int(depth)
+		if idx == 0 {
+			return true
+		}
+		l := labels[idx]
+		vals := stack[len(stack)-l.arity:]
+		stack = append(stack[:l.height], vals...)
+		pc = l.cont
+		if l.loop {
+			labels = labels[:idx+1]
+		} else {
+			labels = labels[:idx]
+		}
+		return false
+	}
+
+	for {
+		if inst.maxFuel > 0 {
+			inst.fuel--
+			if inst.fuel < 0 {
+				panic(ErrFuelExhausted)
+			}
+		}
+
+		op := body[pc]
+		start := pc
+		pc++
+
+		switch op {
+		case 0x00: // unreachable
+			trap("unreachable executed")
+		case 0x01: // nop
+
+		case 0x02, 0x03: // block, loop
+			params, res := inst.blockArity(body, &pc)
+			l := label{height: len(stack) - params}
+			if op == 0x03 {
+				l.cont, l.arity, l.loop = pc, params, true
+			} else {
+				l.cont, l.arity = c.blocks[start].end+1, res
+			}
+			labels = append(labels, l)
+
+		case 0x04: // if
+			params, res := inst.blockArity(body, &pc)
+			cond := uint32(pop())
+			info := c.blocks[start]
+			labels = append(labels, label{cont: info.end + 1, height: len(stack) - params, arity: res})
+			if cond == 0 {
+				if info.els >= 0 {
+					pc = info.els + 1
+				} else {
+					pc = info.end
+				}
+			}
+
+		case 0x05: // else: the then-branch finished, skip to end
+			pc = c.blocks[start].end
+
+		case 0x0b: // end
+			if len(labels) == 1 {
+				return results(nresults)
+			}
+			labels = labels[:len(labels)-1]
+
+		case 0x0c: // br
+			if branch(readU32(body, &pc)) {
+				return results(nresults)
+			}
+
+		case 0x0d: // br_if
+			depth := readU32(body, &pc)
+			if uint32(pop()) != 0 && branch(depth) {
+				return results(nresults)
+			}
+
+		case 0x0e: // br_table
+			n := readU32(body, &pc)
+			targets := make([]uint32, n+1)
+			for i := range targets {
+				targets[i] = readU32(body, &pc)
+			}
+			i := uint32(pop())
+			if i > n {
+				i = n
+			}
+			if branch(targets[i]) {
+				return results(nresults)
+			}
+
+		case 0x0f: // return
+			return results(nresults)
+
+		case 0x10: // call
+			stack = inst.call(readU32(body, &pc), stack)
+
+		case 0x11: // call_indirect
+			typeIdx := readU32(body, &pc)
+			readU32(body, &pc) // table index
+			i := uint32(pop())
+			if int(i) >= len(inst.table) {
+				trap("undefined table element %d", i)
+			}
+			fidx := inst.table[i]
+			if fidx < 0 {
+				trap("uninitialized table element %d", i)
+			}
+			if !inst.mod.types[inst.mod.funcTypes[fidx]].equal(inst.mod.types[typeIdx]) {
+				trap("indirect call type mismatch")
+			}
+			stack = inst.call(uint32(fidx), stack)
+
+		case 0x1a: // drop
+			pop()
+
+		case 0x1b, 0x1c: // select
+			if op == 0x1c {
+				n := readU32(body, &pc)
+				pc += int(n)
+			}
+			cond := uint32(pop())
+			b := pop()
+			a := pop()
+			if cond != 0 {
+				push(a)
+			} else {
+				push(b)
+			}
+
+		case 0x20: // local.get
+			push(locals[readU32(body, &pc)])
+		case 0x21: // local.set
+			locals[readU32(body, &pc)] = pop()
+		case 0x22: // local.tee
+			locals[readU32(body, &pc)] = stack[len(stack)-1]
+		case 0x23: // global.get
+			push(inst.globals[readU32(body, &pc)])
+		case 0x24: // global.set
+			inst.globals[readU32(body, &pc)] = pop()
+
+		case 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e, 0x2f, 0x30, 0x31, 0x32, 0x33, 0x34, 0x35:
+			readU32(body, &pc) // alignment hint
+			offset := readU32(body, &pc)
+			push(inst.load(op, uint32(pop()), offset))
+
+		case 0x36, 0x37, 0x38, 0x39, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e:
+			readU32(body, &pc)
+			offset := readU32(body, &pc)
+			v := pop()
+			inst.store(op, uint32(pop()), offset, v)
+
+		case 0x3f: // memory.size
+			pc++
+			push(uint64(len(inst.mem) / pageSize))
+		case 0x40: // memory.grow
+			pc++
+			push(uint64(uint32(inst.growMemory(uint32(pop())))))
+
+		case 0x41: // i32.const
+			push(uint64(uint32(readS64(body, &pc))))
+		case 0x42: // i64.const
+			push(uint64(readS64(body, &pc)))
+		case 0x43: // f32.const
+			push(readU64Fixed(body, &pc, 4))
+		case 0x44: // f64.const
+			push(readU64Fixed(body, &pc, 8))
+
+		case 0xfc:
+			inst.execMisc(readU32(body, &pc), body, &pc, &stack)
+
+		default:
+			switch {
+			case op >= 0x45 && op <= 0x66:
+				switch op {
+				case 0x45: // i32.eqz
+					push(b2u(uint32(pop()) == 0))
+					continue
+				case 0x50: // i64.eqz
+					push(b2u(pop() == 0))
+					continue
+				}
+				b := pop()
+				a := pop()
+				push(b2u(compare(op, a, b)))
+			case op >= 0x67 && op <= 0x69, op >= 0x79 && op <= 0x7b:
+				push(intUnary(op, pop()))
+			case op >= 0x6a && op <= 0x78:
+				b := pop()
+				push(i32Binary(op, uint32(pop()), uint32(b)))
+			case op >= 0x7c && op <= 0x8a:
+				b := pop()
+				push(i64Binary(op, pop(), b))
+			case op >= 0x8b && op <= 0x91:
+				push(f32Unary(op, pop()))
+			case op >= 0x92 && op <= 0x98:
+				b := pop()
+				push(f32Binary(op, pop(), b))
+			case op >= 0x99 && op <= 0x9f:
+				push(f64Unary(op, pop()))
+			case op >= 0xa0 && op <= 0xa6:
+				b := pop()
+				push(f64Binary(op, pop(), b))
+			case op >= 0xa7 && op <= 0xc4:
+				push(convert(op, pop()))
+			default:
+				trap("unsupported opcode 0x%02x", op)
+			}
+		}
+	}
+}
+
+// call pops the callee's arguments, invokes it and pushes its results.
+func (inst *Instance) call(fidx uint32, stack []uint64) []uint64 {
+	ft := inst.mod.types[inst.mod.funcTypes[fidx]]
+	n := len(ft.Params)
+	args := append([]uint64(nil), stack[len(stack)-n:]...)
+	stack = stack[:len(stack)-n]
+	return append(stack, inst.invoke(fidx, args)...)
+}
+
+func b2u(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// effective computes and bounds-checks a memory address.
+func (inst *Instance) effective(base, offset uint32, size int) uint64 {
+	addr := uint64(base) + uint64(offset)
+	if addr+uint64(size) > uint64(len(inst.mem)) {
+		trap("out of bounds memory access at %d", addr)
+	}
+	return addr
+}
+
+func (inst *Instance) load(op byte, base, offset uint32) uint64 {
+	le := binary.LittleEndian
+	switch op {
+	case 0x28, 0x2a: // i32.load, f32.load
+		a := inst.effective(base, offset, 4)
+		return uint64(le.Uint32(inst.mem[a:]))
+	case 0x29, 0x2b: // i64.load, f64.load
+		a := inst.effective(base, offset, 8)
+		return le.Uint64(inst.mem[a:])
+	case 0x2c: // i32.load8_s
+		a := inst.effective(base, offset, 1)
+		return uint64(uint32(int32(int8(inst.mem[a]))))
+	case 0x2d: // i32.load8_u
+		a := inst.effective(base, offset, 1)
+		return uint64(inst.mem[a])
+	case 0x2e: // i32.load16_s
+		a := inst.effective(base, offset, 2)
+		return uint64(uint32(int32(int16(le.Uint16(inst.mem[a:])))))
+	case 0x2f: // i32.load16_u
+		a := inst.effective(base, offset, 2)
+		return uint64(le.Uint16(inst.mem[a:]))
+	case 0x30: // i64.load8_s
+		a := inst.effective(base, offset, 1)
+		return uint64(int64(int8(inst.mem[a])))
+	case 0x31: // i64.load8_u
+		a := inst.effective(base, offset, 1)
+		return uint64(inst.mem[a])
+	case 0x32: // i64.load16_s
+		a := inst.effective(base, offset, 2)
+		return uint64(int64(int16(le.Uint16(inst.mem[a:]))))
+	case 0x33: // i64.load16_u
+		a := inst.effective(base, offset, 2)
+		return uint64(le.Uint16(inst.mem[a:]))
+	case 0x34: // i64.load32_s
+		a := inst.effective(base, offset, 4)
+		return uint64(int64(int32(le.Uint32(inst.mem[a:]))))
+	default: // 0x35 i64.load32_u
+		a := inst.effective(base, offset, 4)
+		return uint64(le.Uint32(inst.mem[a:]))
+	}
+}
+
+func (inst *Instance) store(op byte, base, offset uint32, v uint64) {
+	le := binary.LittleEndian
+	switch op {
+	case 0x36, 0x38, 0x3e: // i32.store, f32.store, i64.store32
+		a := inst.effective(base, offset, 4)
+		le.PutUint32(inst.mem[a:], uint32(v))
+	case 0x37, 0x39: // i64.store, f64.store
+		a := inst.effective(base, offset, 8)
+		le.PutUint64(inst.mem[a:], v)
+	case 0x3a, 0x3c: // i32.store8, i64.store8
+		a := inst.effective(base, offset, 1)
+		inst.mem[a] = byte(v)
+	default: // 0x3b i32.store16, 0x3d i64.store16
+		a := inst.effective(base, offset, 2)
+		le.PutUint16(inst.mem[a:], uint16(v))
+	}
+}
+
+// execMisc handles the 0xFC prefix: saturating truncation and bulk memory.
+func (inst *Instance) execMisc(sub uint32, body []byte, pc *int, stack *[]uint64) {
+	s := *stack
+	pop := func() uint64 {
+		v := s[len(s)-1]
+		s = s[:len(s)-1]
+		return v
+	}
+
+	switch {
+	case sub <= 7:
+		s = append(s, truncSat(sub, pop()))
+
+	case sub == 8: // memory.init
+		seg := readU32(body, pc)
+		*pc++
+		n, src, dst := uint32(pop()), uint32(pop()), uint32(pop())
+		data := inst.data[seg]
+		if uint64(src)+uint64(n) > uint64(len(data)) {
+			trap("out of bounds memory.init")
+		}
+		a := inst.effective(dst, 0, int(n))
+		copy(inst.mem[a:], data[src:src+n])
+
+	case sub == 9: // data.drop
+		inst.data[readU32(body, pc)] = nil
+
+	case sub == 10: // memory.copy
+		*pc += 2
+		n, src, dst := uint32(pop()), uint32(pop()), uint32(pop())
+		from := inst.effective(src, 0, int(n))
+		to := inst.effective(dst, 0, int(n))
+		copy(inst.mem[to:to+uint64(n)], inst.mem[from:from+uint64(n)])
+
+	case sub == 11: // memory.fill
+		*pc++
+		n, val, dst := uint32(pop()), byte(pop()), uint32(pop())
+		a := inst.effective(dst, 0, int(n))
+		for i := uint64(0); i < uint64(n); i++ {
+			inst.mem[a+i] = val
+		}
+
+	default:
+		trap("unsupported opcode 0xfc %d", sub)
+	}
+	*stack = s
+}
+
+// compare implements the i32/i64/f32/f64 comparison opcodes.
+func compare(op byte, a, b uint64) bool {
+	switch {
+	case op <= 0x4f:
+		x, y := uint32(a), uint32(b)
+		switch op {
+		case 0x46:
+			return x == y
+		case 0x47:
+			return x != y
+		case 0x48:
+			return int32(x) < int32(y)
+		case 0x49:
+			return x < y
+		case 0x4a:
+			return int32(x) > int32(y)
+		case 0x4b:
+			return x > y
+		case 0x4c:
+			return int32(x) <= int32(y)
+		case 0x4d:
+			return x <= y
+		case 0x4e:
+			return int32(x) >= int32(y)
+		default:
+			return x >= y
+		}
+	case op <= 0x5a:
+		switch op {
+		case 0x51:
+			return a == b
+		case 0x52:
+			return a != b
+		case 0x53:
+			return int64(a) < int64(b)
+		case 0x54:
+			return a < b
+		case 0x55:
+			return int64(a) > int64(b)
+		case 0x56:
+			return a > b
+		case 0x57:
+			return int64(a) <= int64(b)
+		case 0x58:
+			return a <= b
+		case 0x59:
+			return int64(a) >= int64(b)
+		default:
+			return a >= b
+		}
+	case op <= 0x60:
+		return floatCompare(op-0x5b, float64(math.Float32frombits(uint32(a))), float64(math.Float32frombits(uint32(b))))
+	default:
+		return floatCompare(op-0x61, math.Float64frombits(a), math.Float64frombits(b))
+	}
+}
+
+// floatCompare handles eq, ne, lt, gt, le, ge (rel 0-5).
+func floatCompare(rel byte, x, y float64) bool {
+	switch rel {
+	case 0:
+		return x == y
+	case 1:
+		return x != y
+	case 2:
+		return x < y
+	case 3:
+		return x > y
+	case 4:
+		return x <= y
+	default:
+		return x >= y
+	}
+}
+
+// intUnary implements clz, ctz and popcnt.
+func intUnary(op byte, v uint64) uint64 {
+	switch op {
+	case 0x67:
+		return uint64(bits.LeadingZeros32(uint32(v)))
+	case 0x68:
+		return uint64(bits.TrailingZeros32(uint32(v)))
+	case 0x69:
+		return uint64(bits.OnesCount32(uint32(v)))
+	case 0x79:
+		return uint64(bits.LeadingZeros64(v))
+	case 0x7a:
+		return uint64(bits.TrailingZeros64(v))
+	default:
+		return uint64(bits.OnesCount64(v))
+	}
+}
+
+func i32Binary(op byte, a, b uint32) uint64 {
+	var r uint32
+	switch op {
+	case 0x6a:
+		r = a + b
+	case 0x6b:
+		r = a - b
+	case 0x6c:
+		r = a * b
+	case 0x6d: // div_s
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		if int32(a) == math.MinInt32 && int32(b) == -1 {
+			trap("integer overflow")
+		}
+		r = uint32(int32(a) / int32(b))
+	case 0x6e:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		r = a / b
+	case 0x6f: // rem_s
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		if int32(b) == -1 {
+			r = 0
+		} else {
+			r = uint32(int32(a) % int32(b))
+		}
+	case 0x70:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		r = a % b
+	case 0x71:
+		r = a & b
+	case 0x72:
+		r = a | b
+	case 0x73:
+		r = a ^ b
+	case 0x74:
+		r = a << (b & 31)
+	case 0x75:
+		r = uint32(int32(a) >> (b & 31))
+	case 0x76:
+		r = a >> (b & 31)
+	case 0x77:
+		r = bits.RotateLeft32(a, int(b&31))
+	default:
+		r = bits.RotateLeft32(a, -int(b&31))
+	}
+	return uint64(r)
+}
+
+func i64Binary(op byte, a, b uint64) uint64 {
+	switch op {
+	case 0x7c:
+		return a + b
+	case 0x7d:
+		return a - b
+	case 0x7e:
+		return a * b
+	case 0x7f: // div_s
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		if int64(a) == math.MinInt64 && int64(b) == -1 {
+			trap("integer overflow")
+		}
+		return uint64(int64(a) / int64(b))
+	case 0x80:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		return a / b
+	case 0x81: // rem_s
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		if int64(b) == -1 {
+			return 0
+		}
+		return uint64(int64(a) % int64(b))
+	case 0x82:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		return a % b
+	case 0x83:
+		return a & b
+	case 0x84:
+		return a | b
+	case 0x85:
+		return a ^ b
+	case 0x86:
+		return a << (b & 63)
+	case 0x87:
+		return uint64(int64(a) >> (b & 63))
+	case 0x88:
+		return a >> (b & 63)
+	case 0x89:
+		return bits.RotateLeft64(a, int(b&63))
+	default:
+		return bits.RotateLeft64(a, -int(b&63))
+	}
+}
+
+// floatUnary implements abs, neg, ceil, floor, trunc, nearest and sqrt
+// (op 0-6) on a float64; f32 results are rounded by the caller.
+func floatUnary(op byte, x float64) float64 {
+	switch op {
+	case 0:
+		return math.Abs(x)
+	case 1:
+		return -x
+	case 2:
+		return math.Ceil(x)
+	case 3:
+		return math.Floor(x)
+	case 4:
+		return math.Trunc(x)
+	case 5:
+		return math.RoundToEven(x)
+	default:
+		return math.Sqrt(x)
+	}
+}
+
+func f32Unary(op byte, v uint64) uint64 {
+	switch op {
+	case 0x8b: // abs: clear the sign bit, preserving NaN payloads
+		return v & 0x7fffffff
+	case 0x8c: // neg
+		return (v ^ 0x80000000) & 0xffffffff
+	}
+	x := float64(math.Float32frombits(uint32(v)))
+	return uint64(math.Float32bits(float32(floatUnary(op-0x8b, x))))
+}
+
+func f64Unary(op byte, v uint64) uint64 {
+	switch op {
+	case 0x99:
+		return v &^ (1 << 63)
+	case 0x9a:
+		return v ^ (1 << 63)
+	}
+	return math.Float64bits(floatUnary(op-0x99, math.Float64frombits(v)))
+}
+
+// floatBinary implements add, sub, mul, div, min, max (op 0-5).
+func floatBinary(op byte, x, y float64) float64 {
+	switch op {
+	case 0:
+		return x + y
+	case 1:
+		return x - y
+	case 2:
+		return x * y
+	case 3:
+		return x / y
+	case 4:
+		if math.IsNaN(x) || math.IsNaN(y) {
+			return math.NaN()
+		}
+		if x == 0 && y == 0 {
+			// min(-0, +0) is -0
+			if math.Signbit(x) {
+				return x
+			}
+			return y
+		}
+		return math.Min(x, y)
+	default:
+		if math.IsNaN(x) || math.IsNaN(y) {
+			return math.NaN()
+		}
+		if x == 0 && y == 0 {
+			if math.Signbit(x) {
+				return y
+			}
+			return x
+		}
+		return math.Max(x, y)
+	}
+}
+
+func f32Binary(op byte, a, b uint64) uint64 {
+	if op == 0x98 { // copysign
+		return (a & 0x7fffffff) | (b & 0x80000000)
+	}
+	x := math.Float32frombits(uint32(a))
+	y := math.Float32frombits(uint32(b))
+	var r float32
+	switch op {
+	case 0x92:
+		r = x + y
+	case 0x93:
+		r = x - y
+	case 0x94:
+		r = x * y
+	case 0x95:
+		r = x / y
+	default:
+		r = float32(floatBinary(op-0x92, float64(x), float64(y)))
+	}
+	return uint64(math.Float32bits(r))
+}
+
+func f64Binary(op byte, a, b uint64) uint64 {
+	if op == 0xa6 { // copysign
+		return (a &^ (1 << 63)) | (b & (1 << 63))
+	}
+	return math.Float64bits(floatBinary(op-0xa0, math.Float64frombits(a), math.Float64frombits(b)))
+}
+
+// truncCheck traps if x cannot be truncated into [lo, hi).
+func truncCheck(x, lo, hi float64) float64 {
+	if math.IsNaN(x) {
+		trap("invalid conversion to integer")
+	}
+	t := math.Trunc(x)
+	if t < lo || t >= hi {
+		trap("integer overflow")
+	}
+	return t
+}
+
+func f32ToF64(v uint64) float64 {
+	return float64(math.Float32frombits(uint32(v)))
+}
+
+// convert implements the conversion opcodes 0xa7-0xc4.
+func convert(op byte, v uint64) uint64 {
+	const (
+		two31 = 1 << 31
+		two32 = 1 << 32
+		two63 = 1 << 63
+		two64 = 1 << 64
+	)
+
+	switch op {
+	case 0xa7: // i32.wrap_i64
+		return uint64(uint32(v))
+	case 0xa8: // i32.trunc_f32_s
+		return uint64(uint32(int32(truncCheck(f32ToF64(v), -two31, two31))))
+	case 0xa9: // i32.trunc_f32_u
+		return uint64(uint32(truncCheck(f32ToF64(v), 0, two32)))
+	case 0xaa: // i32.trunc_f64_s
+		return uint64(uint32(int32(truncCheck(math.Float64frombits(v), -two31, two31))))
+	case 0xab: // i32.trunc_f64_u
+		return uint64(uint32(truncCheck(math.Float64frombits(v), 0, two32)))
+	case 0xac: // i64.extend_i32_s
+		return uint64(int64(int32(uint32(v))))
+	case 0xad: // i64.extend_i32_u
+		return uint64(uint32(v))
+	case 0xae: // i64.trunc_f32_s
+		return uint64(int64(truncCheck(f32ToF64(v), -two63, two63)))
+	case 0xaf: // i64.trunc_f32_u
+		return floatToU64(truncCheck(f32ToF64(v), 0, two64))
+	case 0xb0: // i64.trunc_f64_s
+		return uint64(int64(truncCheck(math.Float64frombits(v), -two63, two63)))
+	case 0xb1: // i64.trunc_f64_u
+		return floatToU64(truncCheck(math.Float64frombits(v), 0, two64))
+	case 0xb2: // f32.convert_i32_s
+		return uint64(math.Float32bits(float32(int32(uint32(v)))))
+	case 0xb3: // f32.convert_i32_u
+		return uint64(math.Float32bits(float32(uint32(v))))
+	case 0xb4: // f32.convert_i64_s
+		return uint64(math.Float32bits(float32(int64(v))))
+	case 0xb5: // f32.convert_i64_u
+		return uint64(math.Float32bits(float32(v)))
+	case 0xb6: // f32.demote_f64
+		return uint64(math.Float32bits(float32(math.Float64frombits(v))))
+	case 0xb7: // f64.convert_i32_s
+		return math.Float64bits(float64(int32(uint32(v))))
+	case 0xb8: // f64.convert_i32_u
+		return math.Float64bits(float64(uint32(v)))
+	case 0xb9: // f64.convert_i64_s
+		return math.Float64bits(float64(int64(v)))
+	case 0xba: // f64.convert_i64_u
+		return math.Float64bits(float64(v))
+	case 0xbb: // f64.promote_f32
+		return math.Float64bits(f32ToF64(v))
+	case 0xbc, 0xbe: // i32.reinterpret_f32, f32.reinterpret_i32
+		return uint64(uint32(v))
+	case 0xbd, 0xbf: // i64.reinterpret_f64, f64.reinterpret_i64
+		return v
+	case 0xc0: // i32.extend8_s
+		return uint64(uint32(int32(int8(v))))
+	case 0xc1: // i32.extend16_s
+		return uint64(uint32(int32(int16(v))))
+	case 0xc2: // i64.extend8_s
+		return uint64(int64(int8(v)))
+	case 0xc3: // i64.extend16_s
+		return uint64(int64(int16(v)))
+	default: // 0xc4 i64.extend32_s
+		return uint64(int64(int32(v)))
+	}
+}
+
+// floatToU64 converts a float in [0, 2^64) to uint64 without relying on
+// the implementation-defined behavior of out-of-range Go conversions.
+func floatToU64(f float64) uint64 {
+	if f >= 1<<63 {
+		return uint64(f-(1<<63)) | 1<<63
+	}
+	return uint64(f)
+}
+
+// truncSat implements the saturating truncations (0xfc 0-7).
+func truncSat(sub uint32, v uint64) uint64 {
+	var x float64
+	if sub%4 < 2 {
+		x = f32ToF64(v)
+	} else {
+		x = math.Float64frombits(v)
+	}
+	if math.IsNaN(x) {
+		return 0
+	}
+	x = math.Trunc(x)
+
+	switch sub {
+	case 0, 2: // i32.trunc_sat_*_s
+		return uint64(uint32(int32(math.Max(math.MinInt32, math.Min(math.MaxInt32, x)))))
+	case 1, 3: // i32.trunc_sat_*_u
+		return uint64(uint32(math.Max(0, math.Min(math.MaxUint32, x))))
+	case 4, 6: // i64.trunc_sat_*_s
+		if x <= math.MinInt64 {
+			return 1 << 63
+		}
+		if x >= 1<<63 {
+			return math.MaxInt64
+		}
+		return uint64(int64(x))
+	default: // i64.trunc_sat_*_u
+		if x <= 0 {
+			return 0
+		}
+		if x >= 1<<64 {
+			return math.MaxUint64
+		}
+		return floatToU64(x)
+	}
+}
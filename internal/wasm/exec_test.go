@@ -0,0 +1,329 @@
+package wasm
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func f64c(v float64) []byte {
+	b := []byte{0x44}
+	bits := math.Float64bits(v)
+	for i := 0; i < 8; i++ {
+		b = append(b, byte(bits>>(8*i)))
+	}
+	return b
+}
+
+func f32c(v float32) []byte {
+	b := []byte{0x43}
+	bits := math.Float32bits(v)
+	for i := 0; i < 4; i++ {
+		b = append(b, byte(bits>>(8*i)))
+	}
+	return b
+}
+
+// run compiles and instantiates a single-function module and calls it.
+func run(t *testing.T, mod []byte, args ...uint64) ([]uint64, error) {
+	t.Helper()
+	m, err := Compile(mod)
+	if err != nil {
+		t.Fatalf("Compile() error: %v", err)
+	}
+	inst, err := Instantiate(m, nil)
+	if err != nil {
+		t.Fatalf("Instantiate() error: %v", err)
+	}
+	return inst.Call("f", args...)
+}
+
+var (
+	i32    = []ValType{I32}
+	i64    = []ValType{I64}
+	f64    = []ValType{F64}
+	i32i32 = []ValType{I32, I32}
+)
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  []ValType
+		results []ValType
+		locals  []ValType
+		body    [][]byte
+		args    []uint64
+		want    uint64
+	}{
+		{
+			name: "i32 add", params: i32i32, results: i32,
+			body: [][]byte{op(0x20, 0, 0x20, 1, 0x6a)},
+			args: []uint64{2, 3}, want: 5,
+		},
+		{
+			name: "i32 sub wraps", params: i32i32, results: i32,
+			body: [][]byte{op(0x20, 0, 0x20, 1, 0x6b)},
+			args: []uint64{0, 1}, want: 0xffffffff,
+		},
+		{
+			name: "i32 div_s", results: i32,
+			body: [][]byte{i32c(-7), i32c(2), op(0x6d)},
+			want: uint64(uint32(0xfffffffd)), // -3
+		},
+		{
+			name: "i32 rem_s", results: i32,
+			body: [][]byte{i32c(-7), i32c(2), op(0x6f)},
+			want: uint64(uint32(0xffffffff)), // -1
+		},
+		{
+			name: "i32 shr_s", results: i32,
+			body: [][]byte{i32c(-8), i32c(1), op(0x75)},
+			want: uint64(uint32(0xfffffffc)),
+		},
+		{
+			name: "i32 rotl", results: i32,
+			body: [][]byte{i32c(math.MinInt32), i32c(1), op(0x77)},
+			want: 1,
+		},
+		{
+			name: "i32 clz and popcnt", results: i32,
+			body: [][]byte{i32c(1), op(0x67), i32c(7), op(0x69), op(0x6a)},
+			want: 31 + 3,
+		},
+		{
+			name: "i64 mul", results: i64,
+			body: [][]byte{i64c(1 << 40), i64c(3), op(0x7e)},
+			want: 3 << 40,
+		},
+		{
+			name: "comparisons", results: i32,
+			body: [][]byte{i32c(-1), i32c(1), op(0x48), i32c(-1), i32c(1), op(0x49), op(0x6a)}, // lt_s + lt_u
+			want: 1,
+		},
+		{
+			name: "eqz", results: i32,
+			body: [][]byte{i32c(0), op(0x45)},
+			want: 1,
+		},
+		{
+			name: "if else", params: i32, results: i32,
+			body: [][]byte{op(0x20, 0, 0x04, byte(I32)), i32c(10), op(0x05), i32c(20), op(0x0b)},
+			args: []uint64{0}, want: 20,
+		},
+		{
+			name: "if without else", params: i32, results: i32, locals: i32,
+			body: [][]byte{i32c(1), op(0x21, 1, 0x20, 0, 0x04, 0x40), i32c(2), op(0x21, 1, 0x0b, 0x20, 1)},
+			args: []uint64{0}, want: 1,
+		},
+		{
+			// sum = 0; i = n; loop { sum += i; i--; br_if i != 0 }
+			name: "loop", params: i32, results: i32, locals: i32,
+			body: [][]byte{
+				op(0x03, 0x40),
+				op(0x20, 1, 0x20, 0, 0x6a, 0x21, 1),
+				op(0x20, 0), i32c(1), op(0x6b, 0x22, 0),
+				op(0x0d, 0),
+				op(0x0b),
+				op(0x20, 1),
+			},
+			args: []uint64{10}, want: 55,
+		},
+		{
+			name: "block result via br", results: i32,
+			body: [][]byte{op(0x02, byte(I32)), i32c(7), op(0x0c, 0), i32c(9), op(0x0b)},
+			want: 7,
+		},
+		{
+			name: "br_table", params: i32, results: i32,
+			body: [][]byte{
+				op(0x02, 0x40, 0x02, 0x40, 0x02, 0x40),
+				op(0x20, 0, 0x0e, 2, 0, 1, 2),
+				op(0x0b), i32c(100), op(0x0f),
+				op(0x0b), i32c(200), op(0x0f),
+				op(0x0b), i32c(300),
+			},
+			args: []uint64{1}, want: 200,
+		},
+		{
+			name: "br_table default", params: i32, results: i32,
+			body: [][]byte{
+				op(0x02, 0x40, 0x02, 0x40),
+				op(0x20, 0, 0x0e, 1, 0, 1),
+				op(0x0b), i32c(100), op(0x0f),
+				op(0x0b), i32c(300),
+			},
+			args: []uint64{9}, want: 300,
+		},
+		{
+			name: "select", results: i32,
+			body: [][]byte{i32c(1), i32c(2), i32c(0), op(0x1b)},
+			want: 2,
+		},
+		{
+			name: "memory store and load", results: i32,
+			body: [][]byte{i32c(8), i32c(-2), op(0x3a, 0, 0), i32c(8), op(0x2c, 0, 0)},
+			want: uint64(uint32(0xfffffffe)),
+		},
+		{
+			name: "memory offset", results: i64,
+			body: [][]byte{i32c(0), i64c(-1), op(0x37, 3, 16), i32c(16), op(0x35, 2, 0)},
+			want: 0xffffffff,
+		},
+		{
+			name: "memory size and grow", results: i32,
+			body: [][]byte{i32c(2), op(0x40, 0, 0x3f, 0, 0x6a)},
+			want: 1 + 3,
+		},
+		{
+			name: "memory fill and copy", results: i32,
+			body: [][]byte{
+				i32c(0), i32c(0x61), i32c(4), op(0xfc, 11, 0),
+				i32c(100), i32c(0), i32c(4), op(0xfc, 10, 0, 0),
+				i32c(100), op(0x28, 2, 0),
+			},
+			want: 0x61616161,
+		},
+		{
+			name: "f64 arithmetic", results: f64,
+			body: [][]byte{f64c(1.5), f64c(2.25), op(0xa0), op(0x9f)}, // sqrt(3.75)
+			want: math.Float64bits(math.Sqrt(3.75)),
+		},
+		{
+			name: "f64 min with negative zero", results: f64,
+			body: [][]byte{f64c(0), f64c(math.Copysign(0, -1)), op(0xa4)},
+			want: math.Float64bits(math.Copysign(0, -1)),
+		},
+		{
+			name: "f32 nearest", results: []ValType{F32},
+			body: [][]byte{f32c(2.5), op(0x90)},
+			want: uint64(math.Float32bits(2)),
+		},
+		{
+			name: "trunc f64 to i32", results: i32,
+			body: [][]byte{f64c(-3.9), op(0xaa)},
+			want: uint64(uint32(0xfffffffd)),
+		},
+		{
+			name: "saturating trunc", results: i32,
+			body: [][]byte{f64c(1e20), op(0xfc, 0x02)},
+			want: math.MaxInt32,
+		},
+		{
+			name: "extend and wrap", results: i64,
+			body: [][]byte{i32c(-1), op(0xac), i32c(-1), op(0xad), op(0x7c)},
+			want: 0xfffffffe,
+		},
+		{
+			name: "sign extension ops", results: i32,
+			body: [][]byte{i32c(0x80), op(0xc0)},
+			want: uint64(uint32(0xffffff80)),
+		},
+		{
+			name: "convert and reinterpret", results: i64,
+			body: [][]byte{i64c(3), op(0xb9, 0xbd)},
+			want: math.Float64bits(3),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := run(t, singleFunc(tt.params, tt.results, tt.locals, tt.body...), tt.args...)
+			if err != nil {
+				t.Fatalf("Call() error: %v", err)
+			}
+			if len(got) != 1 || got[0] != tt.want {
+				t.Errorf("Call() = %#x, want %#x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecute_Traps(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    [][]byte
+		wantErr string
+	}{
+		{name: "unreachable", body: [][]byte{op(0x00)}, wantErr: "unreachable"},
+		{name: "divide by zero", body: [][]byte{i32c(1), i32c(0), op(0x6d, 0x1a)}, wantErr: "divide by zero"},
+		{name: "signed overflow", body: [][]byte{i32c(math.MinInt32), i32c(-1), op(0x6d, 0x1a)}, wantErr: "overflow"},
+		{name: "out of bounds load", body: [][]byte{i32c(65535), op(0x28, 2, 0, 0x1a)}, wantErr: "out of bounds"},
+		{name: "invalid conversion", body: [][]byte{f64c(math.NaN()), op(0xaa, 0x1a)}, wantErr: "invalid conversion"},
+		{name: "conversion overflow", body: [][]byte{f64c(1e10), op(0xaa, 0x1a)}, wantErr: "overflow"},
+		{name: "infinite loop", body: [][]byte{op(0x03, 0x40, 0x0c, 0, 0x0b)}, wantErr: "budget"},
+		{name: "unknown opcode", body: [][]byte{op(0xff)}, wantErr: "unsupported opcode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Compile(singleFunc(nil, nil, nil, tt.body...))
+			if err != nil {
+				t.Fatalf("Compile() error: %v", err)
+			}
+			inst, err := Instantiate(m, nil, WithFuel(10000))
+			if err != nil {
+				t.Fatalf("Instantiate() error: %v", err)
+			}
+			_, err = inst.Call("f")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Call() error = %v, want %q", err, tt.wantErr)
+			}
+			if tt.name == "infinite loop" && !errors.Is(err, ErrFuelExhausted) {
+				t.Errorf("error %v should wrap ErrFuelExhausted", err)
+			}
+		})
+	}
+}
+
+func TestExecute_Calls(t *testing.T) {
+	// Type 0: (i32) -> i32. Function 0 is fact (recursive), function 1
+	// calls function 0 through the table.
+	fact := funcBody(nil,
+		op(0x20, 0, 0x45, 0x04, byte(I32)), i32c(1),
+		op(0x05, 0x20, 0), op(0x20, 0), i32c(1), op(0x6b, 0x10, 0, 0x6c),
+		op(0x0b),
+	)
+	indirect := funcBody(nil, op(0x20, 0), i32c(0), op(0x11, 0, 0))
+
+	mod := cat(
+		magic,
+		section(1, funcType(i32, i32)),
+		section(3, uleb(0), uleb(0)),
+		section(4, []byte{0x70, 0x00, 0x01}),
+		section(7, exportFunc("fact", 0), exportFunc("indirect", 1)),
+		section(9, cat(uleb(0), i32c(0), op(0x0b), uleb(1), uleb(0))),
+		section(10, fact, indirect),
+	)
+
+	m, err := Compile(mod)
+	if err != nil {
+		t.Fatalf("Compile() error: %v", err)
+	}
+	inst, err := Instantiate(m, nil)
+	if err != nil {
+		t.Fatalf("Instantiate() error: %v", err)
+	}
+
+	for _, fn := range []string{"fact", "indirect"} {
+		got, err := inst.Call(fn, 5)
+		if err != nil {
+			t.Fatalf("Call(%s) error: %v", fn, err)
+		}
+		if got[0] != 120 {
+			t.Errorf("Call(%s, 5) = %d, want 120", fn, got[0])
+		}
+	}
+
+	t.Run("call stack exhausted", func(t *testing.T) {
+		loop := cat(magic,
+			section(1, funcType(nil, nil)),
+			section(3, uleb(0)),
+			section(7, exportFunc("f", 0)),
+			section(10, funcBody(nil, op(0x10, 0))),
+		)
+		if _, err := run(t, loop); err == nil || !strings.Contains(err.Error(), "call stack") {
+			t.Errorf("Call() error = %v, want call stack error", err)
+		}
+	})
+}
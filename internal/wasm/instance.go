@@ -0,0 +1,270 @@
+package wasm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+)
+
+// Defaults for instance limits.
+const (
+	// DefaultFuel is the instruction budget for a single Call.
+	DefaultFuel = 50_000_000
+
+	// DefaultMaxPages caps linear memory (64 KiB pages, so 64 MiB).
+	DefaultMaxPages = 1024
+
+	pageSize     = 65536
+	maxCallDepth = 1000
+)
+
+// ErrFuelExhausted is returned when a call exceeds its instruction budget.
+var ErrFuelExhausted = errors.New("instruction budget exhausted")
+
+// Trap is a WebAssembly runtime trap.
+type Trap struct {
+	Reason string
+}
+
+func (t *Trap) Error() string {
+	return "wasm trap: " + t.Reason
+}
+
+func trap(format string, args ...any) {
+	panic(&Trap{Reason: fmt.Sprintf(format, args...)})
+}
+
+// HostFunc implements an imported function. Arguments and results use
+// the same encoding as Call.
+type HostFunc func(inst *Instance, args []uint64) []uint64
+
+// HostFunction is an import provided by the embedder.
+type HostFunction struct {
+	Type FuncType
+	Fn   HostFunc
+}
+
+// Imports maps "module.name" to a host function.
+type Imports map[string]HostFunction
+
+// Instance is an instantiated module with its own memory and globals.
+// An Instance is not safe for concurrent use.
+type Instance struct {
+	mod      *Module
+	hosts    []HostFunc
+	mem      []byte
+	maxPages uint32
+	globals  []uint64
+	table    []int64 // function index, or -1 for an empty slot
+	data     [][]byte
+	fuel     int64
+	maxFuel  int64
+	depth    int
+}
+
+// Option configures an Instance.
+type Option func(*Instance)
+
+// WithFuel sets the instruction budget for each Call. Zero or negative
+// disables the limit.
+func WithFuel(n int64) Option {
+	return func(inst *Instance) {
+		inst.maxFuel = n
+	}
+}
+
+// WithMaxPages caps linear memory growth at n 64 KiB pages.
+func WithMaxPages(n uint32) Option {
+	return func(inst *Instance) {
+		inst.maxPages = n
+	}
+}
+
+// Instantiate links a module against host imports, initializes memory,
+// tables and globals, and runs the start function if there is one.
+func Instantiate(m *Module, imports Imports, opts ...Option) (inst *Instance, err error) {
+	inst = &Instance{mod: m, maxFuel: DefaultFuel, maxPages: DefaultMaxPages}
+	for _, opt := range opts {
+		opt(inst)
+	}
+
+	for _, imp := range m.imports {
+		host, ok := imports[imp.Module+"."+imp.Name]
+		if !ok {
+			return nil, fmt.Errorf("unresolved import %s.%s", imp.Module, imp.Name)
+		}
+		if !host.Type.equal(imp.Type) {
+			return nil, fmt.Errorf("import %s.%s: type %v does not match %v", imp.Module, imp.Name, imp.Type, host.Type)
+		}
+		inst.hosts = append(inst.hosts, host.Fn)
+	}
+
+	if m.hasMemory {
+		if m.memMax < inst.maxPages {
+			inst.maxPages = m.memMax
+		}
+		if m.memMin > inst.maxPages {
+			return nil, fmt.Errorf("module needs %d memory pages, limit is %d", m.memMin, inst.maxPages)
+		}
+		inst.mem = make([]byte, int(m.memMin)*pageSize)
+	}
+
+	inst.globals = make([]uint64, len(m.globals))
+	for i, g := range m.globals {
+		inst.globals[i] = g.init
+	}
+
+	if m.hasTable {
+		inst.table = make([]int64, m.tableMin)
+		for i := range inst.table {
+			inst.table[i] = -1
+		}
+	}
+	for _, seg := range m.elems {
+		if uint64(seg.offset)+uint64(len(seg.funcs)) > uint64(len(inst.table)) {
+			return nil, fmt.Errorf("element segment out of table bounds")
+		}
+		for i, f := range seg.funcs {
+			if int(f) >= len(m.funcTypes) {
+				return nil, fmt.Errorf("element segment references function %d", f)
+			}
+			inst.table[int(seg.offset)+i] = int64(f)
+		}
+	}
+
+	inst.data = make([][]byte, len(m.data))
+	for i, seg := range m.data {
+		if !seg.active {
+			inst.data[i] = seg.init
+			continue
+		}
+		if uint64(seg.offset)+uint64(len(seg.init)) > uint64(len(inst.mem)) {
+			return nil, fmt.Errorf("data segment out of memory bounds")
+		}
+		copy(inst.mem[seg.offset:], seg.init)
+	}
+
+	if m.start >= 0 {
+		if m.start >= len(m.funcTypes) {
+			return nil, fmt.Errorf("start function %d out of range", m.start)
+		}
+		inst.fuel = inst.maxFuel
+		if err := inst.protect(func() { inst.invoke(uint32(m.start), nil) }); err != nil {
+			return nil, fmt.Errorf("start function: %w", err)
+		}
+	}
+
+	return inst, nil
+}
+
+// Memory returns the instance's linear memory. The slice is invalidated
+// by memory growth.
+func (inst *Instance) Memory() []byte {
+	return inst.mem
+}
+
+// Read returns a copy of length bytes at offset, or an error if the
+// range is out of bounds.
+func (inst *Instance) Read(offset, length uint32) ([]byte, error) {
+	end := uint64(offset) + uint64(length)
+	if end > uint64(len(inst.mem)) {
+		return nil, fmt.Errorf("memory range [%d, %d) out of bounds", offset, end)
+	}
+	return append([]byte(nil), inst.mem[offset:end]...), nil
+}
+
+// Write copies b into memory at offset.
+func (inst *Instance) Write(offset uint32, b []byte) error {
+	end := uint64(offset) + uint64(len(b))
+	if end > uint64(len(inst.mem)) {
+		return fmt.Errorf("memory range [%d, %d) out of bounds", offset, end)
+	}
+	copy(inst.mem[offset:], b)
+	return nil
+}
+
+// Call invokes an exported function. Integers are passed as their
+// two's-complement bits; floats as math.Float32bits/Float64bits.
+func (inst *Instance) Call(name string, args ...uint64) (results []uint64, err error) {
+	e, ok := inst.mod.exports[name]
+	if !ok || e.kind != kindFunc || int(e.idx) >= len(inst.mod.funcTypes) {
+		return nil, fmt.Errorf("no exported function %q", name)
+	}
+	ft := inst.mod.types[inst.mod.funcTypes[e.idx]]
+	if len(args) != len(ft.Params) {
+		return nil, fmt.Errorf("%s: got %d arguments, want %d", name, len(args), len(ft.Params))
+	}
+
+	inst.fuel = inst.maxFuel
+	err = inst.protect(func() {
+		results = inst.invoke(e.idx, args)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return results, nil
+}
+
+// protect runs fn, converting traps (and faults from malformed code)
+// into errors.
+func (inst *Instance) protect(fn func()) (err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		inst.depth = 0
+		switch x := r.(type) {
+		case *Trap:
+			err = x
+		case error:
+			if errors.Is(x, ErrFuelExhausted) {
+				err = x
+				return
+			}
+			var re runtime.Error
+			if errors.As(x, &re) {
+				err = &Trap{Reason: "invalid module: " + re.Error()}
+				return
+			}
+			err = x
+		default:
+			panic(r)
+		}
+	}()
+	fn()
+	return nil
+}
+
+// invoke calls function fidx (host or defined) with args.
+func (inst *Instance) invoke(fidx uint32, args []uint64) []uint64 {
+	m := inst.mod
+	if int(fidx) < len(inst.hosts) {
+		return inst.hosts[fidx](inst, args)
+	}
+
+	inst.depth++
+	if inst.depth > maxCallDepth {
+		trap("call stack exhausted")
+	}
+	defer func() { inst.depth-- }()
+
+	ft := m.types[m.funcTypes[fidx]]
+	c := m.codes[int(fidx)-len(inst.hosts)]
+
+	locals := make([]uint64, len(ft.Params)+len(c.locals))
+	copy(locals, args)
+	return inst.execute(c, len(ft.Results), locals)
+}
+
+// growMemory implements memory.grow, returning the old size in pages
+// or -1 on failure.
+func (inst *Instance) growMemory(delta uint32) int32 {
+	old := uint32(len(inst.mem) / pageSize)
+	if uint64(old)+uint64(delta) > uint64(inst.maxPages) || uint64(old)+uint64(delta) > math.MaxInt32/pageSize {
+		return -1
+	}
+	inst.mem = append(inst.mem, make([]byte, int(delta)*pageSize)...)
+	return int32(old)
+}
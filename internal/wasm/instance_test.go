@@ -0,0 +1,195 @@
+package wasm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// hostModule imports env.add(i32, i32) -> i32 and exports f, which calls
+// it with its two arguments.
+func hostModule() []byte {
+	sig := []ValType{I32, I32}
+	return cat(
+		magic,
+		section(1, funcType(sig, []ValType{I32})),
+		section(2, cat(name("env"), name("add"), []byte{kindFunc}, uleb(0))),
+		section(3, uleb(0)),
+		section(7, exportFunc("f", 1)),
+		section(10, funcBody(nil, op(0x20, 0, 0x20, 1, 0x10, 0))),
+	)
+}
+
+func TestInstantiate_Imports(t *testing.T) {
+	m, err := Compile(hostModule())
+	if err != nil {
+		t.Fatalf("Compile() error: %v", err)
+	}
+
+	if imps := m.Imports(); len(imps) != 1 || imps[0].Module != "env" || imps[0].Name != "add" {
+		t.Errorf("Imports() = %+v", imps)
+	}
+
+	add := HostFunction{
+		Type: FuncType{Params: []ValType{I32, I32}, Results: []ValType{I32}},
+		Fn: func(_ *Instance, args []uint64) []uint64 {
+			return []uint64{args[0] + args[1]}
+		},
+	}
+
+	t.Run("resolved", func(t *testing.T) {
+		inst, err := Instantiate(m, Imports{"env.add": add})
+		if err != nil {
+			t.Fatalf("Instantiate() error: %v", err)
+		}
+		got, err := inst.Call("f", 4, 5)
+		if err != nil {
+			t.Fatalf("Call() error: %v", err)
+		}
+		if got[0] != 9 {
+			t.Errorf("Call() = %d, want 9", got[0])
+		}
+	})
+
+	t.Run("unresolved", func(t *testing.T) {
+		if _, err := Instantiate(m, nil); err == nil || !strings.Contains(err.Error(), "unresolved import env.add") {
+			t.Errorf("Instantiate() error = %v", err)
+		}
+	})
+
+	t.Run("type mismatch", func(t *testing.T) {
+		bad := add
+		bad.Type = FuncType{Params: []ValType{I64}}
+		if _, err := Instantiate(m, Imports{"env.add": bad}); err == nil || !strings.Contains(err.Error(), "does not match") {
+			t.Errorf("Instantiate() error = %v", err)
+		}
+	})
+}
+
+func TestInstantiate_DataAndStart(t *testing.T) {
+	// A global counter set by the start function, a data segment at
+	// offset 16, and an exported getter for the global.
+	mod := cat(
+		magic,
+		section(1, funcType(nil, nil), funcType(nil, []ValType{I32})),
+		section(3, uleb(0), uleb(1)),
+		section(5, []byte{0x00, 0x01}),
+		section(6, cat([]byte{byte(I32), 1}, i32c(0), op(0x0b))),
+		section(7, exportFunc("get", 1), cat(name("memory"), []byte{kindMemory, 0})),
+		[]byte{8, 1, 0}, // start: function 0
+		section(10,
+			funcBody(nil, i32c(42), op(0x24, 0)),
+			funcBody(nil, op(0x23, 0)),
+		),
+		section(11, cat(uleb(0), i32c(16), op(0x0b), name("hello"))),
+	)
+
+	m, err := Compile(mod)
+	if err != nil {
+		t.Fatalf("Compile() error: %v", err)
+	}
+	inst, err := Instantiate(m, nil)
+	if err != nil {
+		t.Fatalf("Instantiate() error: %v", err)
+	}
+
+	got, err := inst.Call("get")
+	if err != nil {
+		t.Fatalf("Call() error: %v", err)
+	}
+	if got[0] != 42 {
+		t.Errorf("global = %d, want 42", got[0])
+	}
+
+	b, err := inst.Read(16, 5)
+	if err != nil {
+		t.Fatalf("Read() error: %v", err)
+	}
+	if string(b) != "hello" {
+		t.Errorf("Read() = %q, want hello", b)
+	}
+}
+
+func TestInstance_Memory(t *testing.T) {
+	m, err := Compile(singleFunc(nil, []ValType{I32}, nil, i32c(1), op(0x40, 0)))
+	if err != nil {
+		t.Fatalf("Compile() error: %v", err)
+	}
+
+	t.Run("read and write", func(t *testing.T) {
+		inst, err := Instantiate(m, nil)
+		if err != nil {
+			t.Fatalf("Instantiate() error: %v", err)
+		}
+		if err := inst.Write(100, []byte("abc")); err != nil {
+			t.Fatalf("Write() error: %v", err)
+		}
+		if got := inst.Memory()[100:103]; !bytes.Equal(got, []byte("abc")) {
+			t.Errorf("Memory() = %q, want abc", got)
+		}
+		if err := inst.Write(pageSize-1, []byte("ab")); err == nil {
+			t.Error("Write() past the end expected error")
+		}
+		if _, err := inst.Read(pageSize, 1); err == nil {
+			t.Error("Read() past the end expected error")
+		}
+	})
+
+	t.Run("grow within limit", func(t *testing.T) {
+		inst, err := Instantiate(m, nil)
+		if err != nil {
+			t.Fatalf("Instantiate() error: %v", err)
+		}
+		got, err := inst.Call("f")
+		if err != nil {
+			t.Fatalf("Call() error: %v", err)
+		}
+		if got[0] != 1 || len(inst.Memory()) != 2*pageSize {
+			t.Errorf("memory.grow = %d, size %d", int32(got[0]), len(inst.Memory()))
+		}
+	})
+
+	t.Run("grow past limit", func(t *testing.T) {
+		inst, err := Instantiate(m, nil, WithMaxPages(1))
+		if err != nil {
+			t.Fatalf("Instantiate() error: %v", err)
+		}
+		got, err := inst.Call("f")
+		if err != nil {
+			t.Fatalf("Call() error: %v", err)
+		}
+		if int32(got[0]) != -1 {
+			t.Errorf("memory.grow = %d, want -1", int32(got[0]))
+		}
+	})
+
+	t.Run("initial size over limit", func(t *testing.T) {
+		if _, err := Instantiate(m, nil, WithMaxPages(0)); err == nil {
+			t.Error("Instantiate() expected error")
+		}
+	})
+}
+
+func TestInstance_CallErrors(t *testing.T) {
+	m, err := Compile(singleFunc([]ValType{I32}, nil, nil))
+	if err != nil {
+		t.Fatalf("Compile() error: %v", err)
+	}
+	inst, err := Instantiate(m, nil)
+	if err != nil {
+		t.Fatalf("Instantiate() error: %v", err)
+	}
+
+	if _, err := inst.Call("missing"); err == nil {
+		t.Error("Call(missing) expected error")
+	}
+	if _, err := inst.Call("memory"); err == nil {
+		t.Error("Call(memory) expected error")
+	}
+	if _, err := inst.Call("f"); err == nil {
+		t.Error("Call(f) with wrong arity expected error")
+	}
+	if _, err := inst.Call("f", 1); err != nil {
+		t.Errorf("Call(f, 1) error: %v", err)
+	}
+}
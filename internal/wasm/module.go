@@ -0,0 +1,685 @@
+// Package wasm implements a small, sandboxed WebAssembly interpreter
+// used to run user plugins without cgo or external runtimes.
+//
+// It supports the WebAssembly 1.0 instruction set plus the sign-extension,
+// saturating-truncation and bulk-memory extensions. Modules may import
+// host functions but not memories, tables or globals. Every call runs
+// under an instruction budget and memory growth is capped, so a faulty
+// plugin traps instead of hanging or exhausting the host.
+package wasm
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+)
+
+// ValType is a WebAssembly value type.
+type ValType byte
+
+// Value types.
+const (
+	I32 ValType = 0x7f
+	I64 ValType = 0x7e
+	F32 ValType = 0x7d
+	F64 ValType = 0x7c
+)
+
+func (t ValType) String() string {
+	switch t {
+	case I32:
+		return "i32"
+	case I64:
+		return "i64"
+	case F32:
+		return "f32"
+	case F64:
+		return "f64"
+	}
+	return fmt.Sprintf("valtype(0x%02x)", byte(t))
+}
+
+// FuncType is a function signature.
+type FuncType struct {
+	Params  []ValType
+	Results []ValType
+}
+
+func (ft FuncType) String() string {
+	return fmt.Sprintf("%v -> %v", ft.Params, ft.Results)
+}
+
+func (ft FuncType) equal(other FuncType) bool {
+	return bytes.Equal(valBytes(ft.Params), valBytes(other.Params)) &&
+		bytes.Equal(valBytes(ft.Results), valBytes(other.Results))
+}
+
+func valBytes(ts []ValType) []byte {
+	b := make([]byte, len(ts))
+	for i, t := range ts {
+		b[i] = byte(t)
+	}
+	return b
+}
+
+// External kinds used by imports and exports.
+const (
+	kindFunc   = 0x00
+	kindTable  = 0x01
+	kindMemory = 0x02
+	kindGlobal = 0x03
+)
+
+// Import is a function the module expects the host to provide.
+type Import struct {
+	Module string
+	Name   string
+	Type   FuncType
+}
+
+type globalDef struct {
+	typ     ValType
+	mutable bool
+	init    uint64
+}
+
+type export struct {
+	kind byte
+	idx  uint32
+}
+
+// blockInfo records where a block's else and end opcodes are.
+type blockInfo struct {
+	els int // position of the else opcode, or -1
+	end int // position of the end opcode
+}
+
+// code is the body of a defined function.
+type code struct {
+	locals []ValType
+	body   []byte
+	blocks map[int]blockInfo
+}
+
+type elemSegment struct {
+	offset uint32
+	funcs  []uint32
+}
+
+type dataSegment struct {
+	active bool
+	offset uint32
+	init   []byte
+}
+
+// Module is a decoded WebAssembly module. Only function imports are
+// supported; a module may define (not import) one memory and one table.
+type Module struct {
+	types     []FuncType
+	imports   []Import
+	funcTypes []uint32 // type index for every function, imports first
+	codes     []*code
+
+	hasTable bool
+	tableMin uint32
+
+	hasMemory bool
+	memMin    uint32
+	memMax    uint32 // math.MaxUint32 when unbounded
+
+	globals []globalDef
+	exports map[string]export
+	start   int // function index, or -1
+	elems   []elemSegment
+	data    []dataSegment
+}
+
+// magic and version begin every binary module.
+var magic = []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}
+
+// Compile decodes a binary module.
+func Compile(data []byte) (*Module, error) {
+	if !bytes.HasPrefix(data, magic) {
+		return nil, fmt.Errorf("not a WebAssembly 1.0 binary module")
+	}
+
+	m := &Module{exports: make(map[string]export), start: -1}
+	r := &reader{data: data, pos: len(magic)}
+
+	for !r.eof() {
+		id, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		payload, err := r.bytes(int(size))
+		if err != nil {
+			return nil, err
+		}
+		if err := m.decodeSection(id, &reader{data: payload}); err != nil {
+			return nil, fmt.Errorf("section %d: %w", id, err)
+		}
+	}
+
+	if len(m.codes) != len(m.funcTypes)-len(m.imports) {
+		return nil, fmt.Errorf("function and code section sizes differ")
+	}
+	return m, nil
+}
+
+// Imports lists the functions the module imports.
+func (m *Module) Imports() []Import {
+	return append([]Import(nil), m.imports...)
+}
+
+// ExportedFunc returns the signature of an exported function.
+func (m *Module) ExportedFunc(name string) (FuncType, bool) {
+	e, ok := m.exports[name]
+	if !ok || e.kind != kindFunc || int(e.idx) >= len(m.funcTypes) {
+		return FuncType{}, false
+	}
+	return m.types[m.funcTypes[e.idx]], true
+}
+
+// HasMemoryExport reports whether the module exports its memory as name.
+func (m *Module) HasMemoryExport(name string) bool {
+	e, ok := m.exports[name]
+	return ok && e.kind == kindMemory
+}
+
+func (m *Module) decodeSection(id byte, r *reader) error {
+	switch id {
+	case 0: // custom
+		return nil
+	case 1:
+		return m.decodeTypes(r)
+	case 2:
+		return m.decodeImports(r)
+	case 3:
+		return m.decodeFunctions(r)
+	case 4:
+		return m.decodeTables(r)
+	case 5:
+		return m.decodeMemory(r)
+	case 6:
+		return m.decodeGlobals(r)
+	case 7:
+		return m.decodeExports(r)
+	case 8:
+		idx, err := r.u32()
+		m.start = int(idx)
+		return err
+	case 9:
+		return m.decodeElements(r)
+	case 10:
+		return m.decodeCode(r)
+	case 11:
+		return m.decodeData(r)
+	case 12: // data count
+		_, err := r.u32()
+		return err
+	}
+	return fmt.Errorf("unknown section")
+}
+
+// vec reads a count and calls fn that many times.
+func vec(r *reader, fn func(i int) error) error {
+	n, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < int(n); i++ {
+		if err := fn(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readValType(r *reader) (ValType, error) {
+	b, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	switch t := ValType(b); t {
+	case I32, I64, F32, F64:
+		return t, nil
+	}
+	return 0, fmt.Errorf("unsupported value type 0x%02x", b)
+}
+
+func (m *Module) decodeTypes(r *reader) error {
+	return vec(r, func(int) error {
+		form, err := r.byte()
+		if err != nil {
+			return err
+		}
+		if form != 0x60 {
+			return fmt.Errorf("invalid function type form 0x%02x", form)
+		}
+		var ft FuncType
+		if err := vec(r, func(int) error {
+			t, err := readValType(r)
+			ft.Params = append(ft.Params, t)
+			return err
+		}); err != nil {
+			return err
+		}
+		if err := vec(r, func(int) error {
+			t, err := readValType(r)
+			ft.Results = append(ft.Results, t)
+			return err
+		}); err != nil {
+			return err
+		}
+		m.types = append(m.types, ft)
+		return nil
+	})
+}
+
+func (m *Module) typeAt(idx uint32) (FuncType, error) {
+	if int(idx) >= len(m.types) {
+		return FuncType{}, fmt.Errorf("type index %d out of range", idx)
+	}
+	return m.types[idx], nil
+}
+
+func (m *Module) decodeImports(r *reader) error {
+	return vec(r, func(int) error {
+		mod, err := r.name()
+		if err != nil {
+			return err
+		}
+		name, err := r.name()
+		if err != nil {
+			return err
+		}
+		kind, err := r.byte()
+		if err != nil {
+			return err
+		}
+		if kind != kindFunc {
+			return fmt.Errorf("import %s.%s: only function imports are supported", mod, name)
+		}
+		idx, err := r.u32()
+		if err != nil {
+			return err
+		}
+		ft, err := m.typeAt(idx)
+		if err != nil {
+			return err
+		}
+		m.imports = append(m.imports, Import{Module: mod, Name: name, Type: ft})
+		m.funcTypes = append(m.funcTypes, idx)
+		return nil
+	})
+}
+
+func (m *Module) decodeFunctions(r *reader) error {
+	return vec(r, func(int) error {
+		idx, err := r.u32()
+		if err != nil {
+			return err
+		}
+		if _, err := m.typeAt(idx); err != nil {
+			return err
+		}
+		m.funcTypes = append(m.funcTypes, idx)
+		return nil
+	})
+}
+
+// readLimits reads a min and optional max.
+func readLimits(r *reader) (minimum, maximum uint32, err error) {
+	flag, err := r.byte()
+	if err != nil {
+		return 0, 0, err
+	}
+	if minimum, err = r.u32(); err != nil {
+		return 0, 0, err
+	}
+	maximum = math.MaxUint32
+	if flag&1 != 0 {
+		if maximum, err = r.u32(); err != nil {
+			return 0, 0, err
+		}
+	}
+	return minimum, maximum, nil
+}
+
+func (m *Module) decodeTables(r *reader) error {
+	return vec(r, func(i int) error {
+		if i > 0 {
+			return fmt.Errorf("multiple tables are not supported")
+		}
+		elemType, err := r.byte()
+		if err != nil {
+			return err
+		}
+		if elemType != 0x70 {
+			return fmt.Errorf("unsupported table element type 0x%02x", elemType)
+		}
+		m.hasTable = true
+		m.tableMin, _, err = readLimits(r)
+		return err
+	})
+}
+
+func (m *Module) decodeMemory(r *reader) error {
+	return vec(r, func(i int) error {
+		if i > 0 {
+			return fmt.Errorf("multiple memories are not supported")
+		}
+		var err error
+		m.hasMemory = true
+		m.memMin, m.memMax, err = readLimits(r)
+		return err
+	})
+}
+
+// readConstExpr evaluates a constant initializer expression.
+func (m *Module) readConstExpr(r *reader) (uint64, error) {
+	op, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+
+	var v uint64
+	switch op {
+	case 0x41: // i32.const
+		n, err := r.s64()
+		if err != nil {
+			return 0, err
+		}
+		v = uint64(uint32(n))
+	case 0x42: // i64.const
+		n, err := r.s64()
+		if err != nil {
+			return 0, err
+		}
+		v = uint64(n)
+	case 0x43: // f32.const
+		b, err := r.bytes(4)
+		if err != nil {
+			return 0, err
+		}
+		v = uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16 | uint64(b[3])<<24
+	case 0x44: // f64.const
+		b, err := r.bytes(8)
+		if err != nil {
+			return 0, err
+		}
+		for i := 7; i >= 0; i-- {
+			v = v<<8 | uint64(b[i])
+		}
+	case 0x23: // global.get
+		idx, err := r.u32()
+		if err != nil {
+			return 0, err
+		}
+		if int(idx) >= len(m.globals) {
+			return 0, fmt.Errorf("global index %d out of range", idx)
+		}
+		v = m.globals[idx].init
+	default:
+		return 0, fmt.Errorf("unsupported constant expression opcode 0x%02x", op)
+	}
+
+	end, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	if end != 0x0b {
+		return 0, fmt.Errorf("constant expression not terminated")
+	}
+	return v, nil
+}
+
+func (m *Module) decodeGlobals(r *reader) error {
+	return vec(r, func(int) error {
+		t, err := readValType(r)
+		if err != nil {
+			return err
+		}
+		mut, err := r.byte()
+		if err != nil {
+			return err
+		}
+		init, err := m.readConstExpr(r)
+		if err != nil {
+			return err
+		}
+		m.globals = append(m.globals, globalDef{typ: t, mutable: mut == 1, init: init})
+		return nil
+	})
+}
+
+func (m *Module) decodeExports(r *reader) error {
+	return vec(r, func(int) error {
+		name, err := r.name()
+		if err != nil {
+			return err
+		}
+		kind, err := r.byte()
+		if err != nil {
+			return err
+		}
+		idx, err := r.u32()
+		if err != nil {
+			return err
+		}
+		m.exports[name] = export{kind: kind, idx: idx}
+		return nil
+	})
+}
+
+func (m *Module) decodeElements(r *reader) error {
+	return vec(r, func(int) error {
+		flags, err := r.u32()
+		if err != nil {
+			return err
+		}
+		if flags != 0 {
+			return fmt.Errorf("element segment kind %d is not supported", flags)
+		}
+		offset, err := m.readConstExpr(r)
+		if err != nil {
+			return err
+		}
+		seg := elemSegment{offset: uint32(offset)}
+		if err := vec(r, func(int) error {
+			idx, err := r.u32()
+			seg.funcs = append(seg.funcs, idx)
+			return err
+		}); err != nil {
+			return err
+		}
+		m.elems = append(m.elems, seg)
+		return nil
+	})
+}
+
+func (m *Module) decodeData(r *reader) error {
+	return vec(r, func(int) error {
+		flags, err := r.u32()
+		if err != nil {
+			return err
+		}
+
+		var seg dataSegment
+		switch flags {
+		case 0, 2:
+			if flags == 2 {
+				if memIdx, err := r.u32(); err != nil || memIdx != 0 {
+					return fmt.Errorf("data segment for memory other than 0")
+				}
+			}
+			offset, err := m.readConstExpr(r)
+			if err != nil {
+				return err
+			}
+			seg.active = true
+			seg.offset = uint32(offset)
+		case 1: // passive
+		default:
+			return fmt.Errorf("invalid data segment flags %d", flags)
+		}
+
+		n, err := r.u32()
+		if err != nil {
+			return err
+		}
+		if seg.init, err = r.bytes(int(n)); err != nil {
+			return err
+		}
+		m.data = append(m.data, seg)
+		return nil
+	})
+}
+
+func (m *Module) decodeCode(r *reader) error {
+	return vec(r, func(int) error {
+		size, err := r.u32()
+		if err != nil {
+			return err
+		}
+		body, err := r.bytes(int(size))
+		if err != nil {
+			return err
+		}
+		br := &reader{data: body}
+
+		c := &code{}
+		if err := vec(br, func(int) error {
+			n, err := br.u32()
+			if err != nil {
+				return err
+			}
+			t, err := readValType(br)
+			if err != nil {
+				return err
+			}
+			if len(c.locals)+int(n) > maxLocals {
+				return fmt.Errorf("too many locals")
+			}
+			for j := uint32(0); j < n; j++ {
+				c.locals = append(c.locals, t)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		c.body = body[br.pos:]
+		if c.blocks, err = scanBlocks(c.body); err != nil {
+			return err
+		}
+		m.codes = append(m.codes, c)
+		return nil
+	})
+}
+
+// maxLocals bounds the locals a single function may declare.
+const maxLocals = 50000
+
+// scanBlocks walks a function body once and records the matching else
+// and end positions of every block, loop and if, so that branches can
+// jump without rescanning.
+func scanBlocks(body []byte) (blocks map[int]blockInfo, err error) {
+	defer func() {
+		if recover() != nil {
+			err = fmt.Errorf("malformed function body")
+		}
+	}()
+
+	blocks = make(map[int]blockInfo)
+	var open []int
+	pc := 0
+	for pc < len(body) {
+		start := pc
+		op := body[pc]
+		pc++
+
+		switch op {
+		case 0x02, 0x03, 0x04:
+			readS64(body, &pc) // block type
+			open = append(open, start)
+			blocks[start] = blockInfo{els: -1}
+		case 0x05:
+			if len(open) == 0 {
+				return nil, fmt.Errorf("else without if")
+			}
+			top := open[len(open)-1]
+			info := blocks[top]
+			info.els = start
+			blocks[top] = info
+		case 0x0b:
+			if len(open) == 0 {
+				if pc != len(body) {
+					return nil, fmt.Errorf("code after function end")
+				}
+				return blocks, nil
+			}
+			top := open[len(open)-1]
+			open = open[:len(open)-1]
+			info := blocks[top]
+			info.end = start
+			blocks[top] = info
+			if info.els >= 0 {
+				blocks[info.els] = blockInfo{els: -1, end: start}
+			}
+		default:
+			skipImmediates(op, body, &pc)
+		}
+	}
+	return nil, fmt.Errorf("function body not terminated")
+}
+
+// skipImmediates advances pc past the immediates of op (other than
+// block types, which scanBlocks handles).
+func skipImmediates(op byte, body []byte, pc *int) {
+	switch {
+	case op == 0x0c || op == 0x0d || op == 0x10 || (op >= 0x20 && op <= 0x26) || op == 0xd2:
+		readU32(body, pc)
+	case op == 0x0e:
+		n := readU32(body, pc)
+		for i := uint32(0); i <= n; i++ {
+			readU32(body, pc)
+		}
+	case op == 0x11:
+		readU32(body, pc)
+		readU32(body, pc)
+	case op == 0x1c:
+		n := readU32(body, pc)
+		*pc += int(n)
+	case op >= 0x28 && op <= 0x3e:
+		readU32(body, pc)
+		readU32(body, pc)
+	case op == 0x3f || op == 0x40 || op == 0xd0:
+		*pc++
+	case op == 0x41 || op == 0x42:
+		readS64(body, pc)
+	case op == 0x43:
+		*pc += 4
+	case op == 0x44:
+		*pc += 8
+	case op == 0xfc:
+		switch readU32(body, pc) {
+		case 8:
+			readU32(body, pc)
+			*pc++
+		case 9, 13, 15, 16, 17:
+			readU32(body, pc)
+		case 10:
+			*pc += 2
+		case 11:
+			*pc++
+		case 12, 14:
+			readU32(body, pc)
+			readU32(body, pc)
+		}
+	}
+}
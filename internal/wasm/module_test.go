@@ -0,0 +1,168 @@
+package wasm
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Helpers for assembling binary modules in tests.
+
+func uleb(v uint64) []byte {
+	var b []byte
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if v == 0 {
+			return b
+		}
+	}
+}
+
+func sleb(v int64) []byte {
+	var b []byte
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		done := (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0)
+		if !done {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if done {
+			return b
+		}
+	}
+}
+
+func cat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func name(s string) []byte {
+	return cat(uleb(uint64(len(s))), []byte(s))
+}
+
+// section encodes a section holding a vector of items.
+func section(id byte, items ...[]byte) []byte {
+	payload := cat(append([][]byte{uleb(uint64(len(items)))}, items...)...)
+	return cat([]byte{id}, uleb(uint64(len(payload))), payload)
+}
+
+func funcType(params, results []ValType) []byte {
+	return cat([]byte{0x60}, uleb(uint64(len(params))), valBytes(params), uleb(uint64(len(results))), valBytes(results))
+}
+
+// funcBody encodes a code entry; locals is a list of single locals.
+func funcBody(locals []ValType, instrs ...[]byte) []byte {
+	var decl []byte
+	for _, t := range locals {
+		decl = append(decl, 1, byte(t))
+	}
+	body := cat(uleb(uint64(len(locals))), decl, cat(instrs...), []byte{0x0b})
+	return cat(uleb(uint64(len(body))), body)
+}
+
+func exportFunc(n string, idx uint32) []byte {
+	return cat(name(n), []byte{kindFunc}, uleb(uint64(idx)))
+}
+
+func i32c(v int32) []byte { return cat([]byte{0x41}, sleb(int64(v))) }
+func i64c(v int64) []byte { return cat([]byte{0x42}, sleb(v)) }
+func op(b ...byte) []byte { return b }
+
+// singleFunc builds a module with one exported function "f" and one page
+// of memory exported as "memory".
+func singleFunc(params, results, locals []ValType, instrs ...[]byte) []byte {
+	return cat(
+		magic,
+		section(1, funcType(params, results)),
+		section(3, uleb(0)),
+		section(5, []byte{0x00, 0x01}),
+		section(7, exportFunc("f", 0), cat(name("memory"), []byte{kindMemory, 0})),
+		section(10, funcBody(locals, instrs...)),
+	)
+}
+
+func TestCompile(t *testing.T) {
+	m, err := Compile(singleFunc([]ValType{I32, I32}, []ValType{I32}, nil, op(0x20, 0, 0x20, 1, 0x6a)))
+	if err != nil {
+		t.Fatalf("Compile() error: %v", err)
+	}
+
+	ft, ok := m.ExportedFunc("f")
+	if !ok {
+		t.Fatal("ExportedFunc(f) not found")
+	}
+	if len(ft.Params) != 2 || len(ft.Results) != 1 || ft.Results[0] != I32 {
+		t.Errorf("ExportedFunc(f) = %v", ft)
+	}
+	if _, ok := m.ExportedFunc("memory"); ok {
+		t.Error("ExportedFunc(memory) should not report a memory export")
+	}
+	if !m.HasMemoryExport("memory") {
+		t.Error("HasMemoryExport(memory) = false")
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	valid := singleFunc(nil, nil, nil)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "bad magic", data: []byte("\x00asm\x02\x00\x00\x00")},
+		{name: "truncated", data: valid[:len(valid)-3]},
+		{name: "unknown section", data: cat(magic, []byte{0x20, 0x00})},
+		{name: "bad value type", data: cat(magic, section(1, []byte{0x60, 1, 0x55, 0}))},
+		{name: "type index out of range", data: cat(magic, section(3, uleb(4)))},
+		{
+			name: "memory import",
+			data: cat(magic, section(2, cat(name("env"), name("mem"), []byte{kindMemory, 0, 1}))),
+		},
+		{
+			name: "missing code",
+			data: cat(magic, section(1, funcType(nil, nil)), section(3, uleb(0))),
+		},
+		{
+			name: "unterminated body",
+			data: cat(magic, section(1, funcType(nil, nil)), section(3, uleb(0)), section(10, cat(uleb(2), []byte{0, 0x01}))),
+		},
+		{
+			name: "else without if",
+			data: cat(magic, section(1, funcType(nil, nil)), section(3, uleb(0)), section(10, funcBody(nil, op(0x05)))),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Compile(tt.data); err == nil {
+				t.Error("Compile() expected error")
+			}
+		})
+	}
+}
+
+func TestScanBlocks(t *testing.T) {
+	// block; if; else; end; end; end
+	body := []byte{0x02, 0x40, 0x41, 0x01, 0x04, 0x40, 0x05, 0x0b, 0x0b, 0x0b}
+	blocks, err := scanBlocks(body)
+	if err != nil {
+		t.Fatalf("scanBlocks() error: %v", err)
+	}
+
+	if got := blocks[0]; got.end != 8 || got.els != -1 {
+		t.Errorf("block = %+v, want end 8", got)
+	}
+	if got := blocks[4]; got.end != 7 || got.els != 6 {
+		t.Errorf("if = %+v, want else 6, end 7", got)
+	}
+	if got := blocks[6]; got.end != 7 {
+		t.Errorf("else = %+v, want end 7", got)
+	}
+}
@@ -0,0 +1,188 @@
+package wasm
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Plugin entry points. A plugin exports at least one of them.
+const (
+	// PluginTransform receives an entry's fields as a JSON object and
+	// returns an object, an array of objects, or nothing to drop it.
+	PluginTransform = "transform"
+
+	// PluginParse receives a raw log line and returns a JSON object of
+	// fields, or nothing if the line is not in its format.
+	PluginParse = "parse"
+)
+
+var (
+	sigBuffer = FuncType{Params: []ValType{I32, I32}}
+	sigAlloc  = FuncType{Params: []ValType{I32}, Results: []ValType{I32}}
+	sigEntry  = FuncType{Params: []ValType{I32, I32}, Results: []ValType{I64}}
+)
+
+// Plugin is a module implementing the log2json plugin ABI:
+//
+//   - it exports its linear memory as "memory"
+//   - it exports alloc(len i32) -> ptr i32, which reserves len bytes
+//     for the host to write an input into
+//   - it may export dealloc(ptr i32, len i32), called for every input
+//     and output buffer once the host is done with it
+//   - transform and parse take (ptr i32, len i32) and return an i64
+//     packing the output buffer as ptr<<32 | len; a zero length means
+//     no output
+//
+// Plugins may import env.log(ptr i32, len i32) to write a diagnostic
+// line. A Plugin serializes calls and is safe for concurrent use.
+type Plugin struct {
+	mu         sync.Mutex
+	inst       *Instance
+	hasDealloc bool
+	transform  bool
+	parse      bool
+}
+
+// LoadPlugin compiles and instantiates the plugin at path. Messages the
+// plugin logs are written to logOut, which may be nil to discard them.
+func LoadPlugin(path string, logOut io.Writer, opts ...Option) (*Plugin, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path is supplied by the user
+	if err != nil {
+		return nil, err
+	}
+	m, err := Compile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	p, err := NewPlugin(m, logOut, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// NewPlugin checks that m implements the plugin ABI and instantiates it.
+func NewPlugin(m *Module, logOut io.Writer, opts ...Option) (*Plugin, error) {
+	if !m.HasMemoryExport("memory") {
+		return nil, fmt.Errorf("plugin must export its memory as \"memory\"")
+	}
+	if err := checkExport(m, "alloc", sigAlloc, true); err != nil {
+		return nil, err
+	}
+	if err := checkExport(m, "dealloc", sigBuffer, false); err != nil {
+		return nil, err
+	}
+	if err := checkExport(m, PluginTransform, sigEntry, false); err != nil {
+		return nil, err
+	}
+	if err := checkExport(m, PluginParse, sigEntry, false); err != nil {
+		return nil, err
+	}
+
+	p := &Plugin{}
+	_, p.hasDealloc = m.ExportedFunc("dealloc")
+	_, p.transform = m.ExportedFunc(PluginTransform)
+	_, p.parse = m.ExportedFunc(PluginParse)
+	if !p.transform && !p.parse {
+		return nil, fmt.Errorf("plugin must export %s or %s", PluginTransform, PluginParse)
+	}
+
+	imports := Imports{
+		"env.log": {Type: sigBuffer, Fn: func(inst *Instance, args []uint64) []uint64 {
+			msg, err := inst.Read(uint32(args[0]), uint32(args[1]))
+			if err != nil {
+				trap("env.log: %v", err)
+			}
+			if logOut != nil {
+				_, _ = fmt.Fprintf(logOut, "%s\n", msg)
+			}
+			return nil
+		}},
+	}
+	inst, err := Instantiate(m, imports, opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.inst = inst
+	return p, nil
+}
+
+// checkExport verifies the signature of an exported function.
+func checkExport(m *Module, name string, want FuncType, required bool) error {
+	ft, ok := m.ExportedFunc(name)
+	if !ok {
+		if required {
+			return fmt.Errorf("plugin must export %s", name)
+		}
+		return nil
+	}
+	if !ft.equal(want) {
+		return fmt.Errorf("plugin export %s has type %v, want %v", name, ft, want)
+	}
+	return nil
+}
+
+// HasTransform reports whether the plugin exports a transform function.
+func (p *Plugin) HasTransform() bool {
+	return p.transform
+}
+
+// HasParse reports whether the plugin exports a parse function.
+func (p *Plugin) HasParse() bool {
+	return p.parse
+}
+
+// Transform calls the plugin's transform function with a JSON object.
+// A nil result means the plugin returned nothing.
+func (p *Plugin) Transform(fields []byte) ([]byte, error) {
+	return p.call(PluginTransform, fields)
+}
+
+// Parse calls the plugin's parse function with a raw line. A nil result
+// means the line is not in the plugin's format.
+func (p *Plugin) Parse(line []byte) ([]byte, error) {
+	return p.call(PluginParse, line)
+}
+
+// call copies input into plugin memory, invokes fn and copies out the
+// buffer it returns.
+func (p *Plugin) call(fn string, input []byte) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	res, err := p.inst.Call("alloc", uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	ptr := uint32(res[0])
+	if err := p.inst.Write(ptr, input); err != nil {
+		return nil, fmt.Errorf("alloc returned %w", err)
+	}
+
+	res, err = p.inst.Call(fn, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	outPtr, outLen := uint32(res[0]>>32), uint32(res[0])
+
+	var out []byte
+	if outLen > 0 {
+		if out, err = p.inst.Read(outPtr, outLen); err != nil {
+			return nil, fmt.Errorf("%s returned %w", fn, err)
+		}
+	}
+
+	if p.hasDealloc {
+		if _, err := p.inst.Call("dealloc", uint64(ptr), uint64(len(input))); err != nil {
+			return nil, err
+		}
+		if outLen > 0 {
+			if _, err := p.inst.Call("dealloc", uint64(outPtr), uint64(outLen)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out, nil
+}
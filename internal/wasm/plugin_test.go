@@ -0,0 +1,196 @@
+package wasm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// pluginModule assembles a plugin with a bump allocator (heap starting
+// at 1024, a data segment at 0 holding data) and the given transform and
+// parse bodies, each of type (ptr i32, len i32) -> i64. A nil body omits
+// the export. Function 0 is the env.log import.
+func pluginModule(data string, transform, parse [][]byte) []byte {
+	exports := [][]byte{
+		cat(name("memory"), []byte{kindMemory, 0}),
+		exportFunc("alloc", 1),
+	}
+	funcs := [][]byte{uleb(0)}
+	bodies := [][]byte{funcBody(nil, op(0x23, 0, 0x23, 0, 0x20, 0, 0x6a, 0x24, 0))}
+	for _, fn := range []struct {
+		name string
+		body [][]byte
+	}{{PluginTransform, transform}, {PluginParse, parse}} {
+		if fn.body == nil {
+			continue
+		}
+		exports = append(exports, exportFunc(fn.name, uint32(len(funcs)+1)))
+		funcs = append(funcs, uleb(1))
+		bodies = append(bodies, funcBody(nil, fn.body...))
+	}
+
+	return cat(
+		magic,
+		section(1, funcType([]ValType{I32}, []ValType{I32}), funcType([]ValType{I32, I32}, []ValType{I64}), funcType([]ValType{I32, I32}, nil)),
+		section(2, cat(name("env"), name("log"), []byte{kindFunc}, uleb(2))),
+		section(3, funcs...),
+		section(5, []byte{0x00, 0x01}),
+		section(6, cat([]byte{byte(I32), 1}, i32c(1024), op(0x0b))),
+		section(7, exports...),
+		section(10, bodies...),
+		section(11, cat(uleb(0), i32c(0), op(0x0b), name(data))),
+	)
+}
+
+// Plugin function bodies used in tests.
+var (
+	// pack returns the input buffer: ptr<<32 | len.
+	pack = [][]byte{op(0x20, 0, 0xad), i64c(32), op(0x86, 0x20, 1, 0xad, 0x84)}
+
+	// logAndEcho logs the input, then returns it.
+	logAndEcho = append([][]byte{op(0x20, 0, 0x20, 1, 0x10, 0)}, pack...)
+
+	// echoObjects returns the input if it starts with '{', else nothing.
+	echoObjects = append([][]byte{
+		op(0x20, 0, 0x2d, 0, 0), i32c('{'), op(0x47, 0x04, 0x40), i64c(0), op(0x0f, 0x0b),
+	}, pack...)
+)
+
+// returnData returns the n-byte data segment at offset 0.
+func returnData(n int) [][]byte {
+	return [][]byte{i64c(int64(n))}
+}
+
+func TestPlugin(t *testing.T) {
+	m, err := Compile(pluginModule("", logAndEcho, echoObjects))
+	if err != nil {
+		t.Fatalf("Compile() error: %v", err)
+	}
+	var log bytes.Buffer
+	p, err := NewPlugin(m, &log)
+	if err != nil {
+		t.Fatalf("NewPlugin() error: %v", err)
+	}
+	if !p.HasTransform() || !p.HasParse() {
+		t.Fatalf("HasTransform() = %v, HasParse() = %v", p.HasTransform(), p.HasParse())
+	}
+
+	for i := 0; i < 3; i++ {
+		out, err := p.Transform([]byte(`{"a":1}`))
+		if err != nil {
+			t.Fatalf("Transform() error: %v", err)
+		}
+		if string(out) != `{"a":1}` {
+			t.Errorf("Transform() = %q", out)
+		}
+	}
+	if got := strings.Count(log.String(), "{\"a\":1}\n"); got != 3 {
+		t.Errorf("log = %q, want 3 lines", log.String())
+	}
+
+	out, err := p.Parse([]byte(`{"b":2}`))
+	if err != nil || string(out) != `{"b":2}` {
+		t.Errorf("Parse() = %q, %v", out, err)
+	}
+	out, err = p.Parse([]byte("plain text"))
+	if err != nil || out != nil {
+		t.Errorf("Parse() = %q, %v, want no output", out, err)
+	}
+}
+
+func TestPlugin_ReturnData(t *testing.T) {
+	const result = `[{"x":1},{"x":2}]`
+	m, err := Compile(pluginModule(result, returnData(len(result)), nil))
+	if err != nil {
+		t.Fatalf("Compile() error: %v", err)
+	}
+	p, err := NewPlugin(m, nil)
+	if err != nil {
+		t.Fatalf("NewPlugin() error: %v", err)
+	}
+	if p.HasParse() {
+		t.Error("HasParse() = true for a transform-only plugin")
+	}
+	out, err := p.Transform([]byte(`{}`))
+	if err != nil || string(out) != result {
+		t.Errorf("Transform() = %q, %v", out, err)
+	}
+}
+
+func TestNewPlugin_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		mod     []byte
+		wantErr string
+	}{
+		{
+			name:    "no entry points",
+			mod:     pluginModule("", nil, nil),
+			wantErr: "must export transform or parse",
+		},
+		{
+			name:    "no alloc",
+			mod:     singleFunc(nil, nil, nil),
+			wantErr: "must export alloc",
+		},
+		{
+			name: "no memory",
+			mod: cat(magic,
+				section(1, funcType(nil, nil)),
+				section(3, uleb(0)),
+				section(7, exportFunc("transform", 0)),
+				section(10, funcBody(nil)),
+			),
+			wantErr: "memory",
+		},
+		{
+			name: "wrong signature",
+			mod: cat(magic,
+				section(1, funcType(nil, nil)),
+				section(3, uleb(0)),
+				section(5, []byte{0x00, 0x01}),
+				section(7, exportFunc("alloc", 0), cat(name("memory"), []byte{kindMemory, 0})),
+				section(10, funcBody(nil)),
+			),
+			wantErr: "export alloc has type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Compile(tt.mod)
+			if err != nil {
+				t.Fatalf("Compile() error: %v", err)
+			}
+			if _, err := NewPlugin(m, nil); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewPlugin() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPlugin_Trap(t *testing.T) {
+	m, err := Compile(pluginModule("", [][]byte{op(0x00)}, nil))
+	if err != nil {
+		t.Fatalf("Compile() error: %v", err)
+	}
+	p, err := NewPlugin(m, nil)
+	if err != nil {
+		t.Fatalf("NewPlugin() error: %v", err)
+	}
+	if _, err := p.Transform([]byte(`{}`)); err == nil || !strings.Contains(err.Error(), "unreachable") {
+		t.Errorf("Transform() error = %v, want trap", err)
+	}
+
+	// Out-of-bounds results are reported rather than read.
+	m, err = Compile(pluginModule("", [][]byte{i64c(-1)}, nil))
+	if err != nil {
+		t.Fatalf("Compile() error: %v", err)
+	}
+	if p, err = NewPlugin(m, nil); err != nil {
+		t.Fatalf("NewPlugin() error: %v", err)
+	}
+	if _, err := p.Transform([]byte(`{}`)); err == nil || !strings.Contains(err.Error(), "out of bounds") {
+		t.Errorf("Transform() error = %v, want out of bounds", err)
+	}
+}
@@ -0,0 +1,528 @@
+// Package yaml reads the subset of YAML used by log2json's configuration
+// files: block mappings and sequences, flow collections ([a, b] and
+// {k: v}), plain, quoted and block (| and >) scalars, and comments.
+//
+// Example:
+//
+//	patterns:
+//	  myapp:
+//	    regex: '^(?P<time>\S+) \[(?P<level>\w+)\] (?P<msg>.*)$'
+//	    priority: 10
+//	  tags: [web, "api v2"]
+//
+// Anchors, aliases, tags, multi-line flow collections and multiple
+// documents are not supported. Plain scalars resolve as in the YAML 1.2
+// core schema: null, booleans, integers and floats; everything else, and
+// every quoted scalar, is a string.
+package yaml
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Unmarshal parses a document into map[string]any, []any, string, int64,
+// float64, bool or nil values. An empty document is nil.
+func Unmarshal(data []byte) (any, error) {
+	p := &parser{}
+	started := false
+	for i, text := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if i == 0 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		if strings.TrimRight(text, " ") == "---" && !started {
+			continue
+		}
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.TrimSpace(trimmed) == "" {
+			trimmed = ""
+		} else if trimmed[0] == '\t' {
+			return nil, fmt.Errorf("line %d: tabs cannot be used for indentation", i+1)
+		}
+		started = started || (trimmed != "" && trimmed[0] != '#')
+		p.lines = append(p.lines, line{num: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+
+	p.skipBlank()
+	if p.done() {
+		return nil, nil
+	}
+	v, err := p.block(p.cur().indent)
+	if err != nil {
+		return nil, err
+	}
+	p.skipBlank()
+	if !p.done() {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return v, nil
+}
+
+// line is one source line, its indentation split off.
+type line struct {
+	num    int
+	indent int
+	text   string
+}
+
+// blank reports whether the line holds nothing but a comment.
+func (l line) blank() bool {
+	return l.text == "" || l.text[0] == '#'
+}
+
+// item reports whether the line starts a sequence item.
+func (l line) item() bool {
+	return l.text == "-" || strings.HasPrefix(l.text, "- ")
+}
+
+type parser struct {
+	lines []line
+	pos   int
+}
+
+func (p *parser) done() bool { return p.pos >= len(p.lines) }
+func (p *parser) cur() *line { return &p.lines[p.pos] }
+
+func (p *parser) skipBlank() {
+	for !p.done() && p.cur().blank() {
+		p.pos++
+	}
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	num := len(p.lines)
+	if !p.done() {
+		num = p.cur().num
+	}
+	return fmt.Errorf("line %d: %s", num, fmt.Sprintf(format, args...))
+}
+
+// block parses the mapping or sequence starting at the current line,
+// whose entries are indented by indent.
+func (p *parser) block(indent int) (any, error) {
+	if p.cur().item() {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func (p *parser) mapping(indent int) (map[string]any, error) {
+	m := make(map[string]any)
+	for p.skipBlank(); !p.done(); p.skipBlank() {
+		l := p.cur()
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		if l.item() {
+			return nil, p.errorf("sequence item in a mapping")
+		}
+		key, rest, err := splitKey(l.text)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		if _, dup := m[key]; dup {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		p.pos++
+		v, err := p.value(rest, indent, true)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+func (p *parser) sequence(indent int) ([]any, error) {
+	s := []any{}
+	for p.skipBlank(); !p.done(); p.skipBlank() {
+		l := p.cur()
+		if l.indent < indent || (l.indent == indent && !l.item()) {
+			break
+		}
+		if l.indent > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		content := strings.TrimLeft(l.text[1:], " ")
+		if content != "" && content[0] != '#' && isMappingEntry(content) {
+			// "- key: value" starts a mapping indented to its first key
+			l.indent += len(l.text) - len(content)
+			l.text = content
+			m, err := p.mapping(l.indent)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, m)
+			continue
+		}
+		p.pos++
+		v, err := p.value(content, indent, false)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, v)
+	}
+	return s, nil
+}
+
+// value parses what follows a key or a sequence dash: an inline scalar
+// or flow collection, a block scalar, or a nested block on the next
+// lines. A sequence may sit at the same indentation as its key.
+func (p *parser) value(rest string, indent int, inMapping bool) (any, error) {
+	if rest == "" || rest[0] == '#' {
+		p.skipBlank()
+		if p.done() {
+			return nil, nil
+		}
+		next := p.cur()
+		if next.indent > indent || (inMapping && next.indent == indent && next.item()) {
+			return p.block(next.indent)
+		}
+		return nil, nil
+	}
+	if rest[0] == '|' || rest[0] == '>' {
+		return p.blockScalar(rest, indent)
+	}
+	v, err := scalar(rest)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %v", p.lines[p.pos-1].num, err)
+	}
+	return v, nil
+}
+
+// blockScalar reads a literal (|) or folded (>) scalar from the lines
+// indented past indent. A "-" indicator strips the final newline.
+func (p *parser) blockScalar(header string, indent int) (string, error) {
+	style := header[0]
+	chomp := stripComment(header[1:])
+	if chomp != "" && chomp != "-" {
+		return "", fmt.Errorf("line %d: unsupported block scalar indicator %q", p.lines[p.pos-1].num, header)
+	}
+
+	var lines []string
+	contentIndent := -1
+	for ; !p.done(); p.pos++ {
+		l := p.cur()
+		if l.text == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if contentIndent < 0 {
+			if l.indent <= indent {
+				break
+			}
+			contentIndent = l.indent
+		}
+		if l.indent < contentIndent {
+			break
+		}
+		lines = append(lines, strings.Repeat(" ", l.indent-contentIndent)+l.text)
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return "", nil
+	}
+
+	var text string
+	if style == '|' {
+		text = strings.Join(lines, "\n")
+	} else {
+		var b strings.Builder
+		for i, l := range lines {
+			switch {
+			case i == 0:
+			case l == "":
+				b.WriteByte('\n')
+			case lines[i-1] == "":
+				// already separated by the blank line
+			case strings.HasPrefix(l, " ") || strings.HasPrefix(lines[i-1], " "):
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(' ')
+			}
+			b.WriteString(l)
+		}
+		text = b.String()
+	}
+	if chomp != "-" {
+		text += "\n"
+	}
+	return text, nil
+}
+
+// isMappingEntry reports whether text is a "key: value" line.
+func isMappingEntry(text string) bool {
+	if text[0] == '[' || text[0] == '{' {
+		return false
+	}
+	_, _, err := splitKey(text)
+	return err == nil
+}
+
+// splitKey splits "key: rest" at the first colon followed by a space or
+// the end of the line. Keys may be quoted.
+func splitKey(text string) (key, rest string, err error) {
+	if text[0] == '"' || text[0] == '\'' {
+		key, n, err := quoted(text)
+		if err != nil {
+			return "", "", err
+		}
+		after := strings.TrimLeft(text[n:], " ")
+		if !strings.HasPrefix(after, ":") || (len(after) > 1 && after[1] != ' ') {
+			return "", "", fmt.Errorf("expected ':' after key %q", key)
+		}
+		return key, strings.TrimSpace(after[1:]), nil
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '#' && i > 0 && text[i-1] == ' ' {
+			break
+		}
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			key = strings.TrimSpace(text[:i])
+			if key == "" {
+				break
+			}
+			return key, strings.TrimSpace(text[i+1:]), nil
+		}
+	}
+	return "", "", fmt.Errorf("expected 'key: value', got %q", text)
+}
+
+// scalar parses an inline value: a flow collection, a quoted scalar or
+// a plain one, followed at most by a comment.
+func scalar(text string) (any, error) {
+	switch text[0] {
+	case '[', '{':
+		f := &flow{src: text}
+		v, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		if rest := stripComment(f.src[f.pos:]); rest != "" {
+			return nil, fmt.Errorf("unexpected %q after flow collection", rest)
+		}
+		return v, nil
+	case '"', '\'':
+		s, n, err := quoted(text)
+		if err != nil {
+			return nil, err
+		}
+		if rest := stripComment(text[n:]); rest != "" {
+			return nil, fmt.Errorf("unexpected %q after quoted string", rest)
+		}
+		return s, nil
+	}
+	return resolve(stripComment(text)), nil
+}
+
+// stripComment drops a trailing " #" comment and surrounding spaces.
+func stripComment(text string) string {
+	if strings.HasPrefix(text, "#") {
+		return ""
+	}
+	if i := strings.Index(text, " #"); i >= 0 {
+		text = text[:i]
+	}
+	return strings.TrimSpace(text)
+}
+
+// quoted parses the quoted scalar at the start of text and returns it
+// with the number of bytes consumed.
+func quoted(text string) (string, int, error) {
+	q := text[0]
+	if q == '\'' {
+		var b strings.Builder
+		for i := 1; i < len(text); i++ {
+			if text[i] != '\'' {
+				b.WriteByte(text[i])
+				continue
+			}
+			if i+1 < len(text) && text[i+1] == '\'' {
+				b.WriteByte('\'')
+				i++
+				continue
+			}
+			return b.String(), i + 1, nil
+		}
+		return "", 0, fmt.Errorf("unterminated string %s", text)
+	}
+
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '"':
+			s, err := strconv.Unquote(text[:i+1])
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid string %s", text[:i+1])
+			}
+			return s, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string %s", text)
+}
+
+// resolve types a plain scalar.
+func resolve(s string) any {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	case ".inf", "+.inf", ".Inf", "+.Inf":
+		return math.Inf(1)
+	case "-.inf", "-.Inf":
+		return math.Inf(-1)
+	case ".nan", ".NaN":
+		return math.NaN()
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if hex, ok := strings.CutPrefix(s, "0x"); ok {
+		if i, err := strconv.ParseInt(hex, 16, 64); err == nil {
+			return i
+		}
+	}
+	if oct, ok := strings.CutPrefix(s, "0o"); ok {
+		if i, err := strconv.ParseInt(oct, 8, 64); err == nil {
+			return i
+		}
+	}
+	if isDecimal(s) {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return s
+}
+
+// isDecimal reports whether s is made of digits, a sign, a point and an
+// exponent, so that ParseFloat's "inf", "nan" and hex forms stay strings.
+func isDecimal(s string) bool {
+	digits := false
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			digits = true
+		case c == '+' || c == '-' || c == '.' || c == 'e' || c == 'E':
+		default:
+			return false
+		}
+	}
+	return digits
+}
+
+// flow parses a single-line flow collection.
+type flow struct {
+	src string
+	pos int
+}
+
+func (f *flow) skipSpace() {
+	for f.pos < len(f.src) && f.src[f.pos] == ' ' {
+		f.pos++
+	}
+}
+
+func (f *flow) value() (any, error) {
+	f.skipSpace()
+	if f.pos >= len(f.src) {
+		return nil, fmt.Errorf("unterminated flow collection %s", f.src)
+	}
+	switch f.src[f.pos] {
+	case '[':
+		return f.sequence()
+	case '{':
+		return f.mapping()
+	case '"', '\'':
+		s, n, err := quoted(f.src[f.pos:])
+		f.pos += n
+		return s, err
+	}
+	start := f.pos
+	for f.pos < len(f.src) && !strings.ContainsRune(",]}", rune(f.src[f.pos])) {
+		if f.src[f.pos] == ':' && f.pos+1 < len(f.src) && f.src[f.pos+1] == ' ' {
+			break
+		}
+		f.pos++
+	}
+	return resolve(strings.TrimSpace(f.src[start:f.pos])), nil
+}
+
+func (f *flow) sequence() ([]any, error) {
+	f.pos++ // [
+	s := []any{}
+	for {
+		f.skipSpace()
+		if f.pos < len(f.src) && f.src[f.pos] == ']' {
+			f.pos++
+			return s, nil
+		}
+		v, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, v)
+		if err := f.separator(']'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (f *flow) mapping() (map[string]any, error) {
+	f.pos++ // {
+	m := make(map[string]any)
+	for {
+		f.skipSpace()
+		if f.pos < len(f.src) && f.src[f.pos] == '}' {
+			f.pos++
+			return m, nil
+		}
+		k, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			key = fmt.Sprint(k)
+		}
+		f.skipSpace()
+		if f.pos >= len(f.src) || f.src[f.pos] != ':' {
+			return nil, fmt.Errorf("expected ':' after key %q in %s", key, f.src)
+		}
+		f.pos++
+		v, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+		if err := f.separator('}'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// separator consumes the ',' between items, leaving a closing bracket.
+func (f *flow) separator(end byte) error {
+	f.skipSpace()
+	if f.pos < len(f.src) {
+		switch f.src[f.pos] {
+		case ',':
+			f.pos++
+			return nil
+		case end:
+			return nil
+		}
+	}
+	return fmt.Errorf("expected ',' or '%c' in %s", end, f.src)
+}
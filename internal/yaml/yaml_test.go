@@ -0,0 +1,151 @@
+package yaml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want any
+	}{
+		{name: "empty", src: "# nothing\n", want: nil},
+		{
+			name: "scalars",
+			src: `
+str: hello world   # comment
+int: 42
+neg: -7
+hex: 0x1F
+float: 1.5
+bool: true
+null: ~
+empty:
+single: 'it''s # not a comment'
+double: "tab\there"
+version: 1.2.3
+url: http://example.com:8080/x
+`,
+			want: map[string]any{
+				"str": "hello world", "int": int64(42), "neg": int64(-7), "hex": int64(31),
+				"float": 1.5, "bool": true, "null": nil, "empty": nil,
+				"single": "it's # not a comment", "double": "tab\there",
+				"version": "1.2.3", "url": "http://example.com:8080/x",
+			},
+		},
+		{
+			name: "nested",
+			src: `
+---
+patterns:
+  myapp:
+    regex: '^(?P<msg>.*)$'
+    priority: 10
+  other:
+    dissect: "%{a} %{b}"
+`,
+			want: map[string]any{"patterns": map[string]any{
+				"myapp": map[string]any{"regex": "^(?P<msg>.*)$", "priority": int64(10)},
+				"other": map[string]any{"dissect": "%{a} %{b}"},
+			}},
+		},
+		{
+			name: "sequences",
+			src: `
+inputs:
+  - a.log
+  - "b c.log"
+outputs:
+- -
+- stdout
+routes:
+  - expr: status >= 500
+    to: errors.ndjson
+  - expr: default
+    to: stdout
+nested:
+  -
+    - 1
+    - 2
+`,
+			want: map[string]any{
+				"inputs":  []any{"a.log", "b c.log"},
+				"outputs": []any{"-", "stdout"},
+				"routes": []any{
+					map[string]any{"expr": "status >= 500", "to": "errors.ndjson"},
+					map[string]any{"expr": "default", "to": "stdout"},
+				},
+				"nested": []any{[]any{int64(1), int64(2)}},
+			},
+		},
+		{
+			name: "flow collections",
+			src:  `tags: [web, "api, v2", 3]` + "\n" + `labels: {env: prod, n: [1, 2]} # comment`,
+			want: map[string]any{
+				"tags":   []any{"web", "api, v2", int64(3)},
+				"labels": map[string]any{"env": "prod", "n": []any{int64(1), int64(2)}},
+			},
+		},
+		{
+			name: "block scalars",
+			src: `
+literal: |
+  line one
+    indented
+  line three
+folded: >-
+  one
+  two
+
+  three
+next: x
+`,
+			want: map[string]any{
+				"literal": "line one\n  indented\nline three\n",
+				"folded":  "one two\nthree",
+				"next":    "x",
+			},
+		},
+		{name: "top-level sequence", src: "- a\n- b: 1\n  c: 2\n", want: []any{"a", map[string]any{"b": int64(1), "c": int64(2)}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Unmarshal([]byte(tt.src))
+			if err != nil {
+				t.Fatalf("Unmarshal() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal() =\n%#v\nwant\n%#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{name: "duplicate key", src: "a: 1\na: 2", want: "line 2: duplicate key"},
+		{name: "bad indentation", src: "a: 1\n  b: 2", want: "line 2"},
+		{name: "tab", src: "a:\n\tb: 1", want: "tabs"},
+		{name: "not a mapping", src: "a: 1\njust text", want: "line 2"},
+		{name: "unterminated string", src: `a: "open`, want: "unterminated"},
+		{name: "unterminated flow", src: "a: [1, 2", want: "line 1"},
+		{name: "item in mapping", src: "a: 1\n- b", want: "sequence item"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Unmarshal([]byte(tt.src))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Unmarshal() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
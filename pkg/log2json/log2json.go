@@ -0,0 +1,302 @@
+// Package log2json converts log lines to JSON, so services can embed the
+// conversion the log2json command performs instead of running it.
+//
+//	p := log2json.NewPipeline(log2json.Options{AddFormat: true})
+//	if err := p.Run(ctx, os.Stdin, os.Stdout); err != nil {
+//		log.Fatal(err)
+//	}
+//
+// A Pipeline auto-detects the format of its input (JSON, key=value,
+// syslog, Apache, or generic text) or uses the one it is given, and writes
+// one JSON object per line (NDJSON). Stream passes the parsed entries to
+// a callback instead, for programs that want them as Go values.
+package log2json
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/juliosaraiva/log2json/internal/emitter"
+	"github.com/juliosaraiva/log2json/internal/parser"
+	"github.com/juliosaraiva/log2json/internal/reader"
+)
+
+// Entry is a parsed log line: its fields, the raw line, its 1-based line
+// number, the name of the format that parsed it and, if parsing failed,
+// the error.
+type Entry = parser.Entry
+
+// Errors an Entry's ParseError can wrap, for use with errors.Is.
+var (
+	ErrNoMatch     = parser.ErrNoMatch
+	ErrEmptyLine   = parser.ErrEmptyLine
+	ErrInvalidData = parser.ErrInvalidData
+)
+
+// ErrSkip, returned by an Options.OnError hook, drops the line.
+var ErrSkip = errors.New("skip line")
+
+// LineError describes a line that could not be parsed.
+type LineError struct {
+	Line int    // 1-based line number
+	Text string // the line
+	Err  error  // why it failed, such as ErrNoMatch
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// Options configures a Pipeline. The zero value auto-detects the format
+// and writes the parsed fields only.
+type Options struct {
+	// Format forces a format by name (json, kv, syslog, apache,
+	// generic); empty auto-detects it.
+	Format string
+
+	// Pattern parses every line with a regex whose named groups become
+	// fields. Patterns adds more, tried in order after Pattern until one
+	// matches, for applications logging several line shapes. They take
+	// precedence over Format.
+	Pattern  string
+	Patterns []string
+
+	// Adaptive detects the format of every line, for mixed streams.
+	// Otherwise the format parsing most of the first DetectLines lines
+	// (default 20) is used for the whole stream.
+	Adaptive    bool
+	DetectLines int
+
+	// Parsers restricts auto-detection to these formats, in this order.
+	Parsers []string
+
+	// NoInferTypes keeps key=value and regex values as strings instead of
+	// converting numbers and booleans.
+	NoInferTypes bool
+
+	// Fields limits the output to these fields; empty writes them all.
+	Fields []string
+
+	// Pretty indents the JSON, which is no longer one object per line.
+	Pretty bool
+
+	// AddTimestamp, AddLineNumber, AddRaw and AddFormat add the
+	// _ingestTime, _lineNumber, _raw and _format metadata fields.
+	AddTimestamp  bool
+	AddLineNumber bool
+	AddRaw        bool
+	AddFormat     bool
+
+	// OmitEmpty leaves out lines that fail to parse.
+	OmitEmpty bool
+
+	// OnError, if set, is called for every line that fails to parse
+	// (including empty lines, with ErrEmptyLine) and decides what happens
+	// to it: nil keeps the entry with its ParseError, as without a hook;
+	// ErrSkip drops it; any other error stops the run and is returned.
+	// Read errors, such as a line over MaxLineSize, always stop the run.
+	OnError func(*LineError) error
+
+	// MaxLineSize is the longest line accepted, in bytes (default 1 MiB;
+	// limits under 64 KiB act as 64 KiB). A longer line stops the run.
+	MaxLineSize int
+}
+
+// Pipeline converts a stream of log lines to JSON. A Pipeline holds no
+// state between runs, so one can be shared by several goroutines.
+type Pipeline struct {
+	opts Options
+}
+
+// NewPipeline creates a pipeline. Options are checked when it runs.
+func NewPipeline(opts Options) *Pipeline {
+	return &Pipeline{opts: opts}
+}
+
+// Run reads log lines from r until EOF and writes them to w as JSON. It
+// stops early with ctx's error once ctx is done; a read blocked in r
+// still has to return first. Returns error if the options are invalid or
+// reading or writing fails.
+func (p *Pipeline) Run(ctx context.Context, r io.Reader, w io.Writer) error {
+	registry, err := p.registry()
+	if err != nil {
+		return err
+	}
+
+	emit := emitter.New(w, emitter.Options{
+		Pretty:        p.opts.Pretty,
+		Fields:        p.opts.Fields,
+		AddTimestamp:  p.opts.AddTimestamp,
+		AddLineNumber: p.opts.AddLineNumber,
+		AddRaw:        p.opts.AddRaw,
+		AddFormat:     p.opts.AddFormat,
+		OmitEmpty:     p.opts.OmitEmpty,
+	})
+	err = p.run(ctx, registry, r, emit.Emit)
+	if closeErr := emit.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("cannot write output: %w", closeErr)
+	}
+	return err
+}
+
+// Stream reads log lines from r until EOF and calls fn with each parsed
+// entry, in input order. It stops with the first error fn returns, or
+// with ctx's error once ctx is done. The JSON output options (Fields,
+// Pretty, the Add options and OmitEmpty) do not apply; use OnError to
+// drop lines that fail to parse. Returns error if the options are invalid
+// or reading fails.
+func (p *Pipeline) Stream(ctx context.Context, r io.Reader, fn func(*Entry) error) error {
+	registry, err := p.registry()
+	if err != nil {
+		return err
+	}
+	return p.run(ctx, registry, r, fn)
+}
+
+// registry builds the parser registry for one run.
+func (p *Pipeline) registry() (*parser.Registry, error) {
+	if p.opts.DetectLines < 0 {
+		return nil, fmt.Errorf("invalid DetectLines: %d is negative", p.opts.DetectLines)
+	}
+	if p.opts.MaxLineSize < 0 {
+		return nil, fmt.Errorf("invalid MaxLineSize: %d is negative", p.opts.MaxLineSize)
+	}
+	inference := parser.WithTypeInference(parser.TypeInference{Disabled: p.opts.NoInferTypes})
+
+	patterns := p.opts.Patterns
+	if p.opts.Pattern != "" {
+		patterns = append([]string{p.opts.Pattern}, patterns...)
+	}
+	if len(patterns) > 0 {
+		regexParser, err := parser.NewRegexParser(patterns...)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Pattern: %w", err)
+		}
+		registry := parser.NewRegistry(parser.WithForcedFormat("regex"), inference)
+		registry.Register(regexParser)
+		return registry, nil
+	}
+
+	opts := []parser.RegistryOption{inference}
+	if p.opts.Format != "" {
+		opts = append(opts, parser.WithForcedFormat(p.opts.Format))
+	}
+	if p.opts.Adaptive {
+		opts = append(opts, parser.WithAdaptiveMode())
+	}
+	registry := parser.NewRegistry(opts...)
+
+	if len(p.opts.Parsers) > 0 {
+		if err := registry.Select(p.opts.Parsers); err != nil {
+			return nil, fmt.Errorf("invalid Parsers: %w", err)
+		}
+	}
+	if p.opts.Format != "" && registry.GetParser(p.opts.Format) == nil {
+		return nil, fmt.Errorf("unknown format %q", p.opts.Format)
+	}
+	return registry, nil
+}
+
+// detectWait bounds how long auto-detection waits for its sample, so a
+// slow live stream starts promptly.
+const detectWait = time.Second
+
+// run parses every line of r with registry and passes the entries to
+// handle, stopping at the first error.
+func (p *Pipeline) run(ctx context.Context, registry *parser.Registry, r io.Reader, handle func(*parser.Entry) error) error {
+	var readerOpts []reader.Option
+	if p.opts.MaxLineSize > 0 {
+		readerOpts = append(readerOpts, reader.WithMaxLineSize(p.opts.MaxLineSize))
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lines := reader.New(r, readerOpts...).LinesContext(ctx)
+
+	parse := func(line reader.Line) error {
+		if line.Err != nil {
+			return fmt.Errorf("read error at line %d: %w", line.Number, line.Err)
+		}
+		entry, err := registry.Parse(line.Text)
+		if err != nil {
+			return fmt.Errorf("parse error at line %d: %w", line.Number, err)
+		}
+		entry.LineNum = line.Number
+		if entry.ParseError != nil && p.opts.OnError != nil {
+			err := p.opts.OnError(&LineError{Line: line.Number, Text: line.Text, Err: entry.ParseError})
+			if errors.Is(err, ErrSkip) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return handle(entry)
+	}
+
+	// Pick the format from a sample of the first lines
+	if registry.AutoDetects() {
+		n := p.opts.DetectLines
+		if n == 0 {
+			n = parser.DefaultSampleSize
+		}
+		sample, err := sampleLines(ctx, lines, n)
+		if err != nil {
+			return err
+		}
+		texts := make([]string, 0, len(sample))
+		for _, line := range sample {
+			if line.Err == nil {
+				texts = append(texts, line.Text)
+			}
+		}
+		registry.Detect(texts)
+		for _, line := range sample {
+			if err := parse(line); err != nil {
+				return err
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case line, ok := <-lines:
+			if !ok {
+				return ctx.Err()
+			}
+			if err := parse(line); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sampleLines reads up to n lines, stopping early at the end of input or
+// once detectWait has passed.
+func sampleLines(ctx context.Context, lines <-chan reader.Line, n int) ([]reader.Line, error) {
+	sample := make([]reader.Line, 0, n)
+	timeout := time.NewTimer(detectWait)
+	defer timeout.Stop()
+	for len(sample) < n {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case line, ok := <-lines:
+			if !ok {
+				return sample, nil
+			}
+			sample = append(sample, line)
+		case <-timeout.C:
+			return sample, nil
+		}
+	}
+	return sample, nil
+}
@@ -0,0 +1,284 @@
+package log2json
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPipeline_Run(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		input string
+		want  []map[string]any
+	}{
+		{
+			name:  "auto-detects the format",
+			opts:  Options{AddFormat: true},
+			input: "user=alice status=200\nuser=bob status=404\n",
+			want: []map[string]any{
+				{"user": "alice", "status": float64(200), "_format": "kv"},
+				{"user": "bob", "status": float64(404), "_format": "kv"},
+			},
+		},
+		{
+			name:  "forced format",
+			opts:  Options{Format: "json", AddLineNumber: true},
+			input: `{"msg":"hello"}`,
+			want:  []map[string]any{{"msg": "hello", "_lineNumber": float64(1)}},
+		},
+		{
+			name:  "custom pattern without type inference",
+			opts:  Options{Pattern: `^(?P<level>\w+) (?P<code>\d+)$`, NoInferTypes: true},
+			input: "ERROR 42",
+			want:  []map[string]any{{"level": "ERROR", "code": "42"}},
+		},
+		{
+			name:  "several patterns",
+			opts:  Options{Pattern: `^(?P<level>[A-Z]+) (?P<code>\d+)$`, Patterns: []string{`^(?P<path>/\S*)$`}},
+			input: "ERROR 42\n/health\n",
+			want: []map[string]any{
+				{"level": "ERROR", "code": float64(42)},
+				{"path": "/health"},
+			},
+		},
+		{
+			name:  "selected fields and omitted failures",
+			opts:  Options{Format: "json", Fields: []string{"msg"}, OmitEmpty: true},
+			input: "{\"msg\":\"kept\",\"other\":1}\nnot json\n",
+			want:  []map[string]any{{"msg": "kept"}},
+		},
+		{
+			name:  "adaptive mode",
+			opts:  Options{Adaptive: true, AddFormat: true},
+			input: "{\"a\":1}\nx=1 y=2\n",
+			want: []map[string]any{
+				{"a": float64(1), "_format": "json"},
+				{"x": float64(1), "y": float64(2), "_format": "kv"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := NewPipeline(tt.opts).Run(context.Background(), strings.NewReader(tt.input), &out); err != nil {
+				t.Fatalf("Run() error: %v", err)
+			}
+
+			var got []map[string]any
+			dec := json.NewDecoder(&out)
+			for dec.More() {
+				var m map[string]any
+				if err := dec.Decode(&m); err != nil {
+					t.Fatalf("invalid JSON output: %v", err)
+				}
+				got = append(got, m)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d entries %v, want %d", len(got), got, len(tt.want))
+			}
+			for i := range got {
+				for k, v := range tt.want[i] {
+					if got[i][k] != v {
+						t.Errorf("entry %d: %s = %v, want %v", i, k, got[i][k], v)
+					}
+				}
+				if len(got[i]) != len(tt.want[i]) {
+					t.Errorf("entry %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPipeline_Run_InvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{name: "unknown format", opts: Options{Format: "nope"}, want: "unknown format"},
+		{name: "invalid pattern", opts: Options{Pattern: "("}, want: "invalid Pattern"},
+		{name: "invalid second pattern", opts: Options{Patterns: []string{"(?P<a>.)", "("}}, want: "pattern 2"},
+		{name: "unknown parser", opts: Options{Parsers: []string{"nope"}}, want: "invalid Parsers"},
+		{name: "negative detect lines", opts: Options{DetectLines: -1}, want: "invalid DetectLines: -1 is negative"},
+		{name: "negative max line size", opts: Options{MaxLineSize: -1}, want: "invalid MaxLineSize: -1 is negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewPipeline(tt.opts).Run(context.Background(), strings.NewReader("a=1 b=2"), io.Discard)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Run() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPipeline_Run_ZeroOptions(t *testing.T) {
+	// Zero selects the default, so it is not rejected like a negative value
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "zero detect lines", opts: Options{DetectLines: 0}},
+		{name: "zero max line size", opts: Options{MaxLineSize: 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NewPipeline(tt.opts).Run(context.Background(), strings.NewReader("a=1 b=2"), io.Discard); err != nil {
+				t.Errorf("Run() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestPipeline_Run_LineTooLong(t *testing.T) {
+	// Lines are read into a 64 KiB buffer, so smaller limits do not apply
+	p := NewPipeline(Options{MaxLineSize: 64 * 1024})
+	err := p.Run(context.Background(), strings.NewReader(strings.Repeat("x", 64*1024+1)), io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("Run() error = %v, want a read error at line 1", err)
+	}
+}
+
+func TestPipeline_Run_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// An endless input still stops
+	r := io.MultiReader(strings.NewReader("a=1 b=2\n"), neverEnding{})
+	err := NewPipeline(Options{}).Run(ctx, r, io.Discard)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v, want context.Canceled", err)
+	}
+}
+
+// neverEnding is an endless stream of key=value lines.
+type neverEnding struct{}
+
+func (neverEnding) Read(b []byte) (int, error) {
+	line := "k=v x=y\n"
+	n := 0
+	for n+len(line) <= len(b) {
+		n += copy(b[n:], line)
+	}
+	return n, nil
+}
+
+func TestPipeline_Stream(t *testing.T) {
+	input := "{\"msg\":\"one\"}\n{\"msg\":\"two\"}\n"
+
+	var entries []*Entry
+	err := NewPipeline(Options{}).Stream(context.Background(), strings.NewReader(input), func(e *Entry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream() error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	for i, want := range []string{"one", "two"} {
+		e := entries[i]
+		if e.Fields["msg"] != want || e.LineNum != i+1 || e.Format != "json" || e.ParseError != nil {
+			t.Errorf("entry %d = %+v", i, e)
+		}
+	}
+
+	// An error from the callback stops the stream and is returned as is
+	stop := errors.New("stop")
+	calls := 0
+	err = NewPipeline(Options{}).Stream(context.Background(), strings.NewReader(input), func(*Entry) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("Stream() = %v after %d calls, want stop after 1", err, calls)
+	}
+}
+
+func TestPipeline_Stream_OnError(t *testing.T) {
+	input := "{\"msg\":\"ok\"}\nnot json\n\n{\"msg\":\"last\"}\n"
+	stop := errors.New("stop")
+
+	tests := []struct {
+		name      string
+		onError   func(*LineError) error
+		wantLines []int
+		wantErr   error
+	}{
+		{name: "no hook keeps failures", wantLines: []int{1, 2, 3, 4}},
+		{name: "nil keeps failures", onError: func(*LineError) error { return nil }, wantLines: []int{1, 2, 3, 4}},
+		{name: "skip drops failures", onError: func(*LineError) error { return ErrSkip }, wantLines: []int{1, 4}},
+		{
+			name: "skip only empty lines",
+			onError: func(e *LineError) error {
+				if errors.Is(e, ErrEmptyLine) {
+					return ErrSkip
+				}
+				return nil
+			},
+			wantLines: []int{1, 2, 4},
+		},
+		{name: "error stops the stream", onError: func(*LineError) error { return stop }, wantLines: []int{1}, wantErr: stop},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lines []int
+			p := NewPipeline(Options{Format: "json", OnError: tt.onError})
+			err := p.Stream(context.Background(), strings.NewReader(input), func(e *Entry) error {
+				lines = append(lines, e.LineNum)
+				return nil
+			})
+			if err != tt.wantErr {
+				t.Errorf("Stream() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(lines, tt.wantLines) {
+				t.Errorf("lines = %v, want %v", lines, tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestPipeline_Stream_LineError(t *testing.T) {
+	var got *LineError
+	p := NewPipeline(Options{Format: "json", OnError: func(e *LineError) error {
+		got = e
+		return ErrSkip
+	}})
+	_ = p.Stream(context.Background(), strings.NewReader("{\"a\":1}\nnot json"), func(*Entry) error { return nil })
+
+	if got == nil || got.Line != 2 || got.Text != "not json" {
+		t.Fatalf("OnError got %+v", got)
+	}
+	var syntaxErr *json.SyntaxError
+	if !errors.As(got, &syntaxErr) {
+		t.Errorf("LineError %v should wrap the parse error", got)
+	}
+	if !strings.HasPrefix(got.Error(), "line 2: ") {
+		t.Errorf("Error() = %q", got.Error())
+	}
+}
+
+func TestPipeline_Stream_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := 0
+	err := NewPipeline(Options{Format: "kv"}).Stream(ctx, neverEnding{}, func(*Entry) error {
+		if n++; n == 3 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Stream() error = %v, want context.Canceled", err)
+	}
+}